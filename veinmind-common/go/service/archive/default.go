@@ -0,0 +1,61 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"golang.org/x/sync/errgroup"
+	"sync"
+)
+
+var (
+	defaultOnce   sync.Once
+	defaultError  error
+	defaultClient *archiveClient
+)
+
+func DefaultArchiveClient() *archiveClient {
+	defaultOnce.Do(func() {
+		hasService := false
+		if service.Hosted() {
+			ok, err := service.HasNamespace(Namespace)
+			if err != nil {
+				defaultError = err
+			}
+			hasService = ok
+		}
+
+		group, ctx := errgroup.WithContext(context.Background())
+		if hasService {
+			var list func(req Request) (Listing, error)
+			var extract func(req Request) (Content, error)
+			service.GetService(Namespace, "list", &list)
+			service.GetService(Namespace, "extract", &extract)
+
+			defaultClient = &archiveClient{
+				ctx:     ctx,
+				group:   group,
+				List:    list,
+				Extract: extract,
+			}
+		} else {
+			// Archives aren't walked without limits of runner
+			defaultClient = &archiveClient{
+				ctx:   ctx,
+				group: group,
+				List: func(req Request) (Listing, error) {
+					return Listing{}, errors.New("archive: please list archive in service mode")
+				},
+				Extract: func(req Request) (Content, error) {
+					return Content{}, errors.New("archive: please extract archive in service mode")
+				},
+			}
+		}
+	})
+
+	if defaultError != nil {
+		log.Error(defaultError)
+	}
+	return defaultClient
+}
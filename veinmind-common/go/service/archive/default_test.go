@@ -0,0 +1,14 @@
+package archive
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDefaultClient(t *testing.T) {
+	c := DefaultArchiveClient()
+	_, err := c.List(Request{ImageID: "sha256:aa", Path: "/app/lib.jar"})
+	assert.Error(t, err)
+	_, err = c.Extract(Request{ImageID: "sha256:aa", Path: "/app/lib.jar", Member: "META-INF/MANIFEST.MF"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,54 @@
+// Package archive provides archive service for plugins to list and
+// extract members of archives within images, nested archives included,
+// under limits of runner against archive bombs
+package archive
+
+// Separator joins path of archive and path of its member, e.g.
+// /app/lib.jar!/META-INF/MANIFEST.MF
+const Separator = "!/"
+
+// Request asks for members of archive at Path within image, Member is
+// the member extracted, which is a path joined by Separator for members
+// of nested archives
+type Request struct {
+	ImageID string `json:"image_id"`
+	Path    string `json:"path"`
+	Member  string `json:"member,omitempty"`
+}
+
+type Member struct {
+	Path string `json:"path"`
+	// Size is the size declared by archive, which may differ from the
+	// size of content of archive bombs
+	Size int64 `json:"size"`
+	Dir  bool  `json:"dir,omitempty"`
+	// Archive marks member which is an archive, its members follow it
+	Archive bool `json:"archive,omitempty"`
+	// Depth is the nesting depth of member, members of the archive in
+	// image are of depth 1
+	Depth int `json:"depth"`
+}
+
+// Limit is the limit of runner tripped by archive, such archive is
+// suspicious of being an archive bomb and is reported by runner.
+// Limits are shared by all plugins scanning an image
+type Limit struct {
+	// Name is one of size, depth and files
+	Name string `json:"name"`
+	Max  int64  `json:"max"`
+	// Archive is the archive or member being walked when limit tripped
+	Archive string `json:"archive"`
+}
+
+// Listing is members of archive walked before limit tripped, if any
+type Listing struct {
+	Members []Member `json:"members"`
+	Limit   *Limit   `json:"limit,omitempty"`
+}
+
+// Content is content of member extracted, it's empty if limit tripped
+type Content struct {
+	Member  Member `json:"member"`
+	Content []byte `json:"content,omitempty"`
+	Limit   *Limit `json:"limit,omitempty"`
+}
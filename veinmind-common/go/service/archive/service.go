@@ -0,0 +1,17 @@
+package archive
+
+import (
+	"context"
+	"golang.org/x/sync/errgroup"
+)
+
+// Namespace of archive service, the service is implemented by runner
+// which walks archives within limits
+const Namespace = "github.com/chaitin/veinmind-tools/veinmind-common/go/service/archive"
+
+type archiveClient struct {
+	ctx     context.Context
+	group   *errgroup.Group
+	List    func(req Request) (Listing, error)
+	Extract func(req Request) (Content, error)
+}
@@ -0,0 +1,54 @@
+package artifact
+
+import (
+	"context"
+	"errors"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"golang.org/x/sync/errgroup"
+	"sync"
+)
+
+var (
+	defaultOnce   sync.Once
+	defaultError  error
+	defaultClient *artifactClient
+)
+
+func DefaultArtifactClient() *artifactClient {
+	defaultOnce.Do(func() {
+		hasService := false
+		if service.Hosted() {
+			ok, err := service.HasNamespace(Namespace)
+			if err != nil {
+				defaultError = err
+			}
+			hasService = ok
+		}
+
+		group, ctx := errgroup.WithContext(context.Background())
+		if hasService {
+			var register func(artifact Artifact) (string, error)
+			service.GetService(Namespace, "register", &register)
+
+			defaultClient = &artifactClient{
+				ctx:      ctx,
+				group:    group,
+				Register: register,
+			}
+		} else {
+			defaultClient = &artifactClient{
+				ctx:   ctx,
+				group: group,
+				Register: func(artifact Artifact) (string, error) {
+					return "", errors.New("artifact: please register artifact in service mode")
+				},
+			}
+		}
+	})
+
+	if defaultError != nil {
+		log.Error(defaultError)
+	}
+	return defaultClient
+}
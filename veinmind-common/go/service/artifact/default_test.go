@@ -0,0 +1,12 @@
+package artifact
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDefaultClient(t *testing.T) {
+	c := DefaultArtifactClient()
+	_, err := c.Register(Artifact{ImageID: "sha256:aa", EventID: "1", Name: "yara.txt", Content: []byte("match")})
+	assert.Error(t, err)
+}
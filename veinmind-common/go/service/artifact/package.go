@@ -0,0 +1,19 @@
+// Package artifact provides artifact service for plugins to keep rich
+// output of events, e.g. match dumps and extracted configs
+package artifact
+
+// Artifact is a named output of an event registered by plugin, it
+// should be registered before the event is reported
+type Artifact struct {
+	ImageID string `json:"image_id"`
+	// EventID identifies the event of the artifact, it's defined by plugin
+	EventID string `json:"event_id"`
+	Name    string `json:"name"`
+	// Path is the file of event within image, events reporting the
+	// file are linked to the artifact
+	Path string `json:"path,omitempty"`
+	// Content or File is the artifact, File is a path on host which
+	// is copied by runner, e.g. files written into working directory
+	Content []byte `json:"content,omitempty"`
+	File    string `json:"file,omitempty"`
+}
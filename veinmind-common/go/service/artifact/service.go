@@ -0,0 +1,16 @@
+package artifact
+
+import (
+	"context"
+	"golang.org/x/sync/errgroup"
+)
+
+// Namespace of artifact service, the service is implemented by runner
+// which stores registered artifacts and returns paths of them
+const Namespace = "github.com/chaitin/veinmind-tools/veinmind-common/go/service/artifact"
+
+type artifactClient struct {
+	ctx      context.Context
+	group    *errgroup.Group
+	Register func(artifact Artifact) (string, error)
+}
@@ -0,0 +1,56 @@
+package hash
+
+import (
+	"context"
+	"errors"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"golang.org/x/sync/errgroup"
+	"sync"
+)
+
+var (
+	defaultOnce   sync.Once
+	defaultError  error
+	defaultClient *hashClient
+)
+
+func DefaultHashClient() *hashClient {
+	defaultOnce.Do(func() {
+		hasService := false
+		if service.Hosted() {
+			ok, err := service.HasNamespace(Namespace)
+			if err != nil {
+				defaultError = err
+			}
+			hasService = ok
+		}
+
+		group, ctx := errgroup.WithContext(context.Background())
+		if hasService {
+			var hash func(req Request) (Digest, error)
+			service.GetService(Namespace, "hash", &hash)
+
+			defaultClient = &hashClient{
+				ctx:    ctx,
+				group:  group,
+				hosted: true,
+				Hash:   hash,
+			}
+		} else {
+			// Runner of older version doesn't provide hash service
+			defaultClient = &hashClient{
+				ctx:   ctx,
+				group: group,
+				Hash: func(req Request) (Digest, error) {
+					return Digest{}, errors.New("hash: please request hash in service mode")
+				},
+			}
+		}
+	})
+
+	if defaultError != nil {
+		log.Error(defaultError)
+	}
+	return defaultClient
+}
@@ -0,0 +1,23 @@
+package hash
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDefaultClient(t *testing.T) {
+	c := DefaultHashClient()
+	_, err := c.Hash(Request{ImageID: "sha256:aa", Path: "/bin/sh"})
+	assert.Error(t, err)
+
+	// Digests are computed locally without runner
+	d, err := c.HashOrCompute(Request{ImageID: "sha256:aa", Path: "/bin/sh"}, func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("hello")), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", d.SHA256)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", d.MD5)
+}
@@ -0,0 +1,14 @@
+// Package hash provides hash service for plugins, runner hashes each
+// file of image once and shares the digests among plugins
+package hash
+
+// Request asks for digests of path within image
+type Request struct {
+	ImageID string `json:"image_id"`
+	Path    string `json:"path"`
+}
+
+type Digest struct {
+	SHA256 string `json:"sha256"`
+	MD5    string `json:"md5"`
+}
@@ -0,0 +1,52 @@
+package hash
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"golang.org/x/sync/errgroup"
+	"io"
+)
+
+// Namespace of hash service, the service is implemented by runner
+const Namespace = "github.com/chaitin/veinmind-tools/veinmind-common/go/service/hash"
+
+type hashClient struct {
+	ctx    context.Context
+	group  *errgroup.Group
+	hosted bool
+	Hash   func(req Request) (Digest, error)
+}
+
+// HashOrCompute asks runner for digests of path, digests are computed
+// from open when runner doesn't provide hash service
+func (c *hashClient) HashOrCompute(req Request, open func() (io.ReadCloser, error)) (Digest, error) {
+	if c.hosted {
+		if d, err := c.Hash(req); err == nil {
+			return d, nil
+		}
+	}
+
+	r, err := open()
+	if err != nil {
+		return Digest{}, err
+	}
+	defer r.Close()
+
+	return Compute(r)
+}
+
+// Compute computes digests of content of r
+func Compute(r io.Reader) (Digest, error) {
+	sha256Hash := sha256.New()
+	md5Hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(sha256Hash, md5Hash), r); err != nil {
+		return Digest{}, err
+	}
+
+	return Digest{
+		SHA256: hex.EncodeToString(sha256Hash.Sum(nil)),
+		MD5:    hex.EncodeToString(md5Hash.Sum(nil)),
+	}, nil
+}
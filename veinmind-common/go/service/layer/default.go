@@ -0,0 +1,55 @@
+package layer
+
+import (
+	"context"
+	"errors"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"golang.org/x/sync/errgroup"
+	"sync"
+)
+
+var (
+	defaultOnce   sync.Once
+	defaultError  error
+	defaultClient *layerClient
+)
+
+func DefaultLayerClient() *layerClient {
+	defaultOnce.Do(func() {
+		hasService := false
+		if service.Hosted() {
+			ok, err := service.HasNamespace(Namespace)
+			if err != nil {
+				defaultError = err
+			}
+			hasService = ok
+		}
+
+		group, ctx := errgroup.WithContext(context.Background())
+		if hasService {
+			var locate func(req Request) (Provenance, error)
+			service.GetService(Namespace, "locate", &locate)
+
+			defaultClient = &layerClient{
+				ctx:    ctx,
+				group:  group,
+				Locate: locate,
+			}
+		} else {
+			// Runner of older version doesn't provide layer service
+			defaultClient = &layerClient{
+				ctx:   ctx,
+				group: group,
+				Locate: func(req Request) (Provenance, error) {
+					return Provenance{}, errors.New("layer: please request layer in service mode")
+				},
+			}
+		}
+	})
+
+	if defaultError != nil {
+		log.Error(defaultError)
+	}
+	return defaultClient
+}
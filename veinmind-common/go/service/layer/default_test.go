@@ -0,0 +1,11 @@
+package layer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDefaultClient(t *testing.T) {
+	_, err := DefaultLayerClient().Locate(Request{ImageID: "sha256:aa", Path: "/bin/sh"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,19 @@
+// Package layer lets plugins ask runner which layer of image introduced
+// a file, runner walks layers of each image once and shares the index
+// among plugins
+package layer
+
+// Request asks for provenance of path within image
+type Request struct {
+	ImageID string `json:"image_id"`
+	Path    string `json:"path"`
+}
+
+// Provenance is the topmost layer containing path, CreatedBy is the
+// Dockerfile instruction creating the layer from history of image
+type Provenance struct {
+	Path      string `json:"path"`
+	Index     int    `json:"index"`
+	Digest    string `json:"digest"`
+	CreatedBy string `json:"created_by,omitempty"`
+}
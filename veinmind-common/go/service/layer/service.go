@@ -0,0 +1,15 @@
+package layer
+
+import (
+	"context"
+	"golang.org/x/sync/errgroup"
+)
+
+// Namespace of layer service, the service is implemented by runner
+const Namespace = "github.com/chaitin/veinmind-tools/veinmind-common/go/service/layer"
+
+type layerClient struct {
+	ctx    context.Context
+	group  *errgroup.Group
+	Locate func(req Request) (Provenance, error)
+}
@@ -0,0 +1,59 @@
+package pool
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"golang.org/x/sync/errgroup"
+	"sync"
+)
+
+var (
+	defaultOnce   sync.Once
+	defaultError  error
+	defaultClient *poolClient
+)
+
+func DefaultPoolClient() *poolClient {
+	defaultOnce.Do(func() {
+		hasService := false
+		if service.Hosted() {
+			ok, err := service.HasNamespace(Namespace)
+			if err != nil {
+				defaultError = err
+			}
+			hasService = ok
+		}
+
+		group, ctx := errgroup.WithContext(context.Background())
+		if hasService {
+			var next func(result Result) (Task, error)
+			service.GetService(Namespace, "next", &next)
+
+			defaultClient = &poolClient{
+				ctx:   ctx,
+				group: group,
+				Next:  next,
+			}
+		} else {
+			// Standalone plugin and runner without pool scan once
+			defaultClient = &poolClient{
+				ctx:   ctx,
+				group: group,
+				Next: func(result Result) (Task, error) {
+					return Task{Stop: true}, nil
+				},
+			}
+		}
+	})
+
+	if defaultError != nil {
+		log.Error(defaultError)
+	}
+	return defaultClient
+}
+
+// NewPoolService creates service handing out tasks by next
+func NewPoolService(next func(result Result) (Task, error)) *PoolService {
+	return &PoolService{next: next}
+}
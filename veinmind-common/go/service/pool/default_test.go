@@ -0,0 +1,41 @@
+package pool
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDefaultClient(t *testing.T) {
+	scanned := 0
+	err := DefaultPoolClient().Serve(nil, func(ids []string) error {
+		scanned++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, scanned)
+}
+
+func TestServe(t *testing.T) {
+	tasks := []Task{{ImageIDs: []string{"sha256:bb"}}, {ImageIDs: []string{"sha256:cc"}}, {Stop: true}}
+	results := []Result{}
+	s := NewPoolService(func(result Result) (Task, error) {
+		results = append(results, result)
+		task := tasks[0]
+		tasks = tasks[1:]
+		return task, nil
+	})
+	c := &poolClient{Next: s.Next}
+
+	scanned := []string{}
+	err := c.Serve(errors.New("open sha256:aa"), func(ids []string) error {
+		scanned = append(scanned, ids...)
+		if ids[0] == "sha256:cc" {
+			return errors.New("scan sha256:cc")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sha256:bb", "sha256:cc"}, scanned)
+	assert.Equal(t, []Result{{Error: "open sha256:aa"}, {}, {Error: "scan sha256:cc"}}, results)
+}
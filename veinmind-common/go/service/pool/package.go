@@ -0,0 +1,20 @@
+// Package pool lets long-lived plugin processes scan successive
+// targets, so that runner in server mode doesn't start plugins for
+// every request. Plugins advertise support by Tag in their manifest,
+// scan the images they're started with and then ask runner for the
+// next task until told to stop
+package pool
+
+// Tag is the manifest tag of plugins supporting pool
+const Tag = "pool"
+
+// Result is the result of the task scanned last
+type Result struct {
+	Error string `json:"error,omitempty"`
+}
+
+// Task is images to scan, the process should exit when Stop is set
+type Task struct {
+	ImageIDs []string `json:"image_ids,omitempty"`
+	Stop     bool     `json:"stop,omitempty"`
+}
@@ -0,0 +1,54 @@
+package pool
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"golang.org/x/sync/errgroup"
+)
+
+const Namespace = "github.com/chaitin/veinmind-tools/veinmind-common/go/service/pool"
+
+// PoolService hands out tasks to a pooled plugin process, next is
+// told the result of the last task and blocks until the next one
+type PoolService struct {
+	next func(result Result) (Task, error)
+}
+
+type poolClient struct {
+	ctx   context.Context
+	group *errgroup.Group
+	Next  func(result Result) (Task, error)
+}
+
+func (s *PoolService) Next(result Result) (Task, error) {
+	return s.next(result)
+}
+
+func (s *PoolService) Add(registry *service.Registry) {
+	registry.Define(Namespace, struct{}{})
+	registry.AddService(Namespace, "next", s.Next)
+}
+
+// Serve scans tasks handed out by runner until told to stop, images
+// the process is started with are expected to be scanned before
+func (c *poolClient) Serve(first error, scan func(ids []string) error) error {
+	result := Result{}
+	if first != nil {
+		result.Error = first.Error()
+	}
+
+	for {
+		task, err := c.Next(result)
+		if err != nil {
+			return err
+		}
+		if task.Stop {
+			return nil
+		}
+
+		result = Result{}
+		if err := scan(task.ImageIDs); err != nil {
+			result.Error = err.Error()
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package quarantine
+
+import (
+	"context"
+	"errors"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"golang.org/x/sync/errgroup"
+	"sync"
+)
+
+var (
+	defaultOnce   sync.Once
+	defaultError  error
+	defaultClient *quarantineClient
+)
+
+func DefaultQuarantineClient() *quarantineClient {
+	defaultOnce.Do(func() {
+		hasService := false
+		if service.Hosted() {
+			ok, err := service.HasNamespace(Namespace)
+			if err != nil {
+				defaultError = err
+			}
+			hasService = ok
+		}
+
+		group, ctx := errgroup.WithContext(context.Background())
+		if hasService {
+			var submit func(file File) (string, error)
+			service.GetService(Namespace, "submit", &submit)
+
+			defaultClient = &quarantineClient{
+				ctx:    ctx,
+				group:  group,
+				Submit: submit,
+			}
+		} else {
+			defaultClient = &quarantineClient{
+				ctx:   ctx,
+				group: group,
+				Submit: func(file File) (string, error) {
+					return "", errors.New("quarantine: please submit file in service mode")
+				},
+			}
+		}
+	})
+
+	if defaultError != nil {
+		log.Error(defaultError)
+	}
+	return defaultClient
+}
@@ -0,0 +1,12 @@
+package quarantine
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDefaultClient(t *testing.T) {
+	c := DefaultQuarantineClient()
+	_, err := c.Submit(File{ImageID: "sha256:aa", Path: "/bin/miner"})
+	assert.Error(t, err)
+}
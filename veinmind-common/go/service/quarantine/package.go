@@ -0,0 +1,13 @@
+// Package quarantine provides quarantine service for plugins to
+// preserve copies of flagged files before the image is removed
+package quarantine
+
+// File is a flagged file submitted by plugin, it should be submitted
+// before the event of the file is reported
+type File struct {
+	ImageID string `json:"image_id"`
+	Path    string `json:"path"`
+	// EventID identifies the event of the file, it's defined by plugin
+	EventID string `json:"event_id,omitempty"`
+	Content []byte `json:"content"`
+}
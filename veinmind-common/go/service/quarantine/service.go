@@ -0,0 +1,16 @@
+package quarantine
+
+import (
+	"context"
+	"golang.org/x/sync/errgroup"
+)
+
+// Namespace of quarantine service, the service is implemented by runner
+// which stores submitted files and returns paths of the artifacts
+const Namespace = "github.com/chaitin/veinmind-tools/veinmind-common/go/service/quarantine"
+
+type quarantineClient struct {
+	ctx    context.Context
+	group  *errgroup.Group
+	Submit func(file File) (string, error)
+}
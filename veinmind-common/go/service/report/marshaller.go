@@ -53,6 +53,9 @@ var (
 		Weakpass:        "Weakpass",
 		Asset:           "Asset",
 		Basic:           "Basic",
+		Signature:       "Signature",
+		Build:           "Build",
+		Archive:         "Archive",
 	}
 
 	fromAlertType = map[string]AlertType{
@@ -64,6 +67,9 @@ var (
 		"Weakpass":        Weakpass,
 		"Asset":           Asset,
 		"Basic":           Basic,
+		"Signature":       Signature,
+		"Build":           Build,
+		"Archive":         Archive,
 	}
 
 	toWeakpassService = map[WeakpassService]string{
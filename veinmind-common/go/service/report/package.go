@@ -43,6 +43,9 @@ const (
 	Weakpass
 	Asset
 	Basic
+	Signature
+	Build
+	Archive
 )
 
 type WeakpassService uint32
@@ -60,6 +63,9 @@ type AlertDetail struct {
 	HistoryDetail       *HistoryDetail       `json:"history_detail,omitempty"`
 	AssetDetail         *AssetDetail         `json:"asset_detail,omitempty"`
 	BasicDetail         *BasicDetail         `json:"basic_detail,omitempty"`
+	SignatureDetail     *SignatureDetail     `json:"signature_detail,omitempty"`
+	BuildDetail         *BuildDetail         `json:"build_detail,omitempty"`
+	ArchiveDetail       *ArchiveDetail       `json:"archive_detail,omitempty"`
 }
 
 type FileDetail struct {
@@ -73,6 +79,9 @@ type FileDetail struct {
 	Ctim  int64       `json:"ctim"`
 	Mtim  int64       `json:"mtim"`
 	Atim  int64       `json:"atim"`
+
+	// SHA256 of file content, it's optional and used for threat intelligence lookup
+	SHA256 string `json:"sha256,omitempty"`
 }
 
 type MaliciousFileDetail struct {
@@ -163,6 +172,33 @@ type BasicDetail struct {
 	Author      string   `json:"author"`
 }
 
+type SignatureDetail struct {
+	Reference string `json:"reference"`
+	Digest    string `json:"digest"`
+	Scheme    string `json:"scheme"`
+	Reason    string `json:"reason"`
+}
+
+// BuildDetail is a risky instruction found in build history of image,
+// Index is the position of the instruction in history
+type BuildDetail struct {
+	Index       int    `json:"index"`
+	Instruction string `json:"instruction"`
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+}
+
+// ArchiveDetail is an archive within image which tripped limits of
+// archive service, e.g. an archive bomb
+type ArchiveDetail struct {
+	Path string `json:"path"`
+	// Member is the nested archive or member being walked when limit
+	// tripped
+	Member string `json:"member,omitempty"`
+	Limit  string `json:"limit"`
+	Max    int64  `json:"max"`
+}
+
 type ReportEvent struct {
 	ID           string        `json:"id"`
 	Time         time.Time     `json:"time"`
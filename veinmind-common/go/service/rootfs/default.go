@@ -0,0 +1,56 @@
+package rootfs
+
+import (
+	"context"
+	"errors"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"golang.org/x/sync/errgroup"
+	"sync"
+)
+
+var (
+	defaultOnce   sync.Once
+	defaultError  error
+	defaultClient *rootfsClient
+)
+
+func DefaultRootfsClient() *rootfsClient {
+	defaultOnce.Do(func() {
+		hasService := false
+		if service.Hosted() {
+			ok, err := service.HasNamespace(Namespace)
+			if err != nil {
+				defaultError = err
+			}
+			hasService = ok
+		}
+
+		group, ctx := errgroup.WithContext(context.Background())
+		if hasService {
+			var rootfs func(req Request) (Rootfs, error)
+			service.GetService(Namespace, "rootfs", &rootfs)
+
+			defaultClient = &rootfsClient{
+				ctx:    ctx,
+				group:  group,
+				hosted: true,
+				Rootfs: rootfs,
+			}
+		} else {
+			// Runner serves rootfs only to plugins declaring Tag
+			defaultClient = &rootfsClient{
+				ctx:   ctx,
+				group: group,
+				Rootfs: func(req Request) (Rootfs, error) {
+					return Rootfs{}, errors.New("rootfs: please declare rootfs tag and run in service mode")
+				},
+			}
+		}
+	})
+
+	if defaultError != nil {
+		log.Error(defaultError)
+	}
+	return defaultClient
+}
@@ -0,0 +1,13 @@
+package rootfs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDefaultClient(t *testing.T) {
+	c := DefaultRootfsClient()
+	assert.False(t, c.Hosted())
+	_, err := c.Rootfs(Request{ImageID: "sha256:aa"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,22 @@
+// Package rootfs provides rootfs service for plugins which need merged
+// filesystem of image as a plain directory, e.g. external antivirus
+// engines. Plugins declare Tag in their manifest, runner materializes
+// rootfs of image on their first request and removes it once the image
+// is scanned
+package rootfs
+
+// Tag is the manifest tag of plugins needing rootfs of images
+const Tag = "rootfs"
+
+// Request asks for rootfs of image being scanned
+type Request struct {
+	ImageID string `json:"image_id"`
+}
+
+// Rootfs is the directory holding merged filesystem of image, plugins
+// must treat it as read-only since files may be hard links of content
+// of image. Symbolic links are kept as they are, so absolute ones point
+// outside Path
+type Rootfs struct {
+	Path string `json:"path"`
+}
@@ -0,0 +1,22 @@
+package rootfs
+
+import (
+	"context"
+	"golang.org/x/sync/errgroup"
+)
+
+// Namespace of rootfs service, the service is implemented by runner
+const Namespace = "github.com/chaitin/veinmind-tools/veinmind-common/go/service/rootfs"
+
+type rootfsClient struct {
+	ctx    context.Context
+	group  *errgroup.Group
+	hosted bool
+	Rootfs func(req Request) (Rootfs, error)
+}
+
+// Hosted returns whether runner provides rootfs service, plugins must
+// read images by filesystem API otherwise
+func (c *rootfsClient) Hosted() bool {
+	return c.hosted
+}
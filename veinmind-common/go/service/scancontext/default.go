@@ -0,0 +1,64 @@
+package scancontext
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"golang.org/x/sync/errgroup"
+	"sync"
+	"time"
+)
+
+var (
+	defaultOnce   sync.Once
+	defaultError  error
+	defaultClient *scanContextClient
+)
+
+func DefaultScanContextClient() *scanContextClient {
+	defaultOnce.Do(func() {
+		hasService := false
+		if service.Hosted() {
+			ok, err := service.HasNamespace(Namespace)
+			if err != nil {
+				defaultError = err
+			}
+			hasService = ok
+		}
+
+		group, ctx := errgroup.WithContext(context.Background())
+		if hasService {
+			var query func(req Request) (Response, error)
+			service.GetService(Namespace, "query", &query)
+
+			defaultClient = &scanContextClient{
+				ctx:   ctx,
+				group: group,
+				Query: query,
+			}
+		} else {
+			// Standalone plugin and runner of older version have no context
+			defaultClient = &scanContextClient{
+				ctx:   ctx,
+				group: group,
+				Query: func(req Request) (Response, error) {
+					return Response{SchemaVersion: SchemaVersion, Type: TypeStandalone}, nil
+				},
+			}
+		}
+	})
+
+	if defaultError != nil {
+		log.Error(defaultError)
+	}
+	return defaultClient
+}
+
+// NewScanContextService creates service of context of image scan
+func NewScanContextService(imageID string, context Response) *ScanContextService {
+	return &ScanContextService{
+		imageID: imageID,
+		context: context,
+		now:     time.Now,
+	}
+}
@@ -0,0 +1,58 @@
+package scancontext
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDefaultClient(t *testing.T) {
+	c := DefaultScanContextClient()
+	resp, err := c.Query(Request{SchemaVersion: SchemaVersion, ImageID: "sha256:aa"})
+	assert.NoError(t, err)
+	assert.Equal(t, TypeStandalone, resp.Type)
+	assert.Equal(t, SchemaVersion, resp.SchemaVersion)
+	assert.True(t, resp.Unlimited())
+}
+
+func TestScanContextService(t *testing.T) {
+	now := time.Date(2022, 5, 26, 2, 36, 45, 0, time.UTC)
+	s := NewScanContextService("sha256:aa", Response{
+		Type:      TypeRegistry,
+		Target:    "harbor.internal/team/app:v1",
+		Threshold: "high",
+		Deadline:  now.Add(time.Minute),
+	})
+	s.now = func() time.Time { return now }
+
+	resp, err := s.Query(Request{SchemaVersion: SchemaVersion, ImageID: "sha256:aa"})
+	assert.NoError(t, err)
+	assert.Equal(t, Response{
+		SchemaVersion: SchemaVersion,
+		Type:          TypeRegistry,
+		Target:        "harbor.internal/team/app:v1",
+		Threshold:     "high",
+		Deadline:      now.Add(time.Minute),
+		Remaining:     time.Minute,
+	}, resp)
+	assert.False(t, resp.Unlimited())
+
+	s.now = func() time.Time { return now.Add(time.Hour) }
+	resp, err = s.Query(Request{SchemaVersion: SchemaVersion, ImageID: "sha256:bb"})
+	assert.NoError(t, err)
+	assert.Empty(t, resp.Target)
+	assert.Equal(t, time.Duration(0), resp.Remaining)
+
+	resp, err = NewScanContextService("sha256:aa", Response{Type: TypeHost}).Query(Request{ImageID: "sha256:aa"})
+	assert.NoError(t, err)
+	assert.True(t, resp.Unlimited())
+	assert.Equal(t, time.Duration(0), resp.Remaining)
+
+	s = NewScanContextService("sha256:aa", Response{Type: TypeHost, Deadline: now.Add(time.Minute)})
+	s.now = func() time.Time { return now }
+	s.SetDeadline(now.Add(time.Hour))
+	s.SetDeadline(now.Add(time.Second))
+	resp, err = s.Query(Request{ImageID: "sha256:aa"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, resp.Remaining)
+}
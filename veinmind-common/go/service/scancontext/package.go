@@ -0,0 +1,43 @@
+// Package scancontext lets plugins query the context of the scan they
+// run in, e.g. to run lighter checks in admission mode. Request and
+// Response are versioned, fields are only added within a version
+package scancontext
+
+import "time"
+
+// SchemaVersion of Request and Response
+const SchemaVersion = 1
+
+// Types of scan
+const (
+	TypeHost      = "host"
+	TypeRegistry  = "registry"
+	TypeManifest  = "manifest"
+	TypeAdmission = "admission"
+	// TypeStandalone is returned when plugin isn't run by runner
+	TypeStandalone = "standalone"
+)
+
+type Request struct {
+	SchemaVersion int    `json:"schema_version"`
+	ImageID       string `json:"image_id"`
+}
+
+type Response struct {
+	SchemaVersion int    `json:"schema_version"`
+	Type          string `json:"type"`
+	// Target is the original reference of target scanned
+	Target string `json:"target,omitempty"`
+	// Threshold is the requested severity threshold, e.g. high, empty
+	// if none is requested
+	Threshold string `json:"threshold,omitempty"`
+	// Deadline of the scan, zero means unlimited. Remaining is the time
+	// budget remaining when queried, it's only meaningful with Deadline
+	Deadline  time.Time     `json:"deadline,omitempty"`
+	Remaining time.Duration `json:"remaining,omitempty"`
+}
+
+// Unlimited reports whether the scan has no time budget
+func (r Response) Unlimited() bool {
+	return r.Deadline.IsZero()
+}
@@ -0,0 +1,53 @@
+package scancontext
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"golang.org/x/sync/errgroup"
+	"time"
+)
+
+const Namespace = "github.com/chaitin/veinmind-tools/veinmind-common/go/service/scancontext"
+
+// ScanContextService serves context of a plugin execution
+type ScanContextService struct {
+	imageID string
+	context Response
+	now     func() time.Time
+}
+
+type scanContextClient struct {
+	ctx   context.Context
+	group *errgroup.Group
+	Query func(req Request) (Response, error)
+}
+
+// Query returns context of scan, images other than the one scanned get
+// context without target
+func (s *ScanContextService) Query(req Request) (Response, error) {
+	resp := s.context
+	resp.SchemaVersion = SchemaVersion
+	if req.ImageID != s.imageID {
+		resp.Target = ""
+	}
+	if !resp.Deadline.IsZero() {
+		resp.Remaining = resp.Deadline.Sub(s.now())
+		if resp.Remaining < 0 {
+			resp.Remaining = 0
+		}
+	}
+	return resp, nil
+}
+
+// SetDeadline sets deadline of plugin execution if it's earlier than
+// deadline of the scan
+func (s *ScanContextService) SetDeadline(deadline time.Time) {
+	if s.context.Deadline.IsZero() || deadline.Before(s.context.Deadline) {
+		s.context.Deadline = deadline
+	}
+}
+
+func (s *ScanContextService) Add(registry *service.Registry) {
+	registry.Define(Namespace, struct{}{})
+	registry.AddService(Namespace, "query", s.Query)
+}
@@ -0,0 +1,61 @@
+package scope
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"golang.org/x/sync/errgroup"
+	"sync"
+)
+
+var (
+	defaultOnce   sync.Once
+	defaultError  error
+	defaultClient *scopeClient
+)
+
+func DefaultScopeClient() *scopeClient {
+	defaultOnce.Do(func() {
+		hasService := false
+		if service.Hosted() {
+			ok, err := service.HasNamespace(Namespace)
+			if err != nil {
+				defaultError = err
+			}
+			hasService = ok
+		}
+
+		group, ctx := errgroup.WithContext(context.Background())
+		if hasService {
+			var layers func(imageID string) ([]string, error)
+			service.GetService(Namespace, "layers", &layers)
+
+			defaultClient = &scopeClient{
+				ctx:    ctx,
+				group:  group,
+				Layers: layers,
+			}
+		} else {
+			// Standalone plugin scans the whole image
+			defaultClient = &scopeClient{
+				ctx:   ctx,
+				group: group,
+				Layers: func(imageID string) ([]string, error) {
+					return nil, nil
+				},
+			}
+		}
+	})
+
+	if defaultError != nil {
+		log.Error(defaultError)
+	}
+	return defaultClient
+}
+
+func NewScopeService(imageID string, layers []string) *ScopeService {
+	return &ScopeService{
+		imageID: imageID,
+		layers:  layers,
+	}
+}
@@ -0,0 +1,29 @@
+package scope
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDefaultClient(t *testing.T) {
+	c := DefaultScopeClient()
+	layers, err := c.Layers("sha256:aa")
+	assert.NoError(t, err)
+	assert.Nil(t, layers)
+	assert.True(t, c.InScope("sha256:aa", "sha256:bb"))
+}
+
+func TestScopeService(t *testing.T) {
+	s := NewScopeService("sha256:aa", []string{"sha256:bb"})
+	assert.False(t, s.Queried())
+
+	layers, err := s.Layers("sha256:aa")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sha256:bb"}, layers)
+	assert.True(t, s.Queried())
+
+	c := &scopeClient{Layers: s.Layers}
+	assert.True(t, c.InScope("sha256:aa", "sha256:bb"))
+	assert.False(t, c.InScope("sha256:aa", "sha256:cc"))
+	assert.True(t, c.InScope("sha256:dd", "sha256:cc"))
+}
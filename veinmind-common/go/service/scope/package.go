@@ -0,0 +1,3 @@
+// Package scope restricts scan of plugins to selected layers of image,
+// plugins query the layers in scope and may skip unchanged content
+package scope
@@ -0,0 +1,65 @@
+package scope
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"golang.org/x/sync/errgroup"
+	"sync"
+)
+
+const Namespace = "github.com/chaitin/veinmind-tools/veinmind-common/go/service/scope"
+
+// ScopeService serves layers in scope of a plugin execution
+type ScopeService struct {
+	imageID string
+	layers  []string
+	mu      sync.Mutex
+	queried bool
+}
+
+type scopeClient struct {
+	ctx   context.Context
+	group *errgroup.Group
+	// Layers returns diff ids of layers in scope of image, nil means
+	// the whole image is in scope
+	Layers func(imageID string) ([]string, error)
+}
+
+func (s *ScopeService) Layers(imageID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queried = true
+
+	if imageID != s.imageID {
+		return nil, nil
+	}
+	return s.layers, nil
+}
+
+// Queried reports whether plugin has queried the layers in scope, plugins
+// which haven't queried them scan the whole image
+func (s *ScopeService) Queried() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queried
+}
+
+func (s *ScopeService) Add(registry *service.Registry) {
+	registry.Define(Namespace, struct{}{})
+	registry.AddService(Namespace, "layers", s.Layers)
+}
+
+// InScope reports whether layer of diff id is in scope of image
+func (c *scopeClient) InScope(imageID string, diffID string) bool {
+	layers, err := c.Layers(imageID)
+	if err != nil || layers == nil {
+		return true
+	}
+
+	for _, l := range layers {
+		if l == diffID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package walk
+
+import (
+	"context"
+	"errors"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"golang.org/x/sync/errgroup"
+	"sync"
+)
+
+var (
+	defaultOnce   sync.Once
+	defaultError  error
+	defaultClient *walkClient
+)
+
+func DefaultWalkClient() *walkClient {
+	defaultOnce.Do(func() {
+		hasService := false
+		if service.Hosted() {
+			ok, err := service.HasNamespace(Namespace)
+			if err != nil {
+				defaultError = err
+			}
+			hasService = ok
+		}
+
+		group, ctx := errgroup.WithContext(context.Background())
+		if hasService {
+			var walk func(req Request) (Page, error)
+			service.GetService(Namespace, "walk", &walk)
+
+			defaultClient = &walkClient{
+				ctx:    ctx,
+				group:  group,
+				hosted: true,
+				Walk:   walk,
+			}
+		} else {
+			// Runner of older version doesn't provide walk service
+			defaultClient = &walkClient{
+				ctx:   ctx,
+				group: group,
+				Walk: func(req Request) (Page, error) {
+					return Page{}, errors.New("walk: please walk image in service mode")
+				},
+			}
+		}
+	})
+
+	if defaultError != nil {
+		log.Error(defaultError)
+	}
+	return defaultClient
+}
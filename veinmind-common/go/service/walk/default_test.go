@@ -0,0 +1,16 @@
+package walk
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDefaultClient(t *testing.T) {
+	c := DefaultWalkClient()
+	assert.False(t, c.Hosted())
+	_, err := c.Walk(Request{ImageID: "sha256:aa", Filter: Filter{Extensions: []string{".jar"}}})
+	assert.Error(t, err)
+	assert.Error(t, c.Each("sha256:aa", Filter{}, func(e Entry) error {
+		return nil
+	}))
+}
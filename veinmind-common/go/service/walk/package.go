@@ -0,0 +1,49 @@
+// Package walk provides walk service for plugins, runner walks merged
+// filesystem of each image once and serves entries matching filters of
+// plugins, so that plugins don't walk the image each
+package walk
+
+import "os"
+
+// Filter selects entries served to plugin, entries match if they match
+// all criteria given. Extensions match names case-insensitively, e.g.
+// ".jar", and Globs match path or base name of entry. Directories are
+// only served with Dirs, and regular files carry digests with Hash
+type Filter struct {
+	Extensions []string `json:"extensions,omitempty"`
+	Globs      []string `json:"globs,omitempty"`
+	MinSize    int64    `json:"min_size,omitempty"`
+	// MaxSize is the max size of entries, 0 means unlimited
+	MaxSize int64 `json:"max_size,omitempty"`
+	Dirs    bool  `json:"dirs,omitempty"`
+	Hash    bool  `json:"hash,omitempty"`
+}
+
+// Request asks for a page of entries of image matching Filter from
+// Cursor on, which is Next of the previous page and 0 at first. Limit
+// is the max number of entries of page, runner decides if it's 0
+type Request struct {
+	ImageID string `json:"image_id"`
+	Filter  Filter `json:"filter"`
+	Cursor  int    `json:"cursor"`
+	Limit   int    `json:"limit,omitempty"`
+}
+
+// Entry is a file of merged filesystem of image, Error is why digests
+// asked for aren't given
+type Entry struct {
+	Path   string      `json:"path"`
+	Mode   os.FileMode `json:"mode"`
+	Size   int64       `json:"size"`
+	SHA256 string      `json:"sha256,omitempty"`
+	MD5    string      `json:"md5,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// Page is entries of a request, Done is set once all entries of image
+// are walked
+type Page struct {
+	Entries []Entry `json:"entries"`
+	Next    int     `json:"next"`
+	Done    bool    `json:"done"`
+}
@@ -0,0 +1,43 @@
+package walk
+
+import (
+	"context"
+	"golang.org/x/sync/errgroup"
+)
+
+// Namespace of walk service, the service is implemented by runner
+const Namespace = "github.com/chaitin/veinmind-tools/veinmind-common/go/service/walk"
+
+type walkClient struct {
+	ctx    context.Context
+	group  *errgroup.Group
+	hosted bool
+	Walk   func(req Request) (Page, error)
+}
+
+// Hosted returns whether runner provides walk service, plugins walk
+// images by themselves otherwise
+func (c *walkClient) Hosted() bool {
+	return c.hosted
+}
+
+// Each calls fn on entries of image matching filter page by page, it
+// stops at the first error of fn
+func (c *walkClient) Each(imageID string, filter Filter, fn func(e Entry) error) error {
+	req := Request{ImageID: imageID, Filter: filter}
+	for {
+		page, err := c.Walk(req)
+		if err != nil {
+			return err
+		}
+		for _, e := range page.Entries {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if page.Done {
+			return nil
+		}
+		req.Cursor = page.Next
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/adaptive"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/walk"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"strconv"
+	"time"
+)
+
+// defaultThreads is number of plugins executed in parallel without
+// --threads
+const defaultThreads = 5
+
+// threadsAdaptive is value of --threads picking threads per image
+const threadsAdaptive = "adaptive"
+
+// threadsValue is value of --threads, a number of plugins executed in
+// parallel or adaptive
+type threadsValue struct {
+	threads  int
+	adaptive bool
+}
+
+func newThreadsValue(threads int) *threadsValue {
+	return &threadsValue{threads: threads}
+}
+
+func (v *threadsValue) String() string {
+	if v.adaptive {
+		return threadsAdaptive
+	}
+	return strconv.Itoa(v.threads)
+}
+
+func (v *threadsValue) Set(s string) error {
+	if s == threadsAdaptive {
+		v.threads, v.adaptive = defaultThreads, true
+		return nil
+	}
+	threads, err := strconv.Atoi(s)
+	if err != nil {
+		return errors.Errorf("threads must be a number or %s", threadsAdaptive)
+	}
+	v.threads, v.adaptive = threads, false
+	return nil
+}
+
+func (v *threadsValue) Type() string {
+	return "threads"
+}
+
+var (
+	adaptiveThreads *adaptive.Threads
+	memoryBudget    *adaptive.Budget
+)
+
+// scanThreads returns threads of command, and whether they're picked
+// per image by --threads adaptive
+func scanThreads(c *cobra.Command) (int, bool) {
+	f := c.Flags().Lookup("threads")
+	if f == nil {
+		return defaultThreads, false
+	}
+	if v, ok := f.Value.(*threadsValue); ok {
+		return v.threads, v.adaptive
+	}
+	threads, err := c.Flags().GetInt("threads")
+	if err != nil {
+		return defaultThreads, false
+	}
+	return threads, false
+}
+
+// configureAdaptive sets up threads picked per image and memory budget
+// of images in flight
+func configureAdaptive(c *cobra.Command) error {
+	adaptiveThreads, memoryBudget = nil, nil
+	if _, ok := scanThreads(c); ok {
+		breakpoints := adaptive.Default
+		if values, _ := c.Flags().GetStringArray("threads-breakpoint"); len(values) > 0 {
+			breakpoints = []adaptive.Breakpoint{}
+			for _, v := range values {
+				b, err := adaptive.ParseBreakpoint(v)
+				if err != nil {
+					return err
+				}
+				breakpoints = append(breakpoints, b)
+			}
+		}
+		t, err := adaptive.New(breakpoints)
+		if err != nil {
+			return err
+		}
+		adaptiveThreads = t
+	}
+
+	if budget, _ := c.Flags().GetInt64("memory-budget"); budget < 0 {
+		return errors.New("memory budget must not be negative")
+	} else if budget > 0 {
+		memoryBudget = adaptive.NewBudget(budget)
+	}
+	return nil
+}
+
+// adaptImage picks threads of image and waits for memory budget, the
+// size known to the daemon is used or image is walked to size it.
+// Threads are 0 unless adaptive, done must be called once the scan of
+// image finishes
+func adaptImage(image api.Image, block reporter.Image, walked *walk.Shared) (int, func(), error) {
+	if adaptiveThreads == nil && memoryBudget == nil {
+		return 0, func() {}, nil
+	}
+
+	choice := adaptive.Choice{ImageID: image.ID(), Size: block.Size}
+	if choice.Size == 0 {
+		size, err := walked.Size()
+		if err != nil {
+			log.Warnf("Size image %#v error: %s\n", image.ID(), err.Error())
+		}
+		choice.Size = size
+	}
+	if layers, err := imageDiffIDs(image); err == nil {
+		choice.Layers = len(layers)
+	}
+	if adaptiveThreads != nil {
+		choice.Threads = adaptiveThreads.Pick(choice.Size, choice.Layers)
+	}
+
+	release := func() {}
+	if memoryBudget != nil {
+		r, wait, err := memoryBudget.Acquire(ctx, choice.Size)
+		if err != nil {
+			return 0, nil, err
+		}
+		release, choice.Wait = r, wait
+	}
+	log.Debugf("Image %#v of %d bytes and %d layer(s) is scanned by %d thread(s) after waiting %s for memory budget\n",
+		image.ID(), choice.Size, choice.Layers, choice.Threads, choice.Wait.Round(time.Millisecond))
+
+	start := time.Now()
+	return choice.Threads, func() {
+		release()
+		if adaptiveThreads != nil {
+			choice.Scan = time.Since(start)
+			runnerReporter.AddAdaptiveThreads(choice)
+		}
+	}, nil
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().StringArray("threads-breakpoint", nil,
+			"breakpoint of --threads adaptive in form of size:layers:threads, images of at most size bytes and layers take threads of the first breakpoint they fit in, 0 is unbounded, repeatable")
+		c.Flags().Int64("memory-budget", 0, "max aggregate size in bytes of images scanned at once, 0 is unlimited")
+	}
+}
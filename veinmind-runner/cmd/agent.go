@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/containerd"
+	"github.com/chaitin/libveinmind/go/docker"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/collector"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const agentRetryInterval = 30 * time.Second
+
+var agentCmd = &cobra.Command{
+	Use:     "agent",
+	Short:   "scan host images on schedule and stream events to collector",
+	Args:    cobra.NoArgs,
+	PreRunE: scanPreRunE,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		collectorAddr, _ := cmd.Flags().GetString("collector")
+		if collectorAddr == "" {
+			return errors.New("--collector is required")
+		}
+		interval, _ := cmd.Flags().GetDuration("interval")
+		spoolDir, _ := cmd.Flags().GetString("spool-dir")
+		name, _ := cmd.Flags().GetString("name")
+		runtime, _ := cmd.Flags().GetString("runtime")
+		cert, _ := cmd.Flags().GetString("tls-cert")
+		key, _ := cmd.Flags().GetString("tls-key")
+		ca, _ := cmd.Flags().GetString("tls-ca")
+
+		tlsConfig, err := collector.TLSConfig(cert, key, ca, false)
+		if err != nil {
+			return err
+		}
+
+		spool, err := collector.NewSpool(spoolDir, collectorAddr, tlsConfig)
+		if err != nil {
+			return err
+		}
+		defer spool.Close()
+
+		var veinmindRuntime api.Runtime
+		switch runtime {
+		case "docker":
+			veinmindRuntime, err = docker.New()
+		case "containerd":
+			veinmindRuntime, err = containerd.New()
+		default:
+			return errcode.New(errcode.RuntimeMismatch, "", "runtime not match")
+		}
+		if err != nil {
+			return err
+		}
+
+		host, _ := os.Hostname()
+		if name == "" {
+			name = host
+		}
+
+		agentCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		watchAllowlist(agentCtx, cmd, allowlistStore)
+
+		scanTimer := time.NewTimer(0)
+		retryTimer := time.NewTimer(0)
+		retryTimer.Stop()
+		for {
+			select {
+			case <-agentCtx.Done():
+				log.Infof("Stop agent, %d batch(es) are kept in spool\n", spool.Pending())
+				return nil
+			case <-scanTimer.C:
+				doc := agentScan(cmd, veinmindRuntime)
+				err := spool.Enqueue(collector.Batch{
+					Agent:  name,
+					Host:   host,
+					Seq:    spool.NextSeq(),
+					Time:   time.Now(),
+					Events: doc.Events,
+				})
+				if err != nil {
+					log.Error(err)
+				}
+				scanTimer.Reset(interval)
+			case <-retryTimer.C:
+			}
+
+			if after, err := flushSpool(agentCtx, spool); err != nil {
+				if errors.Is(err, collector.ErrProtocolMismatch) {
+					return err
+				}
+				retryTimer.Reset(after)
+			}
+		}
+	},
+}
+
+// agentScan scans all images of runtime and returns report of the run
+func agentScan(c *cobra.Command, runtime api.Runtime) reporter.Report {
+	ids, err := runtime.ListImageIDs()
+	if err != nil {
+		log.Error(err)
+	}
+
+	for _, id := range ids {
+		image, err := openImage(c, runtime, id)
+		if err != nil {
+			continue
+		}
+
+		if err := scan(c, image); err != nil {
+			log.Error(err)
+		}
+		if err := image.Close(); err != nil {
+			log.Error(err)
+		}
+	}
+
+	// Wait for events reported by plugins to reach reporter
+	scanRunner.Wait()
+
+	enrichEvents()
+	return runnerReporter.Reset()
+}
+
+// flushSpool sends spooled batches, duration to retry is returned
+// when collector is busy or unreachable
+func flushSpool(ctx context.Context, spool *collector.Spool) (time.Duration, error) {
+	err := spool.Flush(ctx)
+	if err == nil {
+		return 0, nil
+	}
+
+	after := agentRetryInterval
+	var retryable *collector.RetryableError
+	if errors.As(err, &retryable) && retryable.After > 0 {
+		after = retryable.After
+	}
+	log.Warnf("Send events to collector error, %d batch(es) are kept in spool: %s\n", spool.Pending(), err.Error())
+
+	return after, err
+}
+
+func init() {
+	rootCmd.AddCommand(agentCmd)
+	agentCmd.Flags().String("collector", "", "address of collector, e.g. collector:8443")
+	agentCmd.Flags().Duration("interval", time.Hour, "interval between host scans")
+	agentCmd.Flags().String("spool-dir", "spool", "directory where events are buffered until collector accepts them")
+	agentCmd.Flags().String("name", "", "name of agent, hostname is used by default. It must be the common name or a DNS name of --tls-cert")
+	agentCmd.Flags().StringP("runtime", "r", "docker", "specifies the runtime of images to scan")
+	agentCmd.Flags().StringP("glob", "g", "", "specifies the pattern of plugin file to find")
+	agentCmd.Flags().IntP("threads", "t", 5, "threads for scan action")
+	agentCmd.Flags().String("tls-cert", "", "client certificate for mutual TLS")
+	agentCmd.Flags().String("tls-key", "", "client key for mutual TLS")
+	agentCmd.Flags().String("tls-ca", "", "CA which signs certificate of collector")
+}
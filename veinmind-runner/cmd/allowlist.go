@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/allowlist"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+// watchAllowlist reloads allowlist of long-running modes whenever its
+// file is modified until ctx is done, malformed rewrites keep the
+// previous allowlist
+func watchAllowlist(ctx context.Context, c *cobra.Command, store *allowlist.Store) {
+	interval, _ := c.Flags().GetDuration("allowlist-reload-interval")
+	if store == nil || interval <= 0 {
+		return
+	}
+	go store.Watch(ctx, interval)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{agentCmd, serverCmd} {
+		c.Flags().String("allowlist", "", "allowlist file of trusted images")
+		c.Flags().Duration("allowlist-reload-interval", 30*time.Second, "interval of checking allowlist file for modification, 0 disables reload")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	commonArchive "github.com/chaitin/veinmind-tools/veinmind-common/go/service/archive"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/archive"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"sync"
+	"time"
+)
+
+// imageArchives is the archive budget of an image shared by plugins
+// scanning it, archives tripping limits are reported once
+type imageArchives struct {
+	image    api.Image
+	budget   *archive.Budget
+	mu       sync.Mutex
+	reported map[string]struct{}
+}
+
+func newImageArchives(c *cobra.Command, image api.Image) *imageArchives {
+	limits := archive.DefaultLimits
+	limits.MaxSize, _ = c.Flags().GetInt64("archive-max-size")
+	limits.MaxDepth, _ = c.Flags().GetInt("archive-max-depth")
+	limits.MaxFiles, _ = c.Flags().GetInt64("archive-max-files")
+
+	return &imageArchives{
+		image:    image,
+		budget:   archive.NewBudget(limits),
+		reported: map[string]struct{}{},
+	}
+}
+
+// limit returns limit tripped by err for plugin, archive is reported
+// as suspicious the first time it trips a limit
+func (a *imageArchives) limit(path string, plugin string, err error) (*commonArchive.Limit, error) {
+	var le *archive.LimitError
+	if !errors.As(err, &le) {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	_, reported := a.reported[path]
+	a.reported[path] = struct{}{}
+	a.mu.Unlock()
+	if reported {
+		return le.ServiceLimit(), nil
+	}
+
+	log.Warnf("Archive %#v of %#v walked by plugin %#v trips %s limit %d at %#v\n",
+		path, a.image.ID(), plugin, le.Limit, le.Max, le.Archive)
+	runnerReporter.Send(report.ReportEvent{
+		ID:         a.image.ID(),
+		Time:       time.Now(),
+		Level:      report.High,
+		DetectType: report.Image,
+		EventType:  report.Risk,
+		AlertType:  report.Archive,
+		AlertDetails: []report.AlertDetail{
+			{
+				ArchiveDetail: &report.ArchiveDetail{
+					Path:   path,
+					Member: le.Archive,
+					Limit:  le.Limit,
+					Max:    le.Max,
+				},
+			},
+		},
+	})
+	return le.ServiceLimit(), nil
+}
+
+// pluginArchiveService walks archives of the image scanned by a plugin
+// execution
+type pluginArchiveService struct {
+	archives *imageArchives
+	plugin   string
+}
+
+func (s *pluginArchiveService) List(req commonArchive.Request) (commonArchive.Listing, error) {
+	if req.ImageID != s.archives.image.ID() {
+		return commonArchive.Listing{}, errors.Errorf("archive: image %#v isn't being scanned", req.ImageID)
+	}
+
+	f, err := s.archives.image.Open(req.Path)
+	if err != nil {
+		return commonArchive.Listing{}, err
+	}
+	defer f.Close()
+
+	members, err := s.archives.budget.List(req.Path, f)
+	limit, err := s.archives.limit(req.Path, s.plugin, err)
+	return commonArchive.Listing{Members: members, Limit: limit}, err
+}
+
+func (s *pluginArchiveService) Extract(req commonArchive.Request) (commonArchive.Content, error) {
+	if req.ImageID != s.archives.image.ID() {
+		return commonArchive.Content{}, errors.Errorf("archive: image %#v isn't being scanned", req.ImageID)
+	}
+
+	f, err := s.archives.image.Open(req.Path)
+	if err != nil {
+		return commonArchive.Content{}, err
+	}
+	defer f.Close()
+
+	member, content, err := s.archives.budget.Extract(req.Path, f, req.Member)
+	limit, err := s.archives.limit(req.Path, s.plugin, err)
+	if limit != nil {
+		return commonArchive.Content{Member: member, Limit: limit}, err
+	}
+	return commonArchive.Content{Member: member, Content: content}, err
+}
+
+func (s *pluginArchiveService) Add(registry *service.Registry) {
+	registry.Define(commonArchive.Namespace, struct{}{})
+	registry.AddService(commonArchive.Namespace, "list", s.List)
+	registry.AddService(commonArchive.Namespace, "extract", s.Extract)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().Int64("archive-max-size", archive.DefaultLimits.MaxSize, "max bytes decompressed from archives of an image by archive service")
+		c.Flags().Int("archive-max-depth", archive.DefaultLimits.MaxDepth, "max nesting depth of archives walked by archive service")
+		c.Flags().Int64("archive-max-files", archive.DefaultLimits.MaxFiles, "max number of archive members of an image walked by archive service")
+	}
+}
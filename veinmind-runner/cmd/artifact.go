@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	commonArtifact "github.com/chaitin/veinmind-tools/veinmind-common/go/service/artifact"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/artifact"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var artifactStore *artifact.Store
+
+func newArtifactStore(c *cobra.Command) (*artifact.Store, error) {
+	dir, _ := c.Flags().GetString("artifact-dir")
+	if dir == "" {
+		return nil, nil
+	}
+
+	maxSize, _ := c.Flags().GetInt64("artifact-max-size")
+	quota, _ := c.Flags().GetInt64("artifact-quota")
+	return artifact.NewStore(dir, maxSize, quota)
+}
+
+// pluginArtifactService stores artifacts registered by a plugin execution
+type pluginArtifactService struct {
+	store  *artifact.Store
+	plugin string
+}
+
+func (s *pluginArtifactService) Register(a commonArtifact.Artifact) (string, error) {
+	key := artifact.Key{ImageID: a.ImageID, EventID: a.EventID, Name: a.Name}
+
+	var (
+		path string
+		err  error
+	)
+	switch {
+	case a.Name == "" || a.EventID == "":
+		err = errors.New("artifact: name and event id are required")
+	case a.File != "":
+		path, err = s.store.PutFile(key, a.File)
+	default:
+		path, err = s.store.Put(key, a.Content)
+	}
+	if err != nil {
+		log.Warnf("Register artifact %#v of plugin %#v error: %s\n", a.Name, s.plugin, err.Error())
+		return "", err
+	}
+
+	log.Infof("Register artifact %#v of plugin %#v to %#v\n", a.Name, s.plugin, path)
+	runnerReporter.AddArtifact(reporter.Artifact{
+		ImageID:  a.ImageID,
+		EventID:  a.EventID,
+		Plugin:   s.plugin,
+		Name:     a.Name,
+		Path:     a.Path,
+		Artifact: path,
+	})
+	return path, nil
+}
+
+func (s *pluginArtifactService) Add(registry *service.Registry) {
+	registry.Define(commonArtifact.Namespace, struct{}{})
+	registry.AddService(commonArtifact.Namespace, "register", s.Register)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().String("artifact-dir", "", "directory where artifacts registered by plugins are stored")
+		c.Flags().Int64("artifact-max-size", 16<<20, "max size in bytes of an artifact")
+		c.Flags().Int64("artifact-quota", 1<<30, "max total size in bytes of artifact directory")
+	}
+}
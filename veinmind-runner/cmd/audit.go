@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/audit"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/runner"
+	"github.com/spf13/cobra"
+	"os"
+	"os/user"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "plugin execution audit log utilities",
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify <path>",
+	Short: "verify hash chain of audit log and its rotated files",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		result, err := audit.Verify(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("verified %d entries (seq %d-%d) in %d files\n",
+			result.Entries, result.First, result.Last, result.Files)
+		return nil
+	},
+}
+
+// openAuditLog opens audit log of --audit-log, nil is returned if it
+// isn't set
+func openAuditLog(c *cobra.Command) (*audit.Log, error) {
+	path, _ := c.Flags().GetString("audit-log")
+	if path == "" {
+		return nil, nil
+	}
+	maxSize, _ := c.Flags().GetInt64("audit-log-max-size")
+
+	identity := audit.Identity{
+		UID: os.Getuid(),
+		PID: os.Getpid(),
+	}
+	identity.Host, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		identity.User = u.Username
+	}
+	return audit.Open(path, maxSize, identity)
+}
+
+// configureAudit records plugin executions of runner to --audit-log
+func configureAudit(c *cobra.Command, r *runner.Runner) error {
+	l, err := openAuditLog(c)
+	if err != nil {
+		return err
+	}
+	r.Audit = l
+	return nil
+}
+
+// closeAudit closes audit log of runner
+func closeAudit(r *runner.Runner) {
+	if r.Audit == nil {
+		return
+	}
+	if err := r.Audit.Close(); err != nil {
+		log.Error(err)
+	}
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd, compareCmd, agentCmd, serverCmd} {
+		c.Flags().String("audit-log", "", "append-only log of plugin executions in JSON lines, every entry is fsynced and hash chained")
+		c.Flags().Int64("audit-log-max-size", 100*1024*1024, "size in bytes after which audit log is rotated, 0 disables rotation")
+	}
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditVerifyCmd)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/docker"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/baseimage"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layer"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var baseDetector *baseimage.Detector
+
+// newBaseDetector loads known base images from flags, nil is returned
+// when no base image is specified
+func newBaseDetector(c *cobra.Command) (*baseimage.Detector, error) {
+	file, _ := c.Flags().GetString("base-images-file")
+	refs, _ := c.Flags().GetStringSlice("base-image")
+	if file == "" && len(refs) == 0 {
+		return nil, nil
+	}
+
+	d := baseimage.NewDetector()
+	if file != "" {
+		bases, err := baseimage.LoadConfig(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range bases {
+			d.Add(b)
+		}
+	}
+
+	if len(refs) > 0 {
+		runtime, err := docker.New()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ref := range refs {
+			ids, err := runtime.FindImageIDs(ref)
+			if err != nil {
+				return nil, err
+			}
+			if len(ids) == 0 {
+				return nil, errors.Errorf("base image %#v not found", ref)
+			}
+
+			image, err := runtime.OpenImageByID(ids[0])
+			if err != nil {
+				return nil, err
+			}
+
+			layers, err := layer.DiffIDs(image)
+			if err != nil {
+				return nil, err
+			}
+			d.Add(baseimage.Base{Ref: ref, Layers: layers})
+		}
+	}
+
+	return d, nil
+}
+
+// detectBaseImage records base image of image in report, files of
+// events are located in layers by index of image
+func detectBaseImage(image api.Image, index *layer.Index) {
+	if baseDetector == nil {
+		return
+	}
+
+	layers, err := layer.DiffIDs(image)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	base, ok := baseDetector.Detect(layers)
+	if !ok {
+		return
+	}
+
+	var locate layer.Locator
+	if index != nil {
+		locate = index.Locator()
+	}
+
+	log.Infof("Detected base image %#v of %#v\n", base.Ref, image.ID())
+	runnerReporter.SetBaseImage(reporter.BaseImage{
+		ImageID: image.ID(),
+		Ref:     base.Ref,
+		Layers:  len(base.Layers),
+	}, locate)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd, compareCmd} {
+		c.Flags().StringSlice("base-image", []string{}, "local images which are known base images")
+		c.Flags().String("base-images-file", "", "file of known base images and diff ids of their layers")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/blobcache"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/spf13/cobra"
+)
+
+// blobCache keeps layers fetched by registry client, nil if
+// --blob-cache-dir isn't set
+var blobCache *blobcache.Cache
+
+func newBlobCache(c *cobra.Command) (*blobcache.Cache, error) {
+	dir, _ := c.Flags().GetString("blob-cache-dir")
+	if dir == "" {
+		return nil, nil
+	}
+	maxSize, _ := c.Flags().GetInt64("blob-cache-max-size")
+
+	if via, _ := c.Flags().GetString("pull-via"); via == "" || via == registry.PullViaRuntime {
+		log.Warnf("Blob cache %s is only used by --pull-via %s or %s\n", dir, registry.PullViaClient, registry.PullViaAuto)
+	}
+	return blobcache.Open(dir, maxSize)
+}
+
+// withBlobCache sets blob cache of layers fetched by client
+func withBlobCache(client registry.Client) (registry.Client, error) {
+	if blobCache == nil || registryStorage != nil {
+		return client, nil
+	}
+	return registry.WithBlobCache(blobCache)(client)
+}
+
+// logBlobCacheStats logs blob cache statistics, which are in summary
+// line as well
+func logBlobCacheStats() {
+	if blobCache == nil {
+		return
+	}
+
+	stats := blobCache.Stats()
+	log.Infof("Blob cache: %d hits, %d misses, %d bytes saved, %d evictions\n",
+		stats.Hits, stats.Misses, stats.Saved, stats.Evictions)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().String("blob-cache-dir", "", "directory where layers fetched by registry client are cached by digest across images and runs")
+		c.Flags().Int64("blob-cache-max-size", 20<<30, "size in bytes over which the least recently used layers are evicted from blob cache, 0 is unlimited")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/budget"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/runner"
+	"github.com/spf13/cobra"
+)
+
+// configureBudget sets time budget of images of --image-timeout and
+// loads timings of plugins of --plugin-timings
+func configureBudget(c *cobra.Command, r *runner.Runner) error {
+	r.ImageTimeout, _ = c.Flags().GetDuration("image-timeout")
+
+	path, _ := c.Flags().GetString("plugin-timings")
+	if path == "" {
+		return nil
+	}
+	timings, err := budget.LoadTimings(path)
+	if err != nil {
+		return err
+	}
+	r.Timings = timings
+	return nil
+}
+
+// saveTimings saves timings of plugins to --plugin-timings
+func saveTimings(c *cobra.Command, r *runner.Runner) {
+	path, _ := c.Flags().GetString("plugin-timings")
+	if path == "" {
+		return
+	}
+	if err := r.Timings.Save(path); err != nil {
+		log.Error(err)
+	}
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().Duration("image-timeout", 0, "time budget of scanning an image shared by plugins, 0 means unlimited")
+		c.Flags().String("plugin-timings", "", "file where average durations of plugins are kept across runs")
+	}
+}
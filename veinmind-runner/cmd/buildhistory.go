@@ -0,0 +1,85 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/buildhistory"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"strings"
+	"time"
+)
+
+// buildLevels are levels of build rules mapped by --build-rule-level
+var buildLevels map[string]report.Level
+
+func newBuildLevels(c *cobra.Command) (map[string]report.Level, error) {
+	values, _ := c.Flags().GetStringArray("build-rule-level")
+
+	levels := map[string]report.Level{}
+	for _, v := range values {
+		i := strings.Index(v, "=")
+		if i < 0 {
+			return nil, errors.Errorf("build rule level %#v isn't in the form of rule=level", v)
+		}
+
+		rule := v[:i]
+		if _, ok := buildhistory.DefaultLevels[rule]; !ok {
+			return nil, errors.Errorf("unknown build rule %#v", rule)
+		}
+		level, err := reporter.ParseLevel(v[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		levels[rule] = level
+	}
+	return levels, nil
+}
+
+// checkBuildHistory records reconstructed build history of image in
+// report, and reports risky instructions of it as events
+func checkBuildHistory(image api.Image) {
+	oci, err := image.OCISpecV1()
+	if err != nil || oci == nil || len(oci.History) == 0 {
+		return
+	}
+
+	history := []buildhistory.Entry{}
+	for _, h := range oci.History {
+		history = append(history, buildhistory.Entry{CreatedBy: h.CreatedBy, EmptyLayer: h.EmptyLayer})
+	}
+	runnerReporter.AddBuildHistory(reporter.BuildHistory{
+		ImageID: image.ID(),
+		Steps:   buildhistory.Reconstruct(history),
+	})
+
+	for _, f := range buildhistory.Detect(history, buildLevels) {
+		log.Warnf("Risky build instruction of %#v: %s\n", image.ID(), f.Step.Instruction)
+		runnerReporter.Send(report.ReportEvent{
+			ID:         image.ID(),
+			Time:       time.Now(),
+			Level:      f.Level,
+			DetectType: report.Image,
+			EventType:  report.Risk,
+			AlertType:  report.Build,
+			AlertDetails: []report.AlertDetail{
+				{
+					BuildDetail: &report.BuildDetail{
+						Index:       f.Step.Index,
+						Instruction: f.Step.Instruction,
+						Rule:        f.Rule,
+						Description: f.Description(),
+					},
+				},
+			},
+		})
+	}
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd, compareCmd, agentCmd} {
+		c.Flags().StringArray("build-rule-level", nil, "level of events of risky build instruction rule in the form of rule=level, rules are add-url, pipe-to-shell, insecure-fetch and secret-in-history")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/bundle"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "export and import plugins and configs for offline hosts",
+}
+
+var bundleExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "package plugins, configs, policies and ignore files into a bundle",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sources := []bundle.Source{}
+		for kind, flag := range map[string]string{
+			bundle.KindPlugin:    "plugin",
+			bundle.KindConfig:    "config",
+			bundle.KindPolicy:    "policy",
+			bundle.KindIgnore:    "ignore-file",
+			bundle.KindAllowlist: "allowlist",
+		} {
+			patterns, _ := cmd.Flags().GetStringSlice(flag)
+			for _, pattern := range patterns {
+				paths, err := filepath.Glob(pattern)
+				if err != nil {
+					return err
+				}
+				if len(paths) == 0 {
+					return errors.Errorf("--%s %#v matches no file", flag, pattern)
+				}
+
+				for _, p := range paths {
+					sources = append(sources, bundle.Source{Kind: kind, Path: p})
+				}
+			}
+		}
+
+		if len(sources) == 0 {
+			return errors.New("nothing to export, specify files by --plugin, --config, --policy, --ignore-file or --allowlist")
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		m, err := bundle.Export(f, sources)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range m.Files {
+			log.Infof("Export %#v sha256:%s\n", file.Path, file.SHA256)
+		}
+		log.Infof("Export bundle success: %#v\n", output)
+		return nil
+	},
+}
+
+var bundleImportCmd = &cobra.Command{
+	Use:   "import <bundle>",
+	Short: "verify and install a bundle",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, _ := cmd.Flags().GetString("dir")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		m, err := bundle.Import(f, dir)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range m.Files {
+			log.Infof("Install %#v\n", filepath.Join(dir, file.Path))
+		}
+		log.Infof("Import bundle success: %#v\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+	bundleCmd.AddCommand(bundleExportCmd)
+	bundleCmd.AddCommand(bundleImportCmd)
+	bundleExportCmd.Flags().StringP("output", "o", "veinmind-bundle.tar.gz", "output filepath of bundle")
+	bundleExportCmd.Flags().StringSlice("plugin", []string{}, "plugin files to export, glob is supported")
+	bundleExportCmd.Flags().StringSlice("config", []string{}, "config files to export, glob is supported")
+	bundleExportCmd.Flags().StringSlice("policy", []string{}, "policy files to export, glob is supported")
+	bundleExportCmd.Flags().StringSlice("ignore-file", []string{}, "ignore files to export, glob is supported")
+	bundleExportCmd.Flags().StringSlice("allowlist", []string{}, "allowlist files to export, glob is supported")
+	bundleImportCmd.Flags().StringP("dir", "d", ".", "directory where bundle is installed")
+}
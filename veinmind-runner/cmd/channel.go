@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+	// Timezones of --report-timezone are embedded for hosts without
+	// zoneinfo, e.g. distroless images
+	_ "time/tzdata"
+)
+
+// newReporterOptions returns options of event channel, level
+// normalizer and timezone of reporter
+func newReporterOptions(c *cobra.Command) ([]reporter.Option, error) {
+	capacity, err := c.Flags().GetInt("event-buffer")
+	if err != nil {
+		return nil, nil
+	}
+	overflow, _ := c.Flags().GetString("event-overflow")
+	spillDir, _ := c.Flags().GetString("event-spill-dir")
+	workers, _ := c.Flags().GetInt("event-workers")
+
+	normalizer, err := newNormalizer(c)
+	if err != nil {
+		return nil, err
+	}
+	suggester, err := newSuggester(c)
+	if err != nil {
+		return nil, err
+	}
+	timezone, _ := c.Flags().GetString("report-timezone")
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, errors.Wrapf(err, "--report-timezone %s", timezone)
+	}
+
+	return []reporter.Option{
+		reporter.WithCapacity(capacity),
+		reporter.WithOverflow(overflow, spillDir),
+		reporter.WithListenWorkers(workers),
+		reporter.WithNormalizer(normalizer),
+		reporter.WithRemediation(suggester),
+		reporter.WithTimezone(location),
+	}, nil
+}
+
+func logChannelStats() {
+	stats := runnerReporter.ChannelStats()
+	log.Infof("Event channel: capacity %d, max depth %d, %d dropped, %d spilled\n",
+		stats.Capacity, stats.MaxDepth, stats.Dropped, stats.Spilled)
+	if stats.Dropped > 0 {
+		log.Warnf("%d event(s) dropped as event channel overflowed, increase --event-buffer or use --event-overflow spill\n", stats.Dropped)
+	}
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd, compareCmd, agentCmd} {
+		c.Flags().Int("event-buffer", reporter.DefaultCapacity, "capacity of event channel of reporter")
+		c.Flags().String("event-overflow", reporter.OverflowBlock, "policy when event channel is full, block, drop-oldest or spill")
+		c.Flags().String("event-spill-dir", os.TempDir(), "directory of temporary file of spilled events")
+		c.Flags().Int("event-workers", 1, "number of goroutines converting events of reporter")
+		c.Flags().String("report-timezone", "UTC", "timezone of human-readable timestamps of events, e.g. Asia/Shanghai or Local, raw timestamps are kept as they are")
+	}
+}
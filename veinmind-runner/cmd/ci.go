@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/ci"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// postCIComment posts markdown summary of report to merge request or
+// pull request, failure doesn't fail the scan unless it's required
+func postCIComment(c *cobra.Command) error {
+	enabled, _ := c.Flags().GetBool("ci-comment")
+	if !enabled {
+		return nil
+	}
+	required, _ := c.Flags().GetBool("ci-comment-required")
+
+	err := func() error {
+		provider, _ := c.Flags().GetString("ci-provider")
+		tokenEnv, _ := c.Flags().GetString("ci-token-env")
+		project, _ := c.Flags().GetString("ci-project")
+		number, _ := c.Flags().GetInt("ci-number")
+		if tokenEnv == "" {
+			tokenEnv = ci.DefaultTokenEnv(provider)
+		}
+
+		token := os.Getenv(tokenEnv)
+		if token == "" {
+			return errors.Errorf("ci: token environment variable %#v is empty", tokenEnv)
+		}
+
+		commenter, err := ci.New(ci.Options{
+			Provider: provider,
+			Token:    token,
+			Project:  project,
+			Number:   number,
+		})
+		if err != nil {
+			return err
+		}
+
+		body := &bytes.Buffer{}
+		if err := reporter.WriteMarkdown(body, runnerReporter.Snapshot()); err != nil {
+			return err
+		}
+
+		return commenter.Upsert(ctx, body.String())
+	}()
+
+	if err != nil {
+		if required {
+			return err
+		}
+		log.Warnf("Post CI comment error: %s\n", err.Error())
+		return nil
+	}
+
+	log.Info("Post CI comment success")
+	return nil
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().Bool("ci-comment", false, "post summary of findings to merge request or pull request")
+		c.Flags().Bool("ci-comment-required", false, "fail the scan when CI comment can't be posted")
+		c.Flags().String("ci-provider", "github", "provider of CI comment, github or gitlab")
+		c.Flags().String("ci-token-env", "", "environment variable of CI API token, GITHUB_TOKEN or GITLAB_TOKEN by default")
+		c.Flags().String("ci-project", "", "repository (github) or project (gitlab), detected from CI environment by default")
+		c.Flags().Int("ci-number", 0, "pull request number or merge request iid, detected from CI environment by default")
+	}
+}
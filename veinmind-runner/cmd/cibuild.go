@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/cibuild"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// ciBuild is the CI build of the scan, nil outside CI unless
+// --build-metadata is given
+var ciBuild *cibuild.Build
+
+// configureBuild detects CI build of the scan from environment and
+// --build-metadata and records it in report
+func configureBuild(c *cobra.Command) error {
+	ciBuild = cibuild.Detect(os.Getenv)
+
+	values, _ := c.Flags().GetStringArray("build-metadata")
+	metadata, err := cibuild.ParseMetadata(values)
+	if err != nil {
+		return err
+	}
+	if len(metadata) > 0 {
+		if ciBuild == nil {
+			ciBuild = &cibuild.Build{}
+		}
+		ciBuild.Apply(metadata)
+	}
+
+	images, _ := c.Flags().GetStringArray("built-image")
+	if ciBuild == nil {
+		if len(images) > 0 {
+			return errors.New("--built-image requires CI environment or --build-metadata to describe the build")
+		}
+		return nil
+	}
+	ciBuild.Images = images
+	runnerReporter.SetBuild(*ciBuild)
+	return nil
+}
+
+// stampBuild stamps CI build on events of images built by it
+func stampBuild() {
+	if ciBuild == nil || len(ciBuild.Images) == 0 {
+		return
+	}
+
+	runnerReporter.Update(func(events []reporter.Event) {
+		for i, evt := range events {
+			refs := append([]string{}, evt.ImageRefs...)
+			if evt.Image != nil {
+				refs = append(refs, evt.Image.Digest)
+				refs = append(refs, evt.Image.RepoRefs...)
+				refs = append(refs, evt.Image.RepoDigests...)
+			}
+			if ciBuild.Built(evt.ID, refs) {
+				events[i].Build = ciBuild.Ref()
+			}
+		}
+	})
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().StringArray("build-metadata", nil, "metadata of CI build in the form of key=value, provider, id, url, repository, commit and branch override those detected from CI environment")
+		c.Flags().StringArray("built-image", nil, "reference or digest of image built by CI build, its events are stamped with the build")
+	}
+}
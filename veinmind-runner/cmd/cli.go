@@ -2,114 +2,325 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
+	"fmt"
 	"github.com/chaitin/libveinmind/go"
 	"github.com/chaitin/libveinmind/go/cmd"
 	"github.com/chaitin/libveinmind/go/containerd"
 	"github.com/chaitin/libveinmind/go/docker"
 	"github.com/chaitin/libveinmind/go/plugin"
 	"github.com/chaitin/libveinmind/go/plugin/log"
-	"github.com/chaitin/libveinmind/go/plugin/service"
-	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/scope"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/allowlist"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/compat"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/cosign"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/detect"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/gate"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layer"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/listing"
 	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
 	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/runner"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/target"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/trace"
 	"github.com/distribution/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/spf13/cobra"
+	"io"
 	"os"
-	"path"
+	"os/signal"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
 )
 
 var (
-	ps             []*plugin.Plugin
 	ctx            context.Context
+	scanRunner     *runner.Runner
 	runnerReporter *reporter.Reporter
-	reportService  *report.ReportService
+	targetTally    *target.Tally
+	allowlistStore *allowlist.Store
 	scanPreRunE    = func(c *cobra.Command, args []string) error {
+		startSummary(c)
+
+		// Profile presets flags before any of them is read, --nice
+		// presets flags the profile leaves
+		if err := applyProfile(c); err != nil {
+			return err
+		}
+		if err := applyNice(c); err != nil {
+			return err
+		}
+
+		if err := checkOffline(c); err != nil {
+			return err
+		}
+
+		// Existing reports are refused before anything is scanned
+		if err := checkOutputsExist(c); err != nil {
+			return err
+		}
+
+		// Pre hook prepares environment of scan, e.g. mounts
+		if err := runPreHook(c, args); err != nil {
+			return err
+		}
+
+		// Unreachable runtimes fail before plugins are discovered
+		if err := checkRuntimes(c); err != nil {
+			return err
+		}
+
 		// Discover Plugins
 		ctx = c.Context()
-		glob, err := c.Flags().GetString("glob")
-		if err == nil && glob != "" {
-			ps, err = plugin.DiscoverPlugins(ctx, ".", plugin.WithGlob(glob))
-		} else {
-			ps, err = plugin.DiscoverPlugins(ctx, ".")
+		if err := startTracing(c); err != nil {
+			return err
 		}
+
+		ps, incompatible, err := discoverPlugins(ctx, c)
 		if err != nil {
 			return err
 		}
-		for _, p := range ps {
-			log.Infof("Discovered plugin: %#v\n", p.Name)
+
+		// Get threads value, adaptive threads are picked per image
+		threads, _ := scanThreads(c)
+		if err := configureAdaptive(c); err != nil {
+			return err
 		}
 
-		// Reporter Channel Listen
-		go runnerReporter.Listen()
+		reporterOptions, err := newReporterOptions(c)
+		if err != nil {
+			return err
+		}
+		scanRunner, err = runner.New(ps, threads, reporterOptions...)
+		if err != nil {
+			return err
+		}
+		if err := configurePluginExec(c, scanRunner); err != nil {
+			return err
+		}
+		if err := configureBudget(c, scanRunner); err != nil {
+			return err
+		}
+		if err := configureClasses(c, scanRunner, threads); err != nil {
+			return err
+		}
+		configureSoftFail(c, scanRunner)
+		if err := configureAudit(c, scanRunner); err != nil {
+			return err
+		}
+		if err := configureLayerCache(c, scanRunner); err != nil {
+			return err
+		}
+		if err := configureThrottle(c); err != nil {
+			return err
+		}
+		runnerReporter = scanRunner.Reporter
+		recordIncompatible(incompatible)
+		recordConfiguration(c, args)
+		if err := configureBuild(c); err != nil {
+			return err
+		}
 
-		// Event Channel Listen
-		go func() {
-			for {
-				select {
-				case evt := <-reportService.EventChannel:
-					runnerReporter.EventChannel <- evt
-				}
-			}
-		}()
+		// Per-target errors are tallied unless failing fast
+		failFast, _ := c.Flags().GetBool("fail-fast")
+		targetTally = &target.Tally{FailFast: failFast}
+		targetFunnel = &target.Funnel{}
 
-		return nil
-	}
-	scanPostRunE = func(cmd *cobra.Command, args []string) error {
-		// Stop reporter listen
-		runnerReporter.StopListen()
+		// Load gate options, malformed files fail the scan early
+		gateOptions, err = newGateOptions(c)
+		if err != nil {
+			return err
+		}
+		configureModes(scanRunner, gateOptions.Policy)
+		trendOptions, err = newTrendOptions(c)
+		if err != nil {
+			return err
+		}
 
-		// Output
-		err := runnerReporter.Write(os.Stdout)
+		// Load levels of risky build instructions
+		buildLevels, err = newBuildLevels(c)
+		if err != nil {
+			return err
+		}
+
+		// Load layer scope
+		layerScope, err = newLayerScope(c)
+		if err != nil {
+			return err
+		}
+
+		// Shared hash cache of plugins
+		hashCache = newHashCache(c)
+
+		// Rootfs of images materialized for plugins needing them
+		rootfsPool, err = newRootfsPool(c)
+		if err != nil {
+			return err
+		}
+
+		// Blob cache of layers pulled from registries
+		blobCache, err = newBlobCache(c)
+		if err != nil {
+			return err
+		}
+
+		// Tokens of registries served by token providers
+		registryTokens, err = newRegistryTokens(c)
+		if err != nil {
+			return err
+		}
+
+		// Load threat intelligence
+		threatIntel, err = newThreatIntel(c)
+		if err != nil {
+			return err
+		}
+
+		// Prepare quarantine directory
+		quarantineStore, err = newQuarantineStore(c)
+		if err != nil {
+			return err
+		}
+
+		// Prepare artifact directory
+		artifactStore, err = newArtifactStore(c)
+		if err != nil {
+			return err
+		}
+
+		flaggedExporter, err = newFlaggedExport(c)
+		if err != nil {
+			return err
+		}
+
+		// Load known base images
+		baseDetector, err = newBaseDetector(c)
+		if err != nil {
+			return err
+		}
+
+		// Load tenants of targets
+		tenantTagger, err = newTenantTagger(c)
 		if err != nil {
-			log.Error(err)
+			return err
 		}
-		output, _ := cmd.Flags().GetString("output")
-		if _, err := os.Stat(output); errors.Is(err, os.ErrNotExist) {
-			f, err := os.Create(output)
+
+		// Load allowlist, malformed allowlist fails the scan
+		allowlistPath, _ := c.Flags().GetString("allowlist")
+		if allowlistPath != "" {
+			allowlistStore, err = allowlist.NewStore(allowlistPath)
 			if err != nil {
-				log.Error(err)
-			} else {
-				err = runnerReporter.Write(f)
-				if err != nil {
-					return err
-				}
+				return err
 			}
-		} else {
-			f, err := os.OpenFile(output, os.O_WRONLY, 0666)
+		}
+
+		// Partial reports are flushed while scanning
+		return startFlush(c)
+	}
+	scanPostRunE = func(cmd *cobra.Command, args []string) error {
+		// No partial report is flushed once the final one is on its way
+		stopFlush()
+
+		// Stop accepting events and drain them, then close output of
+		// plugins before anything is rendered, so that late lines of
+		// plugins never land amid the report
+		scanRunner.Close()
+		flushPluginOutput(scanRunner)
+		closeAudit(scanRunner)
+		stopTracing(len(runnerReporter.Snapshot().Events))
+		logHashCacheStats()
+		logBlobCacheStats()
+		logLayerCacheStats()
+		logChannelStats()
+		logScheduleStats(scanRunner)
+		logThrottleStats()
+		saveTimings(cmd, scanRunner)
+		enrichEvents()
+		stampBuild()
+		failures := targetTally.Failures()
+		runnerReporter.SetFailedTargets(failures)
+
+		// Results of rescan are combined with the report rescanned
+		doc, err := combineRescan(runnerReporter.Snapshot())
+		if err != nil {
+			return err
+		}
+		tagTenants(&doc)
+
+		// Trend gate compares images against their history, comparisons
+		// are reported
+		var trendDecision gate.Decision
+		if trendOptions != nil {
+			trendDecision, err = evaluateTrend(cmd, &doc)
 			if err != nil {
-				log.Error(err)
-			} else {
-				err = runnerReporter.Write(f)
-				if err != nil {
-					return err
-				}
+				return err
 			}
 		}
 
+		// Reports shared outside are redacted, the trend history keeps
+		// the unredacted report
+		doc, err = redactOutputs(cmd, doc)
+		if err != nil {
+			return err
+		}
+
+		// Output
+		if err := writeOutputs(cmd, doc); err != nil {
+			return err
+		}
+		if err := writeTenantOutputs(cmd, doc); err != nil {
+			return err
+		}
+		notifyTenants(doc)
+
+		console := consoleWriter(cmd)
+		printFailedTargets(console, failures)
+		printSoftFailures(console, doc.SoftFailures())
+
+		// CI comment
+		if err := postCIComment(cmd); err != nil {
+			return err
+		}
+
 		// Exit
 		exitcode, err := cmd.Flags().GetInt("exit-code")
 		if err != nil {
 			return err
 		}
 
-		if exitcode == 0 {
-			return nil
-		} else {
-			events, err := runnerReporter.GetEvents()
-			if err != nil {
-				return err
+		exit := 0
+		if exitcode != 0 {
+			// Allowlisted images and accepted findings are reported but not enforced
+			decision := gate.Evaluate(doc.Events, gateOptions)
+			if trendOptions != nil {
+				decision = trendDecision
 			}
-
-			if len(events) > 0 {
-				os.Exit(exitcode)
-			} else {
-				return nil
+			logDecision(decision)
+			if decision.Fail {
+				exit = exitcode
 			}
 		}
+		if exit == 0 {
+			exit = strictExit(cmd, doc)
+		}
+		if exit == 0 {
+			exit = emptyScanExit(cmd, failures)
+		}
 
+		// Post hook is told the exit decision
+		if err := runPostHook(cmd, args, exit); err != nil {
+			return err
+		}
+
+		emitSummary(exit)
+		if exit != 0 {
+			os.Exit(exit)
+		}
 		return nil
 	}
 )
@@ -128,31 +339,33 @@ var listPluginCmd = &cmd.Command{
 			return err
 		}
 
-		verbose, err := cmd.Flags().GetBool("verbose")
-		if err != nil {
-			return err
+		format, _ := cmd.Flags().GetString("format")
+		if verbose, _ := cmd.Flags().GetBool("verbose"); verbose {
+			format = listing.FormatJSON
 		}
 
+		items := []listing.Plugin{}
 		for _, p := range ps {
-			if verbose {
-				pJsonByte, err := json.MarshalIndent(p, "", "	")
-				if err != nil {
-					log.Error(err)
-					continue
-				}
-				log.Info("\n" + string(pJsonByte))
-			} else {
-				log.Info("Plugin Name: " + p.Name)
-			}
+			items = append(items, listing.Plugin{
+				Name:        p.Name,
+				Version:     p.Version,
+				Path:        p.Path,
+				Author:      p.Author,
+				Tags:        p.Tags,
+				Description: p.Description,
+				APIVersion:  p.ManifestVersion,
+				Compat:      compat.Check(p.ManifestVersion).Status,
+			})
 		}
 
-		return nil
+		return listing.Write(os.Stdout, format, listing.NewPlugins(items))
 	},
 }
 var scanHostCmd = &cmd.Command{
-	Use:      "scan-host",
+	Use:      "scan-host [imagename/imageid...]",
 	Short:    "perform hosted scan command",
 	PreRunE:  scanPreRunE,
+	RunE:     scanHost,
 	PostRunE: scanPostRunE,
 }
 var scanRegistryCmd = &cmd.Command{
@@ -160,185 +373,460 @@ var scanRegistryCmd = &cmd.Command{
 	Short:   "perform registry scan command",
 	PreRunE: scanPreRunE,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		var (
-			err             error
-			c               registry.Client
-			veinmindRuntime api.Runtime
-		)
+		verifiers, err := newImageVerifiers(cmd)
+		if err != nil {
+			return err
+		}
 
 		server, _ := cmd.Flags().GetString("server")
-		config, _ := cmd.Flags().GetString("config")
-		namespace, _ := cmd.Flags().GetString("namespace")
-		runtime, _ := cmd.Flags().GetString("runtime")
+		namespaces, _ := cmd.Flags().GetStringSlice("namespace")
 		// tags, _ := cmd.Flags().GetStringSlice("tags")
 
-		switch runtime {
-		case "docker":
-			if config == "" {
-				c, err = registry.NewRegistryDockerClient()
-			} else {
-				c, err = registry.NewRegistryDockerClient(registry.WithAuth(config))
+		c, veinmindRuntime, err := newScanRegistryClient(cmd, verifiers)
+		if err != nil {
+			return err
+		}
+
+		if len(args) > 0 {
+			targetFunnel.Record("requested", len(args))
+		}
+
+		// Invalid references fail alone instead of the whole run
+		valid := []string{}
+		for _, arg := range args {
+			if _, err := reference.Parse(arg); err != nil {
+				if err := targetTally.Fail(arg, target.StageResolve, err); err != nil {
+					return err
+				}
+				continue
 			}
-			if err != nil {
-				return err
+			valid = append(valid, arg)
+		}
+
+		valid, err = defaultTagRepos(cmd, valid)
+		if err != nil {
+			return err
+		}
+
+		// References of other registries are scanned with credentials
+		// of --server, which is decided by --server-mismatch
+		valid, checks, err := checkServerMismatch(cmd, server, valid)
+		if err != nil {
+			return err
+		}
+		if len(args) > 0 {
+			targetFunnel.Record("valid", len(valid), targetFilters(cmd, nil, "server-mismatch")...)
+		}
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if len(args) > 0 && len(valid) == 0 {
+			if dryRun {
+				printDryRun(nil, checks)
 			}
+			return nil
+		}
+
+		repos, err := resolveRepos(ctx, c, server, namespaces, valid)
+		if err != nil {
+			return err
+		}
+		repos, err = defaultTagRepos(cmd, repos)
+		if err != nil {
+			return err
+		}
+		targetFunnel.Record("resolved", len(repos), targetFilters(cmd, nil, "server", "namespace", "require-signature")...)
+		if dryRun {
+			printDryRun(repos, checks)
+			return nil
+		}
+
+		repos, err = orderRepos(cmd, repos)
+		if err != nil {
+			return err
+		}
+
+		// Interrupted scan aborts pulls in flight and targets left,
+		// steps of targets share the context of scan
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
 
-			veinmindRuntime, err = docker.New()
+		// Registries of repos are pulled from in turn
+		fair, err := newFairScheduler(cmd, repos)
+		if err != nil {
+			return err
+		}
+		steps := registrySteps(cmd, c, veinmindRuntime, verifiers)
+		left, err := fair.Run(func(repo string) error {
+			// Images wait for each other while scans are throttled,
+			// waits are cut short by interrupt
+			release, err := acquireThrottle(ctx)
 			if err != nil {
-				return err
+				// Repo interrupted while waiting isn't scanned, it's
+				// failed rather than counted as scanned
+				return targetTally.Fail(repo, target.StageThrottle, err)
 			}
-		case "containerd":
-			c, err = registry.NewRegistryContainerdClient()
-			if err != nil {
+			defer release()
+			return target.Run(repo, steps, targetTally)
+		}, func() bool {
+			return ctx.Err() != nil || scanTimedOut(cmd)
+		})
+		logRegistryStats(fair)
+		if steps.Removals != nil {
+			if err := steps.Removals.Sweep(); err != nil {
 				return err
 			}
-
-			veinmindRuntime, err = containerd.New()
-			if err != nil {
-				return err
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			log.Warnf("Scan interrupted, %d repo(s) not reached\n", len(left))
+			return err
+		}
+		if len(left) > 0 {
+			log.Warnf("Scan timed out, %d repo(s) not reached\n", len(left))
+			for _, repo := range left {
+				notReached("", repo)
 			}
-		default:
-			return errors.New("runtime not match")
 		}
 
-		// If no repo is specified, then query all repo through catalog
-		repos := []string{}
-		if len(args) == 0 {
-			switch c := c.(type) {
-			case *registry.RegistryDockerClient:
-				repos, err = c.GetRepos(server)
-				if err != nil {
-					return err
-				}
-			}
-		} else {
-			// If it doesn't start with registry, autofill registry
-			for _, r := range args {
-				rParse, err := reference.Parse(r)
-				if err != nil {
-					log.Error(err)
-					continue
-				}
+		return nil
+	},
+	PostRunE: scanPostRunE,
+}
 
-				repos = append(repos, rParse.String())
-			}
+// newScanRegistryClient returns registry client and runtime of
+// --runtime which images are pulled into
+func newScanRegistryClient(cmd *cmd.Command, verifiers imageVerifiers) (registry.Client, api.Runtime, error) {
+	config, _ := cmd.Flags().GetString("config")
+	runtime, _ := cmd.Flags().GetString("runtime")
+
+	var (
+		c               registry.Client
+		veinmindRuntime api.Runtime
+		err             error
+	)
+	switch runtime {
+	case "docker":
+		c, err = registry.NewRegistryDockerClient(registryOptions(cmd, config)...)
+		if err != nil {
+			return nil, nil, err
 		}
 
-		if namespace != "" {
-			namespaceMaps := map[string][]string{}
-			for _, repo := range repos {
-				rNamed, err := reference.ParseNamed(repo)
-				if err != nil {
-					log.Error(err)
-					continue
-				}
+		veinmindRuntime, err = docker.New()
+		if err != nil {
+			return nil, nil, err
+		}
+	case "containerd":
+		c, err = registry.NewRegistryContainerdClient(containerdAddress(cmd), containerdRegistryOptions(cmd, config)...)
+		if err != nil {
+			return nil, nil, err
+		}
 
-				p := reference.Path(rNamed)
-				ns := strings.Split(p, "/")[0]
-				namespaceMaps[ns] = append(namespaceMaps[ns], repo)
-			}
+		veinmindRuntime, err = containerd.New()
+		if err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, errcode.New(errcode.RuntimeMismatch, "", "runtime not match")
+	}
 
-			_, ok := namespaceMaps[namespace]
-			if ok {
-				repos = namespaceMaps[namespace]
-			} else {
-				return errors.New("Namespace doesn't match any repos")
-			}
+	c, err = withPlatform(cmd, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err = withPullVia(cmd, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err = withRegistryTokens(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err = withRegistryStorage(cmd, c, verifiers)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err = withBlobCache(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, veinmindRuntime, nil
+}
+
+// resolveDigest resolves digest of repo through registry, credentials
+// of docker client are used. Digest of registry storage is read from it
+func resolveDigest(c registry.Client, repo string) (name.Digest, error) {
+	if registryStorage != nil {
+		return storageDigest(repo)
+	}
+	var opts []remote.Option
+	if dc, ok := c.(*registry.RegistryDockerClient); ok {
+		var err error
+		opts, err = dc.RemoteOptions(repo)
+		if err != nil {
+			return name.Digest{}, err
 		}
+	}
+	return cosign.Resolve(repo, opts...)
+}
+
+// registrySteps returns steps of registry targets, images pulled by
+// docker are found by normalized reference and images pulled by
+// containerd are opened by the pulled reference directly, targets
+// whose digest is present locally are scanned without pulling unless
+// --always-pull is specified
+func registrySteps(cmd *cmd.Command, c registry.Client, veinmindRuntime api.Runtime, verifiers imageVerifiers) target.Steps {
+	// digests resolved of targets which aren't present locally, and
+	// repos of images pulled to pull them again
+	var (
+		digests   = map[string]string{}
+		pulled    = map[string]string{}
+		digestsMu sync.Mutex
+	)
+
+	// Failed targets and images are recorded with where they're pulled
+	// so that they can be rescanned
+	runtime := registryRuntime(c)
+	targetTally.Source, targetTally.Runtime = reporter.TargetRegistry, runtime
+	// Images pulled are recorded so that those kept are pruned later
+	pulledLedger := pullLedger(cmd)
+	keepImages, _ := cmd.Flags().GetBool("keep-images")
+	setTarget := func(id string, ref string) {
+		setScanTarget(id, ref)
+		runnerReporter.SetTarget(id, reporter.Target{Source: reporter.TargetRegistry, Runtime: runtime, Ref: ref})
+	}
+
+	steps := target.Steps{
+		Pull: func(repo string) (string, error) {
+			if err := checkTag(ctx, cmd, c, repo); err != nil {
+				return "", err
+			}
 
-		for _, repo := range repos {
 			log.Infof("Start pull image: %#v\n", repo)
-			r, err := c.Pull(repo)
+			_, pullSpan := trace.Start(ctx, "pull", trace.String("image.ref", repo))
+			r, err := c.Pull(ctx, repo)
+			pullSpan.SetError(err)
+			pullSpan.End()
 			if err != nil {
-				log.Errorf("Pull image error: %#v\n", err.Error())
-				continue
+				return "", pullError(repo, err)
 			}
 			log.Infof("Pull image success: %#v\n", repo)
 
-			var (
-				rNamed reference.Named
-			)
+			digestsMu.Lock()
+			digest := digests[repo]
+			delete(digests, repo)
+			pulled[r] = repo
+			digestsMu.Unlock()
+			runnerReporter.AddPull(reporter.Pull{Ref: repo, Digest: digest, Source: reporter.SourcePulled})
+			return r, nil
+		},
+		Find: func(r string) ([]string, error) {
+			digestsMu.Lock()
+			repo := pulled[r]
+			digestsMu.Unlock()
+			if _, ok := c.(*registry.RegistryContainerdClient); ok {
+				setTarget(r, r)
+				recordPulled(pulledLedger, runtime, r, repo)
+				return []string{r}, nil
+			}
 
-			switch c.(type) {
-			case *registry.RegistryDockerClient:
-				rNamed, err = reference.ParseDockerRef(r)
+			findRef, err := dockerFindRef(r)
+			if err != nil {
+				return nil, err
+			}
+			ids, err := veinmindRuntime.FindImageIDs(findRef)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range ids {
+				setTarget(id, r)
+				recordPulled(pulledLedger, runtime, id, repo)
+			}
+			return ids, nil
+		},
+		Scan: func(id string) error {
+			err := scanImageID(cmd, veinmindRuntime, id)
+			digestsMu.Lock()
+			repo, ok := pulled[id]
+			digestsMu.Unlock()
+			if ok && registry.IsContentMissing(err) {
+				return repullScan(cmd, c, veinmindRuntime, id, repo, err)
+			}
+			return err
+		},
+		Remove: func(id string) error {
+			pulledID := id
+			if cc, ok := c.(*registry.RegistryContainerdClient); ok {
+				// Content is garbage collected along with the image
+				// once lease is released
+				if err := cc.Release(ctx, id); err != nil {
+					log.Warnf("Release lease of %#v error: %s\n", id, err.Error())
+				}
+				digestsMu.Lock()
+				delete(pulled, id)
+				digestsMu.Unlock()
+				if keepImages {
+					log.Infof("Keep image pulled: %#v\n", id)
+					return nil
+				}
+				ref, err := containerdRemoveRef(veinmindRuntime, id)
 				if err != nil {
-					log.Error(err)
-					continue
+					return err
 				}
+				id = ref
+			} else if keepImages {
+				log.Infof("Keep image pulled: %#v\n", id)
+				return nil
+			}
 
-				domain := reference.Domain(rNamed)
-				if domain == "index.docker.io" || domain == "docker.io" {
-					repo = reference.Path(rNamed)
-					if (strings.Split(repo, "/")[0] == "library" || strings.Split(repo, "/")[0] == "_") && len(strings.Split(repo, "/")) >= 2 {
-						repo = strings.Join(strings.Split(repo, "/")[1:], "")
-					}
-				}
-			case *registry.RegistryContainerdClient:
-				repo = r
+			if err := c.Remove(ctx, id); err != nil {
+				return err
 			}
+			log.Infof("Remove image success: %#v\n", id)
+			recordRemoved(pulledLedger, runtime, pulledID)
+			return nil
+		},
+	}
 
-			ids, err := veinmindRuntime.FindImageIDs(repo)
-			switch c.(type) {
-			case *registry.RegistryDockerClient:
-				if len(ids) > 0 {
-					for _, id := range ids {
-						image, err := veinmindRuntime.OpenImageByID(id)
-						if err != nil {
-							log.Error(err)
-							continue
-						}
-
-						err = scan(cmd, image)
-						if err != nil {
-							log.Error(err)
-							continue
-						}
-					}
-
-					for _, id := range ids {
-						err = c.Remove(id)
-						if err != nil {
-							log.Error(err)
-						} else {
-							log.Infof("Remove image success: %#v\n", repo)
-						}
-					}
-				}
-			case *registry.RegistryContainerdClient:
-				image, err := veinmindRuntime.OpenImageByID(r)
-				if err != nil {
-					log.Error(err)
-					continue
-				}
+	if alwaysPull, _ := cmd.Flags().GetBool("always-pull"); !alwaysPull {
+		steps.Local = func(repo string) ([]string, bool) {
+			digest, err := resolveDigest(c, repo)
+			if err != nil {
+				log.Warnf("Resolve digest of %#v error, pull it: %s\n", repo, err.Error())
+				return nil, false
+			}
 
-				var (
-					repoRef string
-				)
-				repoRefs, err := image.RepoRefs()
-				if len(repoRefs) > 0 {
-					repoRef = repoRefs[0]
-				} else {
-					repoRef = image.ID()
-				}
+			id, err := c.Lookup(ctx, repo, digest.DigestStr())
+			if err != nil {
+				log.Warnf("Lookup local image of %#v error, pull it: %s\n", repo, err.Error())
+			}
+			if id == "" {
+				digestsMu.Lock()
+				digests[repo] = digest.DigestStr()
+				digestsMu.Unlock()
+				return nil, false
+			}
 
-				err = scan(cmd, image)
-				if err != nil {
-					log.Error(err)
-				}
+			log.Infof("Image %#v is present locally, skip pull: %#v\n", repo, digest.DigestStr())
+			runnerReporter.AddPull(reporter.Pull{Ref: repo, Digest: digest.DigestStr(), Source: reporter.SourceCached})
+			setTarget(id, repo)
+			return []string{id}, true
+		}
+	}
 
-				err = c.Remove(repoRef)
-				if err != nil {
-					log.Error(err)
-				} else {
-					log.Infof("Remove image success: %#v\n", repo)
-				}
+	if include, _ := cmd.Flags().GetBool("include-artifacts"); !include {
+		steps.Skip = func(repo string) bool {
+			return skipArtifact(c, repo)
+		}
+	}
+
+	if len(verifiers) > 0 {
+		steps.Verify = func(repo string) bool {
+			return verifiers.verify(c, repo)
+		}
+	}
+
+	// Images scanned concurrently may share layers with images removed
+	steps.Removals = newRemovals(cmd, veinmindRuntime, steps.Remove)
+	return steps
+}
+
+// registryRuntime returns runtime which images are pulled into by c
+func registryRuntime(c registry.Client) string {
+	if _, ok := c.(*registry.RegistryContainerdClient); ok {
+		return detect.Containerd
+	}
+	return detect.Docker
+}
+
+// dockerFindRef returns reference to find image pulled by docker,
+// images of docker hub are found by path without the library namespace
+func dockerFindRef(r string) (string, error) {
+	rNamed, err := reference.ParseDockerRef(r)
+	if err != nil {
+		return "", err
+	}
+
+	repo := r
+	domain := reference.Domain(rNamed)
+	if domain == "index.docker.io" || domain == "docker.io" {
+		repo = reference.Path(rNamed)
+		if (strings.Split(repo, "/")[0] == "library" || strings.Split(repo, "/")[0] == "_") && len(strings.Split(repo, "/")) >= 2 {
+			repo = strings.Join(strings.Split(repo, "/")[1:], "")
+		}
+	}
+	return repo, nil
+}
+
+// containerdRemoveRef returns reference to remove image pulled by
+// containerd, image id is used if image has no reference
+func containerdRemoveRef(veinmindRuntime api.Runtime, id string) (string, error) {
+	image, err := veinmindRuntime.OpenImageByID(id)
+	if err != nil {
+		return "", err
+	}
+	defer image.Close()
+
+	repoRefs, err := image.RepoRefs()
+	if err == nil && len(repoRefs) > 0 {
+		return repoRefs[0], nil
+	}
+	return image.ID(), nil
+}
+
+// printFailedTargets prints table of targets which failed to be scanned
+func printFailedTargets(w io.Writer, failures []target.Failure) {
+	if len(failures) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "FAILED TARGET\tSTAGE\tCODE\tERROR\n")
+	for _, f := range failures {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.Target, f.Stage, f.Code, f.Error)
+	}
+	tw.Flush()
+}
+
+// resolveRepos returns repos of args, or all repos of server through
+// catalog or all tags of registry storage if no repo is specified,
+// repos are filtered by namespaces
+func resolveRepos(ctx context.Context, c registry.Client, server string, namespaces []string, args []string) ([]string, error) {
+	filter, err := target.NewNamespaceFilter(server, namespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	// If no repo is specified, then query all repo through catalog
+	repos := []string{}
+	if len(args) == 0 && registryStorage != nil {
+		repos, err = storageRepos(server)
+		if err != nil {
+			return nil, err
+		}
+	} else if len(args) == 0 {
+		switch c := c.(type) {
+		case *registry.RegistryDockerClient:
+			repos, err = c.GetRepos(ctx, server)
+			if err != nil {
+				return nil, err
 			}
 		}
+	} else {
+		// If it doesn't start with registry, autofill registry
+		for _, r := range args {
+			rParse, err := reference.Parse(r)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
 
-		return nil
-	},
-	PostRunE: scanPostRunE,
+			repos = append(repos, rParse.String())
+		}
+	}
+
+	return filter.Filter(repos)
 }
 
 func scan(c *cmd.Command, image api.Image) error {
@@ -350,67 +838,117 @@ func scan(c *cmd.Command, image api.Image) error {
 		ref = image.ID()
 	}
 
-	// Get threads value
-	t, err := c.Flags().GetInt("threads")
-	if err != nil {
-		t = 5
+	if entry, ok := allowlistStore.Match(image); ok {
+		log.Infof("Image %#v is allowlisted by %#v\n", ref, entry.String())
+		runnerReporter.MarkAllowlisted(image.ID())
+	}
+	if !verifyImageLayers(c, image) {
+		return nil
+	}
+	block := imageBlock(c, image)
+	runnerReporter.SetImage(block)
+	index := layer.NewIndex(image)
+	runnerReporter.SetLayerIndex(image.ID(), index)
+	detectBaseImage(image, index)
+	checkBuildHistory(image)
+	skipped := skipPlugins(c, image)
+	skipped = append(skipped, unsupportedOSPlugins(block)...)
+
+	var scopedLayers []string
+	if layerScope != nil {
+		scopedLayers = layerScope.scopeLayers(image)
+		log.Infof("Scan %d layer(s) of image: %#v\n", len(scopedLayers), ref)
 	}
 
-	log.Infof("Scan image: %#v\n", ref)
-	if err := cmd.ScanImage(ctx, ps, image,
-		plugin.WithExecInterceptor(func(
-			ctx context.Context, plug *plugin.Plugin, c *plugin.Command,
-			next func(context.Context, ...plugin.ExecOption) error,
-		) error {
-			// Register Service
-			reg := service.NewRegistry()
-			reg.AddServices(log.WithFields(log.Fields{
-				"plugin":  plug.Name,
-				"command": path.Join(c.Path...),
-			}))
-			reg.AddServices(reportService)
-
-			// Next Plugin
-			return next(ctx, reg.Bind())
-		}), plugin.WithExecParallelism(t)); err != nil {
+	atomic.AddInt64(&scannedImages, 1)
+	archives := newImageArchives(c, image)
+	walked := newImageWalk(image)
+	materialized := newImageRootfs(image, walked)
+	defer closeImageRootfs(materialized, ref)
+	threads, done, err := adaptImage(image, block, walked)
+	if err != nil {
 		return err
 	}
-	return nil
+	defer done()
+	threads = throttleThreads(threads)
+	cached := layerCacheOption(image, index, scopedLayers)
+	start := time.Now()
+	err = scanRunner.ScanImage(ctx, image, runner.WithSkipPlugins(skipped), runner.WithThreads(threads), cached, runner.WithServices(func(plug *plugin.Plugin) []runner.Service {
+		services := []runner.Service{
+			&pluginHashService{cache: hashCache, image: image},
+			newScanContextService(c, image, ref),
+			&pluginLayerService{imageID: image.ID(), index: index},
+			&pluginArchiveService{archives: archives, plugin: plug.Name},
+			&pluginWalkService{walk: walked, plugin: plug.Name},
+		}
+		if quarantineStore != nil {
+			services = append(services, &pluginQuarantineService{store: quarantineStore, plugin: plug.Name})
+		}
+		if artifactStore != nil {
+			services = append(services, &pluginArtifactService{store: artifactStore, plugin: plug.Name})
+		}
+		if layerScope != nil {
+			services = append(services, scope.NewScopeService(image.ID(), scopedLayers))
+		}
+		if needsRootfs(plug) {
+			services = append(services, &pluginRootfsService{rootfs: materialized, image: image.ID(), plugin: plug.Name})
+		}
+		return services
+	}), runner.WithAfterExec(func(plug *plugin.Plugin, services []runner.Service, events int64, err error) {
+		// Scope service of layer cache alone doesn't narrow coverage
+		if layerScope == nil {
+			return
+		}
+		for _, s := range services {
+			if s, ok := s.(*scope.ScopeService); ok {
+				recordCoverage(image, plug.Name, s, scopedLayers)
+			}
+		}
+	}))
+	recordImageWalk(walked, time.Since(start))
+	exportFlaggedFiles(image)
+	return err
 }
 
 func init() {
 	// Cobra init
-	rootCmd.AddCommand(cmd.MapImageCommand(scanHostCmd, scan))
+	rootCmd.AddCommand(scanHostCmd)
 	rootCmd.AddCommand(scanRegistryCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.PersistentFlags().IntP("exit-code", "e", 0, "exit-code when veinmind-runner find security issues")
 	listCmd.AddCommand(listPluginCmd)
+	listCmd.PersistentFlags().String("format", listing.FormatTable, "output format of list, json or table")
 	listPluginCmd.Flags().BoolP("verbose", "v", false, "verbose mode")
+	listPluginCmd.Flags().MarkDeprecated("verbose", "use --format json instead")
 	scanHostCmd.Flags().StringP("glob", "g", "", "specifies the pattern of plugin file to find")
-	scanHostCmd.Flags().StringP("output", "o", "report.json", "output filepath of report")
-	scanHostCmd.Flags().IntP("threads", "t", 5, "threads for scan action")
+	scanHostCmd.Flags().VarP(newThreadsValue(defaultThreads), "threads", "t", "threads for scan action, adaptive picks them per image by its size")
+	scanHostCmd.Flags().String("allowlist", "", "allowlist file of trusted images")
 	scanRegistryCmd.Flags().StringP("runtime", "r", "docker", "specifies the runtime of registry client to use")
 	scanRegistryCmd.Flags().StringP("glob", "g", "", "specifies the pattern of plugin file to find")
-	scanRegistryCmd.Flags().StringP("output", "o", "report.json", "output filepath of report")
 	scanRegistryCmd.Flags().StringP("server", "s", "index.docker.io", "server address of registry")
 	scanRegistryCmd.Flags().StringP("config", "c", "", "auth config path")
-	scanRegistryCmd.Flags().StringP("namespace", "n", "", "namespace of repo")
+	scanRegistryCmd.Flags().StringSliceP("namespace", "n", nil, "namespaces of repos, nested paths and globs are matched, repeatable")
 	scanRegistryCmd.Flags().StringSliceP("tags", "t", []string{"latest"}, "tags of repo")
-	scanRegistryCmd.Flags().Int("threads", 5, "threads for scan action")
-
-	// Service client init
-	reportService = report.NewReportService()
-
-	// Reporter init
-	r, err := reporter.NewReporter()
-	if err != nil {
-		log.Fatal(err)
-	}
-	runnerReporter = r
+	scanRegistryCmd.Flags().Var(newThreadsValue(defaultThreads), "threads", "threads for scan action, adaptive picks them per image by its size")
+	scanRegistryCmd.Flags().String("allowlist", "", "allowlist file of trusted images")
+	scanRegistryCmd.Flags().Bool("fail-fast", false, "abort the scan on the first failed target")
+	scanRegistryCmd.Flags().Bool("always-pull", false, "pull images even if their digest is present locally")
+	scanRegistryCmd.Flags().Bool("verify-signature", false, "verify cosign signature of image before pulling")
+	scanRegistryCmd.Flags().Bool("require-signature", false, "skip pulling image whose cosign signature can't be verified")
+	scanRegistryCmd.Flags().String("cosign-key", "", "public key path or KMS reference (hashivault://, gcpkms://, k8s://) used to verify cosign signature")
+	scanRegistryCmd.Flags().String("cosign-cert-chain", "", "root certificates used to verify keyless cosign signature")
+	scanRegistryCmd.Flags().String("cosign-rekor-key", "", "rekor public key used to verify transparency log bundle of keyless cosign signature")
+	scanRegistryCmd.Flags().String("cosign-identity", "", "expected signer identity of keyless cosign signature, required by keyless verification")
+	scanRegistryCmd.Flags().String("cosign-oidc-issuer", "", "expected OIDC issuer of keyless cosign signature, required by keyless verification")
 }
 
 func main() {
+	// Errors are rendered with their codes and hints
+	rootCmd.SilenceErrors = true
 	if err := rootCmd.Execute(); err != nil {
+		errcode.Render(os.Stderr, err)
+		runError = err
+		emitSummary(1)
 		os.Exit(1)
 	}
 }
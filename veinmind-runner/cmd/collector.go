@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/collector"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/compare"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/gate"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/history"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+var collectorCmd = &cobra.Command{
+	Use:   "collector",
+	Short: "collect events of agents and inspect aggregated results",
+}
+
+var collectorServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "receive events of agents over mutual TLS",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listen, _ := cmd.Flags().GetString("listen")
+		db, _ := cmd.Flags().GetString("db")
+		queueSize, _ := cmd.Flags().GetInt("queue-size")
+		maxBatchSize, _ := cmd.Flags().GetInt64("max-batch-size")
+		cert, _ := cmd.Flags().GetString("tls-cert")
+		key, _ := cmd.Flags().GetString("tls-key")
+		ca, _ := cmd.Flags().GetString("tls-ca")
+
+		tlsConfig, err := collector.TLSConfig(cert, key, ca, true)
+		if err != nil {
+			return err
+		}
+
+		store, err := history.Open(db)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		lis, err := net.Listen("tcp", listen)
+		if err != nil {
+			return err
+		}
+
+		serveCtx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		s := collector.NewServer(store, queueSize, maxBatchSize)
+		persisted := make(chan struct{})
+		go func() {
+			defer close(persisted)
+			s.Run()
+		}()
+
+		server := s.GRPCServer(tlsConfig)
+		shutdown := make(chan struct{})
+		go func() {
+			defer close(shutdown)
+			<-serveCtx.Done()
+			// Batches being received are acknowledged before stop, the
+			// rest are retried by agents
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				server.GracefulStop()
+			}()
+			select {
+			case <-stopped:
+			case <-time.After(10 * time.Second):
+				server.Stop()
+			}
+		}()
+
+		log.Infof("Collector listen on %#v\n", listen)
+		err = server.Serve(lis)
+
+		// Batches acknowledged to agents are persisted before store
+		// is closed, agents have removed them from their spools
+		stop()
+		<-shutdown
+		s.Close()
+		<-persisted
+
+		return err
+	},
+}
+
+var collectorListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list latest results of agents",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		records, err := loadHistory(cmd)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range history.Latest(records) {
+			counts := map[string]int{}
+			for _, evt := range r.Events {
+				counts[reporter.LevelString(evt.Level)]++
+			}
+
+			fmt.Fprintf(os.Stdout, "%s\t%s\t%s\t%d event(s)", r.Agent, r.Host, r.Time.Format(time.RFC3339), len(r.Events))
+			for _, l := range reporter.Levels {
+				if n := counts[reporter.LevelString(l)]; n > 0 {
+					fmt.Fprintf(os.Stdout, "\t%s: %d", reporter.LevelString(l), n)
+				}
+			}
+			fmt.Fprintln(os.Stdout)
+		}
+
+		return nil
+	},
+}
+
+var collectorDiffCmd = &cobra.Command{
+	Use:   "diff <agent>",
+	Short: "compare the latest two results of agent",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		records, err := loadHistory(cmd)
+		if err != nil {
+			return err
+		}
+
+		runs := history.Runs(records, args[0])
+		if len(runs) < 2 {
+			return errors.Errorf("agent %#v has %d result(s), at least 2 are required", args[0], len(runs))
+		}
+
+		base, target := runs[len(runs)-2], runs[len(runs)-1]
+		delta := compare.Compare(base.Events, target.Events)
+		delta.Base = strconv.FormatUint(base.Seq, 10) + " " + base.Time.Format(time.RFC3339)
+		delta.Target = strconv.FormatUint(target.Seq, 10) + " " + target.Time.Format(time.RFC3339)
+		printDelta(os.Stdout, delta)
+
+		return nil
+	},
+}
+
+var collectorGateCmd = &cobra.Command{
+	Use:   "gate",
+	Short: "evaluate latest results of all agents",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := newGateOptions(cmd)
+		if err != nil {
+			return err
+		}
+
+		records, err := loadHistory(cmd)
+		if err != nil {
+			return err
+		}
+
+		events := []reporter.Event{}
+		for _, r := range history.Latest(records) {
+			events = append(events, r.Events...)
+		}
+
+		decision := gate.Evaluate(events, opts)
+		printDecision(os.Stdout, decision)
+		if decision.Fail {
+			exitcode, _ := cmd.Flags().GetInt("exit-code")
+			if !cmd.Flags().Changed("exit-code") {
+				exitcode = 1
+			}
+			os.Exit(exitcode)
+		}
+
+		return nil
+	},
+}
+
+func loadHistory(c *cobra.Command) ([]history.Record, error) {
+	db, _ := c.Flags().GetString("db")
+	store, err := history.Open(db)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	return store.Records()
+}
+
+func init() {
+	rootCmd.AddCommand(collectorCmd)
+	collectorCmd.AddCommand(collectorServeCmd, collectorListCmd, collectorDiffCmd, collectorGateCmd)
+	collectorCmd.PersistentFlags().String("db", "history.jsonl", "history file of collected results")
+	collectorServeCmd.Flags().String("listen", ":8443", "address to listen")
+	collectorServeCmd.Flags().Int("queue-size", 64, "max number of batches waiting to be persisted")
+	collectorServeCmd.Flags().Int64("max-batch-size", 64<<20, "max bytes of a batch message, larger batches are refused")
+	collectorServeCmd.Flags().String("tls-cert", "", "server certificate for mutual TLS")
+	collectorServeCmd.Flags().String("tls-key", "", "server key for mutual TLS")
+	collectorServeCmd.Flags().String("tls-ca", "", "CA which signs certificates of agents")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/containerd"
+	"github.com/chaitin/libveinmind/go/docker"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/compare"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/gate"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/imageid"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layer"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// compareImages are base and target image of compare command
+var compareImages []api.Image
+
+var compareCmd = &cobra.Command{
+	Use:     "compare <base image> <target image>",
+	Short:   "scan two images and report introduced, fixed and unchanged findings",
+	Args:    cobra.ExactArgs(2),
+	PreRunE: scanPreRunE,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		runtime, _ := cmd.Flags().GetString("runtime")
+
+		var (
+			veinmindRuntime api.Runtime
+			err             error
+		)
+		switch runtime {
+		case "docker":
+			veinmindRuntime, err = docker.New()
+		case "containerd":
+			veinmindRuntime, err = containerd.New()
+		default:
+			return errcode.New(errcode.RuntimeMismatch, "", "runtime not match")
+		}
+		if err != nil {
+			return err
+		}
+
+		compareImages = []api.Image{}
+		for _, ref := range args {
+			ids, err := imageid.Find(veinmindRuntime, ref)
+			if err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return errors.Errorf("image %#v not found", ref)
+			}
+
+			image, err := veinmindRuntime.OpenImageByID(ids[0])
+			if err != nil {
+				return err
+			}
+			compareImages = append(compareImages, image)
+		}
+
+		if compareImages[0].ID() == compareImages[1].ID() {
+			log.Warnf("Image %#v and %#v are the same image\n", args[0], args[1])
+			return scan(cmd, compareImages[1])
+		}
+
+		for _, image := range compareImages {
+			if err := scan(cmd, image); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+	PostRunE: func(cmd *cobra.Command, args []string) error {
+		scanRunner.Close()
+		closeAudit(scanRunner)
+		flushPluginOutput(scanRunner)
+		stopTracing(len(runnerReporter.Snapshot().Events))
+		logHashCacheStats()
+		logScheduleStats(scanRunner)
+		enrichEvents()
+
+		base, target := compareImages[0], compareImages[1]
+		baseEvents, targetEvents := []reporter.Event{}, []reporter.Event{}
+		for _, evt := range runnerReporter.Snapshot().Events {
+			if evt.ID == target.ID() {
+				targetEvents = append(targetEvents, evt)
+			} else if evt.ID == base.ID() {
+				baseEvents = append(baseEvents, evt)
+			}
+		}
+
+		// Same image is scanned once and has no delta
+		if base.ID() == target.ID() {
+			baseEvents = targetEvents
+		}
+
+		delta := compare.Compare(baseEvents, targetEvents)
+		delta.Base, delta.Target = args[0], args[1]
+		delta.Attribute(layer.NewLocator(target))
+
+		printDelta(os.Stdout, delta)
+
+		b, err := json.MarshalIndent(delta, "", "  ")
+		if err != nil {
+			return err
+		}
+		output, _ := cmd.Flags().GetString("output")
+		if err := ioutil.WriteFile(output, append(b, '\n'), 0644); err != nil {
+			log.Error(err)
+		}
+
+		exitcode, _ := cmd.Flags().GetInt("exit-code")
+		if exitcode == 0 {
+			return nil
+		}
+
+		// Only introduced findings fail the comparison
+		decision := gate.Evaluate(delta.Events(), gateOptions)
+		logDecision(decision)
+		if decision.Fail {
+			os.Exit(exitcode)
+		}
+
+		return nil
+	},
+}
+
+func printDelta(w io.Writer, d compare.Delta) {
+	fmt.Fprintf(w, "Compare %s -> %s\n", d.Base, d.Target)
+	fmt.Fprintf(w, "Introduced: %d, Fixed: %d, Unchanged: %d\n", len(d.Introduced), len(d.Fixed), len(d.Unchanged))
+
+	sections := []struct {
+		name     string
+		findings []compare.Finding
+	}{
+		{"Introduced", d.Introduced},
+		{"Fixed", d.Fixed},
+	}
+	for _, s := range sections {
+		if len(s.findings) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s:\n", s.name)
+		for _, f := range s.findings {
+			fmt.Fprintf(w, "  - [%s] %s %s\n", reporter.LevelString(f.Level),
+				reporter.AlertTypeString(f.AlertType), reporter.Describe(f.AlertDetails))
+			for _, l := range f.Layers {
+				fmt.Fprintf(w, "      %s from layer %d %s\n", l.Path, l.Index, l.ID)
+			}
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+	compareCmd.Flags().StringP("runtime", "r", "docker", "specifies the runtime of images")
+	compareCmd.Flags().StringP("glob", "g", "", "specifies the pattern of plugin file to find")
+	compareCmd.Flags().StringP("output", "o", "compare.json", "output filepath of compare report")
+	compareCmd.Flags().IntP("threads", "t", 5, "threads for scan action")
+	compareCmd.Flags().String("allowlist", "", "allowlist file of trusted images")
+}
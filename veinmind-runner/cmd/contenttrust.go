@@ -0,0 +1,170 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/cosign"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/notary"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+type contentTrustVerifier struct {
+	*notary.Verifier
+	require bool
+}
+
+// newContentTrustVerifier creates verifier of docker content trust
+// from flags, nil is returned if it isn't enabled
+func newContentTrustVerifier(c *cobra.Command) (*contentTrustVerifier, error) {
+	verify, _ := c.Flags().GetBool("verify-content-trust")
+	require, _ := c.Flags().GetBool("require-content-trust")
+	if !verify && !require {
+		return nil, nil
+	}
+
+	server, _ := c.Flags().GetString("content-trust-server")
+	root, _ := c.Flags().GetString("content-trust-root")
+
+	v := &notary.Verifier{Server: server}
+	if root != "" {
+		b, err := ioutil.ReadFile(root)
+		if err != nil {
+			return nil, err
+		}
+		if v.RootKeys, err = notary.ParseRootKeys(b); err != nil {
+			return nil, errors.Wrapf(err, "content trust root %s", root)
+		}
+	} else {
+		log.Warn("Root of content trust isn't pinned, root keys served by trust server are trusted")
+	}
+
+	return &contentTrustVerifier{Verifier: v, require: require}, nil
+}
+
+// verify resolves signed target of repo from trust server and compares
+// it with the manifest digest in registry before pulling, the result
+// is recorded in report metadata the same as cosign verification
+func (v *contentTrustVerifier) verify(c registry.Client, repo string) bool {
+	// Verifier is shared by targets verified concurrently
+	nv := *v.Verifier
+	var opts []remote.Option
+	if dc, ok := c.(*registry.RegistryDockerClient); ok {
+		opts, _ = dc.RemoteOptions(repo)
+		nv.Credentials = func(ref string) (string, string) {
+			auth, _ := dc.RepoAuth(ref)
+			return auth.Username, auth.Password
+		}
+	}
+
+	result := reporter.SignatureVerification{
+		Scheme:    "notary",
+		Reference: repo,
+	}
+	err := func() error {
+		digest, err := cosign.Resolve(repo, opts...)
+		if err != nil {
+			return err
+		}
+		result.Digest = digest.DigestStr()
+
+		target, err := nv.Verify(repo)
+		if err != nil {
+			return err
+		}
+		result.Signer = strings.Join(target.Signers, ",")
+		result.Role = target.Role
+		if target.Digest != result.Digest {
+			return errors.Errorf("notary: signed digest %s of %s doesn't match manifest digest", target.Digest, target.Name)
+		}
+		return nil
+	}()
+	result.Verified = err == nil
+
+	if err != nil {
+		log.Warnf("Verify content trust failed: %#v, %s\n", repo, err.Error())
+		result.Error = err.Error()
+		runnerReporter.AddSignature(result)
+		runnerReporter.Send(report.ReportEvent{
+			ID:         repo,
+			Time:       time.Now(),
+			Level:      report.High,
+			DetectType: report.Image,
+			EventType:  report.Risk,
+			AlertType:  report.Signature,
+			AlertDetails: []report.AlertDetail{
+				{
+					SignatureDetail: &report.SignatureDetail{
+						Reference: repo,
+						Digest:    result.Digest,
+						Scheme:    "notary",
+						Reason:    err.Error(),
+					},
+				},
+			},
+		})
+
+		return !v.require
+	}
+
+	log.Infof("Verify content trust success: %#v\n", repo)
+	runnerReporter.AddSignature(result)
+	return true
+}
+
+// imageVerifier verifies image before pulling, it returns false if
+// image shouldn't be pulled
+type imageVerifier interface {
+	verify(c registry.Client, repo string) bool
+}
+
+// imageVerifiers runs every enabled scheme so that results of all
+// schemes are recorded, image is pulled only if none refuses it
+type imageVerifiers []imageVerifier
+
+func newImageVerifiers(c *cobra.Command) (imageVerifiers, error) {
+	verifiers := imageVerifiers{}
+
+	signature, err := newSignatureVerifier(c)
+	if err != nil {
+		return nil, err
+	}
+	if signature != nil {
+		verifiers = append(verifiers, signature)
+	}
+
+	contentTrust, err := newContentTrustVerifier(c)
+	if err != nil {
+		return nil, err
+	}
+	if contentTrust != nil {
+		verifiers = append(verifiers, contentTrust)
+	}
+
+	return verifiers, nil
+}
+
+func (vs imageVerifiers) verify(c registry.Client, repo string) bool {
+	pull := true
+	for _, v := range vs {
+		if !v.verify(c, repo) {
+			pull = false
+		}
+	}
+	return pull
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanRegistryCmd, scanManifestCmd} {
+		c.Flags().Bool("verify-content-trust", false, "verify docker content trust of image before pulling")
+		c.Flags().Bool("require-content-trust", false, "skip pulling image whose docker content trust can't be verified")
+		c.Flags().String("content-trust-server", "", "address of notary server, trust server of registry is used if empty")
+		c.Flags().String("content-trust-root", "", "pinned root certificates or public keys of content trust")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go/plugin"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/runner"
+	"github.com/spf13/cobra"
+)
+
+// discoverPlugins discovers plugins selected by --glob and --plugins,
+// no plugin discovered fails unless --allow-no-plugins is specified.
+// Plugins with incompatible API version are skipped and returned
+// unless --strict-compat is specified
+func discoverPlugins(ctx context.Context, c *cobra.Command) ([]*plugin.Plugin, []runner.Incompatible, error) {
+	glob, _ := c.Flags().GetString("glob")
+	names, _ := c.Flags().GetStringSlice("plugins")
+	allowEmpty, _ := c.Flags().GetBool("allow-no-plugins")
+	strictCompat, _ := c.Flags().GetBool("strict-compat")
+
+	return runner.Discover(ctx, runner.DiscoverOptions{
+		Glob:         glob,
+		Names:        names,
+		AllowEmpty:   allowEmpty,
+		StrictCompat: strictCompat,
+	})
+}
+
+// recordIncompatible records plugins skipped for incompatible API
+// version in coverage
+func recordIncompatible(incompatible []runner.Incompatible) {
+	for _, i := range incompatible {
+		runnerReporter.AddCoverage(reporter.Coverage{
+			Plugin: i.Plugin,
+			Scope:  reporter.ScopeIncompatible,
+			Reason: i.Reason,
+		})
+	}
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd, compareCmd, agentCmd, workerCmd, serverCmd} {
+		c.Flags().StringSlice("plugins", nil, "names of plugins to run, all discovered plugins by default")
+		c.Flags().Bool("allow-no-plugins", false, "allow scanning when no plugin is discovered")
+		c.Flags().Bool("strict-compat", false, "fail instead of skipping plugins with incompatible api version")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/target"
+	"github.com/spf13/cobra"
+	"strings"
+	"sync/atomic"
+)
+
+// exitEmptyScan is exit code of a scan which scanned no image, apart
+// from --exit-code of findings and 1 of --strict
+const exitEmptyScan = 3
+
+// targetFunnel records targets left at each stage of resolving targets
+var targetFunnel *target.Funnel
+
+// filterFlag formats flag applied as filter of targets, empty if the
+// flag isn't set
+func filterFlag(c *cobra.Command, name string) string {
+	f := c.Flags().Lookup(name)
+	if f == nil || !f.Changed {
+		return ""
+	}
+	if f.Value.Type() == "bool" {
+		return "--" + name
+	}
+	return "--" + name + "=" + f.Value.String()
+}
+
+// targetFilters returns filters of flags set, args are filters too
+func targetFilters(c *cobra.Command, args []string, names ...string) []string {
+	filters := []string{}
+	if len(args) > 0 {
+		filters = append(filters, "args="+strings.Join(args, ","))
+	}
+	for _, name := range names {
+		if filter := filterFlag(c, name); filter != "" {
+			filters = append(filters, filter)
+		}
+	}
+	return filters
+}
+
+// emptyScanExit returns exit code of a scan which scanned no image,
+// either because no target is left after filtering or every target
+// failed. Targets at each stage are printed, so that an empty scan
+// never looks like a clean pass. Dry runs and rescans of reports
+// without failed targets aren't empty scans
+func emptyScanExit(c *cobra.Command, failures []target.Failure) int {
+	if dryRun, _ := c.Flags().GetBool("dry-run"); dryRun {
+		return 0
+	}
+	if rescanDoc != nil && len(rescanTargets) == 0 {
+		return 0
+	}
+	scanned := atomic.LoadInt64(&scannedImages)
+	if scanned > 0 {
+		return 0
+	}
+
+	targetFunnel.Record("failed", len(failures))
+	targetFunnel.Record("scanned", int(scanned))
+	targetFunnel.Write(consoleWriter(c))
+
+	if allow, _ := c.Flags().GetBool("allow-empty-scan"); allow {
+		log.Warn("No image was scanned")
+		return 0
+	}
+	log.Errorf("No image was scanned, exit with %d, set --allow-empty-scan to allow it\n", exitEmptyScan)
+	return exitEmptyScan
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().Bool("allow-empty-scan", false, "exit with 0 rather than 3 when no image is scanned")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/target"
+)
+
+// runError is the error the command failed with, its code is part of
+// the summary line
+var runError error
+
+// pullError returns error pulling repo with hint naming registry of
+// repo, errors which aren't failures of registry are left as they are
+func pullError(repo string, err error) error {
+	if registryStorage != nil {
+		return storagePullError(repo, err)
+	}
+	domain := registryDomain(repo)
+	switch code := errcode.CodeOf(err); code {
+	case errcode.RegistryAuth:
+		if registryTokens.Serves(domain) {
+			return errcode.Wrap(err, code, fmt.Sprintf("token of %s rejected; check --registry-token-cmd or --registry-token-provider", domain))
+		}
+		return errcode.Wrap(err, code, fmt.Sprintf("credentials for %s not found or rejected; try --config or docker login %s", domain, domain))
+	case errcode.RegistryNotFound:
+		return errcode.Wrap(err, code, fmt.Sprintf("check %s exists, e.g. with veinmind-runner registry check --server %s", repo, domain))
+	case errcode.RegistryRateLimited:
+		return errcode.Wrap(err, code, fmt.Sprintf("%s rate limits pulls; authenticate to it or lower --per-registry-concurrency", domain))
+	case errcode.RegistryUnreachable:
+		return errcode.Wrap(err, code, fmt.Sprintf("%s is unreachable; check network access to it or pull through another path with --pull-via", domain))
+	}
+	return err
+}
+
+// errorCodes returns codes of failed targets, of coverage entries and
+// of the error of the command
+func errorCodes(failures []target.Failure, coverage []reporter.Coverage) []string {
+	codes := []errcode.Code{errcode.CodeOf(runError)}
+	for _, f := range failures {
+		codes = append(codes, f.Code)
+	}
+	for _, c := range coverage {
+		codes = append(codes, c.Code)
+	}
+	return errcode.Codes(codes...)
+}
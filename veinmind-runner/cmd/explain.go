@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/scanconfig"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// configFileFlags are flags of scan commands naming files of
+// configuration, their hashes are recorded in report
+var configFileFlags = []string{
+	"config", "ignore-file", "policy", "allowlist",
+	"normalize-rules", "priority-file", "base-images-file", "tenants-file",
+	"remediation-rules", "redact-rules", "profiles-file",
+}
+
+// recordConfiguration records resolved flags, files of configuration
+// and plugins of scan in metadata of report
+func recordConfiguration(c *cobra.Command, args []string) {
+	cfg := scanconfig.Config{
+		Command: c.CommandPath(),
+		Args:    args,
+		Flags:   []scanconfig.Flag{},
+	}
+	c.Flags().VisitAll(func(f *pflag.Flag) {
+		cfg.Flags = append(cfg.Flags, scanconfig.NewFlag(f.Name, f.Value.Type(), f.Value.String(), f.Changed))
+	})
+	scanconfig.SortFlags(cfg.Flags)
+	if profileResolution != nil {
+		cfg.Profile = profileResolution
+		for i, f := range cfg.Flags {
+			for _, applied := range profileResolution.Applied {
+				if f.Name == applied {
+					cfg.Flags[i].Profile = profileResolution.Name
+				}
+			}
+		}
+	}
+
+	for _, name := range configFileFlags {
+		if c.Flags().Lookup(name) == nil {
+			continue
+		}
+		if path, _ := c.Flags().GetString(name); path != "" {
+			cfg.Files = append(cfg.Files, scanconfig.NewFile(name, path))
+		}
+	}
+
+	for _, p := range scanRunner.Plugins {
+		cfg.Plugins = append(cfg.Plugins, scanconfig.NewPlugin(p.Name, p.Version, p.Path))
+	}
+
+	runnerReporter.SetConfiguration(cfg)
+}
+
+// printConfiguration pretty prints configuration of scan, followed by
+// command line reproducing it
+func printConfiguration(w io.Writer, cfg *scanconfig.Config) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Command:\t%s\n", cfg.Command)
+	if len(cfg.Args) > 0 {
+		fmt.Fprintf(tw, "Args:\t%s\n", strings.Join(cfg.Args, " "))
+	}
+
+	fmt.Fprintln(tw, "\nFlags given:")
+	for _, f := range cfg.Flags {
+		if f.Changed {
+			fmt.Fprintf(tw, "  --%s\t%s\n", f.Name, f.Value)
+		}
+	}
+
+	if p := cfg.Profile; p != nil {
+		fmt.Fprintf(tw, "\nProfile %s (%s):\n", p.Name, p.Source)
+		for _, f := range cfg.Flags {
+			if f.Profile != "" {
+				fmt.Fprintf(tw, "  --%s\t%s\n", f.Name, f.Value)
+			}
+		}
+		if len(p.Overridden) > 0 {
+			fmt.Fprintf(tw, "  overridden by flags given:\t%s\n", strings.Join(p.Overridden, ","))
+		}
+	}
+
+	if len(cfg.Files) > 0 {
+		fmt.Fprintln(tw, "\nFiles:")
+		for _, f := range cfg.Files {
+			fmt.Fprintf(tw, "  --%s\t%s\t%s\n", f.Flag, f.Path, hashOrError(f.SHA256, f.Error))
+		}
+	}
+
+	if len(cfg.Plugins) > 0 {
+		fmt.Fprintln(tw, "\nPlugins:")
+		for _, p := range cfg.Plugins {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", p.Name, p.Version, hashOrError(p.SHA256, p.Error), p.Path)
+		}
+	}
+
+	fmt.Fprintf(tw, "\nReproduce:\n  %s\n", cfg.Reproduce())
+	return tw.Flush()
+}
+
+func hashOrError(sum string, err string) string {
+	if err != "" {
+		return "error: " + err
+	}
+	return "sha256:" + sum
+}
+
+var explainCmd = &cobra.Command{
+	Use:   "explain <report.json>",
+	Short: "print effective configuration of the scan which wrote report",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		doc, err := reporter.Load(args[0])
+		if err != nil {
+			return err
+		}
+		if doc.Metadata.Configuration == nil {
+			return errors.Errorf("report %#v has no configuration, it's written by an older runner", args[0])
+		}
+		return printConfiguration(os.Stdout, doc.Metadata.Configuration)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+}
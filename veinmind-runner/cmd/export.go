@@ -0,0 +1,86 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/export"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/spf13/cobra"
+	"io"
+)
+
+// flaggedExport exports files flagged by events at or above level
+type flaggedExport struct {
+	dir    string
+	level  report.Level
+	limits export.Limits
+}
+
+var flaggedExporter *flaggedExport
+
+func newFlaggedExport(c *cobra.Command) (*flaggedExport, error) {
+	dir, _ := c.Flags().GetString("export-flagged-files")
+	if dir == "" {
+		return nil, nil
+	}
+
+	name, _ := c.Flags().GetString("export-level")
+	level, err := reporter.ParseLevel(name)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &flaggedExport{dir: dir, level: level}
+	e.limits.MaxFileSize, _ = c.Flags().GetInt64("export-max-file-size")
+	e.limits.MaxSize, _ = c.Flags().GetInt64("export-max-size")
+	return e, nil
+}
+
+// imageFS reads files of image for export
+type imageFS struct {
+	api.Image
+}
+
+func (fs imageFS) Open(path string) (io.ReadCloser, error) {
+	return fs.Image.Open(path)
+}
+
+// exportFlaggedFiles exports files flagged by events of image after
+// plugins finish, which waits events reported by plugins to reach
+// reporter
+func exportFlaggedFiles(image api.Image) {
+	if flaggedExporter == nil {
+		return
+	}
+	scanRunner.Wait()
+
+	paths := map[string][]string{}
+	for _, evt := range runnerReporter.Events() {
+		if evt.ID != image.ID() || reporter.LevelRank(evt.Level) < reporter.LevelRank(flaggedExporter.level) {
+			continue
+		}
+		for _, p := range reporter.Paths(evt.AlertDetails) {
+			paths[p] = append(paths[p], evt.Fingerprint)
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+
+	m, err := export.Export(flaggedExporter.dir, image.ID(), imageFS{image}, paths, flaggedExporter.limits)
+	if err != nil {
+		log.Errorf("Export flagged files of %#v error: %s\n", image.ID(), err.Error())
+		return
+	}
+	log.Infof("Export %d of %d flagged file(s) of %#v to %#v\n", m.Exported(), len(m.Files), image.ID(), m.Archive)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().String("export-flagged-files", "", "directory where files flagged by events are exported as <digest>.tar.gz per image")
+		c.Flags().String("export-level", "high", "min level of events whose files are exported")
+		c.Flags().Int64("export-max-file-size", 64<<20, "max size in bytes of a file exported")
+		c.Flags().Int64("export-max-size", 1<<30, "max total size in bytes of files exported per image")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/flush"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/spf13/cobra"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// reportFlusher flushes partial reports at --flush-interval, nil if
+	// it isn't set
+	reportFlusher *flush.Flusher
+	// flushOutputs are outputs partial reports are flushed to
+	flushOutputs []reporter.Output
+	// flushedPaths are paths outputs of timestamp policy are flushed
+	// to by their paths, the final report replaces the partial one
+	flushedPaths = map[string]string{}
+)
+
+// startFlush starts flushing partial reports to file outputs of command
+// at --flush-interval. Stdout can't be rewritten and appended outputs
+// would merge every partial report, so neither is flushed to
+func startFlush(c *cobra.Command) error {
+	interval, _ := c.Flags().GetDuration("flush-interval")
+	if interval <= 0 {
+		return nil
+	}
+	outputs, err := reportOutputs(c)
+	if err != nil {
+		return err
+	}
+
+	policy, _ := c.Flags().GetString("if-output-exists")
+	for _, o := range outputs {
+		if o.Path == reporter.Stdout {
+			continue
+		}
+		if policy == reporter.ExistsAppend {
+			log.Warnf("Partial reports aren't flushed to output %s which is appended to\n", o)
+			continue
+		}
+		if policy == reporter.ExistsTimestamp {
+			path := o.Path
+			if _, err := os.Stat(o.Path); err == nil {
+				path = reporter.TimestampPath(o.Path, scanStart)
+			}
+			flushedPaths[o.Path] = path
+			o.Path = path
+		}
+		flushOutputs = append(flushOutputs, o)
+	}
+	if len(flushOutputs) == 0 {
+		return nil
+	}
+
+	reportFlusher = flush.Start(interval, func(n int) {
+		flushPartial(c, n)
+	})
+	return nil
+}
+
+// flushPartial writes events so far to flush outputs, marked as partial
+// with progress of scan. Each output is replaced atomically
+func flushPartial(c *cobra.Command, flushes int) {
+	doc := runnerReporter.Snapshot()
+	failures := targetTally.Failures()
+	doc.Metadata.FailedTargets = failures
+	now := time.Now()
+	doc.Metadata.Progress = &reporter.Progress{
+		Partial: true,
+		Started: scanStart,
+		Flushed: now,
+		Elapsed: now.Sub(scanStart),
+		Scanned: int(atomic.LoadInt64(&scannedImages)),
+		Failed:  len(failures),
+		Flushes: flushes,
+	}
+	// Coverage of snapshot is shared with reporter which goes on
+	// recording it, it's copied before tenants are tagged
+	doc.Metadata.Coverage = append([]reporter.Coverage(nil), doc.Metadata.Coverage...)
+	tagTenants(&doc)
+
+	// Partial reports are never written unredacted
+	doc, err := redactOutputs(c, doc)
+	if err != nil {
+		log.Warnf("Flush partial report error: %s\n", err.Error())
+		return
+	}
+	for _, o := range flushOutputs {
+		if err := reporter.WriteFile(o.Path, o.Format, doc); err != nil {
+			log.Warnf("Flush partial report to output %s error: %s\n", o, err.Error())
+		}
+	}
+	log.Infof("Flushed partial report of %d event(s) to %d output(s)\n", len(doc.Events), len(flushOutputs))
+}
+
+// stopFlush stops flushing partial reports before the final report is
+// written
+func stopFlush() {
+	if flushes := reportFlusher.Stop(); flushes > 0 {
+		log.Infof("Flushed %d partial report(s), writing the final report\n", flushes)
+	}
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().Duration("flush-interval", 0, "interval of flushing partial reports with events so far to file outputs while scanning, 0 disables it")
+	}
+}
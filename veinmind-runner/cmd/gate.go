@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/libveinmind/go/plugin"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/gate"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/runner"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"sort"
+)
+
+var gateOptions gate.Options
+
+var gateCmd = &cobra.Command{
+	Use:   "gate <report.json>",
+	Short: "evaluate an existing report and exit with configured code",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := newGateOptions(cmd)
+		if err != nil {
+			return err
+		}
+
+		doc, err := reporter.Load(args[0])
+		if err != nil {
+			return err
+		}
+
+		decision := gate.Evaluate(doc.Events, opts)
+		printDecision(os.Stdout, decision)
+
+		if decision.Fail {
+			exitcode, _ := cmd.Flags().GetInt("exit-code")
+			if !cmd.Flags().Changed("exit-code") {
+				exitcode = 1
+			}
+			os.Exit(exitcode)
+		}
+
+		return nil
+	},
+}
+
+// newGateOptions loads severity threshold, policy, ignore file and
+// baseline from flags
+func newGateOptions(c *cobra.Command) (gate.Options, error) {
+	opts := gate.Options{}
+
+	threshold, _ := c.Flags().GetString("severity-threshold")
+	if threshold != "" {
+		l, err := reporter.ParseLevel(threshold)
+		if err != nil {
+			return opts, err
+		}
+		opts.Threshold = &l
+	}
+
+	policy, _ := c.Flags().GetString("policy")
+	if policy != "" {
+		p, err := gate.LoadPolicy(policy)
+		if err != nil {
+			return opts, err
+		}
+		opts.Policy = p
+	}
+
+	ignoreFile, _ := c.Flags().GetString("ignore-file")
+	if ignoreFile != "" {
+		rules, err := gate.LoadIgnoreRules(ignoreFile)
+		if err != nil {
+			return opts, err
+		}
+		opts.Ignore = rules
+	}
+
+	opts.IgnoreBase, _ = c.Flags().GetBool("ignore-base-findings")
+
+	baseline, _ := c.Flags().GetString("baseline")
+	if baseline != "" {
+		doc, err := reporter.Load(baseline)
+		if err != nil {
+			return opts, err
+		}
+		if doc.FingerprintVersion != report.FingerprintVersion {
+			log.Infof("Baseline %#v has fingerprints of version %d, findings are recomputed in it\n", baseline, doc.FingerprintVersion)
+		}
+		opts.Baseline = gate.NewBaseline(doc)
+	}
+
+	return opts, nil
+}
+
+// configureModes applies enforcement modes of plugins in policy,
+// disabled plugins aren't run and events of plugins in monitor mode
+// are reported as monitor-only
+func configureModes(r *runner.Runner, policy *gate.Policy) {
+	plugins := []*plugin.Plugin{}
+	for _, p := range r.Plugins {
+		switch policy.Mode(p.Name) {
+		case reporter.ModeDisabled:
+			log.Infof("Plugin %#v is disabled by policy\n", p.Name)
+			continue
+		case reporter.ModeMonitor:
+			log.Infof("Plugin %#v is in monitor mode, its events never fail the scan\n", p.Name)
+			if r.Monitor == nil {
+				r.Monitor = map[string]struct{}{}
+			}
+			r.Monitor[p.Name] = struct{}{}
+		}
+		plugins = append(plugins, p)
+	}
+	r.Plugins = plugins
+}
+
+func printDecision(w io.Writer, d gate.Decision) {
+	if d.Fail {
+		fmt.Fprintln(w, "Decision: FAIL")
+	} else {
+		fmt.Fprintln(w, "Decision: PASS")
+	}
+
+	if len(d.Reasons) > 0 {
+		fmt.Fprintln(w, "Reasons:")
+		for _, r := range d.Reasons {
+			fmt.Fprintf(w, "  - %s\n", r)
+		}
+	}
+
+	if len(d.Skipped) > 0 {
+		reasons := []string{}
+		for r := range d.Skipped {
+			reasons = append(reasons, r)
+		}
+		sort.Strings(reasons)
+
+		fmt.Fprintln(w, "Skipped:")
+		for _, r := range reasons {
+			fmt.Fprintf(w, "  - %d event(s) %s\n", d.Skipped[r], r)
+		}
+	}
+}
+
+func logDecision(d gate.Decision) {
+	for _, r := range d.Reasons {
+		log.Warnf("Gate failed: %s\n", r)
+	}
+	for r, n := range d.Skipped {
+		log.Infof("Gate skipped %d event(s) %s\n", n, r)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(gateCmd)
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd, gateCmd, compareCmd, collectorGateCmd} {
+		c.Flags().String("severity-threshold", "", "minimum level of events which fail the scan, low, medium, high or critical")
+		c.Flags().String("policy", "", "policy file of per alert type thresholds and enforcement modes of plugins")
+		c.Flags().String("ignore-file", "", "ignore file of accepted findings")
+		c.Flags().String("baseline", "", "previous report whose findings are accepted")
+		c.Flags().Bool("ignore-base-findings", false, "events in base image layers don't fail the scan")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/hash"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/hashcache"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"io"
+)
+
+var hashCache *hashcache.Cache
+
+// pluginHashService hashes files of the image scanned by a plugin execution
+type pluginHashService struct {
+	cache *hashcache.Cache
+	image api.Image
+}
+
+func (s *pluginHashService) Hash(req hash.Request) (hash.Digest, error) {
+	if req.ImageID != s.image.ID() {
+		return hash.Digest{}, errors.Errorf("hash: image %#v isn't being scanned", req.ImageID)
+	}
+
+	return s.cache.Get(req.ImageID, req.Path, func(path string) (io.ReadCloser, error) {
+		return s.image.Open(path)
+	})
+}
+
+func (s *pluginHashService) Add(registry *service.Registry) {
+	registry.Define(hash.Namespace, struct{}{})
+	registry.AddService(hash.Namespace, "hash", s.Hash)
+}
+
+// logHashCacheStats records hash cache statistics in summary of scan
+func logHashCacheStats() {
+	stats := hashCache.Stats()
+	if stats.Hits+stats.Misses == 0 {
+		return
+	}
+
+	log.Infof("Hash cache: %d hits, %d misses, %d evictions\n", stats.Hits, stats.Misses, stats.Evictions)
+	runnerReporter.SetHashCacheStats(stats)
+}
+
+func newHashCache(c *cobra.Command) *hashcache.Cache {
+	size, err := c.Flags().GetInt("hash-cache-size")
+	if err != nil {
+		size = 10000
+	}
+
+	return hashcache.New(size)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd, compareCmd} {
+		c.Flags().Int("hash-cache-size", 10000, "max number of file digests cached for plugins")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/hook"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// runPreHook runs --pre-hook before anything is scanned, its failure
+// aborts the scan
+func runPreHook(c *cobra.Command, args []string) error {
+	command, _ := c.Flags().GetString("pre-hook")
+	if command == "" {
+		return nil
+	}
+
+	log.Infof("Run pre hook: %#v\n", command)
+	err := hook.Run(c.Context(), command, hook.Context{
+		Hook:    hook.Pre,
+		Command: c.Name(),
+		Targets: args,
+	}, hookLog(hook.Pre))
+	return errors.Wrap(err, "abort scan")
+}
+
+// runPostHook runs --post-hook with result of the scan, its failure
+// is only returned with --post-hook-required
+func runPostHook(c *cobra.Command, args []string, exit int) error {
+	command, _ := c.Flags().GetString("post-hook")
+	if command == "" {
+		return nil
+	}
+
+	reports := []string{}
+	if outputs, err := reportOutputs(c); err == nil {
+		for _, o := range outputs {
+			if o.Path != reporter.Stdout {
+				reports = append(reports, o.Path)
+			}
+		}
+	}
+	s := collectSummary()
+	s.Exit = exit
+
+	log.Infof("Run post hook: %#v\n", command)
+	err := hook.Run(c.Context(), command, hook.Context{
+		Hook:    hook.Post,
+		Command: c.Name(),
+		Targets: args,
+		Reports: reports,
+		Summary: &s,
+	}, hookLog(hook.Post))
+	if err == nil {
+		return nil
+	}
+
+	if required, _ := c.Flags().GetBool("post-hook-required"); required {
+		return err
+	}
+	log.Warnf("Post hook failed: %s\n", err.Error())
+	return nil
+}
+
+// hookLog logs output of hook prefixed by the hook
+func hookLog(name string) func(line string) {
+	return func(line string) {
+		log.Infof("[%s-hook] %s\n", name, line)
+	}
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().String("pre-hook", "", "shell command run before scan, scan is aborted if it fails")
+		c.Flags().String("post-hook", "", "shell command run after scan with result passed through VEINMIND_* environment variables")
+		c.Flags().Bool("post-hook-required", false, "fail the scan if post hook fails")
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/imageid"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layer"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/runner"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+const openImageBackoff = time.Second
+
+// scanHost scans images of host matching args, or all images of host
+// if no image is specified, images of every detected runtime are
+// scanned. Only images of running pods are scanned with --kubelet,
+// images are picked from a checklist with --interactive, images are
+// ordered by --priority-file and --priority-by-usage. Images are
+// selected by labels with --label and --label-any
+func scanHost(c *cobra.Command, args []string) error {
+	interactive, err := checkInteractive(c)
+	if err != nil {
+		return err
+	}
+	workloads, useKubelet := kubeletWorkloads(c)
+	labelSelector, err = newLabelSelector(c)
+	if err != nil {
+		return err
+	}
+
+	found := map[string]bool{}
+	matched := map[int]bool{}
+	targets := []hostImages{}
+	filters := targetFilters(c, args, "kubelet")
+	targetFunnel.Record("listed", 0, filters...)
+	for _, name := range hostRuntimes {
+		veinmindRuntime, err := newRuntime(name)
+		if err != nil {
+			log.Errorf("Open runtime %s failed: %s\n", name, err.Error())
+			continue
+		}
+
+		var ids []string
+		if useKubelet {
+			ids, err = kubeletImageIDs(veinmindRuntime, args, workloads, found, matched)
+		} else {
+			ids, err = hostImageIDs(veinmindRuntime, args, found)
+		}
+		if err != nil {
+			log.Errorf("List images of runtime %s failed: %s\n", name, err.Error())
+			continue
+		}
+		targetFunnel.Record("listed", len(ids), filters...)
+		if labelSelector != nil {
+			ids = filterLabeled(veinmindRuntime, ids)
+			targetFunnel.Record("labeled", len(ids), targetFilters(c, nil, "label", "label-any")...)
+		}
+		targets = append(targets, hostImages{name: name, runtime: veinmindRuntime, ids: ids})
+	}
+
+	for _, arg := range args {
+		if !found[arg] {
+			log.Warnf("Image not found: %#v\n", arg)
+		}
+	}
+	for i, w := range workloads {
+		if !matched[i] {
+			log.Warnf("Image %#v of pod %s/%s not found on host\n", w.Image, w.Namespace, w.Pod)
+		}
+	}
+
+	if interactive {
+		targets, err = selectHostImages(targets)
+		if err != nil {
+			return err
+		}
+		selected := 0
+		for _, t := range targets {
+			selected += len(t.ids)
+		}
+		targetFunnel.Record("selected", selected, "--interactive")
+	}
+
+	ordered, err := orderHostTargets(c, targets)
+	if err != nil {
+		return err
+	}
+	if dryRun, _ := c.Flags().GetBool("dry-run"); dryRun {
+		printHostDryRun(ordered)
+		return nil
+	}
+
+	targetFunnel.Record("opened", 0)
+	for i, t := range ordered {
+		if scanTimedOut(c) {
+			log.Warnf("Scan timed out, %d image(s) not reached\n", len(ordered)-i)
+			for _, left := range ordered[i:] {
+				notReached(left.id, "")
+			}
+			break
+		}
+
+		runnerReporter.SetTarget(t.id, reporter.Target{Source: reporter.TargetHost, Runtime: t.name, Ref: t.id})
+		image, err := openImage(c, t.runtime, t.id)
+		if err != nil {
+			continue
+		}
+		targetFunnel.Record("opened", 1)
+
+		runnerReporter.SetRuntime(image.ID(), t.name)
+		if err := scan(c, image); err != nil {
+			log.Error(err)
+		}
+		if err := image.Close(); err != nil {
+			log.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// hostImageIDs returns ids of images of runtime matching args, or all
+// images if no arg is specified, args matched are marked in found.
+// Args are references or full or abbreviated image ids
+func hostImageIDs(veinmindRuntime api.Runtime, args []string, found map[string]bool) ([]string, error) {
+	if len(args) == 0 {
+		return veinmindRuntime.ListImageIDs()
+	}
+
+	ids := []string{}
+	seen := map[string]struct{}{}
+	for _, arg := range args {
+		matched, err := imageid.Find(veinmindRuntime, arg)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if len(matched) > 0 {
+			found[arg] = true
+		}
+		for _, id := range matched {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// openImage opens image with bounded retries, images which can't be
+// opened are recorded as failed in coverage
+func openImage(c *cobra.Command, veinmindRuntime api.Runtime, id string) (api.Image, error) {
+	retries, err := c.Flags().GetInt("open-retries")
+	if err != nil {
+		retries = 3
+	}
+
+	image, err := runner.OpenImage(veinmindRuntime, id, retries+1, openImageBackoff)
+	if err != nil {
+		log.Error(err)
+		failCoverage(id, err)
+		return nil, err
+	}
+	return image, nil
+}
+
+// verifyImageLayers checksums layers of image when --verify-layers is
+// specified, corrupted images are recorded as failed in coverage and
+// shouldn't be scanned
+func verifyImageLayers(c *cobra.Command, image api.Image) bool {
+	verify, _ := c.Flags().GetBool("verify-layers")
+	if !verify {
+		return true
+	}
+
+	dataRoot, _ := c.Flags().GetString("docker-data-root")
+	if err := layer.Verify(image, dataRoot); err != nil {
+		log.Errorf("Verify layers of image %#v failed: %s\n", image.ID(), err.Error())
+		failCoverage(image.ID(), err)
+		return false
+	}
+	return true
+}
+
+func failCoverage(id string, err error) {
+	reason := runner.ReasonTransient
+	var openErr *runner.OpenError
+	var corruptedErr *layer.CorruptedError
+	if errors.As(err, &openErr) {
+		reason = openErr.Reason
+	} else if errors.As(err, &corruptedErr) {
+		reason = runner.ReasonCorrupted
+	}
+
+	runnerReporter.AddCoverage(reporter.Coverage{
+		ImageID: id,
+		Scope:   reporter.ScopeFailed,
+		Reason:  reason,
+		Error:   err.Error(),
+		Code:    errcode.CodeOf(err),
+	})
+}
+
+func init() {
+	scanHostCmd.Flags().StringSliceP("runtime", "r", nil, "runtimes of images to scan, e.g. docker,containerd, all reachable runtimes by default")
+	scanHostCmd.Flags().Bool("containerd", false, "scan images of containerd instead of docker")
+	scanHostCmd.Flags().MarkDeprecated("containerd", "use --runtime containerd instead")
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().Int("open-retries", 3, "retries of opening image, images may be busy while runtime collects garbage")
+		c.Flags().Bool("verify-layers", false, "checksum layers against diff ids before scanning")
+		c.Flags().String("docker-data-root", "/var/lib/docker", "data root of docker where layer metadata is read")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/docker"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/spf13/cobra"
+)
+
+// imageBlock returns canonical block of image for events, size and
+// repo digests recorded by the daemon are only known for images of
+// docker
+func imageBlock(c *cobra.Command, image api.Image) reporter.Image {
+	refs, err := image.RepoRefs()
+	if err != nil {
+		refs = nil
+	}
+
+	var (
+		digests []string
+		size    int64
+	)
+	if _, ok := image.(*docker.Image); ok {
+		client, err := newDockerClient(dockerSocket(c))
+		if err == nil {
+			defer client.Close()
+			inspect, _, err := client.ImageInspectWithRaw(ctx, image.ID())
+			if err == nil {
+				digests = inspect.RepoDigests
+				size = inspect.Size
+			} else {
+				log.Warnf("Inspect image %#v error: %s\n", image.ID(), err.Error())
+			}
+		}
+	}
+
+	block := reporter.NewImage(image.ID(), refs, digests)
+	block.Size = size
+	block.Labels = matchedLabels(image.ID())
+	if oci, err := image.OCISpecV1(); err == nil && oci != nil {
+		if oci.Created != nil {
+			block.Created = oci.Created.UTC()
+		}
+		block.OS = oci.OS
+		block.Architecture = oci.Architecture
+	}
+	return block
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/interactive"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/listing"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/moby/term"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// ReasonNotSelected is reason of coverage of images left out of
+// interactive selection
+const ReasonNotSelected = "not selected interactively"
+
+// hostImages are images of a runtime to be scanned by scan-host
+type hostImages struct {
+	name    string
+	runtime api.Runtime
+	ids     []string
+}
+
+// checkInteractive fails --interactive unless stdin and stderr, where
+// checklist is shown, are terminals
+func checkInteractive(c *cobra.Command) (bool, error) {
+	enabled, _ := c.Flags().GetBool("interactive")
+	if !enabled {
+		return false, nil
+	}
+	if !term.IsTerminal(os.Stdin.Fd()) || !term.IsTerminal(os.Stderr.Fd()) {
+		return false, errors.New("--interactive requires stdin and stderr to be a terminal")
+	}
+	return true, nil
+}
+
+// selectHostImages shows images of runtimes as checklist and keeps ids
+// of images selected, images left out are recorded as skipped in
+// coverage and the equivalent command of selection is printed
+func selectHostImages(targets []hostImages) ([]hostImages, error) {
+	images := []listing.Image{}
+	for _, t := range targets {
+		for _, id := range t.ids {
+			item := listing.Image{Runtime: t.name, ID: id}
+			if image, err := t.runtime.OpenImageByID(id); err == nil {
+				item.Refs, _ = image.RepoRefs()
+				_ = image.Close()
+			}
+			images = append(images, item)
+		}
+	}
+	if len(images) == 0 {
+		return targets, nil
+	}
+
+	session := interactive.NewSession(listing.NewImages(images))
+	if err := session.Run(os.Stdin, os.Stderr); err != nil {
+		return nil, err
+	}
+
+	selected := map[string]map[string]struct{}{}
+	for _, image := range session.Selected() {
+		if selected[image.Runtime] == nil {
+			selected[image.Runtime] = map[string]struct{}{}
+		}
+		selected[image.Runtime][image.ID] = struct{}{}
+	}
+	for _, image := range session.Unselected() {
+		coverage := reporter.Coverage{
+			ImageID: image.ID,
+			Scope:   reporter.ScopeSkipped,
+			Reason:  ReasonNotSelected,
+		}
+		if len(image.Refs) > 0 {
+			coverage.Ref = image.Refs[0]
+		}
+		runnerReporter.AddCoverage(coverage)
+	}
+
+	result := []hostImages{}
+	for _, t := range targets {
+		ids := []string{}
+		for _, id := range t.ids {
+			if _, ok := selected[t.name][id]; ok {
+				ids = append(ids, id)
+			}
+		}
+		result = append(result, hostImages{name: t.name, runtime: t.runtime, ids: ids})
+	}
+
+	command := interactive.Command(session.Selected())
+	fmt.Fprintf(os.Stderr, "Equivalent command: %s\n", command)
+	log.Infof("Scan %d image(s) selected interactively, equivalent command: %s\n", len(session.Selected()), command)
+	return result, nil
+}
+
+func init() {
+	scanHostCmd.Flags().Bool("interactive", false, "select images to scan from a checklist on terminal")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/kubelet"
+	"github.com/spf13/cobra"
+)
+
+// kubeletWorkloads returns containers of pods running on node if
+// --kubelet is specified, host images are enumerated as usual with a
+// warning if kubelet can't be reached
+func kubeletWorkloads(c *cobra.Command) ([]kubelet.Workload, bool) {
+	if enabled, _ := c.Flags().GetBool("kubelet"); !enabled {
+		return nil, false
+	}
+
+	config := kubelet.Config{}
+	config.Address, _ = c.Flags().GetString("kubelet-address")
+	config.TokenFile, _ = c.Flags().GetString("kubelet-token-file")
+	config.CAFile, _ = c.Flags().GetString("kubelet-ca")
+	config.CertFile, _ = c.Flags().GetString("kubelet-cert")
+	config.KeyFile, _ = c.Flags().GetString("kubelet-key")
+	config.Insecure, _ = c.Flags().GetBool("kubelet-insecure")
+
+	client, err := kubelet.New(config)
+	if err != nil {
+		log.Warnf("Kubelet client error: %s, scan images of host instead\n", err.Error())
+		return nil, false
+	}
+	workloads, err := client.Workloads(c.Context())
+	if err != nil {
+		log.Warnf("Kubelet unreachable: %s, scan images of host instead\n", err.Error())
+		return nil, false
+	}
+	log.Infof("Kubelet reports %d container(s) of running pods\n", len(workloads))
+	return workloads, true
+}
+
+// kubeletImageIDs returns ids of images of runtime used by workloads,
+// or those matching args as well if any arg is specified. Workloads are
+// recorded for events of the images, and marked in matched if their
+// images are found
+func kubeletImageIDs(veinmindRuntime api.Runtime, args []string, workloads []kubelet.Workload,
+	found map[string]bool, matched map[int]bool) ([]string, error) {
+	var wanted map[string]struct{}
+	if len(args) > 0 {
+		ids, err := hostImageIDs(veinmindRuntime, args, found)
+		if err != nil {
+			return nil, err
+		}
+		wanted = map[string]struct{}{}
+		for _, id := range ids {
+			wanted[id] = struct{}{}
+		}
+	}
+
+	ids := []string{}
+	byID := map[string][]kubelet.Workload{}
+	for i, w := range workloads {
+		for _, ref := range w.Refs() {
+			refIDs, err := veinmindRuntime.FindImageIDs(ref)
+			if err != nil || len(refIDs) == 0 {
+				continue
+			}
+			matched[i] = true
+
+			id := refIDs[0]
+			if _, ok := wanted[id]; wanted != nil && !ok {
+				break
+			}
+			if _, ok := byID[id]; !ok {
+				ids = append(ids, id)
+			}
+			byID[id] = append(byID[id], w)
+			break
+		}
+	}
+
+	for id, ws := range byID {
+		runnerReporter.SetWorkloads(id, ws)
+	}
+	return ids, nil
+}
+
+func init() {
+	scanHostCmd.Flags().Bool("kubelet", false, "scan only images used by running pods of node, which are queried from kubelet")
+	scanHostCmd.Flags().String("kubelet-address", kubelet.DefaultAddress, "address of kubelet, e.g. http://127.0.0.1:10255 for read-only port")
+	scanHostCmd.Flags().String("kubelet-token-file", "", "bearer token file used to authenticate to kubelet")
+	scanHostCmd.Flags().String("kubelet-ca", "", "CA file verifying serving certificate of kubelet")
+	scanHostCmd.Flags().String("kubelet-cert", "", "client certificate file of kubelet")
+	scanHostCmd.Flags().String("kubelet-key", "", "client key file of kubelet")
+	scanHostCmd.Flags().Bool("kubelet-insecure", false, "skip verifying serving certificate of kubelet")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/label"
+	"github.com/spf13/cobra"
+	"strings"
+	"sync"
+)
+
+var (
+	// labelSelector selects images of scan-host by labels of their
+	// config, nil unless --label or --label-any is given
+	labelSelector *label.Selector
+	// imageLabels are labels of images matched by labelSelector, they
+	// are recorded in image blocks
+	imageLabels   = map[string]map[string]string{}
+	imageLabelsMu sync.Mutex
+)
+
+func newLabelSelector(c *cobra.Command) (*label.Selector, error) {
+	all, _ := c.Flags().GetStringArray("label")
+	anyOf, _ := c.Flags().GetStringArray("label-any")
+	return label.New(all, anyOf)
+}
+
+// filterLabeled keeps ids of images of runtime whose labels match
+// labelSelector, images which can't be opened don't match
+func filterLabeled(veinmindRuntime api.Runtime, ids []string) []string {
+	if labelSelector == nil {
+		return ids
+	}
+
+	kept := []string{}
+	for _, id := range ids {
+		image, err := veinmindRuntime.OpenImageByID(id)
+		if err != nil {
+			log.Warnf("Open image %#v to read labels error: %s\n", id, err.Error())
+			continue
+		}
+		var labels map[string]string
+		if oci, err := image.OCISpecV1(); err == nil && oci != nil {
+			labels = oci.Config.Labels
+		}
+		_ = image.Close()
+
+		matched, ok := labelSelector.Match(labels)
+		if !ok {
+			continue
+		}
+		imageLabelsMu.Lock()
+		imageLabels[id] = matched
+		imageLabelsMu.Unlock()
+		kept = append(kept, id)
+	}
+	return kept
+}
+
+// matchedLabels returns labels of image matched by labelSelector
+func matchedLabels(id string) map[string]string {
+	imageLabelsMu.Lock()
+	defer imageLabelsMu.Unlock()
+	return imageLabels[id]
+}
+
+// printHostDryRun prints images scan-host would scan with their
+// references and labels matched
+func printHostDryRun(targets []hostTarget) {
+	for _, t := range targets {
+		ref := ""
+		if image, err := t.runtime.OpenImageByID(t.id); err == nil {
+			if refs, err := image.RepoRefs(); err == nil && len(refs) > 0 {
+				ref = strings.Join(refs, ",")
+			}
+			_ = image.Close()
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", t.name, t.id, ref, label.String(matchedLabels(t.id)))
+	}
+}
+
+func init() {
+	scanHostCmd.Flags().StringArray("label", nil, "scan only images labeled key=value or key, repeatable and all of them must match")
+	scanHostCmd.Flags().StringArray("label-any", nil, "scan only images labeled with any of key=value or key, repeatable")
+	scanHostCmd.Flags().Bool("dry-run", false, "print images to scan without scanning")
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	layerservice "github.com/chaitin/veinmind-tools/veinmind-common/go/service/layer"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layer"
+	"github.com/pkg/errors"
+)
+
+// pluginLayerService locates files of the image scanned by a plugin
+// execution in its layers, the index is shared with the reporter
+type pluginLayerService struct {
+	imageID string
+	index   *layer.Index
+}
+
+func (s *pluginLayerService) Locate(req layerservice.Request) (layerservice.Provenance, error) {
+	if req.ImageID != s.imageID {
+		return layerservice.Provenance{}, errors.Errorf("layer: image %#v isn't being scanned", req.ImageID)
+	}
+	if s.index == nil {
+		return layerservice.Provenance{}, errors.Errorf("layer: layers of image %#v can't be opened", req.ImageID)
+	}
+
+	prov, ok := s.index.Lookup(req.Path)
+	if !ok {
+		return layerservice.Provenance{}, errors.Errorf("layer: %#v not found in layers of image", req.Path)
+	}
+	return layerservice.Provenance{
+		Path:      prov.Path,
+		Index:     prov.Index,
+		Digest:    prov.Digest,
+		CreatedBy: prov.CreatedBy,
+	}, nil
+}
+
+func (s *pluginLayerService) Add(registry *service.Registry) {
+	registry.Define(layerservice.Namespace, struct{}{})
+	registry.AddService(layerservice.Namespace, "locate", s.Locate)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layer"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layercache"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/runner"
+	"github.com/spf13/cobra"
+)
+
+// layerCache caches events of layer-local plugins per layer, nil if
+// --layer-cache is disabled
+var layerCache *layercache.Cache
+
+// configureLayerCache sets layer cache of runner, which is kept in
+// --layer-cache-dir across runs if it's set
+func configureLayerCache(c *cobra.Command, r *runner.Runner) error {
+	layerCache = nil
+	if enabled, _ := c.Flags().GetBool("layer-cache"); !enabled {
+		return nil
+	}
+
+	dir, _ := c.Flags().GetString("layer-cache-dir")
+	cache, err := layercache.Open(dir)
+	if err != nil {
+		return err
+	}
+	layerCache = cache
+	r.LayerCache = cache
+	return nil
+}
+
+// layerCacheOption scans layers of image in scope through layer cache,
+// events are located in layers by files of their details
+func layerCacheOption(image api.Image, index *layer.Index, scopedLayers []string) runner.ScanOption {
+	if layerCache == nil || index == nil {
+		return runner.WithLayers(nil, nil)
+	}
+
+	layers := scopedLayers
+	if layerScope == nil {
+		var err error
+		if layers, err = layer.DiffIDs(image); err != nil {
+			log.Error(err)
+			return runner.WithLayers(nil, nil)
+		}
+	}
+	return runner.WithLayers(layers, func(evt report.ReportEvent) []string {
+		located := []string{}
+		for _, p := range reporter.Paths(evt.AlertDetails) {
+			located = append(located, index.Layers(p)...)
+		}
+		return located
+	})
+}
+
+// logLayerCacheStats records layer cache statistics in report, layer
+// scans avoided are in summary line as well
+func logLayerCacheStats() {
+	if layerCache == nil {
+		return
+	}
+
+	stats := layerCache.Stats()
+	if stats.Hits+stats.Misses == 0 {
+		return
+	}
+	log.Infof("Layer cache: %d hits, %d misses, %d layer scans avoided, %d uncacheable plugin executions\n",
+		stats.Hits, stats.Misses, stats.Avoided, stats.Uncacheable)
+	runnerReporter.SetLayerCacheStats(stats)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().Bool("layer-cache", true, "assemble events of plugins tagged layer-local from layers scanned before, so that they only scan layers not cached")
+		c.Flags().String("layer-cache-dir", "", "directory where events of layer-local plugins are cached per layer across runs, they're cached in memory for the run if empty")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/spf13/cobra"
+)
+
+// ReasonContentMissing is reason of coverage of images pulled again
+// since their content disappeared during scan
+const ReasonContentMissing = "content garbage collected during scan"
+
+// scanImageID opens image of id and scans it
+func scanImageID(c *cobra.Command, veinmindRuntime api.Runtime, id string) error {
+	image, err := openImage(c, veinmindRuntime, id)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	return scan(c, image)
+}
+
+// repullScan pulls repo of image id once more and scans it, since its
+// content disappeared during scan despite lease of the pull. Incidents
+// are recorded in coverage
+func repullScan(c *cobra.Command, client registry.Client, veinmindRuntime api.Runtime, id string, repo string, cause error) error {
+	log.Warnf("Content of %#v disappeared during scan, pull it again: %s\n", repo, cause.Error())
+	runnerReporter.AddCoverage(reporter.Coverage{
+		ImageID: id,
+		Ref:     repo,
+		Scope:   reporter.ScopeRepulled,
+		Reason:  ReasonContentMissing,
+		Error:   cause.Error(),
+		Code:    errcode.CodeOf(cause),
+	})
+
+	r, err := client.Pull(ctx, repo)
+	if err != nil {
+		return err
+	}
+	err = scanImageID(c, veinmindRuntime, r)
+
+	// Image pulled again is removed by the id scanned before, lease of
+	// another id isn't released by removal
+	if cc, ok := client.(*registry.RegistryContainerdClient); ok && r != id {
+		if err := cc.Release(ctx, r); err != nil {
+			log.Warnf("Release lease of %#v error: %s\n", r, err.Error())
+		}
+	}
+	return err
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/listing"
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/namespaces"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"time"
+)
+
+// labels which name containers of containerd
+var containerdNameLabels = []string{"io.kubernetes.container.name", "nerdctl/name"}
+
+var listImageCmd = &cobra.Command{
+	Use:   "image",
+	Short: "list images visible to runtime",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		useContainerd, _ := cmd.Flags().GetBool("containerd")
+		namespace, _ := cmd.Flags().GetString("namespace")
+
+		var (
+			images []listing.Image
+			err    error
+		)
+		if useContainerd {
+			images, err = listContainerdImages(cmd.Context(), containerdAddress(cmd), namespace)
+		} else {
+			images, err = listDockerImages(cmd.Context(), dockerSocket(cmd))
+		}
+		if err != nil {
+			return err
+		}
+
+		return listing.Write(os.Stdout, format, listing.NewImages(images))
+	},
+}
+
+var listContainerCmd = &cobra.Command{
+	Use:   "container",
+	Short: "list containers visible to runtime",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		useContainerd, _ := cmd.Flags().GetBool("containerd")
+		namespace, _ := cmd.Flags().GetString("namespace")
+
+		var (
+			containers []listing.Container
+			err        error
+		)
+		if useContainerd {
+			containers, err = listContainerdContainers(cmd.Context(), containerdAddress(cmd), namespace)
+		} else {
+			containers, err = listDockerContainers(cmd.Context(), dockerSocket(cmd))
+		}
+		if err != nil {
+			return err
+		}
+
+		return listing.Write(os.Stdout, format, listing.NewContainers(containers))
+	},
+}
+
+func listDockerImages(ctx context.Context, sock string) ([]listing.Image, error) {
+	c, err := newDockerClient(sock)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	summaries, err := c.ImageList(ctx, dockertypes.ImageListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	images := []listing.Image{}
+	for _, s := range summaries {
+		refs := []string{}
+		for _, tag := range s.RepoTags {
+			if tag != "<none>:<none>" {
+				refs = append(refs, tag)
+			}
+		}
+		images = append(images, listing.Image{
+			Runtime: "docker",
+			ID:      s.ID,
+			Refs:    refs,
+			Size:    s.Size,
+			Created: time.Unix(s.Created, 0),
+		})
+	}
+	return images, nil
+}
+
+func listDockerContainers(ctx context.Context, sock string) ([]listing.Container, error) {
+	c, err := newDockerClient(sock)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	summaries, err := c.ContainerList(ctx, dockertypes.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+
+	containers := []listing.Container{}
+	for _, s := range summaries {
+		name := ""
+		if len(s.Names) > 0 {
+			name = strings.TrimPrefix(s.Names[0], "/")
+		}
+		containers = append(containers, listing.Container{
+			Runtime: "docker",
+			ID:      s.ID,
+			Name:    name,
+			Image:   s.Image,
+			State:   s.State,
+		})
+	}
+	return containers, nil
+}
+
+// containerdNamespaces returns namespace if it's specified, otherwise
+// all namespaces of containerd
+func containerdNamespaces(ctx context.Context, c *containerd.Client, namespace string) ([]string, error) {
+	if namespace != "" {
+		return []string{namespace}, nil
+	}
+	return c.NamespaceService().List(ctx)
+}
+
+func listContainerdImages(ctx context.Context, address string, namespace string) ([]listing.Image, error) {
+	c, err := containerd.New(address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "containerd address %s", address)
+	}
+	defer c.Close()
+
+	nss, err := containerdNamespaces(ctx, c, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	images := []listing.Image{}
+	for _, ns := range nss {
+		nsCtx := namespaces.WithNamespace(ctx, ns)
+		cis, err := c.ListImages(nsCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		// Images of the same digest are listed once with all names
+		byID := map[string]int{}
+		for _, ci := range cis {
+			id := ns + "/" + string(ci.Target().Digest)
+			if i, ok := byID[id]; ok {
+				images[i].Refs = append(images[i].Refs, ci.Name())
+				continue
+			}
+
+			size, err := ci.Size(nsCtx)
+			if err != nil && !errdefs.IsNotFound(err) {
+				return nil, err
+			}
+			byID[id] = len(images)
+			images = append(images, listing.Image{
+				Runtime:   "containerd",
+				Namespace: ns,
+				ID:        id,
+				Refs:      []string{ci.Name()},
+				Size:      size,
+				Created:   ci.Metadata().CreatedAt,
+			})
+		}
+	}
+	return images, nil
+}
+
+func listContainerdContainers(ctx context.Context, address string, namespace string) ([]listing.Container, error) {
+	c, err := containerd.New(address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "containerd address %s", address)
+	}
+	defer c.Close()
+
+	nss, err := containerdNamespaces(ctx, c, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	containers := []listing.Container{}
+	for _, ns := range nss {
+		nsCtx := namespaces.WithNamespace(ctx, ns)
+		ccs, err := c.Containers(nsCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cc := range ccs {
+			info, err := cc.Info(nsCtx)
+			if err != nil {
+				return nil, err
+			}
+
+			name := ""
+			for _, label := range containerdNameLabels {
+				if v, ok := info.Labels[label]; ok {
+					name = v
+					break
+				}
+			}
+
+			// Containers without task are created but never started
+			state := "created"
+			if task, err := cc.Task(nsCtx, nil); err == nil {
+				if status, err := task.Status(nsCtx); err == nil {
+					state = string(status.Status)
+				}
+			}
+
+			containers = append(containers, listing.Container{
+				Runtime:   "containerd",
+				Namespace: ns,
+				ID:        cc.ID(),
+				Name:      name,
+				Image:     info.Image,
+				State:     state,
+			})
+		}
+	}
+	return containers, nil
+}
+
+func init() {
+	listCmd.AddCommand(listImageCmd)
+	listCmd.AddCommand(listContainerCmd)
+	for _, c := range []*cobra.Command{listImageCmd, listContainerCmd} {
+		c.Flags().Bool("containerd", false, "list of containerd instead of docker")
+		c.Flags().String("namespace", "", "namespace of containerd, all namespaces by default")
+	}
+}
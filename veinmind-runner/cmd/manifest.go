@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/manifest"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/target"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+var scanManifestCmd = &cobra.Command{
+	Use:      "scan-manifest <file...>",
+	Short:    "scan images referenced in docker-compose files and kubernetes manifests",
+	Args:     cobra.MinimumNArgs(1),
+	PreRunE:  scanPreRunE,
+	RunE:     scanManifest,
+	PostRunE: scanPostRunE,
+}
+
+// scanManifest pulls and scans unique images referenced in manifests,
+// variables of compose files are resolved from environment
+func scanManifest(cmd *cobra.Command, args []string) error {
+	extractor := &manifest.Extractor{Lookup: os.LookupEnv}
+	for _, path := range args {
+		if err := extractor.ParseFile(path); err != nil {
+			return err
+		}
+	}
+	printSkippedImages(consoleWriter(cmd), extractor.Skipped())
+
+	images := extractor.Images()
+	targetFunnel.Record("referenced", len(images)+len(extractor.Skipped()), targetFilters(cmd, args)...)
+	targetFunnel.Record("scannable", len(images))
+	if len(images) == 0 {
+		log.Warn("No image found in manifests")
+		return nil
+	}
+
+	verifiers, err := newImageVerifiers(cmd)
+	if err != nil {
+		return err
+	}
+
+	c, veinmindRuntime, err := newScanRegistryClient(cmd, verifiers)
+	if err != nil {
+		return err
+	}
+
+	steps := registrySteps(cmd, c, veinmindRuntime, verifiers)
+	for _, image := range images {
+		log.Infof("Scan image %#v referenced by %#v\n", image.Ref, image.Sources)
+		if err := target.Run(image.Ref, steps, targetTally); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printSkippedImages prints table of images which can't be scanned
+func printSkippedImages(w io.Writer, skipped []manifest.Skipped) {
+	if len(skipped) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "SKIPPED IMAGE\tSOURCE\tREASON\n")
+	for _, s := range skipped {
+		ref := s.Ref
+		if ref == "" {
+			ref = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", ref, s.Source, s.Reason)
+	}
+	tw.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(scanManifestCmd)
+	scanManifestCmd.Flags().StringP("runtime", "r", "docker", "specifies the runtime of registry client to use")
+	scanManifestCmd.Flags().StringP("glob", "g", "", "specifies the pattern of plugin file to find")
+	scanManifestCmd.Flags().StringP("config", "c", "", "auth config path")
+	scanManifestCmd.Flags().VarP(newThreadsValue(defaultThreads), "threads", "t", "threads for scan action, adaptive picks them per image by its size")
+	scanManifestCmd.Flags().String("allowlist", "", "allowlist file of trusted images")
+	scanManifestCmd.Flags().Bool("fail-fast", false, "abort the scan on the first failed target")
+	scanManifestCmd.Flags().Bool("always-pull", false, "pull images even if their digest is present locally")
+	scanManifestCmd.Flags().Bool("verify-signature", false, "verify cosign signature of image before pulling")
+	scanManifestCmd.Flags().Bool("require-signature", false, "skip pulling image whose cosign signature can't be verified")
+	scanManifestCmd.Flags().String("cosign-key", "", "public key path or KMS reference (hashivault://, gcpkms://, k8s://) used to verify cosign signature")
+	scanManifestCmd.Flags().String("cosign-cert-chain", "", "root certificates used to verify keyless cosign signature")
+	scanManifestCmd.Flags().String("cosign-rekor-key", "", "rekor public key used to verify transparency log bundle of keyless cosign signature")
+	scanManifestCmd.Flags().String("cosign-identity", "", "expected signer identity of keyless cosign signature, required by keyless verification")
+	scanManifestCmd.Flags().String("cosign-oidc-issuer", "", "expected OIDC issuer of keyless cosign signature, required by keyless verification")
+}
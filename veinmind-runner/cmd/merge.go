@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/spf13/cobra"
+)
+
+var mergeReportsCmd = &cobra.Command{
+	Use:   "merge-reports <out> <in...>",
+	Short: "merge reports of parallel scans into one, out is written in form of format=path",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := reporter.ParseOutput(args[0])
+		if err != nil {
+			return err
+		}
+
+		docs := []*reporter.Report{}
+		for _, path := range args[1:] {
+			doc, err := reporter.Load(path)
+			if err != nil {
+				return err
+			}
+			docs = append(docs, doc)
+		}
+
+		merged, err := reporter.Merge(args[1:], docs)
+		if err != nil {
+			return err
+		}
+		duplicates := -len(merged.Events)
+		for _, doc := range docs {
+			duplicates += len(doc.Events)
+		}
+		log.Infof("Merged %d reports into %d events, %d duplicate events dropped\n",
+			len(docs), len(merged.Events), duplicates)
+
+		return writeOutput(out, merged)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mergeReportsCmd)
+}
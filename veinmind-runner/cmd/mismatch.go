@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/target"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+// checkServerMismatch checks registries of references against --server
+// by --server-mismatch policy, returns references to scan with the
+// decisions of mismatched ones, which are recorded in coverage.
+// Rejected references fail alone
+func checkServerMismatch(c *cobra.Command, server string, refs []string) ([]string, []registry.ServerCheck, error) {
+	policy, _ := c.Flags().GetString("server-mismatch")
+	if err := registry.CheckPolicy(policy); err != nil {
+		return nil, nil, err
+	}
+
+	targets := []string{}
+	checks := []registry.ServerCheck{}
+	for _, ref := range refs {
+		check, err := registry.CheckServer(server, ref, policy)
+		if check.Mismatched() {
+			checks = append(checks, check)
+			runnerReporter.AddCoverage(reporter.Coverage{
+				Ref:    ref,
+				Scope:  reporter.ScopeServerMismatch,
+				Reason: check.Action + ": " + check.Reason,
+			})
+		}
+		if err != nil {
+			if err := targetTally.Fail(ref, target.StageResolve, err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		switch check.Action {
+		case registry.ActionWarned:
+			log.Warnf("Scan %#v with credentials of server %#v: %s\n", ref, server, check.Reason)
+		case registry.ActionRewritten:
+			log.Infof("Rewrite %#v to %#v\n", ref, check.Target)
+		}
+		targets = append(targets, check.Target)
+	}
+	return targets, checks, nil
+}
+
+// printDryRun prints targets to scan with server mismatch decisions
+func printDryRun(repos []string, checks []registry.ServerCheck) {
+	decisions := map[string]registry.ServerCheck{}
+	for _, check := range checks {
+		decisions[check.Target] = check
+	}
+
+	for _, repo := range repos {
+		check, ok := decisions[repo]
+		if !ok {
+			fmt.Println(repo)
+			continue
+		}
+		fmt.Printf("%s\t%s %s: %s\n", repo, check.Action, check.Ref, check.Reason)
+	}
+	for _, check := range checks {
+		if check.Action == registry.ActionRejected {
+			fmt.Printf("%s\t%s: %s\n", check.Ref, check.Action, check.Reason)
+		}
+	}
+}
+
+func init() {
+	scanRegistryCmd.Flags().String("server-mismatch", registry.MismatchWarn,
+		"policy of references whose registry differs from --server, one of "+strings.Join(registry.MismatchPolicies, ","))
+	scanRegistryCmd.Flags().Bool("dry-run", false, "print targets to scan without pulling or scanning")
+}
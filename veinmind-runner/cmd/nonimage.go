@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// ReasonNonImageArtifact is reason of coverage of non-image artifacts
+// skipped by registry scans
+const ReasonNonImageArtifact = "non-image artifact"
+
+// skipArtifact reports whether repo is a non-image artifact, which is
+// skipped and recorded in coverage. Tags of artifacts are recognized
+// without fetching, manifests are inspected by clients which access
+// registry directly. Repos failing inspection are pulled as usual
+func skipArtifact(client registry.Client, repo string) bool {
+	var err error
+	if p, ok := registry.ArtifactTag(repo); ok {
+		err = &registry.ArtifactError{Ref: repo, Reason: "tag matches " + p}
+	} else if checker, ok := client.(registry.ArtifactChecker); ok {
+		err = checker.CheckArtifact(repo)
+	}
+
+	var artifactErr *registry.ArtifactError
+	if !errors.As(err, &artifactErr) {
+		if err != nil {
+			log.Warnf("Inspect manifest of %#v error, pull it: %s\n", repo, err.Error())
+		}
+		return false
+	}
+
+	log.Infof("Skip %s\n", artifactErr.Error())
+	runnerReporter.AddCoverage(reporter.Coverage{
+		Ref:    repo,
+		Scope:  reporter.ScopeSkipped,
+		Reason: ReasonNonImageArtifact + ", " + artifactErr.Reason,
+	})
+	return true
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().Bool("include-artifacts", false, "pull signatures, attestations and other non-image artifacts instead of skipping them")
+	}
+}
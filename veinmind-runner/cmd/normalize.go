@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/normalize"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/spf13/cobra"
+)
+
+// newNormalizer returns normalizer of levels reported by plugins, the
+// default rules are used without --normalize-rules. Severities of rules
+// are set as presentation of levels in reports
+func newNormalizer(c *cobra.Command) (*normalize.Normalizer, error) {
+	rules := normalize.Default
+	if path, _ := c.Flags().GetString("normalize-rules"); path != "" {
+		r, err := normalize.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		rules = r
+	}
+
+	n, err := normalize.New(rules)
+	if err != nil {
+		return nil, err
+	}
+	n.Unmapped = func(plugin string, value string, level report.Level) {
+		log.Warnf("Level %#v of plugin %#v has no normalize rule, keep it as %s\n",
+			value, plugin, reporter.LevelString(level))
+	}
+	reporter.SetSeverities(n.Severities())
+	return n, nil
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd, compareCmd, agentCmd} {
+		c.Flags().String("normalize-rules", "", "yaml file of rules mapping levels reported by plugins to canonical levels")
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// networkFlags are flags of features which need network access, they
+// can't be used with --offline
+var networkFlags = []string{
+	"otel-endpoint",
+	"ti-api",
+	"ci-comment",
+	"verify-signature",
+	"require-signature",
+	"verify-content-trust",
+	"require-content-trust",
+}
+
+// checkOffline fails when a feature needing network access is enabled
+// in offline mode
+func checkOffline(c *cobra.Command) error {
+	offline, _ := c.Flags().GetBool("offline")
+	if !offline {
+		return nil
+	}
+
+	if c == scanRegistryCmd || c == scanManifestCmd {
+		return errors.Errorf("offline: %s needs network access to pull images", c.Name())
+	}
+
+	for _, name := range networkFlags {
+		if f := c.Flags().Lookup(name); f != nil && f.Changed {
+			return errors.Errorf("offline: --%s needs network access", name)
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd, compareCmd} {
+		c.Flags().Bool("offline", false, "disable all network access, features needing it fail")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/moby/term"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strings"
+)
+
+// defaultOutputs keeps the report written to stdout and report.json
+// as runner did before outputs were selectable
+var defaultOutputs = []string{"json=report.json", "json=" + reporter.Stdout}
+
+// reportOutputs returns outputs of command, bare paths are deprecated
+func reportOutputs(c *cobra.Command) ([]reporter.Output, error) {
+	values, _ := c.Flags().GetStringArray("output")
+	outputs, err := reporter.ParseOutputs(values)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range outputs {
+		if o.Legacy && o.Path != reporter.Stdout {
+			log.Warnf("--output %s is deprecated and writes json to both stdout and the file, use --output %s\n", o.Path, o)
+		}
+	}
+	return outputs, nil
+}
+
+// writeOutputs renders the same report document to every output, an
+// output failing to be written doesn't prevent the others
+func writeOutputs(c *cobra.Command, doc reporter.Report) error {
+	outputs, err := reportOutputs(c)
+	if err != nil {
+		return err
+	}
+
+	policy, _ := c.Flags().GetString("if-output-exists")
+	failed := 0
+	for _, o := range outputs {
+		if err := writeOutputPolicy(o, doc, policy); err != nil {
+			log.Errorf("Write output %s error: %s\n", o, err.Error())
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errcode.Wrap(errors.Errorf("%d of %d output(s) failed to be written", failed, len(outputs)), errcode.ReportWrite, "")
+	}
+	return nil
+}
+
+func writeOutput(o reporter.Output, doc reporter.Report) error {
+	return writeOutputPolicy(o, doc, reporter.ExistsOverwrite)
+}
+
+// writeOutputPolicy writes output whose file may exist by policy, files
+// are checked by checkOutputsExist before scan for ExistsFail
+func writeOutputPolicy(o reporter.Output, doc reporter.Report, policy string) error {
+	if o.Path == reporter.Stdout {
+		if o.Format == reporter.FormatTable && colorStdout() {
+			buf := &bytes.Buffer{}
+			if err := reporter.WriteColorTable(buf, doc); err != nil {
+				return err
+			}
+			_, err := os.Stdout.Write(buf.Bytes())
+			return err
+		}
+		return reporter.RenderWhole(os.Stdout, o.Format, doc)
+	}
+
+	switch policy {
+	case reporter.ExistsAppend:
+		return reporter.AppendFile(o.Path, o.Format, doc)
+	case reporter.ExistsTimestamp:
+		if path, ok := flushedPaths[o.Path]; ok {
+			// Partial reports flushed are replaced by the final one
+			o.Path = path
+		} else if _, err := os.Stat(o.Path); err == nil {
+			path := reporter.TimestampPath(o.Path, scanStart)
+			log.Infof("Output %s exists, write report to %s\n", o.Path, path)
+			o.Path = path
+		}
+	}
+	return reporter.WriteFile(o.Path, o.Format, doc)
+}
+
+// colorStdout tells if tables written to stdout are colored, which
+// is the case for terminals unless NO_COLOR is set
+func colorStdout() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return term.IsTerminal(os.Stdout.Fd())
+}
+
+// checkOutputsExist checks policy of --if-output-exists, with
+// ExistsFail the scan is refused if any output file exists
+func checkOutputsExist(c *cobra.Command) error {
+	policy, _ := c.Flags().GetString("if-output-exists")
+	if err := reporter.CheckExistsPolicy(policy); err != nil {
+		return err
+	}
+	if policy != reporter.ExistsFail {
+		return nil
+	}
+
+	outputs, err := reportOutputs(c)
+	if err != nil {
+		return err
+	}
+	for _, o := range outputs {
+		if o.Path == reporter.Stdout {
+			continue
+		}
+		if _, err := os.Stat(o.Path); err == nil {
+			return errors.Errorf("output %s exists, remove it or choose another --if-output-exists policy", o.Path)
+		}
+	}
+	return nil
+}
+
+// consoleWriter returns where tables printed along with the report go,
+// which is stderr if the report is rendered to stdout so that stdout
+// holds nothing but the report
+func consoleWriter(c *cobra.Command) io.Writer {
+	values, _ := c.Flags().GetStringArray("output")
+	outputs, err := reporter.ParseOutputs(values)
+	if err == nil && reporter.HasStdout(outputs) {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().StringArrayP("output", "o", defaultOutputs,
+			"outputs of report in form of format=path, format is json, markdown, table or sarif and - is stdout")
+		c.Flags().String("if-output-exists", reporter.ExistsOverwrite,
+			"policy of output files which exist, one of "+strings.Join(reporter.ExistsPolicies, ",")+
+				": append merges events into json reports and timestamp writes beside them")
+	}
+}
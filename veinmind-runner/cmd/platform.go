@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/compat"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/spf13/cobra"
+)
+
+// unsupportedOSPlugins returns plugins which don't support OS of image,
+// skips are recorded in coverage. Plugins declaring the OS in their
+// manifest are the only ones run for images of other OSes than linux
+func unsupportedOSPlugins(image reporter.Image) []string {
+	if image.OS == "" || image.OS == compat.DefaultOS {
+		return nil
+	}
+
+	skipped := []string{}
+	for _, p := range scanRunner.Plugins {
+		if compat.SupportsOS(p.Tags, image.OS) {
+			continue
+		}
+		skipped = append(skipped, p.Name)
+		runnerReporter.AddCoverage(reporter.Coverage{
+			ImageID: image.ID,
+			Plugin:  p.Name,
+			Scope:   reporter.ScopeSkipped,
+			Reason:  image.OS + " images unsupported",
+		})
+	}
+	if len(skipped) > 0 {
+		log.Warnf("Image %#v is a %s image, skip %d plugin(s) not declaring %s%s\n",
+			image.Name(), image.OS, len(skipped), compat.OSTagPrefix, image.OS)
+	}
+	return skipped
+}
+
+// withPlatform sets --platform of images pulled by client
+func withPlatform(c *cobra.Command, client registry.Client) (registry.Client, error) {
+	platform, _ := c.Flags().GetString("platform")
+	if platform == "" {
+		return client, nil
+	}
+	return registry.WithPlatform(platform)(client)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().String("platform", "", "platform pulled of multi-platform images, e.g. linux/arm64, default platform of runtime by default")
+	}
+}
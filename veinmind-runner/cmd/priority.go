@@ -0,0 +1,172 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/listing"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/priority"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/distribution/distribution/reference"
+	"github.com/spf13/cobra"
+	"strings"
+	"time"
+)
+
+// hostTarget is an image of a runtime to be scanned by scan-host
+type hostTarget struct {
+	name    string
+	runtime api.Runtime
+	id      string
+}
+
+// prioritySignals returns signals of --priority-file and, for host
+// scans, --priority-by-usage
+func prioritySignals(c *cobra.Command) ([]priority.Signal, error) {
+	signals := []priority.Signal{}
+	if name, _ := c.Flags().GetString("priority-file"); name != "" {
+		rules, err := priority.LoadRules(name)
+		if err != nil {
+			return nil, err
+		}
+		signals = append(signals, rules.Weight)
+	}
+	if usage, _ := c.Flags().GetBool("priority-by-usage"); usage {
+		signals = append(signals, priority.Usage)
+	}
+	return signals, nil
+}
+
+// orderHostTargets flattens images of runtimes in the order they're
+// scanned, images are ordered by priority signals if any
+func orderHostTargets(c *cobra.Command, targets []hostImages) ([]hostTarget, error) {
+	ordered := []hostTarget{}
+	for _, t := range targets {
+		for _, id := range t.ids {
+			ordered = append(ordered, hostTarget{name: t.name, runtime: t.runtime, id: id})
+		}
+	}
+
+	signals, err := prioritySignals(c)
+	if err != nil || len(signals) == 0 {
+		return ordered, err
+	}
+
+	usage, _ := c.Flags().GetBool("priority-by-usage")
+	running := map[string]map[string]int{}
+	if usage {
+		for _, t := range targets {
+			running[t.name] = runningContainers(c, t.name)
+		}
+	}
+
+	byKey := map[string]hostTarget{}
+	candidates := []priority.Target{}
+	for _, t := range ordered {
+		key := t.name + "/" + t.id
+		byKey[key] = t
+		p := priority.Target{Key: key}
+		if image, err := t.runtime.OpenImageByID(t.id); err == nil {
+			p.Refs, _ = image.RepoRefs()
+			_ = image.Close()
+		}
+		p.Containers = imageContainers(running[t.name], t.id, p.Refs)
+		candidates = append(candidates, p)
+	}
+
+	result := []hostTarget{}
+	for _, p := range priority.Order(candidates, signals...) {
+		result = append(result, byKey[p.Key])
+	}
+	return result, nil
+}
+
+// orderRepos orders repos of registry scans by --priority-file
+func orderRepos(c *cobra.Command, repos []string) ([]string, error) {
+	signals, err := prioritySignals(c)
+	if err != nil || len(signals) == 0 {
+		return repos, err
+	}
+
+	candidates := []priority.Target{}
+	for _, repo := range repos {
+		candidates = append(candidates, priority.Target{Key: repo})
+	}
+
+	result := []string{}
+	for _, p := range priority.Order(candidates, signals...) {
+		result = append(result, p.Key)
+	}
+	return result, nil
+}
+
+// runningContainers counts running containers of runtime by normalized
+// reference or id of their images
+func runningContainers(c *cobra.Command, runtime string) map[string]int {
+	var (
+		containers []listing.Container
+		err        error
+	)
+	switch runtime {
+	case "docker":
+		containers, err = listDockerContainers(c.Context(), dockerSocket(c))
+	case "containerd":
+		containers, err = listContainerdContainers(c.Context(), containerdAddress(c), "")
+	default:
+		return nil
+	}
+	if err != nil {
+		log.Warnf("List containers of runtime %s failed, usage isn't counted: %s\n", runtime, err.Error())
+		return nil
+	}
+
+	counts := map[string]int{}
+	for _, container := range containers {
+		if container.State != "running" {
+			continue
+		}
+		counts[containerImageKey(container.Image)]++
+	}
+	return counts
+}
+
+func containerImageKey(image string) string {
+	if named, err := reference.ParseDockerRef(image); err == nil {
+		return named.String()
+	}
+	return strings.TrimPrefix(image, "sha256:")
+}
+
+// imageContainers returns number of running containers of image of id
+// and refs
+func imageContainers(counts map[string]int, id string, refs []string) int {
+	n := counts[strings.TrimPrefix(id, "sha256:")]
+	for _, ref := range refs {
+		n += counts[containerImageKey(ref)]
+	}
+	return n
+}
+
+// scanTimedOut reports whether --timeout of the scan has passed, the
+// image being scanned is finished while targets left are not reached
+func scanTimedOut(c *cobra.Command) bool {
+	timeout, _ := c.Flags().GetDuration("timeout")
+	return timeout > 0 && time.Since(scanStart) >= timeout
+}
+
+// notReached records targets left when the scan timed out in coverage
+func notReached(imageID string, ref string) {
+	runnerReporter.AddCoverage(reporter.Coverage{
+		ImageID: imageID,
+		Ref:     ref,
+		Scope:   reporter.ScopeNotReached,
+		Reason:  "scan timed out",
+	})
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd} {
+		c.Flags().String("priority-file", "", "file of \"pattern weight\" lines, images of higher weight are scanned first")
+		c.Flags().Duration("timeout", 0, "time limit of the scan, targets not started in time are marked as not reached, 0 means unlimited")
+	}
+	scanHostCmd.Flags().Bool("priority-by-usage", false, "scan images with more running containers first")
+}
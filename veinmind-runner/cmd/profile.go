@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/profile"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/scanconfig"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// profileResolution is resolution of --profile of the scan, nil if no
+// profile is selected
+var profileResolution *scanconfig.Profile
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "presets of scan flags for common scenarios",
+}
+
+var profileShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "print flags preset by profile, flags given on command line override them",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profiles, err := loadProfiles(cmd)
+		if err != nil {
+			return err
+		}
+		p, err := profiles.Get(args[0])
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "Profile:\t%s\n", args[0])
+		fmt.Fprintf(tw, "Description:\t%s\n", p.Description)
+		fmt.Fprintf(tw, "Source:\t%s\n", p.Source)
+		fmt.Fprintln(tw, "\nFlags:")
+		for _, name := range p.FlagNames() {
+			fmt.Fprintf(tw, "  --%s\t%s\n", name, strings.Join(p.Flags[name], ", "))
+		}
+		return tw.Flush()
+	},
+}
+
+// loadProfiles returns builtin profiles overridden by --profiles-file
+func loadProfiles(c *cobra.Command) (profile.Profiles, error) {
+	path, _ := c.Flags().GetString("profiles-file")
+	return profile.Load(path)
+}
+
+// applyProfile sets flags of --profile which aren't given on command
+// line, it must precede reading any flag of the scan
+func applyProfile(c *cobra.Command) error {
+	profileResolution = nil
+	name, _ := c.Flags().GetString("profile")
+	if name == "" {
+		return nil
+	}
+
+	profiles, err := loadProfiles(c)
+	if err != nil {
+		return err
+	}
+	p, err := profiles.Get(name)
+	if err != nil {
+		return err
+	}
+	r, err := p.Apply(name, c.Flags())
+	if err != nil {
+		return err
+	}
+	log.Infof("Profile %#v (%s) applied: %s\n", name, r.Source, strings.Join(r.Applied, ","))
+	if len(r.Overridden) > 0 {
+		log.Infof("Flags given override profile %#v: %s\n", name, strings.Join(r.Overridden, ","))
+	}
+	if len(r.Unsupported) > 0 {
+		log.Debugf("Flags of profile %#v which %s doesn't have: %s\n", name, c.Name(), strings.Join(r.Unsupported, ","))
+	}
+	profileResolution = &r
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileShowCmd)
+	profileShowCmd.Flags().String("profiles-file", "", "yaml file of profiles overriding builtin profiles of the same name flag by flag")
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().String("profile", "", "preset of flags, ci, audit, ir or one of --profiles-file, flags given override it")
+		c.Flags().String("profiles-file", "", "yaml file of profiles overriding builtin profiles of the same name flag by flag")
+	}
+}
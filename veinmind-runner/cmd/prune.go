@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/blobcache"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/detect"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/diagnostics"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/history"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layercache"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/ledger"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/prune"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/quarantine"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/rootfs"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/runner"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// pullLedger returns ledger where images pulled by command are recorded,
+// nil if --pull-ledger is empty
+func pullLedger(c *cobra.Command) *ledger.Ledger {
+	path, _ := c.Flags().GetString("pull-ledger")
+	if path == "" {
+		return nil
+	}
+	return ledger.Open(path)
+}
+
+// recordPulled records image pulled into runtime in ledger, so that it
+// can be pruned if it's kept
+func recordPulled(l *ledger.Ledger, runtime string, id string, ref string) {
+	if l == nil {
+		return
+	}
+	if err := l.Pulled(ledger.Image{Runtime: runtime, ID: id, Ref: ref, Time: time.Now()}); err != nil {
+		log.Warnf("Record pulled image %#v error: %s\n", ref, err.Error())
+	}
+}
+
+// recordRemoved records image removed from runtime in ledger
+func recordRemoved(l *ledger.Ledger, runtime string, id string) {
+	if l == nil {
+		return
+	}
+	if err := l.Removed(runtime, id); err != nil {
+		log.Warnf("Record removed image %#v error: %s\n", id, err.Error())
+	}
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "remove local state left by runs, e.g. cached blobs, kept images and work dirs",
+	Long: `remove local state left by runs, each kind is pruned only if it's selected
+by its flag. Only images recorded in pull ledger are removed, images the
+runner didn't pull are never touched`,
+	Args: cobra.NoArgs,
+	RunE: func(c *cobra.Command, args []string) error {
+		dryRun, _ := c.Flags().GetBool("dry-run")
+		days, _ := c.Flags().GetInt("older-than")
+		if days < 0 {
+			return errors.New("--older-than must not be negative")
+		}
+		before := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+
+		items, selected, err := pruneItems(c, before)
+		if err != nil {
+			return err
+		}
+		images, err := pruneImages(c, before)
+		if err != nil {
+			return err
+		}
+		historyDB, _ := c.Flags().GetString("history-db")
+		if !selected && images == nil && historyDB == "" {
+			return errors.New("nothing to prune, select state by --blob-cache-dir, --layer-cache-dir, --quarantine-dir, --work-dirs, --images or --history-db")
+		}
+
+		prune.Sort(items)
+		printPruneItems(c.OutOrStdout(), items, images, time.Now())
+		if dryRun {
+			if historyDB != "" {
+				n, err := history.Trim(historyDB, before, true)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(c.OutOrStdout(), "Would trim %d run(s) of history %s\n", n, historyDB)
+			}
+			fmt.Fprintf(c.OutOrStdout(), "Would remove %d item(s), %d bytes, and %d image(s)\n", len(items), prune.Total(items), len(images))
+			return nil
+		}
+
+		freed, err := prune.Remove(items)
+		if err != nil {
+			return err
+		}
+		removed := removePrunedImages(c, images)
+		if historyDB != "" {
+			n, err := history.Trim(historyDB, before, false)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(c.OutOrStdout(), "Trimmed %d run(s) of history %s\n", n, historyDB)
+		}
+		fmt.Fprintf(c.OutOrStdout(), "Removed %d item(s), %d bytes, and %d image(s)\n", len(items), freed, removed)
+		if removed < len(images) {
+			return errors.Errorf("%d image(s) can't be removed", len(images)-removed)
+		}
+		return nil
+	},
+}
+
+// pruneItems lists files and directories of kinds selected by flags
+// last used before, false is returned if no kind is selected
+func pruneItems(c *cobra.Command, before time.Time) ([]prune.Item, bool, error) {
+	// kind is state in dir listed by expired
+	type kind struct {
+		dir     string
+		expired func(dir string, before time.Time) ([]prune.Item, error)
+	}
+	kinds := []kind{}
+	for _, k := range []struct {
+		flag    string
+		expired func(dir string, before time.Time) ([]prune.Item, error)
+	}{
+		{"blob-cache-dir", blobcache.Expired},
+		{"layer-cache-dir", layercache.Expired},
+		{"quarantine-dir", quarantine.Expired},
+	} {
+		if dir, _ := c.Flags().GetString(k.flag); dir != "" {
+			kinds = append(kinds, kind{dir, k.expired})
+		}
+	}
+	if workDirs, _ := c.Flags().GetBool("work-dirs"); workDirs {
+		workDir, _ := c.Flags().GetString("work-dir")
+		diagnosticsDir, _ := c.Flags().GetString("diagnostics-dir")
+		if diagnosticsDir == "" {
+			diagnosticsDir = runner.DefaultDiagnosticsDir(workDir)
+		}
+		rootfsDir, _ := c.Flags().GetString("rootfs-dir")
+		kinds = append(kinds, kind{workDir, runner.ExpiredWorkDirs}, kind{diagnosticsDir, diagnostics.Expired}, kind{rootfsDir, rootfs.Expired})
+	}
+
+	items := []prune.Item{}
+	for _, k := range kinds {
+		found, err := k.expired(k.dir, before)
+		if err != nil {
+			return nil, false, err
+		}
+		items = append(items, found...)
+	}
+	return items, len(kinds) > 0, nil
+}
+
+// pruneImages lists images of pull ledger pulled before, nil is
+// returned unless --images is set
+func pruneImages(c *cobra.Command, before time.Time) ([]ledger.Image, error) {
+	if images, _ := c.Flags().GetBool("images"); !images {
+		return nil, nil
+	}
+	l := pullLedger(c)
+	if l == nil {
+		return nil, errors.New("--images requires --pull-ledger")
+	}
+
+	pulled, err := l.Images()
+	if err != nil {
+		return nil, err
+	}
+	images := []ledger.Image{}
+	for _, img := range pulled {
+		if img.Time.Before(before) {
+			images = append(images, img)
+		}
+	}
+	return images, nil
+}
+
+// removePrunedImages removes images by clients of their runtimes and
+// returns how many are removed. Images already gone are removed from
+// ledger as well
+func removePrunedImages(c *cobra.Command, images []ledger.Image) int {
+	if len(images) == 0 {
+		return 0
+	}
+
+	l := pullLedger(c)
+	clients := map[string]registry.Client{}
+	removed := 0
+	for _, img := range images {
+		client, ok := clients[img.Runtime]
+		if !ok {
+			var err error
+			switch img.Runtime {
+			case detect.Containerd:
+				client, err = registry.NewRegistryContainerdClient(containerdAddress(c), registryOptions(c, "")...)
+			default:
+				client, err = registry.NewRegistryDockerClient(registryOptions(c, "")...)
+			}
+			if err != nil {
+				log.Warnf("Connect %s error, its images are kept: %s\n", img.Runtime, err.Error())
+			}
+			clients[img.Runtime] = client
+		}
+		if client == nil {
+			continue
+		}
+
+		// Containerd removes images by name
+		id := img.ID
+		if img.Runtime == detect.Containerd {
+			id = img.Ref
+		}
+		if err := client.Remove(c.Context(), id); err != nil && !registry.IsImageNotFound(err) {
+			log.Warnf("Remove image %#v error: %s\n", img.Ref, err.Error())
+			continue
+		}
+		log.Infof("Remove image success: %#v\n", img.Ref)
+		recordRemoved(l, img.Runtime, img.ID)
+		removed++
+	}
+	if err := l.Compact(); err != nil {
+		log.Warnf("Compact pull ledger error: %s\n", err.Error())
+	}
+	return removed
+}
+
+// printPruneItems prints table of items and images to prune
+func printPruneItems(w io.Writer, items []prune.Item, images []ledger.Image, now time.Time) {
+	if len(items) == 0 && len(images) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "KIND\tPATH\tSIZE\tAGE\n")
+	for _, item := range items {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", item.Kind, item.Path, item.Size, now.Sub(item.Time).Truncate(time.Minute))
+	}
+	for _, img := range images {
+		fmt.Fprintf(tw, "%s\t%s (%s %s)\t-\t%s\n", prune.KindImage, img.Ref, img.Runtime, img.ID, now.Sub(img.Time).Truncate(time.Minute))
+	}
+	tw.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+	pruneCmd.Flags().Bool("dry-run", false, "print what would be removed without removing anything")
+	pruneCmd.Flags().Int("older-than", 7, "days since state is last used before it's pruned, 0 prunes it regardless of age")
+	pruneCmd.Flags().String("blob-cache-dir", "", "prune layers of blob cache in the directory")
+	pruneCmd.Flags().String("layer-cache-dir", "", "prune events of layer cache in the directory")
+	pruneCmd.Flags().String("quarantine-dir", "", "prune files preserved in the quarantine directory")
+	pruneCmd.Flags().Bool("work-dirs", false, "prune working directories of plugins, diagnostics bundles and rootfs of images left by runs")
+	pruneCmd.Flags().String("work-dir", "", "directory where working directories of plugins are created, temporary directory by default")
+	pruneCmd.Flags().String("diagnostics-dir", "", "directory where diagnostics bundles are written, veinmind-diagnostics under work dir by default")
+	pruneCmd.Flags().String("rootfs-dir", "", "directory where rootfs of images are materialized, temporary directory by default")
+	pruneCmd.Flags().Bool("images", false, "remove images kept after scans which are recorded in pull ledger")
+	pruneCmd.Flags().String("pull-ledger", ledger.DefaultPath(), "file where images pulled by runner are recorded")
+	pruneCmd.Flags().String("history-db", "", "trim runs from the history file")
+
+	for _, c := range []*cobra.Command{scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().Bool("keep-images", false, "keep images pulled for scan, they're recorded in pull ledger so that prune --images removes them later")
+		c.Flags().String("pull-ledger", ledger.DefaultPath(), "file where images pulled by runner are recorded, empty disables recording")
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+// withPullVia sets --pull-via of images pulled by client
+func withPullVia(c *cobra.Command, client registry.Client) (registry.Client, error) {
+	via, _ := c.Flags().GetString("pull-via")
+	if via == "" || via == registry.PullViaRuntime {
+		return client, nil
+	}
+	return registry.WithPullVia(via)(client)
+}
+
+// containerdRegistryOptions returns options of containerd registry
+// client, credentials of auth config are translated for containerd
+func containerdRegistryOptions(c *cobra.Command, config string) []registry.Option {
+	opts := []registry.Option{}
+	if ttl, _ := c.Flags().GetDuration("lease-ttl"); ttl != 0 && ttl != registry.DefaultLeaseTTL {
+		opts = append(opts, registry.WithLeaseTTL(ttl))
+	}
+	if config != "" {
+		opts = append(opts, registry.WithAuth(config))
+	}
+	return opts
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().String("pull-via", registry.PullViaRuntime, fmt.Sprintf(
+			"path images are pulled through, one of %s: runtime pulls by docker daemon or containerd, "+
+				"client fetches by registry client and loads into runtime, "+
+				"auto tries client and falls back to runtime on registry negotiation failures",
+			strings.Join(registry.PullVias, ",")))
+		c.Flags().Duration("lease-ttl", registry.DefaultLeaseTTL,
+			"ttl of containerd leases keeping content of pulled images during scan, renewed at half of it")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	commonQuarantine "github.com/chaitin/veinmind-tools/veinmind-common/go/service/quarantine"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/quarantine"
+	"github.com/spf13/cobra"
+)
+
+var quarantineStore *quarantine.Store
+
+func newQuarantineStore(c *cobra.Command) (*quarantine.Store, error) {
+	dir, _ := c.Flags().GetString("quarantine-dir")
+	if dir == "" {
+		return nil, nil
+	}
+
+	maxFileSize, _ := c.Flags().GetInt64("quarantine-max-file-size")
+	quota, _ := c.Flags().GetInt64("quarantine-quota")
+	return quarantine.NewStore(dir, maxFileSize, quota)
+}
+
+// pluginQuarantineService stores files submitted by a plugin execution
+type pluginQuarantineService struct {
+	store  *quarantine.Store
+	plugin string
+}
+
+func (s *pluginQuarantineService) Submit(file commonQuarantine.File) (string, error) {
+	artifact, err := s.store.Put(quarantine.Metadata{
+		ImageID: file.ImageID,
+		Path:    file.Path,
+		Plugin:  s.plugin,
+		EventID: file.EventID,
+	}, file.Content)
+	if err != nil {
+		log.Warnf("Quarantine %#v error: %s\n", file.Path, err.Error())
+		return "", err
+	}
+
+	log.Infof("Quarantine %#v to %#v\n", file.Path, artifact)
+	runnerReporter.AddQuarantine(file.ImageID, file.Path, artifact)
+	return artifact, nil
+}
+
+func (s *pluginQuarantineService) Add(registry *service.Registry) {
+	registry.Define(commonQuarantine.Namespace, struct{}{})
+	registry.AddService(commonQuarantine.Namespace, "submit", s.Submit)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().String("quarantine-dir", "", "directory where files flagged by plugins are preserved")
+		c.Flags().Int64("quarantine-max-file-size", 64<<20, "max size in bytes of a quarantined file")
+		c.Flags().Int64("quarantine-quota", 1<<30, "max total size in bytes of quarantine directory")
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/collector"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/queue"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/runner"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/server"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const workerPopWait = 5 * time.Second
+
+var enqueueCmd = &cobra.Command{
+	Use:   "enqueue [repo...]",
+	Short: "resolve repos of registry and push scan jobs to queue",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		registryServer, _ := cmd.Flags().GetString("server")
+		config, _ := cmd.Flags().GetString("config")
+		namespaces, _ := cmd.Flags().GetStringSlice("namespace")
+		runtime, _ := cmd.Flags().GetString("runtime")
+
+		q, err := openQueue(cmd)
+		if err != nil {
+			return err
+		}
+		defer q.Close()
+
+		c, err := newRegistryClient(runtime, config)
+		if err != nil {
+			return err
+		}
+
+		repos, err := resolveRepos(cmd.Context(), c, registryServer, namespaces, args)
+		if err != nil {
+			return err
+		}
+
+		pushed := 0
+		for _, repo := range repos {
+			job := queue.Job{
+				Key:      jobKey(c, repo),
+				Ref:      repo,
+				Runtime:  runtime,
+				Enqueued: time.Now(),
+			}
+			ok, err := q.Push(cmd.Context(), job)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				log.Infof("Coalesce job of %#v with %#v\n", repo, job.Key)
+				continue
+			}
+			pushed++
+		}
+
+		log.Infof("Enqueue %d job(s) of %d repo(s)\n", pushed, len(repos))
+		return nil
+	},
+}
+
+var workerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "consume scan jobs of queue",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		threads, _ := cmd.Flags().GetInt("threads")
+		config, _ := cmd.Flags().GetString("config")
+		name, _ := cmd.Flags().GetString("name")
+		visibility, _ := cmd.Flags().GetDuration("visibility-timeout")
+
+		q, err := openQueue(cmd)
+		if err != nil {
+			return err
+		}
+		defer q.Close()
+
+		spool, err := newWorkerSpool(cmd)
+		if err != nil {
+			return err
+		}
+		if spool != nil {
+			defer spool.Close()
+		}
+
+		if name == "" {
+			name, _ = os.Hostname()
+		}
+
+		ctx = cmd.Context()
+		ps, _, err := discoverPlugins(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		hashCache = newHashCache(cmd)
+		exec := &scanExecutor{plugins: ps, threads: threads, config: config}
+
+		workerCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		for workerCtx.Err() == nil {
+			if n, err := q.Requeue(workerCtx); err != nil {
+				log.Error(err)
+			} else if n > 0 {
+				log.Warnf("Requeue %d job(s) exceeding visibility timeout\n", n)
+			}
+
+			job, err := q.Pop(workerCtx, workerPopWait)
+			if err != nil {
+				if workerCtx.Err() == nil {
+					log.Error(err)
+					time.Sleep(workerPopWait)
+				}
+				continue
+			}
+			if job == nil {
+				continue
+			}
+
+			if err := work(workerCtx, q, exec, spool, name, *job, visibility); err != nil {
+				failed, nackErr := q.Nack(context.Background(), *job, err)
+				if nackErr != nil {
+					log.Error(nackErr)
+				}
+				if failed {
+					log.Errorf("Job of %#v failed after %d attempt(s): %s\n", job.Ref, job.Attempts+1, err.Error())
+				} else {
+					log.Warnf("Job of %#v will be retried: %s\n", job.Ref, err.Error())
+				}
+				continue
+			}
+
+			if err := q.Ack(context.Background(), *job); err != nil {
+				log.Error(err)
+			}
+		}
+
+		log.Info("Stop worker")
+		return nil
+	},
+}
+
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "inspect queue of distributed scans",
+}
+
+var queueStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show pending, in flight and failed job counts",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		q, err := openQueue(cmd)
+		if err != nil {
+			return err
+		}
+		defer q.Close()
+
+		stats, err := q.Stats(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stdout, "pending: %d\nin flight: %d\nfailed: %d\nresults: %d\n",
+			stats.Pending, stats.InFlight, stats.Failed, stats.Results)
+		return nil
+	},
+}
+
+var queueResultsCmd = &cobra.Command{
+	Use:   "results",
+	Short: "take results pushed by workers as JSON lines",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		q, err := openQueue(cmd)
+		if err != nil {
+			return err
+		}
+		defer q.Close()
+
+		enc := json.NewEncoder(os.Stdout)
+		for {
+			r, err := q.PopResult(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if r == nil {
+				return nil
+			}
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+	},
+}
+
+func openQueue(c *cobra.Command) (queue.Queue, error) {
+	url, _ := c.Flags().GetString("queue")
+	prefix, _ := c.Flags().GetString("queue-prefix")
+	visibility, _ := c.Flags().GetDuration("visibility-timeout")
+	maxAttempts, _ := c.Flags().GetInt("max-attempts")
+
+	return queue.Open(url, prefix, queue.Options{
+		VisibilityTimeout: visibility,
+		MaxAttempts:       maxAttempts,
+	})
+}
+
+// jobKey returns digest of repo so that tags of the same image are
+// coalesced, repo itself is used when digest can't be resolved
+func jobKey(c registry.Client, repo string) string {
+	digest, err := resolveDigest(c, repo)
+	if err != nil {
+		log.Warnf("Resolve digest of %#v error: %s\n", repo, err.Error())
+		return repo
+	}
+	return digest.DigestStr()
+}
+
+// newWorkerSpool returns spool of collector when it's configured as
+// sink of results
+func newWorkerSpool(c *cobra.Command) (*collector.Spool, error) {
+	collectorAddr, _ := c.Flags().GetString("collector")
+	if collectorAddr == "" {
+		return nil, nil
+	}
+	spoolDir, _ := c.Flags().GetString("spool-dir")
+	cert, _ := c.Flags().GetString("tls-cert")
+	key, _ := c.Flags().GetString("tls-key")
+	ca, _ := c.Flags().GetString("tls-ca")
+
+	tlsConfig, err := collector.TLSConfig(cert, key, ca, false)
+	if err != nil {
+		return nil, err
+	}
+	return collector.NewSpool(spoolDir, collectorAddr, tlsConfig)
+}
+
+// work scans image of job and delivers result, visibility of job is
+// extended while it's scanned
+func work(ctx context.Context, q queue.Queue, exec *scanExecutor, spool *collector.Spool,
+	name string, job queue.Job, visibility time.Duration) error {
+	touchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(visibility / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := q.Touch(touchCtx, job); err != nil {
+					log.Error(err)
+				}
+			case <-touchCtx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Infof("Work on job of %#v\n", job.Ref)
+	doc, err := exec.Execute(ctx, server.Request{
+		Type:    server.TargetRegistry,
+		Ref:     job.Ref,
+		Runtime: job.Runtime,
+	}, func(done, total int) {})
+	if err != nil {
+		return err
+	}
+
+	if spool == nil {
+		return q.PushResult(ctx, queue.Result{
+			Job:    job,
+			Worker: name,
+			Time:   time.Now(),
+			Report: doc,
+		})
+	}
+
+	err = spool.Enqueue(collector.Batch{
+		Agent:  name,
+		Host:   name,
+		Seq:    spool.NextSeq(),
+		Time:   time.Now(),
+		Events: doc.Events,
+	})
+	if err != nil {
+		return errors.Wrap(err, "spool result")
+	}
+	if _, err := flushSpool(ctx, spool); err != nil {
+		log.Warnf("Results are kept in spool: %s\n", err.Error())
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(enqueueCmd)
+	rootCmd.AddCommand(workerCmd)
+	rootCmd.AddCommand(queueCmd)
+	queueCmd.AddCommand(queueStatusCmd)
+	queueCmd.AddCommand(queueResultsCmd)
+
+	for _, c := range []*cobra.Command{enqueueCmd, workerCmd, queueStatusCmd, queueResultsCmd} {
+		c.Flags().String("queue", "redis://127.0.0.1:6379/0", "url of job queue")
+		c.Flags().String("queue-prefix", "veinmind", "prefix of queue keys")
+		c.Flags().Duration("visibility-timeout", 30*time.Minute, "how long a job in flight is invisible to other workers")
+		c.Flags().Int("max-attempts", 3, "attempts of a job before it fails")
+	}
+
+	enqueueCmd.Flags().StringP("runtime", "r", "docker", "specifies the runtime of registry client to use")
+	enqueueCmd.Flags().StringP("server", "s", "index.docker.io", "server address of registry")
+	enqueueCmd.Flags().StringP("config", "c", "", "auth config path")
+	enqueueCmd.Flags().StringSliceP("namespace", "n", nil, "namespaces of repos, nested paths and globs are matched, repeatable")
+
+	workerCmd.Flags().StringP("glob", "g", "", "specifies the pattern of plugin file to find")
+	workerCmd.Flags().IntP("threads", "t", 5, "threads for scan action")
+	workerCmd.Flags().StringP("config", "c", "", "auth config path")
+	workerCmd.Flags().String("name", "", "name of worker, hostname by default. It must be the common name or a DNS name of --tls-cert with --collector")
+	workerCmd.Flags().Int("hash-cache-size", 10000, "max number of file digests cached for plugins")
+	workerCmd.Flags().String("collector", "", "address of collector which results are sent to instead of queue, e.g. collector:8443")
+	workerCmd.Flags().String("spool-dir", "spool", "directory where events are buffered until collector accepts them")
+	workerCmd.Flags().String("tls-cert", "", "client certificate for mutual TLS")
+	workerCmd.Flags().String("tls-key", "", "client key for mutual TLS")
+	workerCmd.Flags().String("tls-ca", "", "CA which signs certificate of collector")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/redact"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/spf13/cobra"
+)
+
+var redactCmd = &cobra.Command{
+	Use:   "redact <report.json>",
+	Short: "redact a report for sharing outside, fingerprints and levels of events are kept",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		value, _ := cmd.Flags().GetString("out")
+		out, err := reporter.ParseOutput(value)
+		if err != nil {
+			return err
+		}
+		doc, err := reporter.Load(args[0])
+		if err != nil {
+			return err
+		}
+
+		redacted, err := redactReport(cmd, *doc)
+		if err != nil {
+			return err
+		}
+		return writeOutput(out, redacted)
+	},
+}
+
+// newRedactor returns redactor by rules of --redact-rules, the default
+// rules are used without it
+func newRedactor(c *cobra.Command) (*redact.Redactor, error) {
+	rules := redact.Default
+	if path, _ := c.Flags().GetString("redact-rules"); path != "" {
+		r, err := redact.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		rules = r
+	}
+	return redact.New(rules)
+}
+
+// redactReport returns doc redacted by rules of command
+func redactReport(c *cobra.Command, doc reporter.Report) (reporter.Report, error) {
+	r, err := newRedactor(c)
+	if err != nil {
+		return reporter.Report{}, err
+	}
+	redacted, err := r.Redact(doc)
+	if err != nil {
+		return reporter.Report{}, err
+	}
+	stat := r.Stat()
+	log.Infof("Redacted report: %d value(s) replaced, %d dropped, %d path(s) hashed\n",
+		stat.Replaced, stat.Dropped, stat.Hashed)
+	return redacted, nil
+}
+
+// redactOutputs redacts doc before outputs if --redact is set
+func redactOutputs(c *cobra.Command, doc reporter.Report) (reporter.Report, error) {
+	if enabled, _ := c.Flags().GetBool("redact"); !enabled {
+		return doc, nil
+	}
+	return redactReport(c, doc)
+}
+
+func init() {
+	rootCmd.AddCommand(redactCmd)
+	redactCmd.Flags().String("out", "json=redacted.json", "output of redacted report in form of format=path, - is stdout")
+	redactCmd.Flags().String("redact-rules", "", "yaml file of redaction rules, the default rules hash paths and drop secrets")
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().Bool("redact", false, "redact reports before they're written, e.g. for sharing outside")
+		c.Flags().String("redact-rules", "", "yaml file of redaction rules of --redact, the default rules hash paths and drop secrets")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registrycheck"
+	"github.com/spf13/cobra"
+	"io"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+var registryCmd = &cobra.Command{
+	Use:   "registry",
+	Short: "registry utilities",
+}
+
+var registryCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "check access to registry step by step, exit non-zero on the first failing step",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		server, _ := cmd.Flags().GetString("server")
+		username, _ := cmd.Flags().GetString("username")
+		password, _ := cmd.Flags().GetString("password")
+		repo, _ := cmd.Flags().GetString("repo")
+		plainHTTP, _ := cmd.Flags().GetBool("plain-http")
+
+		// Credentials of auth config and docker config are the ones
+		// used by scan-registry
+		if username == "" {
+			config, _ := cmd.Flags().GetString("config")
+			c, err := registry.NewRegistryDockerClient(registryOptions(cmd, config)...)
+			if err != nil {
+				return err
+			}
+			if auth, ok := c.(*registry.RegistryDockerClient).RegistryAuth(server); ok {
+				username, password = auth.Username, auth.Password
+			}
+		}
+
+		// Certificates aren't verified, the same as registry client
+		client := &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		defer w.Flush()
+		fmt.Fprintf(w, "STEP\tSTATUS\tHTTP\tDETAIL\n")
+		return registrycheck.Check(cmd.Context(), registrycheck.Options{
+			Server:    server,
+			Username:  username,
+			Password:  password,
+			Repo:      repo,
+			PlainHTTP: plainHTTP,
+			Client:    client,
+		}, func(s registrycheck.Step) {
+			printCheckStep(w, s)
+		})
+	},
+}
+
+func printCheckStep(w io.Writer, s registrycheck.Step) {
+	status := "-"
+	if s.HTTPStatus != 0 {
+		status = fmt.Sprint(s.HTTPStatus)
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Name, s.Status, status, s.Detail)
+	for _, c := range s.Challenges {
+		fmt.Fprintf(w, "\t\t\tchallenge: %s\n", c)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(registryCmd)
+	registryCmd.AddCommand(registryCheckCmd)
+	registryCheckCmd.Flags().StringP("server", "s", "index.docker.io", "server address of registry")
+	registryCheckCmd.Flags().StringP("config", "c", "", "auth config path")
+	registryCheckCmd.Flags().String("username", "", "username of registry, auth config and docker config are used if empty")
+	registryCheckCmd.Flags().String("password", "", "password of registry")
+	registryCheckCmd.Flags().String("repo", "", "sample repo whose manifest is checked, the first repo of catalog by default")
+	registryCheckCmd.Flags().Bool("plain-http", false, "access registry without tls")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/regtoken"
+	"github.com/spf13/cobra"
+	"strings"
+	"time"
+)
+
+// registryTokens are tokens of registries served by token providers,
+// nil if neither --registry-token-cmd nor --registry-token-provider is
+// set
+var registryTokens *regtoken.Cache
+
+// newRegistryTokens returns cache of tokens of providers of flags,
+// built-in providers serving their registries come before the command
+// serving every registry
+func newRegistryTokens(c *cobra.Command) (*regtoken.Cache, error) {
+	cmd, _ := c.Flags().GetString("registry-token-cmd")
+	names, _ := c.Flags().GetStringSlice("registry-token-provider")
+
+	providers := []regtoken.Provider{}
+	for _, name := range names {
+		p, err := regtoken.New(name)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	if cmd != "" {
+		providers = append(providers, regtoken.NewCommand(cmd))
+	}
+	if len(providers) == 0 {
+		return nil, nil
+	}
+	return regtoken.NewCache(logTokenFetch, providers...), nil
+}
+
+// logTokenFetch logs fetch of token, token values are never logged
+func logTokenFetch(f regtoken.Fetch) {
+	switch {
+	case f.Err != nil:
+		log.Warnf("Fetch token of registry %s by %s error: %s\n", f.Registry, f.Provider, f.Err.Error())
+	case f.Expiry.IsZero():
+		log.Infof("Fetched token of registry %s by %s\n", f.Registry, f.Provider)
+	default:
+		log.Infof("Fetched token of registry %s by %s, expires at %s\n",
+			f.Registry, f.Provider, f.Expiry.Format(time.RFC3339))
+	}
+}
+
+// withRegistryTokens sets tokens of registries to client
+func withRegistryTokens(client registry.Client) (registry.Client, error) {
+	if registryTokens == nil {
+		return client, nil
+	}
+	return registry.WithTokens(registryTokens)(client)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().String("registry-token-cmd", "", "command run by shell whose stdout is the bearer token of registry in $"+regtoken.RegistryEnv+
+			", run again once registry rejects the token, it takes precedence over --config and docker config")
+		c.Flags().StringSlice("registry-token-provider", nil, fmt.Sprintf(
+			"built-in providers exchanging ambient workload identity for tokens of their registries, one or more of %s: "+
+				"gcp serves GCR and Artifact Registry, azure serves ACR", strings.Join(regtoken.Providers, ",")))
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/remediation"
+	"github.com/spf13/cobra"
+)
+
+// newSuggester returns suggester of remediation of events, rules of
+// --remediation-rules are tried before the default rules
+func newSuggester(c *cobra.Command) (*remediation.Suggester, error) {
+	rules := remediation.Default
+	if path, _ := c.Flags().GetString("remediation-rules"); path != "" {
+		r, err := remediation.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		rules = r
+	}
+	return remediation.New(rules)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd, compareCmd, agentCmd} {
+		c.Flags().String("remediation-rules", "", "yaml file of rules suggesting Dockerfile fixes of findings")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layer"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/target"
+	"github.com/spf13/cobra"
+)
+
+// newRemovals returns removals of pulled images deferred while images
+// sharing their layers are scanned, nil unless images are scanned
+// concurrently
+func newRemovals(c *cobra.Command, veinmindRuntime api.Runtime, remove func(id string) error) *target.Removals {
+	if workers, _ := c.Flags().GetInt("image-concurrency"); workers <= 1 {
+		return nil
+	}
+	return target.NewRemovals(func(id string) ([]string, error) {
+		return imageLayers(veinmindRuntime, id)
+	}, remove, targetTally)
+}
+
+// imageLayers returns diff ids of layers of image, which are taken from
+// config of image unless layer metadata of docker is available
+func imageLayers(veinmindRuntime api.Runtime, id string) ([]string, error) {
+	image, err := veinmindRuntime.OpenImageByID(id)
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+	return imageDiffIDs(image)
+}
+
+// imageDiffIDs returns diff ids of layers of opened image
+func imageDiffIDs(image api.Image) ([]string, error) {
+	if diffIDs, err := layer.DiffIDs(image); err == nil && len(diffIDs) > 0 {
+		return diffIDs, nil
+	}
+	oci, err := image.OCISpecV1()
+	if err != nil || oci == nil {
+		return nil, err
+	}
+	diffIDs := []string{}
+	for _, d := range oci.RootFS.DiffIDs {
+		diffIDs = append(diffIDs, d.String())
+	}
+	return diffIDs, nil
+}
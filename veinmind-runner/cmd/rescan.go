@@ -0,0 +1,163 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/detect"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/imageid"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/target"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// rescanFrom is path of report rescanned, rescanDoc is the report
+	// with failures superseded by the rescan
+	rescanFrom string
+	rescanDoc  *reporter.Report
+	// rescanTargets are failed targets of the report
+	rescanTargets []reporter.Target
+)
+
+var rescanCmd = &cobra.Command{
+	Use:   "rescan --from <report.json>",
+	Short: "rescan targets failed in a report and combine the results with it",
+	Args:  cobra.NoArgs,
+	PreRunE: func(c *cobra.Command, args []string) error {
+		rescanFrom, _ = c.Flags().GetString("from")
+		if rescanFrom == "" {
+			return errors.New("--from is required")
+		}
+		doc, err := reporter.Load(rescanFrom)
+		if err != nil {
+			return err
+		}
+
+		rescanTargets = reporter.FailedTargets(*doc)
+		superseded := reporter.Supersede(rescanFrom, *doc, rescanTargets)
+		rescanDoc = &superseded
+		log.Infof("Rescan %d failed target(s) of %#v\n", len(rescanTargets), rescanFrom)
+
+		return scanPreRunE(c, args)
+	},
+	RunE:     rescan,
+	PostRunE: scanPostRunE,
+}
+
+// rescan scans failed targets again from where they were scanned
+func rescan(c *cobra.Command, args []string) error {
+	targetFunnel.Record("rescanned", len(rescanTargets), "--from="+rescanFrom)
+	for _, t := range rescanTargets {
+		var err error
+		switch t.Source {
+		case reporter.TargetHost:
+			err = rescanHost(c, t)
+		case reporter.TargetRegistry:
+			err = rescanRegistry(c, t)
+		default:
+			err = errors.Errorf("unknown source %#v of target %#v", t.Source, t.Ref)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rescanHost(c *cobra.Command, t reporter.Target) error {
+	veinmindRuntime, err := newRuntime(t.Runtime)
+	if err != nil {
+		return err
+	}
+
+	// Targets of host are ids, which are resolved the same as args of
+	// scan-host so that abbreviated ids of edited reports are accepted
+	id := t.Ref
+	ids, err := imageid.Find(veinmindRuntime, t.Ref)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 1 {
+		id = ids[0]
+	}
+
+	runnerReporter.SetTarget(id, t)
+	// Images failing to open again are recorded in coverage
+	image, err := openImage(c, veinmindRuntime, id)
+	if err != nil {
+		return nil
+	}
+	defer image.Close()
+
+	runnerReporter.SetRuntime(image.ID(), t.Runtime)
+	if err := scan(c, image); err != nil {
+		log.Error(err)
+	}
+	return nil
+}
+
+func rescanRegistry(c *cobra.Command, t reporter.Target) error {
+	if offline, _ := c.Flags().GetBool("offline"); offline {
+		return errors.Errorf("offline: %s needs network access to pull %#v", c.Name(), t.Ref)
+	}
+	config, _ := c.Flags().GetString("config")
+
+	var (
+		client registry.Client
+		err    error
+	)
+	switch t.Runtime {
+	case detect.Docker:
+		client, err = registry.NewRegistryDockerClient(registryOptions(c, config)...)
+	case detect.Containerd:
+		client, err = registry.NewRegistryContainerdClient(containerdAddress(c), containerdRegistryOptions(c, config)...)
+	default:
+		err = errors.Errorf("unknown runtime %#v of target %#v", t.Runtime, t.Ref)
+	}
+	if err != nil {
+		return err
+	}
+	client, err = withPlatform(c, client)
+	if err != nil {
+		return err
+	}
+	client, err = withPullVia(c, client)
+	if err != nil {
+		return err
+	}
+	client, err = withRegistryTokens(client)
+	if err != nil {
+		return err
+	}
+	client, err = withBlobCache(client)
+	if err != nil {
+		return err
+	}
+	veinmindRuntime, err := newRuntime(t.Runtime)
+	if err != nil {
+		return err
+	}
+
+	return target.Run(t.Ref, registrySteps(c, client, veinmindRuntime, nil), targetTally)
+}
+
+// combineRescan combines results of rescan with the report rescanned,
+// doc is returned as is if the command isn't a rescan
+func combineRescan(doc reporter.Report) (reporter.Report, error) {
+	if rescanDoc == nil {
+		return doc, nil
+	}
+	return reporter.Merge([]string{rescanFrom, "rescan"}, []*reporter.Report{rescanDoc, &doc})
+}
+
+func init() {
+	rootCmd.AddCommand(rescanCmd)
+	rescanCmd.Flags().String("from", "", "report whose failed targets are rescanned")
+	rescanCmd.Flags().StringP("glob", "g", "", "specifies the pattern of plugin file to find")
+	rescanCmd.Flags().VarP(newThreadsValue(defaultThreads), "threads", "t", "threads for scan action, adaptive picks them per image by its size")
+	rescanCmd.Flags().StringP("config", "c", "", "auth config path")
+	rescanCmd.Flags().String("allowlist", "", "allowlist file of trusted images")
+	rescanCmd.Flags().Bool("fail-fast", false, "abort the scan on the first failed target")
+	rescanCmd.Flags().Bool("always-pull", false, "pull images even if their digest is present locally")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	commonRootfs "github.com/chaitin/veinmind-tools/veinmind-common/go/service/rootfs"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/rootfs"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/walk"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// rootfsPool materializes rootfs of images for plugins declaring
+// rootfs tag
+var rootfsPool *rootfs.Pool
+
+// newRootfsPool returns pool of rootfs under --rootfs-dir within disk
+// budget and concurrency of flags
+func newRootfsPool(c *cobra.Command) (*rootfs.Pool, error) {
+	dir, _ := c.Flags().GetString("rootfs-dir")
+	budget, _ := c.Flags().GetInt64("rootfs-budget")
+	concurrency, _ := c.Flags().GetInt("rootfs-concurrency")
+	link, _ := c.Flags().GetBool("rootfs-link")
+	return rootfs.NewPool(dir, budget, concurrency, link)
+}
+
+// needsRootfs reports whether plugin declares rootfs tag
+func needsRootfs(plug *plugin.Plugin) bool {
+	for _, tag := range plug.Tags {
+		if tag == commonRootfs.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// newImageRootfs returns rootfs of image shared by plugins, disk budget
+// is reserved by size of image taken from the shared walk
+func newImageRootfs(image api.Image, walked *walk.Shared) *rootfs.Shared {
+	return rootfsPool.New(image.ID(), imageFS{image}, walked.Size)
+}
+
+// closeImageRootfs removes rootfs of image once it's scanned, images
+// whose rootfs is asked for are recorded in coverage with time and
+// disk spent
+func closeImageRootfs(s *rootfs.Shared, ref string) {
+	if err := s.Close(); err != nil {
+		log.Warnf("Remove rootfs of image %#v error: %s\n", ref, err.Error())
+	}
+	if !s.Used() {
+		return
+	}
+
+	stat := s.Stat()
+	log.Infof("Rootfs of image %#v is materialized for %s: %d files, %d hard linked, %d bytes copied in %s\n",
+		ref, strings.Join(stat.Plugins, ","), stat.Files, stat.Linked, stat.Copied, stat.Elapsed.Round(time.Millisecond))
+	runnerReporter.AddCoverage(reporter.Coverage{
+		ImageID: stat.ImageID,
+		Ref:     ref,
+		Scope:   reporter.ScopeMaterialized,
+		Reason:  "rootfs for " + strings.Join(stat.Plugins, ","),
+		Error:   stat.Error,
+		Rootfs:  &stat,
+	})
+}
+
+// pluginRootfsService serves rootfs of the image scanned by a plugin
+// execution
+type pluginRootfsService struct {
+	rootfs *rootfs.Shared
+	image  string
+	plugin string
+	asked  int32
+}
+
+func (s *pluginRootfsService) Rootfs(req commonRootfs.Request) (commonRootfs.Rootfs, error) {
+	if req.ImageID != s.image {
+		return commonRootfs.Rootfs{}, errors.Errorf("rootfs: image %#v isn't being scanned", req.ImageID)
+	}
+	atomic.StoreInt32(&s.asked, 1)
+	path, err := s.rootfs.Path(ctx, s.plugin)
+	if err != nil {
+		return commonRootfs.Rootfs{}, err
+	}
+	return commonRootfs.Rootfs{Path: path}, nil
+}
+
+// MergedView reports whether plugin has asked for rootfs, events of
+// layer-local plugins reading merged filesystem aren't cached per layer
+func (s *pluginRootfsService) MergedView() bool {
+	return atomic.LoadInt32(&s.asked) == 1
+}
+
+func (s *pluginRootfsService) Add(registry *service.Registry) {
+	registry.Define(commonRootfs.Namespace, struct{}{})
+	registry.AddService(commonRootfs.Namespace, "rootfs", s.Rootfs)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().String("rootfs-dir", "", "directory where rootfs of images are materialized for plugins declaring rootfs tag, temporary directory by default")
+		c.Flags().Int64("rootfs-budget", 0, "max bytes copied for rootfs of images materialized at once, images larger than it alone aren't materialized, 0 is unlimited")
+		c.Flags().Int("rootfs-concurrency", 1, "max number of images whose rootfs is materialized at once, 0 is unlimited")
+		c.Flags().Bool("rootfs-link", true, "hard link files of rootfs to content of image where it's on the same filesystem as --rootfs-dir instead of copying them")
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go"
+	veinmindcontainerd "github.com/chaitin/libveinmind/go/containerd"
+	"github.com/chaitin/libveinmind/go/docker"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/detect"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/containerd/containerd"
+	dockercli "github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDockerSock = "/var/run/docker.sock"
+	probeTimeout      = 5 * time.Second
+
+	containerdAddressEnv = "VEINMIND_CONTAINERD_ADDRESS"
+	dockerSocketEnv      = "VEINMIND_DOCKER_SOCKET"
+)
+
+// hostRuntimes is runtimes detected for scan-host before plugins are
+// discovered
+var hostRuntimes []string
+
+// containerdAddress returns socket of containerd from flag or
+// environment, the default socket is used if neither is specified
+func containerdAddress(c *cobra.Command) string {
+	address, _ := c.Flags().GetString("containerd-address")
+	if address == "" {
+		address = os.Getenv(containerdAddressEnv)
+	}
+	if address == "" {
+		return registry.DefaultContainerdAddress
+	}
+	return strings.TrimPrefix(address, "unix://")
+}
+
+// dockerSocket returns socket of docker daemon from flag, environment
+// or DOCKER_HOST, empty string is returned when docker is connected
+// over tcp
+func dockerSocket(c *cobra.Command) string {
+	sock, _ := c.Flags().GetString("docker-socket")
+	if sock == "" {
+		sock = os.Getenv(dockerSocketEnv)
+	}
+	if sock != "" {
+		return strings.TrimPrefix(sock, "unix://")
+	}
+
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		return defaultDockerSock
+	}
+	if strings.HasPrefix(host, "unix://") {
+		return strings.TrimPrefix(host, "unix://")
+	}
+	return ""
+}
+
+func newDockerClient(sock string) (*dockercli.Client, error) {
+	opts := []dockercli.Opt{dockercli.FromEnv, dockercli.WithAPIVersionNegotiation()}
+	if sock != "" {
+		opts = append(opts, dockercli.WithHost("unix://"+sock))
+	}
+	return dockercli.NewClientWithOpts(opts...)
+}
+
+func runtimeProbe(c *cobra.Command, name string) detect.Probe {
+	switch name {
+	case detect.Containerd:
+		address := containerdAddress(c)
+		return detect.Probe{
+			Name:   name,
+			Socket: address,
+			Ping: func(ctx context.Context) error {
+				client, err := containerd.New(address, containerd.WithTimeout(probeTimeout))
+				if err != nil {
+					return errors.Wrapf(err, "connect %s", address)
+				}
+				defer client.Close()
+
+				_, err = client.Version(ctx)
+				return errors.Wrapf(err, "connect %s", address)
+			},
+		}
+	default:
+		sock := dockerSocket(c)
+		return detect.Probe{
+			Name:   name,
+			Socket: sock,
+			Ping: func(ctx context.Context) error {
+				client, err := newDockerClient(sock)
+				if err != nil {
+					return err
+				}
+				defer client.Close()
+
+				_, err = client.Ping(ctx)
+				return errors.Wrapf(err, "connect %s", client.DaemonHost())
+			},
+		}
+	}
+}
+
+// checkRuntimes checks that runtimes used by command are reachable, so
+// that unreachable sockets fail before plugins are discovered
+func checkRuntimes(c *cobra.Command) error {
+	switch c {
+	case scanHostCmd:
+		names, err := detectRuntimes(c)
+		if err != nil {
+			return err
+		}
+		hostRuntimes = names
+	case scanRegistryCmd, scanManifestCmd:
+		name, _ := c.Flags().GetString("runtime")
+		names, err := detect.ParseNames([]string{name})
+		if err != nil {
+			return errcode.Wrap(err, errcode.RuntimeMismatch, "")
+		}
+
+		ctx, cancel := context.WithTimeout(c.Context(), probeTimeout)
+		defer cancel()
+		_, err = detect.Detect(ctx, []detect.Probe{runtimeProbe(c, names[0])})
+		return errcode.Wrap(err, errcode.RuntimeUnreachable, "")
+	}
+	return nil
+}
+
+// registryOptions returns options of registry client of command
+func registryOptions(c *cobra.Command, config string) []registry.Option {
+	opts := []registry.Option{}
+	if sock := dockerSocket(c); sock != "" {
+		opts = append(opts, registry.WithDockerSocket(sock))
+	}
+	if config != "" {
+		opts = append(opts, registry.WithAuth(config))
+	}
+	return opts
+}
+
+// detectRuntimes probes runtimes of --runtime, or all runtimes if it's
+// not specified, and returns the reachable ones
+func detectRuntimes(c *cobra.Command) ([]string, error) {
+	values, _ := c.Flags().GetStringSlice("runtime")
+	if useContainerd, _ := c.Flags().GetBool("containerd"); useContainerd && len(values) == 0 {
+		values = []string{detect.Containerd}
+	}
+
+	names, err := detect.ParseNames(values)
+	if err != nil {
+		return nil, errcode.Wrap(err, errcode.RuntimeMismatch, "")
+	}
+
+	probes := []detect.Probe{}
+	for _, name := range names {
+		probes = append(probes, runtimeProbe(c, name))
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), probeTimeout*time.Duration(len(probes)))
+	defer cancel()
+	detected, err := detect.Detect(ctx, probes)
+	if err != nil {
+		return nil, errcode.Wrap(err, errcode.RuntimeUnreachable, "")
+	}
+
+	if len(values) > 0 && len(detected) < len(names) {
+		log.Warnf("Runtimes unreachable and skipped, detected: %#v\n", detected)
+	} else {
+		log.Infof("Detected runtimes: %#v\n", detected)
+	}
+	return detected, nil
+}
+
+func newRuntime(name string) (api.Runtime, error) {
+	switch name {
+	case detect.Docker:
+		return docker.New()
+	case detect.Containerd:
+		return veinmindcontainerd.New()
+	}
+	return nil, errors.Errorf("unknown runtime %#v", name)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd, listImageCmd, listContainerCmd, pruneCmd} {
+		c.Flags().String("containerd-address", "", "socket of containerd, "+containerdAddressEnv+" is used if not specified")
+		c.Flags().String("docker-socket", "", "socket of docker, "+dockerSocketEnv+" or DOCKER_HOST is used if not specified")
+	}
+}
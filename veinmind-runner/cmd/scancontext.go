@@ -0,0 +1,50 @@
+package main
+
+import (
+	api "github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/scancontext"
+	"github.com/spf13/cobra"
+	"sync"
+)
+
+// scanTypes are scan context types of commands
+var scanTypes = map[string]string{
+	"scan-host":     scancontext.TypeHost,
+	"scan-registry": scancontext.TypeRegistry,
+	"scan-manifest": scancontext.TypeManifest,
+}
+
+var (
+	// scanTargets are original target references of images
+	scanTargets   = map[string]string{}
+	scanTargetsMu sync.Mutex
+)
+
+// setScanTarget records original target reference of image id
+func setScanTarget(id string, target string) {
+	scanTargetsMu.Lock()
+	defer scanTargetsMu.Unlock()
+	scanTargets[id] = target
+}
+
+// newScanContextService returns scan context of image scanned by
+// command, ref is used as target if image isn't scanned for a target
+func newScanContextService(c *cobra.Command, image api.Image, ref string) *scancontext.ScanContextService {
+	scanTargetsMu.Lock()
+	target, ok := scanTargets[image.ID()]
+	scanTargetsMu.Unlock()
+	if !ok {
+		target = ref
+	}
+
+	threshold, _ := c.Flags().GetString("severity-threshold")
+	resp := scancontext.Response{
+		Type:      scanTypes[c.Name()],
+		Target:    target,
+		Threshold: threshold,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		resp.Deadline = deadline
+	}
+	return scancontext.NewScanContextService(image.ID(), resp)
+}
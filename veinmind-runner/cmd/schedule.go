@@ -0,0 +1,92 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/runner"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/schedule"
+	"github.com/distribution/distribution/reference"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+// configureClasses schedules plugins in pools of their concurrency
+// classes when --io-threads or --cpu-threads is specified, --threads
+// is then size of the pool of other plugins
+func configureClasses(c *cobra.Command, r *runner.Runner, threads int) error {
+	ioThreads, _ := c.Flags().GetInt("io-threads")
+	cpuThreads, _ := c.Flags().GetInt("cpu-threads")
+	if ioThreads < 0 || cpuThreads < 0 {
+		return errors.New("--io-threads and --cpu-threads must not be negative")
+	}
+	if ioThreads == 0 && cpuThreads == 0 {
+		return nil
+	}
+
+	r.Classes = schedule.New(map[string]int{
+		schedule.ClassIO:  ioThreads,
+		schedule.ClassCPU: cpuThreads,
+	}, threads)
+	for _, p := range r.Plugins {
+		class := schedule.Class(p.Tags)
+		log.Infof("Plugin %#v of class %s is scheduled in pool %s\n", p.Name, class, r.Classes.Pool(class))
+	}
+	return nil
+}
+
+// logScheduleStats records queue wait of pools of classes in report
+func logScheduleStats(r *runner.Runner) {
+	if r.Classes == nil {
+		return
+	}
+
+	stats := r.Classes.Stats()
+	for _, s := range stats {
+		log.Infof("Pool %s: size %d, %d execution(s), average wait %s, max wait %s\n",
+			s.Class, s.Size, s.Executions, s.AverageWait().Round(time.Millisecond), s.MaxWait.Round(time.Millisecond))
+	}
+	r.Reporter.SetScheduleStats(stats)
+}
+
+// newFairScheduler returns scheduler of repos of scan-registry, which
+// pulls from registries of repos in turn by --image-concurrency workers
+func newFairScheduler(c *cobra.Command, repos []string) (*schedule.Fair, error) {
+	workers, _ := c.Flags().GetInt("image-concurrency")
+	perRegistry, _ := c.Flags().GetInt("per-registry-concurrency")
+	if workers <= 0 {
+		return nil, errors.New("--image-concurrency must be positive")
+	}
+	if perRegistry < 0 {
+		return nil, errors.New("--per-registry-concurrency must not be negative")
+	}
+	return schedule.NewFair(repos, registryDomain, workers, perRegistry), nil
+}
+
+// registryDomain returns registry domain of repo, repos which can't be
+// parsed are a domain of their own
+func registryDomain(repo string) string {
+	named, err := reference.ParseNormalizedNamed(repo)
+	if err != nil {
+		return repo
+	}
+	return reference.Domain(named)
+}
+
+// logRegistryStats records throughput of registries in report
+func logRegistryStats(f *schedule.Fair) {
+	stats := f.Stats()
+	for _, s := range stats {
+		log.Infof("Registry %s: %d of %d target(s), max %d running, busy %s, %.1f target(s)/min\n",
+			s.Domain, s.Completed, s.Targets, s.MaxRunning, s.Busy.Round(time.Millisecond), s.Throughput())
+	}
+	runnerReporter.SetRegistryStats(stats)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd, compareCmd, agentCmd} {
+		c.Flags().Int("io-threads", 0, "size of pool of plugins of class io, they share the pool of --threads if neither --io-threads nor --cpu-threads is specified")
+		c.Flags().Int("cpu-threads", 0, "size of pool of plugins of class cpu, they share the pool of --threads if neither --io-threads nor --cpu-threads is specified")
+	}
+	scanRegistryCmd.Flags().Int("image-concurrency", 1, "number of images pulled and scanned at the same time, registries are taken in turn")
+	scanRegistryCmd.Flags().Int("per-registry-concurrency", 0, "max number of images of a registry pulled and scanned at the same time, 0 means --image-concurrency")
+}
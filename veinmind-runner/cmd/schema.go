@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "print JSON schemas of documents written by runner",
+}
+
+var schemaReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "print JSON schema of report",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version, _ := cmd.Flags().GetInt("version")
+		b, err := reporter.Schema(version)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(b)
+		return err
+	},
+}
+
+var validateReportCmd = &cobra.Command{
+	Use:   "validate-report <report.json>",
+	Short: "validate a report against JSON schema of its schema version",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		violations, err := reporter.Validate(b)
+		if err != nil {
+			return err
+		}
+		for _, v := range violations {
+			fmt.Fprintln(os.Stdout, v.String())
+		}
+		if len(violations) > 0 {
+			return errors.Errorf("report %#v has %d violation(s) of schema", args[0], len(violations))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+	rootCmd.AddCommand(validateReportCmd)
+	schemaCmd.AddCommand(schemaReportCmd)
+	schemaReportCmd.Flags().Int("version", reporter.SchemaVersion, "schema version of report")
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/docker"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/scope"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/imageid"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layer"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// layerScope restricts scan to selected layers, nil means the whole
+// image is scanned
+var layerScope *layerScopeOptions
+
+type layerScopeOptions struct {
+	// layers are diff ids selected by --layers
+	layers map[string]struct{}
+	// since are diff ids of image of --new-layers-since
+	since []string
+}
+
+func newLayerScope(c *cobra.Command) (*layerScopeOptions, error) {
+	layers, _ := c.Flags().GetStringSlice("layers")
+	since, _ := c.Flags().GetString("new-layers-since")
+	if len(layers) == 0 && since == "" {
+		return nil, nil
+	}
+
+	if len(layers) > 0 && since != "" {
+		return nil, errors.New("--layers and --new-layers-since can't be used together")
+	}
+
+	opts := &layerScopeOptions{}
+	if len(layers) > 0 {
+		opts.layers = map[string]struct{}{}
+		for _, l := range layers {
+			opts.layers[l] = struct{}{}
+		}
+		return opts, nil
+	}
+
+	runtime, err := docker.New()
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := imageid.Find(runtime, since)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, errors.Errorf("image %#v not found", since)
+	}
+
+	image, err := runtime.OpenImageByID(ids[0])
+	if err != nil {
+		return nil, err
+	}
+
+	opts.since, err = layer.DiffIDs(image)
+	if err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// scopeLayers returns diff ids of layers in scope of image
+func (opts *layerScopeOptions) scopeLayers(image api.Image) []string {
+	diffIDs, err := layer.DiffIDs(image)
+	if err != nil {
+		log.Error(err)
+		return nil
+	}
+
+	layers := []string{}
+	if opts.layers != nil {
+		for _, id := range diffIDs {
+			if _, ok := opts.layers[id]; ok {
+				layers = append(layers, id)
+			}
+		}
+		return layers
+	}
+
+	shared := 0
+	for shared < len(diffIDs) && shared < len(opts.since) && diffIDs[shared] == opts.since[shared] {
+		shared++
+	}
+	return append(layers, diffIDs[shared:]...)
+}
+
+// recordCoverage records layers scanned by plugin, plugins which haven't
+// queried the scope service scanned the whole image
+func recordCoverage(image api.Image, plugin string, svc *scope.ScopeService, layers []string) {
+	c := reporter.Coverage{
+		ImageID: image.ID(),
+		Plugin:  plugin,
+		Scope:   reporter.ScopeFullImage,
+	}
+	if svc.Queried() {
+		c.Scope = reporter.ScopeLayers
+		c.Layers = layers
+	}
+
+	runnerReporter.AddCoverage(c)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().StringSlice("layers", []string{}, "diff ids of layers which plugins are restricted to")
+		c.Flags().String("new-layers-since", "", "restrict plugins to layers added since the image")
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/containerd"
+	"github.com/chaitin/libveinmind/go/docker"
+	"github.com/chaitin/libveinmind/go/plugin"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/allowlist"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/audit"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/pluginpool"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/runner"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/server"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var serverCmd = &cobra.Command{
+	Use:   "server",
+	Short: "serve on-demand scans over HTTP API",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listen, _ := cmd.Flags().GetString("listen")
+		tokenEnv, _ := cmd.Flags().GetString("token-env")
+		maxConcurrent, _ := cmd.Flags().GetInt("max-concurrent-scans")
+		maxQueued, _ := cmd.Flags().GetInt("max-queued-scans")
+		retention, _ := cmd.Flags().GetDuration("scan-retention")
+		threads, _ := cmd.Flags().GetInt("threads")
+		config, _ := cmd.Flags().GetString("config")
+		cert, _ := cmd.Flags().GetString("tls-cert")
+		key, _ := cmd.Flags().GetString("tls-key")
+		poolSize, _ := cmd.Flags().GetInt("plugin-pool-size")
+		poolIdle, _ := cmd.Flags().GetDuration("plugin-pool-idle")
+		poolRestarts, _ := cmd.Flags().GetInt("plugin-pool-max-restarts")
+
+		token := os.Getenv(tokenEnv)
+		if token == "" {
+			return errors.Errorf("api token is required in environment variable %s", tokenEnv)
+		}
+
+		ctx = cmd.Context()
+		ps, _, err := discoverPlugins(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		hashCache = newHashCache(cmd)
+
+		// Processes of plugins supporting pool are kept warm between
+		// scans, pool is disabled with size of zero
+		var pool *pluginpool.Pool
+		if poolSize > 0 {
+			pool = pluginpool.New(pluginpool.Options{
+				Size:        poolSize,
+				IdleTimeout: poolIdle,
+				MaxRestarts: poolRestarts,
+			})
+		}
+
+		// Plugin executions of all scans are recorded to the same log
+		auditLog, err := openAuditLog(cmd)
+		if err != nil {
+			return err
+		}
+		if auditLog != nil {
+			defer auditLog.Close()
+		}
+
+		// Allowlist applies to all scans and is reloaded once modified
+		if allowlistPath, _ := cmd.Flags().GetString("allowlist"); allowlistPath != "" {
+			allowlistStore, err = allowlist.NewStore(allowlistPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		opts := server.Options{
+			Token:         token,
+			MaxConcurrent: maxConcurrent,
+			MaxQueued:     maxQueued,
+			Retention:     retention,
+		}
+		if pool != nil {
+			opts.Metrics = func() interface{} {
+				return pool.Stats()
+			}
+		}
+		s, err := server.New(&scanExecutor{
+			plugins:   ps,
+			threads:   threads,
+			config:    config,
+			pool:      pool,
+			audit:     auditLog,
+			allowlist: allowlistStore,
+		}, opts)
+		if err != nil {
+			return err
+		}
+
+		serveCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		watchAllowlist(serveCtx, cmd, allowlistStore)
+
+		httpServer := &http.Server{
+			Addr:    listen,
+			Handler: s,
+		}
+		go func() {
+			<-serveCtx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			_ = httpServer.Shutdown(shutdownCtx)
+			s.Close()
+			if pool != nil {
+				pool.Close(shutdownCtx)
+			}
+		}()
+
+		log.Infof("Server listen on %#v\n", listen)
+		if cert != "" || key != "" {
+			err = httpServer.ListenAndServeTLS(cert, key)
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	},
+}
+
+// scanExecutor runs scans of server and queue workers, every scan has its
+// own runner so that reports of concurrent scans are separated
+type scanExecutor struct {
+	plugins []*plugin.Plugin
+	threads int
+	config  string
+	pool    *pluginpool.Pool
+	audit   *audit.Log
+	// allowlist marks events of trusted images, nil if not given
+	allowlist *allowlist.Store
+}
+
+func (e *scanExecutor) Execute(ctx context.Context, req server.Request, progress func(done, total int)) (reporter.Report, error) {
+	threads := req.Threads
+	if threads == 0 {
+		threads = e.threads
+	}
+
+	var (
+		veinmindRuntime api.Runtime
+		err             error
+	)
+	switch req.Runtime {
+	case "docker":
+		veinmindRuntime, err = docker.New()
+	case "containerd":
+		veinmindRuntime, err = containerd.New()
+	default:
+		err = errcode.New(errcode.RuntimeMismatch, "", "runtime not match")
+	}
+	if err != nil {
+		return reporter.Report{}, err
+	}
+	defer veinmindRuntime.Close()
+
+	var ids []string
+	switch req.Type {
+	case server.TargetHost:
+		if req.Ref == "" {
+			ids, err = veinmindRuntime.ListImageIDs()
+		} else {
+			ids, err = veinmindRuntime.FindImageIDs(req.Ref)
+		}
+	case server.TargetImage:
+		ids, err = veinmindRuntime.FindImageIDs(req.Ref)
+		if err == nil && len(ids) == 0 {
+			err = errors.Errorf("image %#v not found", req.Ref)
+		}
+	case server.TargetRegistry:
+		var (
+			c   registry.Client
+			ref string
+		)
+		c, ref, err = e.pull(ctx, req)
+		if err != nil {
+			break
+		}
+
+		// Containerd opens image by pulled reference, docker finds
+		// ids by reference normalized as scan-registry does
+		if req.Runtime == "containerd" {
+			ids = []string{ref}
+		} else {
+			var findRef string
+			findRef, err = dockerFindRef(ref)
+			if err == nil {
+				ids, err = veinmindRuntime.FindImageIDs(findRef)
+			}
+			if err == nil && len(ids) == 0 {
+				err = errors.Errorf("image %#v pulled but not found", req.Ref)
+			}
+		}
+		if err != nil {
+			removePulled(c, []string{ref})
+			break
+		}
+		defer removePulled(c, ids)
+	}
+	if err != nil {
+		return reporter.Report{}, err
+	}
+
+	r, err := runner.New(e.plugins, threads)
+	if err != nil {
+		return reporter.Report{}, err
+	}
+	defer r.Close()
+	r.Pool = e.pool
+	r.Audit = e.audit
+
+	progress(0, len(ids))
+	for i, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return reporter.Report{}, err
+		}
+
+		image, err := veinmindRuntime.OpenImageByID(id)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if entry, ok := e.allowlist.Match(image); ok {
+			log.Infof("Image %#v is allowlisted by %#v\n", id, entry.String())
+			r.Reporter.MarkAllowlisted(image.ID())
+		}
+		err = r.ScanImage(ctx, image, runner.WithServices(func(plug *plugin.Plugin) []runner.Service {
+			return []runner.Service{&pluginHashService{cache: hashCache, image: image}}
+		}))
+		if err != nil {
+			log.Error(err)
+		}
+		if err := image.Close(); err != nil {
+			log.Error(err)
+		}
+		progress(i+1, len(ids))
+	}
+
+	r.Close()
+	return r.Reporter.Snapshot(), nil
+}
+
+// removePulled removes images pulled for registry target, it has its own
+// deadline since context of scan is done once scan is cancelled
+func removePulled(c registry.Client, ids []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, id := range ids {
+		if err := c.Remove(ctx, id); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// pull pulls repo of registry target and returns the pulled reference
+func (e *scanExecutor) pull(ctx context.Context, req server.Request) (registry.Client, string, error) {
+	c, err := newRegistryClient(req.Runtime, e.config)
+	if err != nil {
+		return nil, "", err
+	}
+
+	log.Infof("Start pull image: %#v\n", req.Ref)
+	ref, err := c.Pull(ctx, req.Ref)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "pull image %#v", req.Ref)
+	}
+	log.Infof("Pull image success: %#v\n", req.Ref)
+	return c, ref, nil
+}
+
+// newRegistryClient returns registry client of runtime, auth config is
+// optional
+func newRegistryClient(runtime string, config string) (registry.Client, error) {
+	switch runtime {
+	case "docker":
+		if config == "" {
+			return registry.NewRegistryDockerClient()
+		}
+		return registry.NewRegistryDockerClient(registry.WithAuth(config))
+	case "containerd":
+		return registry.NewRegistryContainerdClient(registry.DefaultContainerdAddress)
+	default:
+		return nil, errcode.New(errcode.RuntimeMismatch, "", "runtime not match")
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(serverCmd)
+	serverCmd.Flags().String("listen", ":8080", "address of HTTP API to listen on")
+	serverCmd.Flags().String("token-env", "VEINMIND_API_TOKEN", "environment variable holding bearer token of HTTP API")
+	serverCmd.Flags().Int("max-concurrent-scans", 2, "max number of scans running at the same time")
+	serverCmd.Flags().Int("max-queued-scans", 10, "max number of scans waiting to run")
+	serverCmd.Flags().Duration("scan-retention", 24*time.Hour, "how long finished scans are kept")
+	serverCmd.Flags().StringP("glob", "g", "", "specifies the pattern of plugin file to find")
+	serverCmd.Flags().IntP("threads", "t", 5, "default threads for scan action")
+	serverCmd.Flags().StringP("config", "c", "", "auth config path of registry")
+	serverCmd.Flags().String("tls-cert", "", "certificate of HTTP API")
+	serverCmd.Flags().String("tls-key", "", "private key of HTTP API")
+	serverCmd.Flags().Int("plugin-pool-size", 0, "max number of warm processes of each plugin supporting pool, 0 disables pool")
+	serverCmd.Flags().Duration("plugin-pool-idle", 5*time.Minute, "how long an idle pooled plugin process is kept")
+	serverCmd.Flags().Int("plugin-pool-max-restarts", 3, "crashes of a pooled plugin after which it's executed per scan again")
+	serverCmd.Flags().Int("hash-cache-size", 10000, "max number of file digests cached for plugins")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/cosign"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+type signatureVerifier struct {
+	*cosign.Verifier
+	key     string
+	require bool
+}
+
+// newSignatureVerifier creates verifier from flags, nil is returned
+// if signature verification isn't enabled
+func newSignatureVerifier(c *cobra.Command) (*signatureVerifier, error) {
+	verify, _ := c.Flags().GetBool("verify-signature")
+	require, _ := c.Flags().GetBool("require-signature")
+	if !verify && !require {
+		return nil, nil
+	}
+
+	key, _ := c.Flags().GetString("cosign-key")
+	roots, _ := c.Flags().GetString("cosign-cert-chain")
+	rekorKey, _ := c.Flags().GetString("cosign-rekor-key")
+	identity, _ := c.Flags().GetString("cosign-identity")
+	issuer, _ := c.Flags().GetString("cosign-oidc-issuer")
+
+	v, err := cosign.NewVerifier(key, roots, rekorKey, identity, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &signatureVerifier{
+		Verifier: v,
+		key:      key,
+		require:  require,
+	}, nil
+}
+
+// verify verifies signature of repo before pulling, the result is
+// recorded in report metadata and failure is reported as event.
+// It returns false if repo shouldn't be pulled
+func (v *signatureVerifier) verify(c registry.Client, repo string) bool {
+	var opts []remote.Option
+	if dc, ok := c.(*registry.RegistryDockerClient); ok {
+		opts, _ = dc.RemoteOptions(repo)
+	}
+
+	digest, sig, err := v.Verify(repo, opts...)
+	result := reporter.SignatureVerification{
+		Scheme:    "cosign",
+		Reference: repo,
+		Digest:    digest.DigestStr(),
+		Verified:  err == nil,
+	}
+
+	if err != nil {
+		log.Warnf("Verify signature failed: %#v, %s\n", repo, err.Error())
+		result.Error = err.Error()
+		runnerReporter.AddSignature(result)
+		runnerReporter.Send(report.ReportEvent{
+			ID:         repo,
+			Time:       time.Now(),
+			Level:      report.High,
+			DetectType: report.Image,
+			EventType:  report.Risk,
+			AlertType:  report.Signature,
+			AlertDetails: []report.AlertDetail{
+				{
+					SignatureDetail: &report.SignatureDetail{
+						Reference: repo,
+						Digest:    digest.DigestStr(),
+						Scheme:    "cosign",
+						Reason:    err.Error(),
+					},
+				},
+			},
+		})
+
+		return !v.require
+	}
+
+	log.Infof("Verify signature success: %#v\n", repo)
+	if sig.Certificate != nil {
+		result.Signer = sig.Identity()
+		result.Issuer = sig.Issuer()
+		result.Certificate = &reporter.CertificateInfo{
+			Subject:      sig.Certificate.Subject.String(),
+			Issuer:       sig.Certificate.Issuer.String(),
+			SerialNumber: sig.Certificate.SerialNumber.String(),
+			NotBefore:    sig.Certificate.NotBefore,
+			NotAfter:     sig.Certificate.NotAfter,
+		}
+	} else {
+		result.Signer = v.key
+	}
+	runnerReporter.AddSignature(result)
+
+	return true
+}
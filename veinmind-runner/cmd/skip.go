@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/skip"
+	"github.com/spf13/cobra"
+)
+
+// skipPlugins returns plugins which image opts out of by label, skips
+// are recorded in coverage. Malformed labels skip nothing
+func skipPlugins(c *cobra.Command, image api.Image) []string {
+	oci, err := image.OCISpecV1()
+	if err != nil || oci == nil {
+		return nil
+	}
+	if _, ok := oci.Config.Labels[skip.Label]; !ok {
+		return nil
+	}
+
+	if ignore, _ := c.Flags().GetBool("ignore-skip-labels"); ignore {
+		log.Infof("Ignore label %s of image %#v\n", skip.Label, image.ID())
+		return nil
+	}
+
+	known := []string{}
+	for _, p := range scanRunner.Plugins {
+		known = append(known, p.Name)
+	}
+
+	result, err := skip.Parse(oci.Config.Labels, known)
+	if err != nil {
+		log.Warnf("Image %#v: %s, no plugin is skipped\n", image.ID(), err.Error())
+		return nil
+	}
+	for _, name := range result.Unknown {
+		log.Warnf("Image %#v skips unknown plugin by label %s: %#v\n", image.ID(), skip.Label, name)
+	}
+
+	for _, name := range result.Plugins {
+		log.Infof("Skip plugin %#v for image %#v by label %s\n", name, image.ID(), skip.Label)
+		runnerReporter.AddCoverage(reporter.Coverage{
+			ImageID: image.ID(),
+			Plugin:  name,
+			Scope:   reporter.ScopeSkipped,
+			Reason:  "label " + skip.Label,
+		})
+	}
+	return result.Plugins
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().Bool("ignore-skip-labels", false, "run all plugins regardless of label "+skip.Label+" of images")
+	}
+}
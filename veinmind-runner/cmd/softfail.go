@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/runner"
+	"github.com/spf13/cobra"
+	"io"
+	"text/tabwriter"
+)
+
+// configureSoftFail sets plugins of --soft-fail-plugins whose failures
+// are soft, plugins declaring runner.SoftFailTag are soft as well
+func configureSoftFail(c *cobra.Command, r *runner.Runner) {
+	names, _ := c.Flags().GetStringSlice("soft-fail-plugins")
+	r.SoftFail = runner.NewSoftFail(names)
+	for _, p := range r.Plugins {
+		if r.SoftFail.Soft(p.Name, p.Tags) {
+			log.Infof("Failures of plugin %#v are soft\n", p.Name)
+		}
+	}
+}
+
+// strictExit returns exit code of --strict, which fails the scan if any
+// plugin execution crashed or ran over budget. Soft-fail plugins are
+// never counted
+func strictExit(c *cobra.Command, doc reporter.Report) int {
+	strict, _ := c.Flags().GetBool("strict")
+	if !strict {
+		return 0
+	}
+
+	failed := doc.FailedExecutions()
+	if len(failed) == 0 {
+		return 0
+	}
+	log.Errorf("%d plugin execution(s) failed in strict mode\n", len(failed))
+	return 1
+}
+
+// printSoftFailures summarizes failures of soft-fail plugins apart from
+// failures of the scan
+func printSoftFailures(w io.Writer, failures []reporter.Coverage) {
+	if len(failures) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "SOFT-FAILED PLUGIN\tIMAGE\tREASON\n")
+	for _, f := range failures {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Plugin, f.ImageID, f.Reason)
+	}
+	tw.Flush()
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd, compareCmd, agentCmd} {
+		c.Flags().StringSlice("soft-fail-plugins", nil, "plugins whose failures are recorded as soft-failed and never fail the scan, e.g. name1,name2")
+		c.Flags().Bool("strict", false, "exit with code 1 if any plugin execution crashed or ran over budget, except soft-fail plugins")
+	}
+}
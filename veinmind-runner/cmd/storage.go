@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/regstorage"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/runner"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// registryStorage is storage of registry images are read from instead
+// of registry, nil if --registry-storage isn't set
+var registryStorage *regstorage.Storage
+
+// withRegistryStorage reads images of client from --registry-storage,
+// verification of signatures needs registry and is rejected
+func withRegistryStorage(c *cobra.Command, client registry.Client, verifiers imageVerifiers) (registry.Client, error) {
+	root, _ := c.Flags().GetString("registry-storage")
+	if root == "" {
+		return client, nil
+	}
+	if len(verifiers) > 0 {
+		return nil, errors.New("signature and content trust can't be verified without registry, they can't be used with --registry-storage")
+	}
+	if via, _ := c.Flags().GetString("pull-via"); c.Flags().Changed("pull-via") && via != registry.PullViaClient {
+		log.Warnf("Images of registry storage are read by registry client, --pull-via %s is ignored\n", via)
+	}
+
+	s, err := regstorage.Open(root)
+	if err != nil {
+		return nil, err
+	}
+	registryStorage = s
+	return registry.WithStorage(s)(client)
+}
+
+// storageRepos returns references of all tags of repos of registry
+// storage, repos are named under server which the storage belongs to
+func storageRepos(server string) ([]string, error) {
+	repos, err := registryStorage.Repositories()
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []string{}
+	for _, repo := range repos {
+		tags, err := registryStorage.Tags(repo)
+		if err != nil {
+			return nil, err
+		}
+		if len(tags) == 0 {
+			log.Warnf("Repo %#v of registry storage has no tag, skip it\n", repo)
+		}
+		for _, tag := range tags {
+			refs = append(refs, server+"/"+repo+":"+tag)
+		}
+	}
+	log.Infof("Found %d repo(s) and %d tag(s) in registry storage %s\n", len(repos), len(refs), registryStorage.Root())
+	return refs, nil
+}
+
+// storageDigest resolves digest of repo in registry storage
+func storageDigest(repo string) (name.Digest, error) {
+	ref, err := name.ParseReference(repo)
+	if err != nil {
+		return name.Digest{}, err
+	}
+	h, err := registryStorage.Resolve(ref.Context().RepositoryStr(), ref.Identifier())
+	if err != nil {
+		return name.Digest{}, err
+	}
+	return ref.Context().Digest(h.String()), nil
+}
+
+// storagePullError returns error reading repo from registry storage
+// with hint, images whose blobs are missing or corrupt are marked as
+// failed in coverage while the scan goes on
+func storagePullError(repo string, err error) error {
+	switch {
+	case regstorage.IsBlobError(err):
+		runnerReporter.AddCoverage(reporter.Coverage{
+			Ref:    repo,
+			Scope:  reporter.ScopeFailed,
+			Reason: runner.ReasonCorrupted,
+			Error:  err.Error(),
+			Code:   errcode.RegistryStorageCorrupt,
+			Target: &reporter.Target{Source: reporter.TargetRegistry, Runtime: targetTally.Runtime, Ref: repo},
+		})
+		return errcode.Wrap(err, errcode.RegistryStorageCorrupt, "")
+	case errors.Is(err, regstorage.ErrNotFound):
+		return errcode.Wrap(err, errcode.RegistryNotFound, fmt.Sprintf("check %s exists in registry storage %s", repo, registryStorage.Root()))
+	}
+	return err
+}
+
+func init() {
+	scanRegistryCmd.Flags().String("registry-storage", "", "storage directory of registry:2 holding docker/registry/v2, images are read from it instead of --server without any request to registry")
+}
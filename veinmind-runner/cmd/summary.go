@@ -0,0 +1,107 @@
+package main
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/summary"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/target"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var (
+	summaryEmitter *summary.Emitter
+	// scannedImages counts images passed to plugins
+	scannedImages int64
+	// scanStart is when the scan command started
+	scanStart time.Time
+)
+
+// startSummary prepares summary line of --summary-line, which is emitted
+// on completion, error or interruption so that scripts always have
+// something to parse
+func startSummary(c *cobra.Command) {
+	scanStart = time.Now()
+	if enabled, _ := c.Flags().GetBool("summary-line"); !enabled {
+		return
+	}
+
+	summaryEmitter = summary.NewEmitter(os.Stderr, collectSummary)
+
+	// Interrupted scan exits with conventional code of the signal
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		exit := 130
+		if sig == syscall.SIGTERM {
+			exit = 143
+		}
+		emitSummary(exit)
+		os.Exit(exit)
+	}()
+}
+
+// collectSummary collects summary of the scan so far, exit code is
+// left to the caller
+func collectSummary() summary.Summary {
+	s := summary.Summary{
+		Scanned:  int(atomic.LoadInt64(&scannedImages)),
+		Duration: time.Since(scanStart),
+	}
+	var (
+		failures []target.Failure
+		coverage []reporter.Coverage
+	)
+	if targetTally != nil {
+		failures = targetTally.Failures()
+		s.Failed = len(failures)
+	}
+	if blobCache != nil {
+		stats := blobCache.Stats()
+		s.BlobHits, s.BlobMisses, s.BlobSaved = stats.Hits, stats.Misses, stats.Saved
+	}
+	if layerCache != nil {
+		s.LayerScansAvoided = layerCache.Stats().Avoided
+	}
+	if runnerReporter != nil {
+		doc := runnerReporter.Snapshot()
+		coverage = doc.Metadata.Coverage
+		events := doc.Events
+		s.Suppressed = doc.Suppressed()
+		s.SoftFailed = len(doc.SoftFailures())
+		// Monitor-only events are counted apart
+		for _, evt := range events {
+			if evt.Monitor != nil {
+				s.Monitored++
+				continue
+			}
+			s.Events++
+			switch evt.Level {
+			case report.Critical:
+				s.Critical++
+			case report.High:
+				s.High++
+			}
+		}
+	}
+	s.Codes = errorCodes(failures, coverage)
+	return s
+}
+
+// emitSummary emits summary line with exit code if it's enabled
+func emitSummary(exit int) {
+	if summaryEmitter != nil {
+		summaryEmitter.Emit(exit)
+	}
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().Bool("summary-line", true, "emit a one-line parsable summary to stderr on exit")
+	}
+}
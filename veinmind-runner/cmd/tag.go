@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/spf13/cobra"
+)
+
+// defaultTagRepos tags repos without tag or digest with --default-tag
+func defaultTagRepos(c *cobra.Command, repos []string) ([]string, error) {
+	tag, _ := c.Flags().GetString("default-tag")
+	if tag == "" {
+		tag = registry.DefaultTag
+	}
+
+	tagged := []string{}
+	for _, repo := range repos {
+		ref, err := registry.WithDefaultTag(repo, tag)
+		if err != nil {
+			return nil, err
+		}
+		tagged = append(tagged, ref)
+	}
+	return tagged, nil
+}
+
+// checkTag checks that tag of repo exists before pulling unless
+// --no-tag-check is specified, clients which can't list tags skip it
+func checkTag(ctx context.Context, c *cobra.Command, client registry.Client, repo string) error {
+	if skip, _ := c.Flags().GetBool("no-tag-check"); skip {
+		return nil
+	}
+
+	checker, ok := client.(registry.TagChecker)
+	if !ok {
+		return nil
+	}
+	return registry.CheckTag(ctx, checker, repo)
+}
+
+func init() {
+	scanRegistryCmd.Flags().String("default-tag", registry.DefaultTag, "tag of references without tag or digest")
+	for _, c := range []*cobra.Command{scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().Bool("no-tag-check", false, "pull without checking that tag exists, for registries restricting tag listing")
+	}
+}
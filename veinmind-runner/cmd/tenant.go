@@ -0,0 +1,116 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/scanconfig"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/tenant"
+	"github.com/spf13/cobra"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// tenantTagger tags events and coverage with tenants, nil unless any of
+// --tenant, --tenants-file and --output-dir is given
+var tenantTagger *tenant.Tagger
+
+// newTenantTagger loads tenants of targets from flags
+func newTenantTagger(c *cobra.Command) (*tenant.Tagger, error) {
+	fallback, _ := c.Flags().GetString("tenant")
+	file, _ := c.Flags().GetString("tenants-file")
+	dir, _ := c.Flags().GetString("output-dir")
+	if fallback == "" && file == "" && dir == "" {
+		return nil, nil
+	}
+
+	t := &tenant.Tagger{Fallback: fallback}
+	if fallback != "" {
+		if err := tenant.CheckName(fallback); err != nil {
+			return nil, err
+		}
+	}
+	if file != "" {
+		config, err := tenant.Load(file)
+		if err != nil {
+			return nil, err
+		}
+		t.Config = config
+	}
+	return t, nil
+}
+
+// tagTenants stamps tenants on events and coverage of report
+func tagTenants(doc *reporter.Report) {
+	if tenantTagger != nil {
+		tenantTagger.Tag(doc)
+	}
+}
+
+// writeTenantOutputs writes report of every tenant to directory of
+// tenant under --output-dir, with file names of outputs. Outputs to
+// stdout aren't split
+func writeTenantOutputs(c *cobra.Command, doc reporter.Report) error {
+	dir, _ := c.Flags().GetString("output-dir")
+	if dir == "" {
+		return nil
+	}
+
+	outputs, err := reportOutputs(c)
+	if err != nil {
+		return err
+	}
+	files := []reporter.Output{}
+	for _, o := range outputs {
+		if o.Path != reporter.Stdout {
+			files = append(files, o)
+		}
+	}
+	if len(files) == 0 {
+		files = append(files, reporter.Output{Format: reporter.FormatJSON, Path: "report.json"})
+	}
+
+	policy, _ := c.Flags().GetString("if-output-exists")
+	for _, name := range tenant.Tenants(doc) {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			return err
+		}
+		filtered := tenant.Filter(doc, name)
+		for _, o := range files {
+			o.Path = filepath.Join(dir, name, filepath.Base(o.Path))
+			if err := writeOutputPolicy(o, filtered, policy); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// notifyTenants posts reports of tenants to their webhooks, failures
+// are logged without failing the scan
+func notifyTenants(doc reporter.Report) {
+	if tenantTagger == nil || tenantTagger.Config == nil {
+		return
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, name := range tenant.Tenants(doc) {
+		url, ok := tenantTagger.Config.Webhooks[name]
+		if !ok {
+			continue
+		}
+		n := tenant.NewNotification(name, tenant.Filter(doc, name))
+		if err := tenant.Notify(ctx, client, url, n); err != nil {
+			log.Warnf("Notify tenant %#v error: %s\n", name, scanconfig.Redact("webhook", err.Error()))
+		}
+	}
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().String("tenant", "", "tenant of targets no rule of tenants file tags, "+tenant.Default+" if empty")
+		c.Flags().String("tenants-file", "", "file of \"tenant=<name> image=<pattern>\" and \"tenant=<name> webhook=<url>\" lines")
+		c.Flags().String("output-dir", "", "directory where outputs are split into subdirectories of tenants")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/threatintel"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var threatIntel *threatintel.Enricher
+
+func newThreatIntel(c *cobra.Command) (*threatintel.Enricher, error) {
+	lookupers := []threatintel.Lookuper{}
+
+	db, _ := c.Flags().GetString("hash-db")
+	if db != "" {
+		l, err := threatintel.LoadDB(db)
+		if err != nil {
+			return nil, err
+		}
+		lookupers = append(lookupers, l)
+	}
+
+	api, _ := c.Flags().GetString("ti-api")
+	if api != "" {
+		tokenEnv, _ := c.Flags().GetString("ti-token-env")
+		lookupers = append(lookupers, threatintel.NewAPI(api, os.Getenv(tokenEnv)))
+	}
+
+	if len(lookupers) == 0 {
+		return nil, nil
+	}
+
+	return threatintel.NewEnricher(lookupers...), nil
+}
+
+// hashesOf returns sha256 of files of event, reported by plugin or
+// computed by hash service
+func hashesOf(evt reporter.Event) []string {
+	hashes := reporter.Hashes(evt.AlertDetails)
+	seen := map[string]struct{}{}
+	for _, h := range hashes {
+		seen[h] = struct{}{}
+	}
+
+	for _, p := range reporter.Paths(evt.AlertDetails) {
+		d, ok := hashCache.Peek(evt.ID, p)
+		if !ok {
+			continue
+		}
+		if _, ok := seen[d.SHA256]; !ok {
+			seen[d.SHA256] = struct{}{}
+			hashes = append(hashes, d.SHA256)
+		}
+	}
+
+	return hashes
+}
+
+// enrichEvents looks up hashes of events against threat intelligence
+func enrichEvents() {
+	if threatIntel == nil {
+		return
+	}
+
+	runnerReporter.Update(func(events []reporter.Event) {
+		matched := threatIntel.Enrich(ctx, events, hashesOf)
+		if matched > 0 {
+			log.Warnf("Threat intelligence matched %d event(s)\n", matched)
+		}
+	})
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd, compareCmd} {
+		c.Flags().String("hash-db", "", "hash blacklist file, one sha256 per line or a bloom filter")
+		c.Flags().String("ti-api", "", "url of threat intelligence hash lookup api")
+		c.Flags().String("ti-token-env", "VEINMIND_TI_TOKEN", "environment variable of token of threat intelligence api")
+	}
+}
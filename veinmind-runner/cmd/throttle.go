@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/detect"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/profile"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/throttle"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadAvgPath is where load average of host is read
+const loadAvgPath = "/proc/loadavg"
+
+var (
+	// scanThrottle throttles scans while the host is under load, nil
+	// unless a throttle threshold is set
+	scanThrottle *throttle.Throttle
+	// stopThrottle stops sampling of scanThrottle
+	stopThrottle = func() {}
+)
+
+// niceProfile presets conservative flags for scans of production hosts,
+// daemon slower than 200ms or load over 3/4 of cpus throttles scans
+func niceProfile() profile.Profile {
+	return profile.Profile{
+		Description: "conservative scans of production hosts",
+		Flags: map[string]profile.Values{
+			"throttle-ping-latency": {"200ms"},
+			"throttle-load":         {strconv.FormatFloat(float64(runtime.NumCPU())*0.75, 'f', 2, 64)},
+			"threads":               {"2"},
+			"image-concurrency":     {"1"},
+		},
+	}
+}
+
+// applyNice sets flags of --nice which are neither given on command line
+// nor set by --profile
+func applyNice(c *cobra.Command) error {
+	if nice, _ := c.Flags().GetBool("nice"); !nice {
+		return nil
+	}
+
+	p := niceProfile()
+	if profileResolution != nil {
+		for _, flag := range profileResolution.Applied {
+			delete(p.Flags, flag)
+		}
+	}
+	r, err := p.Apply("nice", c.Flags())
+	if err != nil {
+		return err
+	}
+	log.Infof("Nice scan applied: %s\n", strings.Join(r.Applied, ","))
+	return nil
+}
+
+// throttleRuntime returns runtime whose daemon is pinged, docker is
+// preferred on hosts running both
+func throttleRuntime(c *cobra.Command) string {
+	if c == scanHostCmd {
+		for _, name := range hostRuntimes {
+			if name == detect.Docker {
+				return name
+			}
+		}
+		if len(hostRuntimes) > 0 {
+			return hostRuntimes[0]
+		}
+	}
+	if name, _ := c.Flags().GetString("runtime"); name == detect.Containerd {
+		return name
+	}
+	return detect.Docker
+}
+
+// throttleProbe samples ping latency of daemon of runtime and load
+// average of host, only what thresholds check is sampled
+func throttleProbe(c *cobra.Command, name string, thresholds throttle.Thresholds) func(ctx context.Context) throttle.Sample {
+	ping := runtimeProbe(c, name).Ping
+	return func(ctx context.Context) throttle.Sample {
+		s := throttle.Sample{Time: time.Now()}
+		if thresholds.Latency > 0 {
+			pingCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+			s.Err = ping(pingCtx)
+			s.Latency = time.Since(s.Time)
+			cancel()
+		}
+		if thresholds.Load > 0 {
+			load, err := throttle.ReadLoadAvg(loadAvgPath)
+			if err != nil {
+				log.Debugf("Read load average error: %s\n", err.Error())
+			}
+			s.Load = load
+		}
+		return s
+	}
+}
+
+// configureThrottle starts sampling the host every --throttle-interval
+// if any throttle threshold is set
+func configureThrottle(c *cobra.Command) error {
+	scanThrottle, stopThrottle = nil, func() {}
+	latency, _ := c.Flags().GetDuration("throttle-ping-latency")
+	load, _ := c.Flags().GetFloat64("throttle-load")
+	if latency == 0 && load == 0 {
+		return nil
+	}
+	interval, _ := c.Flags().GetDuration("throttle-interval")
+	if interval <= 0 {
+		return errors.New("--throttle-interval must be positive")
+	}
+
+	thresholds := throttle.Thresholds{Latency: latency, Load: load}
+	t, err := throttle.New(thresholds, func(evt throttle.Event) {
+		switch evt.Action {
+		case throttle.ActionThrottle:
+			log.Warnf("Scans throttled to one image and plugin: %s\n", evt.Reason)
+		case throttle.ActionResume:
+			log.Infof("Scans resumed: %s\n", evt.Reason)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	name := throttleRuntime(c)
+	log.Infof("Throttle scans by %s ping latency over %s or load average over %.2f, sampled every %s\n",
+		name, latency, load, interval)
+
+	sampleCtx, cancel := context.WithCancel(c.Context())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t.Run(sampleCtx, interval, throttleProbe(c, name, thresholds))
+	}()
+	scanThrottle = t
+	stopThrottle = func() {
+		cancel()
+		<-done
+	}
+	return nil
+}
+
+// throttleThreads returns parallelism of plugins of image, a single
+// plugin while scans are throttled
+func throttleThreads(threads int) int {
+	if scanThrottle == nil {
+		return threads
+	}
+	return scanThrottle.Threads(threads)
+}
+
+// acquireThrottle waits until an image may be scanned, release must be
+// called once the scan of image finishes
+func acquireThrottle(ctx context.Context) (func(), error) {
+	if scanThrottle == nil {
+		return func() {}, nil
+	}
+	release, wait, err := scanThrottle.Acquire(ctx)
+	if wait >= time.Second {
+		log.Debugf("Waited %s for throttled scans\n", wait.Round(time.Millisecond))
+	}
+	return release, err
+}
+
+// logThrottleStats stops sampling and records time and events of scans
+// throttled in report
+func logThrottleStats() {
+	stopThrottle()
+	if scanThrottle == nil {
+		return
+	}
+
+	stats := scanThrottle.Stats(time.Now())
+	if stats.Samples == 0 {
+		return
+	}
+	log.Infof("Throttle: %d samples, %d events, throttled for %s, images waited %s\n",
+		stats.Samples, len(stats.Events), stats.Throttled.Round(time.Second), stats.Waited.Round(time.Second))
+	runnerReporter.SetThrottleStats(stats)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().Duration("throttle-ping-latency", 0, "throttle scans to one image and plugin while the runtime daemon takes longer to answer a ping, 0 disables it")
+		c.Flags().Float64("throttle-load", 0, "throttle scans to one image and plugin while load average of host exceeds it, 0 disables it")
+		c.Flags().Duration("throttle-interval", 10*time.Second, "interval of sampling ping latency and load average, scans resume once samples stay below 80% of thresholds three times in a row")
+		c.Flags().Bool("nice", false, "conservative defaults for production hosts, i.e. --throttle-ping-latency 200ms, --throttle-load of 3/4 of cpus and --threads 2, flags given or of --profile override them")
+	}
+}
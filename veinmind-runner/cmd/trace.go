@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/trace"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+var runSpan *trace.Span
+
+// startTracing enables tracing when otel endpoint is specified and
+// starts the span of the whole run
+func startTracing(c *cobra.Command) error {
+	endpoint, _ := c.Flags().GetString("otel-endpoint")
+	if endpoint == "" {
+		return nil
+	}
+
+	if _, err := trace.Init(endpoint); err != nil {
+		return err
+	}
+
+	ctx, runSpan = trace.Start(ctx, "veinmind-runner "+c.Name())
+	return nil
+}
+
+// stopTracing ends the span of the whole run and exports pending spans
+func stopTracing(events int) {
+	runSpan.SetAttributes(trace.Int("events", int64(events)))
+	runSpan.End()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := trace.Shutdown(shutdownCtx); err != nil {
+		log.Warnf("Export trace error: %s\n", err.Error())
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().String("otel-endpoint", "", "OTLP/HTTP endpoint which spans of scan are exported to")
+}
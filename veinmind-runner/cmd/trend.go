@@ -0,0 +1,111 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/gate"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/history"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+// trendOptions is options of trend gate, nil if --trend-gate isn't set
+var trendOptions *gate.TrendOptions
+
+// newTrendOptions loads options of trend gate from flags
+func newTrendOptions(c *cobra.Command) (*gate.TrendOptions, error) {
+	db, _ := c.Flags().GetString("trend-gate")
+	if db == "" {
+		return nil, nil
+	}
+
+	opts := &gate.TrendOptions{}
+	opts.Window, _ = c.Flags().GetDuration("trend-window")
+	opts.Rules, _ = c.Flags().GetStringSlice("trend-rules")
+	if err := gate.CheckTrendRules(opts.Rules); err != nil {
+		return nil, err
+	}
+
+	level, _ := c.Flags().GetString("trend-level")
+	l, err := reporter.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	opts.Level = l
+
+	return opts, nil
+}
+
+// trendImages returns keys of images scanned, the same as keys of
+// events of images
+func trendImages(doc reporter.Report) []string {
+	images := []string{}
+	seen := map[string]struct{}{}
+	for _, c := range doc.Metadata.Coverage {
+		if _, ok := seen[c.ImageID]; ok || c.ImageID == "" {
+			continue
+		}
+		seen[c.ImageID] = struct{}{}
+
+		key := c.ImageID
+		if block := runnerReporter.Image(c.ImageID); block != nil && len(block.RepoRefs) > 0 {
+			key = block.RepoRefs[0]
+		}
+		images = append(images, key)
+	}
+	return images
+}
+
+// evaluateTrend compares images of doc against their baselines in
+// history of --trend-gate, comparisons are added to doc. Results of the
+// scan are appended to history with --trend-record
+func evaluateTrend(c *cobra.Command, doc *reporter.Report) (gate.Decision, error) {
+	db, _ := c.Flags().GetString("trend-gate")
+	store, err := history.Open(db)
+	if err != nil {
+		return gate.Decision{}, err
+	}
+	defer store.Close()
+
+	runs, err := store.Records()
+	if err != nil {
+		return gate.Decision{}, err
+	}
+
+	now := time.Now()
+	images := trendImages(*doc)
+	decision, trends := gate.EvaluateTrend(doc.Events, images, runs, now, gateOptions, *trendOptions)
+	doc.Metadata.Trends = trends
+	for _, t := range trends {
+		if t.Status == reporter.TrendNoBaseline {
+			log.Warnf("Image %#v has no baseline in %s, static threshold applies\n", t.Image, trendOptions.Window)
+		}
+	}
+
+	if record, _ := c.Flags().GetBool("trend-record"); record {
+		host, _ := os.Hostname()
+		if _, err := store.Append(history.Record{
+			Agent:  host,
+			Host:   host,
+			Seq:    uint64(now.UnixNano()),
+			Time:   now,
+			Events: doc.Events,
+			Images: images,
+		}); err != nil {
+			return gate.Decision{}, err
+		}
+	}
+
+	return decision, nil
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd} {
+		c.Flags().String("trend-gate", "", "history file whose runs are baselines of images, images regressing from their baselines fail the scan")
+		c.Flags().Duration("trend-window", 7*24*time.Hour, "how far back runs of history make baselines of trend gate")
+		c.Flags().StringSlice("trend-rules", gate.TrendRules, "rules of trend gate, count, new or score")
+		c.Flags().String("trend-level", "critical", "level of events counted by count rule of trend gate")
+		c.Flags().Bool("trend-record", false, "append results of the scan to history of trend gate")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/viewer"
+	"github.com/spf13/cobra"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var viewCmd = &cobra.Command{
+	Use:   "view <report>",
+	Short: "browse report in a web UI",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listen, _ := cmd.Flags().GetString("listen")
+		allowRemote, _ := cmd.Flags().GetBool("allow-remote")
+
+		if err := viewer.CheckListen(listen, allowRemote); err != nil {
+			return err
+		}
+
+		doc, err := reporter.Load(args[0])
+		if err != nil {
+			return err
+		}
+		v, err := viewer.New(doc)
+		if err != nil {
+			return err
+		}
+
+		serveCtx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		httpServer := &http.Server{
+			Addr:    listen,
+			Handler: v,
+		}
+		go func() {
+			<-serveCtx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			_ = httpServer.Shutdown(shutdownCtx)
+		}()
+
+		log.Infof("Viewing %d event(s) of %#v on http://%s\n", len(doc.Events), args[0], listen)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(viewCmd)
+	viewCmd.Flags().String("listen", "127.0.0.1:8080", "address of report viewer to listen on")
+	viewCmd.Flags().Bool("allow-remote", false, "allow listening on non-loopback address, the viewer has no authentication")
+}
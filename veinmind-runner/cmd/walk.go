@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/hash"
+	commonWalk "github.com/chaitin/veinmind-tools/veinmind-common/go/service/walk"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/walk"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// newImageWalk returns walk of image shared by plugins scanning it,
+// digests of files are shared with hash service
+func newImageWalk(image api.Image) *walk.Shared {
+	return walk.New(image.ID(), image, func(path string) (hash.Digest, error) {
+		return hashCache.Get(image.ID(), path, func(path string) (io.ReadCloser, error) {
+			return image.Open(path)
+		})
+	})
+}
+
+// recordImageWalk records walk of image in report if any plugin used
+// it, scan is wall time of scan of image
+func recordImageWalk(w *walk.Shared, scan time.Duration) {
+	if !w.Used() {
+		return
+	}
+
+	stat := w.Stat(scan)
+	log.Infof("Walk of image %#v is shared by %d plugin(s): %d entries walked in %s, %s of walks spared, scan took %s\n",
+		stat.ImageID, len(stat.Plugins), stat.Entries, stat.Walk.Round(time.Millisecond),
+		stat.Saved.Round(time.Millisecond), stat.Scan.Round(time.Millisecond))
+	runnerReporter.AddWalk(stat)
+}
+
+// pluginWalkService serves entries of the image scanned by a plugin
+// execution from the walk shared by plugins
+type pluginWalkService struct {
+	walk   *walk.Shared
+	plugin string
+	walked int32
+}
+
+func (s *pluginWalkService) Walk(req commonWalk.Request) (commonWalk.Page, error) {
+	atomic.StoreInt32(&s.walked, 1)
+	return s.walk.Page(s.plugin, req)
+}
+
+// MergedView reports whether plugin has walked merged filesystem of the
+// image, events of layer-local plugins walking it aren't cached per layer
+func (s *pluginWalkService) MergedView() bool {
+	return atomic.LoadInt32(&s.walked) == 1
+}
+
+func (s *pluginWalkService) Add(registry *service.Registry) {
+	registry.Define(commonWalk.Namespace, struct{}{})
+	registry.AddService(commonWalk.Namespace, "walk", s.Walk)
+}
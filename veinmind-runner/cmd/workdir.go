@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/pluginlog"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/runner"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// configurePluginExec sets working directory, extra environment
+// variables, diagnostics, output and event limits of plugin executions
+// of runner
+func configurePluginExec(c *cobra.Command, r *runner.Runner) error {
+	// Output of plugins goes to stderr so that reports rendered to
+	// stdout aren't mixed with it
+	groupLogs, _ := c.Flags().GetBool("group-logs")
+	r.Output = pluginlog.New(os.Stderr, groupLogs)
+
+	values, err := c.Flags().GetStringArray("plugin-env")
+	if err != nil {
+		return nil
+	}
+
+	env, err := runner.ParsePluginEnv(values)
+	if err != nil {
+		return err
+	}
+	r.PluginEnv = env
+	r.WorkDir, _ = c.Flags().GetString("work-dir")
+	r.KeepFailedWorkDirs, _ = c.Flags().GetBool("keep-failed-workdirs")
+	r.DiagnosticsDir, _ = c.Flags().GetString("diagnostics-dir")
+	r.DiagnosticsKeep, _ = c.Flags().GetInt("diagnostics-keep")
+
+	limits, _ := c.Flags().GetStringArray("max-events-per-plugin")
+	r.EventLimits, err = runner.ParseEventLimits(limits)
+	return err
+}
+
+func init() {
+	for _, c := range []*cobra.Command{scanHostCmd, scanRegistryCmd, scanManifestCmd, rescanCmd, compareCmd, agentCmd} {
+		c.Flags().String("work-dir", "", "directory where working directories of plugins are created, temporary directory by default")
+		c.Flags().Bool("keep-failed-workdirs", false, "keep working directories of failed plugins for debugging")
+		c.Flags().String("diagnostics-dir", "", "directory where diagnostics bundles of plugins exiting abnormally are written, veinmind-diagnostics under work dir by default")
+		c.Flags().Int("diagnostics-keep", runner.DefaultDiagnosticsKeep, "number of latest diagnostics bundles kept")
+		c.Flags().StringArray("plugin-env", nil, "extra environment variable of plugin, in the form of name=KEY=VALUE")
+		c.Flags().Bool("group-logs", false, "print output of each plugin execution as a contiguous block after it finishes")
+		c.Flags().StringArray("max-events-per-plugin", nil, "max events kept of a plugin per image in the form of name=N, a bare N is the default of all plugins, the most severe are kept and the rest are collapsed")
+	}
+}
+
+// flushPluginOutput writes output of plugins held back and closes it,
+// it's called before reports are rendered
+func flushPluginOutput(r *runner.Runner) {
+	if r.Output != nil {
+		r.Output.Close()
+	}
+}
@@ -2,6 +2,8 @@ module github.com/chaitin/veinmind-tools/veinmind-runner
 
 go 1.16
 
+replace github.com/chaitin/veinmind-tools/veinmind-common/go => ../veinmind-common/go
+
 require (
 	github.com/chaitin/veinmind-tools/veinmind-common/go v0.0.0-20220526023645-674f9dea184f
 	github.com/BurntSushi/toml v0.3.1
@@ -15,10 +17,16 @@ require (
 	github.com/fvbommel/sortorder v1.0.2 // indirect
 	github.com/google/go-containerregistry v0.8.0
 	github.com/moby/sys/mount v0.3.1 // indirect
-	github.com/moby/term v0.0.0-20210619224110-3f7ff695adc6 // indirect
+	github.com/moby/term v0.0.0-20210619224110-3f7ff695adc6
+	github.com/opencontainers/go-digest v1.0.0
+	github.com/opencontainers/image-spec v1.0.3-0.20211202183452-c5a74bcca799
 	github.com/pkg/errors v0.9.1
 	github.com/spf13/cobra v1.3.0
+	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.7.0
 	github.com/theupdateframework/notary v0.7.0 // indirect
+	github.com/vbatts/tar-split v0.11.2
+	google.golang.org/grpc v1.43.0
+	gopkg.in/yaml.v2 v2.4.0
 	gotest.tools/v3 v3.1.0 // indirect
 )
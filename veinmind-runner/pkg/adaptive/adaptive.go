@@ -0,0 +1,152 @@
+// Package adaptive picks parallelism of plugins per image from its size
+// and number of layers, and limits aggregate size of images scanned at
+// once by a memory budget. Small images gain little from many plugins
+// executed in parallel, while plugins of huge images starve each other
+package adaptive
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Breakpoint applies to images of at most Size bytes and Layers
+// layers, 0 is unbounded
+type Breakpoint struct {
+	Size    int64 `json:"size"`
+	Layers  int   `json:"layers"`
+	Threads int   `json:"threads"`
+}
+
+// Default is breakpoints of small images, of images of average size and
+// of huge images
+var Default = []Breakpoint{
+	{Size: 200 << 20, Layers: 10, Threads: 2},
+	{Size: 2 << 30, Layers: 50, Threads: 5},
+	{Threads: 3},
+}
+
+// ParseBreakpoint parses breakpoint in form of size:layers:threads,
+// e.g. 209715200:10:2
+func ParseBreakpoint(s string) (Breakpoint, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return Breakpoint{}, errors.Errorf("breakpoint %#v isn't in form of size:layers:threads", s)
+	}
+	size, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || size < 0 {
+		return Breakpoint{}, errors.Errorf("breakpoint %#v: invalid size %#v", s, parts[0])
+	}
+	layers, err := strconv.Atoi(parts[1])
+	if err != nil || layers < 0 {
+		return Breakpoint{}, errors.Errorf("breakpoint %#v: invalid layers %#v", s, parts[1])
+	}
+	threads, err := strconv.Atoi(parts[2])
+	if err != nil || threads <= 0 {
+		return Breakpoint{}, errors.Errorf("breakpoint %#v: invalid threads %#v", s, parts[2])
+	}
+	return Breakpoint{Size: size, Layers: layers, Threads: threads}, nil
+}
+
+// Threads picks parallelism of plugins by breakpoints, the first
+// breakpoint an image fits in applies. Images fitting in none get
+// threads of the last breakpoint
+type Threads struct {
+	breakpoints []Breakpoint
+}
+
+// New returns threads picked by breakpoints
+func New(breakpoints []Breakpoint) (*Threads, error) {
+	if len(breakpoints) == 0 {
+		return nil, errors.New("no breakpoint of adaptive threads")
+	}
+	for _, b := range breakpoints {
+		if b.Threads <= 0 {
+			return nil, errors.Errorf("breakpoint %+v: threads must be positive", b)
+		}
+	}
+	return &Threads{breakpoints: breakpoints}, nil
+}
+
+// Pick returns parallelism of plugins of image of size bytes and layers
+func (t *Threads) Pick(size int64, layers int) int {
+	for _, b := range t.breakpoints {
+		if (b.Size == 0 || size <= b.Size) && (b.Layers == 0 || layers <= b.Layers) {
+			return b.Threads
+		}
+	}
+	return t.breakpoints[len(t.breakpoints)-1].Threads
+}
+
+// Choice is parallelism picked for image, Wait is time image waited
+// for memory budget and Scan is wall time of its scan
+type Choice struct {
+	ImageID string        `json:"image_id"`
+	Size    int64         `json:"size"`
+	Layers  int           `json:"layers"`
+	Threads int           `json:"threads"`
+	Wait    time.Duration `json:"wait"`
+	Scan    time.Duration `json:"scan"`
+}
+
+// Budget limits aggregate size of images scanned at once, which lowers
+// concurrency of images when huge images are in flight
+type Budget struct {
+	limit    int64
+	mu       sync.Mutex
+	inflight int64
+	running  int
+	changed  chan struct{}
+}
+
+// NewBudget returns budget of limit bytes
+func NewBudget(limit int64) *Budget {
+	return &Budget{limit: limit, changed: make(chan struct{})}
+}
+
+// Acquire waits until image of size fits in budget along images in
+// flight, an image over budget is scanned once no other image is.
+// Release must be called once scan of image finishes, time waited is
+// returned
+func (b *Budget) Acquire(ctx context.Context, size int64) (func(), time.Duration, error) {
+	start := time.Now()
+	for {
+		b.mu.Lock()
+		if b.running == 0 || b.inflight+size <= b.limit {
+			b.inflight += size
+			b.running++
+			b.mu.Unlock()
+			break
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, time.Since(start), ctx.Err()
+		}
+	}
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.inflight -= size
+			b.running--
+			close(b.changed)
+			b.changed = make(chan struct{})
+		})
+	}, time.Since(start), nil
+}
+
+// InFlight returns aggregate size and number of images in flight
+func (b *Budget) InFlight() (int64, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.inflight, b.running
+}
@@ -0,0 +1,91 @@
+package adaptive
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPick(t *testing.T) {
+	threads, err := New(Default)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, threads.Pick(50<<20, 5))
+	// Many layers make a small image an average one
+	assert.Equal(t, 5, threads.Pick(50<<20, 20))
+	assert.Equal(t, 5, threads.Pick(1<<30, 20))
+	assert.Equal(t, 3, threads.Pick(10<<30, 20))
+	assert.Equal(t, 3, threads.Pick(1<<30, 100))
+
+	threads, err = New([]Breakpoint{{Size: 100, Threads: 1}, {Size: 1000, Threads: 4}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, threads.Pick(100, 1000))
+	assert.Equal(t, 4, threads.Pick(5000, 1))
+
+	_, err = New(nil)
+	assert.Error(t, err)
+}
+
+func TestParseBreakpoint(t *testing.T) {
+	b, err := ParseBreakpoint("209715200:10:2")
+	assert.NoError(t, err)
+	assert.Equal(t, Breakpoint{Size: 200 << 20, Layers: 10, Threads: 2}, b)
+	b, err = ParseBreakpoint("0:0:3")
+	assert.NoError(t, err)
+	assert.Equal(t, Breakpoint{Threads: 3}, b)
+
+	for _, s := range []string{"", "1:2", "a:1:1", "1:-1:1", "1:1:0"} {
+		_, err := ParseBreakpoint(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	b := NewBudget(100)
+
+	var (
+		mu   sync.Mutex
+		peak int64
+	)
+	wg := sync.WaitGroup{}
+	for _, size := range []int64{60, 60, 30, 10, 150} {
+		wg.Add(1)
+		go func(size int64) {
+			defer wg.Done()
+			release, _, err := b.Acquire(context.Background(), size)
+			assert.NoError(t, err)
+			inflight, running := b.InFlight()
+			mu.Lock()
+			// An image over budget is scanned alone
+			if running > 1 && inflight > peak {
+				peak = inflight
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			release()
+		}(size)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, peak, int64(100))
+	inflight, running := b.InFlight()
+	assert.Equal(t, int64(0), inflight)
+	assert.Equal(t, 0, running)
+}
+
+func TestBudgetCancel(t *testing.T) {
+	b := NewBudget(100)
+	release, _, err := b.Acquire(context.Background(), 80)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, wait, err := b.Acquire(ctx, 80)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, wait >= 10*time.Millisecond)
+
+	release()
+	release, _, err = b.Acquire(context.Background(), 80)
+	assert.NoError(t, err)
+	release()
+}
@@ -0,0 +1,212 @@
+// Package allowlist provides trusted images which are exempted
+// from policy enforcement of veinmind-runner
+package allowlist
+
+import (
+	"crypto"
+	"github.com/BurntSushi/toml"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/cosign"
+	"github.com/distribution/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	digestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+	globRegexp   = regexp.MustCompile(`\[[^\]]*\]|[*?]`)
+)
+
+// Image is the part of api.Image which allowlist relies on
+type Image interface {
+	ID() string
+	RepoRefs() ([]string, error)
+}
+
+// Verifier checks whether ref is signed by key
+type Verifier func(ref name.Digest, key crypto.PublicKey) error
+
+type Entry struct {
+	Ref       string `toml:"ref"`
+	Digest    string `toml:"digest"`
+	CosignKey string `toml:"cosign_key"`
+	Comment   string `toml:"comment"`
+
+	key crypto.PublicKey
+}
+
+type Allowlist struct {
+	Entries []Entry `toml:"entries"`
+
+	verifier Verifier
+}
+
+type Option func(a *Allowlist)
+
+// WithVerifier specifies how entries with cosign key are verified
+func WithVerifier(verifier Verifier) Option {
+	return func(a *Allowlist) {
+		a.verifier = verifier
+	}
+}
+
+// Parse parse allowlist content, every entry is validated so that
+// malformed entries fail here rather than never match
+func Parse(content string, opts ...Option) (*Allowlist, error) {
+	a := &Allowlist{}
+	meta, err := toml.Decode(content, a)
+	if err != nil {
+		return nil, err
+	}
+
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, errors.Errorf("allowlist: unknown key %#v", undecoded[0].String())
+	}
+
+	for i := range a.Entries {
+		if err := a.Entries[i].validate(); err != nil {
+			return nil, errors.Wrapf(err, "allowlist: entry %d", i)
+		}
+	}
+
+	a.verifier = func(ref name.Digest, key crypto.PublicKey) error {
+		_, err := cosign.VerifyWithKey(ref, key)
+		return err
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a, nil
+}
+
+func (e *Entry) validate() error {
+	switch {
+	case e.Ref == "" && e.Digest == "":
+		return errors.New("either ref or digest must be specified")
+	case e.Ref != "" && e.Digest != "":
+		return errors.New("ref and digest can't be specified together")
+	}
+
+	if e.Digest != "" && !digestRegexp.MatchString(e.Digest) {
+		return errors.Errorf("digest %#v is not a sha256 digest", e.Digest)
+	}
+
+	if e.Ref != "" {
+		if _, err := path.Match(e.Ref, ""); err != nil {
+			return errors.Errorf("ref %#v is not a valid glob", e.Ref)
+		}
+
+		// Replace wildcards so that the rest of ref can be checked
+		// by reference grammar
+		if _, err := reference.ParseNormalizedNamed(globRegexp.ReplaceAllString(e.Ref, "x")); err != nil {
+			return errors.Wrapf(err, "ref %#v", e.Ref)
+		}
+
+		if !globRegexp.MatchString(e.Ref) {
+			named, err := reference.ParseDockerRef(e.Ref)
+			if err != nil {
+				return errors.Wrapf(err, "ref %#v", e.Ref)
+			}
+			e.Ref = named.String()
+		}
+	}
+
+	if e.CosignKey != "" {
+		key, err := cosign.LoadPublicKey(e.CosignKey)
+		if err != nil {
+			return err
+		}
+		e.key = key
+	}
+
+	return nil
+}
+
+// Match returns the first entry which matches image
+func (a *Allowlist) Match(image Image) (*Entry, bool) {
+	if a == nil {
+		return nil, false
+	}
+
+	refs, err := image.RepoRefs()
+	if err != nil {
+		refs = []string{}
+	}
+
+	for i := range a.Entries {
+		e := &a.Entries[i]
+		if !e.match(image.ID(), refs) {
+			continue
+		}
+
+		if e.key != nil && !a.verified(e, refs) {
+			continue
+		}
+
+		return e, true
+	}
+
+	return nil, false
+}
+
+func (e *Entry) match(id string, refs []string) bool {
+	if e.Digest != "" {
+		if strings.HasSuffix(id, e.Digest) {
+			return true
+		}
+
+		for _, r := range refs {
+			if strings.HasSuffix(r, "@"+e.Digest) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, r := range refs {
+		candidates := []string{r}
+		if named, err := reference.ParseDockerRef(r); err == nil {
+			candidates = append(candidates, named.String())
+		}
+
+		for _, c := range candidates {
+			if ok, _ := path.Match(e.Ref, c); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// verified checks signature of any repo digest of image
+func (a *Allowlist) verified(e *Entry, refs []string) bool {
+	for _, r := range refs {
+		if !strings.Contains(r, "@") {
+			continue
+		}
+
+		digest, err := name.NewDigest(r)
+		if err != nil {
+			continue
+		}
+
+		if err := a.verifier(digest, e.key); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *Entry) String() string {
+	if e.Ref != "" {
+		return e.Ref
+	}
+
+	return e.Digest
+}
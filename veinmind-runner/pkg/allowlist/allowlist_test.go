@@ -0,0 +1,117 @@
+package allowlist
+
+import (
+	"crypto"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type fakeImage struct {
+	id   string
+	refs []string
+}
+
+func (i fakeImage) ID() string {
+	return i.id
+}
+
+func (i fakeImage) RepoRefs() ([]string, error) {
+	return i.refs, nil
+}
+
+const digest = "sha256:3f2a9c0b1d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8"
+
+func TestParseAllowlist(t *testing.T) {
+	content := `[[entries]]
+	ref = "registry.internal/base/*:stable"
+	[[entries]]
+	ref = "nginx"
+	[[entries]]
+	digest = "` + digest + `"
+	comment = "pinned"
+	`
+	a, err := Parse(content)
+	assert.NoError(t, err)
+	assert.Len(t, a.Entries, 3)
+	assert.Equal(t, "docker.io/library/nginx:latest", a.Entries[1].Ref)
+}
+
+func TestParseAllowlistMalformed(t *testing.T) {
+	cases := []string{
+		`[[entries]]
+		comment = "neither ref nor digest"`,
+		`[[entries]]
+		ref = "nginx"
+		digest = "` + digest + `"`,
+		`[[entries]]
+		digest = "sha256:1234"`,
+		`[[entries]]
+		ref = "registry.internal/base/[a-"`,
+		`[[entries]]
+		ref = "Registry Internal/base/*"`,
+		`[[entries]]
+		refs = "nginx"`,
+		`[[entries]]
+		ref = "nginx"
+		cosign_key = "awskms://alias/cosign"`,
+	}
+
+	for _, c := range cases {
+		_, err := Parse(c)
+		assert.Error(t, err, c)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	content := `[[entries]]
+	ref = "registry.internal/base/*:stable"
+	[[entries]]
+	ref = "nginx:1.21"
+	[[entries]]
+	digest = "` + digest + `"
+	`
+	a, err := Parse(content)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		image fakeImage
+		match bool
+	}{
+		{fakeImage{id: "sha256:aa", refs: []string{"registry.internal/base/alpine:stable"}}, true},
+		{fakeImage{id: "sha256:aa", refs: []string{"registry.internal/base/alpine:latest"}}, false},
+		{fakeImage{id: "sha256:aa", refs: []string{"registry.internal/base/team/alpine:stable"}}, false},
+		{fakeImage{id: "sha256:aa", refs: []string{"nginx:1.21"}}, true},
+		{fakeImage{id: "sha256:aa", refs: []string{"docker.io/library/nginx:1.21"}}, true},
+		{fakeImage{id: digest, refs: []string{}}, true},
+		{fakeImage{id: "veinmind-runner/" + digest, refs: []string{}}, true},
+		{fakeImage{id: "sha256:aa", refs: []string{"app@" + digest}}, true},
+		{fakeImage{id: "sha256:aa", refs: []string{"app:latest"}}, false},
+	}
+
+	for _, c := range cases {
+		_, ok := a.Match(c.image)
+		assert.Equal(t, c.match, ok, c.image.refs)
+	}
+}
+
+func TestMatchVerified(t *testing.T) {
+	a, err := Parse(`[[entries]]
+	ref = "registry.internal/base/*"
+	`, WithVerifier(func(ref name.Digest, key crypto.PublicKey) error {
+		return nil
+	}))
+	assert.NoError(t, err)
+
+	// Pretend the entry requires a signature
+	a.Entries[0].key = struct{}{}
+
+	_, ok := a.Match(fakeImage{id: "sha256:aa", refs: []string{"registry.internal/base/alpine:stable"}})
+	assert.False(t, ok)
+
+	_, ok = a.Match(fakeImage{id: "sha256:aa", refs: []string{
+		"registry.internal/base/alpine:stable",
+		"registry.internal/base/alpine@" + digest,
+	}})
+	assert.True(t, ok)
+}
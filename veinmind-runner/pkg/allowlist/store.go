@@ -0,0 +1,114 @@
+package allowlist
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Store holds the allowlist loaded from file, it can be reloaded
+// during long-running modes
+type Store struct {
+	path    string
+	opts    []Option
+	mu      sync.RWMutex
+	list    *Allowlist
+	modTime time.Time
+}
+
+// NewStore load allowlist from path, error is returned if any entry
+// of the file is malformed
+func NewStore(path string, opts ...Option) (*Store, error) {
+	s := &Store{
+		path: path,
+		opts: opts,
+	}
+
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Load returns the current allowlist
+func (s *Store) Load() *Allowlist {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.list
+}
+
+// Match matches image against the current allowlist
+func (s *Store) Match(image Image) (*Entry, bool) {
+	return s.Load().Match(image)
+}
+
+// Reload load allowlist from file again, the previous allowlist
+// is kept when the file is malformed
+func (s *Store) Reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	list, err := Parse(string(content), s.opts...)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.list = list
+	s.modTime = info.ModTime()
+
+	return nil
+}
+
+// Watch reload allowlist whenever the file is modified, it returns
+// after ctx is done
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(s.path)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+
+			s.mu.RLock()
+			modified := !info.ModTime().Equal(s.modTime)
+			s.mu.RUnlock()
+			if !modified {
+				continue
+			}
+
+			if err := s.Reload(); err != nil {
+				// Don't retry until the file is modified again
+				s.mu.Lock()
+				s.modTime = info.ModTime()
+				s.mu.Unlock()
+				log.Errorf("Reload allowlist error, keep previous one: %s\n", err.Error())
+			} else {
+				log.Infof("Reload allowlist success: %#v\n", s.path)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package allowlist
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allowlist")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "allowlist.toml")
+	modified := time.Now()
+	write := func(content string) {
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		// Modification time changes even within its granularity
+		modified = modified.Add(time.Second)
+		require.NoError(t, os.Chtimes(path, modified, modified))
+	}
+	write("[[entries]]\nref = \"nginx\"\n")
+
+	s, err := NewStore(path)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Watch(ctx, 10*time.Millisecond)
+
+	nginx := fakeImage{id: "sha256:aa", refs: []string{"nginx:latest"}}
+	redis := fakeImage{id: "sha256:bb", refs: []string{"redis:latest"}}
+	_, ok := s.Match(nginx)
+	assert.True(t, ok)
+
+	write("[[entries]]\nref = \"redis\"\n")
+	assert.Eventually(t, func() bool {
+		_, ok := s.Match(redis)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	_, ok = s.Match(nginx)
+	assert.False(t, ok)
+
+	// Malformed rewrite keeps the previous allowlist
+	write("[[entries]]\ncomment = \"neither ref nor digest\"\n")
+	assert.Eventually(t, func() bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.modTime.Equal(modified)
+	}, 5*time.Second, 10*time.Millisecond)
+	_, ok = s.Match(redis)
+	assert.True(t, ok)
+}
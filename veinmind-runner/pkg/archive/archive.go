@@ -0,0 +1,326 @@
+// Package archive walks archives within images for archive service of
+// plugins, nested archives are walked under limits shared by all
+// plugins of an image, so that archive bombs can't exhaust the host
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	commonArchive "github.com/chaitin/veinmind-tools/veinmind-common/go/service/archive"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Names of limits
+const (
+	LimitSize  = "size"
+	LimitDepth = "depth"
+	LimitFiles = "files"
+)
+
+var (
+	ErrNotArchive     = errors.New("archive: not an archive")
+	ErrMemberNotFound = errors.New("archive: member not found")
+	// errFound stops walk once member extracted is found
+	errFound = errors.New("archive: member found")
+)
+
+// LimitError is returned when walking archive trips a limit, Archive
+// is the archive or member being walked
+type LimitError struct {
+	Limit   string
+	Max     int64
+	Archive string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("archive: %s limit %d exceeded at %s", e.Limit, e.Max, e.Archive)
+}
+
+// ServiceLimit returns the limit tripped as told to plugins
+func (e *LimitError) ServiceLimit() *commonArchive.Limit {
+	return &commonArchive.Limit{Name: e.Limit, Max: e.Max, Archive: e.Archive}
+}
+
+// Limits of archives of an image, zero means unlimited
+type Limits struct {
+	// MaxSize is total bytes decompressed
+	MaxSize int64
+	// MaxDepth is nesting depth, each archive or compression layer is
+	// a level and the archive in image is of depth 1
+	MaxDepth int
+	// MaxFiles is total number of members
+	MaxFiles int64
+}
+
+var DefaultLimits = Limits{
+	MaxSize:  256 << 20,
+	MaxDepth: 5,
+	MaxFiles: 10000,
+}
+
+// Budget is limits of an image consumed by walks of its archives, a
+// limit once tripped fails the following walks too
+type Budget struct {
+	limits Limits
+	mu     sync.Mutex
+	size   int64
+	files  int64
+}
+
+func NewBudget(limits Limits) *Budget {
+	return &Budget{limits: limits}
+}
+
+func (b *Budget) charge(size int64, files int64, archive string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.size += size
+	b.files += files
+	if b.limits.MaxSize > 0 && b.size > b.limits.MaxSize {
+		return &LimitError{Limit: LimitSize, Max: b.limits.MaxSize, Archive: archive}
+	}
+	if b.limits.MaxFiles > 0 && b.files > b.limits.MaxFiles {
+		return &LimitError{Limit: LimitFiles, Max: b.limits.MaxFiles, Archive: archive}
+	}
+	return nil
+}
+
+// chargedReader charges bytes decompressed from r to budget
+type chargedReader struct {
+	r       io.Reader
+	budget  *Budget
+	archive string
+}
+
+func (c *chargedReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		if cerr := c.budget.charge(int64(n), 0, c.archive); cerr != nil {
+			return n, cerr
+		}
+	}
+	return n, err
+}
+
+type format int
+
+const (
+	formatNone format = iota
+	formatTar
+	formatZip
+	formatGzip
+)
+
+// detect detects format of archive by magic bytes
+func detect(r *bufio.Reader) format {
+	b, _ := r.Peek(262)
+	switch {
+	case bytes.HasPrefix(b, []byte("PK\x03\x04")), bytes.HasPrefix(b, []byte("PK\x05\x06")):
+		return formatZip
+	case bytes.HasPrefix(b, []byte{0x1f, 0x8b}):
+		return formatGzip
+	case len(b) >= 262 && string(b[257:262]) == "ustar":
+		return formatTar
+	}
+	return formatNone
+}
+
+// Visit is called with each member walked, content of archive members
+// is walked after visit and is nil
+type Visit func(m commonArchive.Member, content io.Reader) error
+
+// Walk walks members of archive name with content r, members of nested
+// archives are walked within limits. ErrNotArchive is returned if r
+// isn't an archive, and LimitError once a limit trips
+func (b *Budget) Walk(name string, r io.Reader, visit Visit) error {
+	br := bufio.NewReader(r)
+	if detect(br) == formatNone {
+		return ErrNotArchive
+	}
+	return b.walk(name, br, 1, visit)
+}
+
+func (b *Budget) walk(name string, r *bufio.Reader, depth int, visit Visit) error {
+	if b.limits.MaxDepth > 0 && depth > b.limits.MaxDepth {
+		return &LimitError{Limit: LimitDepth, Max: int64(b.limits.MaxDepth), Archive: name}
+	}
+
+	switch detect(r) {
+	case formatTar:
+		return b.walkTar(name, r, depth, visit)
+	case formatZip:
+		return b.walkZip(name, r, depth, visit)
+	case formatGzip:
+		return b.walkGzip(name, r, depth, visit)
+	}
+	return ErrNotArchive
+}
+
+// member visits member of archive, nested archives are walked after
+func (b *Budget) member(m commonArchive.Member, content io.Reader, visit Visit) error {
+	if m.Dir {
+		return visit(m, nil)
+	}
+
+	br := bufio.NewReader(content)
+	if detect(br) == formatNone {
+		return visit(m, br)
+	}
+
+	m.Archive = true
+	if err := visit(m, nil); err != nil {
+		return err
+	}
+	return b.walk(m.Path, br, m.Depth+1, visit)
+}
+
+func (b *Budget) walkTar(name string, r io.Reader, depth int, visit Visit) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		p := name + commonArchive.Separator + strings.TrimPrefix(hdr.Name, "/")
+		if err := b.charge(0, 1, p); err != nil {
+			return err
+		}
+		m := commonArchive.Member{
+			Path:  p,
+			Size:  hdr.Size,
+			Dir:   hdr.Typeflag == tar.TypeDir,
+			Depth: depth,
+		}
+		if !m.Dir && hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := b.member(m, tr, visit); err != nil {
+			return err
+		}
+	}
+}
+
+// walkZip walks zip archive, which is read into memory as it's read
+// at random. Compressed size of nested zip archives is charged as they
+// are decompressed from their parents, that of the outermost is charged
+// as it's read
+func (b *Budget) walkZip(name string, r io.Reader, depth int, visit Visit) error {
+	if depth == 1 {
+		r = &chargedReader{r: r, budget: b, archive: name}
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		p := name + commonArchive.Separator + strings.TrimPrefix(f.Name, "/")
+		if err := b.charge(0, 1, p); err != nil {
+			return err
+		}
+		m := commonArchive.Member{
+			Path:  p,
+			Size:  int64(f.UncompressedSize64),
+			Dir:   f.FileInfo().IsDir(),
+			Depth: depth,
+		}
+		if m.Dir {
+			if err := visit(m, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = b.member(m, &chargedReader{r: rc, budget: b, archive: p}, visit)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkGzip walks content of gzip, a compressed archive is walked as a
+// nested archive and other content is the only member
+func (b *Budget) walkGzip(name string, r io.Reader, depth int, visit Visit) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	content := bufio.NewReader(&chargedReader{r: gr, budget: b, archive: name})
+	if detect(content) != formatNone {
+		return b.walk(name, content, depth+1, visit)
+	}
+
+	p := name + commonArchive.Separator + strings.TrimSuffix(path.Base(name), ".gz")
+	if err := b.charge(0, 1, p); err != nil {
+		return err
+	}
+	return visit(commonArchive.Member{Path: p, Depth: depth}, content)
+}
+
+// List returns members of archive walked before error
+func (b *Budget) List(name string, r io.Reader) ([]commonArchive.Member, error) {
+	members := []commonArchive.Member{}
+	err := b.Walk(name, r, func(m commonArchive.Member, content io.Reader) error {
+		members = append(members, m)
+		return nil
+	})
+	return members, err
+}
+
+// Extract returns content of member of archive, member is path within
+// archive joined by separator for members of nested archives. Content
+// of archive members isn't extracted, which is walked instead
+func (b *Budget) Extract(name string, r io.Reader, member string) (commonArchive.Member, []byte, error) {
+	target := name + commonArchive.Separator + strings.TrimPrefix(member, "/")
+
+	var (
+		found   commonArchive.Member
+		content []byte
+	)
+	err := b.Walk(name, r, func(m commonArchive.Member, c io.Reader) error {
+		if m.Path != target {
+			return nil
+		}
+		found = m
+		if c != nil {
+			var err error
+			if content, err = ioutil.ReadAll(c); err != nil {
+				return err
+			}
+		}
+		return errFound
+	})
+	switch err {
+	case errFound:
+		return found, content, nil
+	case nil:
+		return found, nil, errors.Wrapf(ErrMemberNotFound, "%s", target)
+	}
+	return found, nil, err
+}
@@ -0,0 +1,180 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	commonArchive "github.com/chaitin/veinmind-tools/veinmind-common/go/service/archive"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+type file struct {
+	name    string
+	content []byte
+}
+
+func tarOf(t *testing.T, files ...file) []byte {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, f := range files {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content))}))
+		_, err := tw.Write(f.content)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func zipOf(t *testing.T, files ...file) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		assert.NoError(t, err)
+		_, err = w.Write(f.content)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func gzipOf(t *testing.T, content []byte) []byte {
+	buf := &bytes.Buffer{}
+	gw, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	assert.NoError(t, err)
+	_, err = gw.Write(content)
+	assert.NoError(t, err)
+	assert.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+// zerosReader yields n zeros without holding them in memory
+func zerosReader(n int64) io.Reader {
+	return io.LimitReader(zeros{}, n)
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestListNested(t *testing.T) {
+	jar := zipOf(t,
+		file{"META-INF/MANIFEST.MF", []byte("Main-Class: App\n")},
+		file{"App.class", []byte{0xca, 0xfe, 0xba, 0xbe}},
+	)
+	layer := gzipOf(t, tarOf(t,
+		file{"app/lib.jar", jar},
+		file{"app/README", []byte("readme")},
+	))
+
+	b := NewBudget(DefaultLimits)
+	members, err := b.List("/opt/app.tar.gz", bytes.NewReader(layer))
+	assert.NoError(t, err)
+
+	paths := []string{}
+	for _, m := range members {
+		paths = append(paths, fmt.Sprintf("%d %s %v", m.Depth, m.Path, m.Archive))
+	}
+	assert.Equal(t, []string{
+		"2 /opt/app.tar.gz!/app/lib.jar true",
+		"3 /opt/app.tar.gz!/app/lib.jar!/META-INF/MANIFEST.MF false",
+		"3 /opt/app.tar.gz!/app/lib.jar!/App.class false",
+		"2 /opt/app.tar.gz!/app/README false",
+	}, paths)
+
+	m, content, err := b.Extract("/opt/app.tar.gz", bytes.NewReader(layer), "app/lib.jar!/META-INF/MANIFEST.MF")
+	assert.NoError(t, err)
+	assert.Equal(t, "Main-Class: App\n", string(content))
+	assert.Equal(t, int64(16), m.Size)
+
+	_, _, err = b.Extract("/opt/app.tar.gz", bytes.NewReader(layer), "app/missing")
+	assert.True(t, errors.Is(err, ErrMemberNotFound))
+
+	err = b.Walk("/etc/passwd", bytes.NewReader([]byte("root:x:0:0")), func(commonArchive.Member, io.Reader) error {
+		return nil
+	})
+	assert.Equal(t, ErrNotArchive, err)
+}
+
+// TestBombs walks crafted archive bombs, each is contained by a limit
+// before it's decompressed in full
+func TestBombs(t *testing.T) {
+	// 256 MiB of zeros compressed into about 256 KiB
+	buf := &bytes.Buffer{}
+	gw, _ := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	_, err := io.Copy(gw, zerosReader(256<<20))
+	assert.NoError(t, err)
+	assert.NoError(t, gw.Close())
+	sizeBomb := buf.Bytes()
+	assert.Less(t, len(sizeBomb), 1<<20)
+
+	// Gzip nested in gzip over and over, like a quine
+	depthBomb := []byte("payload")
+	for i := 0; i < 10; i++ {
+		depthBomb = gzipOf(t, depthBomb)
+	}
+
+	// Zip of zips of many small files
+	entries := []file{}
+	for i := 0; i < 100; i++ {
+		entries = append(entries, file{fmt.Sprintf("f%d", i), []byte("x")})
+	}
+	inner := zipOf(t, entries...)
+	filesBomb := zipOf(t, file{"a.zip", inner}, file{"b.zip", inner}, file{"c.zip", inner})
+
+	limits := Limits{MaxSize: 16 << 20, MaxDepth: 5, MaxFiles: 200}
+	cases := []struct {
+		name    string
+		content []byte
+		limit   string
+		archive string
+	}{
+		{"/bomb.gz", sizeBomb, LimitSize, "/bomb.gz"},
+		{"/quine.gz", depthBomb, LimitDepth, "/quine.gz"},
+		{"/files.zip", filesBomb, LimitFiles, "/files.zip!/b.zip!/f98"},
+	}
+	for _, c := range cases {
+		b := NewBudget(limits)
+		err := b.Walk(c.name, bytes.NewReader(c.content), func(m commonArchive.Member, r io.Reader) error {
+			if r != nil {
+				_, err := io.Copy(ioutil.Discard, r)
+				return err
+			}
+			return nil
+		})
+
+		var le *LimitError
+		if assert.True(t, errors.As(err, &le), c.name) {
+			assert.Equal(t, c.limit, le.Limit, c.name)
+			assert.Equal(t, c.archive, le.Archive, c.name)
+		}
+		assert.LessOrEqual(t, b.size, limits.MaxSize+64<<10, c.name)
+	}
+}
+
+func TestBudgetShared(t *testing.T) {
+	content := tarOf(t, file{"a", []byte("a")}, file{"b", []byte("b")})
+	b := NewBudget(Limits{MaxFiles: 3})
+
+	members, err := b.List("/one.tar", bytes.NewReader(content))
+	assert.NoError(t, err)
+	assert.Len(t, members, 2)
+
+	// Limits are of the image, not of the walk
+	members, err = b.List("/two.tar", bytes.NewReader(content))
+	assert.Len(t, members, 1)
+	var le *LimitError
+	assert.True(t, errors.As(err, &le))
+	assert.Equal(t, &commonArchive.Limit{Name: LimitFiles, Max: 3, Archive: "/two.tar!/b"}, le.ServiceLimit())
+}
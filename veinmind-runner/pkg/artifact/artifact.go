@@ -0,0 +1,157 @@
+// Package artifact stores artifacts registered by plugins under
+// <dir>/<image digest>/<event id>/<name>
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	digestRegexp = regexp.MustCompile(`^(sha256:)?[a-f0-9]{64}$`)
+	nameRegexp   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+var (
+	ErrTooLarge      = errors.New("artifact: artifact exceeds size limit")
+	ErrQuotaExceeded = errors.New("artifact: directory quota exceeded")
+	ErrExists        = errors.New("artifact: artifact already registered")
+)
+
+type Key struct {
+	ImageID string
+	EventID string
+	Name    string
+}
+
+type Store struct {
+	dir     string
+	maxSize int64
+	quota   int64
+	mu      sync.Mutex
+	used    int64
+}
+
+// NewStore creates store under dir, artifacts larger than maxSize or
+// exceeding quota of dir are refused, zero means unlimited
+func NewStore(dir string, maxSize int64, quota int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		dir:     dir,
+		maxSize: maxSize,
+		quota:   quota,
+	}
+
+	// Artifacts of previous runs count towards quota
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			s.used += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Put stores content of artifact, path of the artifact joined with
+// store directory is returned
+func (s *Store) Put(key Key, content []byte) (string, error) {
+	size := int64(len(content))
+	if s.maxSize > 0 && size > s.maxSize {
+		return "", errors.Wrapf(ErrTooLarge, "%#v is %d bytes", key.Name, size)
+	}
+
+	target := s.path(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := os.Stat(target); err == nil {
+		return "", errors.Wrapf(ErrExists, "%#v of event %#v", key.Name, key.EventID)
+	}
+	if s.quota > 0 && s.used+size > s.quota {
+		return "", errors.Wrapf(ErrQuotaExceeded, "%#v needs %d bytes", key.Name, size)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(target, content, 0600); err != nil {
+		_ = os.Remove(target)
+		return "", err
+	}
+	s.used += size
+	return target, nil
+}
+
+// PutFile stores copy of file on host as artifact, files exceeding
+// size limit are refused without being read
+func (s *Store) PutFile(key Key, file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", errors.Errorf("artifact: %#v isn't a regular file", file)
+	}
+	if s.maxSize > 0 && info.Size() > s.maxSize {
+		return "", errors.Wrapf(ErrTooLarge, "%#v is %d bytes", key.Name, info.Size())
+	}
+
+	// File may grow after stat
+	r := io.Reader(f)
+	if s.maxSize > 0 {
+		r = io.LimitReader(f, s.maxSize+1)
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return s.Put(key, content)
+}
+
+// path returns path of artifact, components which aren't safe file
+// names are hashed so that they can't escape store directory
+func (s *Store) path(key Key) string {
+	image := key.ImageID
+	if digestRegexp.MatchString(image) {
+		image = strings.TrimPrefix(image, "sha256:")
+	} else {
+		image = hash(image)
+	}
+	return filepath.Join(s.dir, image, safeName(key.EventID), safeName(key.Name))
+}
+
+func safeName(name string) string {
+	if nameRegexp.MatchString(name) && name != "." && name != ".." {
+		return name
+	}
+	return hash(name)
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,80 @@
+package artifact
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPut(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(dir, 16, 0)
+	assert.NoError(t, err)
+
+	id := "sha256:" + strings.Repeat("a", 64)
+	path, err := s.Put(Key{ImageID: id, EventID: "1", Name: "yara.txt"}, []byte("match"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, strings.Repeat("a", 64), "1", "yara.txt"), path)
+
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "match", string(content))
+
+	_, err = s.Put(Key{ImageID: id, EventID: "1", Name: "yara.txt"}, []byte("again"))
+	assert.True(t, errors.Is(err, ErrExists))
+
+	_, err = s.Put(Key{ImageID: id, EventID: "1", Name: "large"}, []byte(strings.Repeat("x", 17)))
+	assert.True(t, errors.Is(err, ErrTooLarge))
+
+	// Keys can't escape store directory
+	path, err = s.Put(Key{ImageID: "../../etc", EventID: "..", Name: "../passwd"}, []byte("root"))
+	assert.NoError(t, err)
+	rel, err := filepath.Rel(dir, path)
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(rel, ".."))
+}
+
+func TestPutFile(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(filepath.Join(dir, "artifacts"), 16, 0)
+	assert.NoError(t, err)
+
+	file := filepath.Join(dir, "config.json")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("{}"), 0600))
+	path, err := s.PutFile(Key{ImageID: "image", EventID: "1", Name: "config.json"}, file)
+	assert.NoError(t, err)
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", string(content))
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte(strings.Repeat("x", 17)), 0600))
+	_, err = s.PutFile(Key{ImageID: "image", EventID: "2", Name: "config.json"}, file)
+	assert.True(t, errors.Is(err, ErrTooLarge))
+
+	_, err = s.PutFile(Key{ImageID: "image", EventID: "3", Name: "dir"}, dir)
+	assert.Error(t, err)
+
+	_, err = s.PutFile(Key{ImageID: "image", EventID: "4", Name: "missing"}, filepath.Join(dir, "missing"))
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+}
+
+func TestQuota(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(dir, 0, 300)
+	assert.NoError(t, err)
+
+	_, err = s.Put(Key{ImageID: "image", EventID: "1", Name: "a"}, []byte(strings.Repeat("a", 200)))
+	assert.NoError(t, err)
+	_, err = s.Put(Key{ImageID: "image", EventID: "1", Name: "b"}, []byte(strings.Repeat("b", 200)))
+	assert.True(t, errors.Is(err, ErrQuotaExceeded))
+
+	// Usage of previous runs counts towards quota
+	s, err = NewStore(dir, 0, 300)
+	assert.NoError(t, err)
+	_, err = s.Put(Key{ImageID: "image", EventID: "2", Name: "b"}, []byte(strings.Repeat("b", 200)))
+	assert.True(t, errors.Is(err, ErrQuotaExceeded))
+}
@@ -0,0 +1,324 @@
+// Package audit keeps an append-only log of plugin executions in JSON
+// lines, every entry carries the hash of the previous one so that
+// removed or modified entries are detected by Verify
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// rotatedLayout is suffix of rotated files, they sort in the order they
+// are rotated
+const rotatedLayout = "20060102T150405.000000000"
+
+// Identity of runner writing the log
+type Identity struct {
+	Host string `json:"host"`
+	User string `json:"user"`
+	UID  int    `json:"uid"`
+	PID  int    `json:"pid"`
+}
+
+// Entry records a plugin execution, Hash covers the entry with Hash
+// unset, including Prev which is Hash of the previous entry
+type Entry struct {
+	Seq          uint64    `json:"seq"`
+	Runner       Identity  `json:"runner"`
+	Plugin       string    `json:"plugin"`
+	PluginPath   string    `json:"plugin_path"`
+	PluginSHA256 string    `json:"plugin_sha256"`
+	Command      []string  `json:"command"`
+	Args         []string  `json:"args"`
+	ImageID      string    `json:"image_id"`
+	ImageDigest  string    `json:"image_digest,omitempty"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	ExitCode     int       `json:"exit_code"`
+	Error        string    `json:"error,omitempty"`
+	Prev         string    `json:"prev"`
+	Hash         string    `json:"hash"`
+}
+
+func (e Entry) hash() (string, error) {
+	e.Hash = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log appends entries to file at path, the file is rotated once it
+// exceeds max size and the chain continues into the new file
+type Log struct {
+	path     string
+	maxSize  int64
+	identity Identity
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	seq      uint64
+	prev     string
+	digests  map[string]string
+}
+
+// Open opens log at path, chain is continued from the last entry of
+// the latest file. Zero max size disables rotation
+func Open(path string, maxSize int64, identity Identity) (*Log, error) {
+	l := &Log{
+		path:     path,
+		maxSize:  maxSize,
+		identity: identity,
+		digests:  map[string]string{},
+	}
+
+	files, err := Files(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		last, err := lastEntry(files[len(files)-1])
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			l.seq, l.prev = last.Seq, last.Hash
+		}
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size = f, info.Size()
+	return nil
+}
+
+// Record completes entry with identity of runner, sha256 of plugin and
+// the chain, then appends it and syncs the file
+func (l *Log) Record(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		return errors.New("audit log is closed")
+	}
+
+	// Times are kept in UTC so that entries hash the same once decoded
+	e.Runner = l.identity
+	e.Start, e.End = e.Start.UTC(), e.End.UTC()
+	if e.PluginPath != "" {
+		digest, err := l.digest(e.PluginPath)
+		if err != nil {
+			return err
+		}
+		e.PluginSHA256 = digest
+	}
+	e.Seq, e.Prev = l.seq+1, l.prev
+	hash, err := e.hash()
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(b)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	if _, err := l.f.Write(b); err != nil {
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		return err
+	}
+
+	l.size += int64(len(b))
+	l.seq, l.prev = e.Seq, e.Hash
+	return nil
+}
+
+func (l *Log) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	l.f = nil
+	rotated := l.path + "." + time.Now().UTC().Format(rotatedLayout)
+	if err := os.Rename(l.path, rotated); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// digest returns sha256 of plugin binary, binaries are hashed once
+func (l *Log) digest(path string) (string, error) {
+	if digest, ok := l.digests[path]; ok {
+		return digest, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	l.digests[path] = digest
+	return digest, nil
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Files returns rotated files of log at path in the order they are
+// rotated, followed by path itself if it exists
+func Files(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, m := range matches {
+		if _, err := time.Parse(rotatedLayout, m[len(path)+1:]); err == nil {
+			files = append(files, m)
+		}
+	}
+	sort.Strings(files)
+
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return files, nil
+}
+
+func lastEntry(path string) (*Entry, error) {
+	var last *Entry
+	err := readEntries(path, func(e Entry) error {
+		last = &e
+		return nil
+	})
+	return last, err
+}
+
+func readEntries(path string, fn func(e Entry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		e := Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return errors.Wrapf(err, "%s:%d", path, line)
+		}
+		if err := fn(e); err != nil {
+			return errors.Wrapf(err, "%s:%d", path, line)
+		}
+	}
+	return scanner.Err()
+}
+
+// Result of verification, First is sequence of the first entry kept,
+// which is larger than 1 if the oldest files are removed
+type Result struct {
+	Files   int
+	Entries int
+	First   uint64
+	Last    uint64
+}
+
+// Verify checks the chain of entries of log at path through its
+// rotated files
+func Verify(path string) (Result, error) {
+	result := Result{}
+	files, err := Files(path)
+	if err != nil {
+		return result, err
+	}
+	if len(files) == 0 {
+		return result, errors.Errorf("audit log %s not found", path)
+	}
+	result.Files = len(files)
+
+	var prev *Entry
+	for _, file := range files {
+		err := readEntries(file, func(e Entry) error {
+			hash, err := e.hash()
+			if err != nil {
+				return err
+			}
+			if hash != e.Hash {
+				return errors.Errorf("hash of entry %d doesn't match its content", e.Seq)
+			}
+			// The first entry kept may follow entries of removed files
+			if prev == nil {
+				result.First = e.Seq
+			} else {
+				if e.Prev != prev.Hash {
+					return errors.Errorf("entry %d doesn't follow entry %d", e.Seq, prev.Seq)
+				}
+				if e.Seq != prev.Seq+1 {
+					return errors.Errorf("entry %d follows entry %d", e.Seq, prev.Seq)
+				}
+			}
+			prev = &e
+			result.Entries++
+			result.Last = e.Seq
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
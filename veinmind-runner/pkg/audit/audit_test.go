@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func record(t *testing.T, l *Log, plugin string, image string) {
+	start := time.Now()
+	assert.NoError(t, l.Record(Entry{
+		Plugin:     "veinmind-weakpass",
+		PluginPath: plugin,
+		Command:    []string{"scan", "image"},
+		Args:       []string{image},
+		ImageID:    image,
+		Start:      start,
+		End:        start.Add(time.Second),
+	}))
+}
+
+func TestLog(t *testing.T) {
+	dir := t.TempDir()
+	plugin := filepath.Join(dir, "veinmind-weakpass")
+	assert.NoError(t, ioutil.WriteFile(plugin, []byte("binary"), 0755))
+	path := filepath.Join(dir, "audit.log")
+
+	l, err := Open(path, 1024, Identity{Host: "scanner", User: "root", PID: 42})
+	assert.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		record(t, l, plugin, "sha256:aa")
+	}
+	assert.NoError(t, l.Close())
+
+	// Chain continues after the runner restarts
+	l, err = Open(path, 1024, Identity{Host: "scanner", User: "root", PID: 43})
+	assert.NoError(t, err)
+	record(t, l, plugin, "sha256:bb")
+	assert.NoError(t, l.Close())
+
+	files, err := Files(path)
+	assert.NoError(t, err)
+	assert.True(t, len(files) > 1, files)
+
+	result, err := Verify(path)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Files: len(files), Entries: 5, First: 1, Last: 5}, result)
+
+	last, err := lastEntry(path)
+	assert.NoError(t, err)
+	sum := sha256.Sum256([]byte("binary"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), last.PluginSHA256)
+	assert.Equal(t, 43, last.Runner.PID)
+	assert.Equal(t, []string{"sha256:bb"}, last.Args)
+}
+
+func TestVerifyTampered(t *testing.T) {
+	dir := t.TempDir()
+	plugin := filepath.Join(dir, "veinmind-weakpass")
+	assert.NoError(t, ioutil.WriteFile(plugin, []byte("binary"), 0755))
+	path := filepath.Join(dir, "audit.log")
+
+	l, err := Open(path, 0, Identity{})
+	assert.NoError(t, err)
+	for _, image := range []string{"sha256:aa", "sha256:bb", "sha256:cc"} {
+		record(t, l, plugin, image)
+	}
+	assert.NoError(t, l.Close())
+
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.SplitAfter(string(b), "\n")
+
+	// Modified entry
+	assert.NoError(t, ioutil.WriteFile(path, []byte(strings.Replace(string(b), "sha256:bb", "sha256:dd", 2)), 0600))
+	_, err = Verify(path)
+	assert.EqualError(t, err, path+":2: hash of entry 2 doesn't match its content")
+
+	// Removed entry
+	assert.NoError(t, ioutil.WriteFile(path, []byte(lines[0]+lines[2]), 0600))
+	_, err = Verify(path)
+	assert.EqualError(t, err, path+":2: entry 3 doesn't follow entry 1")
+
+	_, err = Verify(filepath.Join(dir, "missing.log"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,113 @@
+// Package baseimage detects the base image of an image by the longest
+// shared prefix of layers
+package baseimage
+
+import (
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"regexp"
+	"sync"
+)
+
+var diffIDRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// Base is a known base image identified by diff ids of its layers
+type Base struct {
+	Ref    string   `toml:"ref"`
+	Layers []string `toml:"layers"`
+}
+
+type config struct {
+	BaseImages []Base `toml:"base_images"`
+}
+
+// LoadConfig parse file of known base images
+func LoadConfig(path string) ([]Base, error) {
+	c := config{}
+	meta, err := toml.DecodeFile(path, &c)
+	if err != nil {
+		return nil, err
+	}
+
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, errors.Errorf("base images: unknown key %#v", undecoded[0].String())
+	}
+
+	for i, b := range c.BaseImages {
+		if err := b.validate(); err != nil {
+			return nil, errors.Wrapf(err, "base images: entry %d", i)
+		}
+	}
+
+	return c.BaseImages, nil
+}
+
+func (b Base) validate() error {
+	if b.Ref == "" {
+		return errors.New("ref is missing")
+	}
+
+	if len(b.Layers) == 0 {
+		return errors.Errorf("layers of %#v are missing", b.Ref)
+	}
+
+	for _, l := range b.Layers {
+		if !diffIDRegexp.MatchString(l) {
+			return errors.Errorf("layer %#v of %#v is not a sha256 diff id", l, b.Ref)
+		}
+	}
+
+	return nil
+}
+
+type Detector struct {
+	mu    sync.RWMutex
+	bases []Base
+}
+
+func NewDetector(bases ...Base) *Detector {
+	return &Detector{bases: bases}
+}
+
+func (d *Detector) Add(b Base) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.bases = append(d.bases, b)
+}
+
+// Detect returns the base whose layers are the longest prefix of
+// layers, an image isn't the base of itself
+func (d *Detector) Detect(layers []string) (Base, bool) {
+	if d == nil {
+		return Base{}, false
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var (
+		found Base
+		ok    bool
+	)
+	for _, b := range d.bases {
+		if len(b.Layers) >= len(layers) || len(b.Layers) <= len(found.Layers) {
+			continue
+		}
+
+		if isPrefix(b.Layers, layers) {
+			found, ok = b, true
+		}
+	}
+
+	return found, ok
+}
+
+func isPrefix(prefix []string, layers []string) bool {
+	for i := range prefix {
+		if prefix[i] != layers[i] {
+			return false
+		}
+	}
+
+	return true
+}
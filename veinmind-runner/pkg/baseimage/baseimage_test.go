@@ -0,0 +1,48 @@
+package baseimage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func diffID(c string) string {
+	return "sha256:" + strings.Repeat(c, 64)
+}
+
+func TestDetect(t *testing.T) {
+	d := NewDetector(
+		Base{Ref: "alpine:3.15", Layers: []string{diffID("a")}},
+		Base{Ref: "ubuntu:20.04", Layers: []string{diffID("b")}},
+	)
+	d.Add(Base{Ref: "python:3.10-alpine", Layers: []string{diffID("a"), diffID("c")}})
+
+	b, ok := d.Detect([]string{diffID("a"), diffID("c"), diffID("d")})
+	assert.True(t, ok)
+	assert.Equal(t, "python:3.10-alpine", b.Ref)
+
+	b, ok = d.Detect([]string{diffID("a"), diffID("d")})
+	assert.True(t, ok)
+	assert.Equal(t, "alpine:3.15", b.Ref)
+
+	// An image isn't the base of itself
+	_, ok = d.Detect([]string{diffID("b")})
+	assert.False(t, ok)
+
+	_, ok = d.Detect([]string{diffID("e"), diffID("a")})
+	assert.False(t, ok)
+
+	var disabled *Detector
+	_, ok = disabled.Detect([]string{diffID("a"), diffID("c")})
+	assert.False(t, ok)
+}
+
+func TestBaseMalformed(t *testing.T) {
+	for _, b := range []Base{
+		{Layers: []string{diffID("a")}},
+		{Ref: "alpine:3.15"},
+		{Ref: "alpine:3.15", Layers: []string{"sha256:abc"}},
+	} {
+		assert.Error(t, b.validate())
+	}
+}
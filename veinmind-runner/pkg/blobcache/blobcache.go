@@ -0,0 +1,281 @@
+// Package blobcache keeps blobs pulled from registries in a directory
+// addressed by their digests, so that layers shared by images are
+// downloaded once across images and runs. Blobs are evicted in LRU
+// order once the directory grows over its size
+package blobcache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/prune"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const algorithm = "sha256"
+
+// staleAfter is how long partial downloads are kept
+const staleAfter = 24 * time.Hour
+
+var ErrDigestMismatch = errors.New("blobcache: digest mismatch")
+
+// Fetcher downloads blob when it isn't cached
+type Fetcher func() (io.ReadCloser, error)
+
+type Stats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// Saved is bytes not downloaded thanks to hits
+	Saved     int64 `json:"saved"`
+	Evictions int64 `json:"evictions"`
+}
+
+type entry struct {
+	digest string
+	size   int64
+}
+
+// call is an in-flight download, concurrent requests of the same blob
+// wait for it rather than downloading again
+type call struct {
+	wg  sync.WaitGroup
+	err error
+}
+
+type Cache struct {
+	dir     string
+	maxSize int64
+	mu      sync.Mutex
+	size    int64
+	ll      *list.List
+	items   map[string]*list.Element
+	calls   map[string]*call
+	stats   Stats
+}
+
+// Open opens cache in dir holding at most maxSize bytes, zero means
+// unlimited. Blobs left by former runs are kept, the least recently
+// used are evicted first. Partial downloads left by interrupted runs
+// are removed once they are stale
+func Open(dir string, maxSize int64) (*Cache, error) {
+	c := &Cache{
+		dir:     dir,
+		maxSize: maxSize,
+		ll:      list.New(),
+		items:   map[string]*list.Element{},
+		calls:   map[string]*call{},
+	}
+	if err := os.MkdirAll(c.blobDir(), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(c.tmpDir(), 0755); err != nil {
+		return nil, err
+	}
+	c.removeStale(time.Now().Add(-staleAfter))
+
+	infos, err := ioutil.ReadDir(c.blobDir())
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		c.add(algorithm+":"+info.Name(), info.Size())
+	}
+	c.evict("")
+	return c, nil
+}
+
+// removeStale removes partial downloads older than before, recent ones
+// may be being downloaded by other runs sharing the directory
+func (c *Cache) removeStale(before time.Time) {
+	infos, err := ioutil.ReadDir(c.tmpDir())
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		if info.ModTime().Before(before) {
+			_ = os.Remove(filepath.Join(c.tmpDir(), info.Name()))
+		}
+	}
+}
+
+func (c *Cache) blobDir() string {
+	return filepath.Join(c.dir, "blobs", algorithm)
+}
+
+func (c *Cache) tmpDir() string {
+	return filepath.Join(c.dir, "tmp")
+}
+
+// path returns path of blob, empty if digest isn't of sha256
+func (c *Cache) path(digest string) string {
+	if !strings.HasPrefix(digest, algorithm+":") {
+		return ""
+	}
+	encoded := strings.TrimPrefix(digest, algorithm+":")
+	if len(encoded) != sha256.Size*2 || strings.ContainsAny(encoded, `/\.`) {
+		return ""
+	}
+	return filepath.Join(c.blobDir(), encoded)
+}
+
+// Get returns content of blob of digest, fetch is called to download
+// it only when it isn't cached. Blobs not of sha256 are fetched
+// without caching. Content downloaded is verified against digest
+func (c *Cache) Get(digest string, fetch Fetcher) (io.ReadCloser, error) {
+	p := c.path(digest)
+	if p == "" {
+		return fetch()
+	}
+
+	for {
+		c.mu.Lock()
+		if e, ok := c.items[digest]; ok {
+			if f, err := os.Open(p); err == nil {
+				c.ll.MoveToFront(e)
+				c.stats.Hits++
+				c.stats.Saved += e.Value.(*entry).size
+				c.mu.Unlock()
+				now := time.Now()
+				_ = os.Chtimes(p, now, now)
+				return f, nil
+			}
+			// Blob removed behind cache
+			c.remove(e)
+		}
+
+		if cl, ok := c.calls[digest]; ok {
+			c.mu.Unlock()
+			cl.wg.Wait()
+			if cl.err != nil {
+				return nil, cl.err
+			}
+			continue
+		}
+
+		c.stats.Misses++
+		cl := &call{}
+		cl.wg.Add(1)
+		c.calls[digest] = cl
+		c.mu.Unlock()
+
+		size, err := c.download(digest, p, fetch)
+
+		// Blob is opened before anything else can evict it
+		var f *os.File
+		c.mu.Lock()
+		delete(c.calls, digest)
+		if err == nil {
+			c.add(digest, size)
+			c.evict(digest)
+			f, err = os.Open(p)
+		}
+		c.mu.Unlock()
+		cl.err = err
+		cl.wg.Done()
+
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+}
+
+// download writes blob into a temporary file, which is renamed into
+// place once it's verified, so that blobs in cache are always whole
+func (c *Cache) download(digest string, p string, fetch Fetcher) (int64, error) {
+	rc, err := fetch()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	tmp, err := ioutil.TempFile(c.tmpDir(), "blob-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), rc)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if got := algorithm + ":" + hex.EncodeToString(h.Sum(nil)); got != digest {
+		return 0, errors.Wrapf(ErrDigestMismatch, "expect %s, got %s", digest, got)
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+func (c *Cache) add(digest string, size int64) {
+	if e, ok := c.items[digest]; ok {
+		c.remove(e)
+	}
+	c.items[digest] = c.ll.PushFront(&entry{digest: digest, size: size})
+	c.size += size
+}
+
+func (c *Cache) remove(e *list.Element) {
+	ent := e.Value.(*entry)
+	c.ll.Remove(e)
+	delete(c.items, ent.digest)
+	c.size -= ent.size
+}
+
+// evict removes the least recently used blobs until cache fits its
+// size, blob keep is never evicted so that it can be read
+func (c *Cache) evict(keep string) {
+	for c.maxSize > 0 && c.size > c.maxSize {
+		oldest := c.ll.Back()
+		if oldest == nil || oldest.Value.(*entry).digest == keep {
+			return
+		}
+		ent := oldest.Value.(*entry)
+		c.remove(oldest)
+		_ = os.Remove(c.path(ent.digest))
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Expired lists blobs of cache in dir not used since before, along with
+// partial downloads started before it
+func Expired(dir string, before time.Time) ([]prune.Item, error) {
+	c := &Cache{dir: dir}
+	blobs, err := prune.Entries(prune.KindBlob, c.blobDir(), before, func(info os.FileInfo) bool {
+		return info.Mode().IsRegular()
+	})
+	if err != nil {
+		return nil, err
+	}
+	partial, err := prune.Entries(prune.KindBlob, c.tmpDir(), before, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(blobs, partial...), nil
+}
@@ -0,0 +1,150 @@
+package blobcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func digestOf(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// fetcher returns content and counts downloads, downloads are slowed
+// down so that concurrent requests overlap
+func fetcher(content []byte, count *int64) Fetcher {
+	return func() (io.ReadCloser, error) {
+		atomic.AddInt64(count, 1)
+		time.Sleep(10 * time.Millisecond)
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	}
+}
+
+func read(t *testing.T, rc io.ReadCloser, err error) string {
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestGet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobcache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c, err := Open(dir, 0)
+	assert.NoError(t, err)
+
+	layer := []byte("base layer")
+	var downloads int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rc, err := c.Get(digestOf(layer), fetcher(layer, &downloads))
+			assert.Equal(t, "base layer", read(t, rc, err))
+		}()
+	}
+	wg.Wait()
+
+	// Concurrent requests share the download
+	assert.Equal(t, int64(1), downloads)
+	assert.Equal(t, Stats{Hits: 7, Misses: 1, Saved: 70}, c.Stats())
+
+	// Blobs are kept across runs
+	c, err = Open(dir, 0)
+	assert.NoError(t, err)
+	rc, err := c.Get(digestOf(layer), fetcher(layer, &downloads))
+	assert.Equal(t, "base layer", read(t, rc, err))
+	assert.Equal(t, int64(1), downloads)
+	assert.Equal(t, Stats{Hits: 1, Saved: 10}, c.Stats())
+
+	// Content not matching digest isn't cached
+	_, err = c.Get(digestOf([]byte("other")), fetcher(layer, &downloads))
+	assert.True(t, errors.Is(err, ErrDigestMismatch))
+	infos, err := ioutil.ReadDir(filepath.Join(dir, "blobs", "sha256"))
+	assert.NoError(t, err)
+	assert.Len(t, infos, 1)
+
+	// Digests of other algorithms are fetched without caching
+	rc, err = c.Get("sha512:abc", fetcher(layer, &downloads))
+	assert.Equal(t, "base layer", read(t, rc, err))
+	rc, err = c.Get("sha512:abc", fetcher(layer, &downloads))
+	assert.Equal(t, "base layer", read(t, rc, err))
+	assert.Equal(t, int64(4), downloads)
+}
+
+func TestEvict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobcache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c, err := Open(dir, 20)
+	assert.NoError(t, err)
+
+	var downloads int64
+	a, b, d := []byte("aaaaaaaaaa"), []byte("bbbbbbbbbb"), []byte("dddddddddd")
+	for _, blob := range [][]byte{a, b, a, d} {
+		rc, err := c.Get(digestOf(blob), fetcher(blob, &downloads))
+		assert.Equal(t, string(blob), read(t, rc, err))
+	}
+
+	// b is the least recently used
+	assert.Equal(t, int64(1), c.Stats().Evictions)
+	rc, err := c.Get(digestOf(a), fetcher(a, &downloads))
+	read(t, rc, err)
+	rc, err = c.Get(digestOf(b), fetcher(b, &downloads))
+	read(t, rc, err)
+	assert.Equal(t, int64(4), downloads)
+
+	// Blobs over size when reopened are evicted by last use
+	c, err = Open(dir, 10)
+	assert.NoError(t, err)
+	infos, err := ioutil.ReadDir(filepath.Join(dir, "blobs", "sha256"))
+	assert.NoError(t, err)
+	assert.Len(t, infos, 1)
+}
+
+func TestExpired(t *testing.T) {
+	dir := t.TempDir()
+	c, err := Open(dir, 0)
+	assert.NoError(t, err)
+
+	var downloads int64
+	a, b := []byte("aaaaaaaaaa"), []byte("bbbbbbbbbb")
+	for _, blob := range [][]byte{a, b} {
+		rc, err := c.Get(digestOf(blob), fetcher(blob, &downloads))
+		read(t, rc, err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	encoded := digestOf(a)[len("sha256:"):]
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "blobs", "sha256", encoded), old, old))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "tmp", "partial"), []byte("a"), 0644))
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "tmp", "partial"), old, old))
+
+	items, err := Expired(dir, time.Now().Add(-24*time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, filepath.Join(dir, "blobs", "sha256", encoded), items[0].Path)
+	assert.Equal(t, int64(10), items[0].Size)
+	assert.Equal(t, filepath.Join(dir, "tmp", "partial"), items[1].Path)
+
+	items, err = Expired(filepath.Join(dir, "missing"), time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+}
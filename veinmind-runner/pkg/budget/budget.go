@@ -0,0 +1,86 @@
+package budget
+
+import (
+	"sync"
+	"time"
+)
+
+// Budget divides time budget of an image among plugins, each plugin
+// gets a slice of the remaining time weighted against plugins which
+// are running or haven't started, so that plugins started late aren't
+// starved by overruns of earlier ones
+type Budget struct {
+	deadline    time.Time
+	parallelism int
+	mu          sync.Mutex
+	weights     map[string]float64
+	pending     map[string]struct{}
+	running     map[string]struct{}
+}
+
+// New creates budget expiring at deadline for plugins, at most
+// parallelism plugins run at the same time
+func New(deadline time.Time, plugins []string, parallelism int, timings *Timings) *Budget {
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+
+	b := &Budget{
+		deadline:    deadline,
+		parallelism: parallelism,
+		weights:     timings.weights(plugins),
+		pending:     map[string]struct{}{},
+		running:     map[string]struct{}{},
+	}
+	for _, p := range plugins {
+		b.pending[p] = struct{}{}
+	}
+	return b
+}
+
+// Start returns slice of budget of plugin starting at now, the plugin
+// runs until Finish. Slices are never longer than remaining time
+func (b *Budget) Start(plugin string, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, pending := b.pending[plugin]
+	delete(b.pending, plugin)
+
+	remaining := b.deadline.Sub(now)
+	if remaining <= 0 {
+		return 0
+	}
+	if !pending {
+		return remaining
+	}
+
+	var sum float64
+	for p := range b.pending {
+		sum += b.weights[p]
+	}
+	for p := range b.running {
+		sum += b.weights[p]
+	}
+	weight := b.weights[plugin]
+	sum += weight
+	b.running[plugin] = struct{}{}
+
+	// Running and pending plugins share remaining time of parallel slots
+	slots := b.parallelism
+	if n := len(b.pending) + len(b.running); n < slots {
+		slots = n
+	}
+	slice := time.Duration(float64(remaining) * float64(slots) * weight / sum)
+	if slice > remaining {
+		slice = remaining
+	}
+	return slice
+}
+
+// Finish marks plugin as finished
+func (b *Budget) Finish(plugin string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.running, plugin)
+}
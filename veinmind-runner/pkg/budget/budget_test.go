@@ -0,0 +1,76 @@
+package budget
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTimings(t *testing.T) {
+	timings := NewTimings()
+	timings.Observe("veinmind-malicious", 30*time.Second)
+	timings.Observe("veinmind-malicious", 10*time.Second)
+	timings.Observe("veinmind-weakpass", 5*time.Second)
+
+	avg, ok := timings.Average("veinmind-malicious")
+	assert.True(t, ok)
+	assert.Equal(t, 20*time.Second, avg)
+	_, ok = timings.Average("veinmind-history")
+	assert.False(t, ok)
+
+	assert.Equal(t,
+		[]string{"veinmind-weakpass", "veinmind-malicious", "veinmind-history", "veinmind-basic"},
+		timings.Order([]string{"veinmind-history", "veinmind-malicious", "veinmind-basic", "veinmind-weakpass"}))
+
+	path := filepath.Join(t.TempDir(), "timings.json")
+	assert.NoError(t, timings.Save(path))
+	loaded, err := LoadTimings(path)
+	assert.NoError(t, err)
+	avg, ok = loaded.Average("veinmind-malicious")
+	assert.True(t, ok)
+	assert.Equal(t, 20*time.Second, avg)
+
+	loaded, err = LoadTimings(filepath.Join(t.TempDir(), "missing.json"))
+	assert.NoError(t, err)
+	assert.Empty(t, loaded.Order(nil))
+}
+
+func TestBudget(t *testing.T) {
+	timings := NewTimings()
+	timings.Observe("fast", 10*time.Second)
+	timings.Observe("slow", 30*time.Second)
+
+	now := time.Date(2022, 5, 26, 2, 36, 45, 0, time.UTC)
+	b := New(now.Add(100*time.Second), []string{"fast", "slow", "unknown"}, 1, timings)
+
+	// unknown weighs the mean 20s, fast gets 10/60 of 100s
+	slice := b.Start("fast", now)
+	assert.Equal(t, 100*time.Second/6, slice)
+
+	// fast overran, slow gets 30/50 of what's left
+	now = now.Add(50 * time.Second)
+	b.Finish("fast")
+	assert.Equal(t, 30*time.Second, b.Start("slow", now))
+	b.Finish("slow")
+	assert.Equal(t, 50*time.Second, b.Start("unknown", now))
+
+	// plugins which aren't budgeted get the remaining time
+	assert.Equal(t, 50*time.Second, b.Start("other", now))
+	assert.Equal(t, time.Duration(0), b.Start("other", now.Add(time.Hour)))
+}
+
+func TestBudgetParallel(t *testing.T) {
+	now := time.Date(2022, 5, 26, 2, 36, 45, 0, time.UTC)
+	b := New(now.Add(60*time.Second), []string{"a", "b", "c", "d"}, 2, NewTimings())
+
+	assert.Equal(t, 30*time.Second, b.Start("a", now))
+	assert.Equal(t, 30*time.Second, b.Start("b", now))
+
+	// a and b finished early, c and d share both slots
+	now = now.Add(20 * time.Second)
+	b.Finish("a")
+	b.Finish("b")
+	assert.Equal(t, 40*time.Second, b.Start("c", now))
+	assert.Equal(t, 40*time.Second, b.Start("d", now))
+}
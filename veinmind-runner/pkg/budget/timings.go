@@ -0,0 +1,122 @@
+// Package budget shares time budget of an image scan among plugins,
+// weighted by historical average durations of plugins
+package budget
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Timing is the average duration of executions of a plugin
+type Timing struct {
+	Average time.Duration `json:"average"`
+	Count   int64         `json:"count"`
+}
+
+// Timings records durations of plugin executions, it's persisted
+// across runs so that weights are known from the first image
+type Timings struct {
+	mu      sync.Mutex
+	plugins map[string]Timing
+}
+
+func NewTimings() *Timings {
+	return &Timings{plugins: map[string]Timing{}}
+}
+
+// LoadTimings loads timings from file, missing file is empty timings
+func LoadTimings(path string) (*Timings, error) {
+	t := NewTimings()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return t, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &t.plugins); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Save writes timings to file
+func (t *Timings) Save(path string) error {
+	t.mu.Lock()
+	b, err := json.MarshalIndent(t.plugins, "", "  ")
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// Observe records duration of an execution of plugin
+func (t *Timings) Observe(plugin string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timing := t.plugins[plugin]
+	timing.Count++
+	timing.Average += (d - timing.Average) / time.Duration(timing.Count)
+	t.plugins[plugin] = timing
+}
+
+// Average returns average duration of plugin if it's known
+func (t *Timings) Average(plugin string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timing, ok := t.plugins[plugin]
+	if !ok || timing.Count == 0 {
+		return 0, false
+	}
+	return timing.Average, true
+}
+
+// Order sorts plugins so that historically fast plugins run first,
+// plugins of unknown timing keep their order after known ones
+func (t *Timings) Order(plugins []string) []string {
+	ordered := append([]string(nil), plugins...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, aok := t.Average(ordered[i])
+		b, bok := t.Average(ordered[j])
+		if aok != bok {
+			return aok
+		}
+		return aok && a < b
+	})
+	return ordered
+}
+
+// weights returns weights of plugins, plugins of unknown timing weigh
+// the mean of known ones, or all weigh equally if none is known
+func (t *Timings) weights(plugins []string) map[string]float64 {
+	weights := map[string]float64{}
+	var (
+		sum   float64
+		known int
+	)
+	for _, p := range plugins {
+		if avg, ok := t.Average(p); ok && avg > 0 {
+			weights[p] = float64(avg)
+			sum += float64(avg)
+			known++
+		}
+	}
+
+	mean := 1.0
+	if known > 0 {
+		mean = sum / float64(known)
+	}
+	for _, p := range plugins {
+		if _, ok := weights[p]; !ok {
+			weights[p] = mean
+		}
+	}
+	return weights
+}
@@ -0,0 +1,170 @@
+// Package buildhistory reconstructs Dockerfile of image from its build
+// history and detects risky build instructions
+package buildhistory
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layer"
+	"regexp"
+	"strings"
+)
+
+// Rules of risky build instructions
+const (
+	RuleAddURL          = "add-url"
+	RulePipeToShell     = "pipe-to-shell"
+	RuleInsecureFetch   = "insecure-fetch"
+	RuleSecretInHistory = "secret-in-history"
+)
+
+// Redacted replaces values of secrets in reconstructed history
+const Redacted = "<redacted>"
+
+// DefaultLevels are levels of events of rules unless mapped otherwise
+var DefaultLevels = map[string]report.Level{
+	RuleAddURL:          report.Medium,
+	RulePipeToShell:     report.High,
+	RuleInsecureFetch:   report.High,
+	RuleSecretInHistory: report.Critical,
+}
+
+var descriptions = map[string]string{
+	RuleAddURL:          "ADD fetches remote file without checksum",
+	RulePipeToShell:     "remote script is piped into shell",
+	RuleInsecureFetch:   "signature or certificate verification is disabled",
+	RuleSecretInHistory: "secret is visible in build history",
+}
+
+var (
+	addURL      = regexp.MustCompile(`(?i)^ADD\s+(--\S+\s+)*https?://`)
+	pipeToShell = regexp.MustCompile(`(?i)\b(curl|wget)\b[^|;&]*\|\s*(sudo\s+)?(ba|z|da)?sh\b`)
+	insecure    = regexp.MustCompile(`(?i)(--no-check-certificate|\bcurl\b[^|;&]*\s(-k|--insecure)\b|--allow-unauthenticated|--force-yes|--nogpgcheck|gpgcheck\s*=\s*0|--allow-untrusted|--trusted-host|GIT_SSL_NO_VERIFY|strict-ssl\s+false|--disable-content-trust)`)
+	// assignment matches NAME=value of build arguments and ENV
+	assignment = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)=("[^"]*"|'[^']*'|\S+)`)
+	secretName = regexp.MustCompile(`(?i)(token|secret|passw|api_?key|access_?key|private_?key|credential)`)
+)
+
+// Entry is an entry of image history
+type Entry struct {
+	CreatedBy  string
+	EmptyLayer bool
+}
+
+// Step is an instruction of reconstructed Dockerfile, values of secrets
+// are redacted
+type Step struct {
+	Index       int    `json:"index"`
+	Instruction string `json:"instruction"`
+	EmptyLayer  bool   `json:"empty_layer,omitempty"`
+}
+
+// Finding is a risky instruction of history
+type Finding struct {
+	Step  Step
+	Rule  string
+	Level report.Level
+}
+
+// Description returns what's risky of finding
+func (f Finding) Description() string {
+	return descriptions[f.Rule]
+}
+
+// Reconstruct returns instructions of history, build arguments recorded
+// by legacy builder are kept as ARG instructions
+func Reconstruct(history []Entry) []Step {
+	steps := []Step{}
+	for i, h := range history {
+		steps = append(steps, Step{
+			Index:       i,
+			Instruction: redact(instruction(h.CreatedBy)),
+			EmptyLayer:  h.EmptyLayer,
+		})
+	}
+	return steps
+}
+
+// Dockerfile renders steps as a pseudo Dockerfile
+func Dockerfile(steps []Step) string {
+	b := &strings.Builder{}
+	for _, s := range steps {
+		b.WriteString(s.Instruction)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// instruction returns Dockerfile instruction of history entry, build
+// arguments of legacy builder are prefixed as "|<n> NAME=value ..."
+func instruction(createdBy string) string {
+	s := strings.TrimSpace(createdBy)
+	if !strings.HasPrefix(s, "|") {
+		return layer.Instruction(s)
+	}
+
+	args := ""
+	if i := strings.Index(s, " "); i >= 0 {
+		args = s[i+1:]
+	}
+	if i := strings.Index(args, "/bin/sh -c "); i >= 0 {
+		args = strings.TrimSpace(args[:i])
+	}
+	return layer.Instruction(s) + " # ARG " + args
+}
+
+// redact replaces values of assignments whose names look sensitive
+func redact(s string) string {
+	return assignment.ReplaceAllStringFunc(s, func(kv string) string {
+		m := assignment.FindStringSubmatch(kv)
+		if !secretName.MatchString(m[1]) {
+			return kv
+		}
+		return m[1] + "=" + Redacted
+	})
+}
+
+// hasSecret reports whether an assignment of createdBy has a sensitive
+// name and a value which isn't a reference to another variable
+func hasSecret(createdBy string) bool {
+	for _, m := range assignment.FindAllStringSubmatch(createdBy, -1) {
+		value := strings.Trim(m[2], `"'`)
+		if secretName.MatchString(m[1]) && value != "" && !strings.HasPrefix(value, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// Detect finds risky instructions of history, levels override levels of
+// rules in DefaultLevels
+func Detect(history []Entry, levels map[string]report.Level) []Finding {
+	findings := []Finding{}
+	steps := Reconstruct(history)
+	for i, h := range history {
+		s := strings.TrimSpace(h.CreatedBy)
+		inst := instruction(s)
+
+		rules := []string{}
+		if addURL.MatchString(inst) {
+			rules = append(rules, RuleAddURL)
+		}
+		if pipeToShell.MatchString(s) {
+			rules = append(rules, RulePipeToShell)
+		}
+		if insecure.MatchString(s) {
+			rules = append(rules, RuleInsecureFetch)
+		}
+		if hasSecret(s) {
+			rules = append(rules, RuleSecretInHistory)
+		}
+
+		for _, rule := range rules {
+			level, ok := levels[rule]
+			if !ok {
+				level = DefaultLevels[rule]
+			}
+			findings = append(findings, Finding{Step: steps[i], Rule: rule, Level: level})
+		}
+	}
+	return findings
+}
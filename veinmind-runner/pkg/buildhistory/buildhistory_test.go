@@ -0,0 +1,54 @@
+package buildhistory
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var history = []Entry{
+	{CreatedBy: "/bin/sh -c #(nop) ADD file:0a1b2c in / "},
+	{CreatedBy: `/bin/sh -c #(nop)  CMD ["bash"]`, EmptyLayer: true},
+	{CreatedBy: "|2 GITHUB_TOKEN=ghp_abc VERSION=1.2 /bin/sh -c make install"},
+	{CreatedBy: "/bin/sh -c curl -fsSL https://get.example.com | sh"},
+	{CreatedBy: "ADD https://example.com/tool.tar.gz /opt/ # buildkit"},
+	{CreatedBy: "RUN /bin/sh -c apt-get install -y --allow-unauthenticated curl # buildkit"},
+	{CreatedBy: "ENV API_KEY=$API_KEY"},
+}
+
+func TestReconstruct(t *testing.T) {
+	steps := Reconstruct(history)
+	assert.Len(t, steps, len(history))
+	assert.Equal(t, "ADD file:0a1b2c in /", steps[0].Instruction)
+	assert.True(t, steps[1].EmptyLayer)
+	assert.Equal(t, "RUN make install # ARG GITHUB_TOKEN=<redacted> VERSION=1.2", steps[2].Instruction)
+	assert.Equal(t, "RUN curl -fsSL https://get.example.com | sh", steps[3].Instruction)
+	assert.Contains(t, Dockerfile(steps), "CMD [\"bash\"]\nRUN make install")
+	assert.NotContains(t, Dockerfile(steps), "ghp_abc")
+}
+
+func TestDetect(t *testing.T) {
+	findings := Detect(history, map[string]report.Level{RuleAddURL: report.Low})
+
+	rules := map[int][]string{}
+	for _, f := range findings {
+		rules[f.Step.Index] = append(rules[f.Step.Index], f.Rule)
+	}
+	assert.Equal(t, map[int][]string{
+		2: {RuleSecretInHistory},
+		3: {RulePipeToShell},
+		4: {RuleAddURL},
+		5: {RuleInsecureFetch},
+	}, rules)
+
+	for _, f := range findings {
+		switch f.Rule {
+		case RuleAddURL:
+			assert.Equal(t, report.Low, f.Level)
+		case RuleSecretInHistory:
+			assert.Equal(t, report.Critical, f.Level)
+			assert.NotContains(t, f.Step.Instruction, "ghp_abc")
+		}
+		assert.NotEmpty(t, f.Description())
+	}
+}
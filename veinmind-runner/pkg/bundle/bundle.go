@@ -0,0 +1,286 @@
+// Package bundle packages plugins, configs, policies and ignore files
+// into a single archive for transfer to air-gapped hosts
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ManifestVersion is the version of bundle manifest
+const ManifestVersion = 1
+
+// ManifestName is the name of manifest in bundle, it's the last entry
+// since it carries checksums of the other entries
+const ManifestName = "manifest.json"
+
+// Kinds of bundle files, files are installed under directory of kind
+const (
+	KindPlugin    = "plugins"
+	KindConfig    = "config"
+	KindPolicy    = "policies"
+	KindIgnore    = "ignores"
+	KindAllowlist = "allowlists"
+)
+
+var kinds = map[string]struct{}{
+	KindPlugin:    {},
+	KindConfig:    {},
+	KindPolicy:    {},
+	KindIgnore:    {},
+	KindAllowlist: {},
+}
+
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Files   []File    `json:"files"`
+}
+
+type File struct {
+	// Path is the slash separated path in bundle, e.g. plugins/veinmind-weakpass
+	Path   string      `json:"path"`
+	Kind   string      `json:"kind"`
+	Mode   os.FileMode `json:"mode"`
+	Size   int64       `json:"size"`
+	SHA256 string      `json:"sha256"`
+}
+
+// Source is a local file to be exported
+type Source struct {
+	Kind string
+	Path string
+}
+
+// Export writes sources into gzip compressed tar
+func Export(w io.Writer, sources []Source) (*Manifest, error) {
+	m := &Manifest{
+		Version: ManifestVersion,
+		Created: time.Now(),
+		Files:   []File{},
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	seen := map[string]struct{}{}
+
+	for _, s := range sources {
+		if _, ok := kinds[s.Kind]; !ok {
+			return nil, errors.Errorf("bundle: kind %#v not match", s.Kind)
+		}
+
+		f, err := exportFile(tw, s)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := seen[f.Path]; ok {
+			return nil, errors.Errorf("bundle: duplicated file %#v", f.Path)
+		}
+		seen[f.Path] = struct{}{}
+		m.Files = append(m.Files, f)
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    ManifestName,
+		Mode:    0644,
+		Size:    int64(len(b)),
+		ModTime: m.Created,
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(b); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func exportFile(tw *tar.Writer, s Source) (File, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return File{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return File{}, errors.Errorf("bundle: %#v isn't a regular file", s.Path)
+	}
+
+	file := File{
+		Path: path.Join(s.Kind, filepath.Base(s.Path)),
+		Kind: s.Kind,
+		Mode: info.Mode().Perm(),
+		Size: info.Size(),
+	}
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    file.Path,
+		Mode:    int64(file.Mode),
+		Size:    file.Size,
+		ModTime: info.ModTime(),
+	}); err != nil {
+		return File{}, err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tw, h), f); err != nil {
+		return File{}, err
+	}
+	file.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	return file, nil
+}
+
+// Import verifies bundle against its manifest and installs files under
+// dir, nothing is installed when the bundle is partial or corrupted
+func Import(r io.Reader, dir string) (*Manifest, error) {
+	staging, err := ioutil.TempDir(dir, ".bundle-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "bundle: corrupted archive")
+	}
+
+	var manifest *Manifest
+	sums := map[string]string{}
+	sizes := map[string]int64{}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "bundle: corrupted archive")
+		}
+
+		if hdr.Name == ManifestName {
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, errors.Wrap(err, "bundle: corrupted manifest")
+			}
+			continue
+		}
+
+		if err := checkPath(hdr.Name); err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, errors.Errorf("bundle: %#v isn't a regular file", hdr.Name)
+		}
+
+		target := filepath.Join(staging, filepath.FromSlash(hdr.Name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode).Perm())
+		if err != nil {
+			return nil, err
+		}
+
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(f, h), tr)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "bundle: corrupted archive")
+		}
+		sums[hdr.Name] = hex.EncodeToString(h.Sum(nil))
+		sizes[hdr.Name] = n
+	}
+
+	if manifest == nil {
+		return nil, errors.New("bundle: manifest is missing, the bundle may be partial")
+	}
+	if manifest.Version > ManifestVersion {
+		return nil, errors.Errorf("bundle: manifest version %d is newer than the supported version %d",
+			manifest.Version, ManifestVersion)
+	}
+
+	if err := manifest.verify(sums, sizes); err != nil {
+		return nil, err
+	}
+
+	for _, f := range manifest.Files {
+		target := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(filepath.Join(staging, filepath.FromSlash(f.Path)), target); err != nil {
+			return nil, err
+		}
+	}
+
+	return manifest, nil
+}
+
+func (m *Manifest) verify(sums map[string]string, sizes map[string]int64) error {
+	listed := map[string]struct{}{}
+	for _, f := range m.Files {
+		if err := checkPath(f.Path); err != nil {
+			return err
+		}
+		listed[f.Path] = struct{}{}
+
+		sum, ok := sums[f.Path]
+		if !ok {
+			return errors.Errorf("bundle: %#v is missing, the bundle may be partial", f.Path)
+		}
+		if sizes[f.Path] != f.Size || sum != f.SHA256 {
+			return errors.Errorf("bundle: checksum of %#v mismatch, the bundle may be corrupted", f.Path)
+		}
+	}
+
+	for p := range sums {
+		if _, ok := listed[p]; !ok {
+			return errors.Errorf("bundle: %#v isn't listed in manifest", p)
+		}
+	}
+
+	return nil
+}
+
+// checkPath refuses paths escaping install directory
+func checkPath(p string) error {
+	clean := path.Clean(p)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return errors.Errorf("bundle: illegal path %#v", p)
+	}
+
+	kind := strings.SplitN(clean, "/", 2)[0]
+	if _, ok := kinds[kind]; !ok || clean == kind {
+		return errors.Errorf("bundle: illegal path %#v", p)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newSources(t *testing.T, dir string) []Source {
+	plugin := filepath.Join(dir, "veinmind-weakpass")
+	assert.NoError(t, ioutil.WriteFile(plugin, []byte("#!/bin/sh\n"), 0755))
+	policy := filepath.Join(dir, "policy.toml")
+	assert.NoError(t, ioutil.WriteFile(policy, []byte(`severity_threshold = "high"`), 0644))
+
+	return []Source{
+		{Kind: KindPlugin, Path: plugin},
+		{Kind: KindPolicy, Path: policy},
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	src, err := ioutil.TempDir("", "bundle")
+	assert.NoError(t, err)
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "bundle")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dst)
+
+	buf := &bytes.Buffer{}
+	m, err := Export(buf, newSources(t, src))
+	assert.NoError(t, err)
+	assert.Len(t, m.Files, 2)
+
+	imported, err := Import(bytes.NewReader(buf.Bytes()), dst)
+	assert.NoError(t, err)
+	assert.Equal(t, m.Files, imported.Files)
+
+	info, err := os.Stat(filepath.Join(dst, "plugins", "veinmind-weakpass"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	b, err := ioutil.ReadFile(filepath.Join(dst, "policies", "policy.toml"))
+	assert.NoError(t, err)
+	assert.Equal(t, `severity_threshold = "high"`, string(b))
+}
+
+func TestImportPartial(t *testing.T) {
+	src, err := ioutil.TempDir("", "bundle")
+	assert.NoError(t, err)
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "bundle")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dst)
+
+	buf := &bytes.Buffer{}
+	_, err = Export(buf, newSources(t, src))
+	assert.NoError(t, err)
+
+	_, err = Import(bytes.NewReader(buf.Bytes()[:buf.Len()/2]), dst)
+	assert.Error(t, err)
+
+	// Nothing is installed
+	entries, err := ioutil.ReadDir(dst)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func writeTar(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func TestImportCorrupted(t *testing.T) {
+	dst, err := ioutil.TempDir("", "bundle")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dst)
+
+	manifest := `{"version": 1, "files": [{"path": "policies/policy.toml", "kind": "policies", "size": 3,
+		"sha256": "0000000000000000000000000000000000000000000000000000000000000000"}]}`
+
+	for _, files := range []map[string]string{
+		{"policies/policy.toml": "abc"},
+		{"policies/policy.toml": "abc", ManifestName: manifest},
+		{"policies/policy.toml": "abc", "../escape": "abc", ManifestName: manifest},
+	} {
+		_, err := Import(bytes.NewReader(writeTar(t, files)), dst)
+		assert.Error(t, err)
+	}
+}
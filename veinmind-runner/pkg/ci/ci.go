@@ -0,0 +1,257 @@
+// Package ci posts scan result to merge request or pull request
+// of code review platforms
+package ci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Marker identifies the comment posted by veinmind-runner, so that
+// the comment is updated in place rather than posted again
+const Marker = "<!-- veinmind-runner -->"
+
+var githubPullRefRegexp = regexp.MustCompile(`^refs/pull/(\d+)/`)
+
+type Commenter interface {
+	// Upsert updates the comment with marker or posts a new one
+	Upsert(ctx context.Context, body string) error
+}
+
+// Options specifies coordinates of merge request or pull request,
+// empty fields are detected from CI environment variables
+type Options struct {
+	Provider string
+	Token    string
+	API      string
+	Project  string
+	Number   int
+	Client   *http.Client
+}
+
+// New creates commenter of provider
+func New(opts Options) (Commenter, error) {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	switch opts.Provider {
+	case "github":
+		c := &GitHub{opts}
+		if err := c.detect(); err != nil {
+			return nil, err
+		}
+		return c, nil
+	case "gitlab":
+		c := &GitLab{opts}
+		if err := c.detect(); err != nil {
+			return nil, err
+		}
+		return c, nil
+	default:
+		return nil, errors.Errorf("ci: provider %#v not match", opts.Provider)
+	}
+}
+
+// DefaultTokenEnv returns the environment variable of token of provider
+func DefaultTokenEnv(provider string) string {
+	switch provider {
+	case "gitlab":
+		return "GITLAB_TOKEN"
+	default:
+		return "GITHUB_TOKEN"
+	}
+}
+
+type GitHub struct {
+	Options
+}
+
+func (c *GitHub) detect() error {
+	if c.API == "" {
+		c.API = os.Getenv("GITHUB_API_URL")
+	}
+	if c.API == "" {
+		c.API = "https://api.github.com"
+	}
+
+	if c.Project == "" {
+		c.Project = os.Getenv("GITHUB_REPOSITORY")
+	}
+
+	if c.Number == 0 {
+		if m := githubPullRefRegexp.FindStringSubmatch(os.Getenv("GITHUB_REF")); m != nil {
+			c.Number, _ = strconv.Atoi(m[1])
+		}
+	}
+
+	if c.Number == 0 {
+		if eventPath := os.Getenv("GITHUB_EVENT_PATH"); eventPath != "" {
+			event := struct {
+				PullRequest struct {
+					Number int `json:"number"`
+				} `json:"pull_request"`
+			}{}
+			if b, err := ioutil.ReadFile(eventPath); err == nil {
+				_ = json.Unmarshal(b, &event)
+				c.Number = event.PullRequest.Number
+			}
+		}
+	}
+
+	if c.Project == "" || c.Number == 0 {
+		return errors.New("ci: github repository and pull request number can't be detected")
+	}
+
+	return nil
+}
+
+func (c *GitHub) Upsert(ctx context.Context, body string) error {
+	body = Marker + "\n" + body
+
+	for page := 1; ; page++ {
+		comments := []struct {
+			ID   int64  `json:"id"`
+			Body string `json:"body"`
+		}{}
+		url := fmt.Sprintf("%s/repos/%s/issues/%d/comments?per_page=100&page=%d", c.API, c.Project, c.Number, page)
+		if err := c.do(ctx, http.MethodGet, url, nil, &comments); err != nil {
+			return err
+		}
+
+		for _, comment := range comments {
+			if strings.Contains(comment.Body, Marker) {
+				url := fmt.Sprintf("%s/repos/%s/issues/comments/%d", c.API, c.Project, comment.ID)
+				return c.do(ctx, http.MethodPatch, url, map[string]string{"body": body}, nil)
+			}
+		}
+
+		if len(comments) < 100 {
+			break
+		}
+	}
+
+	url := fmt.Sprintf("%s/repos/%s/issues/%d/comments", c.API, c.Project, c.Number)
+	return c.do(ctx, http.MethodPost, url, map[string]string{"body": body}, nil)
+}
+
+func (c *GitHub) do(ctx context.Context, method string, url string, in interface{}, out interface{}) error {
+	return do(ctx, c.Client, method, url, map[string]string{
+		"Authorization": "token " + c.Token,
+		"Accept":        "application/vnd.github.v3+json",
+	}, in, out)
+}
+
+type GitLab struct {
+	Options
+}
+
+func (c *GitLab) detect() error {
+	if c.API == "" {
+		c.API = os.Getenv("CI_API_V4_URL")
+	}
+	if c.API == "" {
+		c.API = "https://gitlab.com/api/v4"
+	}
+
+	if c.Project == "" {
+		c.Project = os.Getenv("CI_PROJECT_ID")
+	}
+
+	if c.Number == 0 {
+		c.Number, _ = strconv.Atoi(os.Getenv("CI_MERGE_REQUEST_IID"))
+	}
+
+	if c.Project == "" || c.Number == 0 {
+		return errors.New("ci: gitlab project and merge request iid can't be detected")
+	}
+
+	return nil
+}
+
+func (c *GitLab) Upsert(ctx context.Context, body string) error {
+	body = Marker + "\n" + body
+	project := strings.ReplaceAll(c.Project, "/", "%2F")
+
+	for page := 1; ; page++ {
+		notes := []struct {
+			ID   int64  `json:"id"`
+			Body string `json:"body"`
+		}{}
+		url := fmt.Sprintf("%s/projects/%s/merge_requests/%d/notes?per_page=100&page=%d", c.API, project, c.Number, page)
+		if err := c.do(ctx, http.MethodGet, url, nil, &notes); err != nil {
+			return err
+		}
+
+		for _, note := range notes {
+			if strings.Contains(note.Body, Marker) {
+				url := fmt.Sprintf("%s/projects/%s/merge_requests/%d/notes/%d", c.API, project, c.Number, note.ID)
+				return c.do(ctx, http.MethodPut, url, map[string]string{"body": body}, nil)
+			}
+		}
+
+		if len(notes) < 100 {
+			break
+		}
+	}
+
+	url := fmt.Sprintf("%s/projects/%s/merge_requests/%d/notes", c.API, project, c.Number)
+	return c.do(ctx, http.MethodPost, url, map[string]string{"body": body}, nil)
+}
+
+func (c *GitLab) do(ctx context.Context, method string, url string, in interface{}, out interface{}) error {
+	return do(ctx, c.Client, method, url, map[string]string{
+		"PRIVATE-TOKEN": c.Token,
+	}, in, out)
+}
+
+func do(ctx context.Context, client *http.Client, method string, url string,
+	header map[string]string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("ci: %s %s: %s %s", method, req.URL.Path, resp.Status, string(b))
+	}
+
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package ci
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGitHubUpsert(t *testing.T) {
+	comments := map[int64]string{1: "unrelated comment"}
+	var nextID int64 = 2
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token secret", r.Header.Get("Authorization"))
+
+		body := map[string]string{}
+		if r.Body != nil {
+			_ = json.NewDecoder(r.Body).Decode(&body)
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/org/app/issues/7/comments":
+			list := []map[string]interface{}{}
+			for id, b := range comments {
+				list = append(list, map[string]interface{}{"id": id, "body": b})
+			}
+			_ = json.NewEncoder(w).Encode(list)
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/org/app/issues/7/comments":
+			comments[nextID] = body["body"]
+			nextID++
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/repos/org/app/issues/comments/"):
+			comments[2] = body["body"]
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c, err := New(Options{
+		Provider: "github",
+		Token:    "secret",
+		API:      server.URL,
+		Project:  "org/app",
+		Number:   7,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.Upsert(context.Background(), "first"))
+	assert.NoError(t, c.Upsert(context.Background(), "second"))
+
+	assert.Len(t, comments, 2)
+	assert.Equal(t, Marker+"\nsecond", comments[2])
+}
+
+func setenv(t *testing.T, key string, value string) {
+	prev, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestGitHubDetect(t *testing.T) {
+	setenv(t, "GITHUB_REPOSITORY", "org/app")
+	setenv(t, "GITHUB_REF", "refs/pull/42/merge")
+	setenv(t, "GITHUB_EVENT_PATH", "")
+
+	c, err := New(Options{Provider: "github"})
+	assert.NoError(t, err)
+	assert.Equal(t, 42, c.(*GitHub).Number)
+	assert.Equal(t, "org/app", c.(*GitHub).Project)
+}
+
+func TestGitLabDetectFailed(t *testing.T) {
+	setenv(t, "CI_PROJECT_ID", "")
+	setenv(t, "CI_MERGE_REQUEST_IID", "")
+
+	_, err := New(Options{Provider: "gitlab"})
+	assert.Error(t, err)
+}
+
+func TestAPIFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	c, err := New(Options{
+		Provider: "gitlab",
+		API:      server.URL,
+		Project:  "group/app",
+		Number:   3,
+	})
+	assert.NoError(t, err)
+	assert.Error(t, c.Upsert(context.Background(), "body"))
+}
@@ -0,0 +1,200 @@
+// Package cibuild describes the CI build which produced images scanned,
+// so that findings are traced back to the pipeline building them
+package cibuild
+
+import (
+	"github.com/distribution/distribution/reference"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Build is the CI build of the scan, it's detected from environment
+// variables of CI providers and extended by --build-metadata. Images
+// are references and digests of images built, events of which are
+// stamped with Ref
+type Build struct {
+	Provider   string            `json:"provider,omitempty"`
+	ID         string            `json:"id,omitempty"`
+	URL        string            `json:"url,omitempty"`
+	Repository string            `json:"repository,omitempty"`
+	Commit     string            `json:"commit,omitempty"`
+	Branch     string            `json:"branch,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Images     []string          `json:"images,omitempty"`
+}
+
+// Ref is the reference to build stamped on events
+type Ref struct {
+	Provider string `json:"provider,omitempty"`
+	ID       string `json:"id,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+// provider detects build from environment variables of a CI provider,
+// nil is returned if they're absent
+type provider func(getenv func(string) string) *Build
+
+var providers = []provider{
+	func(getenv func(string) string) *Build {
+		id := getenv("GITHUB_RUN_ID")
+		if id == "" {
+			return nil
+		}
+		server := getenv("GITHUB_SERVER_URL")
+		if server == "" {
+			server = "https://github.com"
+		}
+		b := &Build{Provider: "github", ID: id, Repository: getenv("GITHUB_REPOSITORY"), Commit: getenv("GITHUB_SHA"), Branch: getenv("GITHUB_REF_NAME")}
+		if b.Repository != "" {
+			b.URL = strings.TrimSuffix(server, "/") + "/" + b.Repository + "/actions/runs/" + id
+		}
+		return b
+	},
+	func(getenv func(string) string) *Build {
+		if getenv("CI_PIPELINE_ID") == "" && getenv("CI_PIPELINE_URL") == "" {
+			return nil
+		}
+		return &Build{Provider: "gitlab", ID: getenv("CI_PIPELINE_ID"), URL: getenv("CI_PIPELINE_URL"),
+			Repository: getenv("CI_PROJECT_PATH"), Commit: getenv("CI_COMMIT_SHA"), Branch: getenv("CI_COMMIT_REF_NAME")}
+	},
+	func(getenv func(string) string) *Build {
+		if getenv("JENKINS_URL") == "" || getenv("BUILD_URL") == "" {
+			return nil
+		}
+		return &Build{Provider: "jenkins", ID: getenv("BUILD_NUMBER"), URL: getenv("BUILD_URL"),
+			Repository: getenv("JOB_NAME"), Commit: getenv("GIT_COMMIT"), Branch: getenv("GIT_BRANCH")}
+	},
+	func(getenv func(string) string) *Build {
+		if getenv("CIRCLECI") == "" || getenv("CIRCLE_BUILD_NUM") == "" {
+			return nil
+		}
+		b := &Build{Provider: "circleci", ID: getenv("CIRCLE_BUILD_NUM"), URL: getenv("CIRCLE_BUILD_URL"),
+			Commit: getenv("CIRCLE_SHA1"), Branch: getenv("CIRCLE_BRANCH")}
+		if user, repo := getenv("CIRCLE_PROJECT_USERNAME"), getenv("CIRCLE_PROJECT_REPONAME"); user != "" && repo != "" {
+			b.Repository = user + "/" + repo
+		}
+		return b
+	},
+	func(getenv func(string) string) *Build {
+		id := getenv("BUILD_BUILDID")
+		if getenv("TF_BUILD") == "" || id == "" {
+			return nil
+		}
+		b := &Build{Provider: "azure", ID: id, Repository: getenv("BUILD_REPOSITORY_NAME"),
+			Commit: getenv("BUILD_SOURCEVERSION"), Branch: getenv("BUILD_SOURCEBRANCHNAME")}
+		if collection, project := getenv("SYSTEM_COLLECTIONURI"), getenv("SYSTEM_TEAMPROJECT"); collection != "" && project != "" {
+			b.URL = strings.TrimSuffix(collection, "/") + "/" + project + "/_build/results?buildId=" + id
+		}
+		return b
+	},
+}
+
+// Detect returns build of the first CI provider whose environment
+// variables are present, nil is returned outside CI
+func Detect(getenv func(string) string) *Build {
+	for _, p := range providers {
+		if b := p(getenv); b != nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// ParseMetadata parses values of key=value
+func ParseMetadata(values []string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, v := range values {
+		i := strings.Index(v, "=")
+		if i <= 0 {
+			return nil, errors.Errorf("build metadata %#v isn't in the form of key=value", v)
+		}
+		metadata[v[:i]] = v[i+1:]
+	}
+	return metadata, nil
+}
+
+// Apply sets fields of build by metadata of their json names, the rest
+// are kept as extra metadata
+func (b *Build) Apply(metadata map[string]string) {
+	for k, v := range metadata {
+		switch k {
+		case "provider":
+			b.Provider = v
+		case "id":
+			b.ID = v
+		case "url":
+			b.URL = v
+		case "repository":
+			b.Repository = v
+		case "commit":
+			b.Commit = v
+		case "branch":
+			b.Branch = v
+		default:
+			if b.Metadata == nil {
+				b.Metadata = map[string]string{}
+			}
+			b.Metadata[k] = v
+		}
+	}
+}
+
+// Ref returns reference to build
+func (b *Build) Ref() *Ref {
+	return &Ref{Provider: b.Provider, ID: b.ID, URL: b.URL}
+}
+
+// String returns provider and id of build for display
+func (r Ref) String() string {
+	s := r.Provider
+	if r.ID != "" {
+		if s != "" {
+			s += " "
+		}
+		s += "#" + r.ID
+	}
+	if s == "" {
+		s = "build"
+	}
+	return s
+}
+
+// Built reports whether image of id known by refs, i.e. references,
+// repo digests and digests, is one of images built. Images built are
+// matched by their digests or normalized references, references
+// without tag are of latest
+func (b *Build) Built(id string, refs []string) bool {
+	candidates := map[string]struct{}{id: {}}
+	for _, ref := range refs {
+		candidates[ref] = struct{}{}
+		if n := normalize(ref); n != "" {
+			candidates[n] = struct{}{}
+		}
+		if i := strings.LastIndex(ref, "@"); i >= 0 {
+			candidates[ref[i+1:]] = struct{}{}
+		}
+	}
+
+	for _, img := range b.Images {
+		if _, ok := candidates[img]; ok {
+			return true
+		}
+		if n := normalize(img); n != "" {
+			if _, ok := candidates[n]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalize returns normalized reference of ref, which is tagged as
+// latest if it has neither tag nor digest. Empty string is returned if
+// ref isn't a reference
+func normalize(ref string) string {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return ""
+	}
+	return reference.TagNameOnly(named).String()
+}
@@ -0,0 +1,84 @@
+package cibuild
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(k string) string {
+		return vars[k]
+	}
+}
+
+func TestDetect(t *testing.T) {
+	assert.Nil(t, Detect(env(nil)))
+
+	assert.Equal(t, &Build{
+		Provider:   "github",
+		ID:         "42",
+		URL:        "https://github.com/chaitin/app/actions/runs/42",
+		Repository: "chaitin/app",
+		Commit:     "abc",
+		Branch:     "main",
+	}, Detect(env(map[string]string{
+		"GITHUB_RUN_ID":     "42",
+		"GITHUB_REPOSITORY": "chaitin/app",
+		"GITHUB_SHA":        "abc",
+		"GITHUB_REF_NAME":   "main",
+	})))
+
+	assert.Equal(t, &Build{
+		Provider:   "gitlab",
+		ID:         "7",
+		URL:        "https://gitlab.example.com/team/app/-/pipelines/7",
+		Repository: "team/app",
+	}, Detect(env(map[string]string{
+		"CI_PIPELINE_ID":  "7",
+		"CI_PIPELINE_URL": "https://gitlab.example.com/team/app/-/pipelines/7",
+		"CI_PROJECT_PATH": "team/app",
+	})))
+
+	b := Detect(env(map[string]string{
+		"TF_BUILD":             "True",
+		"BUILD_BUILDID":        "9",
+		"SYSTEM_COLLECTIONURI": "https://dev.azure.com/org/",
+		"SYSTEM_TEAMPROJECT":   "app",
+	}))
+	require.NotNil(t, b)
+	assert.Equal(t, "https://dev.azure.com/org/app/_build/results?buildId=9", b.URL)
+
+	// Jenkins is told by its own variables, BUILD_URL alone isn't
+	assert.Nil(t, Detect(env(map[string]string{"BUILD_URL": "https://ci/job/1/"})))
+}
+
+func TestApply(t *testing.T) {
+	metadata, err := ParseMetadata([]string{"url=https://ci/1", "team=infra", "note=a=b"})
+	require.NoError(t, err)
+
+	b := &Build{Provider: "github", ID: "42", URL: "https://github.com/chaitin/app/actions/runs/42"}
+	b.Apply(metadata)
+	assert.Equal(t, "https://ci/1", b.URL)
+	assert.Equal(t, map[string]string{"team": "infra", "note": "a=b"}, b.Metadata)
+	assert.Equal(t, "github #42", b.Ref().String())
+
+	_, err = ParseMetadata([]string{"=value"})
+	assert.Error(t, err)
+	_, err = ParseMetadata([]string{"key"})
+	assert.Error(t, err)
+}
+
+func TestBuilt(t *testing.T) {
+	digest := "sha256:" + "ab12ab12ab12ab12ab12ab12ab12ab12ab12ab12ab12ab12ab12ab12ab12ab12"
+	b := &Build{Images: []string{"registry.example.com/team/app:1.0", "nginx", digest}}
+
+	assert.True(t, b.Built("sha256:aa", []string{"registry.example.com/team/app:1.0"}))
+	assert.True(t, b.Built("sha256:aa", []string{"docker.io/library/nginx:latest"}))
+	assert.True(t, b.Built("sha256:aa", []string{"registry.example.com/team/other@" + digest}))
+	assert.True(t, b.Built(digest, nil))
+
+	assert.False(t, b.Built("sha256:aa", []string{"registry.example.com/team/app:2.0"}))
+	assert.False(t, b.Built("sha256:aa", []string{"nginx:1.25"}))
+	assert.False(t, (&Build{}).Built("sha256:aa", []string{"nginx"}))
+}
@@ -0,0 +1,210 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sendTimeout limits sending a batch to collector
+const sendTimeout = 30 * time.Second
+
+// ErrProtocolMismatch is returned when collector speaks another version
+var ErrProtocolMismatch = errors.New("collector: protocol version not match")
+
+// RetryableError is returned when batch should be sent again later
+type RetryableError struct {
+	After time.Duration
+	Err   error
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+// Spool buffers batches on disk until collector accepts them, so that
+// events aren't lost when collector is unreachable
+type Spool struct {
+	dir  string
+	conn *grpc.ClientConn
+	mu   sync.Mutex
+}
+
+// NewSpool returns spool in dir sending batches to collector at addr,
+// e.g. collector:8443, over mutual TLS of tlsConfig. Collector is
+// connected lazily so that batches are spooled while it's unreachable
+func NewSpool(dir string, addr string, tlsConfig *tls.Config) (*Spool, error) {
+	if strings.Contains(addr, "://") {
+		return nil, errors.Errorf("collector: %#v is not an address, e.g. collector:8443", addr)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Spool{
+		dir:  dir,
+		conn: conn,
+	}, nil
+}
+
+// Close closes connection to collector, spooled batches are kept
+func (s *Spool) Close() error {
+	return s.conn.Close()
+}
+
+// NextSeq returns seq of the next batch, it's larger than seq of any
+// spooled batch and the last run
+func (s *Spool) NextSeq() uint64 {
+	seq := uint64(time.Now().UnixNano())
+	if seqs, err := s.seqs(); err == nil && len(seqs) > 0 && seqs[len(seqs)-1] >= seq {
+		seq = seqs[len(seqs)-1] + 1
+	}
+
+	return seq
+}
+
+// Enqueue writes batch to spool
+func (s *Spool) Enqueue(b Batch) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := filepath.Join(s.dir, fmt.Sprintf("%020d.json", b.Seq))
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// Pending returns number of spooled batches
+func (s *Spool) Pending() int {
+	seqs, _ := s.seqs()
+	return len(seqs)
+}
+
+// Flush sends spooled batches in order, it stops at the first failure
+// and the rest are kept for the next flush
+func (s *Spool) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seqs, err := s.seqs()
+	if err != nil {
+		return err
+	}
+
+	for _, seq := range seqs {
+		name := filepath.Join(s.dir, fmt.Sprintf("%020d.json", seq))
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		b := Batch{}
+		err = json.Unmarshal(data, &b)
+		if err == nil {
+			err = s.send(ctx, b)
+		}
+		if err != nil {
+			var retryable *RetryableError
+			if errors.As(err, &retryable) || errors.Is(err, ErrProtocolMismatch) {
+				return err
+			}
+
+			// Batch refused by collector is set aside rather than
+			// blocking the batches after it
+			log.Errorf("Batch %d is refused and kept as rejected: %s\n", seq, err.Error())
+			if err := os.Rename(name, name+".rejected"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Spool) send(ctx context.Context, b Batch) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, MetadataProtocol, strconv.Itoa(ProtocolVersion))
+
+	trailer := metadata.MD{}
+	err := s.conn.Invoke(ctx, sendMethod, &b, &Ack{},
+		grpc.CallContentSubtype(codec{}.Name()), grpc.Trailer(&trailer))
+
+	switch status.Code(err) {
+	case codes.OK:
+		return nil
+	case codes.FailedPrecondition, codes.Unimplemented:
+		version := "another version"
+		if v := trailer.Get(MetadataProtocol); len(v) > 0 {
+			version = v[0]
+		}
+		return errors.Wrapf(ErrProtocolMismatch, "agent speaks %d, collector speaks %s", ProtocolVersion, version)
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled, codes.Aborted:
+		after := 0
+		if v := trailer.Get(MetadataRetryAfter); len(v) > 0 {
+			after, _ = strconv.Atoi(v[0])
+		}
+		return &RetryableError{
+			After: time.Duration(after) * time.Second,
+			Err:   errors.Wrap(err, "collector"),
+		}
+	default:
+		return errors.Wrap(err, "collector")
+	}
+}
+
+func (s *Spool) seqs() ([]uint64, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	seqs := []uint64{}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(e.Name(), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	return seqs, nil
+}
@@ -0,0 +1,283 @@
+package collector
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/history"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTLSConfigs returns TLS configs of collector and agent for mutual
+// TLS, agent presents a certificate of common name agent
+func newTLSConfigs(t *testing.T, agent string) (*tls.Config, *tls.Config) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	issue := func(serial int64, cn string, usage x509.ExtKeyUsage) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+
+	server := &tls.Config{
+		Certificates: []tls.Certificate{issue(2, "collector", x509.ExtKeyUsageServerAuth)},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	client := &tls.Config{
+		Certificates: []tls.Certificate{issue(3, agent, x509.ExtKeyUsageClientAuth)},
+		RootCAs:      pool,
+	}
+	return server, client
+}
+
+// serve serves gRPC server on a local port and returns its address
+func serve(t *testing.T, server *grpc.Server) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(lis)
+	return lis.Addr().String()
+}
+
+// newSpool returns spool of agent connected to collector serving
+// server, collector stops with the returned function
+func newSpool(t *testing.T, server *Server, agent string) (*Spool, func()) {
+	serverTLS, clientTLS := newTLSConfigs(t, agent)
+	gs := server.GRPCServer(serverTLS)
+	addr := serve(t, gs)
+
+	spool, err := NewSpool(t.TempDir(), addr, clientTLS)
+	require.NoError(t, err)
+	t.Cleanup(func() { spool.Close() })
+	return spool, gs.Stop
+}
+
+func newBatch(seq uint64) Batch {
+	return Batch{
+		Agent: "host-1",
+		Host:  "host-1",
+		Seq:   seq,
+		Time:  time.Now(),
+		Events: []reporter.Event{{ReportEvent: report.ReportEvent{
+			ID:        "sha256:aa",
+			Level:     report.High,
+			AlertType: report.Weakpass,
+		}}},
+	}
+}
+
+func TestSpoolFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := history.Open(filepath.Join(dir, "history.jsonl"))
+	assert.NoError(t, err)
+	defer store.Close()
+
+	server := NewServer(store, 1, 1<<20)
+	spool, stop := newSpool(t, server, "host-1")
+	assert.NoError(t, spool.Enqueue(newBatch(1)))
+	assert.NoError(t, spool.Enqueue(newBatch(2)))
+
+	// Queue of collector is full since no worker persists batches
+	err = spool.Flush(context.Background())
+	var retryable *RetryableError
+	assert.True(t, errors.As(err, &retryable))
+	assert.Equal(t, 5*time.Second, retryable.After)
+	assert.Equal(t, 1, spool.Pending())
+
+	persisted := make(chan struct{})
+	go func() {
+		defer close(persisted)
+		server.Run()
+	}()
+	defer func() {
+		server.Close()
+		<-persisted
+	}()
+	assert.Eventually(t, func() bool {
+		return spool.Flush(context.Background()) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, spool.Pending())
+
+	// Collector is unreachable, batch is kept
+	stop()
+	assert.NoError(t, spool.Enqueue(newBatch(3)))
+	err = spool.Flush(context.Background())
+	assert.True(t, errors.As(err, &retryable))
+	assert.Equal(t, 1, spool.Pending())
+
+	assert.Eventually(t, func() bool {
+		records, err := store.Records()
+		return err == nil && len(records) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// otherVersion is collector speaking protocol version 2
+type otherVersion struct{}
+
+func (otherVersion) Send(ctx context.Context, b *Batch) (*Ack, error) {
+	_ = grpc.SetTrailer(ctx, metadata.Pairs(MetadataProtocol, "2"))
+	return nil, status.Error(codes.FailedPrecondition, "protocol version not match")
+}
+
+func TestProtocolMismatch(t *testing.T) {
+	serverTLS, clientTLS := newTLSConfigs(t, "host-1")
+
+	other := grpc.NewServer(grpc.Creds(credentials.NewTLS(serverTLS)))
+	other.RegisterService(&serviceDesc, otherVersion{})
+	defer other.Stop()
+	// Collector of another version serves no service of this version
+	unknown := grpc.NewServer(grpc.Creds(credentials.NewTLS(serverTLS)))
+	defer unknown.Stop()
+
+	for _, addr := range []string{serve(t, other), serve(t, unknown)} {
+		spool, err := NewSpool(t.TempDir(), addr, clientTLS)
+		require.NoError(t, err)
+		defer spool.Close()
+		assert.NoError(t, spool.Enqueue(newBatch(1)))
+
+		err = spool.Flush(context.Background())
+		assert.True(t, errors.Is(err, ErrProtocolMismatch), addr)
+		assert.Equal(t, 1, spool.Pending())
+	}
+	assert.Contains(t, func() string {
+		spool, err := NewSpool(t.TempDir(), serve(t, other), clientTLS)
+		require.NoError(t, err)
+		defer spool.Close()
+		return spool.send(context.Background(), newBatch(1)).Error()
+	}(), "collector speaks 2")
+
+	_, err := NewSpool(t.TempDir(), "https://collector:8443", clientTLS)
+	assert.Error(t, err)
+}
+
+func TestHistoryDeduplicate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history.jsonl")
+	store, err := history.Open(path)
+	assert.NoError(t, err)
+
+	stored, err := store.Append(history.Record{Agent: "host-1", Seq: 1})
+	assert.NoError(t, err)
+	assert.True(t, stored)
+	assert.NoError(t, store.Close())
+
+	// Retried batch is stored once across restarts
+	store, err = history.Open(path)
+	assert.NoError(t, err)
+	defer store.Close()
+	stored, err = store.Append(history.Record{Agent: "host-1", Seq: 1})
+	assert.NoError(t, err)
+	assert.False(t, stored)
+}
+
+func TestServerShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "collector")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := history.Open(filepath.Join(dir, "history.jsonl"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	server := NewServer(store, 2, 1<<20)
+	spool, stop := newSpool(t, server, "host-1")
+	defer stop()
+	assert.NoError(t, spool.send(context.Background(), newBatch(1)))
+	assert.NoError(t, spool.send(context.Background(), newBatch(2)))
+
+	// Batches acknowledged before shutdown are persisted
+	server.Close()
+	err = spool.send(context.Background(), newBatch(3))
+	var retryable *RetryableError
+	assert.True(t, errors.As(err, &retryable))
+	server.Run()
+	records, err := store.Records()
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+}
+
+func TestServerRefuse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "collector")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := history.Open(filepath.Join(dir, "history.jsonl"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	server := NewServer(store, 1, 1024)
+	defer server.Close()
+	spool, stop := newSpool(t, server, "host-2")
+	defer stop()
+
+	// Agent can't write records under the name of another agent
+	err = spool.send(context.Background(), newBatch(1))
+	assert.Equal(t, codes.PermissionDenied, status.Code(errors.Cause(err)))
+
+	b := newBatch(1)
+	b.Agent = "host-2"
+	for len(b.Events) < 100 {
+		b.Events = append(b.Events, b.Events[0])
+	}
+	err = spool.send(context.Background(), b)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(errors.Cause(err)))
+
+	b.Events = b.Events[:1]
+	// Batch without protocol version is refused
+	err = spool.conn.Invoke(context.Background(), sendMethod, &b, &Ack{}, grpc.CallContentSubtype(codec{}.Name()))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	assert.NoError(t, spool.send(context.Background(), b))
+}
@@ -0,0 +1,125 @@
+// Package collector streams events of agents to a central collector
+// over gRPC with mutual TLS
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"io/ioutil"
+	"time"
+)
+
+// ProtocolVersion is the version of agent collector protocol, collector
+// refuses batches of other versions
+const ProtocolVersion = 1
+
+const (
+	// MetadataProtocol is the gRPC metadata carrying ProtocolVersion
+	MetadataProtocol = "x-veinmind-protocol"
+	// MetadataRetryAfter is the gRPC trailer carrying seconds to wait
+	// before sending batch again
+	MetadataRetryAfter = "retry-after"
+
+	serviceName = "veinmind.collector.v1.Collector"
+	sendMethod  = "/" + serviceName + "/Send"
+)
+
+// Batch is the events of a run of agent
+type Batch struct {
+	Agent  string           `json:"agent"`
+	Host   string           `json:"host"`
+	Seq    uint64           `json:"seq"`
+	Time   time.Time        `json:"time"`
+	Events []reporter.Event `json:"events"`
+}
+
+// Ack acknowledges batch queued by collector
+type Ack struct{}
+
+// codec marshals messages of collector service as JSON, events are
+// the same documents as of reports so they aren't redefined in protobuf
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return "json"
+}
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// collectorService is implemented by Server
+type collectorService interface {
+	Send(ctx context.Context, b *Batch) (*Ack, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*collectorService)(nil),
+	Methods:     []grpc.MethodDesc{{MethodName: "Send", Handler: sendHandler}},
+	Streams:     []grpc.StreamDesc{},
+}
+
+func sendHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	b := &Batch{}
+	if err := dec(b); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(collectorService).Send(ctx, b)
+	}
+
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: sendMethod}
+	return interceptor(ctx, b, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(collectorService).Send(ctx, req.(*Batch))
+	})
+}
+
+// TLSConfig loads certificate and CA for mutual TLS, peers must present
+// certificates signed by CA
+func TLSConfig(certFile string, keyFile string, caFile string, server bool) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" || caFile == "" {
+		return nil, errors.New("collector: certificate, key and CA are required for mutual TLS")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.Errorf("collector: no certificate found in CA %#v", caFile)
+	}
+
+	c := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if server {
+		c.ClientCAs = pool
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		c.RootCAs = pool
+	}
+
+	return c, nil
+}
@@ -0,0 +1,138 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/history"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"sync"
+)
+
+// Server receives batches of agents and persists them into history,
+// batches are queued and refused when the queue is full
+type Server struct {
+	store *history.Store
+	queue chan Batch
+	// maxBatchSize limits bytes of message of a batch
+	maxBatchSize int64
+	mu           sync.RWMutex
+	closed       bool
+}
+
+func NewServer(store *history.Store, queueSize int, maxBatchSize int64) *Server {
+	return &Server{
+		store:        store,
+		queue:        make(chan Batch, queueSize),
+		maxBatchSize: maxBatchSize,
+	}
+}
+
+// Run persists queued batches until server is closed and batches
+// queued before are all persisted, batches acknowledged to agents are
+// never lost on shutdown
+func (s *Server) Run() {
+	for b := range s.queue {
+		stored, err := s.store.Append(history.Record{
+			Agent:  b.Agent,
+			Host:   b.Host,
+			Seq:    b.Seq,
+			Time:   b.Time,
+			Events: b.Events,
+		})
+		if err != nil {
+			log.Errorf("Persist batch %d of agent %#v error: %s\n", b.Seq, b.Agent, err.Error())
+		} else if stored {
+			log.Infof("Collect %d event(s) of agent %#v\n", len(b.Events), b.Agent)
+		}
+	}
+}
+
+// Close refuses batches from now on, Run returns once queued batches
+// are persisted
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+}
+
+// GRPCServer returns gRPC server serving s to agents over mutual TLS,
+// batches larger than maxBatchSize are refused with ResourceExhausted
+func (s *Server) GRPCServer(tlsConfig *tls.Config) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(tlsConfig)),
+		grpc.MaxRecvMsgSize(int(s.maxBatchSize)),
+	)
+	server.RegisterService(&serviceDesc, s)
+	return server
+}
+
+// Send queues batch of agent, it's refused with Unavailable and a
+// retry-after trailer when the queue is full or server is closed
+func (s *Server) Send(ctx context.Context, b *Batch) (*Ack, error) {
+	version := 0
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(MetadataProtocol)) > 0 {
+		version, _ = strconv.Atoi(md.Get(MetadataProtocol)[0])
+	}
+	if version != ProtocolVersion {
+		_ = grpc.SetTrailer(ctx, metadata.Pairs(MetadataProtocol, strconv.Itoa(ProtocolVersion)))
+		return nil, status.Error(codes.FailedPrecondition, "protocol version not match")
+	}
+
+	if b.Agent == "" || b.Seq == 0 {
+		return nil, status.Error(codes.InvalidArgument, "agent and seq are required")
+	}
+
+	// Agent writes records under the name of its certificate only
+	if !certifiedAgent(ctx, b.Agent) {
+		return nil, status.Error(codes.PermissionDenied, "agent not match certificate")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		_ = grpc.SetTrailer(ctx, metadata.Pairs(MetadataRetryAfter, "5"))
+		return nil, status.Error(codes.Unavailable, "collector is shutting down")
+	}
+	select {
+	case s.queue <- *b:
+		return &Ack{}, nil
+	default:
+		_ = grpc.SetTrailer(ctx, metadata.Pairs(MetadataRetryAfter, "5"))
+		return nil, status.Error(codes.Unavailable, "collector is busy")
+	}
+}
+
+// certifiedAgent tells if agent is the common name or a DNS name of
+// verified client certificate of peer of ctx
+func certifiedAgent(ctx context.Context, agent string) bool {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 {
+		return false
+	}
+
+	cert := info.State.VerifiedChains[0][0]
+	if cert.Subject.CommonName == agent {
+		return true
+	}
+	for _, name := range cert.DNSNames {
+		if name == agent {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+// Package compare computes the delta of findings between two images
+package compare
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layer"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"sort"
+)
+
+// Delta is the report of compare command
+type Delta struct {
+	Base       string    `json:"base"`
+	Target     string    `json:"target"`
+	Introduced []Finding `json:"introduced"`
+	Fixed      []Finding `json:"fixed"`
+	Unchanged  []Finding `json:"unchanged"`
+}
+
+type Finding struct {
+	reporter.Event
+	// Layers attributes paths of finding to layers of target image
+	Layers []layer.Layer `json:"layers,omitempty"`
+}
+
+// Key identifies the same finding in different images, it's derived
+// from input of fingerprint without the image, so that runs reporting
+// fingerprints of other versions are still compared
+func Key(event report.ReportEvent) string {
+	in := report.NewFingerprintInput(event)
+	in.Digest = ""
+	return in.Sum()
+}
+
+// Compare splits findings of base and target image into introduced,
+// fixed and unchanged findings, unchanged findings are the ones of target
+func Compare(base []reporter.Event, target []reporter.Event) Delta {
+	d := Delta{
+		Introduced: []Finding{},
+		Fixed:      []Finding{},
+		Unchanged:  []Finding{},
+	}
+
+	baseKeys := map[string]struct{}{}
+	for _, evt := range base {
+		baseKeys[Key(evt.ReportEvent)] = struct{}{}
+	}
+
+	targetKeys := map[string]struct{}{}
+	for _, evt := range target {
+		key := Key(evt.ReportEvent)
+		if _, ok := targetKeys[key]; ok {
+			continue
+		}
+		targetKeys[key] = struct{}{}
+
+		if _, ok := baseKeys[key]; ok {
+			d.Unchanged = append(d.Unchanged, Finding{Event: evt})
+		} else {
+			d.Introduced = append(d.Introduced, Finding{Event: evt})
+		}
+	}
+
+	for _, evt := range base {
+		key := Key(evt.ReportEvent)
+		if _, ok := targetKeys[key]; ok {
+			continue
+		}
+		// Mark as seen so that duplicated events are fixed once
+		targetKeys[key] = struct{}{}
+		d.Fixed = append(d.Fixed, Finding{Event: evt})
+	}
+
+	return d
+}
+
+// Attribute attributes paths of introduced findings to layers
+func (d *Delta) Attribute(locate layer.Locator) {
+	if locate == nil {
+		return
+	}
+
+	for i := range d.Introduced {
+		f := &d.Introduced[i]
+		paths := reporter.Paths(f.AlertDetails)
+		sort.Strings(paths)
+		for _, p := range paths {
+			if l, ok := locate(p); ok {
+				f.Layers = append(f.Layers, l)
+			}
+		}
+	}
+}
+
+// Events returns events of introduced findings
+func (d *Delta) Events() []reporter.Event {
+	events := make([]reporter.Event, 0, len(d.Introduced))
+	for _, f := range d.Introduced {
+		events = append(events, f.Event)
+	}
+
+	return events
+}
@@ -0,0 +1,58 @@
+package compare
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layer"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newEvent(id string, path string) reporter.Event {
+	return reporter.Event{ReportEvent: report.ReportEvent{
+		ID:        id,
+		Level:     report.High,
+		AlertType: report.Backdoor,
+		AlertDetails: []report.AlertDetail{{
+			BackdoorDetail: &report.BackdoorDetail{FileDetail: report.FileDetail{Path: path}},
+		}},
+	}}
+}
+
+func TestCompare(t *testing.T) {
+	base := []reporter.Event{
+		newEvent("sha256:aa", "/etc/cron.d/job"),
+		newEvent("sha256:aa", "/root/.bashrc"),
+	}
+	target := []reporter.Event{
+		newEvent("sha256:bb", "/root/.bashrc"),
+		newEvent("sha256:bb", "/usr/bin/backdoor"),
+		newEvent("sha256:bb", "/usr/bin/backdoor"),
+	}
+
+	d := Compare(base, target)
+	assert.Len(t, d.Introduced, 1)
+	assert.Equal(t, "sha256:bb", d.Introduced[0].ID)
+	assert.Len(t, d.Fixed, 1)
+	assert.Equal(t, "/etc/cron.d/job", d.Fixed[0].AlertDetails[0].BackdoorDetail.Path)
+	assert.Len(t, d.Unchanged, 1)
+	assert.Equal(t, "sha256:bb", d.Unchanged[0].ID)
+	assert.Len(t, d.Events(), 1)
+}
+
+func TestAttribute(t *testing.T) {
+	d := Compare(nil, []reporter.Event{
+		newEvent("sha256:bb", "/usr/bin/backdoor"),
+		newEvent("sha256:bb", "/tmp/gone"),
+	})
+
+	d.Attribute(func(path string) (layer.Layer, bool) {
+		if path == "/usr/bin/backdoor" {
+			return layer.Layer{Path: path, Index: 3, ID: "sha256:cc"}, true
+		}
+		return layer.Layer{}, false
+	})
+
+	assert.Equal(t, []layer.Layer{{Path: "/usr/bin/backdoor", Index: 3, ID: "sha256:cc"}}, d.Introduced[0].Layers)
+	assert.Empty(t, d.Introduced[1].Layers)
+}
@@ -0,0 +1,47 @@
+// Package compat checks API versions declared by plugins against the
+// range supported by runner, plugins built with an incompatible SDK
+// may run but report malformed events
+package compat
+
+import "fmt"
+
+// Range of plugin API version supported by runner, the API version of
+// a plugin is the manifest version declared by its SDK
+const (
+	MinAPIVersion = 1
+	MaxAPIVersion = 1
+)
+
+// statuses of compatibility
+const (
+	StatusCompatible = "compatible"
+	StatusTooOld     = "too-old"
+	StatusTooNew     = "too-new"
+)
+
+type Result struct {
+	Status string
+	Reason string
+}
+
+func (r Result) Compatible() bool {
+	return r.Status == StatusCompatible
+}
+
+// Check checks API version of plugin against the supported range
+func Check(version int) Result {
+	supported := fmt.Sprintf("supported %d-%d", MinAPIVersion, MaxAPIVersion)
+	switch {
+	case version < MinAPIVersion:
+		return Result{
+			Status: StatusTooOld,
+			Reason: fmt.Sprintf("plugin API version %d is older than runner supports (%s), rebuild plugin with a newer SDK", version, supported),
+		}
+	case version > MaxAPIVersion:
+		return Result{
+			Status: StatusTooNew,
+			Reason: fmt.Sprintf("plugin API version %d is newer than runner supports (%s), upgrade runner", version, supported),
+		}
+	}
+	return Result{Status: StatusCompatible}
+}
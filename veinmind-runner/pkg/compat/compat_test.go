@@ -0,0 +1,47 @@
+package compat
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		version int
+		status  string
+	}{
+		{version: 0, status: StatusTooOld},
+		{version: MinAPIVersion, status: StatusCompatible},
+		{version: MaxAPIVersion, status: StatusCompatible},
+		{version: MaxAPIVersion + 1, status: StatusTooNew},
+	}
+
+	for _, tt := range tests {
+		r := Check(tt.version)
+		assert.Equal(t, tt.status, r.Status, tt.version)
+		assert.Equal(t, tt.status == StatusCompatible, r.Compatible())
+		if !r.Compatible() {
+			assert.Contains(t, r.Reason, "supported 1-1")
+		}
+	}
+}
+
+func TestSupportsOS(t *testing.T) {
+	tests := []struct {
+		tags     []string
+		os       string
+		supports bool
+	}{
+		{tags: nil, os: "linux", supports: true},
+		{tags: nil, os: "", supports: true},
+		{tags: nil, os: "windows", supports: false},
+		{tags: []string{"pool", "os:windows"}, os: "windows", supports: true},
+		{tags: []string{"os:windows"}, os: "linux", supports: false},
+		{tags: []string{"os:linux", "os:Windows"}, os: "windows", supports: true},
+		{tags: []string{"os:linux"}, os: "linux", supports: true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.supports, SupportsOS(tt.tags, tt.os), tt.os)
+	}
+}
@@ -0,0 +1,31 @@
+package compat
+
+import "strings"
+
+// OSTagPrefix declares OS of images supported by plugin in tags of its
+// manifest, e.g. os:windows. Plugins without such tags support linux
+// images only
+const OSTagPrefix = "os:"
+
+// DefaultOS is OS of images supported by plugins declaring no OS,
+// images whose OS is unknown are taken as it
+const DefaultOS = "linux"
+
+// SupportsOS reports whether plugin of tags supports images of os
+func SupportsOS(tags []string, os string) bool {
+	if os == "" {
+		os = DefaultOS
+	}
+
+	declared := false
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, OSTagPrefix) {
+			continue
+		}
+		declared = true
+		if strings.EqualFold(strings.TrimPrefix(tag, OSTagPrefix), os) {
+			return true
+		}
+	}
+	return !declared && os == DefaultOS
+}
@@ -0,0 +1,482 @@
+// Package cosign verifies cosign signatures which are stored
+// alongside images in the registry
+package cosign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureAnnotation   = "dev.cosignproject.cosign/signature"
+	CertificateAnnotation = "dev.sigstore.cosign/certificate"
+	ChainAnnotation       = "dev.sigstore.cosign/chain"
+	BundleAnnotation      = "dev.sigstore.cosign/bundle"
+	SignatureTagSuffix    = ".sig"
+)
+
+var (
+	ErrNoSignature      = errors.New("cosign: no signature found")
+	ErrInvalidSignature = errors.New("cosign: no signature matches the given key")
+
+	// oidcIssuerOID is the certificate extension where fulcio records
+	// the OIDC issuer of the signer
+	oidcIssuerOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+)
+
+// Signature is a single signature layer of the signature image
+type Signature struct {
+	Payload     []byte
+	Signature   []byte
+	Certificate *x509.Certificate
+	Chain       []*x509.Certificate
+	// Bundle proves the signature is recorded in the transparency log
+	Bundle *Bundle
+}
+
+// Bundle is the transparency log entry of signature which rekor signs
+// in SignedEntryTimestamp, it's verified offline
+type Bundle struct {
+	SignedEntryTimestamp []byte        `json:"SignedEntryTimestamp"`
+	Payload              BundlePayload `json:"Payload"`
+}
+
+type BundlePayload struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogIndex       int64  `json:"logIndex"`
+	LogID          string `json:"logID"`
+}
+
+// hashedRekord is the transparency log entry body of signature
+type hashedRekord struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content   []byte `json:"content"`
+			PublicKey struct {
+				Content []byte `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+type simpleSigning struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+// LoadPublicKey parse PEM encoded public key from path, or fetch it from
+// key management service of reference such as hashivault://key
+func LoadPublicKey(ref string) (crypto.PublicKey, error) {
+	if i := strings.Index(ref, "://"); i > 0 {
+		b, err := fetchPublicKey(ref[:i], ref[i+len("://"):])
+		if err != nil {
+			return nil, errors.Wrapf(err, "cosign: fetch key %#v", ref)
+		}
+		return ParsePublicKey(b)
+	}
+
+	b, err := ioutil.ReadFile(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePublicKey(b)
+}
+
+// ParsePublicKey parse PEM encoded public key
+func ParsePublicKey(b []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("cosign: public key is not PEM encoded")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cosign")
+	}
+
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, errors.Errorf("cosign: unsupported public key type %T", key)
+	}
+}
+
+// SignatureTag returns the tag where cosign stores signatures of ref
+func SignatureTag(ref name.Digest) name.Tag {
+	tag := strings.Replace(ref.DigestStr(), ":", "-", 1) + SignatureTagSuffix
+	return ref.Context().Tag(tag)
+}
+
+// FetchSignatures fetch all signature layers attached to ref
+func FetchSignatures(ref name.Digest, opts ...remote.Option) ([]Signature, error) {
+	desc, err := remote.Get(SignatureTag(ref), opts...)
+	if err != nil {
+		return nil, errors.Wrap(ErrNoSignature, err.Error())
+	}
+
+	image, err := desc.Image()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := image.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	signatures := []Signature{}
+	for _, l := range manifest.Layers {
+		sigB64, ok := l.Annotations[SignatureAnnotation]
+		if !ok {
+			continue
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(sigB64)
+		if err != nil {
+			continue
+		}
+
+		layer, err := image.LayerByDigest(l.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		rc, err := layer.Compressed()
+		if err != nil {
+			return nil, err
+		}
+		payload, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		s := Signature{
+			Payload:   payload,
+			Signature: sig,
+		}
+
+		if certPEM, ok := l.Annotations[CertificateAnnotation]; ok {
+			certs, err := parseCertificates([]byte(certPEM))
+			if err == nil && len(certs) > 0 {
+				s.Certificate = certs[0]
+			}
+		}
+
+		if chainPEM, ok := l.Annotations[ChainAnnotation]; ok {
+			certs, err := parseCertificates([]byte(chainPEM))
+			if err == nil {
+				s.Chain = certs
+			}
+		}
+
+		if bundleJSON, ok := l.Annotations[BundleAnnotation]; ok {
+			b := &Bundle{}
+			if err := json.Unmarshal([]byte(bundleJSON), b); err == nil {
+				s.Bundle = b
+			}
+		}
+
+		signatures = append(signatures, s)
+	}
+
+	if len(signatures) == 0 {
+		return nil, ErrNoSignature
+	}
+
+	return signatures, nil
+}
+
+// VerifyWithKey returns the first signature of ref which is signed by key
+// and whose payload refers to the digest of ref
+func VerifyWithKey(ref name.Digest, key crypto.PublicKey, opts ...remote.Option) (*Signature, error) {
+	signatures, err := FetchSignatures(ref, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return verifyKey(ref, signatures, key)
+}
+
+func verifyKey(ref name.Digest, signatures []Signature, key crypto.PublicKey) (*Signature, error) {
+	for _, s := range signatures {
+		if err := checkPayload(ref, s.Payload); err != nil {
+			continue
+		}
+
+		if verifySignature(key, s.Payload, s.Signature) {
+			sig := s
+			return &sig, nil
+		}
+	}
+
+	return nil, ErrInvalidSignature
+}
+
+// CertificateOptions constrains signatures which carry a certificate
+// instead of being signed by a long-lived key (keyless signing)
+type CertificateOptions struct {
+	// Roots verifies the certificate chain of signatures, certificates
+	// are checked at the time signatures are recorded in the
+	// transparency log since they are short-lived
+	Roots *x509.CertPool
+	// RekorKey verifies signed entry timestamps of transparency log
+	// bundles of signatures
+	RekorKey crypto.PublicKey
+	// Identity is the expected email or URI of the signer
+	Identity string
+	// Issuer is the expected OIDC issuer of the signer
+	Issuer string
+}
+
+// VerifyWithCertificate returns the first signature of ref which carries
+// a certificate satisfying opts and is signed by that certificate. The
+// signature must be recorded in the transparency log while the
+// certificate is valid, so that a leaked ephemeral key can't sign later
+func VerifyWithCertificate(ref name.Digest, opts CertificateOptions, ropts ...remote.Option) (*Signature, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	signatures, err := FetchSignatures(ref, ropts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return verifyCertificate(ref, signatures, opts)
+}
+
+func (opts CertificateOptions) validate() error {
+	switch {
+	case opts.Roots == nil:
+		return errors.New("cosign: certificate roots must be specified")
+	case opts.RekorKey == nil:
+		return errors.New("cosign: rekor public key must be specified to verify transparency log")
+	case opts.Identity == "" || opts.Issuer == "":
+		return errors.New("cosign: certificate identity and issuer must be specified")
+	}
+	return nil
+}
+
+func verifyCertificate(ref name.Digest, signatures []Signature, opts CertificateOptions) (*Signature, error) {
+	for _, s := range signatures {
+		if s.Certificate == nil {
+			continue
+		}
+
+		if err := checkPayload(ref, s.Payload); err != nil {
+			continue
+		}
+
+		if err := checkCertificate(s, opts); err != nil {
+			continue
+		}
+
+		if verifySignature(s.Certificate.PublicKey, s.Payload, s.Signature) {
+			sig := s
+			return &sig, nil
+		}
+	}
+
+	return nil, ErrInvalidSignature
+}
+
+func checkCertificate(s Signature, opts CertificateOptions) error {
+	integrated, err := checkBundle(s, opts.RekorKey)
+	if err != nil {
+		return err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range s.Chain {
+		intermediates.AddCert(c)
+	}
+
+	_, err = s.Certificate.Verify(x509.VerifyOptions{
+		Roots:         opts.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   integrated,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.Identity() != opts.Identity {
+		return errors.Errorf("cosign: identity %#v doesn't match", s.Identity())
+	}
+
+	if s.Issuer() != opts.Issuer {
+		return errors.Errorf("cosign: issuer %#v doesn't match", s.Issuer())
+	}
+
+	return nil
+}
+
+// checkBundle verifies the transparency log bundle of s is signed by
+// rekor and records s, the time it's recorded is returned
+func checkBundle(s Signature, rekorKey crypto.PublicKey) (time.Time, error) {
+	if s.Bundle == nil {
+		return time.Time{}, errors.New("cosign: no transparency log bundle")
+	}
+
+	// Signed entry timestamp is signed over canonical JSON of payload,
+	// whose keys are sorted and whose values need no escaping
+	canonical, err := json.Marshal(map[string]interface{}{
+		"body":           s.Bundle.Payload.Body,
+		"integratedTime": s.Bundle.Payload.IntegratedTime,
+		"logIndex":       s.Bundle.Payload.LogIndex,
+		"logID":          s.Bundle.Payload.LogID,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !verifySignature(rekorKey, canonical, s.Bundle.SignedEntryTimestamp) {
+		return time.Time{}, errors.New("cosign: signed entry timestamp isn't signed by rekor")
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(rekorKey)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if id := sha256.Sum256(der); s.Bundle.Payload.LogID != hex.EncodeToString(id[:]) {
+		return time.Time{}, errors.Errorf("cosign: log id %#v doesn't match rekor key", s.Bundle.Payload.LogID)
+	}
+
+	body, err := base64.StdEncoding.DecodeString(s.Bundle.Payload.Body)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "cosign: transparency log entry")
+	}
+	entry := hashedRekord{}
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return time.Time{}, errors.Wrap(err, "cosign: transparency log entry")
+	}
+	if entry.Kind != "hashedrekord" {
+		return time.Time{}, errors.Errorf("cosign: transparency log entry kind %#v is not supported", entry.Kind)
+	}
+
+	digest := sha256.Sum256(s.Payload)
+	certs, err := parseCertificates(entry.Spec.Signature.PublicKey.Content)
+	switch {
+	case entry.Spec.Data.Hash.Algorithm != "sha256" || entry.Spec.Data.Hash.Value != hex.EncodeToString(digest[:]):
+		return time.Time{}, errors.New("cosign: transparency log entry doesn't record payload")
+	case string(entry.Spec.Signature.Content) != string(s.Signature):
+		return time.Time{}, errors.New("cosign: transparency log entry doesn't record signature")
+	case err != nil || len(certs) == 0 || !certs[0].Equal(s.Certificate):
+		return time.Time{}, errors.New("cosign: transparency log entry doesn't record certificate")
+	}
+
+	return time.Unix(s.Bundle.Payload.IntegratedTime, 0), nil
+}
+
+// Identity returns the signer identity recorded in the certificate
+func (s *Signature) Identity() string {
+	if s.Certificate == nil {
+		return ""
+	}
+
+	if len(s.Certificate.EmailAddresses) > 0 {
+		return s.Certificate.EmailAddresses[0]
+	}
+
+	if len(s.Certificate.URIs) > 0 {
+		return s.Certificate.URIs[0].String()
+	}
+
+	return ""
+}
+
+// Issuer returns the OIDC issuer recorded in the certificate
+func (s *Signature) Issuer() string {
+	if s.Certificate == nil {
+		return ""
+	}
+
+	for _, ext := range s.Certificate.Extensions {
+		if ext.Id.Equal(oidcIssuerOID) {
+			return string(ext.Value)
+		}
+	}
+
+	return ""
+}
+
+func checkPayload(ref name.Digest, payload []byte) error {
+	p := simpleSigning{}
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	if p.Critical.Image.DockerManifestDigest != ref.DigestStr() {
+		return errors.Errorf("cosign: payload digest %#v doesn't match %#v",
+			p.Critical.Image.DockerManifestDigest, ref.DigestStr())
+	}
+
+	return nil
+}
+
+func verifySignature(key crypto.PublicKey, payload []byte, sig []byte) bool {
+	digest := sha256.Sum256(payload)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, digest[:], sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, payload, sig)
+	default:
+		return false
+	}
+}
+
+func parseCertificates(b []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
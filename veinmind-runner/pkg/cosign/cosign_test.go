@@ -0,0 +1,276 @@
+package cosign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testIdentity = "dev@example.com"
+	testIssuer   = "https://issuer.example.com"
+)
+
+func newDigest(t *testing.T, b byte) name.Digest {
+	d, err := name.NewDigest("registry.example.com/app@sha256:" + strings.Repeat(hex.EncodeToString([]byte{b}), 32))
+	require.NoError(t, err)
+	return d
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, payload []byte) []byte {
+	digest := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+	return sig
+}
+
+func newPayload(t *testing.T, ref name.Digest) []byte {
+	p := simpleSigning{}
+	p.Critical.Identity.DockerReference = ref.Context().String()
+	p.Critical.Image.DockerManifestDigest = ref.DigestStr()
+	p.Critical.Type = "cosign container image signature"
+	b, err := json.Marshal(p)
+	require.NoError(t, err)
+	return b
+}
+
+type testCA struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newCA(t *testing.T) testCA {
+	key := newKey(t)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fulcio"},
+		NotBefore:             time.Now().Add(-48 * time.Hour),
+		NotAfter:              time.Now().Add(48 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return testCA{key: key, cert: cert}
+}
+
+func (ca testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// issue issues short-lived certificate valid for 10 minutes since
+// notBefore, the same as fulcio
+func (ca testCA) issue(t *testing.T, key *ecdsa.PrivateKey, notBefore time.Time, identity string, issuer string) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       notBefore,
+		NotAfter:        notBefore.Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		EmailAddresses:  []string{identity},
+		ExtraExtensions: []pkix.Extension{{Id: oidcIssuerOID, Value: []byte(issuer)}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+// newBundle records s in transparency log signed by rekor at integrated
+func newBundle(t *testing.T, rekor *ecdsa.PrivateKey, s Signature, integrated time.Time) *Bundle {
+	entry := hashedRekord{Kind: "hashedrekord"}
+	digest := sha256.Sum256(s.Payload)
+	entry.Spec.Data.Hash.Algorithm = "sha256"
+	entry.Spec.Data.Hash.Value = hex.EncodeToString(digest[:])
+	entry.Spec.Signature.Content = s.Signature
+	entry.Spec.Signature.PublicKey.Content = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate.Raw})
+	body, err := json.Marshal(entry)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(&rekor.PublicKey)
+	require.NoError(t, err)
+	logID := sha256.Sum256(der)
+	b := &Bundle{Payload: BundlePayload{
+		Body:           base64.StdEncoding.EncodeToString(body),
+		IntegratedTime: integrated.Unix(),
+		LogIndex:       42,
+		LogID:          hex.EncodeToString(logID[:]),
+	}}
+	canonical, err := json.Marshal(map[string]interface{}{
+		"body":           b.Payload.Body,
+		"integratedTime": b.Payload.IntegratedTime,
+		"logIndex":       b.Payload.LogIndex,
+		"logID":          b.Payload.LogID,
+	})
+	require.NoError(t, err)
+	b.SignedEntryTimestamp = sign(t, rekor, canonical)
+	return b
+}
+
+func TestVerifyWithKey(t *testing.T) {
+	ref := newDigest(t, 0xaa)
+	key := newKey(t)
+	payload := newPayload(t, ref)
+
+	cases := []struct {
+		name      string
+		signature Signature
+		key       crypto.PublicKey
+		valid     bool
+	}{
+		{
+			name:      "valid",
+			signature: Signature{Payload: payload, Signature: sign(t, key, payload)},
+			key:       &key.PublicKey,
+			valid:     true,
+		},
+		{
+			name: "digest mismatch",
+			signature: func() Signature {
+				other := newPayload(t, newDigest(t, 0xbb))
+				return Signature{Payload: other, Signature: sign(t, key, other)}
+			}(),
+			key: &key.PublicKey,
+		},
+		{
+			name:      "wrong key",
+			signature: Signature{Payload: payload, Signature: sign(t, key, payload)},
+			key:       &newKey(t).PublicKey,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sig, err := verifyKey(ref, []Signature{c.signature}, c.key)
+			if c.valid {
+				assert.NoError(t, err)
+				assert.Equal(t, c.signature.Signature, sig.Signature)
+			} else {
+				assert.True(t, errors.Is(err, ErrInvalidSignature))
+			}
+		})
+	}
+}
+
+func TestVerifyWithCertificate(t *testing.T) {
+	ref := newDigest(t, 0xaa)
+	payload := newPayload(t, ref)
+	ca := newCA(t)
+	rekor := newKey(t)
+	// Certificate expired long ago, it's valid when signature is recorded
+	issued := time.Now().Add(-24 * time.Hour)
+
+	newSignature := func(ca testCA, identity string, issuer string) Signature {
+		key := newKey(t)
+		return Signature{
+			Payload:     payload,
+			Signature:   sign(t, key, payload),
+			Certificate: ca.issue(t, key, issued, identity, issuer),
+		}
+	}
+	recorded := func(s Signature, rekor *ecdsa.PrivateKey, integrated time.Time) Signature {
+		s.Bundle = newBundle(t, rekor, s, integrated)
+		return s
+	}
+
+	cases := []struct {
+		name      string
+		signature Signature
+		valid     bool
+	}{
+		{
+			name:      "valid",
+			signature: recorded(newSignature(ca, testIdentity, testIssuer), rekor, issued.Add(time.Minute)),
+			valid:     true,
+		},
+		{
+			name:      "chain outside roots",
+			signature: recorded(newSignature(newCA(t), testIdentity, testIssuer), rekor, issued.Add(time.Minute)),
+		},
+		{
+			name:      "identity mismatch",
+			signature: recorded(newSignature(ca, "attacker@example.com", testIssuer), rekor, issued.Add(time.Minute)),
+		},
+		{
+			name:      "issuer mismatch",
+			signature: recorded(newSignature(ca, testIdentity, "https://attacker.example.com"), rekor, issued.Add(time.Minute)),
+		},
+		{
+			name:      "recorded after certificate expires",
+			signature: recorded(newSignature(ca, testIdentity, testIssuer), rekor, issued.Add(time.Hour)),
+		},
+		{
+			name:      "no transparency log bundle",
+			signature: newSignature(ca, testIdentity, testIssuer),
+		},
+		{
+			name:      "bundle not signed by rekor",
+			signature: recorded(newSignature(ca, testIdentity, testIssuer), newKey(t), issued.Add(time.Minute)),
+		},
+		{
+			name: "bundle of another signature",
+			signature: func() Signature {
+				s := newSignature(ca, testIdentity, testIssuer)
+				s.Bundle = recorded(newSignature(ca, testIdentity, testIssuer), rekor, issued.Add(time.Minute)).Bundle
+				return s
+			}(),
+		},
+	}
+
+	opts := CertificateOptions{
+		Roots:    ca.pool(),
+		RekorKey: &rekor.PublicKey,
+		Identity: testIdentity,
+		Issuer:   testIssuer,
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sig, err := verifyCertificate(ref, []Signature{c.signature}, opts)
+			if c.valid {
+				assert.NoError(t, err)
+				assert.Equal(t, testIdentity, sig.Identity())
+				assert.Equal(t, testIssuer, sig.Issuer())
+			} else {
+				assert.True(t, errors.Is(err, ErrInvalidSignature))
+			}
+		})
+	}
+
+	// Keyless verification without constraints accepts any signer
+	for _, o := range []CertificateOptions{
+		{Roots: opts.Roots, RekorKey: opts.RekorKey, Issuer: testIssuer},
+		{Roots: opts.Roots, RekorKey: opts.RekorKey, Identity: testIdentity},
+		{Roots: opts.Roots, Identity: testIdentity, Issuer: testIssuer},
+	} {
+		_, err := VerifyWithCertificate(ref, o)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,222 @@
+package cosign
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kmsTimeout limits fetching public key from key management service
+const kmsTimeout = 30 * time.Second
+
+// keyProviders fetch PEM encoded public keys of key references by
+// scheme, references are the same as of cosign. Keys of awskms and
+// azurekms are exported by `cosign public-key --key` instead
+var keyProviders = map[string]func(ctx context.Context, ref string) ([]byte, error){
+	"hashivault": vaultPublicKey,
+	"gcpkms":     gcpPublicKey,
+	"k8s":        k8sPublicKey,
+}
+
+func fetchPublicKey(scheme string, ref string) ([]byte, error) {
+	fetch, ok := keyProviders[scheme]
+	if !ok {
+		return nil, errors.Errorf("key reference scheme %#v is not supported", scheme)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kmsTimeout)
+	defer cancel()
+	return fetch(ctx, ref)
+}
+
+// vaultPublicKey fetches the latest public key of transit key of vault
+// at VAULT_ADDR, ref is name of the key
+func vaultPublicKey(ctx context.Context, ref string) ([]byte, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, errors.New("VAULT_ADDR is required by hashivault key")
+	}
+	path := os.Getenv("TRANSIT_SECRET_ENGINE_PATH")
+	if path == "" {
+		path = "transit"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(addr, "/")+"/v1/"+path+"/keys/"+url.PathEscape(ref), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+
+	var resp struct {
+		Data struct {
+			LatestVersion int `json:"latest_version"`
+			Keys          map[string]struct {
+				PublicKey string `json:"public_key"`
+			} `json:"keys"`
+		} `json:"data"`
+	}
+	if err := doJSON(http.DefaultClient, req, &resp); err != nil {
+		return nil, err
+	}
+
+	key, ok := resp.Data.Keys[strconv.Itoa(resp.Data.LatestVersion)]
+	if !ok || key.PublicKey == "" {
+		return nil, errors.Errorf("transit key %#v has no public key", ref)
+	}
+	return []byte(key.PublicKey), nil
+}
+
+var (
+	// gcpKMSEndpoint is endpoint of cloud KMS API
+	gcpKMSEndpoint = "https://cloudkms.googleapis.com"
+	// gcpMetadataHost is host of metadata server serving access tokens
+	// of attached service account, GCE_METADATA_HOST overrides it
+	gcpMetadataHost = "metadata.google.internal"
+)
+
+// gcpPublicKey fetches public key of cloud KMS key version, ref is
+// projects/P/locations/L/keyRings/R/cryptoKeys/K[/versions/V] and the
+// latest enabled version is used if version is absent
+func gcpPublicKey(ctx context.Context, ref string) ([]byte, error) {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = gcpMetadataHost
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := doJSON(http.DefaultClient, req, &token); err != nil {
+		return nil, errors.Wrap(err, "metadata server")
+	}
+
+	get := func(path string, v interface{}) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpKMSEndpoint+"/v1/"+path, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		return doJSON(http.DefaultClient, req, v)
+	}
+
+	version := ""
+	if i := strings.Index(ref, "/versions/"); i >= 0 {
+		ref, version = ref[:i], ref[i+len("/versions/"):]
+	} else {
+		var versions struct {
+			CryptoKeyVersions []struct {
+				Name string `json:"name"`
+			} `json:"cryptoKeyVersions"`
+		}
+		if err := get(ref+"/cryptoKeyVersions?filter=state%3DENABLED", &versions); err != nil {
+			return nil, err
+		}
+		numbers := []int{}
+		for _, v := range versions.CryptoKeyVersions {
+			if n, err := strconv.Atoi(filepath.Base(v.Name)); err == nil {
+				numbers = append(numbers, n)
+			}
+		}
+		if len(numbers) == 0 {
+			return nil, errors.Errorf("crypto key %#v has no enabled version", ref)
+		}
+		sort.Ints(numbers)
+		version = strconv.Itoa(numbers[len(numbers)-1])
+	}
+
+	var key struct {
+		PEM string `json:"pem"`
+	}
+	if err := get(fmt.Sprintf("%s/cryptoKeyVersions/%s/publicKey", ref, version), &key); err != nil {
+		return nil, err
+	}
+	return []byte(key.PEM), nil
+}
+
+// k8sServiceAccountDir holds token and CA of in-cluster service account
+var k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// k8sPublicKey reads cosign.pub of secret generated by `cosign
+// generate-key-pair k8s://`, ref is namespace/name. It's read through
+// API server with the in-cluster service account
+func k8sPublicKey(ctx context.Context, ref string) ([]byte, error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, errors.Errorf("k8s key %#v is not namespace/name", ref)
+	}
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("k8s key is only read in cluster")
+	}
+
+	token, err := ioutil.ReadFile(filepath.Join(k8sServiceAccountDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(filepath.Join(k8sServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificate found in CA of service account")
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	u := url.URL{
+		Scheme: "https",
+		Host:   host + ":" + port,
+		Path:   "/api/v1/namespaces/" + parts[0] + "/secrets/" + parts[1],
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+	// Data of secret is base64 encoded, which []byte decodes
+	var secret struct {
+		Data map[string][]byte `json:"data"`
+	}
+	if err := doJSON(client, req, &secret); err != nil {
+		return nil, err
+	}
+	key, ok := secret.Data["cosign.pub"]
+	if !ok {
+		return nil, errors.Errorf("secret %#v has no cosign.pub", ref)
+	}
+	return key, nil
+}
+
+// doJSON sends req and decodes JSON response into v, bodies of failed
+// responses aren't quoted since they may echo credentials
+func doJSON(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s %s: %s", req.Method, req.URL.Redacted(), resp.Status)
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(v), "%s %s", req.Method, req.URL.Redacted())
+}
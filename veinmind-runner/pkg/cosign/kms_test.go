@@ -0,0 +1,106 @@
+package cosign
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func publicKeyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalPKIXPublicKey(&newKey(t).PublicKey)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func setenv(t *testing.T, key string, value string) {
+	old, ok := os.LookupEnv(key)
+	require.NoError(t, os.Setenv(key, value))
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestVaultKey(t *testing.T) {
+	key := publicKeyPEM(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/transit/keys/cosign" || r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+			"latest_version": 2,
+			"keys": map[string]interface{}{
+				"1": map[string]string{"public_key": string(publicKeyPEM(t))},
+				"2": map[string]string{"public_key": string(key)},
+			},
+		}})
+	}))
+	defer ts.Close()
+	setenv(t, "VAULT_ADDR", ts.URL)
+	setenv(t, "VAULT_TOKEN", "s.token")
+
+	loaded, err := LoadPublicKey("hashivault://cosign")
+	require.NoError(t, err)
+	expected, err := ParsePublicKey(key)
+	require.NoError(t, err)
+	assert.Equal(t, expected, loaded)
+
+	_, err = LoadPublicKey("hashivault://other")
+	assert.Error(t, err)
+}
+
+func TestGCPKey(t *testing.T) {
+	key := publicKeyPEM(t)
+	ring := "projects/p/locations/global/keyRings/r/cryptoKeys/cosign"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/computeMetadata/"):
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "ya29.token"})
+		case r.Header.Get("Authorization") != "Bearer ya29.token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v1/"+ring+"/cryptoKeyVersions":
+			json.NewEncoder(w).Encode(map[string]interface{}{"cryptoKeyVersions": []map[string]string{
+				{"name": ring + "/cryptoKeyVersions/9"},
+				{"name": ring + "/cryptoKeyVersions/10"},
+			}})
+		case r.URL.Path == "/v1/"+ring+"/cryptoKeyVersions/10/publicKey":
+			json.NewEncoder(w).Encode(map[string]string{"pem": string(key)})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	setenv(t, "GCE_METADATA_HOST", strings.TrimPrefix(ts.URL, "http://"))
+	endpoint := gcpKMSEndpoint
+	gcpKMSEndpoint = ts.URL
+	defer func() { gcpKMSEndpoint = endpoint }()
+
+	expected, err := ParsePublicKey(key)
+	require.NoError(t, err)
+
+	// The latest enabled version is used if version is absent
+	for _, ref := range []string{"gcpkms://" + ring, "gcpkms://" + ring + "/versions/10"} {
+		loaded, err := LoadPublicKey(ref)
+		require.NoError(t, err, ref)
+		assert.Equal(t, expected, loaded)
+	}
+
+	_, err = LoadPublicKey("gcpkms://" + ring + "/versions/9")
+	assert.Error(t, err)
+}
+
+func TestUnsupportedKey(t *testing.T) {
+	_, err := LoadPublicKey("awskms:///arn:aws:kms:us-east-1:1:key/k")
+	assert.Error(t, err)
+}
@@ -0,0 +1,106 @@
+package cosign
+
+import (
+	"crypto"
+	"crypto/x509"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/pkg/errors"
+	"io/ioutil"
+)
+
+// Verifier verifies signature of image references, it either uses
+// a public key or certificate constraints
+type Verifier struct {
+	Key         crypto.PublicKey
+	Certificate CertificateOptions
+}
+
+// NewVerifier creates verifier from key reference, or from the PEM
+// encoded roots of keyless certificates and public key of rekor when
+// key is empty. Keyless signatures are constrained by identity and
+// issuer which are required
+func NewVerifier(key string, roots string, rekorKey string, identity string, issuer string) (*Verifier, error) {
+	v := &Verifier{}
+	switch {
+	case key != "":
+		k, err := LoadPublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		v.Key = k
+	case roots != "":
+		b, err := ioutil.ReadFile(roots)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.Errorf("cosign: no certificate found in %#v", roots)
+		}
+
+		v.Certificate = CertificateOptions{
+			Roots:    pool,
+			Identity: identity,
+			Issuer:   issuer,
+		}
+		if rekorKey != "" {
+			k, err := LoadPublicKey(rekorKey)
+			if err != nil {
+				return nil, err
+			}
+			v.Certificate.RekorKey = k
+		}
+		if err := v.Certificate.validate(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("cosign: either key or certificate roots must be specified")
+	}
+
+	return v, nil
+}
+
+// Resolve returns the digest reference of ref, tags are resolved
+// through the registry
+func Resolve(ref string, opts ...remote.Option) (name.Digest, error) {
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	if d, ok := r.(name.Digest); ok {
+		return d, nil
+	}
+
+	desc, err := remote.Head(r, opts...)
+	if err != nil {
+		// Some registries disallow HEAD of manifest
+		d, errGet := remote.Get(r, opts...)
+		if errGet != nil {
+			return name.Digest{}, err
+		}
+		return r.Context().Digest(d.Digest.String()), nil
+	}
+
+	return r.Context().Digest(desc.Digest.String()), nil
+}
+
+// Verify resolves ref and verifies its signature, the resolved digest
+// is returned even if verification fails
+func (v *Verifier) Verify(ref string, opts ...remote.Option) (name.Digest, *Signature, error) {
+	digest, err := Resolve(ref, opts...)
+	if err != nil {
+		return digest, nil, err
+	}
+
+	var sig *Signature
+	if v.Key != nil {
+		sig, err = VerifyWithKey(digest, v.Key, opts...)
+	} else {
+		sig, err = VerifyWithCertificate(digest, v.Certificate, opts...)
+	}
+
+	return digest, sig, err
+}
@@ -0,0 +1,109 @@
+// Package detect probes container runtimes available on host, so that
+// hosts running docker, containerd or both are scanned without the
+// runtime being specified
+package detect
+
+import (
+	"context"
+	"fmt"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/pkg/errors"
+	"os"
+	"strings"
+)
+
+// names of runtimes
+const (
+	Docker     = "docker"
+	Containerd = "containerd"
+)
+
+// Names is all runtimes in the order they're probed
+var Names = []string{Docker, Containerd}
+
+// Probe checks whether a runtime is reachable, Socket is checked for
+// existence before Ping, an empty Socket skips the check, e.g. runtime
+// is connected over tcp
+type Probe struct {
+	Name   string
+	Socket string
+	Ping   func(ctx context.Context) error
+}
+
+// NoRuntimeError is returned when no runtime probed is reachable, it
+// carries the reason of every runtime
+type NoRuntimeError struct {
+	Reasons map[string]error
+	Names   []string
+}
+
+func (e *NoRuntimeError) Error() string {
+	reasons := []string{}
+	for _, name := range e.Names {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", name, e.Reasons[name].Error()))
+	}
+	return fmt.Sprintf("no container runtime reachable (%s), check that the runtime is running "+
+		"and its socket is accessible, or specify it with --runtime", strings.Join(reasons, "; "))
+}
+
+// ParseNames validates runtime names of flag, an empty list means all
+// runtimes, duplicates are dropped
+func ParseNames(values []string) ([]string, error) {
+	if len(values) == 0 {
+		return Names, nil
+	}
+
+	names := []string{}
+	seen := map[string]struct{}{}
+	for _, v := range values {
+		name := strings.ToLower(strings.TrimSpace(v))
+		if name != Docker && name != Containerd {
+			return nil, errors.Errorf("unknown runtime %#v, expect %s", v, strings.Join(Names, " or "))
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Detect returns names of reachable runtimes in the order of probes,
+// NoRuntimeError is returned if none is reachable
+func Detect(ctx context.Context, probes []Probe) ([]string, error) {
+	names := []string{}
+	noRuntime := &NoRuntimeError{Reasons: map[string]error{}}
+	for _, p := range probes {
+		if err := probe(ctx, p); err != nil {
+			log.Debugf("Runtime %s unreachable: %s\n", p.Name, err.Error())
+			noRuntime.Names = append(noRuntime.Names, p.Name)
+			noRuntime.Reasons[p.Name] = err
+			continue
+		}
+		names = append(names, p.Name)
+	}
+
+	if len(names) == 0 {
+		return nil, noRuntime
+	}
+	return names, nil
+}
+
+func probe(ctx context.Context, p Probe) error {
+	if p.Socket != "" {
+		if _, err := os.Stat(p.Socket); err != nil {
+			if os.IsNotExist(err) {
+				return errors.Errorf("socket %s not found", p.Socket)
+			}
+			return errors.Wrapf(err, "socket %s", p.Socket)
+		}
+	}
+
+	if p.Ping != nil {
+		if err := p.Ping(ctx); err != nil {
+			return errors.Wrap(err, "ping")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package detect
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseNames(t *testing.T) {
+	names, err := ParseNames(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{Docker, Containerd}, names)
+
+	names, err = ParseNames([]string{"containerd", " Docker", "containerd"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{Containerd, Docker}, names)
+
+	_, err = ParseNames([]string{"podman"})
+	assert.NotNil(t, err)
+}
+
+func TestDetect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "detect")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "docker.sock")
+	assert.Nil(t, ioutil.WriteFile(sock, nil, 0600))
+	ok := func(ctx context.Context) error { return nil }
+	refused := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name   string
+		probes []Probe
+		want   []string
+		errs   []string
+	}{
+		{
+			name: "both",
+			probes: []Probe{
+				{Name: Docker, Socket: sock, Ping: ok},
+				{Name: Containerd, Ping: ok},
+			},
+			want: []string{Docker, Containerd},
+		},
+		{
+			name: "missing socket",
+			probes: []Probe{
+				{Name: Docker, Socket: filepath.Join(dir, "missing.sock"), Ping: ok},
+				{Name: Containerd, Socket: sock, Ping: ok},
+			},
+			want: []string{Containerd},
+		},
+		{
+			name: "none",
+			probes: []Probe{
+				{Name: Docker, Socket: filepath.Join(dir, "missing.sock"), Ping: ok},
+				{Name: Containerd, Socket: sock, Ping: refused},
+			},
+			errs: []string{"docker: socket", "containerd: ping: connection refused", "--runtime"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names, err := Detect(context.Background(), tt.probes)
+			if tt.errs == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.want, names)
+				return
+			}
+
+			var noRuntime *NoRuntimeError
+			assert.True(t, errors.As(err, &noRuntime))
+			for _, s := range tt.errs {
+				assert.Contains(t, err.Error(), s)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+// Package diagnostics keeps bundles of plugin processes exiting
+// abnormally, a bundle holds the tail of stderr of the process along
+// with its command line, redacted environment and state of runner
+package diagnostics
+
+import (
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/prune"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTailSize is bytes of stderr of plugin kept by default
+const DefaultTailSize = 64 * 1024
+
+// Files of a bundle
+const (
+	BundleFile = "bundle.json"
+	StderrFile = "stderr.log"
+)
+
+// Redacted replaces values of sensitive environment variables
+const Redacted = "<redacted>"
+
+// sensitiveEnv matches names of environment variables whose values
+// are redacted
+var sensitiveEnv = regexp.MustCompile(`(?i)(token|secret|passw|key|credential|auth)`)
+
+// tail keeps the last size bytes written to it
+type tail struct {
+	mu    sync.Mutex
+	size  int
+	buf   []byte
+	total int64
+}
+
+func (t *tail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.total += int64(len(p))
+	if len(p) >= t.size {
+		t.buf = append(t.buf[:0], p[len(p)-t.size:]...)
+		return len(p), nil
+	}
+	if over := len(t.buf) + len(p) - t.size; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	t.buf = append(t.buf, p...)
+	return len(p), nil
+}
+
+func (t *tail) bytes() ([]byte, int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]byte{}, t.buf...), t.total
+}
+
+// Recorder records command line, environment and the tail of stderr of
+// plugin process, Prepare must be called before the process starts
+type Recorder struct {
+	stderr *tail
+	mu     sync.Mutex
+	args   []string
+	env    []string
+}
+
+// NewRecorder creates recorder keeping the last size bytes of stderr,
+// DefaultTailSize is used if size isn't positive
+func NewRecorder(size int) *Recorder {
+	if size <= 0 {
+		size = DefaultTailSize
+	}
+	return &Recorder{stderr: &tail{size: size}}
+}
+
+// Prepare tees stderr of cmd into recorder and records its command
+// line and environment, environment of runner is recorded if cmd
+// inherits it
+func (r *Recorder) Prepare(cmd *exec.Cmd) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.args = append([]string{}, cmd.Args...)
+	if cmd.Env != nil {
+		r.env = append([]string{}, cmd.Env...)
+	} else {
+		r.env = os.Environ()
+	}
+
+	if cmd.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, r.stderr)
+	} else {
+		cmd.Stderr = r.stderr
+	}
+}
+
+// Abnormal reports whether err of plugin execution is an abnormal
+// exit of the process, i.e. non-zero exit status or killed by signal
+func Abnormal(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr)
+}
+
+// Runner is state of runner when plugin exits
+type Runner struct {
+	PID     int    `json:"pid"`
+	Host    string `json:"host,omitempty"`
+	Threads int    `json:"threads"`
+	// Uptime is how long runner has been running
+	Uptime string `json:"uptime"`
+}
+
+// Bundle is the diagnostics of an abnormal plugin exit
+type Bundle struct {
+	Plugin      string    `json:"plugin"`
+	PluginPath  string    `json:"plugin_path"`
+	Command     []string  `json:"command"`
+	Args        []string  `json:"args"`
+	Env         []string  `json:"env"`
+	ImageID     string    `json:"image_id"`
+	ImageDigest string    `json:"image_digest,omitempty"`
+	Error       string    `json:"error"`
+	ExitCode    int       `json:"exit_code"`
+	Time        time.Time `json:"time"`
+	Runner      Runner    `json:"runner"`
+	// StderrBytes is bytes written to stderr by plugin, of which the
+	// last StderrKept are kept
+	StderrBytes int64 `json:"stderr_bytes"`
+	StderrKept  int   `json:"stderr_kept"`
+}
+
+// Bundle returns bundle of plugin execution failed with err, values of
+// sensitive environment variables are redacted
+func (r *Recorder) Bundle(err error) Bundle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b := Bundle{
+		Args:     append([]string{}, r.args...),
+		Env:      RedactEnv(r.env),
+		ExitCode: -1,
+		Time:     time.Now().UTC(),
+	}
+	if err != nil {
+		b.Error = err.Error()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		b.ExitCode = exitErr.ExitCode()
+	}
+	return b
+}
+
+// Stderr returns the tail of stderr kept and bytes written in total
+func (r *Recorder) Stderr() ([]byte, int64) {
+	return r.stderr.bytes()
+}
+
+// RedactEnv returns env with values of variables whose names look
+// sensitive redacted
+func RedactEnv(env []string) []string {
+	redacted := make([]string, 0, len(env))
+	for _, kv := range env {
+		if i := strings.Index(kv, "="); i != -1 && sensitiveEnv.MatchString(kv[:i]) {
+			kv = kv[:i+1] + Redacted
+		}
+		redacted = append(redacted, kv)
+	}
+	return redacted
+}
+
+// Write writes bundle of recorder into a new directory under dir and
+// returns the directory
+func (r *Recorder) Write(dir string, b Bundle) (string, error) {
+	stderr, total := r.Stderr()
+	b.StderrBytes, b.StderrKept = total, len(stderr)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", errors.Wrap(err, "create diagnostics dir")
+	}
+	prefix := strings.NewReplacer("/", "-", string(os.PathSeparator), "-").Replace(b.Plugin) +
+		"-" + b.Time.Format("20060102T150405") + "-"
+	bundleDir, err := ioutil.TempDir(dir, prefix)
+	if err != nil {
+		return "", errors.Wrap(err, "create diagnostics bundle")
+	}
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(bundleDir, BundleFile), data, 0600); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(bundleDir, StderrFile), stderr, 0600); err != nil {
+		return "", err
+	}
+	return bundleDir, nil
+}
+
+// Prune removes bundles under dir except the latest keep ones
+func Prune(dir string, keep int) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	bundles := []os.FileInfo{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, e.Name(), BundleFile)); err == nil {
+			bundles = append(bundles, e)
+		}
+	}
+	if len(bundles) <= keep {
+		return nil
+	}
+
+	sort.Slice(bundles, func(i, j int) bool {
+		return bundles[i].ModTime().After(bundles[j].ModTime())
+	})
+	for _, b := range bundles[keep:] {
+		if err := os.RemoveAll(filepath.Join(dir, b.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Expired lists bundles under dir written before
+func Expired(dir string, before time.Time) ([]prune.Item, error) {
+	return prune.Entries(prune.KindDiagnostics, dir, before, func(info os.FileInfo) bool {
+		if !info.IsDir() {
+			return false
+		}
+		_, err := os.Stat(filepath.Join(dir, info.Name(), BundleFile))
+		return err == nil
+	})
+}
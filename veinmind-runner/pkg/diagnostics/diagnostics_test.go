@@ -0,0 +1,117 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// crashingPlugin writes a stub plugin which floods stderr and crashes
+// with segmentation fault
+func crashingPlugin(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "veinmind-crash")
+	script := `#!/bin/sh
+i=0
+while [ $i -lt 200 ]; do echo "line $i of plugin output" >&2; i=$((i+1)); done
+echo "fatal: crashing now" >&2
+kill -SEGV $$
+`
+	assert.NoError(t, ioutil.WriteFile(path, []byte(script), 0755))
+	return path
+}
+
+func TestRecorder(t *testing.T) {
+	plugin := crashingPlugin(t)
+	cmd := exec.Command(plugin, "scan", "image", "sha256:aa")
+	cmd.Env = []string{"PATH=/usr/bin:/bin", "REGISTRY_TOKEN=s3cr3t", "VEINMIND_PLUGIN_WORKDIR=/tmp/work"}
+
+	r := NewRecorder(256)
+	r.Prepare(cmd)
+	err := cmd.Run()
+	assert.True(t, Abnormal(err))
+
+	b := r.Bundle(err)
+	b.Plugin, b.PluginPath, b.ImageID = "veinmind-crash", plugin, "sha256:aa"
+	dir := t.TempDir()
+	bundleDir, err := r.Write(dir, b)
+	assert.NoError(t, err)
+	assert.Equal(t, dir, filepath.Dir(bundleDir))
+
+	data, err := ioutil.ReadFile(filepath.Join(bundleDir, BundleFile))
+	assert.NoError(t, err)
+	written := Bundle{}
+	assert.NoError(t, json.Unmarshal(data, &written))
+	assert.Equal(t, "veinmind-crash", written.Plugin)
+	assert.Equal(t, []string{plugin, "scan", "image", "sha256:aa"}, written.Args)
+	assert.Equal(t, []string{"PATH=/usr/bin:/bin", "REGISTRY_TOKEN=" + Redacted, "VEINMIND_PLUGIN_WORKDIR=/tmp/work"}, written.Env)
+	assert.Equal(t, "signal: segmentation fault", written.Error)
+	assert.Equal(t, -1, written.ExitCode)
+	assert.Equal(t, 256, written.StderrKept)
+	assert.True(t, written.StderrBytes > 256)
+
+	stderr, err := ioutil.ReadFile(filepath.Join(bundleDir, StderrFile))
+	assert.NoError(t, err)
+	assert.Len(t, stderr, 256)
+	assert.True(t, strings.HasSuffix(string(stderr), "fatal: crashing now\n"))
+}
+
+func TestAbnormal(t *testing.T) {
+	assert.False(t, Abnormal(nil))
+	assert.False(t, Abnormal(exec.ErrNotFound))
+	assert.True(t, Abnormal(exec.Command("/bin/sh", "-c", "exit 2").Run()))
+}
+
+func TestTail(t *testing.T) {
+	tl := &tail{size: 4}
+	for _, s := range []string{"ab", "cd", "e", "fghij", "k"} {
+		_, _ = tl.Write([]byte(s))
+	}
+	b, total := tl.bytes()
+	assert.Equal(t, "hijk", string(b))
+	assert.Equal(t, int64(11), total)
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRecorder(0)
+	for i := 0; i < 4; i++ {
+		_, err := r.Write(dir, Bundle{Plugin: "veinmind-crash"})
+		assert.NoError(t, err)
+	}
+	// Directories without bundle aren't touched
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "other"), 0700))
+
+	assert.NoError(t, Prune(dir, 2))
+	entries, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	assert.NoError(t, Prune(filepath.Join(dir, "missing"), 2))
+}
+
+func TestExpired(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRecorder(0)
+	old, err := r.Write(dir, Bundle{Plugin: "veinmind-crash"})
+	assert.NoError(t, err)
+	_, err = r.Write(dir, Bundle{Plugin: "veinmind-crash"})
+	assert.NoError(t, err)
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "other"), 0700))
+
+	before := time.Now().Add(-time.Hour)
+	past := before.Add(-time.Hour)
+	for _, p := range []string{filepath.Join(old, BundleFile), filepath.Join(old, StderrFile), old, filepath.Join(dir, "other")} {
+		assert.NoError(t, os.Chtimes(p, past, past))
+	}
+
+	items, err := Expired(dir, before)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, old, items[0].Path)
+}
@@ -0,0 +1,165 @@
+// Package errcode classifies failures of runner by codes automation can
+// branch on, along with hints telling users what to do about them.
+// Errors of dependencies carrying no code, e.g. bodies of registry
+// responses, are classified by their messages
+package errcode
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Code of failure, codes are a contract and must be kept stable
+type Code string
+
+const (
+	Unknown                Code = "unknown"
+	Timeout                Code = "timeout"
+	RuntimeMismatch        Code = "runtime-mismatch"
+	RuntimeUnreachable     Code = "runtime-unreachable"
+	RegistryAuth           Code = "registry-auth"
+	RegistryNotFound       Code = "registry-not-found"
+	RegistryRateLimited    Code = "registry-rate-limited"
+	RegistryUnreachable    Code = "registry-unreachable"
+	RegistryStorageCorrupt Code = "registry-storage-corrupt"
+	PluginCrashed          Code = "plugin-crashed"
+	PluginTimeout          Code = "plugin-timeout"
+	PluginFailed           Code = "plugin-failed"
+	ReportWrite            Code = "report-write"
+)
+
+// hints are hints of codes whose errors carry none
+var hints = map[Code]string{
+	Timeout:                "raise --timeout or --image-timeout, or scan fewer targets at once",
+	RuntimeMismatch:        "pass --runtime docker|containerd",
+	RuntimeUnreachable:     "check the runtime is running and its socket is accessible, e.g. --docker-socket",
+	RegistryAuth:           "check credentials of the registry; try --config or docker login",
+	RegistryNotFound:       "check the repository and tag exist, e.g. with veinmind-runner registry check",
+	RegistryRateLimited:    "authenticate to the registry or lower --image-concurrency and --per-registry-concurrency",
+	RegistryUnreachable:    "check network access to the registry, or pull through another path with --pull-via",
+	RegistryStorageCorrupt: "sync the registry storage directory again, blobs of the image are missing or corrupt",
+	PluginCrashed:          "see diagnostics bundle of the execution in coverage of the report",
+	PluginTimeout:          "raise --image-timeout or run the plugin alone to see how long it takes",
+	ReportWrite:            "check the output path is writable, or choose another --if-output-exists policy",
+}
+
+// Error is failure of code with hint for users, its message is the one
+// of the cause
+type Error struct {
+	Code  Code
+	Hint  string
+	cause error
+}
+
+func (e *Error) Error() string {
+	return e.cause.Error()
+}
+
+// Cause returns the underlying error
+func (e *Error) Cause() error {
+	return e.cause
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// New returns error of code with message, the hint of code is used if
+// hint is empty
+func New(code Code, hint string, message string) error {
+	return Wrap(errors.New(message), code, hint)
+}
+
+// Wrap returns err with code and hint, the hint of code is used if
+// hint is empty. Nil is returned if err is nil
+func Wrap(err error, code Code, hint string) error {
+	if err == nil {
+		return nil
+	}
+	if hint == "" {
+		hint = hints[code]
+	}
+	return &Error{Code: code, Hint: hint, cause: err}
+}
+
+// Of returns error with code of err, errors without code are classified
+func Of(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	code := Classify(err)
+	return &Error{Code: code, Hint: hints[code], cause: err}
+}
+
+// CodeOf returns code of err, empty if err is nil
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+	return Of(err).Code
+}
+
+// patterns classify messages of errors, which are lowercased. Runtime
+// patterns come first since errors of daemons mention registries
+var patterns = []struct {
+	code     Code
+	patterns []string
+}{
+	{RuntimeUnreachable, []string{"cannot connect to the docker daemon", "docker.sock", "containerd.sock", "is the docker daemon running"}},
+	{RegistryAuth, []string{"unauthorized", "authentication required", "insufficient_scope", "denied: requested access", "no basic auth credentials"}},
+	{RegistryRateLimited, []string{"toomanyrequests", "too many requests", "rate limit"}},
+	{RegistryNotFound, []string{"manifest unknown", "name unknown", "repository does not exist", "404 not found", "not found: manifest"}},
+	{RegistryUnreachable, []string{"no such host", "connection refused", "i/o timeout", "tls: ", "x509: ", "network is unreachable"}},
+}
+
+// Classify returns code of err by its message, Unknown if it isn't
+// recognized
+func Classify(err error) Code {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Timeout
+	}
+	msg := strings.ToLower(err.Error())
+	for _, p := range patterns {
+		for _, pattern := range p.patterns {
+			if strings.Contains(msg, pattern) {
+				return p.code
+			}
+		}
+	}
+	return Unknown
+}
+
+// Render writes err to w with its code and a hint line, errors which
+// aren't recognized are written as they are
+func Render(w io.Writer, err error) {
+	e := Of(err)
+	if e.Code == Unknown {
+		fmt.Fprintf(w, "Error: %s\n", err.Error())
+		return
+	}
+	fmt.Fprintf(w, "Error (%s): %s\n", e.Code, err.Error())
+	if e.Hint != "" {
+		fmt.Fprintf(w, "hint: %s\n", e.Hint)
+	}
+}
+
+// Codes returns distinct codes sorted, empty codes are left out
+func Codes(codes ...Code) []string {
+	set := map[Code]struct{}{}
+	for _, c := range codes {
+		if c != "" {
+			set[c] = struct{}{}
+		}
+	}
+	result := []string{}
+	for c := range set {
+		result = append(result, string(c))
+	}
+	sort.Strings(result)
+	return result
+}
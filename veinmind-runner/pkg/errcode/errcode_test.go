@@ -0,0 +1,52 @@
+package errcode
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	for msg, code := range map[string]Code{
+		"GET https://harbor.internal/v2/app/manifests/1.0: UNAUTHORIZED: authentication required":                       RegistryAuth,
+		"Error response from daemon: Head https://registry-1.docker.io/v2/library/nginx/manifests/latest: unauthorized": RegistryAuth,
+		"toomanyrequests: You have reached your pull rate limit":                                                        RegistryRateLimited,
+		"MANIFEST_UNKNOWN: manifest unknown; map[Tag:2.0]":                                                              RegistryNotFound,
+		"dial tcp: lookup harbor.internal: no such host":                                                                RegistryUnreachable,
+		"Cannot connect to the Docker daemon at unix:///var/run/docker.sock":                                            RuntimeUnreachable,
+		"layer sha256:401abc not found":                                                                                 Unknown,
+	} {
+		assert.Equal(t, code, Classify(errors.New(msg)), msg)
+	}
+	assert.Equal(t, Timeout, Classify(errors.Wrap(context.DeadlineExceeded, "pull")))
+}
+
+func TestOf(t *testing.T) {
+	err := Wrap(errors.New("runtime not match"), RuntimeMismatch, "")
+	assert.EqualError(t, err, "runtime not match")
+	assert.Equal(t, RuntimeMismatch, CodeOf(errors.Wrap(err, "scan")))
+	assert.Equal(t, "pass --runtime docker|containerd", Of(err).Hint)
+
+	// Codes of errors take precedence over their messages
+	err = Wrap(errors.New("unauthorized"), RegistryAuth, "credentials for harbor.internal not found; try --config")
+	assert.Equal(t, "credentials for harbor.internal not found; try --config", Of(errors.Wrap(err, "pull")).Hint)
+	assert.Equal(t, Code(""), CodeOf(nil))
+	assert.Nil(t, Wrap(nil, Unknown, ""))
+}
+
+func TestRender(t *testing.T) {
+	buf := &bytes.Buffer{}
+	Render(buf, errors.Wrap(New(RuntimeMismatch, "", "runtime not match"), "scan"))
+	assert.Equal(t, "Error (runtime-mismatch): scan: runtime not match\nhint: pass --runtime docker|containerd\n", buf.String())
+
+	buf.Reset()
+	Render(buf, errors.New("boom"))
+	assert.Equal(t, "Error: boom\n", buf.String())
+}
+
+func TestCodes(t *testing.T) {
+	assert.Equal(t, []string{"plugin-crashed", "registry-auth"}, Codes(RegistryAuth, "", PluginCrashed, RegistryAuth))
+	assert.Equal(t, []string{}, Codes())
+}
@@ -0,0 +1,251 @@
+// Package export writes files flagged by events of an image into
+// <dir>/<image digest>.tar.gz with manifest <image digest>.json for
+// offline analysis
+package export
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var digestRegexp = regexp.MustCompile(`^(sha256:)?[a-f0-9]{64}$`)
+
+// Reasons of files not exported
+const (
+	SkipFileTooLarge = "exceeds max file size"
+	SkipSizeExceeded = "exceeds max export size"
+	SkipUnsupported  = "unsupported file type"
+)
+
+// FileSystem is the file system of image which files are exported from
+type FileSystem interface {
+	Lstat(path string) (os.FileInfo, error)
+	Readlink(path string) (string, error)
+	Open(path string) (io.ReadCloser, error)
+}
+
+// Limits of an export, zero means unlimited
+type Limits struct {
+	// MaxFileSize is max size of a file in export
+	MaxFileSize int64
+	// MaxSize is max total size of files in export
+	MaxSize int64
+}
+
+// Manifest describes files of an export
+type Manifest struct {
+	ImageID string    `json:"image_id"`
+	Archive string    `json:"archive"`
+	Time    time.Time `json:"time"`
+	Size    int64     `json:"size"`
+	Files   []File    `json:"files"`
+}
+
+// File is a flagged path of image, Missing marks path which doesn't
+// exist in image, e.g. deleted in upper layers, Skipped is the reason
+// path isn't exported
+type File struct {
+	Path     string   `json:"path"`
+	EventIDs []string `json:"event_ids"`
+	SHA256   string   `json:"sha256,omitempty"`
+	Size     int64    `json:"size,omitempty"`
+	Missing  bool     `json:"missing,omitempty"`
+	Skipped  string   `json:"skipped,omitempty"`
+}
+
+// Exported returns number of files in export
+func (m Manifest) Exported() int {
+	n := 0
+	for _, f := range m.Files {
+		if !f.Missing && f.Skipped == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Export writes paths of image in fsys with ids of events flagging them
+// into dir, paths which can't be exported are noted in manifest rather
+// than failing the export
+func Export(dir string, imageID string, fsys FileSystem, paths map[string][]string, limits Limits) (Manifest, error) {
+	name := imageName(imageID)
+	m := Manifest{
+		ImageID: imageID,
+		Archive: name + ".tar.gz",
+		Time:    time.Now(),
+		Files:   []File{},
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return m, err
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".export-")
+	if err != nil {
+		return m, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	gw := gzip.NewWriter(tmp)
+	tw := tar.NewWriter(gw)
+
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	for _, p := range sorted {
+		f := File{Path: p, EventIDs: dedup(paths[p])}
+		if err := m.add(tw, fsys, &f, limits); err != nil {
+			return m, err
+		}
+		m.Files = append(m.Files, f)
+	}
+
+	if err := tw.Close(); err != nil {
+		return m, err
+	}
+	if err := gw.Close(); err != nil {
+		return m, err
+	}
+	if err := tmp.Close(); err != nil {
+		return m, err
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".json"), b, 0600); err != nil {
+		return m, err
+	}
+	return m, os.Rename(tmp.Name(), filepath.Join(dir, m.Archive))
+}
+
+// add writes file into tw, errors of reading image are noted in file
+// while errors of writing export are returned
+func (m *Manifest) add(tw *tar.Writer, fsys FileSystem, f *File, limits Limits) error {
+	info, err := fsys.Lstat(f.Path)
+	if os.IsNotExist(err) {
+		f.Missing = true
+		return nil
+	} else if err != nil {
+		f.Skipped = err.Error()
+		return nil
+	}
+
+	link := ""
+	switch {
+	case info.Mode().IsRegular():
+		f.Size = info.Size()
+		if limits.MaxFileSize > 0 && f.Size > limits.MaxFileSize {
+			f.Skipped = SkipFileTooLarge
+			return nil
+		}
+		if limits.MaxSize > 0 && m.Size+f.Size > limits.MaxSize {
+			f.Skipped = SkipSizeExceeded
+			return nil
+		}
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err = fsys.Readlink(f.Path)
+		if err != nil {
+			f.Skipped = err.Error()
+			return nil
+		}
+	case info.IsDir():
+	default:
+		f.Skipped = SkipUnsupported
+		return nil
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		f.Skipped = err.Error()
+		return nil
+	}
+	hdr.Name = strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+f.Path)), "/")
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+
+	if !info.Mode().IsRegular() {
+		return tw.WriteHeader(hdr)
+	}
+
+	r, err := fsys.Open(f.Path)
+	if err != nil {
+		f.Skipped = err.Error()
+		return nil
+	}
+	defer r.Close()
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	// Header is written, file is padded to its size if it's truncated
+	// while reading
+	h := sha256.New()
+	n, err := io.CopyN(tw, io.TeeReader(r, h), f.Size)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if n < f.Size {
+		if _, err := io.CopyN(tw, zeros{}, f.Size-n); err != nil {
+			return err
+		}
+		f.Skipped = io.ErrUnexpectedEOF.Error()
+		return nil
+	}
+
+	f.SHA256 = hex.EncodeToString(h.Sum(nil))
+	m.Size += f.Size
+	return nil
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func dedup(ids []string) []string {
+	seen := map[string]struct{}{}
+	out := []string{}
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		out = append(out, id)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// imageName returns file name of image, ids which aren't digests are
+// hashed so that they can't escape export directory
+func imageName(id string) string {
+	if digestRegexp.MatchString(id) {
+		return strings.TrimPrefix(id, "sha256:")
+	}
+
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
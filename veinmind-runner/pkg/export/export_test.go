@@ -0,0 +1,114 @@
+package export
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dirFS is file system rooted at a directory
+type dirFS string
+
+func (d dirFS) Lstat(path string) (os.FileInfo, error) {
+	return os.Lstat(filepath.Join(string(d), path))
+}
+
+func (d dirFS) Readlink(path string) (string, error) {
+	return os.Readlink(filepath.Join(string(d), path))
+}
+
+func (d dirFS) Open(path string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(d), path))
+}
+
+func TestExport(t *testing.T) {
+	root, err := ioutil.TempDir("", "export-root")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	dir, err := ioutil.TempDir("", "export")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "bin"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "bin", "miner"), []byte("miner"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "bin", "large"), []byte(strings.Repeat("x", 17)), 0644))
+	assert.NoError(t, os.Symlink("/bin/miner", filepath.Join(root, "bin", "link")))
+
+	id := "sha256:" + strings.Repeat("a", 64)
+	m, err := Export(dir, id, dirFS(root), map[string][]string{
+		"/bin/miner":   {"b", "a", "b"},
+		"/bin/large":   {"c"},
+		"/bin/link":    {"d"},
+		"/tmp/deleted": {"e"},
+	}, Limits{MaxFileSize: 16})
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("a", 64)+".tar.gz", m.Archive)
+	assert.Equal(t, 2, m.Exported())
+	assert.Equal(t, int64(5), m.Size)
+
+	files := map[string]File{}
+	for _, f := range m.Files {
+		files[f.Path] = f
+	}
+	assert.Equal(t, []string{"a", "b"}, files["/bin/miner"].EventIDs)
+	assert.Equal(t, "8b133a3868993176b613738816247a7f4d357cae555996519cf5b543e9b3554b", files["/bin/miner"].SHA256)
+	assert.Equal(t, SkipFileTooLarge, files["/bin/large"].Skipped)
+	assert.True(t, files["/tmp/deleted"].Missing)
+
+	// Manifest is written next to archive
+	b, err := ioutil.ReadFile(filepath.Join(dir, strings.Repeat("a", 64)+".json"))
+	assert.NoError(t, err)
+	saved := Manifest{}
+	assert.NoError(t, json.Unmarshal(b, &saved))
+	assert.Len(t, saved.Files, 4)
+
+	f, err := os.Open(filepath.Join(dir, m.Archive))
+	assert.NoError(t, err)
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	tr := tar.NewReader(gr)
+
+	entries := map[string]*tar.Header{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		entries[hdr.Name] = hdr
+		if hdr.Name == "bin/miner" {
+			content, err := ioutil.ReadAll(tr)
+			assert.NoError(t, err)
+			assert.Equal(t, "miner", string(content))
+			assert.Equal(t, int64(0755), hdr.Mode&0777)
+		}
+	}
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "/bin/miner", entries["bin/link"].Linkname)
+}
+
+func TestExportMaxSize(t *testing.T) {
+	root, err := ioutil.TempDir("", "export-root")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	dir, err := ioutil.TempDir("", "export")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "a"), []byte(strings.Repeat("a", 8)), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "b"), []byte(strings.Repeat("b", 8)), 0644))
+
+	m, err := Export(dir, "../../etc", dirFS(root), map[string][]string{"/a": {"1"}, "/b": {"2"}}, Limits{MaxSize: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, m.Exported())
+	assert.Equal(t, SkipSizeExceeded, m.Files[1].Skipped)
+	assert.False(t, strings.Contains(m.Archive, ".."))
+}
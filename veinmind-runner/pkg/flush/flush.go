@@ -0,0 +1,71 @@
+// Package flush flushes partial reports periodically while scan is
+// running, so that an up-to-date report is on disk at all times and
+// not only once scan completes
+package flush
+
+import (
+	"sync"
+	"time"
+)
+
+// Flusher calls flush at interval with the number of flushes so far
+// including the call. Flushes never overlap and none starts after Stop
+// returns, so the final report written afterwards is never replaced by
+// a partial one
+type Flusher struct {
+	flush   func(n int)
+	mu      sync.Mutex
+	flushes int
+	stopped bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Start starts flushing at interval
+func Start(interval time.Duration, flush func(n int)) *Flusher {
+	f := &Flusher{
+		flush: flush,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go f.run(interval)
+	return f
+}
+
+func (f *Flusher) run(interval time.Duration) {
+	defer close(f.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			f.mu.Lock()
+			if !f.stopped {
+				f.flushes++
+				f.flush(f.flushes)
+			}
+			f.mu.Unlock()
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// Stop stops flushing, a flush in progress is waited for. Number of
+// flushes is returned, it's safe to call Stop more than once
+func (f *Flusher) Stop() int {
+	if f == nil {
+		return 0
+	}
+
+	f.mu.Lock()
+	if !f.stopped {
+		f.stopped = true
+		close(f.stop)
+	}
+	flushes := f.flushes
+	f.mu.Unlock()
+	<-f.done
+	return flushes
+}
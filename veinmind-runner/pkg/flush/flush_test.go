@@ -0,0 +1,34 @@
+package flush
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlusher(t *testing.T) {
+	var (
+		running int32
+		last    int32
+	)
+	f := Start(5*time.Millisecond, func(n int) {
+		assert.Equal(t, int32(1), atomic.AddInt32(&running, 1), "flushes overlap")
+		time.Sleep(10 * time.Millisecond)
+		atomic.StoreInt32(&last, int32(n))
+		atomic.AddInt32(&running, -1)
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	// Flush in progress is waited for and none starts afterwards
+	flushes := f.Stop()
+	assert.Equal(t, int32(0), atomic.LoadInt32(&running))
+	assert.True(t, flushes >= 2)
+	assert.Equal(t, int32(flushes), atomic.LoadInt32(&last))
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(flushes), atomic.LoadInt32(&last))
+	assert.Equal(t, flushes, f.Stop())
+
+	var none *Flusher
+	assert.Equal(t, 0, none.Stop())
+}
@@ -0,0 +1,178 @@
+// Package gate decides whether findings of a scan fail it, the same
+// decision is made by scan commands and the gate command
+package gate
+
+import (
+	"fmt"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"sort"
+	"time"
+)
+
+// Skip reasons of events which don't fail the scan
+const (
+	SkipAllowlisted    = "allowlisted"
+	SkipBaseline       = "in baseline"
+	SkipBaseImage      = "in base image layers"
+	SkipIgnored        = "ignored"
+	SkipPolicy         = "ignored by policy"
+	SkipBelowThreshold = "below severity threshold"
+	SkipMonitor        = "monitor-only"
+)
+
+type Options struct {
+	// Threshold overrides severity threshold of policy, nil means
+	// events of any level fail the scan
+	Threshold *report.Level
+	Policy    *Policy
+	Ignore    *IgnoreRules
+	// Baseline is fingerprints of accepted findings
+	Baseline *Baseline
+	// IgnoreBase skips events whose files live in base image layers
+	IgnoreBase bool
+}
+
+type Decision struct {
+	Fail    bool
+	Reasons []string
+	Failed  []reporter.Event
+	Skipped map[string]int
+}
+
+// Baseline is fingerprints of accepted findings of Version
+type Baseline struct {
+	Version      int
+	Fingerprints map[string]struct{}
+}
+
+// NewBaseline collects fingerprints of events in baseline report
+func NewBaseline(doc *reporter.Report) *Baseline {
+	baseline := &Baseline{
+		Version:      doc.FingerprintVersion,
+		Fingerprints: map[string]struct{}{},
+	}
+	for _, evt := range doc.Events {
+		baseline.Fingerprints[evt.Fingerprint] = struct{}{}
+	}
+
+	return baseline
+}
+
+// Has reports whether finding of event is accepted, fingerprint of
+// event is recomputed in version of baseline unless they match
+func (b *Baseline) Has(evt reporter.Event) bool {
+	if b == nil {
+		return false
+	}
+	if _, ok := b.Fingerprints[evt.Fingerprint]; ok {
+		return true
+	}
+	fingerprint, err := reporter.FingerprintOf(evt, b.Version)
+	if err != nil {
+		return false
+	}
+	_, ok := b.Fingerprints[fingerprint]
+	return ok
+}
+
+// Evaluate decides whether events fail the scan
+func Evaluate(events []reporter.Event, opts Options) Decision {
+	d := Decision{
+		Failed:  []reporter.Event{},
+		Skipped: map[string]int{},
+	}
+
+	now := time.Now()
+	for _, evt := range events {
+		if reason, skip := opts.skip(evt, now); skip {
+			d.Skipped[reason]++
+			continue
+		}
+
+		d.Failed = append(d.Failed, evt)
+	}
+
+	d.Fail = len(d.Failed) > 0
+	d.Reasons = reasons(d.Failed)
+	return d
+}
+
+func (opts Options) skip(evt reporter.Event, now time.Time) (string, bool) {
+	// Events of reports recorded in monitor mode are enforced once
+	// policy enforces their plugin
+	if evt.Monitor != nil && (opts.Policy == nil || opts.Policy.Mode(evt.Monitor.Plugin) == reporter.ModeMonitor) {
+		return SkipMonitor, true
+	}
+
+	if evt.Allowlisted {
+		return SkipAllowlisted, true
+	}
+
+	if opts.Baseline.Has(evt) {
+		return SkipBaseline, true
+	}
+
+	if opts.IgnoreBase && evt.Origin == reporter.OriginBase {
+		return SkipBaseImage, true
+	}
+
+	if _, ok := opts.Ignore.Match(evt, now); ok {
+		return SkipIgnored, true
+	}
+
+	threshold := opts.Threshold
+	if threshold == nil && opts.Policy != nil {
+		threshold = opts.Policy.threshold
+		if t := opts.Policy.tenantThreshold(evt); t != nil {
+			threshold = t
+		}
+	}
+
+	if rule := opts.Policy.rule(evt.AlertType); rule != nil {
+		if rule.Ignore {
+			return SkipPolicy, true
+		}
+
+		if rule.threshold != nil {
+			threshold = rule.threshold
+		}
+	}
+
+	if threshold != nil && reporter.LevelRank(evt.Level) < reporter.LevelRank(*threshold) {
+		return SkipBelowThreshold, true
+	}
+
+	return "", false
+}
+
+// reasons summarizes failed events by image, level and alert type
+func reasons(events []reporter.Event) []string {
+	type key struct {
+		image string
+		level report.Level
+		alert report.AlertType
+	}
+
+	counts := map[key]int{}
+	keys := []key{}
+	for _, evt := range events {
+		k := key{reporter.ImageKey(evt), evt.Level, evt.AlertType}
+		if _, ok := counts[k]; !ok {
+			keys = append(keys, k)
+		}
+		counts[k]++
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		return reporter.LevelRank(keys[i].level) > reporter.LevelRank(keys[j].level)
+	})
+
+	r := []string{}
+	for _, k := range keys {
+		r = append(r, fmt.Sprintf("%d %s %s event(s) in %s",
+			counts[k], reporter.LevelString(k.level), reporter.AlertTypeString(k.alert), k.image))
+	}
+
+	return r
+}
@@ -0,0 +1,209 @@
+package gate
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newEvent(id string, level report.Level, alert report.AlertType, path string) reporter.Event {
+	evt := report.ReportEvent{
+		ID:        id,
+		Level:     level,
+		AlertType: alert,
+		AlertDetails: []report.AlertDetail{
+			{
+				SensitiveFileDetail: &report.SensitveFileDetail{
+					FileDetail: report.FileDetail{Path: path},
+				},
+			},
+		},
+	}
+
+	return reporter.Event{
+		ReportEvent: evt,
+		ImageRefs:   []string{id + ":latest"},
+		Fingerprint: reporter.Fingerprint(evt),
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	high := report.High
+	policy := &Policy{
+		SeverityThreshold: "medium",
+		Rules: []PolicyRule{
+			{AlertType: "Asset", Ignore: true},
+			{AlertType: "Weakpass", SeverityThreshold: "low"},
+		},
+	}
+	assert.NoError(t, policy.validate())
+
+	ignore := &IgnoreRules{Ignores: []IgnoreRule{
+		{Path: "/usr/share/doc/*", Reason: "docs"},
+		{Image: "expired", Expires: time.Now().Add(-time.Hour)},
+	}}
+
+	baselined := newEvent("app", report.Critical, report.MaliciousFile, "/bin/miner")
+	allowlisted := newEvent("base", report.Critical, report.MaliciousFile, "/bin/miner")
+	allowlisted.Allowlisted = true
+	inBase := newEvent("app", report.High, report.Sensitive, "/etc/ssl/private/key")
+	inBase.Origin = reporter.OriginBase
+
+	events := []reporter.Event{
+		baselined,
+		allowlisted,
+		newEvent("app", report.High, report.Sensitive, "/usr/share/doc/key"),
+		newEvent("app", report.Critical, report.Asset, "/"),
+		newEvent("app", report.Low, report.Weakpass, "/etc/shadow"),
+		newEvent("app", report.Low, report.Sensitive, "/etc/key"),
+		newEvent("expired", report.High, report.Sensitive, "/etc/key"),
+		inBase,
+	}
+
+	cases := []struct {
+		opts    Options
+		failed  int
+		skipped map[string]int
+	}{
+		{
+			opts:    Options{},
+			failed:  7,
+			skipped: map[string]int{SkipAllowlisted: 1},
+		},
+		{
+			opts: Options{
+				Policy:     policy,
+				Ignore:     ignore,
+				Baseline:   NewBaseline(&reporter.Report{FingerprintVersion: report.FingerprintVersion, Events: []reporter.Event{baselined}}),
+				IgnoreBase: true,
+			},
+			failed: 2,
+			skipped: map[string]int{
+				SkipAllowlisted:    1,
+				SkipBaseline:       1,
+				SkipBaseImage:      1,
+				SkipIgnored:        1,
+				SkipPolicy:         1,
+				SkipBelowThreshold: 1,
+			},
+		},
+		{
+			opts:   Options{Threshold: &high, Policy: policy},
+			failed: 5,
+			skipped: map[string]int{
+				SkipAllowlisted:    1,
+				SkipPolicy:         1,
+				SkipBelowThreshold: 1,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		d := Evaluate(events, c.opts)
+		assert.Len(t, d.Failed, c.failed)
+		assert.Equal(t, c.failed > 0, d.Fail)
+		assert.Equal(t, c.skipped, d.Skipped)
+	}
+}
+
+func TestBaselineVersions(t *testing.T) {
+	evt := newEvent("sha256:aa", report.Critical, report.MaliciousFile, "/bin/miner")
+	v1, err := report.FingerprintOf(evt.ReportEvent, report.FingerprintV1)
+	assert.NoError(t, err)
+
+	// Findings of current scan are recomputed in version of baseline
+	old := NewBaseline(&reporter.Report{
+		FingerprintVersion: report.FingerprintV1,
+		Events:             []reporter.Event{{ReportEvent: evt.ReportEvent, Fingerprint: v1}},
+	})
+	assert.True(t, old.Has(evt))
+	assert.False(t, old.Has(newEvent("sha256:aa", report.Critical, report.MaliciousFile, "/bin/other")))
+
+	// Redacted findings can't be recomputed
+	redacted := newEvent("sha256:aa", report.Critical, report.MaliciousFile, reporter.RedactedPathPrefix+"0a1b2c3d")
+	assert.False(t, old.Has(redacted))
+
+	var none *Baseline
+	assert.False(t, none.Has(evt))
+}
+
+func TestPolicyMalformed(t *testing.T) {
+	for _, p := range []*Policy{
+		{SeverityThreshold: "severe"},
+		{Rules: []PolicyRule{{AlertType: "Malware"}}},
+		{Rules: []PolicyRule{{AlertType: "Weakpass", SeverityThreshold: "3"}}},
+		{Plugins: map[string]string{"veinmind-new": "audit"}},
+		{Tenants: map[string]TenantPolicy{"payments": {SeverityThreshold: "severe"}}},
+		{Tenants: map[string]TenantPolicy{"../payments": {}}},
+	} {
+		assert.Error(t, p.validate())
+	}
+}
+
+func TestEvaluateTenants(t *testing.T) {
+	policy := &Policy{
+		SeverityThreshold: "high",
+		Rules:             []PolicyRule{{AlertType: "Weakpass", SeverityThreshold: "critical"}},
+		Tenants: map[string]TenantPolicy{
+			"payments":     {SeverityThreshold: "low"},
+			tenant.Default: {SeverityThreshold: "medium"},
+		},
+	}
+	assert.NoError(t, policy.validate())
+
+	payments := newEvent("pay", report.Low, report.Sensitive, "/etc/key")
+	payments.Tenant = "payments"
+	paymentsWeakpass := newEvent("pay", report.High, report.Weakpass, "/etc/shadow")
+	paymentsWeakpass.Tenant = "payments"
+	search := newEvent("search", report.Medium, report.Sensitive, "/etc/key")
+	search.Tenant = "search"
+	// Events without tenant belong to the default tenant
+	untagged := newEvent("app", report.Medium, report.Sensitive, "/etc/key")
+
+	d := Evaluate([]reporter.Event{payments, paymentsWeakpass, search, untagged}, Options{Policy: policy})
+	assert.Equal(t, []reporter.Event{payments, untagged}, d.Failed)
+	assert.Equal(t, map[string]int{SkipBelowThreshold: 2}, d.Skipped)
+}
+
+func TestEvaluateModes(t *testing.T) {
+	monitored := newEvent("app", report.Critical, report.MaliciousFile, "/bin/miner")
+	monitored.Monitor = &reporter.Monitor{Plugin: "veinmind-new"}
+	events := []reporter.Event{
+		monitored,
+		newEvent("app", report.High, report.Sensitive, "/etc/key"),
+	}
+
+	monitor := &Policy{Plugins: map[string]string{"veinmind-new": reporter.ModeMonitor, "veinmind-old": reporter.ModeDisabled}}
+	assert.NoError(t, monitor.validate())
+	assert.Equal(t, reporter.ModeMonitor, monitor.Mode("veinmind-new"))
+	assert.Equal(t, reporter.ModeEnforce, monitor.Mode("veinmind-sensitive"))
+	assert.Equal(t, []string{"veinmind-old"}, monitor.PluginsOf(reporter.ModeDisabled))
+
+	d := Evaluate(events, Options{Policy: monitor})
+	assert.Len(t, d.Failed, 1)
+	assert.Equal(t, map[string]int{SkipMonitor: 1}, d.Skipped)
+
+	// Reports are evaluated as recorded without policy
+	d = Evaluate(events, Options{})
+	assert.Len(t, d.Failed, 1)
+
+	// Flipping plugin to enforce fails the scan with the same report
+	enforce := &Policy{Plugins: map[string]string{"veinmind-new": reporter.ModeEnforce}}
+	assert.NoError(t, enforce.validate())
+	d = Evaluate(events, Options{Policy: enforce})
+	assert.Len(t, d.Failed, 2)
+	assert.Empty(t, d.Skipped)
+}
+
+func TestIgnoreRuleMalformed(t *testing.T) {
+	for _, r := range []IgnoreRule{
+		{Reason: "matches everything"},
+		{Path: "/etc/[a-"},
+		{AlertType: "Malware"},
+	} {
+		assert.Error(t, r.validate())
+	}
+}
@@ -0,0 +1,116 @@
+package gate
+
+import (
+	"github.com/BurntSushi/toml"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"path"
+	"time"
+)
+
+// IgnoreRule ignores events matching all specified fields
+type IgnoreRule struct {
+	Image       string    `toml:"image"`
+	AlertType   string    `toml:"alert_type"`
+	Path        string    `toml:"path"`
+	Fingerprint string    `toml:"fingerprint"`
+	Reason      string    `toml:"reason"`
+	Expires     time.Time `toml:"expires"`
+}
+
+type IgnoreRules struct {
+	Ignores []IgnoreRule `toml:"ignores"`
+}
+
+// LoadIgnoreRules parse ignore file
+func LoadIgnoreRules(path string) (*IgnoreRules, error) {
+	rules := &IgnoreRules{}
+	meta, err := toml.DecodeFile(path, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, errors.Errorf("ignore: unknown key %#v", undecoded[0].String())
+	}
+
+	for i, r := range rules.Ignores {
+		if err := r.validate(); err != nil {
+			return nil, errors.Wrapf(err, "ignore: rule %d", i)
+		}
+	}
+
+	return rules, nil
+}
+
+func (r IgnoreRule) validate() error {
+	if r.Image == "" && r.AlertType == "" && r.Path == "" && r.Fingerprint == "" {
+		return errors.New("rule matches every event")
+	}
+
+	for _, pattern := range []string{r.Image, r.Path} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Errorf("%#v is not a valid glob", pattern)
+		}
+	}
+
+	if r.AlertType != "" {
+		if _, err := reporter.ParseAlertType(r.AlertType); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Match returns the first unexpired rule matching event
+func (rules *IgnoreRules) Match(evt reporter.Event, now time.Time) (*IgnoreRule, bool) {
+	if rules == nil {
+		return nil, false
+	}
+
+	for i := range rules.Ignores {
+		r := &rules.Ignores[i]
+		if !r.Expires.IsZero() && now.After(r.Expires) {
+			continue
+		}
+
+		if r.match(evt) {
+			return r, true
+		}
+	}
+
+	return nil, false
+}
+
+func (r IgnoreRule) match(evt reporter.Event) bool {
+	if r.Fingerprint != "" && !reporter.HasFingerprint(evt, r.Fingerprint) {
+		return false
+	}
+
+	if r.AlertType != "" {
+		if a, _ := reporter.ParseAlertType(r.AlertType); a != evt.AlertType {
+			return false
+		}
+	}
+
+	if r.Image != "" && !matchAny(r.Image, append([]string{evt.ID}, evt.ImageRefs...)) {
+		return false
+	}
+
+	if r.Path != "" && !matchAny(r.Path, reporter.Paths(evt.AlertDetails)) {
+		return false
+	}
+
+	return true
+}
+
+func matchAny(pattern string, candidates []string) bool {
+	for _, c := range candidates {
+		if ok, _ := path.Match(pattern, c); ok {
+			return true
+		}
+	}
+
+	return false
+}
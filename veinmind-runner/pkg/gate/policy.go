@@ -0,0 +1,161 @@
+package gate
+
+import (
+	"github.com/BurntSushi/toml"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/tenant"
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// Policy decides which events fail the scan, Plugins are enforcement
+// modes of plugins by name and Tenants are policies of tenants by name
+type Policy struct {
+	SeverityThreshold string                  `toml:"severity_threshold"`
+	Rules             []PolicyRule            `toml:"rules"`
+	Plugins           map[string]string       `toml:"plugins"`
+	Tenants           map[string]TenantPolicy `toml:"tenants"`
+
+	threshold *report.Level
+}
+
+// TenantPolicy overrides severity threshold of policy for events of
+// tenant, rules of alert types still apply
+type TenantPolicy struct {
+	SeverityThreshold string `toml:"severity_threshold"`
+
+	threshold *report.Level
+}
+
+// PolicyRule overrides policy for events of alert type
+type PolicyRule struct {
+	AlertType         string `toml:"alert_type"`
+	SeverityThreshold string `toml:"severity_threshold"`
+	Ignore            bool   `toml:"ignore"`
+
+	alertType report.AlertType
+	threshold *report.Level
+}
+
+// LoadPolicy parse policy file
+func LoadPolicy(path string) (*Policy, error) {
+	p := &Policy{}
+	meta, err := toml.DecodeFile(path, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, errors.Errorf("policy: unknown key %#v", undecoded[0].String())
+	}
+
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *Policy) validate() error {
+	if p.SeverityThreshold != "" {
+		l, err := reporter.ParseLevel(p.SeverityThreshold)
+		if err != nil {
+			return errors.Wrap(err, "policy")
+		}
+		p.threshold = &l
+	}
+
+	for name, mode := range p.Plugins {
+		if err := reporter.CheckMode(mode); err != nil {
+			return errors.Wrapf(err, "policy: plugin %#v", name)
+		}
+	}
+
+	for name, t := range p.Tenants {
+		if err := tenant.CheckName(name); err != nil {
+			return errors.Wrap(err, "policy")
+		}
+		if t.SeverityThreshold != "" {
+			l, err := reporter.ParseLevel(t.SeverityThreshold)
+			if err != nil {
+				return errors.Wrapf(err, "policy: tenant %#v", name)
+			}
+			t.threshold = &l
+			p.Tenants[name] = t
+		}
+	}
+
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		a, err := reporter.ParseAlertType(r.AlertType)
+		if err != nil {
+			return errors.Wrapf(err, "policy: rule %d", i)
+		}
+		r.alertType = a
+
+		if r.SeverityThreshold != "" {
+			l, err := reporter.ParseLevel(r.SeverityThreshold)
+			if err != nil {
+				return errors.Wrapf(err, "policy: rule %d", i)
+			}
+			r.threshold = &l
+		}
+	}
+
+	return nil
+}
+
+func (p *Policy) rule(a report.AlertType) *PolicyRule {
+	if p == nil {
+		return nil
+	}
+
+	for i := range p.Rules {
+		if p.Rules[i].alertType == a {
+			return &p.Rules[i]
+		}
+	}
+
+	return nil
+}
+
+// tenantThreshold returns severity threshold of tenant of event, events
+// without tenant belong to the default tenant
+func (p *Policy) tenantThreshold(evt reporter.Event) *report.Level {
+	if p == nil {
+		return nil
+	}
+	name := evt.Tenant
+	if name == "" {
+		name = tenant.Default
+	}
+	return p.Tenants[name].threshold
+}
+
+// Mode returns enforcement mode of plugin, plugins unknown to policy
+// are enforced
+func (p *Policy) Mode(plugin string) string {
+	if p == nil {
+		return reporter.ModeEnforce
+	}
+	if mode, ok := p.Plugins[plugin]; ok {
+		return mode
+	}
+	return reporter.ModeEnforce
+}
+
+// PluginsOf returns plugins of mode in policy
+func (p *Policy) PluginsOf(mode string) []string {
+	plugins := []string{}
+	if p == nil {
+		return plugins
+	}
+	for name, m := range p.Plugins {
+		if m == mode {
+			plugins = append(plugins, name)
+		}
+	}
+	sort.Strings(plugins)
+	return plugins
+}
@@ -0,0 +1,229 @@
+package gate
+
+import (
+	"fmt"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/history"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rules of trend gate comparing image against its baseline
+const (
+	// TrendCount fails images whose events of level outnumber the
+	// median of baseline
+	TrendCount = "count"
+	// TrendNew fails images with alert types firing which never fired
+	// in baseline
+	TrendNew = "new"
+	// TrendScore fails images whose score exceeds the median of
+	// baseline
+	TrendScore = "score"
+)
+
+var TrendRules = []string{TrendCount, TrendNew, TrendScore}
+
+// SkipTrend is reason of events of images within their baselines
+const SkipTrend = "within baseline trend"
+
+type TrendOptions struct {
+	// Window is how far back historical runs make baseline
+	Window time.Duration
+	Rules  []string
+	// Level is the level whose events are counted by TrendCount
+	Level report.Level
+}
+
+// CheckTrendRules checks whether rules are known trend rules
+func CheckTrendRules(rules []string) error {
+	for _, rule := range rules {
+		known := false
+		for _, r := range TrendRules {
+			known = known || r == rule
+		}
+		if !known {
+			return errors.Errorf("unknown trend rule %#v, expect some of %s",
+				rule, strings.Join(TrendRules, ","))
+		}
+	}
+	return nil
+}
+
+func (t TrendOptions) enabled(rule string) bool {
+	for _, r := range t.Rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// sample is findings of image in a run
+type sample struct {
+	count  int
+	score  int
+	alerts map[string]struct{}
+}
+
+func newSample(events []reporter.Event, level report.Level) sample {
+	s := sample{alerts: map[string]struct{}{}, score: reporter.Score(events)}
+	for _, evt := range events {
+		if evt.Level == level {
+			s.count++
+		}
+		s.alerts[reporter.AlertTypeString(evt.AlertType)] = struct{}{}
+	}
+	return s
+}
+
+// EvaluateTrend decides whether events of scanned images fail the scan
+// by comparing each image against its baseline of runs in window before
+// now. Images are keyed by reporter.ImageKey, and scanned are images
+// without events too. Events skipped by options other than threshold
+// aren't counted, both in the scan and in runs. Images without runs in
+// window are decided by static threshold and marked no baseline
+func EvaluateTrend(events []reporter.Event, scanned []string, runs []history.Record, now time.Time,
+	opts Options, trend TrendOptions) (Decision, []reporter.Trend) {
+	d := Decision{
+		Failed:  []reporter.Event{},
+		Skipped: map[string]int{},
+	}
+
+	current := map[string][]reporter.Event{}
+	images := []string{}
+	addImage := func(image string) {
+		if _, ok := current[image]; !ok {
+			current[image] = []reporter.Event{}
+			images = append(images, image)
+		}
+	}
+	for _, image := range scanned {
+		addImage(image)
+	}
+	for _, evt := range events {
+		if reason, skip := opts.skip(evt, now); skip && reason != SkipBelowThreshold {
+			d.Skipped[reason]++
+			continue
+		}
+		image := reporter.ImageKey(evt)
+		addImage(image)
+		current[image] = append(current[image], evt)
+	}
+	sort.Strings(images)
+
+	baselines := opts.baselines(runs, now.Add(-trend.Window), now, trend.Level)
+	trends := []reporter.Trend{}
+	for _, image := range images {
+		t := compare(image, current[image], baselines[image], trend)
+		if t.Status == reporter.TrendNoBaseline {
+			static := Evaluate(current[image], opts)
+			for reason, n := range static.Skipped {
+				d.Skipped[reason] += n
+			}
+			d.Failed = append(d.Failed, static.Failed...)
+			d.Reasons = append(d.Reasons, static.Reasons...)
+			t.Regressions = static.Reasons
+			t.Fail = static.Fail
+		} else if t.Fail {
+			d.Failed = append(d.Failed, current[image]...)
+			for _, r := range t.Regressions {
+				d.Reasons = append(d.Reasons, r+" in "+image)
+			}
+		} else if n := len(current[image]); n > 0 {
+			d.Skipped[SkipTrend] += n
+		}
+		trends = append(trends, t)
+	}
+
+	d.Fail = len(d.Reasons) > 0
+	return d, trends
+}
+
+// baselines returns samples of images in runs between since and until,
+// images are sampled in runs listing them or having events in them
+func (opts Options) baselines(runs []history.Record, since, until time.Time, level report.Level) map[string][]sample {
+	baselines := map[string][]sample{}
+	for _, run := range runs {
+		if run.Time.Before(since) || !run.Time.Before(until) {
+			continue
+		}
+
+		byImage := map[string][]reporter.Event{}
+		for _, image := range run.Images {
+			byImage[image] = []reporter.Event{}
+		}
+		for _, evt := range run.Events {
+			if reason, skip := opts.skip(evt, until); skip && reason != SkipBelowThreshold {
+				continue
+			}
+			image := reporter.ImageKey(evt)
+			byImage[image] = append(byImage[image], evt)
+		}
+		for image, events := range byImage {
+			baselines[image] = append(baselines[image], newSample(events, level))
+		}
+	}
+	return baselines
+}
+
+// compare compares findings of image against samples of its baseline
+func compare(image string, events []reporter.Event, samples []sample, trend TrendOptions) reporter.Trend {
+	s := newSample(events, trend.Level)
+	t := reporter.Trend{
+		Image:  image,
+		Status: reporter.TrendNoBaseline,
+		Runs:   len(samples),
+		Level:  reporter.LevelString(trend.Level),
+		Count:  s.count,
+		Score:  s.score,
+	}
+	if len(samples) == 0 {
+		return t
+	}
+	t.Status = reporter.TrendCompared
+
+	counts, scores := []float64{}, []float64{}
+	fired := map[string]struct{}{}
+	for _, b := range samples {
+		counts = append(counts, float64(b.count))
+		scores = append(scores, float64(b.score))
+		for a := range b.alerts {
+			fired[a] = struct{}{}
+		}
+	}
+	t.MedianCount, t.MedianScore = median(counts), median(scores)
+	for a := range s.alerts {
+		if _, ok := fired[a]; !ok {
+			t.NewAlertTypes = append(t.NewAlertTypes, a)
+		}
+	}
+	sort.Strings(t.NewAlertTypes)
+
+	if trend.enabled(TrendCount) && float64(t.Count) > t.MedianCount {
+		t.Regressions = append(t.Regressions, fmt.Sprintf("%s events increased to %d from median %g of %d run(s)",
+			t.Level, t.Count, t.MedianCount, t.Runs))
+	}
+	if trend.enabled(TrendNew) && len(t.NewAlertTypes) > 0 {
+		t.Regressions = append(t.Regressions, fmt.Sprintf("new alert types %s fired",
+			strings.Join(t.NewAlertTypes, ",")))
+	}
+	if trend.enabled(TrendScore) && float64(t.Score) > t.MedianScore {
+		t.Regressions = append(t.Regressions, fmt.Sprintf("score regressed to %d from median %g of %d run(s)",
+			t.Score, t.MedianScore, t.Runs))
+	}
+	t.Fail = len(t.Regressions) > 0
+	return t
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,112 @@
+package gate
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/history"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestEvaluateTrend(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	miner := func(id string, path string) reporter.Event {
+		return newEvent(id, report.Critical, report.MaliciousFile, path)
+	}
+
+	runs := []history.Record{
+		// Outside window
+		{Time: now.Add(-30 * day), Images: []string{"app:latest", "web:latest"}},
+		{Time: now.Add(-3 * day), Images: []string{"app:latest", "web:latest", "db:latest"},
+			Events: []reporter.Event{miner("app", "/bin/a")}},
+		{Time: now.Add(-2 * day), Images: []string{"app:latest", "web:latest", "db:latest"},
+			Events: []reporter.Event{
+				miner("app", "/bin/a"),
+				miner("app", "/bin/b"),
+				newEvent("db", report.Low, report.Weakpass, "/etc/shadow"),
+			}},
+		{Time: now.Add(-day), Images: []string{"app:latest", "web:latest", "db:latest"},
+			Events: []reporter.Event{
+				miner("app", "/bin/a"),
+				newEvent("db", report.Low, report.Weakpass, "/etc/shadow"),
+			}},
+	}
+
+	events := []reporter.Event{
+		// app: 2 criticals against median 1
+		miner("app", "/bin/a"),
+		miner("app", "/bin/c"),
+		// db: weakpass fired before, within trend
+		newEvent("db", report.Low, report.Weakpass, "/etc/shadow"),
+		// web: clean in baseline, a new alert type fires
+		newEvent("web", report.Low, report.Backdoor, "/etc/profile"),
+		// new: no baseline, decided by static threshold
+		newEvent("new", report.Low, report.Weakpass, "/etc/shadow"),
+	}
+
+	high := report.High
+	d, trends := EvaluateTrend(events, []string{"clean:latest"}, runs, now,
+		Options{Threshold: &high},
+		TrendOptions{Window: 7 * day, Rules: TrendRules, Level: report.Critical})
+
+	assert.True(t, d.Fail)
+	assert.Len(t, trends, 5)
+	byImage := map[string]reporter.Trend{}
+	for _, trend := range trends {
+		byImage[trend.Image] = trend
+	}
+
+	app := byImage["app:latest"]
+	assert.Equal(t, reporter.TrendCompared, app.Status)
+	assert.Equal(t, 3, app.Runs)
+	assert.Equal(t, 2, app.Count)
+	assert.Equal(t, float64(1), app.MedianCount)
+	assert.Equal(t, 8, app.Score)
+	assert.Equal(t, float64(4), app.MedianScore)
+	assert.Len(t, app.Regressions, 2)
+	assert.True(t, app.Fail)
+
+	db := byImage["db:latest"]
+	assert.Equal(t, reporter.TrendCompared, db.Status)
+	assert.Empty(t, db.NewAlertTypes)
+	assert.False(t, db.Fail)
+
+	web := byImage["web:latest"]
+	assert.Equal(t, []string{"Backdoor"}, web.NewAlertTypes)
+	assert.True(t, web.Fail)
+
+	// Below static threshold without baseline, marked rather than passed
+	// silently
+	assert.Equal(t, reporter.TrendNoBaseline, byImage["new:latest"].Status)
+	assert.False(t, byImage["new:latest"].Fail)
+	assert.Equal(t, 1, d.Skipped[SkipBelowThreshold])
+	assert.Equal(t, reporter.TrendNoBaseline, byImage["clean:latest"].Status)
+
+	assert.Equal(t, 1, d.Skipped[SkipTrend])
+	assert.Len(t, d.Failed, 3)
+}
+
+func TestEvaluateTrendRules(t *testing.T) {
+	now := time.Now()
+	runs := []history.Record{
+		{Time: now.Add(-time.Hour), Images: []string{"app:latest"}},
+	}
+	events := []reporter.Event{newEvent("app", report.Low, report.Weakpass, "/etc/shadow")}
+
+	d, trends := EvaluateTrend(events, nil, runs, now, Options{},
+		TrendOptions{Window: time.Hour * 2, Rules: []string{TrendCount}, Level: report.Critical})
+	assert.False(t, d.Fail)
+	assert.Equal(t, []string{"Weakpass"}, trends[0].NewAlertTypes)
+
+	d, _ = EvaluateTrend(events, nil, runs, now, Options{},
+		TrendOptions{Window: time.Hour * 2, Rules: []string{TrendScore}, Level: report.Critical})
+	assert.True(t, d.Fail)
+	assert.Equal(t, []string{"score regressed to 1 from median 0 of 1 run(s) in app:latest"}, d.Reasons)
+}
+
+func TestCheckTrendRules(t *testing.T) {
+	assert.NoError(t, CheckTrendRules(TrendRules))
+	assert.Error(t, CheckTrendRules([]string{"count", "median"}))
+}
@@ -0,0 +1,139 @@
+// Package hashcache hashes files of images once and caches digests
+// in a bounded LRU cache shared by plugins
+package hashcache
+
+import (
+	"container/list"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/hash"
+	"io"
+	"sync"
+)
+
+// Opener opens path within image
+type Opener func(path string) (io.ReadCloser, error)
+
+type Stats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+type key struct {
+	imageID string
+	path    string
+}
+
+type entry struct {
+	key    key
+	digest hash.Digest
+}
+
+// call is an in-flight hash computation, concurrent requests of the
+// same file wait for it rather than hashing again
+type call struct {
+	wg     sync.WaitGroup
+	digest hash.Digest
+	err    error
+}
+
+type Cache struct {
+	size  int
+	mu    sync.Mutex
+	ll    *list.List
+	items map[key]*list.Element
+	calls map[key]*call
+	stats Stats
+}
+
+// New creates cache holding at most size digests
+func New(size int) *Cache {
+	return &Cache{
+		size:  size,
+		ll:    list.New(),
+		items: map[key]*list.Element{},
+		calls: map[key]*call{},
+	}
+}
+
+// Get returns digests of path within image, file is opened and hashed
+// only when digests aren't cached
+func (c *Cache) Get(imageID string, path string, open Opener) (hash.Digest, error) {
+	k := key{imageID, path}
+
+	c.mu.Lock()
+	if e, ok := c.items[k]; ok {
+		c.ll.MoveToFront(e)
+		c.stats.Hits++
+		c.mu.Unlock()
+		return e.Value.(*entry).digest, nil
+	}
+
+	if cl, ok := c.calls[k]; ok {
+		c.stats.Hits++
+		c.mu.Unlock()
+		cl.wg.Wait()
+		return cl.digest, cl.err
+	}
+
+	c.stats.Misses++
+	cl := &call{}
+	cl.wg.Add(1)
+	c.calls[k] = cl
+	c.mu.Unlock()
+
+	cl.digest, cl.err = compute(path, open)
+	cl.wg.Done()
+
+	c.mu.Lock()
+	delete(c.calls, k)
+	if cl.err == nil {
+		c.add(k, cl.digest)
+	}
+	c.mu.Unlock()
+
+	return cl.digest, cl.err
+}
+
+// Peek returns cached digests of path within image without hashing it,
+// statistics aren't affected
+func (c *Cache) Peek(imageID string, path string) (hash.Digest, bool) {
+	if c == nil {
+		return hash.Digest{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key{imageID, path}]
+	if !ok {
+		return hash.Digest{}, false
+	}
+	return e.Value.(*entry).digest, true
+}
+
+func (c *Cache) add(k key, d hash.Digest) {
+	c.items[k] = c.ll.PushFront(&entry{key: k, digest: d})
+
+	for c.size > 0 && c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry).key)
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func compute(path string, open Opener) (hash.Digest, error) {
+	r, err := open(path)
+	if err != nil {
+		return hash.Digest{}, err
+	}
+	defer r.Close()
+
+	return hash.Compute(r)
+}
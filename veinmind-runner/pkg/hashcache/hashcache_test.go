@@ -0,0 +1,71 @@
+package hashcache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func opener(opened *int64) Opener {
+	return func(path string) (io.ReadCloser, error) {
+		atomic.AddInt64(opened, 1)
+		return ioutil.NopCloser(strings.NewReader(path)), nil
+	}
+}
+
+func TestGet(t *testing.T) {
+	var opened int64
+	c := New(2)
+
+	d, err := c.Get("image", "/bin/sh", opener(&opened))
+	assert.NoError(t, err)
+	assert.Len(t, d.SHA256, 64)
+
+	again, err := c.Get("image", "/bin/sh", opener(&opened))
+	assert.NoError(t, err)
+	assert.Equal(t, d, again)
+	assert.Equal(t, int64(1), opened)
+
+	// Same path of another image is hashed again
+	_, err = c.Get("other", "/bin/sh", opener(&opened))
+	assert.NoError(t, err)
+	_, err = c.Get("image", "/bin/ls", opener(&opened))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), opened)
+
+	// Least recently used digest is evicted
+	_, err = c.Get("image", "/bin/sh", opener(&opened))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), opened)
+	assert.Equal(t, Stats{Hits: 1, Misses: 4, Evictions: 2}, c.Stats())
+
+	_, ok := c.Peek("other", "/bin/sh")
+	assert.False(t, ok)
+	peeked, ok := c.Peek("image", "/bin/sh")
+	assert.True(t, ok)
+	assert.Equal(t, d, peeked)
+	assert.Equal(t, Stats{Hits: 1, Misses: 4, Evictions: 2}, c.Stats())
+}
+
+func TestGetConcurrent(t *testing.T) {
+	var opened int64
+	c := New(16)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Get("image", "/bin/sh", opener(&opened))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(1), opened)
+	assert.Equal(t, int64(31), c.Stats().Hits)
+}
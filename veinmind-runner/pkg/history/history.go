@@ -0,0 +1,284 @@
+// Package history persists scan results of runs as JSON lines, one
+// line per run
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// appendFlag opens history file for appending records
+const appendFlag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+
+// Record is the result of a run of an agent, Seq increases with runs
+type Record struct {
+	Agent  string           `json:"agent"`
+	Host   string           `json:"host"`
+	Seq    uint64           `json:"seq"`
+	Time   time.Time        `json:"time"`
+	Events []reporter.Event `json:"events"`
+	// Images are keys of images scanned in the run, images without
+	// events are only known to be scanned from them
+	Images []string `json:"images,omitempty"`
+}
+
+type Store struct {
+	path string
+	mu   sync.Mutex
+	f    *os.File
+	// last is the last seq of each agent, records retried by agent
+	// are stored once
+	last map[string]uint64
+}
+
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path: path,
+		last: map[string]uint64{},
+	}
+
+	records, err := s.Records()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, r := range records {
+		if r.Seq > s.last[r.Agent] {
+			s.last[r.Agent] = r.Seq
+		}
+	}
+
+	s.f, err = lockCurrent(nil, path, appendFlag)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock(s.f)
+
+	// Terminate torn line so that it doesn't corrupt the next record
+	if torn, err := endsWithTornLine(path); err != nil {
+		s.f.Close()
+		return nil, err
+	} else if torn {
+		if _, err := s.f.Write([]byte{'\n'}); err != nil {
+			s.f.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Append stores record, false is returned when record of the same seq
+// has been stored
+func (s *Store) Append(r Record) (bool, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if last, ok := s.last[r.Agent]; ok && r.Seq <= last {
+		return false, nil
+	}
+
+	// History file replaced by Trim since last append is reopened
+	s.f, err = lockCurrent(s.f, s.path, appendFlag)
+	if err != nil {
+		return false, err
+	}
+	defer unlock(s.f)
+
+	if _, err := s.f.Write(append(b, '\n')); err != nil {
+		return false, err
+	}
+	if err := s.f.Sync(); err != nil {
+		return false, err
+	}
+	s.last[r.Agent] = r.Seq
+
+	return true, nil
+}
+
+// Records reads all records ordered by agent and seq, a torn line
+// written by interrupted process is skipped
+func (s *Store) Records() ([]Record, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := []Record{}
+	reader := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			r := Record{}
+			if jsonErr := json.Unmarshal(line, &r); jsonErr != nil {
+				log.Warnf("Skip malformed history record at line %d: %s\n", n, jsonErr.Error())
+			} else {
+				records = append(records, r)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Agent != records[j].Agent {
+			return records[i].Agent < records[j].Agent
+		}
+		return records[i].Seq < records[j].Seq
+	})
+
+	return records, nil
+}
+
+// Close closes store once append in progress completes
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.f.Close()
+}
+
+// lockCurrent locks f exclusively against appends and trims of other
+// processes, f is (re)opened with flag if it's nil or no longer the file
+// at path, which is the case once Trim replaces the file
+func lockCurrent(f *os.File, path string, flag int) (*os.File, error) {
+	for {
+		if f == nil {
+			var err error
+			if f, err = os.OpenFile(path, flag, 0600); err != nil {
+				return nil, err
+			}
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "lock history")
+		}
+
+		current, err := os.Stat(path)
+		if err != nil && !os.IsNotExist(err) {
+			f.Close()
+			return nil, err
+		}
+		if info, statErr := f.Stat(); err == nil && statErr == nil && os.SameFile(current, info) {
+			return f, nil
+		}
+		f.Close()
+		f = nil
+	}
+}
+
+func unlock(f *os.File) {
+	_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
+
+func endsWithTornLine(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return false, err
+	}
+
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, info.Size()-1); err != nil {
+		return false, err
+	}
+	return b[0] != '\n', nil
+}
+
+// Latest returns the latest record of each agent
+func Latest(records []Record) []Record {
+	latest := []Record{}
+	for i, r := range records {
+		if i+1 == len(records) || records[i+1].Agent != r.Agent {
+			latest = append(latest, r)
+		}
+	}
+
+	return latest
+}
+
+// Runs returns records of agent ordered by seq
+func Runs(records []Record, agent string) []Record {
+	runs := []Record{}
+	for _, r := range records {
+		if r.Agent == agent {
+			runs = append(runs, r)
+		}
+	}
+
+	return runs
+}
+
+// Trim removes records of runs before from history file at path and
+// returns how many are removed, the file is left untouched on dry run.
+// Malformed lines are kept as they can't be dated. Stores open on path
+// append to the trimmed file afterwards
+func Trim(path string, before time.Time, dryRun bool) (int, error) {
+	// Lock is held until the file is replaced, records appended by a
+	// running collector are never lost in between
+	f, err := lockCurrent(nil, path, os.O_RDONLY)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		return 0, err
+	}
+
+	kept := make([]byte, 0, len(content))
+	trimmed := 0
+	for _, line := range bytes.SplitAfter(content, []byte{'\n'}) {
+		r := Record{}
+		if len(bytes.TrimSpace(line)) > 0 && json.Unmarshal(line, &r) == nil && r.Time.Before(before) {
+			trimmed++
+			continue
+		}
+		kept = append(kept, line...)
+	}
+	if trimmed == 0 || dryRun {
+		return trimmed, nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-history-")
+	if err != nil {
+		return 0, errors.Wrap(err, "trim history")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(kept); err != nil {
+		tmp.Close()
+		return 0, errors.Wrap(err, "trim history")
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, errors.Wrap(err, "trim history")
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, errors.Wrap(err, "trim history")
+	}
+	return trimmed, nil
+}
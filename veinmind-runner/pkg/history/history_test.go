@@ -0,0 +1,91 @@
+package history
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history.jsonl")
+	store, err := Open(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	now := time.Now().UTC()
+	for _, r := range []Record{
+		{Agent: "host-2", Seq: 1, Time: now},
+		{Agent: "host-1", Seq: 2, Time: now},
+		{Agent: "host-1", Seq: 1, Time: now.Add(-time.Hour)},
+		{Agent: "host-1", Seq: 3, Time: now},
+	} {
+		_, err := store.Append(r)
+		require.NoError(t, err)
+	}
+
+	// Records retried or out of order are stored once
+	records, err := store.Records()
+	require.NoError(t, err)
+	assert.Len(t, records, 3)
+
+	latest := Latest(records)
+	require.Len(t, latest, 2)
+	assert.Equal(t, "host-1", latest[0].Agent)
+	assert.Equal(t, uint64(3), latest[0].Seq)
+	assert.Equal(t, "host-2", latest[1].Agent)
+
+	runs := Runs(records, "host-1")
+	require.Len(t, runs, 2)
+	assert.Equal(t, uint64(2), runs[0].Seq)
+	assert.Equal(t, uint64(3), runs[1].Seq)
+	assert.Empty(t, Runs(records, "host-3"))
+}
+
+func TestTrim(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history.jsonl")
+	store, err := Open(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	now := time.Now().UTC()
+	_, err = store.Append(Record{Agent: "host-1", Seq: 1, Time: now.Add(-48 * time.Hour)})
+	require.NoError(t, err)
+	_, err = store.Append(Record{Agent: "host-1", Seq: 2, Time: now})
+	require.NoError(t, err)
+
+	n, err := Trim(path, now.Add(-24*time.Hour), true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	records, err := store.Records()
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	n, err = Trim(path, now.Add(-24*time.Hour), false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// Store open during trim appends to the trimmed file
+	_, err = store.Append(Record{Agent: "host-1", Seq: 3, Time: now})
+	require.NoError(t, err)
+	records, err = store.Records()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, uint64(2), records[0].Seq)
+	assert.Equal(t, uint64(3), records[1].Seq)
+
+	n, err = Trim(filepath.Join(dir, "missing.jsonl"), now, false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
@@ -0,0 +1,125 @@
+// Package hook runs user commands before and after scans, context of
+// the scan is passed to commands through environment variables
+package hook
+
+import (
+	"bufio"
+	"context"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/summary"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	Pre  = "pre"
+	Post = "post"
+)
+
+// Environment variables of hook commands, list values are separated by
+// newlines
+const (
+	EnvHook       = "VEINMIND_HOOK"
+	EnvCommand    = "VEINMIND_COMMAND"
+	EnvTargets    = "VEINMIND_TARGETS"
+	EnvReports    = "VEINMIND_REPORTS"
+	EnvScanned    = "VEINMIND_SCANNED"
+	EnvFailed     = "VEINMIND_FAILED"
+	EnvEvents     = "VEINMIND_EVENTS"
+	EnvCritical   = "VEINMIND_CRITICAL"
+	EnvHigh       = "VEINMIND_HIGH"
+	EnvSuppressed = "VEINMIND_SUPPRESSED"
+	EnvExitCode   = "VEINMIND_EXIT_CODE"
+	EnvDecision   = "VEINMIND_DECISION"
+)
+
+// Decisions of scan passed to post hook
+const (
+	DecisionPass = "pass"
+	DecisionFail = "fail"
+)
+
+// Context is scan context passed to hook, result fields are only set
+// for post hook
+type Context struct {
+	Hook    string
+	Command string
+	// Targets are targets given to command, empty means all
+	Targets []string
+	// Reports are paths of report files written
+	Reports []string
+	Summary *summary.Summary
+}
+
+// Environ returns environment variables of ctx
+func (c Context) Environ() []string {
+	env := []string{
+		EnvHook + "=" + c.Hook,
+		EnvCommand + "=" + c.Command,
+		EnvTargets + "=" + strings.Join(c.Targets, "\n"),
+	}
+	if c.Hook != Post {
+		return env
+	}
+
+	env = append(env, EnvReports+"="+strings.Join(c.Reports, "\n"))
+	if s := c.Summary; s != nil {
+		decision := DecisionPass
+		if s.Exit != 0 {
+			decision = DecisionFail
+		}
+		env = append(env,
+			EnvScanned+"="+strconv.Itoa(s.Scanned),
+			EnvFailed+"="+strconv.Itoa(s.Failed),
+			EnvEvents+"="+strconv.Itoa(s.Events),
+			EnvCritical+"="+strconv.Itoa(s.Critical),
+			EnvHigh+"="+strconv.Itoa(s.High),
+			EnvSuppressed+"="+strconv.Itoa(s.Suppressed),
+			EnvExitCode+"="+strconv.Itoa(s.Exit),
+			EnvDecision+"="+decision,
+		)
+	}
+	return env
+}
+
+// Run runs command with shell and environment of ctx added, every line
+// of stdout and stderr of command is passed to log
+func Run(ctx context.Context, command string, c Context, log func(line string)) error {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), c.Environ()...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "%s hook", c.Hook)
+	}
+
+	// Lines of stdout and stderr are logged as they come
+	wg := sync.WaitGroup{}
+	for _, r := range []io.Reader{stdout, stderr} {
+		wg.Add(1)
+		go func(r io.Reader) {
+			defer wg.Done()
+			scanner := bufio.NewScanner(r)
+			for scanner.Scan() {
+				log(scanner.Text())
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	if err := cmd.Wait(); err != nil {
+		return errors.Wrapf(err, "%s hook", c.Hook)
+	}
+	return nil
+}
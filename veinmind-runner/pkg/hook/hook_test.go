@@ -0,0 +1,46 @@
+package hook
+
+import (
+	"context"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/summary"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"sync"
+	"testing"
+)
+
+type lines struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *lines) log(line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, line)
+}
+
+func TestRunPre(t *testing.T) {
+	l := &lines{}
+	err := Run(context.Background(), `echo "$VEINMIND_HOOK $VEINMIND_COMMAND"; echo "$VEINMIND_TARGETS" >&2; echo "[$VEINMIND_EVENTS]"`, Context{
+		Hook:    Pre,
+		Command: "scan-host",
+		Targets: []string{"nginx", "redis"},
+	}, l.log)
+	assert.NoError(t, err)
+
+	sort.Strings(l.lines)
+	assert.Equal(t, []string{"[]", "nginx", "pre scan-host", "redis"}, l.lines)
+}
+
+func TestRunPost(t *testing.T) {
+	l := &lines{}
+	err := Run(context.Background(), `echo "$VEINMIND_REPORTS $VEINMIND_EVENTS $VEINMIND_EXIT_CODE $VEINMIND_DECISION"; exit 3`, Context{
+		Hook:    Post,
+		Command: "scan-registry",
+		Reports: []string{"report.json"},
+		Summary: &summary.Summary{Events: 7, Exit: 1},
+	}, l.log)
+	assert.EqualError(t, err, "post hook: exit status 3")
+	assert.Equal(t, []string{"report.json 7 1 fail"}, l.lines)
+}
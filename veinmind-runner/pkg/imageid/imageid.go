@@ -0,0 +1,83 @@
+// Package imageid resolves images given by users, which are references
+// or full or abbreviated image ids
+package imageid
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// algorithm prefixes ids of images, ids are accepted with or without it
+const algorithm = "sha256:"
+
+var hexPattern = regexp.MustCompile(`^[0-9a-f]{1,64}$`)
+
+// Finder finds images of runtime, it's implemented by runtimes
+type Finder interface {
+	FindImageIDs(pattern string) ([]string, error)
+	ListImageIDs() ([]string, error)
+}
+
+// AmbiguousError is returned if prefix of id matches more than one
+// image, candidates are listed to pick one
+type AmbiguousError struct {
+	Prefix     string
+	Candidates []string
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("image id prefix %s is ambiguous, candidates: %s", e.Prefix, strings.Join(e.Candidates, ", "))
+}
+
+// Prefix returns hex digits of arg if it's a full or abbreviated image
+// id, with or without sha256: prefix
+func Prefix(arg string) (string, bool) {
+	hex := strings.TrimPrefix(strings.ToLower(arg), algorithm)
+	if !hexPattern.MatchString(hex) {
+		return "", false
+	}
+	return hex, true
+}
+
+// Find returns ids of images of arg. Arg found by runtime as reference
+// or id is returned as runtime finds it, otherwise arg is taken as id
+// prefix and resolved against images of runtime. AmbiguousError is
+// returned if prefix matches more than one image
+func Find(f Finder, arg string) ([]string, error) {
+	ids, err := f.FindImageIDs(arg)
+	if err != nil || len(ids) > 0 {
+		return ids, err
+	}
+
+	prefix, ok := Prefix(arg)
+	if !ok {
+		return nil, nil
+	}
+	all, err := f.ListImageIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []string{}
+	for _, id := range all {
+		if strings.HasPrefix(hexOf(id), prefix) {
+			matched = append(matched, id)
+		}
+	}
+	if len(matched) > 1 {
+		sort.Strings(matched)
+		return nil, &AmbiguousError{Prefix: arg, Candidates: matched}
+	}
+	return matched, nil
+}
+
+// hexOf returns hex digits of image id, ids of some runtimes are
+// qualified by namespace, e.g. k8s.io/sha256:<hex>
+func hexOf(id string) string {
+	if i := strings.LastIndex(id, ":"); i != -1 {
+		return id[i+1:]
+	}
+	return id
+}
@@ -0,0 +1,79 @@
+package imageid
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// fakeFinder finds images by full id or reference
+type fakeFinder struct {
+	ids  []string
+	refs map[string]string
+}
+
+func (f *fakeFinder) FindImageIDs(pattern string) ([]string, error) {
+	if id, ok := f.refs[pattern]; ok {
+		return []string{id}, nil
+	}
+	for _, id := range f.ids {
+		if id == pattern {
+			return []string{id}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeFinder) ListImageIDs() ([]string, error) {
+	return f.ids, nil
+}
+
+func TestFind(t *testing.T) {
+	nginx := "sha256:3f2a9c" + strings.Repeat("1", 58)
+	redis := "sha256:3f2a9d" + strings.Repeat("2", 58)
+	alpine := "k8s.io/sha256:c0ffee" + strings.Repeat("3", 58)
+	f := &fakeFinder{
+		ids:  []string{nginx, redis, alpine},
+		refs: map[string]string{"nginx:1.21": nginx, "cafe": redis},
+	}
+
+	for _, tc := range []struct {
+		arg      string
+		expected []string
+	}{
+		{"nginx:1.21", []string{nginx}},
+		{nginx, []string{nginx}},
+		{"3f2a9c", []string{nginx}},
+		{"sha256:3f2a9c", []string{nginx}},
+		{"3F2A9C", []string{nginx}},
+		{"c0ffee", []string{alpine}},
+		// References found by runtime win over id prefixes
+		{"cafe", []string{redis}},
+		{"deadbeef", []string{}},
+		{"nginx:latest", nil},
+	} {
+		ids, err := Find(f, tc.arg)
+		assert.NoError(t, err, tc.arg)
+		assert.Equal(t, tc.expected, ids, tc.arg)
+	}
+
+	_, err := Find(f, "3f2a9")
+	ambiguous := &AmbiguousError{}
+	if assert.True(t, errors.As(err, &ambiguous)) {
+		assert.Equal(t, []string{nginx, redis}, ambiguous.Candidates)
+	}
+	assert.Contains(t, err.Error(), "image id prefix 3f2a9 is ambiguous")
+}
+
+func TestPrefix(t *testing.T) {
+	for _, arg := range []string{"3f2a9c", "sha256:3f2a9c", "SHA256:3F2A9C"} {
+		prefix, ok := Prefix(arg)
+		assert.True(t, ok, arg)
+		assert.Equal(t, "3f2a9c", prefix, arg)
+	}
+	for _, arg := range []string{"nginx", "sha256:", "3f2a9c:latest", strings.Repeat("a", 65)} {
+		_, ok := Prefix(arg)
+		assert.False(t, ok, arg)
+	}
+}
@@ -0,0 +1,242 @@
+// Package interactive selects images to scan from a checklist on
+// terminal, the list is narrowed with a fuzzy filter
+package interactive
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/listing"
+	"github.com/pkg/errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrAborted is returned when selection is aborted by user
+var ErrAborted = errors.New("selection aborted")
+
+const help = `Commands:
+  /<text>    filter images fuzzily by text, "/" alone clears filter
+  1 3 5-7    toggle images by number of the list shown
+  a          toggle all images shown
+  <enter>    scan selected images
+  q          abort
+`
+
+// Match reports whether characters of query appear in text in order,
+// case is ignored
+func Match(query string, text string) bool {
+	text = strings.ToLower(text)
+	for _, r := range strings.ToLower(query) {
+		i := strings.IndexRune(text, r)
+		if i < 0 {
+			return false
+		}
+		text = text[i+len(string(r)):]
+	}
+	return true
+}
+
+// Label returns text of image shown in checklist and matched by filter
+func Label(image listing.Image) string {
+	label := image.Runtime + "  "
+	if len(image.Refs) > 0 {
+		label += strings.Join(image.Refs, ",") + "  "
+	}
+	return label + shortID(image.ID)
+}
+
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// Session is a checklist of images
+type Session struct {
+	images   []listing.Image
+	selected map[int]bool
+	filter   string
+}
+
+// NewSession creates checklist of images with nothing selected
+func NewSession(images []listing.Image) *Session {
+	return &Session{images: images, selected: map[int]bool{}}
+}
+
+// visible returns indexes of images matching filter
+func (s *Session) visible() []int {
+	indexes := []int{}
+	for i, image := range s.images {
+		if Match(s.filter, Label(image)) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// Selected returns images selected in order of checklist
+func (s *Session) Selected() []listing.Image {
+	selected := []listing.Image{}
+	for i, image := range s.images {
+		if s.selected[i] {
+			selected = append(selected, image)
+		}
+	}
+	return selected
+}
+
+// Unselected returns images deliberately left out
+func (s *Session) Unselected() []listing.Image {
+	unselected := []listing.Image{}
+	for i, image := range s.images {
+		if !s.selected[i] {
+			unselected = append(unselected, image)
+		}
+	}
+	return unselected
+}
+
+// Run shows checklist on w and reads commands from r until images are
+// confirmed, ErrAborted is returned if user quits or input ends
+func (s *Session) Run(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	s.render(w)
+	for {
+		fmt.Fprint(w, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(w)
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+			return ErrAborted
+		}
+
+		done, err := s.Handle(scanner.Text())
+		if err != nil {
+			fmt.Fprintln(w, err.Error())
+			continue
+		}
+		if done {
+			return nil
+		}
+		s.render(w)
+	}
+}
+
+// Handle applies a command line to checklist, done is returned when
+// selection is confirmed
+func (s *Session) Handle(line string) (bool, error) {
+	line = strings.TrimSpace(line)
+	switch {
+	case line == "":
+		if len(s.Selected()) == 0 {
+			return false, errors.New("no image is selected")
+		}
+		return true, nil
+	case line == "q":
+		return false, ErrAborted
+	case line == "?":
+		return false, errors.New(help)
+	case line == "a":
+		visible := s.visible()
+		all := true
+		for _, i := range visible {
+			all = all && s.selected[i]
+		}
+		for _, i := range visible {
+			s.selected[i] = !all
+		}
+		return false, nil
+	case strings.HasPrefix(line, "/"):
+		s.filter = strings.TrimSpace(line[1:])
+		return false, nil
+	}
+
+	visible := s.visible()
+	numbers, err := parseNumbers(line, len(visible))
+	if err != nil {
+		return false, err
+	}
+	for _, n := range numbers {
+		i := visible[n-1]
+		s.selected[i] = !s.selected[i]
+	}
+	return false, nil
+}
+
+func (s *Session) render(w io.Writer) {
+	visible := s.visible()
+	for n, i := range visible {
+		mark := " "
+		if s.selected[i] {
+			mark = "x"
+		}
+		fmt.Fprintf(w, "%3d [%s] %s\n", n+1, mark, Label(s.images[i]))
+	}
+	if s.filter != "" {
+		fmt.Fprintf(w, "filter %#v: %d of %d image(s) shown\n", s.filter, len(visible), len(s.images))
+	}
+	fmt.Fprintf(w, "%d image(s) selected, ? for help\n", len(s.Selected()))
+}
+
+// parseNumbers parses numbers and ranges separated by spaces or commas,
+// each of them must be within 1 and max
+func parseNumbers(line string, max int) ([]int, error) {
+	numbers := []int{}
+	fields := strings.FieldsFunc(line, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	for _, field := range fields {
+		from, to := field, field
+		if i := strings.Index(field, "-"); i > 0 {
+			from, to = field[:i], field[i+1:]
+		}
+
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, errors.Errorf("unknown command %#v, ? for help", line)
+		}
+		end, err := strconv.Atoi(to)
+		if err != nil {
+			return nil, errors.Errorf("unknown command %#v, ? for help", line)
+		}
+		if start < 1 || end > max || start > end {
+			return nil, errors.Errorf("%#v is out of range 1-%d", field, max)
+		}
+		for n := start; n <= end; n++ {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers, nil
+}
+
+// Command returns scan-host command scanning exactly images, images are
+// named by their first reference or ID if they have no reference
+func Command(images []listing.Image) string {
+	runtimes := map[string]struct{}{}
+	args := []string{}
+	for _, image := range images {
+		runtimes[image.Runtime] = struct{}{}
+		if len(image.Refs) > 0 {
+			args = append(args, image.Refs[0])
+		} else {
+			args = append(args, image.ID)
+		}
+	}
+
+	names := []string{}
+	for name := range runtimes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	command := []string{"veinmind-runner", "scan-host"}
+	if len(names) > 0 {
+		command = append(command, "--runtime", strings.Join(names, ","))
+	}
+	return strings.Join(append(command, args...), " ")
+}
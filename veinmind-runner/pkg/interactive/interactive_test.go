@@ -0,0 +1,51 @@
+package interactive
+
+import (
+	"bytes"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/listing"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+var images = []listing.Image{
+	{Runtime: "docker", ID: "sha256:0123456789abcdef", Refs: []string{"nginx:latest"}},
+	{Runtime: "docker", ID: "sha256:fedcba9876543210", Refs: []string{"redis:6"}},
+	{Runtime: "containerd", ID: "sha256:aaaabbbbccccdddd"},
+}
+
+func TestMatch(t *testing.T) {
+	assert.True(t, Match("", "nginx"))
+	assert.True(t, Match("ngx", "docker  nginx:latest"))
+	assert.True(t, Match("NGX", "nginx"))
+	assert.False(t, Match("xgn", "nginx"))
+}
+
+func TestSession(t *testing.T) {
+	s := NewSession(images)
+	out := &bytes.Buffer{}
+	err := s.Run(strings.NewReader("\n/rds\n1\n/\n3-4\n3\n\n"), out)
+	assert.NoError(t, err)
+
+	assert.Contains(t, out.String(), "no image is selected")
+	assert.Contains(t, out.String(), "1 of 3 image(s) shown")
+	assert.Contains(t, out.String(), "out of range 1-3")
+	assert.Equal(t, []listing.Image{images[1], images[2]}, s.Selected())
+	assert.Equal(t, []listing.Image{images[0]}, s.Unselected())
+	assert.Equal(t, "veinmind-runner scan-host --runtime containerd,docker redis:6 sha256:aaaabbbbccccdddd",
+		Command(s.Selected()))
+}
+
+func TestSessionToggleAll(t *testing.T) {
+	s := NewSession(images)
+	for _, line := range []string{"a", "2", "a"} {
+		done, err := s.Handle(line)
+		assert.NoError(t, err)
+		assert.False(t, done)
+	}
+	assert.Len(t, s.Selected(), 3)
+
+	_, err := s.Handle("q")
+	assert.Equal(t, ErrAborted, err)
+	assert.Equal(t, ErrAborted, NewSession(images).Run(strings.NewReader("1\n"), &bytes.Buffer{}))
+}
@@ -0,0 +1,205 @@
+// Package kubelet finds images used by pods running on the local node
+// through pods endpoint of kubelet, so that nodes can be scanned
+// without reaching apiserver
+package kubelet
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultAddress is the authenticated endpoint of kubelet, read-only
+// endpoint is usually http://127.0.0.1:10255 if it's enabled
+const DefaultAddress = "https://127.0.0.1:10250"
+
+// PodsPath is path of pods endpoint of kubelet
+const PodsPath = "/pods"
+
+// Workload is a container of pod using an image
+type Workload struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	// Image is image of container in spec of pod
+	Image string `json:"-"`
+	// ImageID is image of running container reported by runtime, in
+	// the form of docker-pullable://name@digest or an image id
+	ImageID string `json:"-"`
+}
+
+// Refs returns references of image of workload which local images can
+// be found by
+func (w Workload) Refs() []string {
+	refs := []string{}
+	if id := w.ImageID; id != "" {
+		if i := strings.Index(id, "://"); i >= 0 {
+			id = id[i+3:]
+		}
+		refs = append(refs, id)
+	}
+	if w.Image != "" {
+		refs = append(refs, w.Image)
+	}
+	return refs
+}
+
+// Config is how kubelet is reached
+type Config struct {
+	Address string
+	// TokenFile is bearer token, e.g. token of service account
+	TokenFile string
+	// CAFile verifies serving certificate of kubelet
+	CAFile string
+	// CertFile and KeyFile are client certificate of kubelet
+	CertFile string
+	KeyFile  string
+	// Insecure skips verifying serving certificate, which is often
+	// self-signed
+	Insecure bool
+	Timeout  time.Duration
+}
+
+// Client queries pods endpoint of kubelet
+type Client struct {
+	address string
+	token   string
+	client  *http.Client
+}
+
+// New creates client of config, files of config are read once
+func New(config Config) (*Client, error) {
+	address := config.Address
+	if address == "" {
+		address = DefaultAddress
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	c := &Client{address: strings.TrimSuffix(address, "/")}
+	if config.TokenFile != "" {
+		b, err := ioutil.ReadFile(config.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		c.token = strings.TrimSpace(string(b))
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.Insecure, MinVersion: tls.VersionTLS12}
+	if config.CAFile != "" {
+		ca, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.Errorf("kubelet: no certificate found in CA %#v", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	c.client = &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	return c, nil
+}
+
+// Workloads returns containers of pods running on node
+func (c *Client) Workloads(ctx context.Context) ([]Workload, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.address+PodsPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("kubelet: %s", resp.Status)
+	}
+	return Parse(resp.Body)
+}
+
+type podList struct {
+	Items []struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Spec struct {
+			Containers []container `json:"containers"`
+		} `json:"spec"`
+		Status struct {
+			Phase             string            `json:"phase"`
+			ContainerStatuses []containerStatus `json:"containerStatuses"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+type container struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+}
+
+type containerStatus struct {
+	Name    string `json:"name"`
+	ImageID string `json:"imageID"`
+}
+
+// Parse parses pod list of kubelet into containers of running pods,
+// image id of container is taken from its status if it's reported.
+// Init containers have finished once pod runs and are left out
+func Parse(r io.Reader) ([]Workload, error) {
+	pods := podList{}
+	if err := json.NewDecoder(r).Decode(&pods); err != nil {
+		return nil, errors.Wrap(err, "kubelet: decode pods")
+	}
+
+	workloads := []Workload{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != "Running" {
+			continue
+		}
+
+		statuses := map[string]containerStatus{}
+		for _, s := range pod.Status.ContainerStatuses {
+			statuses[s.Name] = s
+		}
+		for _, c := range pod.Spec.Containers {
+			w := Workload{
+				Namespace: pod.Metadata.Namespace,
+				Pod:       pod.Metadata.Name,
+				Container: c.Name,
+				Image:     c.Image,
+			}
+			if s, ok := statuses[c.Name]; ok {
+				w.ImageID = s.ImageID
+			}
+			workloads = append(workloads, w)
+		}
+	}
+	return workloads, nil
+}
@@ -0,0 +1,63 @@
+package kubelet
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+const pods = `{"kind": "PodList", "items": [
+  {
+    "metadata": {"name": "web-0", "namespace": "prod"},
+    "spec": {"containers": [{"name": "nginx", "image": "nginx:1.21"}, {"name": "sidecar", "image": "envoy:1.20"}]},
+    "status": {"phase": "Running", "containerStatuses": [
+      {"name": "nginx", "image": "nginx:1.21", "imageID": "docker-pullable://nginx@sha256:aaaa"}
+    ]}
+  },
+  {
+    "metadata": {"name": "job-1", "namespace": "batch"},
+    "spec": {"containers": [{"name": "job", "image": "busybox"}]},
+    "status": {"phase": "Succeeded"}
+  }
+]}`
+
+func TestWorkloads(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, PodsPath, r.URL.Path)
+		w.Write([]byte(pods))
+	}))
+	defer server.Close()
+
+	token := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, ioutil.WriteFile(token, []byte("secret\n"), 0600))
+
+	c, err := New(Config{Address: server.URL, TokenFile: token, Insecure: true})
+	assert.NoError(t, err)
+	workloads, err := c.Workloads(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []Workload{
+		{Namespace: "prod", Pod: "web-0", Container: "nginx", Image: "nginx:1.21", ImageID: "docker-pullable://nginx@sha256:aaaa"},
+		{Namespace: "prod", Pod: "web-0", Container: "sidecar", Image: "envoy:1.20"},
+	}, workloads)
+	assert.Equal(t, []string{"nginx@sha256:aaaa", "nginx:1.21"}, workloads[0].Refs())
+	assert.Equal(t, []string{"envoy:1.20"}, workloads[1].Refs())
+
+	// Serving certificate is verified unless insecure
+	c, err = New(Config{Address: server.URL, TokenFile: token})
+	assert.NoError(t, err)
+	_, err = c.Workloads(context.Background())
+	assert.Error(t, err)
+
+	c, err = New(Config{Address: server.URL, Insecure: true})
+	assert.NoError(t, err)
+	_, err = c.Workloads(context.Background())
+	assert.EqualError(t, err, "kubelet: 401 Unauthorized")
+}
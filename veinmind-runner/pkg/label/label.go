@@ -0,0 +1,117 @@
+// Package label selects images by labels of their config, e.g. labels
+// of team and pipeline stamped by build systems
+package label
+
+import (
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+// Term matches label Key, with value Value unless Value is empty. Terms
+// of "key" match images labeled with key regardless of value
+type Term struct {
+	Key   string
+	Value string
+}
+
+// ParseTerm parses term of "key=value" or "key"
+func ParseTerm(s string) (Term, error) {
+	key, value := s, ""
+	if i := strings.Index(s, "="); i >= 0 {
+		key, value = s[:i], s[i+1:]
+	}
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return Term{}, errors.Errorf("label %#v has no key", s)
+	}
+	return Term{Key: key, Value: value}, nil
+}
+
+func (t Term) String() string {
+	if t.Value == "" {
+		return t.Key
+	}
+	return t.Key + "=" + t.Value
+}
+
+// match returns value of label matched by term
+func (t Term) match(labels map[string]string) (string, bool) {
+	v, ok := labels[t.Key]
+	if !ok || (t.Value != "" && v != t.Value) {
+		return "", false
+	}
+	return v, true
+}
+
+// Selector matches images having labels of all terms of All and of
+// any term of Any, either of them may be empty
+type Selector struct {
+	All []Term
+	Any []Term
+}
+
+// New parses terms of selector, nil is returned if no term is given
+func New(all []string, anyOf []string) (*Selector, error) {
+	if len(all) == 0 && len(anyOf) == 0 {
+		return nil, nil
+	}
+
+	s := &Selector{}
+	for _, a := range all {
+		t, err := ParseTerm(a)
+		if err != nil {
+			return nil, err
+		}
+		s.All = append(s.All, t)
+	}
+	for _, a := range anyOf {
+		t, err := ParseTerm(a)
+		if err != nil {
+			return nil, err
+		}
+		s.Any = append(s.Any, t)
+	}
+	return s, nil
+}
+
+// Match returns labels matched by terms of selector, ok is false if
+// labels don't match. Images with no labels never match
+func (s *Selector) Match(labels map[string]string) (map[string]string, bool) {
+	if len(labels) == 0 {
+		return nil, false
+	}
+
+	matched := map[string]string{}
+	for _, t := range s.All {
+		v, ok := t.match(labels)
+		if !ok {
+			return nil, false
+		}
+		matched[t.Key] = v
+	}
+
+	if len(s.Any) > 0 {
+		found := false
+		for _, t := range s.Any {
+			if v, ok := t.match(labels); ok {
+				matched[t.Key] = v
+				found = true
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return matched, true
+}
+
+// String formats matched labels sorted by key, e.g. for dry runs
+func String(labels map[string]string) string {
+	terms := []string{}
+	for k, v := range labels {
+		terms = append(terms, Term{Key: k, Value: v}.String())
+	}
+	sort.Strings(terms)
+	return strings.Join(terms, ",")
+}
@@ -0,0 +1,59 @@
+package label
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseTerm(t *testing.T) {
+	term, err := ParseTerm("team=payments")
+	assert.NoError(t, err)
+	assert.Equal(t, Term{Key: "team", Value: "payments"}, term)
+
+	term, err = ParseTerm("pipeline")
+	assert.NoError(t, err)
+	assert.Equal(t, Term{Key: "pipeline"}, term)
+
+	// Values may contain "="
+	term, err = ParseTerm("args=a=b")
+	assert.NoError(t, err)
+	assert.Equal(t, "a=b", term.Value)
+
+	_, err = ParseTerm("=payments")
+	assert.Error(t, err)
+}
+
+func TestMatch(t *testing.T) {
+	s, err := New(nil, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, s)
+
+	labels := map[string]string{"team": "payments", "pipeline": "release", "os": "linux"}
+
+	s, err = New([]string{"team=payments", "pipeline"}, nil)
+	assert.NoError(t, err)
+	matched, ok := s.Match(labels)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"team": "payments", "pipeline": "release"}, matched)
+	assert.Equal(t, "pipeline=release,team=payments", String(matched))
+
+	// Terms of --label are ANDed
+	s, _ = New([]string{"team=payments", "pipeline=nightly"}, nil)
+	_, ok = s.Match(labels)
+	assert.False(t, ok)
+
+	// Terms of --label-any are ORed
+	s, _ = New(nil, []string{"team=search", "pipeline=release"})
+	matched, ok = s.Match(labels)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"pipeline": "release"}, matched)
+
+	s, _ = New([]string{"os=linux"}, []string{"team=search", "team=cache"})
+	_, ok = s.Match(labels)
+	assert.False(t, ok)
+
+	// Images with no labels never match
+	s, _ = New(nil, []string{"team"})
+	_, ok = s.Match(nil)
+	assert.False(t, ok)
+}
@@ -0,0 +1,188 @@
+package layer
+
+import (
+	api "github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/docker"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// whiteoutPrefix marks files removed by a layer from layers below it,
+// and opaqueWhiteout hides all files of its directory in layers below
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// Prefixes of history of layers created by legacy builder
+const (
+	shellPrefix = "/bin/sh -c "
+	nopPrefix   = "#(nop) "
+)
+
+// Provenance is the layer which introduced a file of image, CreatedBy
+// is the Dockerfile instruction which created the layer
+type Provenance struct {
+	Path      string `json:"path"`
+	Index     int    `json:"index"`
+	Digest    string `json:"digest"`
+	CreatedBy string `json:"created_by,omitempty"`
+}
+
+// Index maps files of image to the topmost layer containing them.
+// Layers are walked once when the index is first looked up, so images
+// without findings never pay for it
+type Index struct {
+	image     *docker.Image
+	once      sync.Once
+	paths     map[string]int
+	layers    map[string][]int
+	diffIDs   []string
+	createdBy []string
+}
+
+// NewIndex returns index of layers of image, nil is returned when
+// layers of image can't be opened
+func NewIndex(image api.Image) *Index {
+	dockerImage, ok := image.(*docker.Image)
+	if !ok {
+		return nil
+	}
+
+	return &Index{image: dockerImage}
+}
+
+func (x *Index) build() {
+	x.paths = map[string]int{}
+	x.layers = map[string][]int{}
+
+	diffIDs, err := DiffIDs(x.image)
+	if err != nil {
+		log.Error(err)
+	}
+	x.diffIDs = diffIDs
+
+	// History of empty layers like ENV has no layer
+	if oci, err := x.image.OCISpecV1(); err == nil && oci != nil {
+		for _, h := range oci.History {
+			if !h.EmptyLayer {
+				x.createdBy = append(x.createdBy, Instruction(h.CreatedBy))
+			}
+		}
+	}
+
+	for i := 0; i < x.image.NumLayers(); i++ {
+		l, err := x.image.OpenLayer(i)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		err = l.Walk("/", func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			// Overlay stores whiteouts as character devices
+			if info.Mode()&os.ModeCharDevice != 0 {
+				dir, name := path.Split(p)
+				p = path.Join(dir, whiteoutPrefix+name)
+			}
+			x.add(i, p)
+			return nil
+		})
+		if err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// add records path of layer, layers are added from bottom to top so
+// that the topmost layer wins. Whiteouts remove the file from index,
+// while layers holding it are still recorded
+func (x *Index) add(layer int, p string) {
+	dir, name := path.Split(p)
+	if name == opaqueWhiteout {
+		for q := range x.paths {
+			if strings.HasPrefix(q, dir) && x.paths[q] < layer {
+				delete(x.paths, q)
+			}
+		}
+		return
+	}
+	if strings.HasPrefix(name, whiteoutPrefix) {
+		delete(x.paths, path.Join(dir, strings.TrimPrefix(name, whiteoutPrefix)))
+		return
+	}
+	x.paths[p] = layer
+	x.layers[p] = append(x.layers[p], layer)
+}
+
+// Lookup returns provenance of path, false is returned when no layer
+// contains it
+func (x *Index) Lookup(p string) (Provenance, bool) {
+	x.once.Do(x.build)
+
+	i, ok := x.paths[path.Clean("/"+p)]
+	if !ok {
+		return Provenance{}, false
+	}
+
+	prov := Provenance{Path: p, Index: i}
+	if i < len(x.diffIDs) {
+		prov.Digest = x.diffIDs[i]
+	}
+	if i < len(x.createdBy) {
+		prov.CreatedBy = x.createdBy[i]
+	}
+	return prov, true
+}
+
+// Layers returns diff ids of all layers holding path, including those
+// whose file is hidden or removed by layers above, from bottom to top
+func (x *Index) Layers(p string) []string {
+	x.once.Do(x.build)
+
+	layers := []string{}
+	for _, i := range x.layers[path.Clean("/"+p)] {
+		if i < len(x.diffIDs) {
+			layers = append(layers, x.diffIDs[i])
+		}
+	}
+	return layers
+}
+
+// Locator returns locator backed by index
+func (x *Index) Locator() Locator {
+	return func(p string) (Layer, bool) {
+		prov, ok := x.Lookup(p)
+		if !ok {
+			return Layer{}, false
+		}
+		return Layer{Path: p, Index: prov.Index, ID: prov.Digest}, true
+	}
+}
+
+// Instruction trims the shell wrapper docker records for instructions
+// of legacy builder, RUN is recorded as the bare command and others are
+// marked with nop
+func Instruction(createdBy string) string {
+	s := strings.TrimSpace(createdBy)
+	if strings.HasPrefix(s, "|") {
+		// Build arguments of RUN are recorded as "|<n> ARG=value ... /bin/sh -c"
+		if i := strings.Index(s, shellPrefix); i >= 0 {
+			s = s[i:]
+		}
+	}
+	if !strings.HasPrefix(s, shellPrefix) {
+		return s
+	}
+
+	s = strings.TrimSpace(strings.TrimPrefix(s, shellPrefix))
+	if strings.HasPrefix(s, nopPrefix) {
+		return strings.TrimSpace(strings.TrimPrefix(s, nopPrefix))
+	}
+	return "RUN " + s
+}
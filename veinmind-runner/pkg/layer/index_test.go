@@ -0,0 +1,60 @@
+package layer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	x := &Index{
+		paths:     map[string]int{},
+		layers:    map[string][]int{},
+		diffIDs:   []string{"sha256:l0", "sha256:l1", "sha256:l2"},
+		createdBy: []string{"ADD file:abc in /", "RUN apt-get install -y curl", "COPY app /app"},
+	}
+	x.once.Do(func() {})
+
+	x.add(0, "/etc/passwd")
+	x.add(0, "/etc/shadow")
+	x.add(0, "/usr/bin/curl")
+	x.add(0, "/app/old")
+	x.add(1, "/usr/bin/curl")
+	x.add(1, "/etc/.wh.shadow")
+	x.add(2, "/app/.wh..wh..opq")
+	x.add(2, "/app/main")
+
+	prov, ok := x.Lookup("/usr/bin/curl")
+	assert.True(t, ok)
+	assert.Equal(t, Provenance{Path: "/usr/bin/curl", Index: 1, Digest: "sha256:l1", CreatedBy: "RUN apt-get install -y curl"}, prov)
+
+	prov, ok = x.Lookup("etc/passwd")
+	assert.True(t, ok)
+	assert.Equal(t, 0, prov.Index)
+
+	_, ok = x.Lookup("/etc/shadow")
+	assert.False(t, ok)
+	_, ok = x.Lookup("/app/old")
+	assert.False(t, ok)
+
+	l, ok := x.Locator()("/app/main")
+	assert.True(t, ok)
+	assert.Equal(t, Layer{Path: "/app/main", Index: 2, ID: "sha256:l2"}, l)
+
+	// Layers holding files hidden or removed above are kept
+	assert.Equal(t, []string{"sha256:l0", "sha256:l1"}, x.Layers("usr/bin/curl"))
+	assert.Equal(t, []string{"sha256:l0"}, x.Layers("/etc/shadow"))
+	assert.Equal(t, []string{"sha256:l0"}, x.Layers("/app/old"))
+	assert.Equal(t, []string{}, x.Layers("/missing"))
+}
+
+func TestInstruction(t *testing.T) {
+	for createdBy, expected := range map[string]string{
+		`/bin/sh -c #(nop)  CMD ["nginx" "-g" "daemon off;"]`: `CMD ["nginx" "-g" "daemon off;"]`,
+		"/bin/sh -c apt-get update":                           "RUN apt-get update",
+		"|1 VERSION=1.2 /bin/sh -c make install":              "RUN make install",
+		"RUN /bin/sh -c go build ./... # buildkit":            "RUN /bin/sh -c go build ./... # buildkit",
+		"COPY app /app # buildkit":                            "COPY app /app # buildkit",
+	} {
+		assert.Equal(t, expected, Instruction(createdBy))
+	}
+}
@@ -0,0 +1,62 @@
+// Package layer locates files of findings in image layers
+package layer
+
+import (
+	api "github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/docker"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+)
+
+type Layer struct {
+	Path  string `json:"path"`
+	Index int    `json:"index"`
+	ID    string `json:"id"`
+}
+
+// Locator finds the topmost layer which contains path
+type Locator func(path string) (Layer, bool)
+
+// NewLocator locates paths in layers of image, the topmost layer
+// containing the path is the one which added or modified it last.
+// Nil is returned when layers of image can't be opened
+func NewLocator(image api.Image) Locator {
+	dockerImage, ok := image.(*docker.Image)
+	if !ok {
+		return nil
+	}
+
+	return func(path string) (Layer, bool) {
+		for i := dockerImage.NumLayers() - 1; i >= 0; i-- {
+			l, err := dockerImage.OpenLayer(i)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+
+			if _, err := l.Lstat(path); err == nil {
+				return Layer{Path: path, Index: i, ID: l.ID()}, true
+			}
+		}
+
+		return Layer{}, false
+	}
+}
+
+// DiffIDs returns diff ids of layers of image from bottom to top
+func DiffIDs(image api.Image) ([]string, error) {
+	dockerImage, ok := image.(*docker.Image)
+	if !ok {
+		return nil, nil
+	}
+
+	ids := []string{}
+	for i := 0; i < dockerImage.NumLayers(); i++ {
+		id, err := dockerImage.GetLayerDiffID(i)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
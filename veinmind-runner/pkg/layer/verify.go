@@ -0,0 +1,109 @@
+package layer
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	api "github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/docker"
+	"github.com/pkg/errors"
+	"github.com/vbatts/tar-split/tar/asm"
+	"github.com/vbatts/tar-split/tar/storage"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CorruptedError reports a layer whose content doesn't match its diff id
+type CorruptedError struct {
+	Index  int
+	DiffID string
+	Err    error
+}
+
+func (e *CorruptedError) Error() string {
+	return fmt.Sprintf("layer %d (%s) is corrupted: %s", e.Index, e.DiffID, e.Err.Error())
+}
+
+func (e *CorruptedError) Unwrap() error {
+	return e.Err
+}
+
+// Verify reassembles tar stream of every layer of docker image from
+// tar-split metadata under dataRoot, and compares its digest with the
+// diff id of the layer. Images of other runtimes aren't verified
+func Verify(image api.Image, dataRoot string) error {
+	dockerImage, ok := image.(*docker.Image)
+	if !ok {
+		return nil
+	}
+
+	diffIDs, err := DiffIDs(image)
+	if err != nil {
+		return err
+	}
+
+	chainID := ""
+	for i, diffID := range diffIDs {
+		if i == 0 {
+			chainID = diffID
+		} else {
+			sum := sha256.Sum256([]byte(chainID + " " + diffID))
+			chainID = "sha256:" + hex.EncodeToString(sum[:])
+		}
+
+		if err := verifyLayer(dockerImage, i, diffID, chainID, dataRoot); err != nil {
+			return &CorruptedError{Index: i, DiffID: diffID, Err: err}
+		}
+	}
+	return nil
+}
+
+func verifyLayer(image *docker.Image, index int, diffID string, chainID string, dataRoot string) error {
+	matches, _ := filepath.Glob(filepath.Join(dataRoot, "image", "*", "layerdb", "sha256",
+		strings.TrimPrefix(chainID, "sha256:"), "tar-split.json.gz"))
+	if len(matches) == 0 {
+		return errors.New("tar-split metadata not found")
+	}
+
+	f, err := os.Open(matches[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.Wrap(err, "read tar-split metadata")
+	}
+	defer gz.Close()
+
+	l, err := image.OpenLayer(index)
+	if err != nil {
+		return err
+	}
+
+	stream := asm.NewOutputTarStream(fileGetter{l}, storage.NewJSONUnpacker(gz))
+	defer stream.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, stream); err != nil {
+		return errors.Wrap(err, "reassemble layer")
+	}
+
+	if digest := "sha256:" + hex.EncodeToString(h.Sum(nil)); digest != diffID {
+		return errors.Errorf("digest %s doesn't match", digest)
+	}
+	return nil
+}
+
+// fileGetter reads file content of tar entries from layer
+type fileGetter struct {
+	fs api.FileSystem
+}
+
+func (g fileGetter) Get(name string) (io.ReadCloser, error) {
+	return g.fs.Open("/" + strings.TrimPrefix(name, "/"))
+}
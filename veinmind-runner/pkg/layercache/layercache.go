@@ -0,0 +1,283 @@
+// Package layercache caches events of layer-local plugins by plugin,
+// version of plugin and diff id of layer, so that layers shared by
+// images are scanned once by each plugin. Events of an image are
+// assembled from cached layers and fresh scans of the rest.
+//
+// Only plugins declaring Tag are cached, they promise that events of
+// an image are the union of events of its layers scanned alone, e.g.
+// files matched by content. Plugins inspecting state across layers,
+// e.g. the merged filesystem or config of image, must not declare it
+package layercache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/prune"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tag is declared in tags of manifest by layer-local plugins
+const Tag = "layer-local"
+
+// LayerLocal reports whether plugin of tags declares Tag
+func LayerLocal(tags []string) bool {
+	for _, tag := range tags {
+		if tag == Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is event reported by plugin with level as it's reported, so
+// that cached events are normalized by rules of the scan replaying them
+type Event struct {
+	Event report.ReportEvent `json:"event"`
+	Level string             `json:"level"`
+}
+
+// Key identifies events of a layer scanned by a version of plugin
+type Key struct {
+	Plugin  string `json:"plugin"`
+	Version string `json:"version"`
+	Layer   string `json:"layer"`
+}
+
+// entry is file of cached layer
+type entry struct {
+	Key
+	Events []Event `json:"events"`
+}
+
+// Stats of layer cache, Hits and Misses are lookups of layers, Avoided
+// are layer scans spared by events assembled from cache and Uncacheable
+// are plugin executions whose events can't be attributed to layers
+type Stats struct {
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`
+	Avoided     int64 `json:"avoided"`
+	Uncacheable int64 `json:"uncacheable"`
+}
+
+type Cache struct {
+	dir   string
+	mu    sync.Mutex
+	items map[Key][]Event
+	stats Stats
+}
+
+// Open opens cache persisted in dir, cache is kept in memory for the
+// run only if dir is empty
+func Open(dir string) (*Cache, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Cache{dir: dir, items: map[Key][]Event{}}, nil
+}
+
+func (c *Cache) path(key Key) string {
+	h := sha256.New()
+	h.Write([]byte(key.Plugin))
+	h.Write([]byte{0})
+	h.Write([]byte(key.Version))
+	h.Write([]byte{0})
+	h.Write([]byte(key.Layer))
+	return filepath.Join(c.dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// get returns events of key, entries of dir are loaded on first use
+// and touched so that entries in use aren't pruned. Entries which can't
+// be read are misses
+func (c *Cache) get(key Key) ([]Event, bool) {
+	if events, ok := c.items[key]; ok {
+		return events, true
+	}
+	if c.dir == "" {
+		return nil, false
+	}
+
+	b, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	e := entry{}
+	if err := json.Unmarshal(b, &e); err != nil || e.Key != key {
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(c.path(key), now, now)
+	c.items[key] = e.Events
+	return e.Events, true
+}
+
+// Plan is how an image is scanned by a plugin, Cached are events of
+// layers scanned before and Scan are layers left to scan, in order of
+// layers of image
+type Plan struct {
+	Layers []string
+	Cached map[string][]Event
+	Scan   []string
+}
+
+// Plan looks up layers of image scanned by version of plugin before
+func (c *Cache) Plan(plugin string, version string, layers []string) Plan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := Plan{Layers: layers, Cached: map[string][]Event{}, Scan: []string{}}
+	for _, l := range layers {
+		if _, ok := p.Cached[l]; ok {
+			continue
+		}
+		if events, ok := c.get(Key{Plugin: plugin, Version: version, Layer: l}); ok {
+			p.Cached[l] = events
+			c.stats.Hits++
+			continue
+		}
+		if !contains(p.Scan, l) {
+			p.Scan = append(p.Scan, l)
+			c.stats.Misses++
+		}
+	}
+	return p
+}
+
+// Store caches events of layers scanned by version of plugin, layers
+// without events are cached as well
+func (c *Cache) Store(plugin string, version string, results map[string][]Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for l, events := range results {
+		key := Key{Plugin: plugin, Version: version, Layer: l}
+		if events == nil {
+			events = []Event{}
+		}
+		c.items[key] = events
+		if c.dir == "" {
+			continue
+		}
+		if err := c.write(entry{Key: key, Events: events}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes entry into a temporary file which is renamed into place,
+// so that runs sharing dir never read partial entries
+func (c *Cache) write(e entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.path(e.Key))
+}
+
+// Avoided counts layer scans spared by events assembled from cache
+func (c *Cache) Avoided(layers int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Avoided += int64(layers)
+}
+
+// Uncacheable counts a plugin execution whose events aren't cached
+func (c *Cache) Uncacheable() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Uncacheable++
+}
+
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Locator returns diff ids of layers holding files of event, including
+// files hidden by layers above
+type Locator func(evt report.ReportEvent) []string
+
+// Attribute attributes events of a plugin execution to layers scanned,
+// each event must be of files held by exactly one of them. Events of
+// files of no layer or of more than one layer fail attribution, since
+// which layer they're found in can't be told
+func Attribute(events []Event, scanned []string, locate Locator) (map[string][]Event, error) {
+	results := map[string][]Event{}
+	for _, l := range scanned {
+		results[l] = []Event{}
+	}
+
+	for _, e := range events {
+		owners := []string{}
+		for _, l := range locate(e.Event) {
+			if _, ok := results[l]; ok && !contains(owners, l) {
+				owners = append(owners, l)
+			}
+		}
+		if len(owners) != 1 {
+			return nil, errors.Errorf("event of image %s is of %d layer(s) scanned, expect 1", e.Event.ID, len(owners))
+		}
+		results[owners[0]] = append(results[owners[0]], e)
+	}
+	return results, nil
+}
+
+// Assemble returns cached events of layers in order of layers, events
+// are rebased on image and time of assembly
+func Assemble(imageID string, layers []string, cached map[string][]Event, now time.Time) []Event {
+	events := []Event{}
+	seen := map[string]struct{}{}
+	for _, l := range layers {
+		if _, ok := seen[l]; ok {
+			continue
+		}
+		seen[l] = struct{}{}
+		for _, e := range cached[l] {
+			e.Event.ID = imageID
+			e.Event.Time = now
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Expired lists entries of cache in dir not used since before, along
+// with temporary files of writes interrupted
+func Expired(dir string, before time.Time) ([]prune.Item, error) {
+	return prune.Entries(prune.KindLayerCache, dir, before, func(info os.FileInfo) bool {
+		return info.Mode().IsRegular() && (strings.HasSuffix(info.Name(), ".json") || strings.HasPrefix(info.Name(), ".tmp-"))
+	})
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package layercache
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// event returns event of malicious file at path found in image
+func event(image string, path string) Event {
+	return Event{
+		Event: report.ReportEvent{
+			ID:        image,
+			Time:      time.Unix(1, 0).UTC(),
+			Level:     report.High,
+			EventType: report.Invasion,
+			AlertType: report.MaliciousFile,
+			AlertDetails: []report.AlertDetail{{
+				MaliciousFileDetail: &report.MaliciousFileDetail{
+					FileDetail: report.FileDetail{Path: path},
+				},
+			}},
+		},
+		Level: "high",
+	}
+}
+
+// locator locates events by path of malicious file in files of layers
+func locator(files map[string][]string) Locator {
+	return func(evt report.ReportEvent) []string {
+		layers := []string{}
+		for _, d := range evt.AlertDetails {
+			if d.MaliciousFileDetail == nil {
+				continue
+			}
+			layers = append(layers, files[d.MaliciousFileDetail.Path]...)
+		}
+		return layers
+	}
+}
+
+func TestLayerLocal(t *testing.T) {
+	assert.True(t, LayerLocal([]string{"soft-fail", Tag}))
+	assert.False(t, LayerLocal([]string{"pool"}))
+	assert.False(t, LayerLocal(nil))
+}
+
+func TestPlan(t *testing.T) {
+	c, err := Open("")
+	require.NoError(t, err)
+
+	p := c.Plan("malicious", "1.0", []string{"a", "b", "a"})
+	assert.Empty(t, p.Cached)
+	assert.Equal(t, []string{"a", "b"}, p.Scan)
+	require.NoError(t, c.Store("malicious", "1.0", map[string][]Event{"a": {event("image", "/bin/x")}, "b": nil}))
+
+	// Layers of image scanned are cached, even those without events
+	p = c.Plan("malicious", "1.0", []string{"a", "b", "c"})
+	assert.Equal(t, map[string][]Event{"a": {event("image", "/bin/x")}, "b": {}}, p.Cached)
+	assert.Equal(t, []string{"c"}, p.Scan)
+
+	// Another version or plugin scans layers again
+	assert.Equal(t, []string{"a", "b"}, c.Plan("malicious", "1.1", []string{"a", "b"}).Scan)
+	assert.Equal(t, []string{"a"}, c.Plan("sensitive", "1.0", []string{"a"}).Scan)
+	assert.Equal(t, Stats{Hits: 2, Misses: 6}, c.Stats())
+}
+
+func TestPersist(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	c, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, c.Store("malicious", "1.0", map[string][]Event{"a": {event("image", "/bin/x")}, "b": nil}))
+
+	// Cache of another run reads entries of dir
+	reopened, err := Open(dir)
+	require.NoError(t, err)
+	p := reopened.Plan("malicious", "1.0", []string{"a", "b"})
+	assert.Equal(t, []string{}, p.Scan)
+	assert.Equal(t, []Event{event("image", "/bin/x")}, p.Cached["a"])
+	assert.Equal(t, []Event{}, p.Cached["b"])
+	assert.Equal(t, Stats{Hits: 2}, reopened.Stats())
+
+	// Corrupt entries are misses
+	require.NoError(t, ioutil.WriteFile(reopened.path(Key{Plugin: "malicious", Version: "1.0", Layer: "c"}), []byte("{"), 0644))
+	reopened, err = Open(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, reopened.Plan("malicious", "1.0", []string{"a", "c"}).Scan)
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
+
+func TestOpenError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, ioutil.WriteFile(file, nil, 0644))
+	_, err := Open(file)
+	assert.Error(t, err)
+	_, err = os.Stat(file)
+	assert.NoError(t, err)
+}
+
+func TestAttribute(t *testing.T) {
+	files := map[string][]string{
+		"/bin/x":      {"a"},
+		"/bin/y":      {"b"},
+		"/etc/shadow": {"a", "b"},
+		"/opt/z":      {"c", "a"},
+	}
+	locate := locator(files)
+
+	results, err := Attribute([]Event{event("image", "/bin/x"), event("image", "/bin/y")}, []string{"a", "b", "d"}, locate)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]Event{
+		"a": {event("image", "/bin/x")},
+		"b": {event("image", "/bin/y")},
+		"d": {},
+	}, results)
+
+	// Files of layers not scanned don't count
+	results, err = Attribute([]Event{event("image", "/opt/z")}, []string{"a"}, locate)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]Event{"a": {event("image", "/opt/z")}}, results)
+
+	// Files of several layers scanned, of no layer or events without
+	// files can't be attributed
+	for _, e := range []Event{event("image", "/etc/shadow"), event("image", "/unknown"), {Event: report.ReportEvent{ID: "image"}}} {
+		_, err = Attribute([]Event{event("image", "/bin/x"), e}, []string{"a", "b"}, locate)
+		assert.Error(t, err)
+	}
+
+	results, err = Attribute(nil, []string{"a"}, locate)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]Event{"a": {}}, results)
+}
+
+func TestAssemble(t *testing.T) {
+	now := time.Unix(2, 0).UTC()
+	cached := map[string][]Event{
+		"a": {event("base", "/bin/x"), event("base", "/bin/w")},
+		"b": {},
+		"c": {event("other", "/bin/y")},
+	}
+
+	events := Assemble("image", []string{"c", "b", "a", "c", "d"}, cached, now)
+	expect := []Event{event("image", "/bin/y"), event("image", "/bin/x"), event("image", "/bin/w")}
+	for i := range expect {
+		expect[i].Event.Time = now
+	}
+	assert.Equal(t, expect, events)
+
+	// Cached events are left as they are
+	assert.Equal(t, "base", cached["a"][0].Event.ID)
+	assert.Equal(t, []Event{}, Assemble("image", []string{"b", "d"}, cached, now))
+}
+
+// TestCycle scans an image, then an image built on it and checks
+// events assembled from cache and fresh scan equal those of full scan
+func TestCycle(t *testing.T) {
+	c, err := Open(t.TempDir())
+	require.NoError(t, err)
+	files := map[string][]string{"/bin/x": {"a"}, "/bin/y": {"c"}}
+	locate := locator(files)
+	scan := func(image string, layers []string) []Event {
+		events := []Event{}
+		for _, path := range []string{"/bin/x", "/bin/y"} {
+			for _, l := range files[path] {
+				if contains(layers, l) {
+					events = append(events, event(image, path))
+				}
+			}
+		}
+		return events
+	}
+
+	p := c.Plan("malicious", "1.0", []string{"a", "b"})
+	results, err := Attribute(scan("base", p.Scan), p.Scan, locate)
+	require.NoError(t, err)
+	require.NoError(t, c.Store("malicious", "1.0", results))
+
+	now := time.Unix(1, 0).UTC()
+	p = c.Plan("malicious", "1.0", []string{"a", "b", "c"})
+	assert.Equal(t, []string{"c"}, p.Scan)
+	events := append(Assemble("app", p.Layers, p.Cached, now), scan("app", p.Scan)...)
+	c.Avoided(len(p.Cached))
+	c.Uncacheable()
+	assert.ElementsMatch(t, scan("app", []string{"a", "b", "c"}), events)
+	assert.Equal(t, Stats{Hits: 2, Misses: 3, Avoided: 2, Uncacheable: 1}, c.Stats())
+}
+
+func TestExpired(t *testing.T) {
+	dir := t.TempDir()
+	c, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, c.Store("malicious", "1.0", map[string][]Event{"a": nil, "b": nil}))
+	past := time.Now().Add(-48 * time.Hour)
+	for _, l := range []string{"a", "b"} {
+		require.NoError(t, os.Chtimes(c.path(Key{Plugin: "malicious", Version: "1.0", Layer: l}), past, past))
+	}
+
+	// Entries loaded are in use
+	reopened, err := Open(dir)
+	require.NoError(t, err)
+	assert.Empty(t, reopened.Plan("malicious", "1.0", []string{"b"}).Scan)
+
+	items, err := Expired(dir, time.Now().Add(-24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, c.path(Key{Plugin: "malicious", Version: "1.0", Layer: "a"}), items[0].Path)
+}
@@ -0,0 +1,182 @@
+// Package ledger records images pulled by runner as JSON lines, so that
+// images kept after scans can be pruned later without touching those
+// runner didn't pull
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Image is an image pulled by runner into a runtime, Ref is what it's
+// pulled as
+type Image struct {
+	Runtime string    `json:"runtime"`
+	ID      string    `json:"id"`
+	Ref     string    `json:"ref"`
+	Time    time.Time `json:"time"`
+}
+
+// record is a line of ledger, images removed are recorded as well so
+// that appending never rewrites the file
+type record struct {
+	Image
+	Removed bool `json:"removed,omitempty"`
+}
+
+// DefaultPath is where ledger is kept by default, under cache directory
+// of user
+func DefaultPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "veinmind-runner", "pulled.jsonl")
+}
+
+type Ledger struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Open opens ledger at path, which is created on the first record
+func Open(path string) *Ledger {
+	return &Ledger{path: path}
+}
+
+// Pulled records image pulled
+func (l *Ledger) Pulled(img Image) error {
+	return l.append(record{Image: img})
+}
+
+// Removed records image of runtime removed
+func (l *Ledger) Removed(runtime string, id string) error {
+	return l.append(record{Image: Image{Runtime: runtime, ID: id, Time: time.Now()}, Removed: true})
+}
+
+func (l *Ledger) append(r record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return errors.Wrap(err, "create ledger dir")
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "open ledger")
+	}
+	defer f.Close()
+
+	// Terminate torn line so that it doesn't corrupt the record
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if r, err := os.Open(l.path); err == nil {
+			_, err = r.ReadAt(last, info.Size()-1)
+			r.Close()
+			if err == nil && last[0] != '\n' {
+				b = append([]byte{'\n'}, b...)
+			}
+		}
+	}
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Images returns images pulled and not removed since, the oldest first.
+// Image pulled again is dated by the latest pull, malformed lines are
+// skipped
+func (l *Ledger) Images() ([]Image, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.images()
+}
+
+func (l *Ledger) images() ([]Image, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Image{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	type key struct{ runtime, id string }
+	kept := map[key]Image{}
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		r := record{}
+		if len(line) > 0 && json.Unmarshal(line, &r) == nil && r.ID != "" {
+			k := key{r.Runtime, r.ID}
+			if r.Removed {
+				delete(kept, k)
+			} else {
+				kept[k] = r.Image
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	images := []Image{}
+	for _, img := range kept {
+		images = append(images, img)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		if !images[i].Time.Equal(images[j].Time) {
+			return images[i].Time.Before(images[j].Time)
+		}
+		return images[i].ID < images[j].ID
+	})
+	return images, nil
+}
+
+// Compact rewrites ledger with only images not removed
+func (l *Ledger) Compact() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	images, err := l.images()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(l.path); os.IsNotExist(err) {
+		return nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(l.path), ".tmp-ledger-")
+	if err != nil {
+		return errors.Wrap(err, "compact ledger")
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	for _, img := range images {
+		b, err := json.Marshal(record{Image: img})
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(append(b, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "compact ledger")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "compact ledger")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), l.path), "compact ledger")
+}
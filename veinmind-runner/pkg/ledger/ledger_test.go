@@ -0,0 +1,67 @@
+package ledger
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLedger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "pulled.jsonl")
+	l := Open(path)
+
+	images, err := l.Images()
+	require.NoError(t, err)
+	assert.Empty(t, images)
+
+	now := time.Unix(1700000000, 0).UTC()
+	a := Image{Runtime: "docker", ID: "sha256:aa", Ref: "nginx:latest", Time: now}
+	b := Image{Runtime: "containerd", ID: "sha256:bb", Ref: "redis:7", Time: now.Add(time.Hour)}
+	c := Image{Runtime: "docker", ID: "sha256:cc", Ref: "alpine:3", Time: now.Add(2 * time.Hour)}
+	for _, img := range []Image{b, a, c} {
+		require.NoError(t, l.Pulled(img))
+	}
+	require.NoError(t, l.Removed("docker", "sha256:cc"))
+	// Same id of another runtime isn't removed
+	require.NoError(t, l.Removed("containerd", "sha256:aa"))
+
+	// Torn line of interrupted process is skipped
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"runtime":"docker","id":`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	images, err = l.Images()
+	require.NoError(t, err)
+	assert.Equal(t, []Image{a, b}, images)
+
+	// Image pulled again is dated by the latest pull
+	require.NoError(t, l.Pulled(c))
+	a.Time = now.Add(3 * time.Hour)
+	require.NoError(t, l.Pulled(a))
+	images, err = l.Images()
+	require.NoError(t, err)
+	assert.Equal(t, []Image{b, c, a}, images)
+
+	require.NoError(t, l.Removed("docker", "sha256:cc"))
+	require.NoError(t, l.Compact())
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(content), "\n"))
+	images, err = Open(path).Images()
+	require.NoError(t, err)
+	assert.Equal(t, []Image{b, a}, images)
+}
+
+func TestCompactMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pulled.jsonl")
+	require.NoError(t, Open(path).Compact())
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,109 @@
+package listing
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Image struct {
+	Runtime   string    `json:"runtime"`
+	Namespace string    `json:"namespace,omitempty"`
+	ID        string    `json:"id"`
+	Refs      []string  `json:"refs"`
+	Size      int64     `json:"size"`
+	Created   time.Time `json:"created"`
+}
+
+// Images are sorted by runtime and id, refs are never null
+type Images []Image
+
+func NewImages(images []Image) Images {
+	items := make(Images, 0, len(images))
+	for _, i := range images {
+		i.Refs = append([]string{}, i.Refs...)
+		sort.Strings(i.Refs)
+		items = append(items, i)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Runtime != items[j].Runtime {
+			return items[i].Runtime < items[j].Runtime
+		}
+		return items[i].ID < items[j].ID
+	})
+	return items
+}
+
+func (is Images) Header() []string {
+	return []string{"RUNTIME", "ID", "REFS", "SIZE", "CREATED"}
+}
+
+func (is Images) Rows() [][]string {
+	rows := [][]string{}
+	for _, i := range is {
+		rows = append(rows, []string{
+			runtimeColumn(i.Runtime, i.Namespace), i.ID, strings.Join(i.Refs, ","),
+			HumanSize(i.Size), i.Created.UTC().Format(time.RFC3339),
+		})
+	}
+	return rows
+}
+
+type Container struct {
+	Runtime   string `json:"runtime"`
+	Namespace string `json:"namespace,omitempty"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Image     string `json:"image"`
+	State     string `json:"state"`
+}
+
+// Containers are sorted by runtime and id
+type Containers []Container
+
+func NewContainers(containers []Container) Containers {
+	items := append(Containers{}, containers...)
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Runtime != items[j].Runtime {
+			return items[i].Runtime < items[j].Runtime
+		}
+		return items[i].ID < items[j].ID
+	})
+	return items
+}
+
+func (cs Containers) Header() []string {
+	return []string{"RUNTIME", "ID", "NAME", "IMAGE", "STATE"}
+}
+
+func (cs Containers) Rows() [][]string {
+	rows := [][]string{}
+	for _, c := range cs {
+		rows = append(rows, []string{runtimeColumn(c.Runtime, c.Namespace), c.ID, c.Name, c.Image, c.State})
+	}
+	return rows
+}
+
+func runtimeColumn(runtime string, namespace string) string {
+	if namespace == "" {
+		return runtime
+	}
+	return runtime + "/" + namespace
+}
+
+// HumanSize formats size in bytes with decimal units
+func HumanSize(size int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	f := float64(size)
+	i := 0
+	for f >= 1000 && i < len(units)-1 {
+		f /= 1000
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatInt(size, 10) + units[0]
+	}
+	return strconv.FormatFloat(f, 'f', 1, 64) + units[i]
+}
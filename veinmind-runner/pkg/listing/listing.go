@@ -0,0 +1,46 @@
+// Package listing renders output of list subcommands, the JSON shape
+// of listed items is stable so that outputs of hosts can be diffed
+package listing
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+)
+
+// Table is a list of items which can be rendered as table, it's
+// rendered as JSON by marshaling itself
+type Table interface {
+	Header() []string
+	Rows() [][]string
+}
+
+// Write renders items in format, JSON is an indented array
+func Write(w io.Writer, format string, items Table) error {
+	switch format {
+	case FormatJSON:
+		b, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	case FormatTable, "":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(items.Header(), "\t"))
+		for _, row := range items.Rows() {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	default:
+		return errors.Errorf("unknown format: %#v", format)
+	}
+}
@@ -0,0 +1,94 @@
+package listing
+
+import (
+	"bytes"
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func golden(t *testing.T, name string, items Table, format string) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, Write(buf, format, items))
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		assert.NoError(t, ioutil.WriteFile(path, buf.Bytes(), 0644))
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), buf.String())
+}
+
+func testPlugins() Plugins {
+	return NewPlugins([]Plugin{
+		{
+			Name:        "veinmind-weakpass",
+			Version:     "1.0.0",
+			Path:        "plugins/veinmind-weakpass",
+			Author:      "veinmind-team",
+			Tags:        []string{"weakpass", "ssh"},
+			Description: "veinmind-weakpass scan image weakpass",
+			APIVersion:  1,
+			Compat:      "compatible",
+		},
+		{
+			Name:        "veinmind-basic",
+			Path:        "plugins/veinmind-basic",
+			Author:      "veinmind-team",
+			Description: "veinmind-basic scan image basic info",
+			Compat:      "too-old",
+		},
+	})
+}
+
+func TestPluginsGolden(t *testing.T) {
+	golden(t, "plugins.json", testPlugins(), FormatJSON)
+	golden(t, "plugins.table", testPlugins(), FormatTable)
+	golden(t, "plugins-empty.json", NewPlugins(nil), FormatJSON)
+}
+
+func TestImagesGolden(t *testing.T) {
+	created := time.Date(2022, 5, 26, 2, 36, 45, 0, time.UTC)
+	images := NewImages([]Image{
+		{
+			Runtime:   "containerd",
+			Namespace: "k8s.io",
+			ID:        "k8s.io/sha256:bb",
+			Refs:      []string{"docker.io/library/nginx:latest", "docker.io/library/nginx:1.21"},
+			Size:      56700000,
+			Created:   created,
+		},
+		{
+			Runtime: "docker",
+			ID:      "sha256:aa",
+			Size:    512,
+			Created: created,
+		},
+	})
+	golden(t, "images.json", images, FormatJSON)
+	golden(t, "images.table", images, FormatTable)
+
+	containers := NewContainers([]Container{
+		{Runtime: "docker", ID: "cc", Name: "web", Image: "nginx:latest", State: "running"},
+		{Runtime: "containerd", Namespace: "default", ID: "dd", Image: "docker.io/library/redis:6", State: "stopped"},
+	})
+	golden(t, "containers.json", containers, FormatJSON)
+	golden(t, "containers.table", containers, FormatTable)
+}
+
+func TestHumanSize(t *testing.T) {
+	assert.Equal(t, "999B", HumanSize(999))
+	assert.Equal(t, "1.0kB", HumanSize(1000))
+	assert.Equal(t, "56.7MB", HumanSize(56700000))
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	assert.Error(t, Write(&bytes.Buffer{}, "yaml", testPlugins()))
+}
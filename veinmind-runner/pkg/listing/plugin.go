@@ -0,0 +1,51 @@
+package listing
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Plugin struct {
+	Name        string   `json:"name"`
+	Version     string   `json:"version"`
+	Path        string   `json:"path"`
+	Author      string   `json:"author"`
+	Tags        []string `json:"tags"`
+	Description string   `json:"description"`
+	APIVersion  int      `json:"api_version"`
+	Compat      string   `json:"compat"`
+}
+
+// Plugins are sorted by name and path, tags are never null
+type Plugins []Plugin
+
+func NewPlugins(ps []Plugin) Plugins {
+	items := make(Plugins, 0, len(ps))
+	for _, p := range ps {
+		if p.Tags == nil {
+			p.Tags = []string{}
+		}
+		items = append(items, p)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Name != items[j].Name {
+			return items[i].Name < items[j].Name
+		}
+		return items[i].Path < items[j].Path
+	})
+	return items
+}
+
+func (ps Plugins) Header() []string {
+	return []string{"NAME", "VERSION", "AUTHOR", "TAGS", "API", "COMPAT", "PATH", "DESCRIPTION"}
+}
+
+func (ps Plugins) Rows() [][]string {
+	rows := [][]string{}
+	for _, p := range ps {
+		rows = append(rows, []string{p.Name, p.Version, p.Author, strings.Join(p.Tags, ","), strconv.Itoa(p.APIVersion), p.Compat, p.Path, p.Description})
+	}
+	return rows
+}
@@ -0,0 +1,127 @@
+package manifest
+
+import (
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Interpolate substitutes variables of s the way docker-compose does,
+// $NAME and ${NAME} with default (:- and -), required (:? and ?) and
+// alternative (:+ and +) forms are supported, $$ escapes a dollar sign,
+// unset variables without default are substituted with empty string
+func Interpolate(s string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		switch next := s[i+1]; {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+		case next == '{':
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				return "", errors.Errorf("unterminated variable in %#v", s)
+			}
+			v, err := expand(s[i+2:end], lookup)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+			i = end
+		case isNameStart(next):
+			j := i + 1
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			v, _ := lookup(s[i+1 : j])
+			b.WriteString(v)
+			i = j - 1
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
+
+// expand expands expression of braced variable
+func expand(expr string, lookup func(string) (string, bool)) (string, error) {
+	j := 0
+	for j < len(expr) && isNameChar(expr[j]) {
+		j++
+	}
+	name, op := expr[:j], expr[j:]
+	if name == "" || !isNameStart(name[0]) {
+		return "", errors.Errorf("invalid variable name in ${%s}", expr)
+	}
+
+	value, set := lookup(name)
+	if op == "" {
+		return value, nil
+	}
+
+	// Operators with colon also treat empty values as unset
+	nonEmpty := set
+	if strings.HasPrefix(op, ":") {
+		nonEmpty = set && value != ""
+		op = op[1:]
+	}
+	if op == "" {
+		return "", errors.Errorf("invalid variable expression ${%s}", expr)
+	}
+
+	word, err := Interpolate(op[1:], lookup)
+	if err != nil {
+		return "", err
+	}
+	switch op[0] {
+	case '-':
+		if !nonEmpty {
+			return word, nil
+		}
+		return value, nil
+	case '?':
+		if !nonEmpty {
+			if word == "" {
+				word = "required variable is missing a value"
+			}
+			return "", errors.Errorf("%s: %s", name, word)
+		}
+		return value, nil
+	case '+':
+		if nonEmpty {
+			return word, nil
+		}
+		return "", nil
+	}
+	return "", errors.Errorf("invalid variable expression ${%s}", expr)
+}
+
+// closingBrace returns index of brace closing the one opened before
+// start, nested braces are skipped
+func closingBrace(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
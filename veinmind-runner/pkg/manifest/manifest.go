@@ -0,0 +1,207 @@
+// Package manifest extracts image references from docker-compose files
+// and kubernetes manifests, so that images a deployment would run can
+// be scanned before deploying
+package manifest
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"io"
+	"os"
+	"sort"
+)
+
+// Image is a unique image reference with where it's referenced
+type Image struct {
+	Ref     string   `json:"ref"`
+	Sources []string `json:"sources"`
+}
+
+// Skipped is an image which can't be scanned through registry, e.g.
+// compose services built from a build context
+type Skipped struct {
+	Ref    string `json:"ref,omitempty"`
+	Source string `json:"source"`
+	Reason string `json:"reason"`
+}
+
+// Extractor collects images of manifests parsed, Lookup resolves
+// variables of compose files, os.LookupEnv is used if it's nil
+type Extractor struct {
+	Lookup func(string) (string, bool)
+
+	images  []Image
+	index   map[string]int
+	skipped []Skipped
+}
+
+type document struct {
+	Services map[string]composeService `yaml:"services"`
+	Kind     string                    `yaml:"kind"`
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec  objectSpec `yaml:"spec"`
+	Items []document `yaml:"items"`
+}
+
+type composeService struct {
+	Image string      `yaml:"image"`
+	Build interface{} `yaml:"build"`
+}
+
+type container struct {
+	Name  string `yaml:"name"`
+	Image string `yaml:"image"`
+}
+
+type podSpec struct {
+	InitContainers      []container `yaml:"initContainers"`
+	Containers          []container `yaml:"containers"`
+	EphemeralContainers []container `yaml:"ephemeralContainers"`
+}
+
+type podTemplate struct {
+	Spec podSpec `yaml:"spec"`
+}
+
+// objectSpec is spec of pods, workloads with pod template and cronjobs
+type objectSpec struct {
+	podSpec     `yaml:",inline"`
+	Template    *podTemplate `yaml:"template"`
+	JobTemplate *struct {
+		Spec struct {
+			Template podTemplate `yaml:"template"`
+		} `yaml:"spec"`
+	} `yaml:"jobTemplate"`
+}
+
+// ParseFile parses manifest file, see Parse
+func (e *Extractor) ParseFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return e.Parse(path, f)
+}
+
+// Parse parses documents of manifest named name, documents which are
+// neither compose files nor known kubernetes objects are ignored
+func (e *Extractor) Parse(name string, r io.Reader) error {
+	decoder := yaml.NewDecoder(r)
+	for {
+		var doc document
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "parse %s", name)
+		}
+
+		if doc.Services != nil {
+			e.compose(name, doc.Services)
+		} else {
+			e.object(name, doc)
+		}
+	}
+}
+
+func (e *Extractor) compose(name string, services map[string]composeService) {
+	names := []string{}
+	for n := range services {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	lookup := e.Lookup
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+
+	for _, n := range names {
+		service := services[n]
+		source := fmt.Sprintf("%s: service %s", name, n)
+
+		ref, err := Interpolate(service.Image, lookup)
+		if err != nil {
+			e.skip(service.Image, source, err.Error())
+			continue
+		}
+
+		switch {
+		case service.Build != nil:
+			e.skip(ref, source, "built from build context")
+		case ref == "" && service.Image != "":
+			e.skip(service.Image, source, "image is empty after interpolation")
+		case ref == "":
+			e.skip("", source, "no image")
+		default:
+			e.add(ref, source)
+		}
+	}
+}
+
+func (e *Extractor) object(name string, doc document) {
+	var spec *podSpec
+	switch doc.Kind {
+	case "List":
+		for _, item := range doc.Items {
+			e.object(name, item)
+		}
+		return
+	case "Pod":
+		spec = &doc.Spec.podSpec
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job":
+		if doc.Spec.Template != nil {
+			spec = &doc.Spec.Template.Spec
+		}
+	case "CronJob":
+		if doc.Spec.JobTemplate != nil {
+			spec = &doc.Spec.JobTemplate.Spec.Template.Spec
+		}
+	}
+	if spec == nil {
+		return
+	}
+
+	containers := append(append(append([]container{}, spec.InitContainers...), spec.Containers...), spec.EphemeralContainers...)
+	for _, c := range containers {
+		source := fmt.Sprintf("%s: %s/%s container %s", name, doc.Kind, doc.Metadata.Name, c.Name)
+		if c.Image == "" {
+			e.skip("", source, "no image")
+			continue
+		}
+		e.add(c.Image, source)
+	}
+}
+
+func (e *Extractor) add(ref string, source string) {
+	if e.index == nil {
+		e.index = map[string]int{}
+	}
+
+	if i, ok := e.index[ref]; ok {
+		e.images[i].Sources = append(e.images[i].Sources, source)
+		return
+	}
+	e.index[ref] = len(e.images)
+	e.images = append(e.images, Image{Ref: ref, Sources: []string{source}})
+}
+
+func (e *Extractor) skip(ref string, source string, reason string) {
+	e.skipped = append(e.skipped, Skipped{Ref: ref, Source: source, Reason: reason})
+}
+
+// Images returns unique images in the order they're first referenced
+func (e *Extractor) Images() []Image {
+	return e.images
+}
+
+// Skipped returns images which can't be scanned with reasons
+func (e *Extractor) Skipped() []Skipped {
+	return e.skipped
+}
@@ -0,0 +1,83 @@
+package manifest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func lookupOf(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	lookup := lookupOf(map[string]string{
+		"TAG":   "1.0",
+		"EMPTY": "",
+	})
+
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "nginx:$TAG", want: "nginx:1.0"},
+		{in: "nginx:${TAG}-alpine", want: "nginx:1.0-alpine"},
+		{in: "nginx:${MISSING}", want: "nginx:"},
+		{in: "nginx:${MISSING:-latest}", want: "nginx:latest"},
+		{in: "nginx:${EMPTY:-latest}", want: "nginx:latest"},
+		{in: "nginx:${EMPTY-latest}", want: "nginx:"},
+		{in: "nginx:${MISSING:-${TAG}}", want: "nginx:1.0"},
+		{in: "nginx${TAG:+:}${TAG}", want: "nginx:1.0"},
+		{in: "cost$$", want: "cost$"},
+		{in: "nginx:${MISSING:?tag is required}", err: true},
+		{in: "nginx:${TAG", err: true},
+		{in: "nginx:${1TAG}", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Interpolate(tt.in, lookup)
+		if tt.err {
+			assert.NotNil(t, err, tt.in)
+			continue
+		}
+		assert.Nil(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+}
+
+func TestExtractor(t *testing.T) {
+	e := &Extractor{Lookup: lookupOf(map[string]string{"NGINX_TAG": "1.23"})}
+	assert.Nil(t, e.ParseFile("testdata/docker-compose.yml"))
+	assert.Nil(t, e.ParseFile("testdata/k8s.yaml"))
+
+	assert.Equal(t, []Image{
+		{Ref: "postgres:14", Sources: []string{
+			"testdata/docker-compose.yml: service db",
+			"testdata/k8s.yaml: CronJob/backup container backup",
+		}},
+		{Ref: "docker.io/library/nginx:1.23", Sources: []string{
+			"testdata/docker-compose.yml: service web",
+			"testdata/k8s.yaml: Deployment/web container nginx",
+		}},
+		{Ref: "example/migrate:1.0", Sources: []string{"testdata/k8s.yaml: Deployment/web container migrate"}},
+		{Ref: "busybox", Sources: []string{"testdata/k8s.yaml: Pod/debug container shell"}},
+	}, e.Images())
+
+	assert.Equal(t, []Skipped{
+		{Ref: "example/app:latest", Source: "testdata/docker-compose.yml: service app", Reason: "built from build context"},
+		{Ref: "${CACHE_IMAGE}", Source: "testdata/docker-compose.yml: service cache", Reason: "image is empty after interpolation"},
+		{Source: "testdata/docker-compose.yml: service worker", Reason: "built from build context"},
+		{Source: "testdata/k8s.yaml: Deployment/web container sidecar", Reason: "no image"},
+	}, e.Skipped())
+}
+
+func TestExtractorMalformed(t *testing.T) {
+	e := &Extractor{}
+	err := e.Parse("bad.yaml", strings.NewReader("kind: [Pod"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "bad.yaml")
+}
@@ -0,0 +1,225 @@
+// Package normalize maps levels reported by plugins in their own
+// vocabularies onto the canonical report levels, so that thresholds
+// compare levels of all plugins alike
+package normalize
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AnyPlugin is the key of rules applied to all plugins
+const AnyPlugin = "*"
+
+// Rules maps levels by plugin name, level values as reported are
+// matched case-insensitively. Classes map alert types of a plugin to a
+// level, which is used when the reported level has no mapping.
+// Severities map canonical levels to their presentation by name
+type Rules struct {
+	Plugins    map[string]PluginRules `yaml:"plugins"`
+	Severities map[string]Severity    `yaml:"severities"`
+}
+
+type PluginRules struct {
+	Levels  map[string]string `yaml:"levels"`
+	Classes map[string]string `yaml:"classes"`
+}
+
+// Default is rules of first-party plugins, python plugins report
+// values of levels while go plugins report names of levels, and
+// veinmind-sensitive is implemented by both
+var Default = Rules{Plugins: map[string]PluginRules{
+	"veinmind-backdoor":  {Levels: pythonLevels},
+	"veinmind-history":   {Levels: pythonLevels},
+	"veinmind-sensitive": {Levels: merge(pythonLevels, goLevels)},
+	"veinmind-malicious": {Levels: goLevels},
+	"veinmind-weakpass":  {Levels: goLevels},
+	"veinmind-asset":     {Levels: goLevels},
+	"veinmind-basic":     {Levels: goLevels},
+}, Severities: DefaultSeverities}
+
+var (
+	pythonLevels = map[string]string{"0": "low", "1": "medium", "2": "high", "3": "critical"}
+	goLevels     = map[string]string{"low": "low", "medium": "medium", "high": "high", "critical": "critical", "none": "none"}
+)
+
+func merge(maps ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, m := range maps {
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// Load parses rules file, rules of a plugin in file replace its
+// default rules
+func Load(path string) (Rules, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Rules{}, err
+	}
+
+	rules := Rules{}
+	if err := yaml.Unmarshal(b, &rules); err != nil {
+		return Rules{}, errors.Wrapf(err, "normalize rules %s", path)
+	}
+	return Merge(Default, rules), nil
+}
+
+// Merge returns rules with plugins of override replacing those of
+// base, severities of override are merged into those of base by field
+func Merge(base Rules, override Rules) Rules {
+	merged := Rules{Plugins: map[string]PluginRules{}, Severities: map[string]Severity{}}
+	for name, p := range base.Plugins {
+		merged.Plugins[name] = p
+	}
+	for name, p := range override.Plugins {
+		merged.Plugins[name] = p
+	}
+	for level, s := range base.Severities {
+		merged.Severities[strings.ToLower(level)] = s
+	}
+	for level, s := range override.Severities {
+		level = strings.ToLower(level)
+		merged.Severities[level] = mergeSeverity(merged.Severities[level], s)
+	}
+	return merged
+}
+
+type compiled struct {
+	levels  map[string]report.Level
+	classes map[report.AlertType]report.Level
+}
+
+// Normalizer normalizes levels by rules, values without mapping are
+// reported once per plugin through Unmapped
+type Normalizer struct {
+	Unmapped func(plugin string, value string, level report.Level)
+
+	plugins    map[string]compiled
+	severities map[report.Level]Severity
+	seen       map[string]map[string]struct{}
+	mu         sync.Mutex
+}
+
+// New compiles rules, names of levels and alert types are validated
+func New(rules Rules) (*Normalizer, error) {
+	n := &Normalizer{
+		plugins:    map[string]compiled{},
+		severities: map[report.Level]Severity{},
+		seen:       map[string]map[string]struct{}{},
+	}
+	for l, s := range rules.Severities {
+		level, err := parseLevel(l)
+		if err != nil {
+			return nil, errors.Wrap(err, "severities of normalize rules")
+		}
+		if err := s.check(); err != nil {
+			return nil, errors.Wrapf(err, "severity of %s", l)
+		}
+		n.severities[level] = s
+	}
+	for name, p := range rules.Plugins {
+		c := compiled{
+			levels:  map[string]report.Level{},
+			classes: map[report.AlertType]report.Level{},
+		}
+		for value, l := range p.Levels {
+			level, err := parseLevel(l)
+			if err != nil {
+				return nil, errors.Wrapf(err, "normalize rules of %s", name)
+			}
+			c.levels[strings.ToLower(value)] = level
+		}
+		for class, l := range p.Classes {
+			alert, err := parseAlertType(class)
+			if err != nil {
+				return nil, errors.Wrapf(err, "normalize rules of %s", name)
+			}
+			level, err := parseLevel(l)
+			if err != nil {
+				return nil, errors.Wrapf(err, "normalize rules of %s", name)
+			}
+			c.classes[alert] = level
+		}
+		n.plugins[name] = c
+	}
+	return n, nil
+}
+
+// Normalize returns canonical level of value reported by plugin, rules
+// of plugin are tried before rules of all plugins, then canonical names
+// and values of levels. Unmapped values keep level decoded from event,
+// as well as events without level
+func (n *Normalizer) Normalize(plugin string, value string, evt report.ReportEvent) report.Level {
+	key := strings.ToLower(strings.TrimSpace(value))
+	for _, name := range []string{plugin, AnyPlugin} {
+		if level, ok := n.plugins[name].levels[key]; ok {
+			return level
+		}
+	}
+	if level, err := parseLevel(key); err == nil {
+		return level
+	}
+	if i, err := strconv.ParseUint(key, 10, 32); err == nil && i <= uint64(report.None) {
+		return report.Level(i)
+	}
+	for _, name := range []string{plugin, AnyPlugin} {
+		if level, ok := n.plugins[name].classes[evt.AlertType]; ok {
+			return level
+		}
+	}
+
+	if value != "" {
+		n.unmapped(plugin, value, evt.Level)
+	}
+	return evt.Level
+}
+
+// Severities returns presentation of canonical levels
+func (n *Normalizer) Severities() map[report.Level]Severity {
+	return n.severities
+}
+
+func (n *Normalizer) unmapped(plugin string, value string, level report.Level) {
+	n.mu.Lock()
+	seen, ok := n.seen[plugin]
+	if !ok {
+		seen = map[string]struct{}{}
+		n.seen[plugin] = seen
+	}
+	_, reported := seen[value]
+	seen[value] = struct{}{}
+	n.mu.Unlock()
+
+	if !reported && n.Unmapped != nil {
+		n.Unmapped(plugin, value, level)
+	}
+}
+
+func parseLevel(s string) (report.Level, error) {
+	for l := report.Low; l <= report.None; l++ {
+		b, _ := l.MarshalJSON()
+		if strings.EqualFold(strings.Trim(string(b), `"`), s) {
+			return l, nil
+		}
+	}
+	return report.None, errors.Errorf("unknown level %#v", s)
+}
+
+func parseAlertType(s string) (report.AlertType, error) {
+	for a := report.Vulnerability; a <= report.Archive; a++ {
+		b, _ := a.MarshalJSON()
+		if strings.EqualFold(strings.Trim(string(b), `"`), s) {
+			return a, nil
+		}
+	}
+	return 0, errors.Errorf("unknown alert type %#v", s)
+}
@@ -0,0 +1,77 @@
+package normalize
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	rules, err := Load("testdata/rules.yaml")
+	assert.Nil(t, err)
+	n, err := New(rules)
+	assert.Nil(t, err)
+
+	unmapped := [][2]string{}
+	n.Unmapped = func(plugin string, value string, level report.Level) {
+		unmapped = append(unmapped, [2]string{plugin, value})
+	}
+
+	for _, tc := range []struct {
+		plugin string
+		value  string
+		alert  report.AlertType
+		level  report.Level
+	}{
+		{"veinmind-custom", "5", report.Backdoor, report.Critical},
+		{"veinmind-custom", "INFO", report.Backdoor, report.None},
+		{"veinmind-custom", "Serious", report.Backdoor, report.High},
+		{"veinmind-custom", "HIGH", report.Backdoor, report.High},
+		{"veinmind-custom", "1", report.Backdoor, report.Medium},
+		{"veinmind-custom", "urgent", report.Sensitive, report.Medium},
+		{"veinmind-history", "2", report.AbnormalHistory, report.Critical},
+		{"veinmind-backdoor", "2", report.Backdoor, report.High},
+		{"veinmind-other", "urgent", report.Backdoor, report.Low},
+		{"veinmind-other", "urgent", report.Backdoor, report.Low},
+		{"veinmind-other", "", report.Backdoor, report.Low},
+	} {
+		level := n.Normalize(tc.plugin, tc.value, report.ReportEvent{Level: report.Low, AlertType: tc.alert})
+		assert.Equal(t, tc.level, level, tc.plugin+" "+tc.value)
+	}
+	assert.Equal(t, [][2]string{{"veinmind-other", "urgent"}}, unmapped)
+}
+
+func TestNewInvalid(t *testing.T) {
+	_, err := New(Rules{Plugins: map[string]PluginRules{"p": {Levels: map[string]string{"x": "severe"}}}})
+	assert.Error(t, err)
+	_, err = New(Rules{Plugins: map[string]PluginRules{"p": {Classes: map[string]string{"Secret": "high"}}}})
+	assert.Error(t, err)
+	_, err = New(Default)
+	assert.Nil(t, err)
+}
+
+func TestSeverities(t *testing.T) {
+	rules, err := Load("testdata/rules.yaml")
+	assert.Nil(t, err)
+	n, err := New(rules)
+	assert.Nil(t, err)
+
+	severities := n.Severities()
+	// Fields not given keep their defaults
+	assert.Equal(t, "warning", severities[report.High].SARIFLevel)
+	assert.Equal(t, 8.0, *severities[report.High].SecuritySeverity)
+	assert.Equal(t, "warning", severities[report.Medium].SARIFLevel)
+	assert.Equal(t, 6.5, *severities[report.Medium].SecuritySeverity)
+	assert.Equal(t, "magenta", severities[report.Medium].Color)
+	assert.Equal(t, DefaultSeverities["critical"], severities[report.Critical])
+
+	for _, s := range []map[string]Severity{
+		{"severe": {}},
+		{"high": {SARIFLevel: "fatal"}},
+		{"high": {SecuritySeverity: score(11)}},
+		{"high": {Color: "pink"}},
+	} {
+		_, err := New(Rules{Severities: s})
+		assert.Error(t, err)
+	}
+}
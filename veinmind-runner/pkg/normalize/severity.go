@@ -0,0 +1,91 @@
+package normalize
+
+import (
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+// SARIFLevels are levels of SARIF results
+var SARIFLevels = []string{"error", "warning", "note", "none"}
+
+// Colors are ANSI escape codes of colors of levels on terminals, codes
+// are of the same length so that colored columns keep aligned
+var Colors = map[string]string{
+	"red":      "0;31",
+	"green":    "0;32",
+	"yellow":   "0;33",
+	"blue":     "0;34",
+	"magenta":  "0;35",
+	"cyan":     "0;36",
+	"white":    "0;37",
+	"bold-red": "1;31",
+}
+
+// NoColor is escape code of the default color
+const NoColor = "0;39"
+
+// Severity is presentation of a canonical level. SARIFLevel is level of
+// SARIF results, SecuritySeverity is score of SARIF rules from 0.0 to
+// 10.0 which code scanning of GitHub ranks alerts by, and Color is
+// color of the level in tables written to terminals
+type Severity struct {
+	SARIFLevel       string   `yaml:"sarif_level"`
+	SecuritySeverity *float64 `yaml:"security_severity"`
+	Color            string   `yaml:"color"`
+}
+
+// DefaultSeverities are scored at the middle of ranges of GitHub, e.g.
+// scores from 7.0 to 8.9 are high
+var DefaultSeverities = map[string]Severity{
+	"critical": {SARIFLevel: "error", SecuritySeverity: score(9.5), Color: "bold-red"},
+	"high":     {SARIFLevel: "error", SecuritySeverity: score(8.0), Color: "red"},
+	"medium":   {SARIFLevel: "warning", SecuritySeverity: score(5.5), Color: "yellow"},
+	"low":      {SARIFLevel: "note", SecuritySeverity: score(2.0), Color: "cyan"},
+	"none":     {SARIFLevel: "none"},
+}
+
+func score(f float64) *float64 {
+	return &f
+}
+
+// mergeSeverity returns base with fields set in override replaced
+func mergeSeverity(base Severity, override Severity) Severity {
+	if override.SARIFLevel != "" {
+		base.SARIFLevel = override.SARIFLevel
+	}
+	if override.SecuritySeverity != nil {
+		base.SecuritySeverity = override.SecuritySeverity
+	}
+	if override.Color != "" {
+		base.Color = override.Color
+	}
+	return base
+}
+
+func (s Severity) check() error {
+	if s.SARIFLevel != "" && !contains(SARIFLevels, s.SARIFLevel) {
+		return errors.Errorf("unknown sarif level %#v, expect one of %s", s.SARIFLevel, strings.Join(SARIFLevels, ","))
+	}
+	if s.SecuritySeverity != nil && (*s.SecuritySeverity < 0 || *s.SecuritySeverity > 10) {
+		return errors.Errorf("security severity %v out of range 0.0-10.0", *s.SecuritySeverity)
+	}
+	if _, ok := Colors[s.Color]; s.Color != "" && !ok {
+		names := []string{}
+		for name := range Colors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return errors.Errorf("unknown color %#v, expect one of %s", s.Color, strings.Join(names, ","))
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,254 @@
+// Package notary verifies Docker Content Trust data of images, which
+// is TUF metadata served by a Notary server. Only the subset of TUF
+// needed to resolve a signed tag is implemented: metadata is fetched
+// fresh for every verification and nothing is cached between them
+package notary
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/pkg/errors"
+	"math/big"
+	"time"
+)
+
+const (
+	RoleRoot      = "root"
+	RoleTimestamp = "timestamp"
+	RoleSnapshot  = "snapshot"
+	RoleTargets   = "targets"
+	// RoleReleases is the delegation docker signs tags into when
+	// delegations are set up, it takes precedence over targets
+	RoleReleases = "targets/releases"
+)
+
+var (
+	ErrNoTrustData    = errors.New("notary: no trust data")
+	ErrTargetNotFound = errors.New("notary: no signed target")
+	ErrUntrustedRoot  = errors.New("notary: root isn't signed by pinned root keys")
+)
+
+// Signed is the envelope of TUF metadata, signatures are made over
+// the canonical JSON of Signed which is served verbatim by Notary
+type Signed struct {
+	Signed     json.RawMessage `json:"signed"`
+	Signatures []Signature     `json:"signatures"`
+}
+
+type Signature struct {
+	KeyID  string `json:"keyid"`
+	Method string `json:"method"`
+	Sig    []byte `json:"sig"`
+}
+
+type Key struct {
+	Type  string `json:"keytype"`
+	Value struct {
+		Public []byte `json:"public"`
+	} `json:"keyval"`
+}
+
+type Role struct {
+	KeyIDs    []string `json:"keyids"`
+	Threshold int      `json:"threshold"`
+}
+
+type Root struct {
+	Expires time.Time       `json:"expires"`
+	Keys    map[string]Key  `json:"keys"`
+	Roles   map[string]Role `json:"roles"`
+}
+
+type FileMeta struct {
+	Length int64             `json:"length"`
+	Hashes map[string][]byte `json:"hashes"`
+}
+
+// Meta is signed part of timestamp and snapshot
+type Meta struct {
+	Expires time.Time           `json:"expires"`
+	Meta    map[string]FileMeta `json:"meta"`
+}
+
+type DelegationRole struct {
+	Role
+	Name string `json:"name"`
+}
+
+type Targets struct {
+	Expires     time.Time           `json:"expires"`
+	Targets     map[string]FileMeta `json:"targets"`
+	Delegations struct {
+		Keys  map[string]Key   `json:"keys"`
+		Roles []DelegationRole `json:"roles"`
+	} `json:"delegations"`
+}
+
+// PublicKey returns public key of key, certificates of x509 key types
+// are PEM encoded and their expiry isn't checked as docker does
+func (k Key) PublicKey() (crypto.PublicKey, error) {
+	switch k.Type {
+	case "ecdsa", "rsa":
+		return x509.ParsePKIXPublicKey(k.Value.Public)
+	case "ecdsa-x509", "rsa-x509":
+		block, _ := pem.Decode(k.Value.Public)
+		if block == nil {
+			return nil, errors.New("notary: key certificate is not PEM encoded")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "notary")
+		}
+		return cert.PublicKey, nil
+	case "ed25519":
+		if len(k.Value.Public) != ed25519.PublicKeySize {
+			return nil, errors.New("notary: invalid ed25519 key")
+		}
+		return ed25519.PublicKey(k.Value.Public), nil
+	default:
+		return nil, errors.Errorf("notary: unsupported key type %#v", k.Type)
+	}
+}
+
+// verifySignature verifies sig of msg by key, ecdsa signatures of
+// Notary are r and s concatenated rather than ASN.1 encoded
+func verifySignature(key crypto.PublicKey, method string, msg []byte, sig []byte) bool {
+	digest := sha256.Sum256(msg)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if method != "ecdsa" || len(sig) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(k, digest[:], r, s)
+	case *rsa.PublicKey:
+		switch method {
+		case "rsapss":
+			return rsa.VerifyPSS(k, crypto.SHA256, digest[:], sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		case "rsapkcs1v15":
+			return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+		}
+	case ed25519.PublicKey:
+		return method == "ed25519" && ed25519.Verify(k, msg, sig)
+	}
+	return false
+}
+
+// verifyRole checks that s is signed by threshold of distinct keys of
+// role and returns ids of keys with valid signatures
+func verifyRole(s Signed, keys map[string]Key, role Role) ([]string, error) {
+	allowed := map[string]struct{}{}
+	for _, id := range role.KeyIDs {
+		allowed[id] = struct{}{}
+	}
+
+	valid := []string{}
+	seen := map[string]struct{}{}
+	for _, sig := range s.Signatures {
+		if _, ok := allowed[sig.KeyID]; !ok {
+			continue
+		}
+		if _, ok := seen[sig.KeyID]; ok {
+			continue
+		}
+		key, ok := keys[sig.KeyID]
+		if !ok {
+			continue
+		}
+		pub, err := key.PublicKey()
+		if err != nil {
+			continue
+		}
+		if verifySignature(pub, sig.Method, s.Signed, sig.Sig) {
+			seen[sig.KeyID] = struct{}{}
+			valid = append(valid, sig.KeyID)
+		}
+	}
+
+	threshold := role.Threshold
+	if threshold < 1 {
+		threshold = 1
+	}
+	if len(valid) < threshold {
+		return nil, errors.Errorf("notary: %d of %d required signatures are valid", len(valid), threshold)
+	}
+	return valid, nil
+}
+
+// checkMeta checks b against its length and sha256 recorded by meta
+func checkMeta(name string, meta FileMeta, b []byte) error {
+	if meta.Length > 0 && int64(len(b)) != meta.Length {
+		return errors.Errorf("notary: length of %s doesn't match", name)
+	}
+	expected, ok := meta.Hashes["sha256"]
+	if !ok {
+		return errors.Errorf("notary: no sha256 of %s", name)
+	}
+	actual := sha256.Sum256(b)
+	if string(expected) != string(actual[:]) {
+		return errors.Errorf("notary: sha256 of %s doesn't match", name)
+	}
+	return nil
+}
+
+func checkExpires(role string, expires time.Time, now time.Time) error {
+	if now.After(expires) {
+		return errors.Errorf("notary: %s expired at %s", role, expires.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// samePublicKey compares public keys regardless of their encodings
+func samePublicKey(a crypto.PublicKey, b crypto.PublicKey) bool {
+	switch a := a.(type) {
+	case *ecdsa.PublicKey:
+		b, ok := b.(*ecdsa.PublicKey)
+		return ok && a.Curve == b.Curve && a.X.Cmp(b.X) == 0 && a.Y.Cmp(b.Y) == 0
+	case *rsa.PublicKey:
+		b, ok := b.(*rsa.PublicKey)
+		return ok && a.E == b.E && a.N.Cmp(b.N) == 0
+	case ed25519.PublicKey:
+		b, ok := b.(ed25519.PublicKey)
+		return ok && a.Equal(b)
+	}
+	return false
+}
+
+// ParseRootKeys parses pinned root keys from PEM encoded certificates
+// or public keys
+func ParseRootKeys(b []byte) ([]crypto.PublicKey, error) {
+	keys := []crypto.PublicKey{}
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, errors.Wrap(err, "notary")
+			}
+			keys = append(keys, cert.PublicKey)
+		case "PUBLIC KEY":
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, errors.Wrap(err, "notary")
+			}
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("notary: no root key found")
+	}
+	return keys, nil
+}
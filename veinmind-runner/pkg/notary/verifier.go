@@ -0,0 +1,378 @@
+package notary
+
+import (
+	"crypto"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/distribution/distribution/reference"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DockerHubServer is trust server of images of docker hub
+const DockerHubServer = "https://notary.docker.io"
+
+// Credentials returns username and password to get token of trust
+// server for ref, empty username means anonymous
+type Credentials func(ref string) (username string, password string)
+
+// Verifier resolves signed targets of image references from trust
+// server, root of repositories must be signed by one of RootKeys if
+// any is pinned, otherwise root is trusted as served
+type Verifier struct {
+	// Server is address of trust server, empty means the trust server
+	// of registry as docker does
+	Server      string
+	RootKeys    []crypto.PublicKey
+	Credentials Credentials
+	Client      *http.Client
+	// Now returns current time to check expiry of metadata
+	Now func() time.Time
+}
+
+// Target is tag resolved from trust data
+type Target struct {
+	// GUN is globally unique name of repository in trust server
+	GUN    string
+	Name   string
+	Digest string
+	// Role is the role signing target, Signers are ids of its keys
+	// with valid signatures
+	Role    string
+	Signers []string
+}
+
+type repo struct {
+	ref    string
+	server string
+	gun    string
+	path   string
+	tag    string
+	digest string
+	token  string
+}
+
+// Verify resolves target of ref, the tag of ref or the latest tag is
+// looked up, references by digest match target of any tag
+func (v *Verifier) Verify(ref string) (Target, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return Target{}, err
+	}
+	named = reference.TagNameOnly(named)
+
+	r := &repo{ref: ref, server: v.Server, gun: named.Name(), path: reference.Path(named)}
+	if r.server == "" {
+		r.server = TrustServer(reference.Domain(named))
+	}
+	if tagged, ok := named.(reference.Tagged); ok {
+		r.tag = tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		r.digest = digested.Digest().String()
+		r.tag = ""
+	}
+
+	root, err := v.root(r)
+	if err != nil {
+		return Target{}, err
+	}
+
+	timestampB, _, err := v.fetch(r, RoleTimestamp, root.Keys, root.Roles[RoleTimestamp])
+	if err != nil {
+		return Target{}, err
+	}
+	ts := Meta{}
+	if err := v.decode(RoleTimestamp, timestampB, &ts); err != nil {
+		return Target{}, err
+	}
+
+	snapshotB, _, err := v.fetchChecked(r, RoleSnapshot, ts.Meta, root.Keys, root.Roles[RoleSnapshot])
+	if err != nil {
+		return Target{}, err
+	}
+	snapshot := Meta{}
+	if err := v.decode(RoleSnapshot, snapshotB, &snapshot); err != nil {
+		return Target{}, err
+	}
+
+	targetsB, signers, err := v.fetchChecked(r, RoleTargets, snapshot.Meta, root.Keys, root.Roles[RoleTargets])
+	if err != nil {
+		return Target{}, err
+	}
+	targets := Targets{}
+	if err := v.decode(RoleTargets, targetsB, &targets); err != nil {
+		return Target{}, err
+	}
+
+	// Tags signed by releases delegation take precedence as docker does
+	for _, d := range targets.Delegations.Roles {
+		if d.Name != RoleReleases {
+			continue
+		}
+		releasesB, releasesSigners, err := v.fetchChecked(r, RoleReleases, snapshot.Meta, targets.Delegations.Keys, d.Role)
+		if err != nil {
+			return Target{}, err
+		}
+		releases := Targets{}
+		if err := v.decode(RoleReleases, releasesB, &releases); err != nil {
+			return Target{}, err
+		}
+		if t, ok := r.find(releases); ok {
+			t.Role, t.Signers = RoleReleases, releasesSigners
+			return t, nil
+		}
+	}
+
+	if t, ok := r.find(targets); ok {
+		t.Role, t.Signers = RoleTargets, signers
+		return t, nil
+	}
+	return Target{}, ErrTargetNotFound
+}
+
+// TrustServer returns trust server of registry as docker does
+func TrustServer(registry string) string {
+	if registry == "docker.io" || registry == "index.docker.io" {
+		return DockerHubServer
+	}
+	return "https://" + registry
+}
+
+func (r *repo) find(targets Targets) (Target, bool) {
+	for name, meta := range targets.Targets {
+		if r.tag != "" && name != r.tag {
+			continue
+		}
+		hash, ok := meta.Hashes["sha256"]
+		if !ok {
+			continue
+		}
+		digest := "sha256:" + hex.EncodeToString(hash)
+		if r.digest != "" && digest != r.digest {
+			continue
+		}
+		return Target{GUN: r.gun, Name: name, Digest: digest}, true
+	}
+	return Target{}, false
+}
+
+// root fetches root of repository and verifies it is signed by its own
+// root role and, if pinned, by one of pinned root keys
+func (v *Verifier) root(r *repo) (Root, error) {
+	b, err := v.get(r, RoleRoot)
+	if err != nil {
+		return Root{}, err
+	}
+	s := Signed{}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return Root{}, errors.Wrap(err, "notary: root")
+	}
+	root := Root{}
+	if err := json.Unmarshal(s.Signed, &root); err != nil {
+		return Root{}, errors.Wrap(err, "notary: root")
+	}
+
+	valid, err := verifyRole(s, root.Keys, root.Roles[RoleRoot])
+	if err != nil {
+		return Root{}, errors.Wrap(err, "root")
+	}
+	if len(v.RootKeys) > 0 && !v.pinned(root, valid) {
+		return Root{}, ErrUntrustedRoot
+	}
+	return root, checkExpires(RoleRoot, root.Expires, v.now())
+}
+
+func (v *Verifier) pinned(root Root, valid []string) bool {
+	for _, id := range valid {
+		pub, err := root.Keys[id].PublicKey()
+		if err != nil {
+			continue
+		}
+		for _, pinned := range v.RootKeys {
+			if samePublicKey(pub, pinned) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fetchChecked fetches metadata of role which is recorded by parent
+// metadata, so that the served one must match its hash
+func (v *Verifier) fetchChecked(r *repo, role string, parent map[string]FileMeta, keys map[string]Key, signers Role) ([]byte, []string, error) {
+	meta, ok := parent[role]
+	if !ok {
+		return nil, nil, errors.Errorf("notary: %s isn't recorded", role)
+	}
+	b, err := v.get(r, role)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkMeta(role, meta, b); err != nil {
+		return nil, nil, err
+	}
+	return v.verify(role, b, keys, signers)
+}
+
+func (v *Verifier) fetch(r *repo, role string, keys map[string]Key, signers Role) ([]byte, []string, error) {
+	b, err := v.get(r, role)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v.verify(role, b, keys, signers)
+}
+
+// verify verifies signatures of metadata and returns its signed part
+func (v *Verifier) verify(role string, b []byte, keys map[string]Key, signers Role) ([]byte, []string, error) {
+	s := Signed{}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, nil, errors.Wrapf(err, "notary: %s", role)
+	}
+	valid, err := verifyRole(s, keys, signers)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, role)
+	}
+	return s.Signed, valid, nil
+}
+
+func (v *Verifier) decode(role string, b []byte, out interface{}) error {
+	if err := json.Unmarshal(b, out); err != nil {
+		return errors.Wrapf(err, "notary: %s", role)
+	}
+	var expires time.Time
+	switch m := out.(type) {
+	case *Meta:
+		expires = m.Expires
+	case *Targets:
+		expires = m.Expires
+	}
+	return checkExpires(role, expires, v.now())
+}
+
+func (v *Verifier) now() time.Time {
+	if v.Now != nil {
+		return v.Now()
+	}
+	return time.Now()
+}
+
+func (v *Verifier) client() *http.Client {
+	if v.Client != nil {
+		return v.Client
+	}
+	return http.DefaultClient
+}
+
+// get fetches metadata of role, token is requested on the first
+// challenge of trust server and reused for the other roles
+func (v *Verifier) get(r *repo, role string) ([]byte, error) {
+	u := strings.TrimRight(r.server, "/") + "/v2/" + r.gun + "/_trust/tuf/" + role + ".json"
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if r.token != "" {
+			req.Header.Set("Authorization", "Bearer "+r.token)
+		}
+
+		resp, err := v.client().Do(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "notary")
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "notary")
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			return b, nil
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, errors.Wrapf(ErrNoTrustData, "%s of %s", role, r.gun)
+		case resp.StatusCode == http.StatusUnauthorized && attempt == 0:
+			if r.token, err = v.token(r, resp.Header.Get("WWW-Authenticate")); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errors.Errorf("notary: get %s of %s: %s", role, r.gun, resp.Status)
+		}
+	}
+}
+
+// token requests bearer token from realm of challenge
+func (v *Verifier) token(r *repo, challenge string) (string, error) {
+	params := parseChallenge(challenge)
+	realm, ok := params["realm"]
+	if !ok {
+		return "", errors.Errorf("notary: unsupported challenge %#v", challenge)
+	}
+
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", errors.Wrap(err, "notary")
+	}
+	q := u.Query()
+	if service, ok := params["service"]; ok {
+		q.Set("service", service)
+	}
+	scope, ok := params["scope"]
+	if !ok {
+		scope = "repository:" + r.path + ":pull"
+	}
+	q.Set("scope", scope)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if v.Credentials != nil {
+		if username, password := v.Credentials(r.ref); username != "" {
+			req.SetBasicAuth(username, password)
+		}
+	}
+
+	resp, err := v.client().Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "notary")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("notary: get token: %s", resp.Status)
+	}
+
+	t := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", errors.Wrap(err, "notary: get token")
+	}
+	if t.Token == "" {
+		t.Token = t.AccessToken
+	}
+	return t.Token, nil
+}
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// parseChallenge parses parameters of bearer challenge, values are
+// quoted and may contain commas
+func parseChallenge(challenge string) map[string]string {
+	params := map[string]string{}
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return params
+	}
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(m[1])] = m[2]
+	}
+	return params
+}
@@ -0,0 +1,226 @@
+package notary
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testKey struct {
+	id   string
+	priv *ecdsa.PrivateKey
+	key  Key
+}
+
+func newTestKey(t *testing.T, id string, cert bool) testKey {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	k := testKey{id: id, priv: priv}
+	if cert {
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "docker.io/library/nginx"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+		assert.NoError(t, err)
+		k.key.Type = "ecdsa-x509"
+		k.key.Value.Public = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	} else {
+		der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+		assert.NoError(t, err)
+		k.key.Type = "ecdsa"
+		k.key.Value.Public = der
+	}
+	return k
+}
+
+func (k testKey) sign(t *testing.T, signed interface{}) []byte {
+	b, err := json.Marshal(signed)
+	assert.NoError(t, err)
+	digest := sha256.Sum256(b)
+	r, s, err := ecdsa.Sign(rand.Reader, k.priv, digest[:])
+	assert.NoError(t, err)
+
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	out, err := json.Marshal(Signed{
+		Signed:     b,
+		Signatures: []Signature{{KeyID: k.id, Method: "ecdsa", Sig: sig}},
+	})
+	assert.NoError(t, err)
+	return out
+}
+
+func fileMeta(b []byte) FileMeta {
+	sum := sha256.Sum256(b)
+	return FileMeta{Length: int64(len(b)), Hashes: map[string][]byte{"sha256": sum[:]}}
+}
+
+// trustRepo builds trust data of nginx with latest tag signed by
+// releases delegation and stable tag signed by targets
+func trustRepo(t *testing.T, root testKey, tamper bool) map[string][]byte {
+	keys := map[string]testKey{}
+	for _, role := range []string{RoleTimestamp, RoleSnapshot, RoleTargets, RoleReleases} {
+		keys[role] = newTestKey(t, role+"-key", false)
+	}
+	expires := time.Now().Add(time.Hour)
+	hash := func(s string) FileMeta {
+		sum := sha256.Sum256([]byte(s))
+		return FileMeta{Length: 1, Hashes: map[string][]byte{"sha256": sum[:]}}
+	}
+
+	rootSigned := Root{
+		Expires: expires,
+		Keys:    map[string]Key{root.id: root.key},
+		Roles:   map[string]Role{RoleRoot: {KeyIDs: []string{root.id}, Threshold: 1}},
+	}
+	for _, role := range []string{RoleTimestamp, RoleSnapshot, RoleTargets} {
+		rootSigned.Keys[keys[role].id] = keys[role].key
+		rootSigned.Roles[role] = Role{KeyIDs: []string{keys[role].id}, Threshold: 1}
+	}
+
+	releases := Targets{Expires: expires, Targets: map[string]FileMeta{"latest": hash("latest")}}
+	targets := Targets{Expires: expires, Targets: map[string]FileMeta{"stable": hash("stable")}}
+	targets.Delegations.Keys = map[string]Key{keys[RoleReleases].id: keys[RoleReleases].key}
+	targets.Delegations.Roles = []DelegationRole{{
+		Name: RoleReleases,
+		Role: Role{KeyIDs: []string{keys[RoleReleases].id}, Threshold: 1},
+	}}
+
+	files := map[string][]byte{
+		RoleRoot:     root.sign(t, rootSigned),
+		RoleTargets:  keys[RoleTargets].sign(t, targets),
+		RoleReleases: keys[RoleReleases].sign(t, releases),
+	}
+	files[RoleSnapshot] = keys[RoleSnapshot].sign(t, Meta{Expires: expires, Meta: map[string]FileMeta{
+		RoleRoot:     fileMeta(files[RoleRoot]),
+		RoleTargets:  fileMeta(files[RoleTargets]),
+		RoleReleases: fileMeta(files[RoleReleases]),
+	}})
+	files[RoleTimestamp] = keys[RoleTimestamp].sign(t, Meta{Expires: expires, Meta: map[string]FileMeta{
+		RoleSnapshot: fileMeta(files[RoleSnapshot]),
+	}})
+
+	if tamper {
+		releases.Targets["latest"] = hash("evil")
+		files[RoleReleases] = keys[RoleReleases].sign(t, releases)
+	}
+	return files
+}
+
+func trustServer(t *testing.T, files map[string][]byte) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "repository:docker.io/library/nginx:pull", r.URL.Query().Get("scope"))
+		_, _ = w.Write([]byte(`{"token":"secret"}`))
+	})
+	var ts *httptest.Server
+	mux.HandleFunc("/v2/docker.io/library/nginx/_trust/tuf/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+ts.URL+`/token",service="notary",scope="repository:docker.io/library/nginx:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		role := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2/docker.io/library/nginx/_trust/tuf/"), ".json")
+		b, ok := files[role]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(b)
+	})
+	ts = httptest.NewServer(mux)
+	return ts
+}
+
+func digestOf(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestVerify(t *testing.T) {
+	root := newTestKey(t, "root-key", true)
+	ts := trustServer(t, trustRepo(t, root, false))
+	defer ts.Close()
+
+	rootPub, err := root.key.PublicKey()
+	assert.NoError(t, err)
+	v := &Verifier{Server: ts.URL, RootKeys: []crypto.PublicKey{rootPub}}
+
+	target, err := v.Verify("nginx")
+	assert.NoError(t, err)
+	assert.Equal(t, "docker.io/library/nginx", target.GUN)
+	assert.Equal(t, "latest", target.Name)
+	assert.Equal(t, digestOf("latest"), target.Digest)
+	assert.Equal(t, RoleReleases, target.Role)
+	assert.Equal(t, []string{RoleReleases + "-key"}, target.Signers)
+
+	target, err = v.Verify("nginx:stable")
+	assert.NoError(t, err)
+	assert.Equal(t, RoleTargets, target.Role)
+
+	target, err = v.Verify("nginx@" + digestOf("stable"))
+	assert.NoError(t, err)
+	assert.Equal(t, "stable", target.Name)
+
+	_, err = v.Verify("nginx:unsigned")
+	assert.Equal(t, ErrTargetNotFound, err)
+}
+
+func TestVerifyUntrusted(t *testing.T) {
+	root := newTestKey(t, "root-key", true)
+	pinned := newTestKey(t, "pinned-key", false)
+	pinnedPub, err := pinned.key.PublicKey()
+	assert.NoError(t, err)
+
+	ts := trustServer(t, trustRepo(t, root, false))
+	defer ts.Close()
+	v := &Verifier{Server: ts.URL, RootKeys: []crypto.PublicKey{pinnedPub}}
+	_, err = v.Verify("nginx")
+	assert.Equal(t, ErrUntrustedRoot, err)
+
+	// Delegation modified without updating snapshot
+	tampered := trustServer(t, trustRepo(t, root, true))
+	defer tampered.Close()
+	v = &Verifier{Server: tampered.URL}
+	_, err = v.Verify("nginx")
+	assert.EqualError(t, err, "notary: sha256 of targets/releases doesn't match")
+
+	// Expired metadata
+	v = &Verifier{Server: ts.URL, Now: func() time.Time { return time.Now().Add(2 * time.Hour) }}
+	_, err = v.Verify("nginx")
+	assert.Error(t, err)
+
+	_, err = (&Verifier{Server: ts.URL}).Verify("library/redis")
+	assert.True(t, errors.Is(err, ErrNoTrustData), err)
+}
+
+func TestParseRootKeys(t *testing.T) {
+	root := newTestKey(t, "root-key", true)
+	keys, err := ParseRootKeys(root.key.Value.Public)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.True(t, samePublicKey(keys[0], &root.priv.PublicKey))
+
+	_, err = ParseRootKeys([]byte("not pem"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,140 @@
+// Package pluginlog serializes output of plugins running in parallel,
+// so that lines of different plugins never interleave mid-line
+package pluginlog
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// Output is the destination shared by output of all plugins, every
+// write to it is a whole line or a whole group of lines
+type Output struct {
+	w      io.Writer
+	group  bool
+	mu     sync.Mutex
+	open   map[*Writer]struct{}
+	closed bool
+}
+
+// New creates output writing to w, output of each plugin execution is
+// held back and written as a contiguous block when group is set
+func New(w io.Writer, group bool) *Output {
+	return &Output{w: w, group: group, open: map[*Writer]struct{}{}}
+}
+
+// Writer returns writer of a plugin execution whose lines are prefixed
+// with prefix, it must be closed after the execution finishes
+func (o *Output) Writer(prefix string) *Writer {
+	w := &Writer{out: o, prefix: []byte("[" + prefix + "] ")}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.open[w] = struct{}{}
+	return w
+}
+
+// write writes b as a whole, output closed drops it
+func (o *Output) write(b []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return
+	}
+	_, _ = o.w.Write(b)
+}
+
+// Close flushes writers which are still open and closes output, so
+// that nothing is written after the final report is rendered. Lines
+// of plugins written later are dropped
+func (o *Output) Close() {
+	o.mu.Lock()
+	writers := []*Writer{}
+	for w := range o.open {
+		writers = append(writers, w)
+	}
+	o.mu.Unlock()
+
+	for _, w := range writers {
+		_ = w.Close()
+	}
+
+	o.mu.Lock()
+	o.closed = true
+	o.mu.Unlock()
+}
+
+// Writer buffers output of a plugin execution by line, it's safe to be
+// used as both stdout and stderr of the plugin process
+type Writer struct {
+	out     *Output
+	prefix  []byte
+	mu      sync.Mutex
+	partial []byte
+	block   []byte
+	closed  bool
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	w.partial = append(w.partial, p...)
+	lines := []byte{}
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, w.prefix...)
+		lines = append(lines, w.partial[:i+1]...)
+		w.partial = w.partial[i+1:]
+	}
+	w.emit(lines)
+	return len(p), nil
+}
+
+// emit writes lines to output, or keeps them until close when output
+// is grouped
+func (w *Writer) emit(lines []byte) {
+	if len(lines) == 0 {
+		return
+	}
+	if w.out.group {
+		w.block = append(w.block, lines...)
+		return
+	}
+	w.out.write(lines)
+}
+
+// Close writes the trailing line without newline and the block of
+// grouped output, later writes fail
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if len(w.partial) > 0 {
+		line := append(append([]byte{}, w.prefix...), w.partial...)
+		w.emit(append(line, '\n'))
+		w.partial = nil
+	}
+	if len(w.block) > 0 {
+		w.out.write(w.block)
+		w.block = nil
+	}
+
+	w.out.mu.Lock()
+	delete(w.out.open, w)
+	w.out.mu.Unlock()
+	return nil
+}
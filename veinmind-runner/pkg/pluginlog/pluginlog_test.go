@@ -0,0 +1,68 @@
+package pluginlog
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestInterleave(t *testing.T) {
+	b := &bytes.Buffer{}
+	out := New(b, false)
+
+	a := out.Writer("plugin-a/nginx:latest")
+	c := out.Writer("plugin-c/redis:latest")
+	a.Write([]byte("hello "))
+	c.Write([]byte("line 1\nline"))
+	a.Write([]byte("world\n"))
+	c.Write([]byte(" 2"))
+	assert.NoError(t, c.Close())
+	_, err := c.Write([]byte("late\n"))
+	assert.Error(t, err)
+
+	assert.Equal(t, "[plugin-c/redis:latest] line 1\n"+
+		"[plugin-a/nginx:latest] hello world\n"+
+		"[plugin-c/redis:latest] line 2\n", b.String())
+
+	// Partial lines of writers still open are flushed on close
+	a.Write([]byte("bye"))
+	out.Close()
+	assert.True(t, strings.HasSuffix(b.String(), "[plugin-a/nginx:latest] bye\n"))
+
+	// Output closed drops lines written later
+	n := b.Len()
+	late := out.Writer("plugin-d/nginx:latest")
+	late.Write([]byte("late\n"))
+	late.Close()
+	assert.Equal(t, n, b.Len())
+}
+
+func TestGroup(t *testing.T) {
+	b := &bytes.Buffer{}
+	out := New(b, true)
+
+	wg := sync.WaitGroup{}
+	for _, prefix := range []string{"a", "b", "c"} {
+		w := out.Writer(prefix)
+		wg.Add(1)
+		go func(prefix string) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				w.Write([]byte("line\n"))
+			}
+			w.Close()
+		}(prefix)
+	}
+	wg.Wait()
+
+	// Lines of each writer are contiguous
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	assert.Len(t, lines, 300)
+	for i := 0; i < 300; i += 100 {
+		for _, l := range lines[i : i+100] {
+			assert.Equal(t, lines[i], l)
+		}
+	}
+}
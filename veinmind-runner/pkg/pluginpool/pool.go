@@ -0,0 +1,275 @@
+// Package pluginpool keeps long-lived processes of plugins supporting
+// pool warm between scans, so that requests of server mode don't wait
+// for plugins to start. A process is started for the first task of its
+// plugin and asks for the next task through the pool service after
+// it's done, idle processes are told to stop after IdleTimeout
+package pluginpool
+
+import (
+	"context"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/pool"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnavailable is returned when task can't be scanned by pool,
+	// e.g. pool is full, closed or plugin crashes too often, and the
+	// plugin should be executed for the task as usual
+	ErrUnavailable = errors.New("plugin pool is unavailable")
+	// ErrExited is returned for task whose process exited before
+	// finishing it
+	ErrExited = errors.New("pooled plugin exited")
+)
+
+type Options struct {
+	// Size is max number of processes of a plugin
+	Size int
+	// IdleTimeout is how long an idle process is kept
+	IdleTimeout time.Duration
+	// MaxRestarts is number of crashes of a plugin after which its
+	// tasks aren't scanned by pool anymore
+	MaxRestarts int
+}
+
+// Launcher starts process of plugin scanning ids with services bound,
+// and blocks until process exits
+type Launcher func(ctx context.Context, ids []string, services *Services) error
+
+// Services are registered into processes started by pool, events of
+// process are reported to the task it's scanning
+type Services struct {
+	Pool   *pool.PoolService
+	Report func(evt report.ReportEvent)
+}
+
+type task struct {
+	ids    []string
+	report func(evt report.ReportEvent)
+	done   chan error
+}
+
+type worker struct {
+	plugin  string
+	tasks   chan *task
+	mu      sync.Mutex
+	current *task
+}
+
+type Pool struct {
+	opts    Options
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopCh  chan struct{}
+	mu      sync.Mutex
+	workers map[string]int
+	idle    map[string][]*worker
+	crashes map[string]int
+	closed  bool
+	wg      sync.WaitGroup
+	stats   Stats
+}
+
+func New(opts Options) *Pool {
+	if opts.Size <= 0 {
+		opts.Size = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Pool{
+		opts:    opts,
+		ctx:     ctx,
+		cancel:  cancel,
+		stopCh:  make(chan struct{}),
+		workers: map[string]int{},
+		idle:    map[string][]*worker{},
+		crashes: map[string]int{},
+	}
+}
+
+// Scan scans ids with a warm process of plugin, a process is started
+// by launch if none is idle. ErrUnavailable is returned if the task
+// isn't taken by pool
+func (p *Pool) Scan(ctx context.Context, plugin string, ids []string, reportEvent func(evt report.ReportEvent), launch Launcher) error {
+	start := time.Now()
+	t := &task{ids: ids, report: reportEvent, done: make(chan error, 1)}
+
+	p.mu.Lock()
+	if p.closed || p.crashes[plugin] > p.opts.MaxRestarts {
+		p.stats.Fallback++
+		p.mu.Unlock()
+		return ErrUnavailable
+	}
+
+	warm := false
+	if idle := p.idle[plugin]; len(idle) > 0 {
+		w := idle[len(idle)-1]
+		p.idle[plugin] = idle[:len(idle)-1]
+		// Sent with mu held so that a worker exiting meanwhile finds it
+		w.tasks <- t
+		p.mu.Unlock()
+		warm = true
+	} else if p.workers[plugin] < p.opts.Size {
+		p.workers[plugin]++
+		p.mu.Unlock()
+
+		w := &worker{plugin: plugin, tasks: make(chan *task, 1), current: t}
+		p.wg.Add(1)
+		go p.run(w, launch)
+	} else {
+		p.stats.Fallback++
+		p.mu.Unlock()
+		return ErrUnavailable
+	}
+
+	var err error
+	select {
+	case err = <-t.done:
+	case <-ctx.Done():
+		// Process keeps scanning the task, its result is dropped
+		err = ctx.Err()
+	}
+	p.observe(warm, time.Since(start))
+	return err
+}
+
+// run starts process of worker and cleans up after it exits
+func (p *Pool) run(w *worker, launch Launcher) {
+	defer p.wg.Done()
+
+	services := &Services{
+		Pool: pool.NewPoolService(func(result pool.Result) (pool.Task, error) {
+			return p.next(w, result)
+		}),
+		Report: func(evt report.ReportEvent) {
+			w.mu.Lock()
+			t := w.current
+			w.mu.Unlock()
+			if t != nil {
+				t.report(evt)
+			}
+		},
+	}
+	err := launch(p.ctx, w.current.ids, services)
+
+	w.mu.Lock()
+	t := w.current
+	w.current = nil
+	w.mu.Unlock()
+
+	p.mu.Lock()
+	p.workers[w.plugin]--
+	p.removeIdle(w)
+	if err != nil && p.ctx.Err() == nil {
+		p.crashes[w.plugin]++
+		p.stats.Crashes++
+	}
+	// Task handed out right before process exited
+	select {
+	case pending := <-w.tasks:
+		pending.done <- ErrExited
+	default:
+	}
+	p.mu.Unlock()
+
+	// Process without pool support exits after its first task
+	if t != nil {
+		if err != nil {
+			err = errors.Wrap(ErrExited, err.Error())
+		}
+		t.done <- err
+	}
+}
+
+// next finishes the current task of worker and waits for the next
+func (p *Pool) next(w *worker, result pool.Result) (pool.Task, error) {
+	w.mu.Lock()
+	t := w.current
+	w.current = nil
+	w.mu.Unlock()
+	if t != nil {
+		var err error
+		if result.Error != "" {
+			err = errors.New(result.Error)
+		}
+		t.done <- err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return pool.Task{Stop: true}, nil
+	}
+	p.idle[w.plugin] = append(p.idle[w.plugin], w)
+	p.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if p.opts.IdleTimeout > 0 {
+		timer := time.NewTimer(p.opts.IdleTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case t := <-w.tasks:
+		return p.assign(w, t), nil
+	case <-timeout:
+	case <-p.stopCh:
+	}
+
+	// Task may be handed out right before the worker is removed
+	p.mu.Lock()
+	removed := p.removeIdle(w)
+	if removed {
+		p.stats.Recycled++
+	}
+	p.mu.Unlock()
+	if !removed {
+		return p.assign(w, <-w.tasks), nil
+	}
+	return pool.Task{Stop: true}, nil
+}
+
+func (p *Pool) assign(w *worker, t *task) pool.Task {
+	w.mu.Lock()
+	w.current = t
+	w.mu.Unlock()
+	return pool.Task{ImageIDs: t.ids}
+}
+
+// removeIdle removes worker from idle ones, mu must be held
+func (p *Pool) removeIdle(w *worker) bool {
+	idle := p.idle[w.plugin]
+	for i, iw := range idle {
+		if iw == w {
+			p.idle[w.plugin] = append(idle[:i], idle[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Close stops idle processes and waits for processes to exit, those
+// still running after ctx is done are killed
+func (p *Pool) Close(ctx context.Context) {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.stopCh)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+	}
+	p.cancel()
+}
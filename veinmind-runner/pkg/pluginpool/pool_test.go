@@ -0,0 +1,167 @@
+package pluginpool
+
+import (
+	"context"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/pool"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pooledLauncher simulates plugin supporting pool, which reports an
+// event for every image and fails images named "bad"
+func pooledLauncher(started *int32) Launcher {
+	return func(ctx context.Context, ids []string, services *Services) error {
+		atomic.AddInt32(started, 1)
+		scan := func(ids []string) error {
+			for _, id := range ids {
+				if id == "bad" {
+					return errors.New("scan bad")
+				}
+				services.Report(report.ReportEvent{ID: id})
+			}
+			return nil
+		}
+
+		result := pool.Result{}
+		if err := scan(ids); err != nil {
+			result.Error = err.Error()
+		}
+		for {
+			task, err := services.Pool.Next(result)
+			if err != nil {
+				return err
+			}
+			if task.Stop {
+				return nil
+			}
+			result = pool.Result{}
+			if err := scan(task.ImageIDs); err != nil {
+				result.Error = err.Error()
+			}
+		}
+	}
+}
+
+type events struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (e *events) report(evt report.ReportEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ids = append(e.ids, evt.ID)
+}
+
+func TestPoolWarm(t *testing.T) {
+	p := New(Options{Size: 1, IdleTimeout: time.Minute})
+	started := int32(0)
+	launch := pooledLauncher(&started)
+
+	for _, id := range []string{"sha256:aa", "sha256:bb", "bad", "sha256:cc"} {
+		e := &events{}
+		err := p.Scan(context.Background(), "veinmind-backdoor", []string{id}, e.report, launch)
+		if id == "bad" {
+			assert.EqualError(t, err, "scan bad")
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, []string{id}, e.ids)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&started))
+
+	p.Close(context.Background())
+	stats := p.Stats()
+	assert.Equal(t, int64(1), stats.Cold.Requests)
+	assert.Equal(t, int64(3), stats.Warm.Requests)
+	assert.Equal(t, int64(1), stats.Recycled)
+
+	err := p.Scan(context.Background(), "veinmind-backdoor", []string{"sha256:dd"}, (&events{}).report, launch)
+	assert.Equal(t, ErrUnavailable, err)
+}
+
+func TestPoolFull(t *testing.T) {
+	p := New(Options{Size: 1, IdleTimeout: time.Minute})
+	defer p.Close(context.Background())
+
+	release := make(chan struct{})
+	blocked := func(ctx context.Context, ids []string, services *Services) error {
+		<-release
+		return nil
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- p.Scan(context.Background(), "veinmind-history", []string{"sha256:aa"}, (&events{}).report, blocked)
+	}()
+	assert.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.workers["veinmind-history"] == 1
+	}, time.Second, time.Millisecond)
+
+	err := p.Scan(context.Background(), "veinmind-history", []string{"sha256:bb"}, (&events{}).report, blocked)
+	assert.Equal(t, ErrUnavailable, err)
+
+	// Plugin without pool support exits after its first task
+	close(release)
+	assert.NoError(t, <-done)
+	assert.Equal(t, int64(1), p.Stats().Fallback)
+}
+
+func TestPoolIdle(t *testing.T) {
+	p := New(Options{Size: 2, IdleTimeout: 10 * time.Millisecond})
+	defer p.Close(context.Background())
+	started := int32(0)
+	launch := pooledLauncher(&started)
+
+	assert.NoError(t, p.Scan(context.Background(), "veinmind-backdoor", []string{"sha256:aa"}, (&events{}).report, launch))
+	assert.Eventually(t, func() bool {
+		return p.Stats().Recycled == 1
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, p.Scan(context.Background(), "veinmind-backdoor", []string{"sha256:bb"}, (&events{}).report, launch))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&started))
+}
+
+func TestPoolCrash(t *testing.T) {
+	p := New(Options{Size: 1, IdleTimeout: time.Minute, MaxRestarts: 1})
+	defer p.Close(context.Background())
+	crash := func(ctx context.Context, ids []string, services *Services) error {
+		return errors.New("signal: segmentation fault")
+	}
+
+	for i := 0; i < 2; i++ {
+		err := p.Scan(context.Background(), "veinmind-malicious", []string{"sha256:aa"}, (&events{}).report, crash)
+		assert.True(t, errors.Is(err, ErrExited), err)
+	}
+	err := p.Scan(context.Background(), "veinmind-malicious", []string{"sha256:aa"}, (&events{}).report, crash)
+	assert.Equal(t, ErrUnavailable, err)
+	assert.Equal(t, int64(2), p.Stats().Crashes)
+}
+
+func TestPoolCloseKills(t *testing.T) {
+	p := New(Options{Size: 1})
+	running := make(chan struct{})
+	stuck := func(ctx context.Context, ids []string, services *Services) error {
+		close(running)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- p.Scan(context.Background(), "veinmind-weakpass", []string{"sha256:aa"}, (&events{}).report, stuck)
+	}()
+	<-running
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	p.Close(ctx)
+	assert.True(t, errors.Is(<-done, ErrExited))
+	assert.Equal(t, int64(0), p.Stats().Crashes)
+}
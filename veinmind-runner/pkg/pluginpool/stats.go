@@ -0,0 +1,47 @@
+package pluginpool
+
+import "time"
+
+// Stats of pool, latencies of warm and cold requests are kept apart
+// to show the latency saved by warm processes
+type Stats struct {
+	Warm     Latency `json:"warm"`
+	Cold     Latency `json:"cold"`
+	Fallback int64   `json:"fallback"`
+	Crashes  int64   `json:"crashes"`
+	Recycled int64   `json:"recycled"`
+}
+
+// Latency of requests served by pool
+type Latency struct {
+	Requests int64         `json:"requests"`
+	Mean     time.Duration `json:"mean"`
+	Max      time.Duration `json:"max"`
+	total    time.Duration
+}
+
+func (l *Latency) observe(d time.Duration) {
+	l.Requests++
+	l.total += d
+	l.Mean = l.total / time.Duration(l.Requests)
+	if d > l.Max {
+		l.Max = d
+	}
+}
+
+func (p *Pool) observe(warm bool, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if warm {
+		p.stats.Warm.observe(d)
+	} else {
+		p.stats.Cold.observe(d)
+	}
+}
+
+// Stats returns statistics of pool
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
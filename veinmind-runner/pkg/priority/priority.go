@@ -0,0 +1,140 @@
+// Package priority orders scan targets by signals of their importance,
+// e.g. weights of a priorities file or usage of images, so that the
+// most important targets are scanned first when the scan is time-boxed
+package priority
+
+import (
+	"bufio"
+	"github.com/distribution/distribution/reference"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Target is a scan target, Key is image id or reference of target
+type Target struct {
+	Key  string
+	Refs []string
+	// Containers is number of running containers of image
+	Containers int
+}
+
+// Signal scores target, scores of signals are summed
+type Signal func(t Target) float64
+
+// Usage scores target by number of its running containers
+func Usage(t Target) float64 {
+	return float64(t.Containers)
+}
+
+// Order returns targets sorted by descending sum of scores of signals,
+// targets of the same score keep their order
+func Order(targets []Target, signals ...Signal) []Target {
+	scores := make([]float64, len(targets))
+	for i, t := range targets {
+		for _, s := range signals {
+			scores[i] += s(t)
+		}
+	}
+
+	index := make([]int, len(targets))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(i, j int) bool {
+		return scores[index[i]] > scores[index[j]]
+	})
+
+	ordered := make([]Target, 0, len(targets))
+	for _, i := range index {
+		ordered = append(ordered, targets[i])
+	}
+	return ordered
+}
+
+// Rule weights targets matching Pattern, which is matched by
+// path.Match against key and references in both normalized and
+// familiar forms, e.g. docker.io/library/nginx:1.21 and nginx:1.21
+type Rule struct {
+	Pattern string
+	Weight  float64
+}
+
+type Rules []Rule
+
+// Weight is signal of the highest weight of rules matching target
+func (rs Rules) Weight(t Target) float64 {
+	weight := 0.0
+	matched := false
+	for _, r := range rs {
+		if r.match(t) && (!matched || r.Weight > weight) {
+			weight, matched = r.Weight, true
+		}
+	}
+	return weight
+}
+
+func (r Rule) match(t Target) bool {
+	candidates := []string{}
+	for _, ref := range append([]string{t.Key}, t.Refs...) {
+		candidates = append(candidates, ref)
+		if named, err := reference.ParseDockerRef(ref); err == nil {
+			candidates = append(candidates, named.String(), reference.FamiliarString(named))
+		}
+	}
+
+	for _, c := range candidates {
+		if ok, _ := path.Match(r.Pattern, c); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadRules reads priorities file, see ParseRules
+func LoadRules(name string) (Rules, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rules, err := ParseRules(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "priority file %#v", name)
+	}
+	return rules, nil
+}
+
+// ParseRules parses lines of "pattern weight", blank lines and lines
+// starting with # are ignored
+func ParseRules(r io.Reader) (Rules, error) {
+	rules := Rules{}
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, errors.Errorf("line %d: expect \"pattern weight\", got %#v", n, line)
+		}
+		if _, err := path.Match(fields[0], ""); err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+		weight, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+		rules = append(rules, Rule{Pattern: fields[0], Weight: weight})
+	}
+	return rules, scanner.Err()
+}
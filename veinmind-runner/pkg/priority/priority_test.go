@@ -0,0 +1,68 @@
+package priority
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func keys(targets []Target) []string {
+	ks := []string{}
+	for _, t := range targets {
+		ks = append(ks, t.Key)
+	}
+	return ks
+}
+
+func TestOrder(t *testing.T) {
+	targets := []Target{
+		{Key: "a", Containers: 1},
+		{Key: "b", Containers: 3},
+		{Key: "c"},
+		{Key: "d", Containers: 3},
+	}
+
+	// Targets of the same score keep their order
+	assert.Equal(t, []string{"b", "d", "a", "c"}, keys(Order(targets, Usage)))
+	assert.Equal(t, []string{"a", "b", "c", "d"}, keys(Order(targets)))
+
+	// Scores of signals are summed
+	boost := func(t Target) float64 {
+		if t.Key == "c" {
+			return 10
+		}
+		return 0
+	}
+	assert.Equal(t, []string{"c", "b", "d", "a"}, keys(Order(targets, Usage, boost)))
+
+	// Input isn't modified
+	assert.Equal(t, "a", targets[0].Key)
+}
+
+func TestRules(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`
+# critical services first
+registry.internal/payments/*  100
+nginx:*                       10
+*                             -1
+`))
+	assert.NoError(t, err)
+	assert.Len(t, rules, 3)
+
+	assert.Equal(t, 100.0, rules.Weight(Target{Key: "sha256:aa", Refs: []string{"registry.internal/payments/api:v2"}}))
+	assert.Equal(t, 10.0, rules.Weight(Target{Key: "nginx:1.21"}))
+	// Normalized references of docker hub are matched too
+	assert.Equal(t, 10.0, rules.Weight(Target{Key: "sha256:bb", Refs: []string{"docker.io/library/nginx:1.21"}}))
+	assert.Equal(t, -1.0, rules.Weight(Target{Key: "redis:7"}))
+	assert.Equal(t, 0.0, Rules{}.Weight(Target{Key: "redis:7"}))
+
+	targets := []Target{{Key: "redis:7"}, {Key: "nginx:1.21", Containers: 2}, {Key: "registry.internal/payments/api:v2"}}
+	assert.Equal(t, []string{"registry.internal/payments/api:v2", "nginx:1.21", "redis:7"}, keys(Order(targets, rules.Weight, Usage)))
+
+	_, err = ParseRules(strings.NewReader("nginx:*\n"))
+	assert.Error(t, err)
+	_, err = ParseRules(strings.NewReader("nginx:* high\n"))
+	assert.Error(t, err)
+	_, err = ParseRules(strings.NewReader("nginx[ 1\n"))
+	assert.Error(t, err)
+}
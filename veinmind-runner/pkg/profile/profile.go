@@ -0,0 +1,206 @@
+// Package profile presets flags of scan commands for common scenarios,
+// e.g. gate of CI pipelines, nightly audit of registries and triage of
+// hosts in incident response. Flags given on command line always win
+// over values of profiles
+package profile
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/scanconfig"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"sort"
+)
+
+// Sources of profiles
+const (
+	SourceBuiltin = "builtin"
+)
+
+// Values are values of a flag, a list flag is set once per value.
+// Values are given in yaml as a scalar or a sequence
+type Values []string
+
+func (v *Values) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*v = list
+		return nil
+	}
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	*v = Values{value}
+	return nil
+}
+
+// Profile is values of flags by names of flags, Source is where the
+// profile is defined
+type Profile struct {
+	Description string            `yaml:"description"`
+	Flags       map[string]Values `yaml:"flags"`
+	Source      string            `yaml:"-"`
+}
+
+// Profiles by name
+type Profiles map[string]Profile
+
+// File is profiles file, profiles of file override builtin profiles of
+// the same name flag by flag and empty values drop flags of them
+type File struct {
+	Profiles Profiles `yaml:"profiles"`
+}
+
+// plugins are first-party plugins finding risks of images
+var plugins = Values{"veinmind-malicious", "veinmind-backdoor", "veinmind-sensitive", "veinmind-weakpass", "veinmind-history"}
+
+// Builtin is profiles shipped with runner
+var Builtin = Profiles{
+	"ci": {
+		Description: "gate of CI pipelines, fails on high findings within a bounded time",
+		Flags: map[string]Values{
+			"plugins":            plugins,
+			"severity-threshold": {"high"},
+			"exit-code":          {"1"},
+			"output":             {"json=report.json", "sarif=report.sarif", "table=-"},
+			"timeout":            {"30m"},
+			"image-timeout":      {"10m"},
+			"threads":            {"5"},
+		},
+		Source: SourceBuiltin,
+	},
+	"audit": {
+		Description: "nightly audit of registries, all plugins and all findings are reported without failing",
+		Flags: map[string]Values{
+			"output":                   {"json=audit.json", "markdown=audit.md"},
+			"timeout":                  {"6h"},
+			"image-timeout":            {"30m"},
+			"threads":                  {"adaptive"},
+			"image-concurrency":        {"4"},
+			"per-registry-concurrency": {"2"},
+		},
+		Source: SourceBuiltin,
+	},
+	"ir": {
+		Description: "triage of hosts in incident response, every finding of malware and backdoors on the host is reported",
+		Flags: map[string]Values{
+			"plugins":            append(Values{"veinmind-basic"}, plugins...),
+			"severity-threshold": {"low"},
+			"output":             {"json=ir-report.json", "markdown=ir-report.md", "table=-"},
+			"image-timeout":      {"1h"},
+			"threads":            {"2"},
+		},
+		Source: SourceBuiltin,
+	},
+}
+
+// Load returns builtin profiles overridden by profiles file
+func Load(path string) (Profiles, error) {
+	profiles := Profiles{}
+	for name, p := range Builtin {
+		profiles[name] = p.copy()
+	}
+	if path == "" {
+		return profiles, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := File{}
+	if err := yaml.UnmarshalStrict(b, &file); err != nil {
+		return nil, errors.Wrapf(err, "profiles file %s", path)
+	}
+
+	for name, p := range file.Profiles {
+		merged, ok := profiles[name]
+		if !ok {
+			merged = Profile{Flags: map[string]Values{}}
+		}
+		if p.Description != "" {
+			merged.Description = p.Description
+		}
+		for flag, values := range p.Flags {
+			if flag == "profile" || flag == "profiles-file" {
+				return nil, errors.Errorf("profiles file %s: profile %s can't set --%s", path, name, flag)
+			}
+			if len(values) == 0 {
+				delete(merged.Flags, flag)
+				continue
+			}
+			merged.Flags[flag] = values
+		}
+		merged.Source = path
+		if ok {
+			merged.Source = SourceBuiltin + "," + path
+		}
+		profiles[name] = merged
+	}
+	return profiles, nil
+}
+
+func (p Profile) copy() Profile {
+	flags := map[string]Values{}
+	for name, values := range p.Flags {
+		flags[name] = append(Values(nil), values...)
+	}
+	p.Flags = flags
+	return p
+}
+
+// Get returns profile of name
+func (p Profiles) Get(name string) (Profile, error) {
+	profile, ok := p[name]
+	if !ok {
+		return Profile{}, errors.Errorf("unknown profile %#v, one of %v", name, p.Names())
+	}
+	return profile, nil
+}
+
+// Names returns names of profiles sorted
+func (p Profiles) Names() []string {
+	names := []string{}
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FlagNames returns names of flags of profile sorted
+func (p Profile) FlagNames() []string {
+	names := []string{}
+	for name := range p.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply sets flags of profile which aren't given on command line and
+// returns how profile is resolved. Flags set stay unchanged so that
+// explicit flags can still be told apart
+func (p Profile) Apply(name string, flags *pflag.FlagSet) (scanconfig.Profile, error) {
+	r := scanconfig.Profile{Name: name, Source: p.Source}
+	for _, flag := range p.FlagNames() {
+		f := flags.Lookup(flag)
+		switch {
+		case f == nil:
+			r.Unsupported = append(r.Unsupported, flag)
+			continue
+		case f.Changed:
+			r.Overridden = append(r.Overridden, flag)
+			continue
+		}
+		for _, v := range p.Flags[flag] {
+			if err := f.Value.Set(v); err != nil {
+				return scanconfig.Profile{}, errors.Wrapf(err, "profile %s: --%s %s", name, flag, v)
+			}
+		}
+		r.Applied = append(r.Applied, flag)
+	}
+	return r, nil
+}
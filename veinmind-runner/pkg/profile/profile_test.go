@@ -0,0 +1,80 @@
+package profile
+
+import (
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	profiles, err := Load("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"audit", "ci", "ir"}, profiles.Names())
+
+	profiles, err = Load("testdata/profiles.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"audit", "ci", "ir", "nightly"}, profiles.Names())
+
+	ci, err := profiles.Get("ci")
+	assert.NoError(t, err)
+	assert.Equal(t, "gate of release pipelines", ci.Description)
+	assert.Equal(t, "builtin,testdata/profiles.yaml", ci.Source)
+	assert.Equal(t, Values{"critical"}, ci.Flags["severity-threshold"])
+	assert.NotContains(t, ci.Flags, "exit-code")
+	assert.Equal(t, Values{"30m"}, ci.Flags["timeout"])
+	// Builtin profiles are left as they are
+	assert.Equal(t, Values{"high"}, Builtin["ci"].Flags["severity-threshold"])
+	assert.Contains(t, Builtin["ci"].Flags, "exit-code")
+
+	nightly, err := profiles.Get("nightly")
+	assert.NoError(t, err)
+	assert.Equal(t, "testdata/profiles.yaml", nightly.Source)
+	assert.Equal(t, Values{"json=nightly.json", "markdown=nightly.md"}, nightly.Flags["output"])
+	assert.Equal(t, Values{"adaptive"}, nightly.Flags["threads"])
+
+	_, err = profiles.Get("missing")
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("profile:\n  ci: {}\n"), 0644))
+	_, err = Load(path)
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("profiles:\n  ci:\n    flags:\n      profile: audit\n"), 0644))
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+func TestApply(t *testing.T) {
+	flags := pflag.NewFlagSet("scan-host", pflag.ContinueOnError)
+	flags.StringSlice("plugins", nil, "")
+	flags.String("severity-threshold", "", "")
+	flags.StringArray("output", []string{"table=-"}, "")
+	flags.Duration("timeout", 0, "")
+	flags.Int("threads", 5, "")
+	assert.NoError(t, flags.Parse([]string{"--severity-threshold", "critical"}))
+
+	r, err := Builtin["ci"].Apply("ci", flags)
+	assert.NoError(t, err)
+	assert.Equal(t, "ci", r.Name)
+	assert.Equal(t, SourceBuiltin, r.Source)
+	assert.Equal(t, []string{"output", "plugins", "threads", "timeout"}, r.Applied)
+	assert.Equal(t, []string{"severity-threshold"}, r.Overridden)
+	assert.Equal(t, []string{"exit-code", "image-timeout"}, r.Unsupported)
+
+	// Explicit flags win, values of profile replace defaults
+	threshold, _ := flags.GetString("severity-threshold")
+	assert.Equal(t, "critical", threshold)
+	outputs, _ := flags.GetStringArray("output")
+	assert.Equal(t, []string{"json=report.json", "sarif=report.sarif", "table=-"}, outputs)
+	timeout, _ := flags.GetDuration("timeout")
+	assert.Equal(t, 30*time.Minute, timeout)
+	assert.False(t, flags.Changed("timeout"))
+
+	invalid := Profile{Flags: map[string]Values{"threads": {"many"}}}
+	_, err = invalid.Apply("invalid", flags)
+	assert.Error(t, err)
+}
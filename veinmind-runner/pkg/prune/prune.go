@@ -0,0 +1,124 @@
+// Package prune removes local state left by runs of runner, e.g. blobs
+// cached, working directories and diagnostics bundles. Items expired
+// are listed by packages owning the state, so that they're printed
+// before anything is removed
+package prune
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of items
+const (
+	KindBlob        = "blob"
+	KindLayerCache  = "layer-cache"
+	KindWorkDir     = "work-dir"
+	KindDiagnostics = "diagnostics"
+	KindQuarantine  = "quarantine"
+	KindRootfs      = "rootfs"
+	KindImage       = "image"
+	KindHistory     = "history"
+)
+
+// Item is a file or directory to remove, Time is when it's last used
+type Item struct {
+	Kind string    `json:"kind"`
+	Path string    `json:"path"`
+	Size int64     `json:"size"`
+	Time time.Time `json:"time"`
+}
+
+// Entries lists entries of dir last modified before, entries not
+// matching match are left. Missing dir has no entries
+func Entries(kind string, dir string, before time.Time, match func(info os.FileInfo) bool) ([]Item, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	items := []Item{}
+	for _, info := range infos {
+		if match != nil && !match(info) {
+			continue
+		}
+		p := filepath.Join(dir, info.Name())
+		size, last := Usage(p)
+		if last.IsZero() || !last.Before(before) {
+			continue
+		}
+		items = append(items, Item{Kind: kind, Path: p, Size: size, Time: last})
+	}
+	return items, nil
+}
+
+// Usage returns total size of regular files under p and when p or any
+// file under it is last modified
+func Usage(p string) (int64, time.Time) {
+	var (
+		size int64
+		last time.Time
+	)
+	_ = filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+		return nil
+	})
+	return size, last
+}
+
+// Prefixed matches entries whose names have prefix
+func Prefixed(prefix string) func(info os.FileInfo) bool {
+	return func(info os.FileInfo) bool {
+		return strings.HasPrefix(info.Name(), prefix)
+	}
+}
+
+// Remove removes files and directories of items, bytes freed are
+// returned. Items already gone are skipped
+func Remove(items []Item) (int64, error) {
+	var freed int64
+	for _, item := range items {
+		if _, err := os.Lstat(item.Path); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.RemoveAll(item.Path); err != nil {
+			return freed, err
+		}
+		freed += item.Size
+	}
+	return freed, nil
+}
+
+// Sort sorts items by kind and then by time, the oldest first
+func Sort(items []Item) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Kind != items[j].Kind {
+			return items[i].Kind < items[j].Kind
+		}
+		return items[i].Time.Before(items[j].Time)
+	})
+}
+
+// Total returns total size of items
+func Total(items []Item) int64 {
+	var total int64
+	for _, item := range items {
+		total += item.Size
+	}
+	return total
+}
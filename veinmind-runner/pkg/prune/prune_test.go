@@ -0,0 +1,72 @@
+package prune
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// touch writes file of size at p last modified at t
+func touch(t *testing.T, p string, size int, mtime time.Time) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	require.NoError(t, ioutil.WriteFile(p, make([]byte, size), 0644))
+	require.NoError(t, os.Chtimes(p, mtime, mtime))
+}
+
+func TestEntries(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	old := now.Add(-10 * 24 * time.Hour)
+	touch(t, filepath.Join(dir, "old"), 3, old)
+	touch(t, filepath.Join(dir, "new"), 5, now)
+	touch(t, filepath.Join(dir, "veinmind-work-a", "out"), 7, old)
+	touch(t, filepath.Join(dir, "veinmind-work-b", "out"), 11, old)
+	touch(t, filepath.Join(dir, "veinmind-work-b", "recent"), 1, now)
+	for _, d := range []string{"veinmind-work-a", "veinmind-work-b"} {
+		require.NoError(t, os.Chtimes(filepath.Join(dir, d), old, old))
+	}
+	before := now.Add(-24 * time.Hour)
+
+	items, err := Entries(KindWorkDir, dir, before, Prefixed("veinmind-work-"))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, Item{Kind: KindWorkDir, Path: filepath.Join(dir, "veinmind-work-a"), Size: 7, Time: items[0].Time}, items[0])
+	assert.True(t, items[0].Time.Equal(old))
+
+	items, err = Entries(KindBlob, dir, before, func(info os.FileInfo) bool { return info.Mode().IsRegular() })
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, filepath.Join(dir, "old"), items[0].Path)
+
+	items, err = Entries(KindBlob, filepath.Join(dir, "missing"), now, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+}
+
+func TestRemove(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	touch(t, filepath.Join(dir, "a", "b"), 3, now)
+	touch(t, filepath.Join(dir, "c"), 5, now)
+
+	items := []Item{
+		{Kind: KindBlob, Path: filepath.Join(dir, "c"), Size: 5, Time: now},
+		{Kind: KindWorkDir, Path: filepath.Join(dir, "a"), Size: 3, Time: now.Add(-time.Hour)},
+		{Kind: KindBlob, Path: filepath.Join(dir, "gone"), Size: 13, Time: now.Add(-time.Hour)},
+	}
+	assert.Equal(t, int64(21), Total(items))
+	Sort(items)
+	assert.Equal(t, []string{filepath.Join(dir, "gone"), filepath.Join(dir, "c"), filepath.Join(dir, "a")},
+		[]string{items[0].Path, items[1].Path, items[2].Path})
+
+	freed, err := Remove(items)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), freed)
+	infos, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, infos)
+}
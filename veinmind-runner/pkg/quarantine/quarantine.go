@@ -0,0 +1,144 @@
+// Package quarantine preserves copies of flagged files under
+// <dir>/<image digest>/<sha256> for forensics
+package quarantine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/prune"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var digestRegexp = regexp.MustCompile(`^(sha256:)?[a-f0-9]{64}$`)
+
+var (
+	ErrFileTooLarge  = errors.New("quarantine: file exceeds size limit")
+	ErrQuotaExceeded = errors.New("quarantine: directory quota exceeded")
+)
+
+// Metadata is written next to quarantined file as <sha256>.json
+type Metadata struct {
+	ImageID string    `json:"image_id"`
+	Path    string    `json:"path"`
+	Plugin  string    `json:"plugin"`
+	EventID string    `json:"event_id,omitempty"`
+	SHA256  string    `json:"sha256"`
+	Size    int64     `json:"size"`
+	Time    time.Time `json:"time"`
+}
+
+type Store struct {
+	dir         string
+	maxFileSize int64
+	quota       int64
+	mu          sync.Mutex
+	used        int64
+}
+
+// NewStore creates store under dir, files larger than maxFileSize or
+// exceeding quota of dir are refused, zero means unlimited
+func NewStore(dir string, maxFileSize int64, quota int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		dir:         dir,
+		maxFileSize: maxFileSize,
+		quota:       quota,
+	}
+
+	// Files quarantined by previous runs count towards quota
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			s.used += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Put stores content and its metadata, path of the artifact relative
+// to store directory is returned
+func (s *Store) Put(meta Metadata, content []byte) (string, error) {
+	size := int64(len(content))
+	if s.maxFileSize > 0 && size > s.maxFileSize {
+		return "", errors.Wrapf(ErrFileTooLarge, "%#v is %d bytes", meta.Path, size)
+	}
+
+	sum := sha256.Sum256(content)
+	meta.SHA256 = hex.EncodeToString(sum[:])
+	meta.Size = size
+	if meta.Time.IsZero() {
+		meta.Time = time.Now()
+	}
+
+	metaBytes, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	rel := filepath.Join(imageDir(meta.ImageID), meta.SHA256)
+	target := filepath.Join(s.dir, rel)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Same content of the same image is quarantined once
+	if _, err := os.Stat(target); err == nil {
+		return rel, nil
+	}
+
+	total := size + int64(len(metaBytes))
+	if s.quota > 0 && s.used+total > s.quota {
+		return "", errors.Wrapf(ErrQuotaExceeded, "%#v needs %d bytes", meta.Path, total)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(target+".json", metaBytes, 0600); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(target, content, 0600); err != nil {
+		_ = os.Remove(target + ".json")
+		return "", err
+	}
+	s.used += total
+
+	return rel, nil
+}
+
+// imageDir returns directory name of image, ids which aren't digests
+// are hashed so that they can't escape store directory
+func imageDir(id string) string {
+	if digestRegexp.MatchString(id) {
+		return strings.TrimPrefix(id, "sha256:")
+	}
+
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// Expired lists directories of images under dir whose files are all
+// quarantined before
+func Expired(dir string, before time.Time) ([]prune.Item, error) {
+	return prune.Entries(prune.KindQuarantine, dir, before, func(info os.FileInfo) bool {
+		return info.IsDir()
+	})
+}
@@ -0,0 +1,93 @@
+package quarantine
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quarantine")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewStore(dir, 16, 0)
+	assert.NoError(t, err)
+
+	id := "sha256:" + strings.Repeat("a", 64)
+	rel, err := s.Put(Metadata{ImageID: id, Path: "/bin/miner", Plugin: "veinmind-malicious"}, []byte("miner"))
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("a", 64), filepath.Dir(rel))
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, rel))
+	assert.NoError(t, err)
+	assert.Equal(t, "miner", string(content))
+
+	metaBytes, err := ioutil.ReadFile(filepath.Join(dir, rel+".json"))
+	assert.NoError(t, err)
+	meta := Metadata{}
+	assert.NoError(t, json.Unmarshal(metaBytes, &meta))
+	assert.Equal(t, "/bin/miner", meta.Path)
+	assert.Equal(t, "veinmind-malicious", meta.Plugin)
+	assert.Equal(t, int64(5), meta.Size)
+
+	// Same content is stored once
+	again, err := s.Put(Metadata{ImageID: id, Path: "/usr/bin/miner"}, []byte("miner"))
+	assert.NoError(t, err)
+	assert.Equal(t, rel, again)
+
+	_, err = s.Put(Metadata{ImageID: id, Path: "/bin/large"}, []byte(strings.Repeat("x", 17)))
+	assert.True(t, errors.Is(err, ErrFileTooLarge))
+
+	// Image id can't escape store directory
+	rel, err = s.Put(Metadata{ImageID: "../../etc", Path: "/bin/miner"}, []byte("miner"))
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(rel, ".."))
+}
+
+func TestQuota(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quarantine")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewStore(dir, 0, 512)
+	assert.NoError(t, err)
+
+	_, err = s.Put(Metadata{ImageID: "image", Path: "/a"}, []byte(strings.Repeat("a", 200)))
+	assert.NoError(t, err)
+
+	_, err = s.Put(Metadata{ImageID: "image", Path: "/b"}, []byte(strings.Repeat("b", 200)))
+	assert.True(t, errors.Is(err, ErrQuotaExceeded))
+
+	// Usage of previous runs counts towards quota
+	s, err = NewStore(dir, 0, 512)
+	assert.NoError(t, err)
+	_, err = s.Put(Metadata{ImageID: "image", Path: "/b"}, []byte(strings.Repeat("b", 200)))
+	assert.True(t, errors.Is(err, ErrQuotaExceeded))
+}
+
+func TestExpired(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(dir, 0, 0)
+	assert.NoError(t, err)
+
+	past := time.Now().Add(-48 * time.Hour)
+	old, err := s.Put(Metadata{ImageID: "sha256:" + strings.Repeat("a", 64), Path: "/bin/miner", Time: past}, []byte("miner"))
+	assert.NoError(t, err)
+	_, err = s.Put(Metadata{ImageID: "sha256:" + strings.Repeat("b", 64), Path: "/bin/miner"}, []byte("miner"))
+	assert.NoError(t, err)
+	for _, p := range []string{filepath.Join(dir, old), filepath.Join(dir, old+".json"), filepath.Join(dir, filepath.Dir(old))} {
+		assert.NoError(t, os.Chtimes(p, past, past))
+	}
+
+	items, err := Expired(dir, time.Now().Add(-24*time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, filepath.Join(dir, strings.Repeat("a", 64)), items[0].Path)
+}
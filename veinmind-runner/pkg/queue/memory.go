@@ -0,0 +1,166 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process queue, it's useful for tests and single
+// host setups only
+type Memory struct {
+	opts     Options
+	mu       sync.Mutex
+	jobs     map[string]Job
+	pending  []string
+	inFlight map[string]time.Time
+	failed   []Job
+	results  []Result
+	notify   chan struct{}
+}
+
+func NewMemory(opts Options) *Memory {
+	return &Memory{
+		opts:     opts,
+		jobs:     map[string]Job{},
+		inFlight: map[string]time.Time{},
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+func (m *Memory) Push(ctx context.Context, job Job) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.jobs[job.Key]; ok {
+		return false, nil
+	}
+	m.jobs[job.Key] = job
+	m.pending = append(m.pending, job.Key)
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+	return true, nil
+}
+
+func (m *Memory) Pop(ctx context.Context, wait time.Duration) (*Job, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		m.mu.Lock()
+		if len(m.pending) > 0 {
+			key := m.pending[0]
+			m.pending = m.pending[1:]
+			m.inFlight[key] = time.Now().Add(m.opts.VisibilityTimeout)
+			job := m.jobs[key]
+			m.mu.Unlock()
+			return &job, nil
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-m.notify:
+		case <-timer.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (m *Memory) Touch(ctx context.Context, job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.inFlight[job.Key]; ok {
+		m.inFlight[job.Key] = time.Now().Add(m.opts.VisibilityTimeout)
+	}
+	return nil
+}
+
+func (m *Memory) Ack(ctx context.Context, job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.inFlight[job.Key]; ok {
+		delete(m.inFlight, job.Key)
+		delete(m.jobs, job.Key)
+	}
+	return nil
+}
+
+func (m *Memory) Nack(ctx context.Context, job Job, cause error) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.inFlight[job.Key]; !ok {
+		return false, nil
+	}
+	delete(m.inFlight, job.Key)
+
+	failed := retry(&job, cause, m.opts.MaxAttempts)
+	if failed {
+		delete(m.jobs, job.Key)
+		m.failed = append(m.failed, job)
+	} else {
+		m.jobs[job.Key] = job
+		m.pending = append(m.pending, job.Key)
+	}
+	return failed, nil
+}
+
+func (m *Memory) Requeue(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	var expired []Job
+	for key, deadline := range m.inFlight {
+		if time.Now().After(deadline) {
+			expired = append(expired, m.jobs[key])
+		}
+	}
+	m.mu.Unlock()
+
+	for _, job := range expired {
+		if _, err := m.Nack(ctx, job, ErrVisibilityTimeout); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
+
+func (m *Memory) Stats(ctx context.Context) (Stats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return Stats{
+		Pending:  int64(len(m.pending)),
+		InFlight: int64(len(m.inFlight)),
+		Failed:   int64(len(m.failed)),
+		Results:  int64(len(m.results)),
+	}, nil
+}
+
+func (m *Memory) PushResult(ctx context.Context, r Result) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.results = append(m.results, r)
+	return nil
+}
+
+func (m *Memory) PopResult(ctx context.Context) (*Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.results) == 0 {
+		return nil, nil
+	}
+	r := m.results[0]
+	m.results = m.results[1:]
+	return &r, nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
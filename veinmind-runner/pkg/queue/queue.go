@@ -0,0 +1,107 @@
+// Package queue distributes scan jobs among workers, jobs in flight
+// return to the queue when their visibility timeout expires so that
+// crashed workers don't lose jobs
+package queue
+
+import (
+	"context"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"net/url"
+	"time"
+)
+
+var ErrVisibilityTimeout = errors.New("visibility timeout exceeded")
+
+// Job scans an image reference, jobs with the same key are coalesced
+// while pending or in flight
+type Job struct {
+	// Key is digest of the image when it's resolved, otherwise the reference
+	Key      string    `json:"key"`
+	Ref      string    `json:"ref"`
+	Runtime  string    `json:"runtime"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error,omitempty"`
+	Enqueued time.Time `json:"enqueued"`
+}
+
+// Result is pushed by workers when no other sink is configured
+type Result struct {
+	Job    Job             `json:"job"`
+	Worker string          `json:"worker"`
+	Time   time.Time       `json:"time"`
+	Report reporter.Report `json:"report"`
+}
+
+type Stats struct {
+	Pending  int64 `json:"pending"`
+	InFlight int64 `json:"in_flight"`
+	Failed   int64 `json:"failed"`
+	Results  int64 `json:"results"`
+}
+
+type Options struct {
+	// VisibilityTimeout is how long a popped job is invisible to other
+	// workers before it's touched, acked or nacked
+	VisibilityTimeout time.Duration
+	// MaxAttempts is number of attempts before a job is failed
+	MaxAttempts int
+}
+
+type Queue interface {
+	// Push adds job to the queue, false is returned if job is coalesced
+	// with a pending or in flight job of the same key
+	Push(ctx context.Context, job Job) (bool, error)
+	// Pop takes a pending job and marks it in flight, nil is returned
+	// if no job is pending in wait
+	Pop(ctx context.Context, wait time.Duration) (*Job, error)
+	// Touch extends visibility timeout of job in flight
+	Touch(ctx context.Context, job Job) error
+	// Ack removes job in flight after it's done
+	Ack(ctx context.Context, job Job) error
+	// Nack returns job in flight to the queue, or moves it to failed
+	// jobs when attempts are exhausted
+	Nack(ctx context.Context, job Job, cause error) (failed bool, err error)
+	// Requeue nacks jobs whose visibility timeout expired
+	Requeue(ctx context.Context) (int, error)
+	Stats(ctx context.Context) (Stats, error)
+	PushResult(ctx context.Context, r Result) error
+	// PopResult takes the oldest result, nil is returned if no result
+	PopResult(ctx context.Context) (*Result, error)
+	Close() error
+}
+
+// Open opens queue of url, redis://[:password@]host:port[/db] and
+// memory:// are supported, prefix namespaces keys of redis
+func Open(rawurl string, prefix string, opts Options) (Queue, error) {
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = 30 * time.Minute
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 3
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse queue url")
+	}
+
+	switch u.Scheme {
+	case "redis":
+		return NewRedis(u, prefix, opts)
+	case "memory":
+		return NewMemory(opts), nil
+	default:
+		return nil, errors.Errorf("unsupported queue: %#v", u.Scheme)
+	}
+}
+
+// retry records failed attempt of job and reports whether attempts
+// are exhausted
+func retry(job *Job, cause error, maxAttempts int) bool {
+	job.Attempts++
+	if cause != nil {
+		job.Error = cause.Error()
+	}
+	return job.Attempts >= maxAttempts
+}
@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryCoalesce(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemory(Options{VisibilityTimeout: time.Minute, MaxAttempts: 2})
+
+	ok, err := q.Push(ctx, Job{Key: "sha256:aa", Ref: "nginx:1"})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = q.Push(ctx, Job{Key: "sha256:aa", Ref: "nginx:latest"})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	job, err := q.Pop(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "nginx:1", job.Ref)
+
+	// In flight jobs are coalesced as well
+	ok, _ = q.Push(ctx, Job{Key: "sha256:aa"})
+	assert.False(t, ok)
+
+	assert.NoError(t, q.Ack(ctx, *job))
+	ok, _ = q.Push(ctx, Job{Key: "sha256:aa"})
+	assert.True(t, ok)
+}
+
+func TestMemoryRetry(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemory(Options{VisibilityTimeout: time.Minute, MaxAttempts: 2})
+	_, err := q.Push(ctx, Job{Key: "sha256:aa"})
+	assert.NoError(t, err)
+
+	job, _ := q.Pop(ctx, 0)
+	failed, err := q.Nack(ctx, *job, errors.New("pull error"))
+	assert.NoError(t, err)
+	assert.False(t, failed)
+
+	job, _ = q.Pop(ctx, 0)
+	assert.Equal(t, 1, job.Attempts)
+	assert.Equal(t, "pull error", job.Error)
+	failed, err = q.Nack(ctx, *job, errors.New("pull error"))
+	assert.NoError(t, err)
+	assert.True(t, failed)
+
+	stats, _ := q.Stats(ctx)
+	assert.Equal(t, Stats{Failed: 1}, stats)
+
+	// Failed jobs don't block enqueueing again
+	ok, _ := q.Push(ctx, Job{Key: "sha256:aa"})
+	assert.True(t, ok)
+}
+
+func TestMemoryRequeue(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemory(Options{VisibilityTimeout: 10 * time.Millisecond, MaxAttempts: 3})
+	_, err := q.Push(ctx, Job{Key: "sha256:aa"})
+	assert.NoError(t, err)
+
+	job, _ := q.Pop(ctx, 0)
+	assert.NotNil(t, job)
+	n, _ := q.Requeue(ctx)
+	assert.Equal(t, 0, n)
+
+	// The worker crashed without touching the job
+	time.Sleep(20 * time.Millisecond)
+	n, _ = q.Requeue(ctx)
+	assert.Equal(t, 1, n)
+
+	job, _ = q.Pop(ctx, 0)
+	assert.Equal(t, ErrVisibilityTimeout.Error(), job.Error)
+
+	// Nacks of acked jobs are ignored
+	assert.NoError(t, q.Ack(ctx, *job))
+	failed, err := q.Nack(ctx, *job, nil)
+	assert.NoError(t, err)
+	assert.False(t, failed)
+	stats, _ := q.Stats(ctx)
+	assert.Equal(t, Stats{}, stats)
+}
+
+func TestMemoryPopWait(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemory(Options{VisibilityTimeout: time.Minute, MaxAttempts: 3})
+
+	job, err := q.Pop(ctx, 10*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Nil(t, job)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Push(ctx, Job{Key: "sha256:aa"})
+	}()
+	job, err = q.Pop(ctx, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:aa", job.Key)
+}
+
+func TestRESP(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, writeCommand(bufio.NewWriter(buf), "LPUSH", "k", ""))
+	assert.Equal(t, "*3\r\n$5\r\nLPUSH\r\n$1\r\nk\r\n$0\r\n\r\n", buf.String())
+
+	for _, c := range []struct {
+		reply string
+		value interface{}
+	}{
+		{"+OK\r\n", "OK"},
+		{":42\r\n", int64(42)},
+		{"$5\r\na\r\nbc\r\n", "a\r\nbc"},
+		{"$-1\r\n", nil},
+		{"*-1\r\n", nil},
+		{"*2\r\n$1\r\na\r\n:1\r\n", []interface{}{"a", int64(1)}},
+	} {
+		v, err := readReply(bufio.NewReader(strings.NewReader(c.reply)))
+		assert.NoError(t, err, c.reply)
+		assert.Equal(t, c.value, v, c.reply)
+	}
+
+	_, err := readReply(bufio.NewReader(strings.NewReader("-ERR unknown command\r\n")))
+	assert.Equal(t, redisError("ERR unknown command"), err)
+	_, err = readReply(bufio.NewReader(strings.NewReader("?\r\n")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,323 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scripts keep state transitions of jobs atomic
+const (
+	// KEYS: jobs, pending; ARGV: key, job
+	pushScript = `if redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2]) == 0 then return 0 end
+redis.call('LPUSH', KEYS[2], ARGV[1])
+return 1`
+	// KEYS: pending, in flight, jobs; ARGV: deadline
+	popScript = `local key = redis.call('RPOP', KEYS[1])
+if not key then return false end
+redis.call('ZADD', KEYS[2], ARGV[1], key)
+return redis.call('HGET', KEYS[3], key)`
+	// KEYS: in flight; ARGV: key, deadline
+	touchScript = `if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then return 0 end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1`
+	// KEYS: in flight, jobs; ARGV: key
+	ackScript = `if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then return 0 end
+redis.call('HDEL', KEYS[2], ARGV[1])
+return 1`
+	// KEYS: in flight, jobs, pending, failed; ARGV: key, job, failed
+	nackScript = `if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then return 0 end
+if ARGV[3] == '1' then
+  redis.call('HDEL', KEYS[2], ARGV[1])
+  redis.call('LPUSH', KEYS[4], ARGV[2])
+else
+  redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+  redis.call('LPUSH', KEYS[3], ARGV[1])
+end
+return 1`
+)
+
+// popInterval is interval to poll pending jobs, scripts can't block
+const popInterval = time.Second
+
+// Redis keeps jobs in keys prefixed by prefix: a hash of jobs, a list
+// of pending keys, a sorted set of in flight keys scored by deadline,
+// a list of failed jobs and a list of results
+type Redis struct {
+	addr     string
+	password string
+	db       string
+	prefix   string
+	opts     Options
+	idle     chan *redisConn
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+func NewRedis(u *url.URL, prefix string, opts Options) (*Redis, error) {
+	if prefix == "" {
+		prefix = "veinmind"
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	password, _ := u.User.Password()
+	db := strings.Trim(u.Path, "/")
+	if db != "" {
+		if _, err := strconv.Atoi(db); err != nil {
+			return nil, errors.Errorf("invalid redis db: %#v", db)
+		}
+	}
+
+	q := &Redis{
+		addr:     addr,
+		password: password,
+		db:       db,
+		prefix:   prefix,
+		opts:     opts,
+		idle:     make(chan *redisConn, 4),
+	}
+
+	// Fail early when redis is unreachable
+	if _, err := q.do(context.Background(), "PING"); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *Redis) key(name string) string {
+	return q.prefix + ":" + name
+}
+
+func (q *Redis) dial(ctx context.Context) (*redisConn, error) {
+	d := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := d.DialContext(ctx, "tcp", q.addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "dial redis")
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+
+	if q.password != "" {
+		if _, err := c.do("AUTH", q.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if q.db != "" {
+		if _, err := c.do("SELECT", q.db); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(30 * time.Second))
+	if err := writeCommand(c.w, args...); err != nil {
+		return nil, err
+	}
+	return readReply(c.r)
+}
+
+// do runs command on an idle connection, connections broken by i/o
+// errors are dropped
+func (q *Redis) do(ctx context.Context, args ...string) (interface{}, error) {
+	var c *redisConn
+	select {
+	case c = <-q.idle:
+	default:
+		var err error
+		if c, err = q.dial(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := c.do(args...)
+	if _, ok := err.(redisError); err != nil && !ok {
+		c.conn.Close()
+		return nil, err
+	}
+
+	select {
+	case q.idle <- c:
+	default:
+		c.conn.Close()
+	}
+	return reply, err
+}
+
+func (q *Redis) eval(ctx context.Context, script string, keys []string, args ...string) (interface{}, error) {
+	cmd := append([]string{"EVAL", script, strconv.Itoa(len(keys))}, keys...)
+	return q.do(ctx, append(cmd, args...)...)
+}
+
+func (q *Redis) deadline() string {
+	return strconv.FormatInt(time.Now().Add(q.opts.VisibilityTimeout).Unix(), 10)
+}
+
+func (q *Redis) Push(ctx context.Context, job Job) (bool, error) {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return false, err
+	}
+
+	reply, err := q.eval(ctx, pushScript, []string{q.key("jobs"), q.key("pending")}, job.Key, string(b))
+	if err != nil {
+		return false, err
+	}
+	return reply == int64(1), nil
+}
+
+func (q *Redis) Pop(ctx context.Context, wait time.Duration) (*Job, error) {
+	timeout := time.Now().Add(wait)
+	for {
+		reply, err := q.eval(ctx, popScript, []string{q.key("pending"), q.key("inflight"), q.key("jobs")}, q.deadline())
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := reply.(string); ok {
+			job := Job{}
+			if err := json.Unmarshal([]byte(s), &job); err != nil {
+				return nil, errors.Wrap(err, "decode job")
+			}
+			return &job, nil
+		}
+
+		if time.Now().After(timeout) {
+			return nil, nil
+		}
+		select {
+		case <-time.After(popInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (q *Redis) Touch(ctx context.Context, job Job) error {
+	_, err := q.eval(ctx, touchScript, []string{q.key("inflight")}, job.Key, q.deadline())
+	return err
+}
+
+func (q *Redis) Ack(ctx context.Context, job Job) error {
+	_, err := q.eval(ctx, ackScript, []string{q.key("inflight"), q.key("jobs")}, job.Key)
+	return err
+}
+
+func (q *Redis) Nack(ctx context.Context, job Job, cause error) (bool, error) {
+	failed := retry(&job, cause, q.opts.MaxAttempts)
+	b, err := json.Marshal(job)
+	if err != nil {
+		return false, err
+	}
+
+	flag := "0"
+	if failed {
+		flag = "1"
+	}
+	reply, err := q.eval(ctx, nackScript,
+		[]string{q.key("inflight"), q.key("jobs"), q.key("pending"), q.key("failed")},
+		job.Key, string(b), flag)
+	if err != nil {
+		return false, err
+	}
+	return failed && reply == int64(1), nil
+}
+
+func (q *Redis) Requeue(ctx context.Context) (int, error) {
+	reply, err := q.do(ctx, "ZRANGEBYSCORE", q.key("inflight"), "-inf", strconv.FormatInt(time.Now().Unix(), 10))
+	if err != nil {
+		return 0, err
+	}
+	keys, _ := reply.([]interface{})
+
+	n := 0
+	for _, key := range keys {
+		key, _ := key.(string)
+		reply, err := q.do(ctx, "HGET", q.key("jobs"), key)
+		if err != nil {
+			return n, err
+		}
+		job := Job{Key: key}
+		if s, ok := reply.(string); ok {
+			if err := json.Unmarshal([]byte(s), &job); err != nil {
+				return n, errors.Wrap(err, "decode job")
+			}
+		}
+		if _, err := q.Nack(ctx, job, ErrVisibilityTimeout); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (q *Redis) Stats(ctx context.Context) (Stats, error) {
+	stats := Stats{}
+	for _, c := range []struct {
+		cmd   string
+		key   string
+		value *int64
+	}{
+		{"LLEN", "pending", &stats.Pending},
+		{"ZCARD", "inflight", &stats.InFlight},
+		{"LLEN", "failed", &stats.Failed},
+		{"LLEN", "results", &stats.Results},
+	} {
+		reply, err := q.do(ctx, c.cmd, q.key(c.key))
+		if err != nil {
+			return stats, err
+		}
+		*c.value, _ = reply.(int64)
+	}
+	return stats, nil
+}
+
+func (q *Redis) PushResult(ctx context.Context, r Result) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = q.do(ctx, "LPUSH", q.key("results"), string(b))
+	return err
+}
+
+func (q *Redis) PopResult(ctx context.Context) (*Result, error) {
+	reply, err := q.do(ctx, "RPOP", q.key("results"))
+	if err != nil {
+		return nil, err
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return nil, nil
+	}
+
+	r := Result{}
+	if err := json.Unmarshal([]byte(s), &r); err != nil {
+		return nil, errors.Wrap(err, "decode result")
+	}
+	return &r, nil
+}
+
+func (q *Redis) Close() error {
+	for {
+		select {
+		case c := <-q.idle:
+			c.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
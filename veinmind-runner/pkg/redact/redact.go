@@ -0,0 +1,278 @@
+// Package redact redacts reports before they're shared outside, by
+// rules replacing patterns in fields, dropping fields and hashing paths
+// of files. Fingerprints, levels and events are kept as they are, so
+// redacted reports still validate against the schema and diff against
+// baselines of the unredacted ones
+package redact
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces values of dropped fields
+const Redacted = reporter.RedactedValue
+
+// HashedPrefix prefixes hashes of paths of files
+const HashedPrefix = reporter.RedactedPathPrefix
+
+// Replacement replaces matches of Pattern by Replacement, which may
+// refer to groups of Pattern as in regexp, e.g. $1. Fields are fields
+// it applies to, all fields if empty
+type Replacement struct {
+	Pattern     string   `yaml:"pattern"`
+	Replacement string   `yaml:"replacement"`
+	Fields      []string `yaml:"fields"`
+}
+
+// Rules of redaction. Fields are paths of json names from the root of
+// report without indexes of arrays, e.g. events.image_refs, a path
+// covers fields under it. Drop are fields whose values are replaced by
+// Redacted, or emptied if they aren't strings. HashPaths replaces
+// paths of files by their hashes salted by Salt, the same path gets the
+// same hash so that findings of redacted reports can still be told apart
+type Rules struct {
+	Replace   []Replacement `yaml:"replace"`
+	Drop      []string      `yaml:"drop"`
+	HashPaths bool          `yaml:"hash_paths"`
+	Salt      string        `yaml:"salt"`
+}
+
+// Default is rules of secrets found by first-party plugins and paths of
+// files, registry credentials in references are replaced
+var Default = Rules{
+	Replace: []Replacement{
+		{Pattern: `://[^/@\s]+@`, Replacement: "://" + Redacted + "@"},
+	},
+	Drop: []string{
+		"events.alert_details.weakpass_detail.password",
+		"events.alert_details.sensitive_env_detail.value",
+		"events.alert_details.history_detail.content",
+		"events.alert_details.basic_detail.env",
+		"metadata.build_histories",
+	},
+	HashPaths: true,
+}
+
+// Protected are fields never redacted, which identify findings and
+// their severities
+var Protected = []string{
+	"schema_version",
+	"fingerprint_version",
+	"events.id",
+	"events.time",
+	"events.level",
+	"events.detect_type",
+	"events.event_type",
+	"events.alert_type",
+	"events.fingerprint",
+}
+
+// pathFields are names of fields holding paths of files
+var pathFields = map[string]bool{
+	"path":       true,
+	"file_path":  true,
+	"quarantine": true,
+	"artifacts":  true,
+}
+
+// Load parses rules file
+func Load(name string) (Rules, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return Rules{}, err
+	}
+
+	rules := Rules{}
+	if err := yaml.UnmarshalStrict(b, &rules); err != nil {
+		return Rules{}, errors.Wrapf(err, "redact rules %s", name)
+	}
+	return rules, nil
+}
+
+// Stat is number of values redacted by each kind of rules
+type Stat struct {
+	Replaced int
+	Dropped  int
+	Hashed   int
+}
+
+type replacement struct {
+	Replacement
+	pattern *regexp.Regexp
+}
+
+// Redactor redacts reports by rules
+type Redactor struct {
+	rules   Rules
+	replace []replacement
+	stat    Stat
+}
+
+// New compiles rules, fields which are protected can't be redacted
+func New(rules Rules) (*Redactor, error) {
+	r := &Redactor{rules: rules}
+	for i, rep := range rules.Replace {
+		p, err := regexp.Compile(rep.Pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "redact replacement %d", i)
+		}
+		if err := checkFields(rep.Fields); err != nil {
+			return nil, errors.Wrapf(err, "redact replacement %d", i)
+		}
+		r.replace = append(r.replace, replacement{Replacement: rep, pattern: p})
+	}
+	if err := checkFields(rules.Drop); err != nil {
+		return nil, errors.Wrap(err, "redact drop")
+	}
+	return r, nil
+}
+
+func checkFields(fields []string) error {
+	for _, f := range fields {
+		if f == "" {
+			return errors.New("empty field")
+		}
+		for _, p := range Protected {
+			if covers(f, p) {
+				return errors.Errorf("field %#v covers protected field %s", f, p)
+			}
+		}
+	}
+	return nil
+}
+
+// covers tells if field is under path
+func covers(path string, field string) bool {
+	return field == path || strings.HasPrefix(field, path+".")
+}
+
+func coveredBy(paths []string, field string) bool {
+	for _, p := range paths {
+		if covers(p, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns redacted copy of doc, which is validated against
+// schema of its version
+func (r *Redactor) Redact(doc reporter.Report) (reporter.Report, error) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return reporter.Report{}, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return reporter.Report{}, err
+	}
+
+	v = r.value(v, "", "")
+	if b, err = json.Marshal(v); err != nil {
+		return reporter.Report{}, err
+	}
+	violations, err := reporter.Validate(b)
+	if err != nil {
+		return reporter.Report{}, err
+	}
+	if len(violations) > 0 {
+		return reporter.Report{}, errors.Errorf("redacted report violates schema: %s", violations[0])
+	}
+	redacted, err := reporter.Parse(b)
+	if err != nil {
+		return reporter.Report{}, errors.Wrap(err, "redacted report")
+	}
+	return *redacted, nil
+}
+
+// Stat returns values redacted so far
+func (r *Redactor) Stat() Stat {
+	return r.stat
+}
+
+// value redacts v of field, name is json name of the field
+func (r *Redactor) value(v interface{}, field string, name string) interface{} {
+	if coveredBy(Protected, field) {
+		return v
+	}
+	if coveredBy(r.rules.Drop, field) {
+		return r.drop(v)
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			f := k
+			if field != "" {
+				f = field + "." + k
+			}
+			v[k] = r.value(e, f, k)
+		}
+		return v
+	case []interface{}:
+		for i, e := range v {
+			v[i] = r.value(e, field, name)
+		}
+		return v
+	case string:
+		for _, rep := range r.replace {
+			if len(rep.Fields) > 0 && !coveredBy(rep.Fields, field) {
+				continue
+			}
+			if replaced := rep.pattern.ReplaceAllString(v, rep.Replacement.Replacement); replaced != v {
+				v = replaced
+				r.stat.Replaced++
+			}
+		}
+		if r.rules.HashPaths && pathFields[name] && v != "" {
+			v = r.hash(v)
+		}
+		return v
+	}
+	return v
+}
+
+// drop empties v keeping its type, objects keep their fields so that
+// fields required by schema are still there
+func (r *Redactor) drop(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = r.drop(e)
+		}
+		return v
+	case []interface{}:
+		if len(v) > 0 {
+			r.stat.Dropped++
+		}
+		return []interface{}{}
+	case string:
+		if v == "" {
+			return v
+		}
+		r.stat.Dropped++
+		return Redacted
+	case json.Number:
+		return json.Number("0")
+	case bool:
+		return false
+	}
+	return v
+}
+
+func (r *Redactor) hash(path string) string {
+	r.stat.Hashed++
+	sum := sha256.Sum256([]byte(r.rules.Salt + path))
+	return HashedPrefix + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,141 @@
+package registry
+
+import (
+	"fmt"
+	"github.com/distribution/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"path"
+	"strings"
+)
+
+// ArtifactTagPatterns are tags of cosign signatures, attestations and
+// attachments, which are known to be non-image artifacts without
+// fetching their manifests
+var ArtifactTagPatterns = []string{"*.sig", "*.att", "*.sbom"}
+
+// ArtifactError is returned for references of non-image artifacts,
+// e.g. signatures, SBOM attachments or helm charts, which can't be
+// scanned as images
+type ArtifactError struct {
+	Ref    string
+	Reason string
+}
+
+func (e *ArtifactError) Error() string {
+	return fmt.Sprintf("%s is a non-image artifact: %s", e.Ref, e.Reason)
+}
+
+// ArtifactChecker detects non-image artifacts before pulling, it's
+// implemented by clients which access registry directly
+type ArtifactChecker interface {
+	CheckArtifact(ref string) error
+}
+
+// ArtifactTag returns the pattern tag of ref matches if it's tag of a
+// non-image artifact
+func ArtifactTag(ref string) (string, bool) {
+	r, err := reference.Parse(ref)
+	if err != nil {
+		return "", false
+	}
+	tagged, ok := r.(reference.Tagged)
+	if !ok {
+		return "", false
+	}
+
+	for _, p := range ArtifactTagPatterns {
+		if ok, _ := path.Match(p, tagged.Tag()); ok {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// ManifestArtifact returns reason if manifest isn't of a runnable
+// image, whose config is image config and whose layers are all
+// filesystem layers
+func ManifestArtifact(m *v1.Manifest) (string, bool) {
+	switch m.Config.MediaType {
+	case types.DockerConfigJSON, types.OCIConfigJSON:
+	default:
+		return fmt.Sprintf("config media type %s", m.Config.MediaType), true
+	}
+
+	for _, l := range m.Layers {
+		if !strings.Contains(string(l.MediaType), ".tar") {
+			return fmt.Sprintf("layer media type %s", l.MediaType), true
+		}
+	}
+	return "", false
+}
+
+// IndexArtifact returns reason if index references no image manifest
+func IndexArtifact(idx *v1.IndexManifest) (string, bool) {
+	for _, m := range idx.Manifests {
+		if m.MediaType.IsImage() || m.MediaType.IsIndex() {
+			return "", false
+		}
+	}
+	return "index without image manifest", true
+}
+
+// CheckArtifact checks whether ref is a non-image artifact, by tag
+// first and then by manifest of ref, ArtifactError is returned if it
+// is. Manifests of child indexes aren't fetched
+func (client *RegistryDockerClient) CheckArtifact(ref string) error {
+	if p, ok := ArtifactTag(ref); ok {
+		return &ArtifactError{Ref: ref, Reason: "tag matches " + p}
+	}
+
+	options, err := client.RemoteOptions(ref)
+	if err != nil {
+		return err
+	}
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return err
+	}
+	desc, err := remote.Get(r, options...)
+	if err != nil {
+		return err
+	}
+
+	var (
+		reason   string
+		artifact bool
+	)
+	switch {
+	case desc.MediaType == types.DockerManifestSchema1 || desc.MediaType == types.DockerManifestSchema1Signed:
+		// Schema 1 manifests have no config, they're images
+	case desc.MediaType.IsIndex():
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return err
+		}
+		m, err := idx.IndexManifest()
+		if err != nil {
+			return err
+		}
+		reason, artifact = IndexArtifact(m)
+	case desc.MediaType.IsImage():
+		img, err := desc.Image()
+		if err != nil {
+			return err
+		}
+		m, err := img.Manifest()
+		if err != nil {
+			return err
+		}
+		reason, artifact = ManifestArtifact(m)
+	default:
+		reason, artifact = fmt.Sprintf("media type %s", desc.MediaType), true
+	}
+
+	if artifact {
+		return &ArtifactError{Ref: ref, Reason: reason}
+	}
+	return nil
+}
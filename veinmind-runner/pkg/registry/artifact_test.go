@@ -0,0 +1,50 @@
+package registry
+
+import (
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestArtifactTag(t *testing.T) {
+	digest := "sha256-0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	for _, ref := range []string{"harbor.internal/app:" + digest + ".sig", "app:" + digest + ".att", "app:" + digest + ".sbom"} {
+		_, ok := ArtifactTag(ref)
+		assert.True(t, ok, ref)
+	}
+	for _, ref := range []string{"app:latest", "app", "app@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"} {
+		_, ok := ArtifactTag(ref)
+		assert.False(t, ok, ref)
+	}
+}
+
+func TestManifestArtifact(t *testing.T) {
+	image := &v1.Manifest{
+		Config: v1.Descriptor{MediaType: types.OCIConfigJSON},
+		Layers: []v1.Descriptor{{MediaType: types.OCILayer}, {MediaType: types.DockerForeignLayer}},
+	}
+	_, ok := ManifestArtifact(image)
+	assert.False(t, ok)
+
+	helm := &v1.Manifest{
+		Config: v1.Descriptor{MediaType: "application/vnd.cncf.helm.config.v1+json"},
+		Layers: []v1.Descriptor{{MediaType: "application/vnd.cncf.helm.chart.content.v1.tar+gzip"}},
+	}
+	reason, ok := ManifestArtifact(helm)
+	assert.True(t, ok)
+	assert.Equal(t, "config media type application/vnd.cncf.helm.config.v1+json", reason)
+
+	// Signatures of cosign have image config but no filesystem layer
+	signature := &v1.Manifest{
+		Config: v1.Descriptor{MediaType: types.OCIConfigJSON},
+		Layers: []v1.Descriptor{{MediaType: "application/vnd.dev.cosign.simplesigning.v1+json"}},
+	}
+	_, ok = ManifestArtifact(signature)
+	assert.True(t, ok)
+
+	_, ok = IndexArtifact(&v1.IndexManifest{Manifests: []v1.Descriptor{{MediaType: types.OCIManifestSchema1}}})
+	assert.False(t, ok)
+	_, ok = IndexArtifact(&v1.IndexManifest{Manifests: []v1.Descriptor{{MediaType: "application/vnd.oci.artifact.manifest.v1+json"}}})
+	assert.True(t, ok)
+}
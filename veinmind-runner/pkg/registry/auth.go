@@ -4,6 +4,8 @@ import "github.com/BurntSushi/toml"
 
 type Auth struct {
 	Registry string `toml:"registry"`
+	// Prefix restricts auth to repos under the path prefix of registry
+	Prefix   string `toml:"prefix"`
 	Username string `toml:"username"`
 	Password string `toml:"password"`
 }
@@ -0,0 +1,57 @@
+package registry
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/blobcache"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"io"
+)
+
+// cachedImage serves compressed layers of image fetched by registry
+// client from blob cache, layers shared by images are downloaded once
+type cachedImage struct {
+	v1.Image
+	cache *blobcache.Cache
+}
+
+// withBlobCache wraps img with cache, img is returned as is if cache
+// is nil
+func withBlobCache(cache *blobcache.Cache, img v1.Image) v1.Image {
+	if cache == nil {
+		return img
+	}
+	return &cachedImage{Image: img, cache: cache}
+}
+
+func (i *cachedImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	cached := make([]v1.Layer, 0, len(layers))
+	for _, l := range layers {
+		cached = append(cached, &cachedLayer{Layer: l, cache: i.cache})
+	}
+	return cached, nil
+}
+
+func (i *cachedImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	l, err := i.Image.LayerByDigest(h)
+	if err != nil {
+		return nil, err
+	}
+	return &cachedLayer{Layer: l, cache: i.cache}, nil
+}
+
+type cachedLayer struct {
+	v1.Layer
+	cache *blobcache.Cache
+}
+
+func (l *cachedLayer) Compressed() (io.ReadCloser, error) {
+	digest, err := l.Digest()
+	if err != nil {
+		return nil, err
+	}
+	return l.cache.Get(digest.String(), l.Layer.Compressed)
+}
@@ -1,7 +1,24 @@
 package registry
 
+import (
+	"context"
+	"github.com/containerd/containerd/errdefs"
+	dockercli "github.com/docker/docker/client"
+)
+
+// Client pulls images of registry into runtime, operations accessing
+// registry or runtime are aborted once ctx is done
 type Client interface {
-	Pull(repo string) (string, error)
-	Remove(id string) error
+	Pull(ctx context.Context, repo string) (string, error)
+	// Lookup returns id of local image of repo with digest, empty
+	// string is returned if the image isn't present locally
+	Lookup(ctx context.Context, repo string, digest string) (string, error)
+	Remove(ctx context.Context, id string) error
 	Auth(config AuthConfig) error
 }
+
+// IsImageNotFound reports whether err of Remove is failure of runtime
+// finding the image, e.g. image removed by others
+func IsImageNotFound(err error) bool {
+	return err != nil && (errdefs.IsNotFound(err) || dockercli.IsErrNotFound(err))
+}
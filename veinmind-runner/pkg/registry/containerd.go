@@ -1,45 +1,187 @@
 package registry
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/blobcache"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/regstorage"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/regtoken"
 	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/images"
 	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
 	"github.com/distribution/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
 	"strings"
+	"sync"
+	"time"
 )
 
-const (
-	ns             = "veinmind-runner"
-	containerdSock = "/run/containerd/containerd.sock"
-)
+const ns = "veinmind-runner"
+
+// dockerHubHost is host of docker hub registry resolved by containerd
+const dockerHubHost = "registry-1.docker.io"
+
+// DefaultContainerdAddress is socket of containerd by default
+const DefaultContainerdAddress = "/run/containerd/containerd.sock"
 
 type RegistryContainerdClient struct {
 	client *containerd.Client
+	// credentials of auth config and docker config, translated into
+	// authorizer of containerd resolver
+	credentials *Credentials
+	// tokens of registries served by token providers, which take
+	// precedence over credentials
+	tokens *regtoken.Cache
+	// platform of images pulled, default platform of host is used if
+	// it's empty
+	platform string
+	// pullVia is the path images are pulled through, PullViaRuntime
+	// is used if it's empty
+	pullVia string
+	// blobCache keeps layers fetched by registry client if it's set
+	blobCache *blobcache.Cache
+	// storage is registry storage images are read from instead of
+	// registry if it's set
+	storage *regstorage.Storage
+	// leaseTTL is ttl of leases keeping content of pulled images,
+	// DefaultLeaseTTL is used if it's zero
+	leaseTTL time.Duration
+
+	leasesMu sync.Mutex
+	// leases of pulled images by ids returned by Pull
+	leases map[string]*pullLease
 }
 
-func NewRegistryContainerdClient() (Client, error) {
+// NewRegistryContainerdClient returns client of containerd at address,
+// DefaultContainerdAddress is used if address is empty
+func NewRegistryContainerdClient(address string, opts ...Option) (Client, error) {
+	if address == "" {
+		address = DefaultContainerdAddress
+	}
+
 	c := &RegistryContainerdClient{}
-	client, err := containerd.New(containerdSock, containerd.WithDefaultNamespace(ns))
+	client, err := containerd.New(address, containerd.WithDefaultNamespace(ns))
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrapf(err, "containerd address %s", address)
 	}
 
 	c.client = client
+	c.credentials = dockerConfigCredentials()
+	c.leaseTTL = DefaultLeaseTTL
+	c.leases = map[string]*pullLease{}
+
+	for _, opt := range opts {
+		cNew, err := opt(c)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		c = cNew.(*RegistryContainerdClient)
+	}
 
 	return c, nil
 }
 
 func (c *RegistryContainerdClient) Auth(config AuthConfig) error {
+	c.credentials.Add(SourceAuthConfig, config.Auths...)
+
 	return nil
 }
 
-func (c *RegistryContainerdClient) Pull(repo string) (string, error) {
+// resolver returns resolver of containerd authorized by tokens or by
+// credentials, host of docker hub is resolved as index.docker.io
+func (c *RegistryContainerdClient) resolver() remotes.Resolver {
+	var authorizer docker.Authorizer = docker.NewDockerAuthorizer(docker.WithAuthCreds(func(host string) (string, string, error) {
+		registry := containerdRegistry(host)
+		if c.tokens.Serves(registry) {
+			token, err := c.tokens.Token(context.Background(), registry)
+			return token.Username, token.Password, err
+		}
+		auth, _ := c.credentials.ResolveRegistry(registry)
+		return auth.Username, auth.Password, nil
+	}))
+	if c.tokens != nil {
+		authorizer = &tokenAuthorizer{Authorizer: authorizer, tokens: c.tokens}
+	}
+	return docker.NewResolver(docker.ResolverOptions{
+		Hosts: docker.ConfigureDefaultRegistries(docker.WithAuthorizer(authorizer)),
+	})
+}
+
+// Pull pulls repo under a lease, so that content of the image isn't
+// garbage collected until it's released by Release
+func (c *RegistryContainerdClient) Pull(ctx context.Context, repo string) (string, error) {
+	lease, ctx, err := acquireLease(ctx, c.client.LeasesService(), c.leaseTTL)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := pull(ctx, pullVia(c.pullVia, c.storage), repo, c.pullClient, c.pullRuntime)
+	if err != nil {
+		if err := lease.release(context.Background()); err != nil {
+			log.Warnf("Release lease of %#v error: %s\n", repo, err.Error())
+		}
+		return "", err
+	}
+
+	c.leasesMu.Lock()
+	prev := c.leases[id]
+	c.leases[id] = lease
+	c.leasesMu.Unlock()
+	if prev != nil {
+		if err := prev.release(context.Background()); err != nil {
+			log.Warnf("Release lease of %#v error: %s\n", repo, err.Error())
+		}
+	}
+	return id, nil
+}
+
+// Release releases lease of image id returned by Pull, ids without
+// lease are ignored
+func (c *RegistryContainerdClient) Release(ctx context.Context, id string) error {
+	c.leasesMu.Lock()
+	lease, ok := c.leases[id]
+	delete(c.leases, id)
+	c.leasesMu.Unlock()
+	if !ok {
+		return nil
+	}
+	return lease.release(ctx)
+}
+
+// pullRuntime pulls repo by containerd client
+func (c *RegistryContainerdClient) pullRuntime(ctx context.Context, repo string) (string, error) {
+	registry := ""
 	if named, err := reference.ParseDockerRef(repo); err == nil {
 		repo = named.String()
+		registry = normalizeRegistry(reference.Domain(named))
 	}
 
-	image, err := c.client.Pull(context.Background(), repo, containerd.WithPullUnpack)
+	// Resolver reads tokens from cache, rejected basic tokens fail
+	// fetching registry tokens and the pull is retried
+	var image containerd.Image
+	err := withToken(ctx, c.tokens, registry, func(*regtoken.Token) error {
+		opts := []containerd.RemoteOpt{containerd.WithPullUnpack, containerd.WithResolver(c.resolver())}
+		if c.platform != "" {
+			opts = append(opts, containerd.WithPlatform(c.platform))
+		}
+		var err error
+		image, err = c.client.Pull(ctx, repo, opts...)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
@@ -48,15 +190,200 @@ func (c *RegistryContainerdClient) Pull(repo string) (string, error) {
 	return imageID, nil
 }
 
-func (c *RegistryContainerdClient) Remove(repo string) error {
+// pullClient fetches repo by registry client and writes it into content
+// store of containerd, the image is recorded and unpacked with the same
+// digests as pulled by containerd, and children of index other than
+// platform pulled are absent the same
+func (c *RegistryContainerdClient) pullClient(ctx context.Context, repo string) (string, error) {
+	named, err := reference.ParseDockerRef(repo)
+	if err != nil {
+		return "", err
+	}
+	ref, err := name.ParseReference(named.String())
+	if err != nil {
+		return "", err
+	}
+
+	registry := normalizeRegistry(reference.Domain(named))
+	options := []remote.Option{remote.WithTransport(c.tokens.Transport(registry, remoteTransport()))}
+	if c.tokens.Serves(registry) {
+		options = append(options, remote.WithAuth(&tokenAuthenticator{tokens: c.tokens, registry: registry}))
+	} else if auth, _ := c.credentials.Resolve(repo); auth.Username != "" && auth.Password != "" {
+		options = append(options, remote.WithAuth(&authn.Basic{
+			Username: auth.Username,
+			Password: auth.Password,
+		}))
+	}
+
+	ctx = namespaces.WithNamespace(ctx, ns)
+	desc, img, err := fetchImage(ctx, c.storage, ref, c.platform, options)
+	if err != nil {
+		return "", err
+	}
+	img = withBlobCache(c.blobCache, img)
+
+	// Content written is protected from garbage collection by lease
+	// until the image record references it
+	ctx, done, err := c.client.WithLease(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer done(ctx)
+
+	target, err := c.writeImage(ctx, desc, img)
+	if err != nil {
+		return "", err
+	}
+
+	record := images.Image{Name: named.String(), Target: target}
+	imageStore := c.client.ImageService()
+	if _, err := imageStore.Create(ctx, record); err != nil {
+		if !errdefs.IsAlreadyExists(err) {
+			return "", err
+		}
+		if _, err := imageStore.Update(ctx, record, "target"); err != nil {
+			return "", err
+		}
+	}
+
+	p, err := remotePlatform(c.platform)
+	if err != nil {
+		return "", err
+	}
+	image := containerd.NewImageWithPlatform(c.client, record, platforms.Only(ocispec.Platform{
+		OS:           p.OS,
+		Architecture: p.Architecture,
+		Variant:      p.Variant,
+	}))
+	if err := image.Unpack(ctx, containerd.DefaultSnapshotter); err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{ns, string(target.Digest)}, "/"), nil
+}
+
+// writeImage writes manifests, config and layers of img into content
+// store, and returns descriptor of desc which is the index of img for
+// multi-platform images. Blobs are labeled with their children the same
+// as containerd, so they're garbage collected along with the image
+func (c *RegistryContainerdClient) writeImage(ctx context.Context, desc *remote.Descriptor, img v1.Image) (ocispec.Descriptor, error) {
+	cs := c.client.ContentStore()
+
+	config, err := img.RawConfigFile()
+	if err != nil {
+		return ocispec.Descriptor{}, &fetchError{err: err}
+	}
+	configName, err := img.ConfigName()
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return ocispec.Descriptor{}, &fetchError{err: err}
+	}
+	if err := content.WriteBlob(ctx, cs, configName.String(), bytes.NewReader(config),
+		ociDescriptor(manifest.Config)); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	labels := map[string]string{
+		"containerd.io/gc.ref.content.config": configName.String(),
+	}
+	for i, l := range manifest.Layers {
+		layer, err := img.LayerByDigest(l.Digest)
+		if err != nil {
+			return ocispec.Descriptor{}, &fetchError{err: err}
+		}
+		if err := writeLayer(ctx, cs, layer, ociDescriptor(l)); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.l.%d", i)] = l.Digest.String()
+	}
+
+	raw, err := img.RawManifest()
+	if err != nil {
+		return ocispec.Descriptor{}, &fetchError{err: err}
+	}
+	mediaType, err := img.MediaType()
+	if err != nil {
+		return ocispec.Descriptor{}, &fetchError{err: err}
+	}
+	target := ocispec.Descriptor{
+		MediaType: string(mediaType),
+		Digest:    digest.FromBytes(raw),
+		Size:      int64(len(raw)),
+	}
+	if err := content.WriteBlob(ctx, cs, target.Digest.String(), bytes.NewReader(raw), target,
+		content.WithLabels(labels)); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	if !desc.MediaType.IsIndex() {
+		return target, nil
+	}
+	index := ociDescriptor(desc.Descriptor)
+	if err := content.WriteBlob(ctx, cs, index.Digest.String(), bytes.NewReader(desc.Manifest), index,
+		content.WithLabels(map[string]string{
+			"containerd.io/gc.ref.content.m.0": target.Digest.String(),
+		})); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return index, nil
+}
+
+// writeLayer writes compressed blob of layer into content store, layers
+// are fetched from registry while they're written
+func writeLayer(ctx context.Context, cs content.Store, layer v1.Layer, desc ocispec.Descriptor) error {
+	rc, err := layer.Compressed()
+	if err != nil {
+		return &fetchError{err: err}
+	}
+	defer rc.Close()
+
+	return content.WriteBlob(ctx, cs, desc.Digest.String(), rc, desc)
+}
+
+func ociDescriptor(d v1.Descriptor) ocispec.Descriptor {
+	return ocispec.Descriptor{
+		MediaType: string(d.MediaType),
+		Digest:    digest.Digest(d.Digest.String()),
+		Size:      d.Size,
+	}
+}
+
+func (c *RegistryContainerdClient) Lookup(ctx context.Context, repo string, digest string) (string, error) {
+	if named, err := reference.ParseDockerRef(repo); err == nil {
+		repo = named.String()
+	}
+
+	ctx = namespaces.WithNamespace(ctx, ns)
+	image, err := c.client.GetImage(ctx, repo)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if string(image.Target().Digest) != digest {
+		return "", nil
+	}
+
+	// Images without snapshots can't be scanned
+	unpacked, err := image.IsUnpacked(ctx, containerd.DefaultSnapshotter)
+	if err != nil || !unpacked {
+		return "", err
+	}
+
+	return strings.Join([]string{ns, digest}, "/"), nil
+}
+
+func (c *RegistryContainerdClient) Remove(ctx context.Context, repo string) error {
 	if named, err := reference.ParseDockerRef(repo); err == nil {
 		repo = named.String()
 	}
 
-	var (
-		ctx        = namespaces.WithNamespace(context.Background(), ns)
-		imageStore = c.client.ImageService()
-	)
+	ctx = namespaces.WithNamespace(ctx, ns)
+	imageStore := c.client.ImageService()
 
 	var opts []images.DeleteOpt
 	opts = append(opts, images.SynchronousDelete())
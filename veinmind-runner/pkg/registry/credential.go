@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/distribution/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/name"
+	"sort"
+	"strings"
+)
+
+// sources of credentials, lower rank takes precedence
+const (
+	SourceAuthConfig   = "auth config"
+	SourceDockerConfig = "docker config"
+)
+
+var sourceRanks = map[string]int{
+	SourceAuthConfig:   0,
+	SourceDockerConfig: 1,
+}
+
+type credential struct {
+	Auth
+	source string
+	index  int
+}
+
+// Credentials resolves auth of image references, the entry with the
+// longest matching repo prefix wins, ties are broken by rank of source
+// and then order of entries, so resolution is deterministic
+type Credentials struct {
+	entries []credential
+}
+
+func NewCredentials() *Credentials {
+	return &Credentials{}
+}
+
+// Add adds auth entries of source, registry of entries is normalized
+// and prefix is matched against repo path by segments
+func (c *Credentials) Add(source string, auths ...Auth) {
+	for _, auth := range auths {
+		auth.Registry = normalizeRegistry(auth.Registry)
+		auth.Prefix = strings.Trim(auth.Prefix, "/")
+		c.entries = append(c.entries, credential{
+			Auth:   auth,
+			source: source,
+			index:  len(c.entries),
+		})
+	}
+
+	sort.SliceStable(c.entries, func(i, j int) bool {
+		a, b := c.entries[i], c.entries[j]
+		if len(a.Prefix) != len(b.Prefix) {
+			return len(a.Prefix) > len(b.Prefix)
+		}
+		if sourceRanks[a.source] != sourceRanks[b.source] {
+			return sourceRanks[a.source] < sourceRanks[b.source]
+		}
+		return a.index < b.index
+	})
+}
+
+// Resolve returns auth of image reference
+func (c *Credentials) Resolve(ref string) (Auth, bool) {
+	named, err := reference.ParseDockerRef(ref)
+	if err != nil {
+		return Auth{}, false
+	}
+
+	auth, ok := c.lookup(normalizeRegistry(reference.Domain(named)), reference.Path(named))
+	return c.resolved(ref, auth, ok)
+}
+
+// ResolveRegistry returns auth of registry-wide access such as catalog,
+// entries without prefix are preferred
+func (c *Credentials) ResolveRegistry(registry string) (Auth, bool) {
+	registry = normalizeRegistry(registry)
+	auth, ok := c.lookup(registry, "")
+	if !ok {
+		for _, e := range c.entries {
+			if e.Registry == registry {
+				auth, ok = e, true
+				break
+			}
+		}
+	}
+	return c.resolved(registry, auth, ok)
+}
+
+func (c *Credentials) resolved(ref string, auth credential, ok bool) (Auth, bool) {
+	if ok {
+		log.Debugf("Resolve credential of %#v: registry %#v, prefix %#v, user %#v from %s\n",
+			ref, auth.Registry, auth.Prefix, auth.Username, auth.source)
+		return auth.Auth, true
+	}
+
+	log.Debugf("Resolve credential of %#v: anonymous\n", ref)
+	return Auth{}, false
+}
+
+func (c *Credentials) lookup(registry string, path string) (credential, bool) {
+	for _, e := range c.entries {
+		if e.Registry != registry {
+			continue
+		}
+		if e.Prefix == "" || path == e.Prefix || strings.HasPrefix(path, e.Prefix+"/") {
+			return e, true
+		}
+	}
+	return credential{}, false
+}
+
+// normalizeRegistry returns canonical name of registry, docker hub
+// aliases are all index.docker.io
+func normalizeRegistry(registry string) string {
+	r, err := name.NewRegistry(registry)
+	if err != nil {
+		return registry
+	}
+	return r.RegistryStr()
+}
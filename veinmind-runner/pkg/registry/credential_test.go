@@ -0,0 +1,48 @@
+package registry
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCredentialsResolve(t *testing.T) {
+	c := NewCredentials()
+	c.Add(SourceDockerConfig,
+		Auth{Registry: "index.docker.io", Username: "hub"},
+		Auth{Registry: "registry.example.com", Username: "docker"},
+	)
+	c.Add(SourceAuthConfig,
+		Auth{Registry: "registry.example.com", Username: "default"},
+		Auth{Registry: "registry.example.com", Prefix: "team-a/", Username: "team-a"},
+		Auth{Registry: "registry.example.com", Prefix: "team-a/app", Username: "app"},
+		Auth{Registry: "docker.io", Prefix: "library", Username: "library"},
+	)
+
+	for _, tc := range []struct {
+		ref      string
+		username string
+	}{
+		{"registry.example.com/team-a/app:v1", "app"},
+		{"registry.example.com/team-a/app/sub", "app"},
+		{"registry.example.com/team-a/web", "team-a"},
+		{"registry.example.com/team-ab/web", "default"},
+		{"registry.example.com/other", "default"},
+		{"nginx:latest", "library"},
+		{"bitnami/nginx", "hub"},
+		{"private.net/nginx", ""},
+	} {
+		auth, ok := c.Resolve(tc.ref)
+		assert.Equal(t, tc.username != "", ok, tc.ref)
+		assert.Equal(t, tc.username, auth.Username, tc.ref)
+	}
+
+	auth, ok := c.ResolveRegistry("registry.example.com")
+	assert.True(t, ok)
+	assert.Equal(t, "default", auth.Username)
+
+	c = NewCredentials()
+	c.Add(SourceAuthConfig, Auth{Registry: "private.net", Prefix: "team-a", Username: "team-a"})
+	auth, ok = c.ResolveRegistry("private.net")
+	assert.True(t, ok)
+	assert.Equal(t, "team-a", auth.Username)
+}
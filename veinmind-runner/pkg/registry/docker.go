@@ -6,6 +6,9 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/blobcache"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/regstorage"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/regtoken"
 	"github.com/distribution/distribution/reference"
 	"github.com/docker/cli/cli/command"
 	"github.com/docker/cli/cli/config/configfile"
@@ -14,12 +17,15 @@ import (
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/pkg/errors"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
 	"strings"
 	"time"
 )
@@ -27,89 +33,102 @@ import (
 const dockerConfigPath = "/root/.docker/config.json"
 
 type RegistryDockerClient struct {
-	ctx     context.Context
-	auth    map[string]Auth
-	options []remote.Option
+	credentials *Credentials
+	// tokens of registries served by token providers, which take
+	// precedence over credentials
+	tokens    *regtoken.Cache
+	transport http.RoundTripper
+	options   []remote.Option
+	// socket of docker daemon, environment of docker client is used if
+	// it's empty
+	socket string
+	// platform of images pulled, default platform of daemon is used if
+	// it's empty
+	platform string
+	// pullVia is the path images are pulled through, PullViaRuntime
+	// is used if it's empty
+	pullVia string
+	// blobCache keeps layers fetched by registry client if it's set
+	blobCache *blobcache.Cache
+	// storage is registry storage images are read from instead of
+	// registry if it's set
+	storage *regstorage.Storage
 }
 
-func parseDockerAuthConfig(path string) (map[string]Auth, error) {
+// parseDockerAuthConfig returns auths of docker config file sorted by
+// registry, entries which can't be decoded are skipped
+func parseDockerAuthConfig(path string) ([]Auth, error) {
 	dockerConfig := configfile.ConfigFile{}
-	authConfigMap := make(map[string]Auth)
+	dockerConfigByte, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(dockerConfigByte, &dockerConfig)
+	if err != nil {
+		return nil, err
+	}
 
-	if _, err := os.Stat(path); err != nil {
-		dockerConfigByte, err := ioutil.ReadFile(path)
+	auths := []Auth{}
+	for server, config := range dockerConfig.AuthConfigs {
+		u, err := url.Parse(server)
+		registryName := ""
+		if err != nil || u.Host == "" {
+			registryName = server
+		} else {
+			registryName = u.Host
+		}
 
-		err = json.Unmarshal(dockerConfigByte, &dockerConfig)
+		registry, err := name.NewRegistry(registryName)
 		if err != nil {
-			return nil, err
-		} else {
-			for server, config := range dockerConfig.AuthConfigs {
-				u, err := url.Parse(server)
-				registryName := ""
-				if err != nil {
-					registryName = server
-				} else {
-					registryName = u.Host
-				}
-
-				registry, err := name.NewRegistry(registryName)
-				if err != nil {
-					log.Error(err)
-					continue
-				}
-
-				if config.Auth != "" {
-					authDecode, err := base64.StdEncoding.DecodeString(config.Auth)
-					if err == nil {
-						authSplit := strings.Split(string(authDecode), ":")
-						if len(authSplit) == 2 {
-							auth := Auth{
-								Username: authSplit[0],
-								Password: authSplit[1],
-							}
-							authConfigMap[registry.String()] = auth
-						} else {
-							log.Error("docker config auth block length wrong")
-							continue
-						}
-					} else {
-						log.Error(err)
-						continue
-					}
-				}
+			log.Error(err)
+			continue
+		}
+
+		if config.Auth != "" {
+			authDecode, err := base64.StdEncoding.DecodeString(config.Auth)
+			if err != nil {
+				log.Error(err)
+				continue
 			}
-			return authConfigMap, nil
+
+			authSplit := strings.SplitN(string(authDecode), ":", 2)
+			if len(authSplit) != 2 {
+				log.Error("docker config auth block length wrong")
+				continue
+			}
+			auths = append(auths, Auth{
+				Registry: registry.RegistryStr(),
+				Username: authSplit[0],
+				Password: authSplit[1],
+			})
 		}
-	} else {
-		return nil, err
 	}
-}
 
-func NewRegistryDockerClient(opts ...Option) (Client, error) {
-	c := &RegistryDockerClient{}
-	c.ctx = context.Background()
-	c.auth = make(map[string]Auth)
+	sort.Slice(auths, func(i, j int) bool {
+		return auths[i].Registry < auths[j].Registry
+	})
+	return auths, nil
+}
 
-	// Get Auth Token From Config File
-	auth, err := parseDockerAuthConfig(dockerConfigPath)
+// dockerConfigCredentials returns credentials of docker config file
+func dockerConfigCredentials() *Credentials {
+	credentials := NewCredentials()
+	auths, err := parseDockerAuthConfig(dockerConfigPath)
 	if err != nil {
-		log.Error(err)
-	} else {
-		c.auth = auth
-	}
-
-	// Options handle
-	for _, opt := range opts {
-		cNew, err := opt(c)
-		if err != nil {
+		if !os.IsNotExist(err) {
 			log.Error(err)
-			continue
 		}
-		c = cNew.(*RegistryDockerClient)
+	} else {
+		credentials.Add(SourceDockerConfig, auths...)
 	}
+	return credentials
+}
 
-	var clientOpts []remote.Option
-	clientOpts = append(clientOpts, remote.WithTransport(&http.Transport{
+// remoteTransport returns transport of registry client, certificates of
+// registries aren't verified
+func remoteTransport() http.RoundTripper {
+	return &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
 			Timeout:   5 * time.Second,
@@ -123,23 +142,63 @@ func NewRegistryDockerClient(opts ...Option) (Client, error) {
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: true,
 		},
-	}))
-	c.options = clientOpts
+	}
+}
+
+func NewRegistryDockerClient(opts ...Option) (Client, error) {
+	c := &RegistryDockerClient{}
+
+	// Get Auth Token From Config File
+	c.credentials = dockerConfigCredentials()
+
+	// Options handle
+	for _, opt := range opts {
+		cNew, err := opt(c)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		c = cNew.(*RegistryDockerClient)
+	}
+
+	c.transport = remoteTransport()
+	c.options = []remote.Option{remote.WithTransport(c.transport)}
 
 	return c, nil
 }
 
-func (client *RegistryDockerClient) GetRepo(repo string, options ...remote.Option) (*remote.Descriptor, error) {
-	options = append(options, client.options...)
+// RemoteOptions returns options of remote registry access for repo,
+// including transport and auth resolved for the repo
+func (client *RegistryDockerClient) RemoteOptions(repo string) ([]remote.Option, error) {
 	named, err := reference.ParseDockerRef(repo)
 	if err != nil {
 		return nil, err
 	}
 
-	domain := reference.Domain(named)
-	var auth Auth
-	if v, ok := client.auth[domain]; ok {
-		auth = v
+	auth, _ := client.credentials.Resolve(repo)
+	return client.authOptions(normalizeRegistry(reference.Domain(named)), auth), nil
+}
+
+// RegistryAuth returns auth of registry resolved from auth config and
+// docker config
+func (client *RegistryDockerClient) RegistryAuth(registry string) (Auth, bool) {
+	return client.credentials.ResolveRegistry(registry)
+}
+
+// RepoAuth returns auth of repo resolved from auth config and docker
+// config, for services of registry other than distribution API
+func (client *RegistryDockerClient) RepoAuth(repo string) (Auth, bool) {
+	return client.credentials.Resolve(repo)
+}
+
+// authOptions returns options authenticating to registry with token of
+// registry if tokens serve it, and with auth otherwise
+func (client *RegistryDockerClient) authOptions(registry string, auth Auth) []remote.Option {
+	options := append([]remote.Option{}, client.options...)
+	if client.tokens.Serves(registry) {
+		return append(options,
+			remote.WithTransport(client.tokens.Transport(registry, client.transport)),
+			remote.WithAuth(&tokenAuthenticator{tokens: client.tokens, registry: registry}))
 	}
 
 	if auth.Username != "" && auth.Password != "" {
@@ -149,32 +208,34 @@ func (client *RegistryDockerClient) GetRepo(repo string, options ...remote.Optio
 		}))
 	}
 
-	ref, err := name.ParseReference(repo)
+	return options
+}
+
+func (client *RegistryDockerClient) GetRepo(repo string, options ...remote.Option) (*remote.Descriptor, error) {
+	authOptions, err := client.RemoteOptions(repo)
 	if err != nil {
 		return nil, err
 	}
-	return remote.Get(ref, options...)
-}
+	options = append(options, authOptions...)
 
-func (client *RegistryDockerClient) GetRepoTags(repo string, options ...remote.Option) ([]string, error) {
-	options = append(options, client.options...)
-	named, err := reference.ParseDockerRef(repo)
+	ref, err := name.ParseReference(repo)
 	if err != nil {
 		return nil, err
 	}
+	return remote.Get(ref, options...)
+}
 
-	domain := reference.Domain(named)
-	var auth Auth
-	if v, ok := client.auth[domain]; ok {
-		auth = v
+func (client *RegistryDockerClient) GetRepoTags(ctx context.Context, repo string, options ...remote.Option) ([]string, error) {
+	if client.storage != nil {
+		return storageTags(client.storage, repo)
 	}
 
-	if auth.Username != "" && auth.Password != "" {
-		options = append(options, remote.WithAuth(&authn.Basic{
-			Username: auth.Username,
-			Password: auth.Password,
-		}))
+	authOptions, err := client.RemoteOptions(repo)
+	if err != nil {
+		return nil, err
 	}
+	options = append(options, authOptions...)
+	options = append(options, remote.WithContext(ctx))
 
 	repoR, err := name.NewRepository(repo)
 	if err != nil {
@@ -183,19 +244,10 @@ func (client *RegistryDockerClient) GetRepoTags(repo string, options ...remote.O
 	return remote.List(repoR, options...)
 }
 
-func (client *RegistryDockerClient) GetRepos(address string, options ...remote.Option) (repos []string, err error) {
-	options = append(options, client.options...)
-	var auth Auth
-	if v, ok := client.auth[address]; ok {
-		auth = v
-	}
-
-	if auth.Username != "" && auth.Password != "" {
-		options = append(options, remote.WithAuth(&authn.Basic{
-			Username: auth.Username,
-			Password: auth.Password,
-		}))
-	}
+func (client *RegistryDockerClient) GetRepos(ctx context.Context, address string, options ...remote.Option) (repos []string, err error) {
+	auth, _ := client.credentials.ResolveRegistry(address)
+	options = append(options, client.authOptions(normalizeRegistry(address), auth)...)
+	options = append(options, remote.WithContext(ctx))
 
 	regsitry, err := name.NewRegistry(address)
 	if err != nil {
@@ -223,15 +275,29 @@ func (client *RegistryDockerClient) GetRepos(address string, options ...remote.O
 }
 
 func (client *RegistryDockerClient) Auth(config AuthConfig) error {
-	for _, auth := range config.Auths {
-		client.auth[auth.Registry] = auth
-	}
+	client.credentials.Add(SourceAuthConfig, config.Auths...)
 
 	return nil
 }
 
-func (client *RegistryDockerClient) Pull(repo string) (string, error) {
-	c, err := dockercli.NewClientWithOpts(dockercli.FromEnv, dockercli.WithAPIVersionNegotiation())
+// dockerClient returns client of docker daemon at socket of client
+func (client *RegistryDockerClient) dockerClient() (*dockercli.Client, error) {
+	opts := []dockercli.Opt{dockercli.FromEnv, dockercli.WithAPIVersionNegotiation()}
+	if client.socket != "" {
+		opts = append(opts, dockercli.WithHost("unix://"+client.socket))
+	}
+
+	return dockercli.NewClientWithOpts(opts...)
+}
+
+func (client *RegistryDockerClient) Pull(ctx context.Context, repo string) (string, error) {
+	return pull(ctx, pullVia(client.pullVia, client.storage), repo, client.pullClient, client.pullRuntime)
+}
+
+// pullRuntime pulls repo by docker daemon, the pull is aborted by
+// daemon once ctx is done
+func (client *RegistryDockerClient) pullRuntime(ctx context.Context, repo string) (string, error) {
+	c, err := client.dockerClient()
 	if err != nil {
 		return "", err
 	}
@@ -241,41 +307,139 @@ func (client *RegistryDockerClient) Pull(repo string) (string, error) {
 		return "", err
 	}
 
-	domain := reference.Domain(named)
-	var auth Auth
-	if v, ok := client.auth[domain]; ok {
-		auth = v
+	auth, _ := client.credentials.Resolve(repo)
+	err = withToken(ctx, client.tokens, normalizeRegistry(reference.Domain(named)), func(t *regtoken.Token) error {
+		config := dockertypes.AuthConfig{
+			Username: auth.Username,
+			Password: auth.Password,
+		}
+		if t != nil {
+			config = dockertypes.AuthConfig{
+				Username:      t.Username,
+				Password:      t.Password,
+				RegistryToken: t.Bearer,
+			}
+		}
+
+		// Generate Auth Token
+		token, err := command.EncodeAuthToBase64(config)
+
+		var closer io.ReadCloser
+		if token == "" {
+			closer, err = c.ImagePull(ctx, repo, dockertypes.ImagePullOptions{
+				Platform: client.platform,
+			})
+		} else {
+			closer, err = c.ImagePull(ctx, repo, dockertypes.ImagePullOptions{
+				RegistryAuth: token,
+				Platform:     client.platform,
+			})
+		}
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+
+		_, err = ioutil.ReadAll(closer)
+		return err
+	})
+	if err != nil {
+		return "", err
 	}
 
-	// Generate Auth Token
-	token, err := command.EncodeAuthToBase64(dockertypes.AuthConfig{
-		Username: auth.Username,
-		Password: auth.Password})
+	return named.String(), nil
+}
 
-	var closer io.ReadCloser
-	if token == "" {
-		closer, err = c.ImagePull(client.ctx, repo, dockertypes.ImagePullOptions{})
-	} else {
-		closer, err = c.ImagePull(client.ctx, repo, dockertypes.ImagePullOptions{
-			RegistryAuth: token,
-		})
+// pullClient fetches repo by registry client and loads it into docker
+// daemon, the image is tagged as pulled by daemon. Images of digest
+// references can't be tagged by loading, and id of them is returned
+func (client *RegistryDockerClient) pullClient(ctx context.Context, repo string) (string, error) {
+	named, err := reference.ParseDockerRef(repo)
+	if err != nil {
+		return "", err
+	}
+	ref, err := name.ParseReference(named.String())
+	if err != nil {
+		return "", err
 	}
 
-	_, err = ioutil.ReadAll(closer)
+	options, err := client.RemoteOptions(repo)
+	if err != nil {
+		return "", err
+	}
+	_, img, err := fetchImage(ctx, client.storage, ref, client.platform, options)
+	if err != nil {
+		return "", err
+	}
+	img = withBlobCache(client.blobCache, img)
+
+	c, err := client.dockerClient()
+	if err != nil {
+		return "", err
+	}
+
+	// Layers are fetched while the tarball is written, so failures of
+	// writer are failures of fetch unless loading stopped first
+	pr, pw := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := tarball.Write(ref, img, pw)
+		pw.CloseWithError(err)
+		written <- err
+	}()
+
+	resp, err := c.ImageLoad(ctx, pr, true)
+	if err == nil {
+		_, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	pr.CloseWithError(errLoadStopped)
+	if werr := <-written; werr != nil && !errors.Is(werr, errLoadStopped) {
+		return "", &fetchError{err: werr}
+	}
 	if err != nil {
 		return "", err
 	}
 
+	if _, ok := ref.(name.Digest); ok {
+		id, err := img.ConfigName()
+		if err != nil {
+			return "", err
+		}
+		return id.String(), nil
+	}
 	return named.String(), nil
 }
 
-func (client *RegistryDockerClient) Remove(id string) error {
-	c, err := dockercli.NewClientWithOpts(dockercli.FromEnv, dockercli.WithAPIVersionNegotiation())
+func (client *RegistryDockerClient) Lookup(ctx context.Context, repo string, digest string) (string, error) {
+	c, err := client.dockerClient()
+	if err != nil {
+		return "", err
+	}
+
+	named, err := reference.ParseDockerRef(repo)
+	if err != nil {
+		return "", err
+	}
+
+	// Docker resolves digest references against repo digests of images
+	inspect, _, err := c.ImageInspectWithRaw(ctx, named.Name()+"@"+digest)
+	if err != nil {
+		if dockercli.IsErrNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return inspect.ID, nil
+}
+
+func (client *RegistryDockerClient) Remove(ctx context.Context, id string) error {
+	c, err := client.dockerClient()
 	if err != nil {
 		return err
 	}
 
-	_, err = c.ImageRemove(client.ctx, id, dockertypes.ImageRemoveOptions{
+	_, err = c.ImageRemove(ctx, id, dockertypes.ImageRemoveOptions{
 		Force:         true,
 		PruneChildren: true,
 	})
@@ -1,6 +1,7 @@
 package registry
 
 import (
+	"context"
 	"log"
 	"testing"
 )
@@ -12,7 +13,7 @@ func TestList(t *testing.T) {
 	}
 	switch v := c.(type) {
 	case *RegistryDockerClient:
-		log.Println(v.GetRepos("127.0.0.1:5000"))
+		log.Println(v.GetRepos(context.Background(), "127.0.0.1:5000"))
 		d, err := v.GetRepo("ubuntu")
 		if err != nil {
 			t.Error(err)
@@ -21,7 +22,7 @@ func TestList(t *testing.T) {
 		m, _ := d.RawManifest()
 		log.Println(string(m), err)
 
-		_, err = c.Pull("ubuntu")
+		_, err = c.Pull(context.Background(), "ubuntu")
 		if err != nil {
 			t.Error(err)
 		}
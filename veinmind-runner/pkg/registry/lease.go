@@ -0,0 +1,138 @@
+package registry
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/leases"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/pkg/errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLeaseTTL is how long content of images pulled by containerd
+// client is kept without renewal, leases of runners which exit without
+// releasing them expire after it
+const DefaultLeaseTTL = 10 * time.Minute
+
+// leaseLabel labels leases taken by runner
+const leaseLabel = "veinmind-runner/pulled"
+
+// IsContentMissing reports whether err is failure of runtime finding
+// content of image, e.g. content garbage collected during scan
+func IsContentMissing(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errdefs.IsNotFound(err) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "content digest") && strings.Contains(msg, "not found")
+}
+
+// pullLease keeps content of an image pulled by containerd client from
+// garbage collection until it's released. The lease expires after ttl
+// unless renewed, it's renewed at half of ttl by taking a new lease of
+// the same resources
+type pullLease struct {
+	manager leases.Manager
+	ttl     time.Duration
+
+	mu    sync.Mutex
+	lease leases.Lease
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// acquireLease takes lease of ttl and returns context of it, content
+// pulled with the context is referenced by the lease
+func acquireLease(ctx context.Context, manager leases.Manager, ttl time.Duration) (*pullLease, context.Context, error) {
+	ctx = namespaces.WithNamespace(ctx, ns)
+	l, err := createLease(ctx, manager, ttl)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "create lease")
+	}
+
+	pl := &pullLease{
+		manager: manager,
+		ttl:     ttl,
+		lease:   l,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go pl.renew()
+	return pl, leases.WithLease(ctx, l.ID), nil
+}
+
+func createLease(ctx context.Context, manager leases.Manager, ttl time.Duration) (leases.Lease, error) {
+	return manager.Create(ctx, leases.WithRandomID(), leases.WithExpiration(ttl),
+		leases.WithLabels(map[string]string{leaseLabel: "true"}))
+}
+
+func (pl *pullLease) renew() {
+	defer close(pl.done)
+
+	ticker := time.NewTicker(pl.ttl / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-pl.stop:
+			return
+		case <-ticker.C:
+			if err := pl.renewOnce(); err != nil {
+				log.Warnf("Renew lease of pulled image error: %s\n", err.Error())
+			}
+		}
+	}
+}
+
+// renewOnce moves resources of lease to a new lease of ttl, the old
+// lease is deleted after the new one references all of them
+func (pl *pullLease) renewOnce() error {
+	ctx := namespaces.WithNamespace(context.Background(), ns)
+
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	resources, err := pl.manager.ListResources(ctx, pl.lease)
+	if err != nil {
+		return err
+	}
+	l, err := createLease(ctx, pl.manager, pl.ttl)
+	if err != nil {
+		return err
+	}
+	for _, r := range resources {
+		if err := pl.manager.AddResource(ctx, l, r); err != nil {
+			pl.manager.Delete(ctx, l)
+			return err
+		}
+	}
+
+	old := pl.lease
+	pl.lease = l
+	if err := pl.manager.Delete(ctx, old); err != nil && !errdefs.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// release stops renewal and deletes lease, content of image is garbage
+// collected along with the image afterwards
+func (pl *pullLease) release(ctx context.Context) error {
+	close(pl.stop)
+	<-pl.done
+
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	err := pl.manager.Delete(namespaces.WithNamespace(ctx, ns), pl.lease)
+	if errdefs.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,15 @@
+package registry
+
+import (
+	"github.com/containerd/containerd/errdefs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIsContentMissing(t *testing.T) {
+	assert.False(t, IsContentMissing(nil))
+	assert.True(t, IsContentMissing(errors.Wrap(errdefs.ErrNotFound, "content sha256:aa")))
+	assert.True(t, IsContentMissing(errors.New("failed to open: content digest sha256:aa: not found")))
+	assert.False(t, IsContentMissing(errors.New("plugin exited with status 1")))
+}
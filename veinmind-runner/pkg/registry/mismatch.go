@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"fmt"
+	"github.com/distribution/distribution/reference"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Policies of references whose registry differs from the server
+// scanned, credentials of the server are used for all references
+const (
+	MismatchWarn    = "warn"
+	MismatchRewrite = "rewrite"
+	MismatchError   = "error"
+)
+
+var MismatchPolicies = []string{MismatchWarn, MismatchRewrite, MismatchError}
+
+// Actions taken on a reference by server check
+const (
+	ActionMatched   = "matched"
+	ActionWarned    = "warned"
+	ActionRewritten = "rewritten"
+	ActionRejected  = "rejected"
+)
+
+// ServerMismatchError is returned for references whose registry
+// differs from the server under error policy
+type ServerMismatchError struct {
+	Ref      string
+	Registry string
+	Server   string
+}
+
+func (e *ServerMismatchError) Error() string {
+	return fmt.Sprintf("registry %s of %s differs from server %s, use --server %s or --server-mismatch rewrite",
+		e.Registry, e.Ref, e.Server, e.Registry)
+}
+
+// ServerCheck is the decision of a reference checked against server,
+// Target is the reference to scan
+type ServerCheck struct {
+	Ref      string
+	Target   string
+	Registry string
+	Action   string
+	Reason   string
+}
+
+// Mismatched reports whether registry of reference differs from server
+func (c ServerCheck) Mismatched() bool {
+	return c.Action != ActionMatched
+}
+
+// CheckPolicy checks whether policy is a known mismatch policy
+func CheckPolicy(policy string) error {
+	for _, p := range MismatchPolicies {
+		if p == policy {
+			return nil
+		}
+	}
+	return errors.Errorf("unknown server mismatch policy %#v, expect one of %s",
+		policy, strings.Join(MismatchPolicies, ","))
+}
+
+// CheckServer checks registry of reference against server, references
+// without registry are always matched. Mismatched references are kept
+// with a warning, rewritten onto server with the path kept as given,
+// or rejected with ServerMismatchError according to policy
+func CheckServer(server string, ref string, policy string) (ServerCheck, error) {
+	check := ServerCheck{Ref: ref, Target: ref, Action: ActionMatched}
+
+	r, err := reference.Parse(ref)
+	if err != nil {
+		return check, err
+	}
+	named, ok := r.(reference.Named)
+	if !ok {
+		return check, nil
+	}
+	domain := reference.Domain(named)
+	if domain == "" || normalizeRegistry(domain) == normalizeRegistry(server) {
+		return check, nil
+	}
+	check.Registry = domain
+
+	switch policy {
+	case MismatchWarn:
+		check.Action = ActionWarned
+		check.Reason = fmt.Sprintf("registry %s differs from server %s", domain, server)
+	case MismatchRewrite:
+		check.Action = ActionRewritten
+		check.Target = server + ref[len(domain):]
+		check.Reason = fmt.Sprintf("registry %s rewritten to server %s", domain, server)
+	case MismatchError:
+		check.Action = ActionRejected
+		err := &ServerMismatchError{Ref: ref, Registry: domain, Server: server}
+		check.Reason = err.Error()
+		return check, err
+	default:
+		return check, CheckPolicy(policy)
+	}
+	return check, nil
+}
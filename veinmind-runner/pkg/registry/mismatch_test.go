@@ -0,0 +1,47 @@
+package registry
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCheckServer(t *testing.T) {
+	for _, tc := range []struct {
+		server string
+		ref    string
+		policy string
+		target string
+		action string
+	}{
+		{"harbor.internal", "library/nginx:1.21", MismatchError, "library/nginx:1.21", ActionMatched},
+		{"harbor.internal", "harbor.internal/library/nginx", MismatchError, "harbor.internal/library/nginx", ActionMatched},
+		{"index.docker.io", "docker.io/library/nginx", MismatchError, "docker.io/library/nginx", ActionMatched},
+		{"harbor.internal", "docker.io/library/nginx", MismatchWarn, "docker.io/library/nginx", ActionWarned},
+		{"harbor.internal", "docker.io/library/nginx:1.21", MismatchRewrite, "harbor.internal/library/nginx:1.21", ActionRewritten},
+		{"harbor.internal:8443", "quay.io/coreos/etcd@sha256:" + testDigest, MismatchRewrite, "harbor.internal:8443/coreos/etcd@sha256:" + testDigest, ActionRewritten},
+	} {
+		check, err := CheckServer(tc.server, tc.ref, tc.policy)
+		assert.NoError(t, err, tc.ref)
+		assert.Equal(t, tc.ref, check.Ref)
+		assert.Equal(t, tc.target, check.Target, tc.ref)
+		assert.Equal(t, tc.action, check.Action, tc.ref)
+		assert.Equal(t, tc.action != ActionMatched, check.Mismatched(), tc.ref)
+	}
+}
+
+func TestCheckServerError(t *testing.T) {
+	check, err := CheckServer("harbor.internal", "docker.io/library/nginx", MismatchError)
+	assert.Equal(t, ActionRejected, check.Action)
+	assert.Equal(t, &ServerMismatchError{
+		Ref:      "docker.io/library/nginx",
+		Registry: "docker.io",
+		Server:   "harbor.internal",
+	}, err)
+	assert.Contains(t, err.Error(), "--server docker.io")
+
+	_, err = CheckServer("harbor.internal", "docker.io/library/nginx", "ignore")
+	assert.Error(t, err)
+	assert.NoError(t, CheckPolicy(MismatchRewrite))
+}
+
+const testDigest = "a3ab7fbfa8a0e9d8b3e1b8e0f9d4f6d7c1e2b3a4f5e6d7c8b9a0f1e2d3c4b5a6"
@@ -1,6 +1,13 @@
 package registry
 
-import "errors"
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/blobcache"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/regstorage"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/regtoken"
+	"github.com/containerd/containerd/platforms"
+	"github.com/pkg/errors"
+	"time"
+)
 
 type Option func(c Client) (Client, error)
 
@@ -24,3 +31,124 @@ func WithAuth(path string) Option {
 		return c, nil
 	}
 }
+
+// WithTokens authenticates to registries served by tokens with tokens
+// of their providers instead of credentials of auth config and docker
+// config, for both registry client and runtime pulls
+func WithTokens(tokens *regtoken.Cache) Option {
+	return func(c Client) (Client, error) {
+		switch c := c.(type) {
+		case *RegistryDockerClient:
+			c.tokens = tokens
+		case *RegistryContainerdClient:
+			c.tokens = tokens
+		default:
+			return nil, errors.New("registry tokens aren't supported by client")
+		}
+		return c, nil
+	}
+}
+
+// WithDockerSocket connects docker client to daemon at socket path
+// instead of the environment of docker
+func WithDockerSocket(path string) Option {
+	return func(c Client) (Client, error) {
+		dc, ok := c.(*RegistryDockerClient)
+		if !ok {
+			return nil, errors.New("docker socket is only supported by docker client")
+		}
+
+		dc.socket = path
+		return dc, nil
+	}
+}
+
+// WithPlatform pulls platform of multi-platform images, e.g.
+// linux/arm64, instead of the default platform of runtime
+func WithPlatform(platform string) Option {
+	return func(c Client) (Client, error) {
+		if _, err := platforms.Parse(platform); err != nil {
+			return nil, errors.Wrapf(err, "platform %#v", platform)
+		}
+
+		switch c := c.(type) {
+		case *RegistryDockerClient:
+			c.platform = platform
+		case *RegistryContainerdClient:
+			c.platform = platform
+		default:
+			return nil, errors.New("platform isn't supported by client")
+		}
+		return c, nil
+	}
+}
+
+// WithPullVia pulls images through path via, one of PullVias
+func WithPullVia(via string) Option {
+	return func(c Client) (Client, error) {
+		if err := CheckPullVia(via); err != nil {
+			return nil, err
+		}
+
+		switch c := c.(type) {
+		case *RegistryDockerClient:
+			c.pullVia = via
+		case *RegistryContainerdClient:
+			c.pullVia = via
+		default:
+			return nil, errors.New("pull path isn't supported by client")
+		}
+		return c, nil
+	}
+}
+
+// WithBlobCache keeps layers fetched by registry client in cache, so
+// that they are downloaded once across images and runs. Images pulled
+// by runtime don't go through cache
+func WithBlobCache(cache *blobcache.Cache) Option {
+	return func(c Client) (Client, error) {
+		switch c := c.(type) {
+		case *RegistryDockerClient:
+			c.blobCache = cache
+		case *RegistryContainerdClient:
+			c.blobCache = cache
+		default:
+			return nil, errors.New("blob cache isn't supported by client")
+		}
+		return c, nil
+	}
+}
+
+// WithStorage reads images from registry storage instead of registry,
+// images are fetched by registry client and loaded into runtime whatever
+// the pull path is, and no request is sent to registry
+func WithStorage(storage *regstorage.Storage) Option {
+	return func(c Client) (Client, error) {
+		switch c := c.(type) {
+		case *RegistryDockerClient:
+			c.storage = storage
+		case *RegistryContainerdClient:
+			c.storage = storage
+		default:
+			return nil, errors.New("registry storage isn't supported by client")
+		}
+		return c, nil
+	}
+}
+
+// WithLeaseTTL keeps content of images pulled by containerd client for
+// ttl without renewal, leases are renewed at half of ttl during scan
+func WithLeaseTTL(ttl time.Duration) Option {
+	return func(c Client) (Client, error) {
+		cc, ok := c.(*RegistryContainerdClient)
+		if !ok {
+			return nil, errors.New("lease ttl is only supported by containerd client")
+		}
+		if ttl <= 0 {
+			return nil, errors.Errorf("lease ttl %s isn't positive", ttl)
+		}
+
+		cc.leaseTTL = ttl
+		return cc, nil
+	}
+}
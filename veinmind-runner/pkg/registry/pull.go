@@ -0,0 +1,161 @@
+package registry
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/containerd/containerd/platforms"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+)
+
+// Paths images are pulled through, images pulled are the same to the
+// rest of scan whichever path pulled them
+const (
+	// PullViaRuntime delegates pulls to runtime, e.g. docker daemon or
+	// containerd client, with credentials of registry client
+	PullViaRuntime = "runtime"
+	// PullViaClient fetches images by registry client and loads them
+	// into runtime
+	PullViaClient = "client"
+	// PullViaAuto pulls by registry client, and falls back to runtime
+	// if negotiation with registry fails
+	PullViaAuto = "auto"
+)
+
+var PullVias = []string{PullViaRuntime, PullViaClient, PullViaAuto}
+
+// ErrUnsupportedManifest is returned by registry client for manifests
+// it can't fetch images of, e.g. docker schema 1 manifests
+var ErrUnsupportedManifest = errors.New("registry: manifest not supported by registry client")
+
+// errLoadStopped closes tarball written for runtime which stopped
+// loading it
+var errLoadStopped = errors.New("registry: runtime stopped loading image")
+
+// CheckPullVia checks whether via is a known pull path
+func CheckPullVia(via string) error {
+	for _, v := range PullVias {
+		if v == via {
+			return nil
+		}
+	}
+	return errors.Errorf("unknown pull path %#v, expect one of %s",
+		via, strings.Join(PullVias, ","))
+}
+
+// fetchError is failure of registry client fetching image, failures
+// of runtime loading image never fall back
+type fetchError struct {
+	err error
+}
+
+func (e *fetchError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fetchError) Unwrap() error {
+	return e.err
+}
+
+// pull pulls repo through path via, by registry client with byClient
+// and by runtime with byRuntime, both of which abort once ctx is done
+func pull(ctx context.Context, via string, repo string, byClient, byRuntime func(context.Context, string) (string, error)) (string, error) {
+	switch via {
+	case PullViaClient:
+		return byClient(ctx, repo)
+	case PullViaAuto:
+		id, err := byClient(ctx, repo)
+		if err == nil || !fallback(err) {
+			return id, err
+		}
+		log.Warnf("Pull %#v by registry client failed, fall back to runtime: %s\n", repo, err)
+		return byRuntime(ctx, repo)
+	default:
+		return byRuntime(ctx, repo)
+	}
+}
+
+// fallback reports whether pull failure err of registry client may be
+// retried by runtime. Failures negotiating with registry are retried,
+// while missing images, cancellation and failures of runtime aren't,
+// since runtime fails the same
+func fallback(err error) bool {
+	var fe *fetchError
+	if !errors.As(err, &fe) {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrUnsupportedManifest) {
+		return true
+	}
+
+	var te *transport.Error
+	if errors.As(err, &te) {
+		if te.StatusCode == http.StatusNotFound {
+			return false
+		}
+		for _, d := range te.Errors {
+			switch d.Code {
+			case transport.ManifestUnknownErrorCode, transport.NameUnknownErrorCode:
+				return false
+			}
+		}
+		return true
+	}
+
+	// Registry speaking plain http on the port of https
+	var he tls.RecordHeaderError
+	return errors.As(err, &he)
+}
+
+// remotePlatform returns platform of images fetched, default platform
+// of host is used if platform is empty, the same as runtimes
+func remotePlatform(platform string) (v1.Platform, error) {
+	spec := platforms.DefaultSpec()
+	if platform != "" {
+		var err error
+		spec, err = platforms.Parse(platform)
+		if err != nil {
+			return v1.Platform{}, errors.Wrapf(err, "platform %#v", platform)
+		}
+	}
+	return v1.Platform{
+		OS:           spec.OS,
+		Architecture: spec.Architecture,
+		Variant:      spec.Variant,
+	}, nil
+}
+
+// fetch resolves ref from registry, image of platform is picked from
+// multi-platform images. Failures are fetchError
+func fetch(ctx context.Context, ref name.Reference, platform string, options []remote.Option) (*remote.Descriptor, v1.Image, error) {
+	p, err := remotePlatform(platform)
+	if err != nil {
+		return nil, nil, err
+	}
+	options = append(options, remote.WithContext(ctx), remote.WithPlatform(p))
+
+	desc, err := remote.Get(ref, options...)
+	if err != nil {
+		return nil, nil, &fetchError{err: err}
+	}
+	switch desc.MediaType {
+	case types.DockerManifestSchema1, types.DockerManifestSchema1Signed:
+		return nil, nil, &fetchError{err: errors.Wrapf(ErrUnsupportedManifest, "%s of %s", desc.MediaType, ref)}
+	}
+
+	img, err := desc.Image()
+	if err != nil {
+		return nil, nil, &fetchError{err: err}
+	}
+	return desc, img, nil
+}
@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckPullVia(t *testing.T) {
+	for _, via := range PullVias {
+		assert.NoError(t, CheckPullVia(via))
+	}
+	assert.Error(t, CheckPullVia("daemon"))
+}
+
+func TestFallback(t *testing.T) {
+	fetchFailed := func(err error) error {
+		return errors.Wrap(&fetchError{err: err}, "pull")
+	}
+
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unauthorized", fetchFailed(&transport.Error{StatusCode: http.StatusUnauthorized}), true},
+		{"unsupported media type", fetchFailed(&transport.Error{StatusCode: http.StatusUnsupportedMediaType}), true},
+		{"schema 1", fetchFailed(errors.Wrap(ErrUnsupportedManifest, "nginx")), true},
+		{"plain http", fetchFailed(&url.Error{Op: "Get", URL: "https://harbor.internal/v2/", Err: tls.RecordHeaderError{}}), true},
+		{"not found", fetchFailed(&transport.Error{StatusCode: http.StatusNotFound}), false},
+		{"manifest unknown", fetchFailed(&transport.Error{
+			StatusCode: http.StatusBadRequest,
+			Errors:     []transport.Diagnostic{{Code: transport.ManifestUnknownErrorCode}},
+		}), false},
+		{"canceled", fetchFailed(context.Canceled), false},
+		{"connection refused", fetchFailed(errors.New("dial tcp: connection refused")), false},
+		{"runtime", &transport.Error{StatusCode: http.StatusUnauthorized}, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, fallback(c.err), c.name)
+	}
+}
+
+func TestPull(t *testing.T) {
+	var calls []string
+	byClient := func(err error) func(context.Context, string) (string, error) {
+		return func(ctx context.Context, repo string) (string, error) {
+			calls = append(calls, PullViaClient)
+			return "client", err
+		}
+	}
+	byRuntime := func(ctx context.Context, repo string) (string, error) {
+		calls = append(calls, PullViaRuntime)
+		return "runtime", nil
+	}
+	negotiation := &fetchError{err: &transport.Error{StatusCode: http.StatusForbidden}}
+	missing := &fetchError{err: &transport.Error{StatusCode: http.StatusNotFound}}
+
+	cases := []struct {
+		via   string
+		err   error
+		id    string
+		calls []string
+	}{
+		{"", nil, "runtime", []string{PullViaRuntime}},
+		{PullViaRuntime, nil, "runtime", []string{PullViaRuntime}},
+		{PullViaClient, negotiation, "client", []string{PullViaClient}},
+		{PullViaAuto, nil, "client", []string{PullViaClient}},
+		{PullViaAuto, negotiation, "runtime", []string{PullViaClient, PullViaRuntime}},
+		{PullViaAuto, missing, "client", []string{PullViaClient}},
+	}
+	for _, c := range cases {
+		calls = nil
+		id, err := pull(context.Background(), c.via, "nginx", byClient(c.err), byRuntime)
+		if c.id == "runtime" {
+			assert.NoError(t, err, c.via)
+		}
+		assert.Equal(t, c.id, id, c.via)
+		assert.Equal(t, c.calls, calls, c.via)
+	}
+}
+
+func TestPullCanceled(t *testing.T) {
+	// Registry accepting connections but never answering
+	hung := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hung.Close()
+
+	c, err := NewRegistryDockerClient(WithPullVia(PullViaClient))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = c.Pull(ctx, strings.TrimPrefix(hung.URL, "https://")+"/team/app:v1")
+	assert.Error(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(2*time.Second))
+}
@@ -0,0 +1,57 @@
+package registry
+
+import (
+	"context"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/regstorage"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// pullVia returns path images are pulled through, images of storage
+// are always read by registry client since runtimes can't pull them
+func pullVia(via string, storage *regstorage.Storage) string {
+	if storage != nil {
+		return PullViaClient
+	}
+	return via
+}
+
+// fetchImage fetches ref from storage if it's set, otherwise from
+// registry. Failures are fetchError
+func fetchImage(ctx context.Context, storage *regstorage.Storage, ref name.Reference, platform string, options []remote.Option) (*remote.Descriptor, v1.Image, error) {
+	if storage == nil {
+		return fetch(ctx, ref, platform, options)
+	}
+
+	p, err := remotePlatform(platform)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	m, img, err := storage.Image(ref.Context().RepositoryStr(), ref.Identifier(), p)
+	if err != nil {
+		return nil, nil, &fetchError{err: err}
+	}
+	return &remote.Descriptor{Descriptor: m.Descriptor, Manifest: m.Raw}, img, nil
+}
+
+// storageHasTag checks tag of ref in storage
+func storageHasTag(storage *regstorage.Storage, ref string) (bool, error) {
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return false, err
+	}
+	return storage.HasTag(r.Context().RepositoryStr(), r.Identifier())
+}
+
+// storageTags lists tags of repo in storage
+func storageTags(storage *regstorage.Storage, repo string) ([]string, error) {
+	r, err := name.NewRepository(repo)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Tags(r.RepositoryStr())
+}
@@ -0,0 +1,64 @@
+package registry
+
+import (
+	"context"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/regstorage"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const storageDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000001"
+
+// newStorage returns storage with tag 1.0 of library/nginx and team/app
+// whose manifest blobs aren't synced
+func newStorage(t *testing.T) *regstorage.Storage {
+	root := t.TempDir()
+	for _, repo := range []string{"library/nginx", "team/app"} {
+		link := filepath.Join(root, "docker/registry/v2/repositories", repo, "_manifests/tags/1.0/current/link")
+		require.NoError(t, os.MkdirAll(filepath.Dir(link), 0755))
+		require.NoError(t, ioutil.WriteFile(link, []byte(storageDigest), 0644))
+	}
+	s, err := regstorage.Open(root)
+	require.NoError(t, err)
+	return s
+}
+
+func TestPullViaStorage(t *testing.T) {
+	assert.Equal(t, PullViaAuto, pullVia(PullViaAuto, nil))
+	assert.Equal(t, PullViaClient, pullVia(PullViaRuntime, newStorage(t)))
+}
+
+func TestStorageTags(t *testing.T) {
+	s := newStorage(t)
+	c := &RegistryDockerClient{storage: s}
+
+	ok, err := c.HasTag(context.Background(), "registry.internal/team/app:1.0")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.HasTag(context.Background(), "nginx:2.0")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	tags, err := c.GetRepoTags(context.Background(), "nginx")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.0"}, tags)
+	assert.Error(t, CheckTag(context.Background(), c, "nginx:2.0"))
+}
+
+func TestFetchImageStorage(t *testing.T) {
+	s := newStorage(t)
+	ref, err := name.ParseReference("registry.internal/team/app:1.0")
+	require.NoError(t, err)
+
+	_, _, err = fetchImage(context.Background(), s, ref, "linux/amd64", nil)
+	var fe *fetchError
+	require.True(t, errors.As(err, &fe))
+	assert.True(t, regstorage.IsBlobError(err))
+	assert.False(t, fallback(err))
+}
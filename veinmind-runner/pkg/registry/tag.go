@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/distribution/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/pkg/errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DefaultTag is the tag of references without tag or digest
+const DefaultTag = "latest"
+
+// maxAvailableTags limits tags listed in TagNotFoundError
+const maxAvailableTags = 20
+
+// TagNotFoundError is returned if tag of reference doesn't exist in
+// repository, available tags are listed to correct the reference
+type TagNotFoundError struct {
+	Repo      string
+	Tag       string
+	Available []string
+}
+
+func (e *TagNotFoundError) Error() string {
+	if len(e.Available) == 0 {
+		return fmt.Sprintf("tag %s not found in %s; no tag is available", e.Tag, e.Repo)
+	}
+
+	available := e.Available
+	more := ""
+	if len(available) > maxAvailableTags {
+		more = fmt.Sprintf(" and %d more", len(available)-maxAvailableTags)
+		available = available[:maxAvailableTags]
+	}
+	return fmt.Sprintf("tag %s not found in %s; available: %s%s", e.Tag, e.Repo, strings.Join(available, ", "), more)
+}
+
+// TagChecker checks existence of tags, it's implemented by clients
+// which access registry directly
+type TagChecker interface {
+	HasTag(ctx context.Context, ref string) (bool, error)
+	GetRepoTags(ctx context.Context, repo string, options ...remote.Option) ([]string, error)
+}
+
+// WithDefaultTag returns reference with tag, references without tag or
+// digest are tagged with tag
+func WithDefaultTag(ref string, tag string) (string, error) {
+	r, err := reference.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := r.(reference.Tagged); ok {
+		return ref, nil
+	}
+	if _, ok := r.(reference.Digested); ok {
+		return ref, nil
+	}
+	return ref + ":" + tag, nil
+}
+
+// CheckTag checks that tag of reference exists, TagNotFoundError with
+// the available tags is returned if it doesn't. References by digest
+// aren't checked
+func CheckTag(ctx context.Context, c TagChecker, ref string) error {
+	r, err := reference.ParseDockerRef(ref)
+	if err != nil {
+		return err
+	}
+	if _, ok := r.(reference.Digested); ok {
+		return nil
+	}
+	tagged, ok := r.(reference.Tagged)
+	if !ok {
+		return nil
+	}
+
+	found, err := c.HasTag(ctx, ref)
+	if err != nil {
+		return errors.Wrapf(err, "check tag of %s", ref)
+	}
+	if found {
+		return nil
+	}
+
+	tags, err := c.GetRepoTags(ctx, r.Name())
+	if err != nil {
+		return errors.Wrapf(err, "tag %s not found in %s, list tags", tagged.Tag(), r.Name())
+	}
+	sort.Strings(tags)
+	return &TagNotFoundError{Repo: r.Name(), Tag: tagged.Tag(), Available: tags}
+}
+
+// HasTag checks whether manifest of reference exists by HEAD request,
+// or in registry storage if client reads images from it
+func (client *RegistryDockerClient) HasTag(ctx context.Context, ref string) (bool, error) {
+	if client.storage != nil {
+		return storageHasTag(client.storage, ref)
+	}
+
+	options, err := client.RemoteOptions(ref)
+	if err != nil {
+		return false, err
+	}
+
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return false, err
+	}
+
+	options = append(options, remote.WithContext(ctx))
+	if _, err := remote.Head(r, options...); err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
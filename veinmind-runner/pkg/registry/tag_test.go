@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"context"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+type fakeTagChecker struct {
+	tags    []string
+	listErr error
+}
+
+func (c *fakeTagChecker) HasTag(ctx context.Context, ref string) (bool, error) {
+	for _, t := range c.tags {
+		if strings.HasSuffix(ref, ":"+t) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *fakeTagChecker) GetRepoTags(ctx context.Context, repo string, options ...remote.Option) ([]string, error) {
+	return c.tags, c.listErr
+}
+
+func TestWithDefaultTag(t *testing.T) {
+	for _, tc := range []struct {
+		ref      string
+		expected string
+	}{
+		{"nginx", "nginx:v1"},
+		{"harbor.internal:8443/team/app", "harbor.internal:8443/team/app:v1"},
+		{"nginx:1.21", "nginx:1.21"},
+		{"nginx@sha256:" + testDigest, "nginx@sha256:" + testDigest},
+	} {
+		ref, err := WithDefaultTag(tc.ref, "v1")
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, ref)
+	}
+
+	_, err := WithDefaultTag("Invalid Ref", "v1")
+	assert.Error(t, err)
+}
+
+func TestCheckTag(t *testing.T) {
+	c := &fakeTagChecker{tags: []string{"v1.1", "stable", "v1"}}
+
+	assert.NoError(t, CheckTag(context.Background(), c, "harbor.internal/team/app:v1"))
+	assert.NoError(t, CheckTag(context.Background(), c, "harbor.internal/team/app@sha256:"+testDigest))
+
+	err := CheckTag(context.Background(), c, "harbor.internal/team/app:v2")
+	nf := &TagNotFoundError{}
+	assert.True(t, errors.As(err, &nf))
+	assert.Equal(t, "tag v2 not found in harbor.internal/team/app; available: stable, v1, v1.1", err.Error())
+
+	c.listErr = errors.New("unauthorized")
+	err = CheckTag(context.Background(), c, "harbor.internal/team/app:v2")
+	assert.Contains(t, err.Error(), "tag v2 not found")
+	assert.Contains(t, err.Error(), "unauthorized")
+}
+
+func TestTagNotFoundError(t *testing.T) {
+	err := &TagNotFoundError{Repo: "app", Tag: "v2"}
+	assert.Equal(t, "tag v2 not found in app; no tag is available", err.Error())
+
+	for i := 0; i < maxAvailableTags+2; i++ {
+		err.Available = append(err.Available, "t")
+	}
+	assert.True(t, strings.HasSuffix(err.Error(), " and 2 more"))
+}
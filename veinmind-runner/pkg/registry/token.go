@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"context"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/regtoken"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+// tokenAuthenticator authenticates registry client with token of
+// registry, which is taken from cache on each authorization so that
+// expired and rejected tokens are renewed
+type tokenAuthenticator struct {
+	tokens   *regtoken.Cache
+	registry string
+}
+
+func (a *tokenAuthenticator) Authorization() (*authn.AuthConfig, error) {
+	token, err := a.tokens.Token(context.Background(), a.registry)
+	if err != nil {
+		return nil, err
+	}
+	return &authn.AuthConfig{
+		Username:      token.Username,
+		Password:      token.Password,
+		RegistryToken: token.Bearer,
+	}, nil
+}
+
+// tokenAuthorizer authorizes requests of containerd resolver with
+// bearer tokens of registries, basic tokens go through authorizer of
+// resolver which fetches registry tokens with them
+type tokenAuthorizer struct {
+	docker.Authorizer
+	tokens *regtoken.Cache
+}
+
+func (a *tokenAuthorizer) Authorize(ctx context.Context, req *http.Request) error {
+	registry := containerdRegistry(req.URL.Host)
+	if a.tokens.Serves(registry) {
+		token, err := a.tokens.Token(ctx, registry)
+		if err != nil {
+			return err
+		}
+		if token.Bearer != "" {
+			req.Header.Set("Authorization", token.Header())
+			return nil
+		}
+	}
+	return a.Authorizer.Authorize(ctx, req)
+}
+
+// AddResponses fetches bearer token rejected by registry anew, so that
+// containerd retries the request with it once
+func (a *tokenAuthorizer) AddResponses(ctx context.Context, responses []*http.Response) error {
+	last := responses[len(responses)-1]
+	registry := containerdRegistry(last.Request.URL.Host)
+	header := last.Request.Header.Get("Authorization")
+	if token, err := a.tokens.Token(ctx, registry); err == nil && token.Bearer != "" && header == token.Header() {
+		a.tokens.Reject(registry, token)
+		fresh, err := a.tokens.Token(ctx, registry)
+		if err != nil {
+			return err
+		}
+		if fresh.Header() == header {
+			return errors.Errorf("token of %s is rejected by registry", registry)
+		}
+		return nil
+	}
+	return a.Authorizer.AddResponses(ctx, responses)
+}
+
+// containerdRegistry returns registry of host resolved by containerd,
+// host of docker hub is index.docker.io
+func containerdRegistry(host string) string {
+	if host == dockerHubHost {
+		return name.DefaultRegistry
+	}
+	return normalizeRegistry(host)
+}
+
+// withToken calls fn with token of registry if tokens serve it, and
+// once more with a token fetched anew if registry rejects it. It's for
+// pulls by runtimes, which can't renew tokens themselves
+func withToken(ctx context.Context, tokens *regtoken.Cache, registry string, fn func(token *regtoken.Token) error) error {
+	if !tokens.Serves(registry) {
+		return fn(nil)
+	}
+
+	token, err := tokens.Token(ctx, registry)
+	if err != nil {
+		return err
+	}
+	err = fn(&token)
+	if err == nil || errcode.Classify(err) != errcode.RegistryAuth {
+		return err
+	}
+
+	tokens.Reject(registry, token)
+	fresh, ferr := tokens.Token(ctx, registry)
+	if ferr != nil || fresh.Header() == token.Header() {
+		return err
+	}
+	return fn(&fresh)
+}
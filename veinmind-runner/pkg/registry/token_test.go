@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"context"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/regtoken"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+// tokenProvider numbers tokens of registries under example.com
+type tokenProvider struct {
+	fetches int
+	same    bool
+}
+
+func (p *tokenProvider) Name() string {
+	return "test"
+}
+
+func (p *tokenProvider) Match(registry string) bool {
+	return strings.HasSuffix(registry, "example.com")
+}
+
+func (p *tokenProvider) Fetch(ctx context.Context, registry string) (regtoken.Token, error) {
+	p.fetches++
+	if p.same {
+		return regtoken.Token{Bearer: "token"}, nil
+	}
+	return regtoken.Token{Bearer: strings.Repeat("t", p.fetches)}, nil
+}
+
+func TestWithToken(t *testing.T) {
+	p := &tokenProvider{}
+	tokens := regtoken.NewCache(nil, p)
+
+	// Registries without provider pull with credentials
+	err := withToken(context.Background(), tokens, "index.docker.io", func(token *regtoken.Token) error {
+		assert.Nil(t, token)
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, withToken(context.Background(), nil, "r.example.com", func(token *regtoken.Token) error {
+		assert.Nil(t, token)
+		return nil
+	}))
+
+	// Rejected token is fetched anew and pulled with once more
+	seen := []string{}
+	err = withToken(context.Background(), tokens, "r.example.com", func(token *regtoken.Token) error {
+		seen = append(seen, token.Bearer)
+		if token.Bearer == "t" {
+			return errors.New("Error response from daemon: Head https://r.example.com/v2/app/manifests/1.0: unauthorized")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"t", "tt"}, seen)
+
+	// Other failures aren't retried
+	err = withToken(context.Background(), tokens, "r.example.com", func(token *regtoken.Token) error {
+		return errors.New("manifest unknown")
+	})
+	assert.EqualError(t, err, "manifest unknown")
+	assert.Equal(t, 2, p.fetches)
+
+	// Tokens fetched anew the same aren't pulled with again
+	same := &tokenProvider{same: true}
+	calls := 0
+	err = withToken(context.Background(), regtoken.NewCache(nil, same), "r.example.com", func(token *regtoken.Token) error {
+		calls++
+		return errors.New("unauthorized")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 2, same.fetches)
+}
+
+func TestContainerdRegistry(t *testing.T) {
+	assert.Equal(t, "index.docker.io", containerdRegistry(dockerHubHost))
+	assert.Equal(t, "r.example.com:5000", containerdRegistry("r.example.com:5000"))
+}
@@ -0,0 +1,421 @@
+// Package registrycheck diagnoses access to a registry step by step:
+// v2 ping, token exchange, catalog and manifest HEAD of a sample repo,
+// the challenges returned by registry are recorded on the way
+package registrycheck
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Steps of check
+const (
+	StepPing     = "ping"
+	StepToken    = "token"
+	StepCatalog  = "catalog"
+	StepManifest = "manifest"
+)
+
+// Status of step
+const (
+	StatusOK      = "ok"
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+)
+
+// dockerHubHosts are aliases of docker hub, whose v2 endpoint lives
+// on another host
+var dockerHubHosts = map[string]struct{}{
+	"docker.io":       {},
+	"index.docker.io": {},
+}
+
+const dockerHubEndpoint = "registry-1.docker.io"
+
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+type Options struct {
+	Server   string
+	Username string
+	Password string
+	// Repo is the sample repo whose manifest is checked, e.g.
+	// library/alpine:3.16, the first repo of catalog is used if empty
+	Repo string
+	// PlainHTTP accesses registry without TLS
+	PlainHTTP bool
+	Client    *http.Client
+}
+
+// Step is the outcome of a step, Challenges are values of
+// WWW-Authenticate headers returned during the step
+type Step struct {
+	Name       string
+	Status     string
+	HTTPStatus int
+	Detail     string
+	Challenges []string
+}
+
+type checker struct {
+	ctx      context.Context
+	opts     Options
+	base     string
+	client   *http.Client
+	redactor *strings.Replacer
+	// challenge is the bearer challenge of ping, token is the token
+	// exchanged for scope
+	challenge map[string]string
+	scheme    string
+	scope     string
+	token     string
+}
+
+// Check runs steps in order and calls report with outcome of each,
+// the first failing step stops the check and its error is returned.
+// Secrets never appear in steps
+func Check(ctx context.Context, opts Options, report func(Step)) error {
+	host := opts.Server
+	if _, ok := dockerHubHosts[host]; ok {
+		host = dockerHubEndpoint
+	}
+	scheme := "https"
+	if opts.PlainHTTP {
+		scheme = "http"
+	}
+
+	c := &checker{
+		ctx:    ctx,
+		opts:   opts,
+		base:   scheme + "://" + host,
+		client: opts.Client,
+	}
+	if c.client == nil {
+		c.client = http.DefaultClient
+	}
+
+	secrets := []string{}
+	if opts.Password != "" {
+		secrets = append(secrets, opts.Password, "<redacted>")
+		basic := base64.StdEncoding.EncodeToString([]byte(opts.Username + ":" + opts.Password))
+		secrets = append(secrets, basic, "<redacted>")
+	}
+	c.redactor = strings.NewReplacer(secrets...)
+
+	for _, step := range []func() (Step, error){c.ping, c.exchange, c.catalog, c.manifest} {
+		s, err := step()
+		if err != nil {
+			s.Status = StatusFailed
+			s.Detail = c.redact(err.Error())
+			report(s)
+			return errors.Errorf("%s failed: %s", s.Name, s.Detail)
+		}
+		s.Detail = c.redact(s.Detail)
+		report(s)
+	}
+	return nil
+}
+
+func (c *checker) redact(s string) string {
+	if c.token != "" {
+		s = strings.ReplaceAll(s, c.token, "<redacted>")
+	}
+	return c.redactor.Replace(s)
+}
+
+func (c *checker) ping() (Step, error) {
+	s := Step{Name: StepPing}
+	resp, err := c.do(http.MethodGet, c.base+"/v2/", nil)
+	if err != nil {
+		return s, err
+	}
+	defer resp.Body.Close()
+	s.HTTPStatus = resp.StatusCode
+	s.Challenges = resp.Header.Values("WWW-Authenticate")
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		s.Status = StatusOK
+		s.Detail = "registry requires no authentication"
+	case http.StatusUnauthorized:
+		if len(s.Challenges) == 0 {
+			return s, errors.New("registry requires authentication without challenge")
+		}
+		c.scheme, c.challenge = ParseChallenge(s.Challenges[0])
+		s.Status = StatusOK
+		s.Detail = fmt.Sprintf("registry requires %s authentication", c.scheme)
+	default:
+		return s, unexpected(resp)
+	}
+	return s, nil
+}
+
+// exchange exchanges token with credentials for bearer challenge, or
+// verifies credentials for basic challenge
+func (c *checker) exchange() (Step, error) {
+	s := Step{Name: StepToken}
+	switch strings.ToLower(c.scheme) {
+	case "":
+		s.Status = StatusSkipped
+		s.Detail = "no challenge"
+		return s, nil
+	case "basic":
+		if c.opts.Username == "" {
+			return s, errors.New("basic authentication is required but no credential is given")
+		}
+		resp, err := c.do(http.MethodGet, c.base+"/v2/", nil)
+		if err != nil {
+			return s, err
+		}
+		defer resp.Body.Close()
+		s.HTTPStatus = resp.StatusCode
+		s.Challenges = resp.Header.Values("WWW-Authenticate")
+		if resp.StatusCode != http.StatusOK {
+			return s, unexpected(resp)
+		}
+		s.Status = StatusOK
+		s.Detail = fmt.Sprintf("credential of %s accepted", c.opts.Username)
+		return s, nil
+	case "bearer":
+		scope := "registry:catalog:*"
+		if c.opts.Repo != "" {
+			scope = repoScope(c.opts.Repo)
+		}
+		status, err := c.authorize(scope)
+		s.HTTPStatus = status
+		if err != nil {
+			return s, err
+		}
+		s.Status = StatusOK
+		s.Detail = fmt.Sprintf("token of scope %s received from %s", scope, c.challenge["realm"])
+		if c.opts.Username == "" {
+			s.Detail += " anonymously"
+		}
+		return s, nil
+	default:
+		return s, errors.Errorf("unsupported authentication scheme %s", c.scheme)
+	}
+}
+
+func (c *checker) catalog() (Step, error) {
+	s := Step{Name: StepCatalog}
+	if strings.EqualFold(c.scheme, "bearer") && c.scope != "registry:catalog:*" {
+		if _, err := c.authorize("registry:catalog:*"); err != nil {
+			s.Status = StatusSkipped
+			s.Detail = "no token of catalog: " + err.Error()
+			return s, nil
+		}
+	}
+
+	resp, err := c.do(http.MethodGet, c.base+"/v2/_catalog?n=10", nil)
+	if err != nil {
+		return s, err
+	}
+	defer resp.Body.Close()
+	s.HTTPStatus = resp.StatusCode
+	s.Challenges = resp.Header.Values("WWW-Authenticate")
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		s.Status = StatusSkipped
+		s.Detail = "catalog isn't allowed"
+		return s, nil
+	default:
+		return s, unexpected(resp)
+	}
+
+	catalog := struct {
+		Repositories []string `json:"repositories"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&catalog); err != nil {
+		return s, errors.Wrap(err, "decode catalog")
+	}
+	s.Status = StatusOK
+	s.Detail = fmt.Sprintf("%d repo(s) listed", len(catalog.Repositories))
+	if c.opts.Repo == "" && len(catalog.Repositories) > 0 {
+		c.opts.Repo = catalog.Repositories[0]
+		s.Detail += ", use " + c.opts.Repo + " as sample repo"
+	}
+	return s, nil
+}
+
+func (c *checker) manifest() (Step, error) {
+	s := Step{Name: StepManifest}
+	if c.opts.Repo == "" {
+		return s, errors.New("no sample repo, specify --repo")
+	}
+	name, ref := splitRepo(c.opts.Repo)
+
+	if strings.EqualFold(c.scheme, "bearer") && c.scope != repoScope(c.opts.Repo) {
+		if _, err := c.authorize(repoScope(c.opts.Repo)); err != nil {
+			return s, err
+		}
+	}
+
+	header := http.Header{}
+	header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	resp, err := c.do(http.MethodHead, c.base+"/v2/"+name+"/manifests/"+ref, header)
+	if err != nil {
+		return s, err
+	}
+	defer resp.Body.Close()
+	s.HTTPStatus = resp.StatusCode
+	s.Challenges = resp.Header.Values("WWW-Authenticate")
+	if resp.StatusCode != http.StatusOK {
+		return s, unexpected(resp)
+	}
+
+	s.Status = StatusOK
+	s.Detail = fmt.Sprintf("manifest of %s:%s found", name, ref)
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		s.Detail += " with digest " + digest
+	}
+	return s, nil
+}
+
+// authorize exchanges token of scope from realm of bearer challenge
+func (c *checker) authorize(scope string) (int, error) {
+	realm := c.challenge["realm"]
+	if realm == "" {
+		return 0, errors.New("bearer challenge has no realm")
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return 0, err
+	}
+	q := u.Query()
+	if service := c.challenge["service"]; service != "" {
+		q.Set("service", service)
+	}
+	q.Set("scope", scope)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	if c.opts.Username != "" {
+		req.SetBasicAuth(c.opts.Username, c.opts.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, unexpected(resp)
+	}
+
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return resp.StatusCode, errors.Wrap(err, "decode token")
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return resp.StatusCode, errors.New("token response has no token")
+	}
+	c.token, c.scope = token.Token, scope
+	return resp.StatusCode, nil
+}
+
+func (c *checker) do(method string, u string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case strings.EqualFold(c.scheme, "basic") && c.opts.Username != "":
+		req.SetBasicAuth(c.opts.Username, c.opts.Password)
+	}
+	return c.client.Do(req)
+}
+
+// ParseChallenge parses scheme and parameters of WWW-Authenticate
+// header, e.g. Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func ParseChallenge(header string) (string, map[string]string) {
+	params := map[string]string{}
+	header = strings.TrimSpace(header)
+	i := strings.IndexByte(header, ' ')
+	if i < 0 {
+		return header, params
+	}
+	scheme, rest := header[:i], header[i+1:]
+
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+		params[key] = strings.TrimSpace(value)
+	}
+	return scheme, params
+}
+
+// splitRepo splits repo into name and tag or digest, latest is used
+// if neither is given
+func splitRepo(repo string) (string, string) {
+	if i := strings.IndexByte(repo, '@'); i >= 0 {
+		return repo[:i], repo[i+1:]
+	}
+	if i := strings.LastIndexByte(repo, ':'); i > strings.LastIndexByte(repo, '/') {
+		return repo[:i], repo[i+1:]
+	}
+	return repo, "latest"
+}
+
+func repoScope(repo string) string {
+	name, _ := splitRepo(repo)
+	return "repository:" + name + ":pull"
+}
+
+func unexpected(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		return errors.Errorf("unexpected status %s", resp.Status)
+	}
+	return errors.Errorf("unexpected status %s: %s", resp.Status, msg)
+}
@@ -0,0 +1,174 @@
+package registrycheck
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testUsername = "robot"
+	testPassword = "s3cret-password"
+	testToken    = "t0ken-value"
+)
+
+// newBearerRegistry serves a registry requiring bearer token, catalog
+// is forbidden unless allowCatalog
+func newBearerRegistry(t *testing.T, allowCatalog bool) *httptest.Server {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	challenge := `Bearer realm="` + srv.URL + `/token",service="test-registry"`
+
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			w.Header().Set("WWW-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case !authorized(w, r):
+		case r.URL.Path == "/v2/_catalog":
+			if !allowCatalog {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string][]string{"repositories": {"team/app", "team/web"}})
+		case r.URL.Path == "/v2/team/app/manifests/v1":
+			assert.Equal(t, http.MethodHead, r.Method)
+			assert.Contains(t, r.Header.Get("Accept"), "manifest.v2+json")
+			w.Header().Set("Docker-Content-Digest", "sha256:aa")
+		case r.URL.Path == "/v2/":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != testUsername || password != testPassword {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"details":"incorrect username or password ` + password + `"}`))
+			return
+		}
+		assert.Equal(t, "test-registry", r.URL.Query().Get("service"))
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": testToken})
+	})
+	return srv
+}
+
+func runCheck(srv *httptest.Server, opts Options) ([]Step, error) {
+	opts.Server = strings.TrimPrefix(srv.URL, "http://")
+	opts.PlainHTTP = true
+	steps := []Step{}
+	err := Check(context.Background(), opts, func(s Step) {
+		steps = append(steps, s)
+	})
+	return steps, err
+}
+
+func statuses(steps []Step) []string {
+	result := []string{}
+	for _, s := range steps {
+		result = append(result, s.Name+":"+s.Status)
+	}
+	return result
+}
+
+func TestCheckBearer(t *testing.T) {
+	srv := newBearerRegistry(t, true)
+	defer srv.Close()
+
+	// Sample repo of catalog has no latest tag
+	steps, err := runCheck(srv, Options{Username: testUsername, Password: testPassword})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"ping:ok", "token:ok", "catalog:ok", "manifest:failed"}, statuses(steps))
+	assert.Contains(t, steps[0].Challenges[0], `service="test-registry"`)
+	assert.Contains(t, steps[2].Detail, "use team/app as sample repo")
+
+	steps, err = runCheck(srv, Options{Username: testUsername, Password: testPassword, Repo: "team/app:v1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ping:ok", "token:ok", "catalog:ok", "manifest:ok"}, statuses(steps))
+	assert.Contains(t, steps[3].Detail, "sha256:aa")
+	for _, s := range steps {
+		assert.NotContains(t, s.Detail, testToken)
+	}
+}
+
+func TestCheckForbiddenCatalog(t *testing.T) {
+	srv := newBearerRegistry(t, false)
+	defer srv.Close()
+
+	steps, err := runCheck(srv, Options{Username: testUsername, Password: testPassword, Repo: "team/app:v1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ping:ok", "token:ok", "catalog:skipped", "manifest:ok"}, statuses(steps))
+}
+
+func TestCheckStopsAtFailure(t *testing.T) {
+	srv := newBearerRegistry(t, true)
+	defer srv.Close()
+
+	steps, err := runCheck(srv, Options{Username: testUsername, Password: "wrong-" + testPassword})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"ping:ok", "token:failed"}, statuses(steps))
+	assert.Equal(t, http.StatusUnauthorized, steps[1].HTTPStatus)
+	// Password echoed by registry is redacted
+	assert.NotContains(t, steps[1].Detail, testPassword)
+	assert.NotContains(t, err.Error(), testPassword)
+	assert.Contains(t, steps[1].Detail, "<redacted>")
+}
+
+func TestCheckBasic(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != testUsername || password != testPassword {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/v2/_catalog" {
+			_ = json.NewEncoder(w).Encode(map[string][]string{"repositories": {}})
+		}
+	}))
+	defer srv.Close()
+
+	steps, err := runCheck(srv, Options{Username: testUsername, Password: testPassword, Repo: "team/app"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ping:ok", "token:ok", "catalog:ok", "manifest:ok"}, statuses(steps))
+	assert.Contains(t, steps[3].Detail, "team/app:latest")
+
+	steps, err = runCheck(srv, Options{Repo: "team/app"})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"ping:ok", "token:failed"}, statuses(steps))
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := ParseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull,push"`)
+	assert.Equal(t, "Bearer", scheme)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/alpine:pull,push",
+	}, params)
+
+	scheme, params = ParseChallenge("Basic realm=registry")
+	assert.Equal(t, "Basic", scheme)
+	assert.Equal(t, "registry", params["realm"])
+}
+
+func TestSplitRepo(t *testing.T) {
+	for _, tc := range []struct{ repo, name, ref string }{
+		{"team/app", "team/app", "latest"},
+		{"team/app:v1", "team/app", "v1"},
+		{"team/app@sha256:aa", "team/app", "sha256:aa"},
+	} {
+		name, ref := splitRepo(tc.repo)
+		assert.Equal(t, tc.name, name)
+		assert.Equal(t, tc.ref, ref)
+	}
+}
@@ -0,0 +1,460 @@
+// Package regstorage reads images from storage directory of registry:2,
+// e.g. a copy synced to sites without access to the registry, without
+// any request to the registry. Repositories and tags are enumerated
+// from the layout of the directory, and blobs are verified against
+// their digests since copies may be corrupt or partially synced
+package regstorage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/pkg/errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// v2Dir is the directory of storage driver holding registry data
+const v2Dir = "docker/registry/v2"
+
+// Reasons of blob errors
+const (
+	ReasonMissing = "missing"
+	ReasonSize    = "size mismatch"
+	ReasonDigest  = "digest mismatch"
+)
+
+// ErrUnsupportedManifest is returned for manifests images can't be
+// read of, e.g. docker schema 1 manifests
+var ErrUnsupportedManifest = errors.New("regstorage: manifest not supported")
+
+// ErrNotFound is returned for repositories, tags and manifests absent
+// from storage
+var ErrNotFound = errors.New("regstorage: not found")
+
+// BlobError is a blob of image which is missing or corrupt in storage,
+// e.g. not synced yet or truncated by an interrupted sync
+type BlobError struct {
+	Digest string
+	Reason string
+	Path   string
+}
+
+func (e *BlobError) Error() string {
+	return fmt.Sprintf("blob %s %s in registry storage: %s", e.Digest, e.Reason, e.Path)
+}
+
+// IsBlobError reports whether err is caused by a missing or corrupt blob
+func IsBlobError(err error) bool {
+	var be *BlobError
+	return errors.As(err, &be)
+}
+
+// Storage is storage directory of registry:2
+type Storage struct {
+	root string
+}
+
+// Open opens storage of registry at root, which is the rootdirectory
+// of filesystem storage driver holding docker/registry/v2
+func Open(root string) (*Storage, error) {
+	s := &Storage{root: root}
+	info, err := os.Stat(s.path("repositories"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "registry storage %s", root)
+	}
+	if !info.IsDir() {
+		return nil, errors.Errorf("registry storage %s: %s isn't a directory", root, s.path("repositories"))
+	}
+	return s, nil
+}
+
+// Root returns root directory of storage
+func (s *Storage) Root() string {
+	return s.root
+}
+
+func (s *Storage) path(elem ...string) string {
+	return filepath.Join(append([]string{s.root, v2Dir}, elem...)...)
+}
+
+func (s *Storage) repoPath(repo string, elem ...string) string {
+	return s.path(append([]string{"repositories", filepath.FromSlash(repo)}, elem...)...)
+}
+
+func (s *Storage) blobPath(h v1.Hash) string {
+	dir := h.Hex
+	if len(dir) > 2 {
+		dir = dir[:2]
+	}
+	return s.path("blobs", h.Algorithm, dir, h.Hex, "data")
+}
+
+// Repositories returns names of repositories sorted, repositories are
+// directories holding manifests and may be nested in others
+func (s *Storage) Repositories() ([]string, error) {
+	base := s.path("repositories")
+	repos := []string{}
+	err := filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || path == base {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), "_") {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(path, "_manifests")); err == nil {
+			rel, err := filepath.Rel(base, path)
+			if err != nil {
+				return err
+			}
+			repos = append(repos, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(repos)
+	return repos, nil
+}
+
+// Tags returns tags of repo sorted, tags without current link, e.g.
+// partially synced, are left out
+func (s *Storage) Tags(repo string) ([]string, error) {
+	entries, err := ioutil.ReadDir(s.repoPath(repo, "_manifests", "tags"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Wrapf(ErrNotFound, "repository %s", repo)
+		}
+		return nil, err
+	}
+
+	tags := []string{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(s.repoPath(repo, "_manifests", "tags", e.Name(), "current", "link")); err == nil {
+			tags = append(tags, e.Name())
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// HasTag reports whether tag of repo exists
+func (s *Storage) HasTag(repo string, tag string) (bool, error) {
+	_, err := s.Resolve(repo, tag)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Resolve returns digest of manifest of repo by ref, which is a tag or
+// a digest
+func (s *Storage) Resolve(repo string, ref string) (v1.Hash, error) {
+	if strings.Contains(ref, ":") {
+		h, err := v1.NewHash(ref)
+		if err != nil {
+			return v1.Hash{}, err
+		}
+		if _, err := s.readLink(s.repoPath(repo, "_manifests", "revisions", h.Algorithm, h.Hex, "link")); err != nil {
+			return v1.Hash{}, errors.Wrapf(err, "manifest %s of %s", ref, repo)
+		}
+		return h, nil
+	}
+
+	h, err := s.readLink(s.repoPath(repo, "_manifests", "tags", ref, "current", "link"))
+	if err != nil {
+		return v1.Hash{}, errors.Wrapf(err, "tag %s of %s", ref, repo)
+	}
+	return h, nil
+}
+
+// readLink reads digest of link file, ErrNotFound is returned if it
+// doesn't exist
+func (s *Storage) readLink(path string) (v1.Hash, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return v1.Hash{}, ErrNotFound
+		}
+		return v1.Hash{}, err
+	}
+	h, err := v1.NewHash(strings.TrimSpace(string(b)))
+	if err != nil {
+		return v1.Hash{}, errors.Wrapf(err, "link %s", path)
+	}
+	return h, nil
+}
+
+// ReadBlob reads blob of digest h, which is verified against h
+func (s *Storage) ReadBlob(h v1.Hash) ([]byte, error) {
+	path := s.blobPath(h)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &BlobError{Digest: h.String(), Reason: ReasonMissing, Path: path}
+		}
+		return nil, err
+	}
+	if sum := sha256.Sum256(b); h.Algorithm != "sha256" || hex.EncodeToString(sum[:]) != h.Hex {
+		return nil, &BlobError{Digest: h.String(), Reason: ReasonDigest, Path: path}
+	}
+	return b, nil
+}
+
+// checkBlob checks blob of descriptor is present with the size of it,
+// which catches blobs not synced or truncated without reading them
+func (s *Storage) checkBlob(d v1.Descriptor) error {
+	path := s.blobPath(d.Digest)
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &BlobError{Digest: d.Digest.String(), Reason: ReasonMissing, Path: path}
+		}
+		return err
+	}
+	if info.Size() != d.Size {
+		return &BlobError{Digest: d.Digest.String(), Reason: ReasonSize, Path: path}
+	}
+	return nil
+}
+
+// openBlob opens blob of descriptor, content is verified against digest
+// and size of it once it's read through
+func (s *Storage) openBlob(d v1.Descriptor) (io.ReadCloser, error) {
+	if d.Digest.Algorithm != "sha256" {
+		return nil, errors.Errorf("unsupported digest %s", d.Digest)
+	}
+	path := s.blobPath(d.Digest)
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &BlobError{Digest: d.Digest.String(), Reason: ReasonMissing, Path: path}
+		}
+		return nil, err
+	}
+	return &verifyReader{f: f, h: sha256.New(), desc: d, path: path}, nil
+}
+
+// verifyReader fails reading blob at the end if its content doesn't
+// match descriptor
+type verifyReader struct {
+	f    *os.File
+	h    hash.Hash
+	n    int64
+	desc v1.Descriptor
+	path string
+}
+
+func (r *verifyReader) Read(p []byte) (int, error) {
+	n, err := r.f.Read(p)
+	r.h.Write(p[:n])
+	r.n += int64(n)
+	if err != io.EOF {
+		return n, err
+	}
+	if r.n != r.desc.Size {
+		return n, &BlobError{Digest: r.desc.Digest.String(), Reason: ReasonSize, Path: r.path}
+	}
+	if hex.EncodeToString(r.h.Sum(nil)) != r.desc.Digest.Hex {
+		return n, &BlobError{Digest: r.desc.Digest.String(), Reason: ReasonDigest, Path: r.path}
+	}
+	return n, io.EOF
+}
+
+func (r *verifyReader) Close() error {
+	return r.f.Close()
+}
+
+// Manifest is manifest of reference read from storage, which is the
+// index of image for multi-platform images
+type Manifest struct {
+	v1.Descriptor
+	Raw []byte
+}
+
+// Image returns manifest of repo by ref and image of platform, which is
+// picked from index for multi-platform images. Config and presence
+// and sizes of layers are checked, contents of layers are verified
+// while they're read
+func (s *Storage) Image(repo string, ref string, platform v1.Platform) (*Manifest, v1.Image, error) {
+	h, err := s.Resolve(repo, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	top, err := s.manifest(h)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m := top
+	if top.MediaType.IsIndex() {
+		index, err := v1.ParseIndexManifest(bytes.NewReader(top.Raw))
+		if err != nil {
+			return nil, nil, err
+		}
+		child, ok := matchPlatform(index.Manifests, platform)
+		if !ok {
+			return nil, nil, errors.Wrapf(ErrNotFound, "no image of platform %s/%s in %s:%s", platform.OS, platform.Architecture, repo, ref)
+		}
+		m, err = s.manifest(child.Digest)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	switch m.MediaType {
+	case types.DockerManifestSchema2, types.OCIManifestSchema1:
+	default:
+		return nil, nil, errors.Wrapf(ErrUnsupportedManifest, "%s of %s:%s", m.MediaType, repo, ref)
+	}
+
+	img, err := s.image(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	return top, img, nil
+}
+
+// manifest reads manifest of digest h, media type is taken from the
+// manifest itself
+func (s *Storage) manifest(h v1.Hash) (*Manifest, error) {
+	raw, err := s.ReadBlob(h)
+	if err != nil {
+		return nil, err
+	}
+	var probe struct {
+		SchemaVersion int             `json:"schemaVersion"`
+		MediaType     types.MediaType `json:"mediaType"`
+		Manifests     json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return nil, errors.Wrapf(err, "manifest %s", h)
+	}
+
+	mediaType := probe.MediaType
+	switch {
+	case mediaType != "":
+	case probe.SchemaVersion == 1:
+		mediaType = types.DockerManifestSchema1
+	case probe.Manifests != nil:
+		mediaType = types.OCIImageIndex
+	default:
+		mediaType = types.OCIManifestSchema1
+	}
+	return &Manifest{
+		Descriptor: v1.Descriptor{MediaType: mediaType, Digest: h, Size: int64(len(raw))},
+		Raw:        raw,
+	}, nil
+}
+
+// matchPlatform returns manifest of platform, variant is matched only
+// if platform has one
+func matchPlatform(manifests []v1.Descriptor, platform v1.Platform) (v1.Descriptor, bool) {
+	for _, d := range manifests {
+		if d.Platform == nil {
+			continue
+		}
+		if d.Platform.OS != platform.OS || d.Platform.Architecture != platform.Architecture {
+			continue
+		}
+		if platform.Variant != "" && d.Platform.Variant != platform.Variant {
+			continue
+		}
+		return d, true
+	}
+	return v1.Descriptor{}, false
+}
+
+// image returns image of manifest m, blobs of which are checked before
+func (s *Storage) image(m *Manifest) (v1.Image, error) {
+	manifest, err := v1.ParseManifest(bytes.NewReader(m.Raw))
+	if err != nil {
+		return nil, errors.Wrapf(err, "manifest %s", m.Digest)
+	}
+	config, err := s.ReadBlob(manifest.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range manifest.Layers {
+		if err := s.checkBlob(l); err != nil {
+			return nil, err
+		}
+	}
+
+	return partial.CompressedToImage(&compressedImage{
+		storage:  s,
+		manifest: m,
+		parsed:   manifest,
+		config:   config,
+	})
+}
+
+// compressedImage is image of storage, layers are read compressed as
+// they're stored
+type compressedImage struct {
+	storage  *Storage
+	manifest *Manifest
+	parsed   *v1.Manifest
+	config   []byte
+}
+
+func (i *compressedImage) MediaType() (types.MediaType, error) {
+	return i.manifest.MediaType, nil
+}
+
+func (i *compressedImage) RawManifest() ([]byte, error) {
+	return i.manifest.Raw, nil
+}
+
+func (i *compressedImage) RawConfigFile() ([]byte, error) {
+	return i.config, nil
+}
+
+func (i *compressedImage) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	for _, l := range i.parsed.Layers {
+		if l.Digest == h {
+			return &compressedLayer{storage: i.storage, desc: l}, nil
+		}
+	}
+	if i.parsed.Config.Digest == h {
+		return partial.ConfigLayer(i)
+	}
+	return nil, errors.Errorf("layer %s not found in manifest %s", h, i.manifest.Digest)
+}
+
+type compressedLayer struct {
+	storage *Storage
+	desc    v1.Descriptor
+}
+
+func (l *compressedLayer) Digest() (v1.Hash, error) {
+	return l.desc.Digest, nil
+}
+
+func (l *compressedLayer) Compressed() (io.ReadCloser, error) {
+	return l.storage.openBlob(l.desc)
+}
+
+func (l *compressedLayer) Size() (int64, error) {
+	return l.desc.Size, nil
+}
+
+func (l *compressedLayer) MediaType() (types.MediaType, error) {
+	return l.desc.MediaType, nil
+}
@@ -0,0 +1,280 @@
+package regstorage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var linux = v1.Platform{OS: "linux", Architecture: "amd64"}
+
+// fixture writes layout of registry:2 storage under root
+type fixture struct {
+	t    *testing.T
+	root string
+}
+
+func newFixture(t *testing.T) *fixture {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, v2Dir, "repositories"), 0755))
+	return &fixture{t: t, root: root}
+}
+
+func (f *fixture) write(path string, b []byte) {
+	require.NoError(f.t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(f.t, ioutil.WriteFile(path, b, 0644))
+}
+
+// blob writes blob of content and returns its descriptor
+func (f *fixture) blob(mediaType types.MediaType, b []byte) v1.Descriptor {
+	sum := sha256.Sum256(b)
+	h := v1.Hash{Algorithm: "sha256", Hex: hex.EncodeToString(sum[:])}
+	f.write(filepath.Join(f.root, v2Dir, "blobs", "sha256", h.Hex[:2], h.Hex, "data"), b)
+	return v1.Descriptor{MediaType: mediaType, Digest: h, Size: int64(len(b))}
+}
+
+func (f *fixture) blobPath(d v1.Descriptor) string {
+	return filepath.Join(f.root, v2Dir, "blobs", "sha256", d.Digest.Hex[:2], d.Digest.Hex, "data")
+}
+
+// image writes image of layers and returns descriptor of its manifest
+func (f *fixture) image(layers ...string) (v1.Descriptor, []v1.Descriptor) {
+	config := f.blob(types.DockerConfigJSON, []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`))
+	m := v1.Manifest{SchemaVersion: 2, MediaType: types.DockerManifestSchema2, Config: config}
+	for _, l := range layers {
+		m.Layers = append(m.Layers, f.blob(types.DockerLayer, []byte(l)))
+	}
+	b, err := json.Marshal(m)
+	require.NoError(f.t, err)
+	return f.blob(types.DockerManifestSchema2, b), m.Layers
+}
+
+// tag links manifest as tag of repo
+func (f *fixture) tag(repo string, tag string, d v1.Descriptor) {
+	dir := filepath.Join(f.root, v2Dir, "repositories", repo, "_manifests")
+	f.write(filepath.Join(dir, "tags", tag, "current", "link"), []byte(d.Digest.String()))
+	f.write(filepath.Join(dir, "revisions", "sha256", d.Digest.Hex, "link"), []byte(d.Digest.String()))
+}
+
+func (f *fixture) open() *Storage {
+	s, err := Open(f.root)
+	require.NoError(f.t, err)
+	return s
+}
+
+func TestOpen(t *testing.T) {
+	_, err := Open(t.TempDir())
+	assert.Error(t, err)
+
+	f := newFixture(t)
+	s, err := Open(f.root)
+	require.NoError(t, err)
+	assert.Equal(t, f.root, s.Root())
+}
+
+func TestRepositories(t *testing.T) {
+	f := newFixture(t)
+	m, _ := f.image("layer")
+	f.tag("library/nginx", "latest", m)
+	f.tag("team/app", "1.0", m)
+	f.tag("team/app/worker", "1.0", m)
+	f.write(filepath.Join(f.root, v2Dir, "repositories", "team", "app", "_uploads", "x", "data"), []byte("partial"))
+	require.NoError(t, os.MkdirAll(filepath.Join(f.root, v2Dir, "repositories", "empty"), 0755))
+
+	repos, err := f.open().Repositories()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"library/nginx", "team/app", "team/app/worker"}, repos)
+}
+
+func TestTags(t *testing.T) {
+	f := newFixture(t)
+	m, _ := f.image("layer")
+	f.tag("app", "2.0", m)
+	f.tag("app", "1.0", m)
+	// Tag whose current link isn't synced yet
+	require.NoError(t, os.MkdirAll(filepath.Join(f.root, v2Dir, "repositories", "app", "_manifests", "tags", "3.0"), 0755))
+	s := f.open()
+
+	tags, err := s.Tags("app")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.0", "2.0"}, tags)
+
+	_, err = s.Tags("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	ok, err := s.HasTag("app", "1.0")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = s.HasTag("app", "3.0")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestResolve(t *testing.T) {
+	f := newFixture(t)
+	m, _ := f.image("layer")
+	other, _ := f.image("other")
+	f.tag("app", "1.0", m)
+	s := f.open()
+
+	h, err := s.Resolve("app", "1.0")
+	require.NoError(t, err)
+	assert.Equal(t, m.Digest, h)
+
+	h, err = s.Resolve("app", m.Digest.String())
+	require.NoError(t, err)
+	assert.Equal(t, m.Digest, h)
+
+	// Blobs of other repositories aren't manifests of repo
+	_, err = s.Resolve("app", other.Digest.String())
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestImage(t *testing.T) {
+	f := newFixture(t)
+	m, layers := f.image("layer-1", "layer-2")
+	f.tag("app", "1.0", m)
+
+	top, img, err := f.open().Image("app", "1.0", linux)
+	require.NoError(t, err)
+	assert.Equal(t, m.Digest, top.Digest)
+	assert.Equal(t, types.DockerManifestSchema2, top.MediaType)
+
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, m.Digest, digest)
+
+	ls, err := img.Layers()
+	require.NoError(t, err)
+	require.Len(t, ls, 2)
+	rc, err := ls[1].Compressed()
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, "layer-2", string(b))
+
+	d, err := ls[0].Digest()
+	require.NoError(t, err)
+	assert.Equal(t, layers[0].Digest, d)
+}
+
+func TestImageIndex(t *testing.T) {
+	f := newFixture(t)
+	amd64, _ := f.image("amd64")
+	arm64, _ := f.image("arm64")
+	index := v1.IndexManifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIImageIndex,
+		Manifests: []v1.Descriptor{
+			withPlatform(arm64, v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}),
+			withPlatform(amd64, linux),
+		},
+	}
+	b, err := json.Marshal(index)
+	require.NoError(t, err)
+	idx := f.blob(types.OCIImageIndex, b)
+	f.tag("app", "multi", idx)
+	s := f.open()
+
+	top, img, err := s.Image("app", "multi", linux)
+	require.NoError(t, err)
+	assert.Equal(t, idx.Digest, top.Digest)
+	assert.True(t, top.MediaType.IsIndex())
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, amd64.Digest, digest)
+
+	_, img, err = s.Image("app", "multi", v1.Platform{OS: "linux", Architecture: "arm64"})
+	require.NoError(t, err)
+	digest, err = img.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, arm64.Digest, digest)
+
+	_, _, err = s.Image("app", "multi", v1.Platform{OS: "windows", Architecture: "amd64"})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func withPlatform(d v1.Descriptor, p v1.Platform) v1.Descriptor {
+	d.Platform = &p
+	return d
+}
+
+func TestImageBlobErrors(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		damage func(f *fixture, layer v1.Descriptor)
+		reason string
+		onRead bool
+	}{
+		{
+			name:   "missing",
+			damage: func(f *fixture, layer v1.Descriptor) { require.NoError(t, os.Remove(f.blobPath(layer))) },
+			reason: ReasonMissing,
+		},
+		{
+			name:   "truncated",
+			damage: func(f *fixture, layer v1.Descriptor) { f.write(f.blobPath(layer), []byte("lay")) },
+			reason: ReasonSize,
+		},
+		{
+			name:   "corrupt",
+			damage: func(f *fixture, layer v1.Descriptor) { f.write(f.blobPath(layer), []byte("LAYER")) },
+			reason: ReasonDigest,
+			onRead: true,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			f := newFixture(t)
+			m, layers := f.image("layer")
+			f.tag("app", "1.0", m)
+			c.damage(f, layers[0])
+
+			_, img, err := f.open().Image("app", "1.0", linux)
+			if c.onRead {
+				require.NoError(t, err)
+				ls, lerr := img.Layers()
+				require.NoError(t, lerr)
+				rc, lerr := ls[0].Compressed()
+				require.NoError(t, lerr)
+				_, err = ioutil.ReadAll(rc)
+				rc.Close()
+			}
+			require.True(t, IsBlobError(err), fmt.Sprint(err))
+			var be *BlobError
+			require.ErrorAs(t, err, &be)
+			assert.Equal(t, c.reason, be.Reason)
+			assert.Equal(t, layers[0].Digest.String(), be.Digest)
+		})
+	}
+}
+
+func TestImageCorruptManifest(t *testing.T) {
+	f := newFixture(t)
+	m, _ := f.image("layer")
+	f.tag("app", "1.0", m)
+	f.write(f.blobPath(m), []byte(`{"schemaVersion":2}`))
+
+	_, _, err := f.open().Image("app", "1.0", linux)
+	var be *BlobError
+	require.ErrorAs(t, err, &be)
+	assert.Equal(t, ReasonDigest, be.Reason)
+}
+
+func TestImageSchema1(t *testing.T) {
+	f := newFixture(t)
+	m := f.blob(types.DockerManifestSchema1Signed, []byte(`{"schemaVersion":1,"name":"app","tag":"old"}`))
+	f.tag("app", "old", m)
+
+	_, _, err := f.open().Image("app", "old", linux)
+	assert.ErrorIs(t, err, ErrUnsupportedManifest)
+}
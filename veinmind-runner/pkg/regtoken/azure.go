@@ -0,0 +1,159 @@
+package regtoken
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Environment of azure workload identity injected into pods
+const (
+	azureClientIDEnv  = "AZURE_CLIENT_ID"
+	azureTenantIDEnv  = "AZURE_TENANT_ID"
+	azureTokenFileEnv = "AZURE_FEDERATED_TOKEN_FILE"
+	azureAuthorityEnv = "AZURE_AUTHORITY_HOST"
+)
+
+const (
+	azureAuthority = "https://login.microsoftonline.com/"
+	// azureIMDS is instance metadata service serving tokens of managed
+	// identity, used without workload identity
+	azureIMDS = "http://169.254.169.254"
+	// azureResource is resource of AAD tokens exchanged for ACR tokens
+	azureResource = "https://management.azure.com/"
+	// azureUsername is username of ACR refresh tokens
+	azureUsername = "00000000-0000-0000-0000-000000000000"
+)
+
+type azure struct {
+	client    *http.Client
+	clientID  string
+	tenantID  string
+	tokenFile string
+	authority string
+	imds      string
+}
+
+// NewAzure returns provider of ACR, AAD tokens of workload identity or
+// of managed identity if workload identity isn't configured are
+// exchanged for ACR refresh tokens
+func NewAzure() Provider {
+	authority := os.Getenv(azureAuthorityEnv)
+	if authority == "" {
+		authority = azureAuthority
+	}
+	return &azure{
+		client:    &http.Client{Timeout: httpTimeout},
+		clientID:  os.Getenv(azureClientIDEnv),
+		tenantID:  os.Getenv(azureTenantIDEnv),
+		tokenFile: os.Getenv(azureTokenFileEnv),
+		authority: strings.TrimSuffix(authority, "/") + "/",
+		imds:      azureIMDS,
+	}
+}
+
+func (a *azure) Name() string {
+	return Azure
+}
+
+func (a *azure) Match(registry string) bool {
+	for _, suffix := range []string{".azurecr.io", ".azurecr.cn", ".azurecr.us"} {
+		if strings.HasSuffix(registry, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *azure) Fetch(ctx context.Context, registry string) (Token, error) {
+	aad, err := a.aadToken(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+
+	form := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {registry},
+		"access_token": {aad.Password},
+	}
+	if a.tenantID != "" {
+		form.Set("tenant", a.tenantID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+registry+"/oauth2/exchange",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var resp struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := doJSON(a.client, req, &resp); err != nil {
+		return Token{}, errors.Wrap(err, "exchange for ACR token")
+	}
+	// ACR refresh tokens outlive AAD tokens they're exchanged for
+	return Token{Username: azureUsername, Password: resp.RefreshToken, Expiry: aad.Expiry}, nil
+}
+
+// aadToken returns AAD token in Password, federated token of workload
+// identity is read on each fetch since kubelet rotates it
+func (a *azure) aadToken(ctx context.Context) (Token, error) {
+	var req *http.Request
+	if a.tokenFile != "" {
+		if a.clientID == "" || a.tenantID == "" {
+			return Token{}, errors.Errorf("%s and %s are required by workload identity", azureClientIDEnv, azureTenantIDEnv)
+		}
+		assertion, err := ioutil.ReadFile(a.tokenFile)
+		if err != nil {
+			return Token{}, errors.Wrap(err, "read federated token")
+		}
+
+		form := url.Values{
+			"client_id":             {a.clientID},
+			"client_assertion":      {strings.TrimSpace(string(assertion))},
+			"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+			"grant_type":            {"client_credentials"},
+			"scope":                 {azureResource + ".default"},
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost,
+			a.authority+url.PathEscape(a.tenantID)+"/oauth2/v2.0/token", strings.NewReader(form.Encode()))
+		if err != nil {
+			return Token{}, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		query := url.Values{
+			"api-version": {"2018-02-01"},
+			"resource":    {azureResource},
+		}
+		if a.clientID != "" {
+			query.Set("client_id", a.clientID)
+		}
+		var err error
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet,
+			a.imds+"/metadata/identity/oauth2/token?"+query.Encode(), nil)
+		if err != nil {
+			return Token{}, err
+		}
+		req.Header.Set("Metadata", "true")
+	}
+
+	// IMDS encodes expires_in as string
+	var resp struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	if err := doJSON(a.client, req, &resp); err != nil {
+		return Token{}, errors.Wrap(err, "AAD token")
+	}
+	if resp.AccessToken == "" {
+		return Token{}, errors.New("AAD token: empty access token")
+	}
+	return Token{Password: resp.AccessToken, Expiry: expiry(resp.ExpiresIn)}, nil
+}
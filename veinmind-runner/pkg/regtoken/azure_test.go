@@ -0,0 +1,68 @@
+package regtoken
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAzure(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		switch {
+		case r.URL.Path == "/tenant/oauth2/v2.0/token":
+			if r.PostForm.Get("client_assertion") != "federated" || r.PostForm.Get("client_id") != "client" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"access_token":"aad-workload","expires_in":3600}`))
+		case r.URL.Path == "/metadata/identity/oauth2/token" && r.Header.Get("Metadata") == "true":
+			_, _ = w.Write([]byte(`{"access_token":"aad-managed","expires_in":"86399"}`))
+		case r.URL.Path == "/oauth2/exchange":
+			if r.PostForm.Get("grant_type") != "access_token" || !strings.HasPrefix(r.PostForm.Get("access_token"), "aad-") {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"refresh_token":"acr-` + r.PostForm.Get("access_token") + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	registry := strings.TrimPrefix(srv.URL, "https://")
+
+	p := &azure{client: srv.Client(), authority: srv.URL + "/", imds: srv.URL}
+	assert.True(t, p.Match("myregistry.azurecr.io"))
+	assert.False(t, p.Match("gcr.io"))
+
+	// Managed identity without workload identity
+	token, err := p.Fetch(context.Background(), registry)
+	require.NoError(t, err)
+	assert.Equal(t, azureUsername, token.Username)
+	assert.Equal(t, "acr-aad-managed", token.Password)
+	assert.False(t, token.Expiry.IsZero())
+
+	// Workload identity
+	p.tokenFile = filepath.Join(t.TempDir(), "token")
+	require.NoError(t, ioutil.WriteFile(p.tokenFile, []byte("federated\n"), 0600))
+	_, err = p.Fetch(context.Background(), registry)
+	assert.Error(t, err)
+	p.clientID, p.tenantID = "client", "tenant"
+	token, err = p.Fetch(context.Background(), registry)
+	require.NoError(t, err)
+	assert.Equal(t, "acr-aad-workload", token.Password)
+
+	// Failures don't quote responses
+	require.NoError(t, ioutil.WriteFile(p.tokenFile, []byte("expired"), 0600))
+	_, err = p.Fetch(context.Background(), registry)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401 Unauthorized")
+	assert.NotContains(t, err.Error(), url.QueryEscape("expired"))
+}
@@ -0,0 +1,59 @@
+package regtoken
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// RegistryEnv is environment variable of registry whose token is asked
+// for by token command
+const RegistryEnv = "VEINMIND_REGISTRY"
+
+// maxStderr limits stderr of token command quoted in errors
+const maxStderr = 512
+
+type command struct {
+	cmd string
+}
+
+// NewCommand returns provider of every registry running cmd by shell,
+// whose stdout is the bearer token of registry in RegistryEnv. It runs
+// again once registry rejects the token
+func NewCommand(cmd string) Provider {
+	return &command{cmd: cmd}
+}
+
+func (c *command) Name() string {
+	return "command"
+}
+
+func (c *command) Match(string) bool {
+	return true
+}
+
+func (c *command) Fetch(ctx context.Context, registry string) (Token, error) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.cmd)
+	cmd.Env = append(os.Environ(), RegistryEnv+"="+registry)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > maxStderr {
+			msg = msg[len(msg)-maxStderr:]
+		}
+		if msg != "" {
+			return Token{}, errors.Wrapf(err, "token command: %s", msg)
+		}
+		return Token{}, errors.Wrap(err, "token command")
+	}
+
+	token := strings.TrimSpace(stdout.String())
+	if token == "" {
+		return Token{}, errors.New("token command printed no token")
+	}
+	return Token{Bearer: token}, nil
+}
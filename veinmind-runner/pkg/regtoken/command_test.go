@@ -0,0 +1,21 @@
+package regtoken
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	p := NewCommand(`echo "token-of-$VEINMIND_REGISTRY"`)
+	assert.True(t, p.Match("index.docker.io"))
+	token, err := p.Fetch(context.Background(), "harbor.internal")
+	require.NoError(t, err)
+	assert.Equal(t, Token{Bearer: "token-of-harbor.internal"}, token)
+
+	_, err = NewCommand("echo denied >&2; exit 3").Fetch(context.Background(), "harbor.internal")
+	assert.EqualError(t, err, "token command: denied: exit status 3")
+	_, err = NewCommand("true").Fetch(context.Background(), "harbor.internal")
+	assert.Error(t, err)
+}
@@ -0,0 +1,97 @@
+package regtoken
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// gcpMetadataHost is host of metadata server of GCP, which serves
+// tokens of the attached service account, or of the service account
+// bound to kubernetes service account by GKE workload identity
+const gcpMetadataHost = "metadata.google.internal"
+
+// gcpMetadataHostEnv overrides gcpMetadataHost, the same as GCP SDKs
+const gcpMetadataHostEnv = "GCE_METADATA_HOST"
+
+// gcpUsername is username of access tokens for GCR and Artifact Registry
+const gcpUsername = "oauth2accesstoken"
+
+// httpTimeout limits requests of providers
+const httpTimeout = 10 * time.Second
+
+type gcp struct {
+	client *http.Client
+	// base is URL of metadata server
+	base string
+}
+
+// NewGCP returns provider of GCR and Artifact Registry, access tokens
+// of ambient service account are taken from metadata server
+func NewGCP() Provider {
+	host := os.Getenv(gcpMetadataHostEnv)
+	if host == "" {
+		host = gcpMetadataHost
+	}
+	return &gcp{client: &http.Client{Timeout: httpTimeout}, base: "http://" + host}
+}
+
+func (g *gcp) Name() string {
+	return GCP
+}
+
+func (g *gcp) Match(registry string) bool {
+	return registry == "gcr.io" || strings.HasSuffix(registry, ".gcr.io") ||
+		strings.HasSuffix(registry, "-docker.pkg.dev")
+}
+
+func (g *gcp) Fetch(ctx context.Context, registry string) (Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		g.base+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	var resp struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	if err := doJSON(g.client, req, &resp); err != nil {
+		return Token{}, errors.Wrap(err, "metadata server")
+	}
+	return Token{
+		Username: gcpUsername,
+		Password: resp.AccessToken,
+		Expiry:   expiry(resp.ExpiresIn),
+	}, nil
+}
+
+// doJSON sends req and decodes JSON response into v, bodies of failed
+// responses aren't quoted since they may echo credentials
+func doJSON(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s %s: %s", req.Method, req.URL.Redacted(), resp.Status)
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(v), "%s %s", req.Method, req.URL.Redacted())
+}
+
+// expiry returns expiry of token expiring in seconds, zero if seconds
+// is absent
+func expiry(seconds json.Number) time.Time {
+	n, err := seconds.Int64()
+	if err != nil || n <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(n) * time.Second)
+}
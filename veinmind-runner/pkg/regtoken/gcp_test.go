@@ -0,0 +1,44 @@
+package regtoken
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGCP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"ya29.x","expires_in":3599,"token_type":"Bearer"}`))
+	}))
+	defer srv.Close()
+
+	p := &gcp{client: srv.Client(), base: srv.URL}
+	for registry, match := range map[string]bool{
+		"gcr.io":                             true,
+		"eu.gcr.io":                          true,
+		"us-central1-docker.pkg.dev":         true,
+		"myregistry.azurecr.io":              false,
+		"index.docker.io":                    false,
+		"us-central1-docker.pkg.dev.example": false,
+	} {
+		assert.Equal(t, match, p.Match(registry), registry)
+	}
+
+	token, err := p.Fetch(context.Background(), "gcr.io")
+	require.NoError(t, err)
+	assert.Equal(t, "oauth2accesstoken", token.Username)
+	assert.Equal(t, "ya29.x", token.Password)
+	assert.WithinDuration(t, time.Now().Add(3599*time.Second), token.Expiry, time.Minute)
+
+	p.base = srv.URL + "/other"
+	_, err = p.Fetch(context.Background(), "gcr.io")
+	assert.Error(t, err)
+}
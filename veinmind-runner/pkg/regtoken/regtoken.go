@@ -0,0 +1,181 @@
+// Package regtoken provides short-lived tokens of registries, e.g. OIDC
+// tokens of workload identity exchanged for registry tokens, instead of
+// static credentials. Tokens are cached per registry and fetched anew
+// once they expire or registry rejects them
+package regtoken
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/pkg/errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of built-in providers
+const (
+	GCP   = "gcp"
+	Azure = "azure"
+)
+
+// Providers are names of built-in providers
+var Providers = []string{GCP, Azure}
+
+// expiryMargin is how long before expiry tokens are fetched anew, so
+// that they don't expire during requests
+const expiryMargin = time.Minute
+
+// fetchTimeout limits a fetch of token, callers without deadline such
+// as authenticators of registry client wait for it at most
+const fetchTimeout = 30 * time.Second
+
+// Token is token of registry, Bearer is sent to registry as is if it's
+// set, and Username and Password are basic credentials otherwise. Zero
+// Expiry is valid until registry rejects it
+type Token struct {
+	Username string
+	Password string
+	Bearer   string
+	Expiry   time.Time
+}
+
+// Header returns Authorization header carrying token
+func (t Token) Header() string {
+	if t.Bearer != "" {
+		return "Bearer " + t.Bearer
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(t.Username+":"+t.Password))
+}
+
+// Provider fetches tokens of the registries it matches
+type Provider interface {
+	Name() string
+	Match(registry string) bool
+	Fetch(ctx context.Context, registry string) (Token, error)
+}
+
+// New returns built-in provider of name, one of Providers
+func New(name string) (Provider, error) {
+	switch name {
+	case GCP:
+		return NewGCP(), nil
+	case Azure:
+		return NewAzure(), nil
+	}
+	return nil, errors.Errorf("unknown token provider %#v, expect one of %s", name, strings.Join(Providers, ","))
+}
+
+// Fetch is a fetch of token of registry by provider, token values are
+// never included
+type Fetch struct {
+	Registry string
+	Provider string
+	Expiry   time.Time
+	Err      error
+}
+
+type entry struct {
+	mu    sync.Mutex
+	token Token
+	ok    bool
+}
+
+// Cache caches tokens of providers by registry, the first provider
+// matching registry serves it. Concurrent callers share a fetch, and a
+// token rejected by concurrent requests is fetched anew once
+type Cache struct {
+	providers []Provider
+	notify    func(Fetch)
+	now       func() time.Time
+	mu        sync.Mutex
+	entries   map[string]*entry
+}
+
+// NewCache returns cache of tokens of providers, notify is called for
+// each fetch if it isn't nil
+func NewCache(notify func(Fetch), providers ...Provider) *Cache {
+	return &Cache{
+		providers: providers,
+		notify:    notify,
+		now:       time.Now,
+		entries:   map[string]*entry{},
+	}
+}
+
+func (c *Cache) provider(registry string) (Provider, bool) {
+	if c == nil {
+		return nil, false
+	}
+	for _, p := range c.providers {
+		if p.Match(registry) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Serves reports whether any provider matches registry
+func (c *Cache) Serves(registry string) bool {
+	_, ok := c.provider(registry)
+	return ok
+}
+
+func (c *Cache) entry(registry string) *entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[registry]
+	if !ok {
+		e = &entry{}
+		c.entries[registry] = e
+	}
+	return e
+}
+
+// Token returns token of registry, it's fetched if it isn't cached,
+// expires soon or is rejected. Fetches of a registry are serialized
+func (c *Cache) Token(ctx context.Context, registry string) (Token, error) {
+	p, ok := c.provider(registry)
+	if !ok {
+		return Token{}, errors.Errorf("no token provider of registry %s", registry)
+	}
+
+	e := c.entry(registry)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ok && (e.token.Expiry.IsZero() || c.now().Add(expiryMargin).Before(e.token.Expiry)) {
+		return e.token, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	token, err := p.Fetch(ctx, registry)
+	if err == nil && token.Bearer == "" && token.Password == "" {
+		err = errors.New("empty token")
+	}
+	if c.notify != nil {
+		c.notify(Fetch{Registry: registry, Provider: p.Name(), Expiry: token.Expiry, Err: err})
+	}
+	if err != nil {
+		e.ok = false
+		return Token{}, errors.Wrapf(err, "fetch token of %s by %s", registry, p.Name())
+	}
+	e.token, e.ok = token, true
+	return token, nil
+}
+
+// Reject drops token of registry rejected by it, so that the next call
+// of Token fetches anew. Tokens other than the cached one are ignored,
+// they're rejected by requests before it's fetched
+func (c *Cache) Reject(registry string, token Token) {
+	if !c.Serves(registry) {
+		return
+	}
+
+	e := c.entry(registry)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ok && e.token.Header() == token.Header() {
+		e.ok = false
+	}
+}
@@ -0,0 +1,118 @@
+package regtoken
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// counter is provider of registries of suffix, whose tokens are numbered
+// by fetches
+type counter struct {
+	suffix  string
+	fetches int32
+	expiry  time.Duration
+	err     error
+}
+
+func (c *counter) Name() string {
+	return "counter"
+}
+
+func (c *counter) Match(registry string) bool {
+	return strings.HasSuffix(registry, c.suffix)
+}
+
+func (c *counter) Fetch(ctx context.Context, registry string) (Token, error) {
+	n := atomic.AddInt32(&c.fetches, 1)
+	time.Sleep(10 * time.Millisecond)
+	if c.err != nil {
+		return Token{}, c.err
+	}
+	t := Token{Bearer: fmt.Sprintf("%s-%d", registry, n)}
+	if c.expiry != 0 {
+		t.Expiry = time.Now().Add(c.expiry)
+	}
+	return t, nil
+}
+
+func TestCache(t *testing.T) {
+	p := &counter{suffix: ".example.com"}
+	fetches := []Fetch{}
+	c := NewCache(func(f Fetch) { fetches = append(fetches, f) }, p)
+	assert.True(t, c.Serves("a.example.com"))
+	assert.False(t, c.Serves("index.docker.io"))
+	_, err := c.Token(context.Background(), "index.docker.io")
+	assert.Error(t, err)
+
+	// Concurrent callers share a fetch
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := c.Token(context.Background(), "a.example.com")
+			assert.NoError(t, err)
+			assert.Equal(t, "a.example.com-1", token.Bearer)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), p.fetches)
+	require.Len(t, fetches, 1)
+	assert.Equal(t, Fetch{Registry: "a.example.com", Provider: "counter"}, fetches[0])
+
+	// Token rejected by concurrent requests is fetched anew once
+	token, _ := c.Token(context.Background(), "a.example.com")
+	c.Reject("a.example.com", token)
+	fresh, err := c.Token(context.Background(), "a.example.com")
+	require.NoError(t, err)
+	c.Reject("a.example.com", token)
+	again, err := c.Token(context.Background(), "a.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "a.example.com-2", fresh.Bearer)
+	assert.Equal(t, fresh, again)
+	assert.Equal(t, "Bearer a.example.com-2", again.Header())
+}
+
+func TestCacheExpiry(t *testing.T) {
+	p := &counter{suffix: ".example.com", expiry: time.Hour}
+	c := NewCache(nil, p)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	_, err := c.Token(context.Background(), "a.example.com")
+	require.NoError(t, err)
+	_, err = c.Token(context.Background(), "a.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), p.fetches)
+
+	// Tokens expiring soon are fetched anew
+	now = now.Add(time.Hour - expiryMargin/2)
+	token, err := c.Token(context.Background(), "a.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "a.example.com-2", token.Bearer)
+
+	p.err = errors.New("unavailable")
+	c.Reject("a.example.com", token)
+	_, err = c.Token(context.Background(), "a.example.com")
+	assert.EqualError(t, err, "fetch token of a.example.com by counter: unavailable")
+}
+
+func TestNew(t *testing.T) {
+	for _, name := range Providers {
+		p, err := New(name)
+		require.NoError(t, err)
+		assert.Equal(t, name, p.Name())
+	}
+	_, err := New("aws")
+	assert.Error(t, err)
+
+	assert.Equal(t, "Basic dXNlcjpwYXNz", Token{Username: "user", Password: "pass"}.Header())
+}
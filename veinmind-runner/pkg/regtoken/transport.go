@@ -0,0 +1,68 @@
+package regtoken
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// cached returns token of registry cached, it's never fetched
+func (c *Cache) cached(registry string) (Token, bool) {
+	if !c.Serves(registry) {
+		return Token{}, false
+	}
+
+	e := c.entry(registry)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.token, e.ok
+}
+
+// Transport returns transport of requests to registry, requests which
+// carry token of registry and are rejected with 401 are replayed once
+// with a token fetched anew. Other requests, e.g. those carrying tokens
+// issued by registry, pass through
+func (c *Cache) Transport(registry string, base http.RoundTripper) http.RoundTripper {
+	if !c.Serves(registry) {
+		return base
+	}
+	return &transport{cache: c, registry: registry, base: base}
+}
+
+type transport struct {
+	cache    *Cache
+	registry string
+	base     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	header := req.Header.Get("Authorization")
+	token, ok := t.cache.cached(t.registry)
+	ours := ok && header != "" && header == token.Header()
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !ours {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	t.cache.Reject(t.registry, token)
+	fresh, err := t.cache.Token(req.Context(), t.registry)
+	if err != nil || fresh.Header() == header {
+		return resp, nil
+	}
+
+	replay := req.Clone(req.Context())
+	if req.Body != nil {
+		replay.Body, err = req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+	}
+	replay.Header.Set("Authorization", fresh.Header())
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return t.base.RoundTrip(replay)
+}
@@ -0,0 +1,66 @@
+package regtoken
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+	valid := "Bearer r.example.com-2"
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("Authorization") != valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write(b)
+	}))
+	defer srv.Close()
+
+	p := &counter{suffix: ".example.com"}
+	c := NewCache(nil, p)
+	assert.Equal(t, http.DefaultTransport, c.Transport("index.docker.io", http.DefaultTransport))
+	client := &http.Client{Transport: c.Transport("r.example.com", http.DefaultTransport)}
+
+	// Requests without token aren't replayed, e.g. ping of registry
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, int32(1), requests)
+
+	// Rejected token is fetched anew and the request is replayed
+	token, err := c.Token(context.Background(), "r.example.com")
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("body"))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", token.Header())
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "body", string(b))
+	assert.Equal(t, int32(3), requests)
+	assert.Equal(t, int32(2), p.fetches)
+
+	// Tokens issued by registry pass through
+	req, err = http.NewRequest(http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer issued")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, int32(4), requests)
+	assert.Equal(t, int32(2), p.fetches)
+}
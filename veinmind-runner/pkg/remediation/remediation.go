@@ -0,0 +1,241 @@
+// Package remediation suggests Dockerfile changes fixing findings, by
+// rules matching alert types and fields of events. Findings no rule
+// matches get no suggestion rather than a generic one
+package remediation
+
+import (
+	"fmt"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// Rule suggests Suggestion for details of events of AlertType, any
+// alert type if empty. Path is a glob matching path of file or its base
+// name, Name is a glob matching name of finding case-insensitively,
+// e.g. rule name of sensitive files, Env matches environment variables
+// and WorldWritable matches files writable by others. Rules with Path
+// or WorldWritable only match files. Suggestion is a text/template of
+// Fields
+type Rule struct {
+	AlertType     string `yaml:"alert_type"`
+	Path          string `yaml:"path"`
+	Name          string `yaml:"name"`
+	Env           bool   `yaml:"env"`
+	WorldWritable bool   `yaml:"world_writable"`
+	Suggestion    string `yaml:"suggestion"`
+}
+
+// Rules are tried in order, the first rule matching a detail suggests
+// its fix
+type Rules struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Fields are fields of detail of event available to suggestions, Perm
+// is in octal, e.g. 0777, and Key is name of environment variable
+type Fields struct {
+	Path     string
+	Base     string
+	Perm     string
+	Name     string
+	Username string
+	Key      string
+
+	mode os.FileMode
+}
+
+// secretHint is suggestion of secrets baked into images, deleting them
+// in a later layer keeps them in layers of the image
+const secretHint = "# remove the instruction adding {{.Path}}, deleting it in a later layer keeps it in image layers\n" +
+	"# mount it at runtime instead, e.g. docker run -v /path/on/host/{{.Base}}:{{.Path}}:ro"
+
+const credentialHint = "# remove credentials from {{.Path}} and provide them at runtime, e.g. docker run -e or a mounted secret"
+
+// Default is rules of world-writable files, private keys and default
+// credentials reported by first-party plugins
+var Default = Rules{Rules: []Rule{
+	{AlertType: "Sensitive", Path: "id_rsa", Suggestion: secretHint},
+	{AlertType: "Sensitive", Path: "id_dsa", Suggestion: secretHint},
+	{AlertType: "Sensitive", Path: "id_ecdsa", Suggestion: secretHint},
+	{AlertType: "Sensitive", Path: "id_ed25519", Suggestion: secretHint},
+	{AlertType: "Sensitive", Path: "*.pem", Suggestion: secretHint},
+	{AlertType: "Sensitive", Path: "*.key", Suggestion: secretHint},
+	{AlertType: "Sensitive", Path: "*", Name: "*private*key*", Suggestion: secretHint},
+	{AlertType: "Sensitive", Path: "*", Name: "*password*", Suggestion: credentialHint},
+	{AlertType: "Sensitive", Path: "*", Name: "*credential*", Suggestion: credentialHint},
+	{AlertType: "Sensitive", Env: true, Suggestion: "# remove ENV {{.Key}} from the Dockerfile and provide it at runtime, e.g. docker run -e {{.Key}}"},
+	{AlertType: "Weakpass", Suggestion: "RUN passwd -l {{.Username}}\n# or set a strong password at runtime instead of baking it into the image"},
+	{AlertType: "Sensitive", WorldWritable: true, Suggestion: "RUN chmod 640 {{.Path}}"},
+	{WorldWritable: true, Suggestion: "RUN chmod o-w {{.Path}}"},
+}}
+
+// Load parses rules file, rules of file are tried before the default
+// rules
+func Load(name string) (Rules, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return Rules{}, err
+	}
+
+	rules := Rules{}
+	if err := yaml.UnmarshalStrict(b, &rules); err != nil {
+		return Rules{}, errors.Wrapf(err, "remediation rules %s", name)
+	}
+	rules.Rules = append(rules.Rules, Default.Rules...)
+	return rules, nil
+}
+
+type compiled struct {
+	Rule
+	alertType *report.AlertType
+	template  *template.Template
+}
+
+// Suggester suggests fixes of events by rules
+type Suggester struct {
+	rules []compiled
+}
+
+// New compiles rules, alert types, globs and templates are validated
+func New(rules Rules) (*Suggester, error) {
+	s := &Suggester{}
+	for i, r := range rules.Rules {
+		c := compiled{Rule: r}
+		if r.AlertType != "" {
+			a, err := parseAlertType(r.AlertType)
+			if err != nil {
+				return nil, errors.Wrapf(err, "remediation rule %d", i)
+			}
+			c.alertType = &a
+		}
+		for _, glob := range []string{r.Path, r.Name} {
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, errors.Wrapf(err, "remediation rule %d", i)
+			}
+		}
+		if strings.TrimSpace(r.Suggestion) == "" {
+			return nil, errors.Errorf("remediation rule %d: empty suggestion", i)
+		}
+		// Unknown fields fail on execution
+		t, err := template.New("").Parse(r.Suggestion)
+		if err == nil {
+			err = t.Execute(ioutil.Discard, Fields{})
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "remediation rule %d", i)
+		}
+		c.template = t
+		s.rules = append(s.rules, c)
+	}
+	return s, nil
+}
+
+// Suggest returns suggestions of details of event, nil if no rule
+// matches any of them. Details suggested the same fix are collapsed
+func (s *Suggester) Suggest(evt report.ReportEvent) []string {
+	if s == nil {
+		return nil
+	}
+
+	var suggestions []string
+	seen := map[string]struct{}{}
+	for _, d := range evt.AlertDetails {
+		f, ok := fieldsOf(d)
+		if !ok {
+			continue
+		}
+		for _, r := range s.rules {
+			if !r.match(evt.AlertType, f) {
+				continue
+			}
+			b := &strings.Builder{}
+			if err := r.template.Execute(b, f); err != nil {
+				break
+			}
+			if _, ok := seen[b.String()]; !ok {
+				seen[b.String()] = struct{}{}
+				suggestions = append(suggestions, b.String())
+			}
+			break
+		}
+	}
+	return suggestions
+}
+
+func (r compiled) match(alertType report.AlertType, f Fields) bool {
+	if r.alertType != nil && *r.alertType != alertType {
+		return false
+	}
+	if r.Env && f.Key == "" {
+		return false
+	}
+	if (r.Path != "" || r.WorldWritable) && f.Path == "" {
+		return false
+	}
+	if r.Path != "" && !matchGlob(r.Path, f.Path) && !matchGlob(r.Path, f.Base) {
+		return false
+	}
+	if r.Name != "" && !matchGlob(strings.ToLower(r.Name), strings.ToLower(f.Name)) {
+		return false
+	}
+	if r.WorldWritable && f.mode&0002 == 0 {
+		return false
+	}
+	return true
+}
+
+func matchGlob(pattern string, s string) bool {
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
+
+// fieldsOf returns fields of detail, details without fields to match
+// are skipped
+func fieldsOf(d report.AlertDetail) (Fields, bool) {
+	var f Fields
+	file := func(fd report.FileDetail, name string) {
+		f = Fields{
+			Path: fd.Path,
+			Base: path.Base(fd.Path),
+			Perm: fmt.Sprintf("%04o", fd.Perm.Perm()),
+			Name: name,
+			mode: fd.Perm,
+		}
+	}
+
+	switch {
+	case d.MaliciousFileDetail != nil:
+		file(d.MaliciousFileDetail.FileDetail, d.MaliciousFileDetail.MaliciousName)
+	case d.BackdoorDetail != nil:
+		file(d.BackdoorDetail.FileDetail, d.BackdoorDetail.Description)
+	case d.SensitiveFileDetail != nil:
+		name := d.SensitiveFileDetail.RuleName
+		if name == "" {
+			name = d.SensitiveFileDetail.RuleDescription
+		}
+		file(d.SensitiveFileDetail.FileDetail, name)
+	case d.SensitiveEnvDetail != nil:
+		f = Fields{Key: d.SensitiveEnvDetail.Key, Name: d.SensitiveEnvDetail.RuleName}
+	case d.WeakpassDetail != nil:
+		f = Fields{Username: d.WeakpassDetail.Username}
+	default:
+		return f, false
+	}
+	return f, true
+}
+
+func parseAlertType(s string) (report.AlertType, error) {
+	for a := report.Vulnerability; a <= report.Archive; a++ {
+		b, _ := a.MarshalJSON()
+		if strings.EqualFold(strings.Trim(string(b), `"`), s) {
+			return a, nil
+		}
+	}
+	return 0, errors.Errorf("unknown alert type %#v", s)
+}
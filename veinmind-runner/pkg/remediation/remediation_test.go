@@ -0,0 +1,99 @@
+package remediation
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func sensitiveFile(path string, perm uint32, rule string) report.AlertDetail {
+	return report.AlertDetail{SensitiveFileDetail: &report.SensitveFileDetail{
+		FileDetail: report.FileDetail{Path: path, Perm: os.FileMode(perm)},
+		RuleName:   rule,
+	}}
+}
+
+func TestSuggest(t *testing.T) {
+	s, err := New(Default)
+	assert.NoError(t, err)
+
+	suggestions := s.Suggest(report.ReportEvent{
+		AlertType:    report.Sensitive,
+		AlertDetails: []report.AlertDetail{sensitiveFile("/root/.ssh/id_rsa", 0600, "ssh key")},
+	})
+	assert.Len(t, suggestions, 1)
+	assert.Contains(t, suggestions[0], "/root/.ssh/id_rsa")
+	assert.Contains(t, suggestions[0], "id_rsa:/root/.ssh/id_rsa:ro")
+
+	assert.Equal(t, []string{"RUN chmod 640 /etc/app.conf"}, s.Suggest(report.ReportEvent{
+		AlertType:    report.Sensitive,
+		AlertDetails: []report.AlertDetail{sensitiveFile("/etc/app.conf", 0777, "config")},
+	}))
+	assert.Equal(t, []string{"RUN chmod o-w /usr/bin/sshd"}, s.Suggest(report.ReportEvent{
+		AlertType: report.Backdoor,
+		AlertDetails: []report.AlertDetail{{BackdoorDetail: &report.BackdoorDetail{
+			FileDetail: report.FileDetail{Path: "/usr/bin/sshd", Perm: 0777},
+		}}},
+	}))
+
+	suggestions = s.Suggest(report.ReportEvent{
+		AlertType: report.Weakpass,
+		AlertDetails: []report.AlertDetail{
+			{WeakpassDetail: &report.WeakpassDetail{Username: "root"}},
+			{WeakpassDetail: &report.WeakpassDetail{Username: "root"}},
+		},
+	})
+	// Details suggested the same fix are collapsed
+	assert.Len(t, suggestions, 1)
+	assert.Contains(t, suggestions[0], "RUN passwd -l root")
+
+	suggestions = s.Suggest(report.ReportEvent{
+		AlertType:    report.Sensitive,
+		AlertDetails: []report.AlertDetail{{SensitiveEnvDetail: &report.SensitiveEnvDetail{Key: "AWS_SECRET_ACCESS_KEY"}}},
+	})
+	assert.Len(t, suggestions, 1)
+	assert.Contains(t, suggestions[0], "ENV AWS_SECRET_ACCESS_KEY")
+
+	// Findings no rule matches get no suggestion
+	assert.Nil(t, s.Suggest(report.ReportEvent{
+		AlertType:    report.Sensitive,
+		AlertDetails: []report.AlertDetail{sensitiveFile("/etc/app.conf", 0644, "config")},
+	}))
+	assert.Nil(t, s.Suggest(report.ReportEvent{AlertType: report.Vulnerability}))
+
+	var none *Suggester
+	assert.Nil(t, none.Suggest(report.ReportEvent{AlertType: report.Weakpass}))
+}
+
+func TestLoad(t *testing.T) {
+	rules, err := Load("testdata/rules.yaml")
+	assert.NoError(t, err)
+	assert.Len(t, rules.Rules, len(Default.Rules)+1)
+
+	s, err := New(rules)
+	assert.NoError(t, err)
+	// Rules of file are tried before the default rules
+	assert.Equal(t, []string{"RUN --mount=type=secret,id=tls.key ./start.sh"}, s.Suggest(report.ReportEvent{
+		AlertType:    report.Sensitive,
+		AlertDetails: []report.AlertDetail{sensitiveFile("/app/tls.key", 0600, "private key")},
+	}))
+	assert.Len(t, s.Suggest(report.ReportEvent{
+		AlertType:    report.Sensitive,
+		AlertDetails: []report.AlertDetail{sensitiveFile("/etc/tls.key", 0600, "private key")},
+	}), 1)
+}
+
+func TestNew(t *testing.T) {
+	for _, r := range []Rule{
+		{AlertType: "unknown", Suggestion: "RUN true"},
+		{Path: "[", Suggestion: "RUN true"},
+		{Name: "[", Suggestion: "RUN true"},
+		{AlertType: "Weakpass"},
+		{AlertType: "Weakpass", Suggestion: "RUN passwd -l {{.Username"},
+		{AlertType: "Weakpass", Suggestion: "RUN passwd -l {{.User}}"},
+	} {
+		_, err := New(Rules{Rules: []Rule{r}})
+		assert.Error(t, err, r.Suggestion)
+	}
+}
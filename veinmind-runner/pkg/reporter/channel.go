@@ -0,0 +1,217 @@
+package reporter
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultCapacity is capacity of event channel by default
+const DefaultCapacity = 1 << 8
+
+// Overflow policies of event channel when it's full
+const (
+	// OverflowBlock blocks sender until there's room, plugins are
+	// back-pressured by slow reporter
+	OverflowBlock = "block"
+	// OverflowDropOldest drops the oldest event in channel
+	OverflowDropOldest = "drop-oldest"
+	// OverflowSpill writes events to a temporary file which is merged
+	// back when events are read
+	OverflowSpill = "spill"
+)
+
+// ChannelStats is statistics of event channel of reporter
+type ChannelStats struct {
+	Capacity int    `json:"capacity"`
+	Overflow string `json:"overflow"`
+	MaxDepth int64  `json:"max_depth"`
+	Dropped  int64  `json:"dropped"`
+	Spilled  int64  `json:"spilled"`
+}
+
+type eventChannel struct {
+	ch       chan report.ReportEvent
+	overflow string
+	spill    *spillFile
+
+	maxDepth int64
+	dropped  int64
+	spilled  int64
+}
+
+func newEventChannel(capacity int, overflow string, spillDir string) (*eventChannel, error) {
+	if capacity < 0 {
+		return nil, errors.Errorf("invalid capacity of event channel: %d", capacity)
+	}
+
+	c := &eventChannel{
+		ch:       make(chan report.ReportEvent, capacity),
+		overflow: overflow,
+	}
+	switch overflow {
+	case OverflowBlock:
+	case OverflowDropOldest, OverflowSpill:
+		if capacity == 0 {
+			return nil, errors.Errorf("overflow policy %s needs a buffered event channel", overflow)
+		}
+		if overflow == OverflowSpill {
+			spill, err := newSpillFile(spillDir)
+			if err != nil {
+				return nil, err
+			}
+			c.spill = spill
+		}
+	default:
+		return nil, errors.Errorf("unknown overflow policy %#v, expect block, drop-oldest or spill", overflow)
+	}
+	return c, nil
+}
+
+// send sends event to channel following overflow policy of channel
+func (c *eventChannel) send(evt report.ReportEvent) {
+	switch c.overflow {
+	case OverflowDropOldest:
+		for {
+			select {
+			case c.ch <- evt:
+				c.observe()
+				return
+			default:
+			}
+
+			select {
+			case <-c.ch:
+				atomic.AddInt64(&c.dropped, 1)
+			default:
+			}
+		}
+	case OverflowSpill:
+		select {
+		case c.ch <- evt:
+			c.observe()
+			return
+		default:
+		}
+
+		if err := c.spill.write(evt); err != nil {
+			// Events are never lost, block if spill file is broken
+			c.ch <- evt
+			c.observe()
+			return
+		}
+		atomic.AddInt64(&c.spilled, 1)
+	default:
+		c.ch <- evt
+		c.observe()
+	}
+}
+
+// observe records depth of channel after sending
+func (c *eventChannel) observe() {
+	depth := int64(len(c.ch))
+	for {
+		max := atomic.LoadInt64(&c.maxDepth)
+		if depth <= max || atomic.CompareAndSwapInt64(&c.maxDepth, max, depth) {
+			return
+		}
+	}
+}
+
+// drain returns events spilled so far and empties spill file
+func (c *eventChannel) drain() ([]report.ReportEvent, error) {
+	if c.spill == nil {
+		return nil, nil
+	}
+	return c.spill.drain()
+}
+
+func (c *eventChannel) stats() ChannelStats {
+	return ChannelStats{
+		Capacity: cap(c.ch),
+		Overflow: c.overflow,
+		MaxDepth: atomic.LoadInt64(&c.maxDepth),
+		Dropped:  atomic.LoadInt64(&c.dropped),
+		Spilled:  atomic.LoadInt64(&c.spilled),
+	}
+}
+
+func (c *eventChannel) reset() {
+	atomic.StoreInt64(&c.maxDepth, 0)
+	atomic.StoreInt64(&c.dropped, 0)
+	atomic.StoreInt64(&c.spilled, 0)
+}
+
+// spillFile is NDJSON file of events overflowed from channel
+type spillFile struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func newSpillFile(dir string) (*spillFile, error) {
+	f, err := ioutil.TempFile(dir, "veinmind-events-*.ndjson")
+	if err != nil {
+		return nil, errors.Wrap(err, "create spill file")
+	}
+
+	// The file is unlinked right away, it lives as long as the process
+	if err := os.Remove(f.Name()); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "create spill file")
+	}
+	return &spillFile{f: f}, nil
+}
+
+func (s *spillFile) write(evt report.ReportEvent) error {
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(b, '\n'))
+	return err
+}
+
+func (s *spillFile) drain() ([]report.ReportEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	events := []report.ReportEvent{}
+	reader := bufio.NewReader(s.f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var evt report.ReportEvent
+			if err := json.Unmarshal(line, &evt); err != nil {
+				return nil, errors.Wrap(err, "read spill file")
+			}
+			events = append(events, evt)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.f.Truncate(0); err != nil {
+		return nil, err
+	}
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,64 @@
+package reporter
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestEventChannelDropOldest(t *testing.T) {
+	c, err := newEventChannel(2, OverflowDropOldest, "")
+	assert.Nil(t, err)
+
+	for i := 0; i < 5; i++ {
+		c.send(report.ReportEvent{ID: strconv.Itoa(i)})
+	}
+
+	assert.Equal(t, "3", (<-c.ch).ID)
+	assert.Equal(t, "4", (<-c.ch).ID)
+	assert.Equal(t, ChannelStats{
+		Capacity: 2,
+		Overflow: OverflowDropOldest,
+		MaxDepth: 2,
+		Dropped:  3,
+	}, c.stats())
+}
+
+func TestEventChannelSpill(t *testing.T) {
+	c, err := newEventChannel(1, OverflowSpill, t.TempDir())
+	assert.Nil(t, err)
+
+	for i := 0; i < 4; i++ {
+		c.send(report.ReportEvent{ID: strconv.Itoa(i)})
+	}
+	assert.Equal(t, "0", (<-c.ch).ID)
+
+	spilled, err := c.drain()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, ids(spilled))
+	assert.Equal(t, int64(3), c.stats().Spilled)
+
+	// Spill file is emptied by drain and reused afterwards
+	c.send(report.ReportEvent{ID: "4"})
+	c.send(report.ReportEvent{ID: "5"})
+	spilled, err = c.drain()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"5"}, ids(spilled))
+}
+
+func TestEventChannelInvalid(t *testing.T) {
+	_, err := newEventChannel(0, OverflowSpill, "")
+	assert.NotNil(t, err)
+
+	_, err = newEventChannel(1, "discard", "")
+	assert.NotNil(t, err)
+}
+
+func ids(events []report.ReportEvent) []string {
+	s := []string{}
+	for _, e := range events {
+		s = append(s, e.ID)
+	}
+	return s
+}
@@ -0,0 +1,96 @@
+package reporter
+
+import (
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Policies of outputs whose file already exists
+const (
+	// ExistsFail refuses to scan
+	ExistsFail = "fail"
+	// ExistsOverwrite replaces the file with the report
+	ExistsOverwrite = "overwrite"
+	// ExistsAppend merges events of the report into the file
+	ExistsAppend = "append"
+	// ExistsTimestamp writes the report beside the file, with time of
+	// scan in its name
+	ExistsTimestamp = "timestamp"
+)
+
+var ExistsPolicies = []string{ExistsFail, ExistsOverwrite, ExistsAppend, ExistsTimestamp}
+
+// timestampLayout is time of scan in paths of ExistsTimestamp
+const timestampLayout = "20060102T1504"
+
+// appendSource is source of report appended in merged metadata
+const appendSource = "appended"
+
+// CheckExistsPolicy checks whether policy is a known policy of outputs
+// which exist
+func CheckExistsPolicy(policy string) error {
+	for _, p := range ExistsPolicies {
+		if p == policy {
+			return nil
+		}
+	}
+	return errors.Errorf("unknown output exists policy %#v, expect one of %s",
+		policy, strings.Join(ExistsPolicies, ","))
+}
+
+// TimestampPath returns path with t inserted before its extension, e.g.
+// report.json becomes report-20240101T0203.json
+func TimestampPath(path string, t time.Time) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + t.Format(timestampLayout) + ext
+}
+
+// WriteFile renders report document in format to path, the document is
+// written into a temporary file beside path and renamed over it, so
+// that path holds either the previous report or the whole new one
+func WriteFile(path string, format string, doc Report) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = Render(tmp, format, doc)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// AppendFile merges report document into json report at path, events
+// already in the report are dropped. The document is written as is if
+// path doesn't exist
+func AppendFile(path string, format string, doc Report) error {
+	if format != FormatJSON {
+		return errors.Errorf("output %s can't be appended, only json reports can", Output{Format: format, Path: path})
+	}
+
+	existing, err := Load(path)
+	if os.IsNotExist(err) {
+		return WriteFile(path, format, doc)
+	}
+	if err != nil {
+		return err
+	}
+
+	merged, err := Merge([]string{path, appendSource}, []*Report{existing, &doc})
+	if err != nil {
+		return err
+	}
+	return WriteFile(path, format, merged)
+}
@@ -0,0 +1,61 @@
+package reporter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckExistsPolicy(t *testing.T) {
+	for _, p := range ExistsPolicies {
+		assert.NoError(t, CheckExistsPolicy(p))
+	}
+	assert.Error(t, CheckExistsPolicy("skip"))
+}
+
+func TestTimestampPath(t *testing.T) {
+	at := time.Date(2024, 1, 1, 2, 3, 4, 0, time.UTC)
+	assert.Equal(t, "report-20240101T0203.json", TimestampPath("report.json", at))
+	assert.Equal(t, "out/report-20240101T0203.sarif", TimestampPath("out/report.sarif", at))
+	assert.Equal(t, "report-20240101T0203", TimestampPath("report", at))
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("previous report which is longer than the new one"), 0644))
+
+	doc := Report{SchemaVersion: SchemaVersion, Events: []Event{{Fingerprint: "fp1"}}}
+	assert.NoError(t, WriteFile(path, FormatJSON, doc))
+
+	written, err := Load(path)
+	assert.NoError(t, err)
+	assert.Len(t, written.Events, 1)
+
+	// No temporary file is left
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestAppendFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+
+	first := Report{SchemaVersion: SchemaVersion, Events: []Event{{Fingerprint: "fp1"}, {Fingerprint: "fp2"}}}
+	assert.NoError(t, AppendFile(path, FormatJSON, first))
+	second := Report{SchemaVersion: SchemaVersion, Events: []Event{{Fingerprint: "fp2"}, {Fingerprint: "fp3"}}}
+	assert.NoError(t, AppendFile(path, FormatJSON, second))
+
+	doc, err := Load(path)
+	assert.NoError(t, err)
+	fingerprints := []string{}
+	for _, evt := range doc.Events {
+		fingerprints = append(fingerprints, evt.Fingerprint)
+	}
+	assert.Equal(t, []string{"fp1", "fp2", "fp3"}, fingerprints)
+
+	assert.Error(t, AppendFile(path, FormatSARIF, second))
+}
@@ -0,0 +1,26 @@
+package reporter
+
+// FailedExecutions returns coverage of plugin executions which crashed
+// or ran over budget, failures of soft-fail plugins aren't included
+func (doc Report) FailedExecutions() []Coverage {
+	return doc.coverageOf(ScopeCrashed, ScopeOverrun)
+}
+
+// SoftFailures returns coverage of failed executions of soft-fail
+// plugins
+func (doc Report) SoftFailures() []Coverage {
+	return doc.coverageOf(ScopeSoftFailed)
+}
+
+func (doc Report) coverageOf(scopes ...string) []Coverage {
+	result := []Coverage{}
+	for _, c := range doc.Metadata.Coverage {
+		for _, scope := range scopes {
+			if c.Scope == scope {
+				result = append(result, c)
+				break
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,22 @@
+package reporter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFailures(t *testing.T) {
+	doc := Report{Metadata: Metadata{Coverage: []Coverage{
+		{ImageID: "sha256:aa", Plugin: "veinmind-backdoor", Scope: ScopeCrashed},
+		{ImageID: "sha256:aa", Plugin: "veinmind-sensitive", Scope: ScopeOverrun},
+		{ImageID: "sha256:aa", Plugin: "veinmind-community", Scope: ScopeSoftFailed},
+		{ImageID: "sha256:aa", Plugin: "veinmind-weakpass", Scope: ScopeFullImage},
+	}}}
+
+	failed := doc.FailedExecutions()
+	assert.Len(t, failed, 2)
+	assert.Equal(t, "veinmind-backdoor", failed[0].Plugin)
+	assert.Equal(t, "veinmind-sensitive", failed[1].Plugin)
+	assert.Equal(t, []Coverage{doc.Metadata.Coverage[2]}, doc.SoftFailures())
+	assert.Empty(t, Report{}.FailedExecutions())
+}
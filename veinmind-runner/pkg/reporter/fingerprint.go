@@ -0,0 +1,82 @@
+package reporter
+
+import (
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Markers of values of redacted reports, fingerprints of events holding
+// them can't be recomputed
+const (
+	RedactedValue      = "<redacted>"
+	RedactedPathPrefix = "redacted-path:"
+)
+
+// FingerprintOf recomputes fingerprint of event of version, which fails
+// if key fields of event are redacted
+func FingerprintOf(evt Event, version int) (string, error) {
+	details, _ := json.Marshal(evt.AlertDetails)
+	if strings.Contains(string(details), RedactedValue) || strings.Contains(string(details), RedactedPathPrefix) {
+		return "", errors.New("alert details are redacted")
+	}
+	return report.FingerprintOf(evt.ReportEvent, version)
+}
+
+// HasFingerprint reports whether fingerprint is one of event of any
+// version, e.g. of ignore rules written before fingerprints change
+func HasFingerprint(evt Event, fingerprint string) bool {
+	if evt.Fingerprint == fingerprint {
+		return true
+	}
+	for _, version := range report.FingerprintVersions {
+		if f, err := FingerprintOf(evt, version); err == nil && f == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// FingerprintMigration is result of migrating fingerprints of report,
+// Kept are events whose fingerprints can't be recomputed
+type FingerprintMigration struct {
+	From       int
+	To         int
+	Recomputed int
+	Kept       int
+}
+
+// fingerprintVersion is version of fingerprints of events of doc,
+// documents which don't record it have fingerprints of version 1
+func (doc *Report) fingerprintVersion() int {
+	if doc.FingerprintVersion == 0 {
+		return report.FingerprintV1
+	}
+	return doc.FingerprintVersion
+}
+
+// MigrateFingerprints recomputes fingerprints of events of doc in
+// version, events whose key fields are redacted keep theirs
+func (doc *Report) MigrateFingerprints(version int) (FingerprintMigration, error) {
+	m := FingerprintMigration{From: doc.fingerprintVersion(), To: version}
+	if m.From == version {
+		doc.FingerprintVersion = version
+		return m, nil
+	}
+	if _, err := report.FingerprintOf(report.ReportEvent{}, version); err != nil {
+		return m, err
+	}
+
+	for i, evt := range doc.Events {
+		fingerprint, err := FingerprintOf(evt, version)
+		if err != nil {
+			m.Kept++
+			continue
+		}
+		doc.Events[i].Fingerprint = fingerprint
+		m.Recomputed++
+	}
+	doc.FingerprintVersion = version
+	return m, nil
+}
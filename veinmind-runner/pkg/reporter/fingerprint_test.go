@@ -0,0 +1,51 @@
+package reporter
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func fingerprintEvent(path string) Event {
+	event := report.ReportEvent{ID: "sha256:aa", AlertType: report.Backdoor, AlertDetails: []report.AlertDetail{
+		{BackdoorDetail: &report.BackdoorDetail{FileDetail: report.FileDetail{Path: path}}},
+	}}
+	fingerprint, _ := report.FingerprintOf(event, report.FingerprintV1)
+	return Event{ReportEvent: event, Fingerprint: fingerprint}
+}
+
+func TestMigrateFingerprints(t *testing.T) {
+	doc := &Report{
+		FingerprintVersion: report.FingerprintV1,
+		Events: []Event{
+			fingerprintEvent("/etc/cron.d/job"),
+			fingerprintEvent(RedactedPathPrefix + "0a1b2c3d4e5f6071"),
+		},
+	}
+	redacted := doc.Events[1].Fingerprint
+
+	m, err := doc.MigrateFingerprints(report.FingerprintV2)
+	assert.NoError(t, err)
+	assert.Equal(t, FingerprintMigration{From: report.FingerprintV1, To: report.FingerprintV2, Recomputed: 1, Kept: 1}, m)
+	assert.Equal(t, report.FingerprintV2, doc.FingerprintVersion)
+	assert.Equal(t, Fingerprint(doc.Events[0].ReportEvent), doc.Events[0].Fingerprint)
+	assert.Equal(t, redacted, doc.Events[1].Fingerprint)
+
+	m, err = doc.MigrateFingerprints(report.FingerprintV2)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, m.Recomputed)
+
+	_, err = doc.MigrateFingerprints(99)
+	assert.Error(t, err)
+}
+
+func TestHasFingerprint(t *testing.T) {
+	evt := fingerprintEvent("/etc/cron.d/job")
+	v1 := evt.Fingerprint
+	evt.Fingerprint = Fingerprint(evt.ReportEvent)
+
+	// Fingerprints of any version identify event
+	assert.True(t, HasFingerprint(evt, v1))
+	assert.True(t, HasFingerprint(evt, evt.Fingerprint))
+	assert.False(t, HasFingerprint(evt, fingerprintEvent("/etc/cron.d/other").Fingerprint))
+}
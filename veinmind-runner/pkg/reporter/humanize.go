@@ -0,0 +1,156 @@
+package reporter
+
+import (
+	"fmt"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"strings"
+	"time"
+)
+
+// sizeUnits are IEC units of sizes above bytes
+var sizeUnits = []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// archiveLimitSize is limit of archive service whose max is bytes
+const archiveLimitSize = "size"
+
+// Readable is human-readable companion of raw timestamps and sizes of
+// event, raw values of event stay primary. Details are companions of
+// alert details of the same index
+type Readable struct {
+	Time      string           `json:"time,omitempty"`
+	ImageSize string           `json:"image_size,omitempty"`
+	Details   []ReadableDetail `json:"details,omitempty"`
+}
+
+// ReadableDetail is companion of an alert detail, fields unset in the
+// detail are empty
+type ReadableDetail struct {
+	Size    string `json:"size,omitempty"`
+	Mtime   string `json:"mtime,omitempty"`
+	Ctime   string `json:"ctime,omitempty"`
+	Atime   string `json:"atime,omitempty"`
+	Created string `json:"created,omitempty"`
+	Max     string `json:"max,omitempty"`
+}
+
+// FormatSize formats bytes in IEC units with a decimal, e.g. 1.5 MiB,
+// sizes below 1 KiB are in bytes
+func FormatSize(size int64) string {
+	if size < 1024 && size > -1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	v := float64(size) / 1024
+	unit := 0
+	// Sizes rounding up to 1024 take the next unit
+	for (v >= 1023.95 || v <= -1023.95) && unit < len(sizeUnits)-1 {
+		v /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", v, sizeUnits[unit])
+}
+
+// FormatTime formats time as ISO 8601 in loc, UTC if loc is nil. Zero
+// time is unset and formatted as empty string
+func FormatTime(t time.Time, loc *time.Location) string {
+	if t.IsZero() {
+		return ""
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format(time.RFC3339)
+}
+
+// FormatUnix formats unix seconds as FormatTime does, 0 is unset
+func FormatUnix(sec int64, loc *time.Location) string {
+	if sec == 0 {
+		return ""
+	}
+	return FormatTime(time.Unix(sec, 0), loc)
+}
+
+// fileDetail returns file of alert detail, nil if it has none
+func fileDetail(d report.AlertDetail) *report.FileDetail {
+	switch {
+	case d.MaliciousFileDetail != nil:
+		return &d.MaliciousFileDetail.FileDetail
+	case d.BackdoorDetail != nil:
+		return &d.BackdoorDetail.FileDetail
+	case d.SensitiveFileDetail != nil:
+		return &d.SensitiveFileDetail.FileDetail
+	}
+	return nil
+}
+
+// NewReadable returns companion of timestamps and sizes of event with
+// times in loc, nil if event has none of them
+func NewReadable(evt Event, loc *time.Location) *Readable {
+	r := Readable{Time: FormatTime(evt.Time, loc)}
+	if evt.Image != nil && evt.Image.Size > 0 {
+		r.ImageSize = FormatSize(evt.Image.Size)
+	}
+
+	set := false
+	details := make([]ReadableDetail, len(evt.AlertDetails))
+	for i, d := range evt.AlertDetails {
+		rd := &details[i]
+		if f := fileDetail(d); f != nil {
+			if f.Size > 0 {
+				rd.Size = FormatSize(f.Size)
+			}
+			rd.Mtime = FormatUnix(f.Mtim, loc)
+			rd.Ctime = FormatUnix(f.Ctim, loc)
+			rd.Atime = FormatUnix(f.Atim, loc)
+		}
+		if d.BasicDetail != nil {
+			rd.Created = FormatUnix(d.BasicDetail.CreatedTime, loc)
+		}
+		if d.ArchiveDetail != nil && d.ArchiveDetail.Limit == archiveLimitSize {
+			rd.Max = FormatSize(d.ArchiveDetail.Max)
+		}
+		if *rd != (ReadableDetail{}) {
+			set = true
+		}
+	}
+	if set {
+		r.Details = details
+	}
+
+	if r.Time == "" && r.ImageSize == "" && r.Details == nil {
+		return nil
+	}
+	return &r
+}
+
+// readableNote returns sizes and times of details of event for display,
+// e.g. " (1.5 MiB, modified 2022-04-15T05:20:00Z)"
+func readableNote(evt Event) string {
+	if evt.Readable == nil {
+		return ""
+	}
+
+	notes := []string{}
+	for _, d := range evt.Readable.Details {
+		fields := []string{}
+		if d.Size != "" {
+			fields = append(fields, d.Size)
+		}
+		if d.Mtime != "" {
+			fields = append(fields, "modified "+d.Mtime)
+		}
+		if d.Created != "" {
+			fields = append(fields, "created "+d.Created)
+		}
+		if d.Max != "" {
+			fields = append(fields, "limit "+d.Max)
+		}
+		if len(fields) > 0 {
+			notes = append(notes, strings.Join(fields, ", "))
+		}
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(notes, "; ") + ")"
+}
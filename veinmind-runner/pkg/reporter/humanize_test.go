@@ -0,0 +1,97 @@
+package reporter
+
+import (
+	"bytes"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestFormatSize(t *testing.T) {
+	for size, expected := range map[int64]string{
+		0:                   "0 B",
+		1023:                "1023 B",
+		1024:                "1.0 KiB",
+		1536:                "1.5 KiB",
+		1048524:             "1023.9 KiB",
+		1048575:             "1.0 MiB",
+		5 << 20:             "5.0 MiB",
+		3<<30 + 300<<20:     "3.3 GiB",
+		1 << 40:             "1.0 TiB",
+		-2048:               "-2.0 KiB",
+		9223372036854775807: "8.0 EiB",
+	} {
+		assert.Equal(t, expected, FormatSize(size), "%d", size)
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	assert.Equal(t, "2022-04-15T05:20:00Z", FormatUnix(1649999999+1, nil))
+	assert.Equal(t, "2022-04-15T13:20:00+08:00", FormatUnix(1650000000, shanghai))
+	assert.Equal(t, "", FormatUnix(0, shanghai))
+	assert.Equal(t, "2022-04-15T13:20:00+08:00", FormatTime(time.Unix(1650000000, 500), shanghai))
+	assert.Equal(t, "", FormatTime(time.Time{}, nil))
+}
+
+func TestNewReadable(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	evt := Event{
+		ReportEvent: report.ReportEvent{
+			ID:   "sha256:aa",
+			Time: time.Unix(1650000000, 0),
+			AlertDetails: []report.AlertDetail{
+				{MaliciousFileDetail: &report.MaliciousFileDetail{FileDetail: report.FileDetail{Path: "/bin/x", Size: 1536, Mtim: 1650000000, Atim: 1650003600}}},
+				{WeakpassDetail: &report.WeakpassDetail{Username: "root"}},
+				{BasicDetail: &report.BasicDetail{CreatedTime: 1600000000}},
+				{ArchiveDetail: &report.ArchiveDetail{Path: "/opt/a.zip", Limit: "size", Max: 100 << 20}},
+				{ArchiveDetail: &report.ArchiveDetail{Path: "/opt/b.zip", Limit: "depth", Max: 5}},
+			},
+		},
+		Image: &Image{ID: "sha256:aa", Size: 70 << 20},
+	}
+
+	r := NewReadable(evt, shanghai)
+	require.NotNil(t, r)
+	assert.Equal(t, &Readable{
+		Time:      "2022-04-15T13:20:00+08:00",
+		ImageSize: "70.0 MiB",
+		Details: []ReadableDetail{
+			{Size: "1.5 KiB", Mtime: "2022-04-15T13:20:00+08:00", Atime: "2022-04-15T14:20:00+08:00"},
+			{},
+			{Created: "2020-09-13T20:26:40+08:00"},
+			{Max: "100.0 MiB"},
+			{},
+		},
+	}, r)
+
+	evt.Readable = r
+	assert.Equal(t, " (1.5 KiB, modified 2022-04-15T13:20:00+08:00; created 2020-09-13T20:26:40+08:00; limit 100.0 MiB)", readableNote(evt))
+
+	// Events without timestamps and sizes have no companion
+	assert.Nil(t, NewReadable(Event{ReportEvent: report.ReportEvent{AlertDetails: []report.AlertDetail{{WeakpassDetail: &report.WeakpassDetail{}}}}}, nil))
+	assert.Equal(t, &Readable{Time: "2022-04-15T05:20:00Z"}, NewReadable(Event{ReportEvent: report.ReportEvent{Time: time.Unix(1650000000, 0)}}, nil))
+	assert.Equal(t, "", readableNote(Event{}))
+}
+
+func TestTableReadable(t *testing.T) {
+	evt := Event{ReportEvent: report.ReportEvent{
+		ID:        "sha256:aa",
+		Level:     report.High,
+		AlertType: report.MaliciousFile,
+		AlertDetails: []report.AlertDetail{
+			{MaliciousFileDetail: &report.MaliciousFileDetail{FileDetail: report.FileDetail{Path: "/bin/x", Size: 5 << 20, Mtim: 1650000000}, MaliciousName: "miner"}},
+		},
+	}}
+	evt.Readable = NewReadable(evt, nil)
+
+	b := &bytes.Buffer{}
+	require.NoError(t, WriteTable(b, Report{Events: []Event{evt}}))
+	assert.Contains(t, b.String(), "/bin/x: miner (5.0 MiB, modified 2022-04-15T05:20:00Z)\n")
+
+	b.Reset()
+	require.NoError(t, WriteMarkdown(b, Report{Events: []Event{evt}}))
+	assert.Contains(t, b.String(), "| /bin/x: miner (5.0 MiB, modified 2022-04-15T05:20:00Z) |\n")
+}
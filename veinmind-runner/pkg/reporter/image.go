@@ -0,0 +1,83 @@
+package reporter
+
+import (
+	"github.com/distribution/distribution/reference"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Image is the canonical block of image of events, it's populated once
+// per image from the image itself so that events of the same image
+// carry the same block whichever command scans it. Digest is the
+// manifest digest of repo digests, or ID for images never pulled, and
+// is the key to join events downstream
+type Image struct {
+	ID           string    `json:"id"`
+	Digest       string    `json:"digest"`
+	RepoDigests  []string  `json:"repo_digests,omitempty"`
+	RepoRefs     []string  `json:"repo_refs,omitempty"`
+	Size         int64     `json:"size,omitempty"`
+	Created      time.Time `json:"created,omitempty"`
+	OS           string    `json:"os,omitempty"`
+	Architecture string    `json:"architecture,omitempty"`
+	// Registry is the registry image is pulled from, which is taken
+	// from repo digests
+	Registry string `json:"registry,omitempty"`
+	// Labels are labels of image matched by --label and --label-any
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// NewImage returns image block of id, references with digest are
+// taken as repo digests, both are deduplicated and sorted
+func NewImage(id string, refs []string, digests []string) Image {
+	img := Image{ID: id, Digest: id}
+
+	repoRefs := map[string]struct{}{}
+	repoDigests := map[string]struct{}{}
+	for _, ref := range append(append([]string{}, refs...), digests...) {
+		if ref == "" {
+			continue
+		}
+		if strings.Contains(ref, "@") {
+			repoDigests[ref] = struct{}{}
+		} else {
+			repoRefs[ref] = struct{}{}
+		}
+	}
+	img.RepoRefs = sortedKeys(repoRefs)
+	img.RepoDigests = sortedKeys(repoDigests)
+
+	if len(img.RepoDigests) > 0 {
+		first := img.RepoDigests[0]
+		img.Digest = first[strings.LastIndex(first, "@")+1:]
+		if named, err := reference.ParseNormalizedNamed(first); err == nil {
+			img.Registry = reference.Domain(named)
+		}
+	}
+	return img
+}
+
+// Name returns the primary reference of image for display, ID is
+// returned if image has no reference
+func (i Image) Name() string {
+	if len(i.RepoRefs) > 0 {
+		return i.RepoRefs[0]
+	}
+	if len(i.RepoDigests) > 0 {
+		return i.RepoDigests[0]
+	}
+	return i.ID
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
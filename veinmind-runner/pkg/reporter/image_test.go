@@ -0,0 +1,108 @@
+package reporter
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layer"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const (
+	testImageID     = "sha256:5d0da3dc976460b72c77d94c8a1ad043720b0416bfc16c52c45d4847e53fadb6"
+	testImageDigest = "sha256:2834dc507516af02784808c5f48b7cbe38b8ed5d0f4837f16e78d00deb7e7767"
+)
+
+func TestNewImage(t *testing.T) {
+	img := NewImage(testImageID, []string{
+		"harbor.internal/team/nginx:1.21",
+		"nginx:latest",
+		"harbor.internal/team/nginx@" + testImageDigest,
+	}, []string{"harbor.internal/team/nginx@" + testImageDigest})
+
+	assert.Equal(t, testImageDigest, img.Digest)
+	assert.Equal(t, "harbor.internal", img.Registry)
+	assert.Equal(t, []string{"harbor.internal/team/nginx:1.21", "nginx:latest"}, img.RepoRefs)
+	assert.Equal(t, []string{"harbor.internal/team/nginx@" + testImageDigest}, img.RepoDigests)
+	assert.Equal(t, "harbor.internal/team/nginx:1.21", img.Name())
+
+	local := NewImage(testImageID, nil, nil)
+	assert.Equal(t, testImageID, local.Digest)
+	assert.Equal(t, testImageID, local.Name())
+	assert.Empty(t, local.Registry)
+}
+
+func TestImageBlockOfScans(t *testing.T) {
+	created := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	blocks := []Image{}
+
+	// Runtimes list repo digests either among references or apart
+	// from them, in any order
+	for _, refs := range [][2][]string{
+		{{"harbor.internal/team/nginx@" + testImageDigest, "nginx:1.21", "harbor.internal/team/nginx:1.21"}, nil},
+		{{"harbor.internal/team/nginx:1.21", "nginx:1.21"}, {"harbor.internal/team/nginx@" + testImageDigest}},
+	} {
+		r, err := NewReporter()
+		assert.Nil(t, err)
+		go r.Listen()
+
+		img := NewImage(testImageID, refs[0], refs[1])
+		img.Created = created
+		img.OS = "linux"
+		img.Architecture = "amd64"
+		r.SetImage(img)
+		r.Send(report.ReportEvent{ID: testImageID, Level: report.High})
+		r.StopListen()
+
+		events := r.Events()
+		if assert.Len(t, events, 1) && assert.NotNil(t, events[0].Image) {
+			blocks = append(blocks, *events[0].Image)
+		}
+	}
+
+	if assert.Len(t, blocks, 2) {
+		assert.Equal(t, testImageDigest, blocks[0].Digest)
+		assert.Equal(t, blocks[0], blocks[1])
+	}
+}
+
+func TestEventOfRemovedImage(t *testing.T) {
+	r, err := NewReporter()
+	assert.NoError(t, err)
+	go r.Listen()
+
+	// Image is removed after registry scan, before its events are
+	// converted, what reporter records of it is kept
+	r.SetImage(NewImage(testImageID, []string{"harbor.internal/team/nginx:1.21"}, nil))
+	r.MarkAllowlisted(testImageID)
+	r.SetBaseImage(BaseImage{ImageID: testImageID, Ref: "debian:11", Layers: 1}, func(path string) (layer.Layer, bool) {
+		return layer.Layer{Path: path, Index: 0}, true
+	})
+	r.Send(report.ReportEvent{ID: testImageID, Level: report.High, AlertDetails: []report.AlertDetail{
+		{BackdoorDetail: &report.BackdoorDetail{FileDetail: report.FileDetail{Path: "/etc/cron.d/x"}}},
+	}})
+	r.StopListen()
+
+	events := r.Events()
+	if assert.Len(t, events, 1) {
+		assert.True(t, events[0].Allowlisted)
+		assert.Equal(t, OriginBase, events[0].Origin)
+		assert.Equal(t, []string{"harbor.internal/team/nginx:1.21"}, events[0].ImageRefs)
+	}
+}
+
+func TestResetImageState(t *testing.T) {
+	r, err := NewReporter()
+	assert.NoError(t, err)
+
+	// Long running modes reset reporter every run, state of images of
+	// the previous run doesn't pile up
+	r.SetImage(NewImage(testImageID, nil, nil))
+	r.MarkAllowlisted(testImageID)
+	r.SetLayerIndex(testImageID, &layer.Index{})
+	r.Reset()
+
+	assert.Nil(t, r.Image(testImageID))
+	assert.Empty(t, r.allowlisted)
+	assert.Empty(t, r.indexes)
+}
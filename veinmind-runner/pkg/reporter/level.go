@@ -0,0 +1,88 @@
+package reporter
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Levels are ordered from the most severe one
+var Levels = []report.Level{report.Critical, report.High, report.Medium, report.Low, report.None}
+
+func LevelString(l report.Level) string {
+	b, _ := l.MarshalJSON()
+	return strings.Trim(string(b), `"`)
+}
+
+// ParseLevel parse level name case-insensitively
+func ParseLevel(s string) (report.Level, error) {
+	for _, l := range Levels {
+		if strings.EqualFold(LevelString(l), s) {
+			return l, nil
+		}
+	}
+
+	return report.None, errors.Errorf("level %#v not match", s)
+}
+
+// LevelRank returns comparable severity of level, None is less
+// severe than Low
+func LevelRank(l report.Level) int {
+	if l == report.None {
+		return -1
+	}
+
+	return int(l)
+}
+
+func AlertTypeString(a report.AlertType) string {
+	b, _ := a.MarshalJSON()
+	return strings.Trim(string(b), `"`)
+}
+
+// ParseAlertType parse alert type name case-insensitively
+func ParseAlertType(s string) (report.AlertType, error) {
+	for a := report.Vulnerability; a <= report.Archive; a++ {
+		if strings.EqualFold(AlertTypeString(a), s) {
+			return a, nil
+		}
+	}
+
+	return 0, errors.Errorf("alert type %#v not match", s)
+}
+
+// Paths returns file paths referred by alert details
+func Paths(details []report.AlertDetail) []string {
+	paths := []string{}
+	for _, d := range details {
+		switch {
+		case d.MaliciousFileDetail != nil:
+			paths = append(paths, d.MaliciousFileDetail.Path)
+		case d.BackdoorDetail != nil:
+			paths = append(paths, d.BackdoorDetail.Path)
+		case d.SensitiveFileDetail != nil:
+			paths = append(paths, d.SensitiveFileDetail.Path)
+		case d.ArchiveDetail != nil:
+			paths = append(paths, d.ArchiveDetail.Path)
+		}
+	}
+
+	return paths
+}
+
+// Hashes collects sha256 of files from alert details
+func Hashes(details []report.AlertDetail) []string {
+	hashes := []string{}
+	for _, d := range details {
+		switch {
+		case d.MaliciousFileDetail != nil && d.MaliciousFileDetail.SHA256 != "":
+			hashes = append(hashes, d.MaliciousFileDetail.SHA256)
+		case d.BackdoorDetail != nil && d.BackdoorDetail.SHA256 != "":
+			hashes = append(hashes, d.BackdoorDetail.SHA256)
+		case d.SensitiveFileDetail != nil && d.SensitiveFileDetail.SHA256 != "":
+			hashes = append(hashes, d.SensitiveFileDetail.SHA256)
+		}
+	}
+
+	return hashes
+}
@@ -0,0 +1,68 @@
+package reporter
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestListenConcurrent(t *testing.T) {
+	const producers, count = 8, 50
+
+	r, err := NewReporter(WithCapacity(16), WithListenWorkers(4))
+	assert.Nil(t, err)
+	go r.Listen()
+
+	stop := make(chan struct{})
+	readers := sync.WaitGroup{}
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+				events := r.Events()
+				assert.LessOrEqual(t, len(events), producers*count)
+				_ = r.Snapshot()
+			}
+		}
+	}()
+
+	wg := sync.WaitGroup{}
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				r.Send(report.ReportEvent{ID: strconv.Itoa(p*count + i)})
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	r.StopListen()
+	r.StopListen()
+	close(stop)
+	readers.Wait()
+
+	seen := map[string]bool{}
+	for _, evt := range r.Events() {
+		seen[evt.ID] = true
+	}
+	assert.Len(t, seen, producers*count)
+}
+
+func TestStopListenBeforeListen(t *testing.T) {
+	r, err := NewReporter()
+	assert.Nil(t, err)
+	r.StopListen()
+	r.StopListen()
+
+	_, err = NewReporter(WithListenWorkers(0))
+	assert.Error(t, err)
+}
@@ -0,0 +1,87 @@
+package reporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/pkg/errors"
+	"io/ioutil"
+)
+
+// Fingerprint identifies the same finding across runs, it's derived
+// from the image and the alert of event as defined by the current
+// version of fingerprints
+func Fingerprint(event report.ReportEvent) string {
+	return report.Fingerprint(event)
+}
+
+// Load reads report document written by reporter
+func Load(path string) (*Report, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := Parse(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "report %#v", path)
+	}
+
+	return doc, nil
+}
+
+// Parse parse report document of any schema version up to SchemaVersion,
+// reports of newer versions are refused since they can't be understood
+func Parse(b []byte) (*Report, error) {
+	b = bytes.TrimSpace(b)
+	doc := &Report{}
+
+	switch {
+	case len(b) == 0:
+		// Runner before schema version writes nothing when there are no events
+		doc.Events = []Event{}
+	case b[0] == '[':
+		// Runner before schema version writes a bare array of events
+		if err := json.Unmarshal(b, &doc.Events); err != nil {
+			return nil, err
+		}
+	default:
+		version := struct {
+			SchemaVersion *int `json:"schema_version"`
+		}{}
+		if err := json.Unmarshal(b, &version); err != nil {
+			return nil, err
+		}
+
+		if version.SchemaVersion == nil {
+			return nil, errors.New("schema version is missing")
+		}
+
+		if *version.SchemaVersion > SchemaVersion {
+			return nil, errors.Errorf("schema version %d is newer than the supported version %d, please upgrade veinmind-runner",
+				*version.SchemaVersion, SchemaVersion)
+		}
+
+		if err := json.Unmarshal(b, doc); err != nil {
+			return nil, err
+		}
+	}
+
+	// Older reports have fingerprints of version 1 or none, which are
+	// computed in the version of report
+	if doc.FingerprintVersion == 0 {
+		doc.FingerprintVersion = report.FingerprintV1
+	}
+	for i := range doc.Events {
+		if doc.Events[i].Fingerprint == "" {
+			fingerprint, err := report.FingerprintOf(doc.Events[i].ReportEvent, doc.FingerprintVersion)
+			if err != nil {
+				return nil, err
+			}
+			doc.Events[i].Fingerprint = fingerprint
+		}
+	}
+	doc.SchemaVersion = SchemaVersion
+
+	return doc, nil
+}
@@ -0,0 +1,41 @@
+package reporter
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	legacy := `[{"id": "sha256:aa", "level": "High", "alert_type": "Weakpass", "image_refs": ["app:latest"]}]`
+	doc, err := Parse([]byte(legacy))
+	assert.NoError(t, err)
+	assert.Len(t, doc.Events, 1)
+	assert.Equal(t, SchemaVersion, doc.SchemaVersion)
+	// Legacy reports have fingerprints of version 1
+	assert.Equal(t, report.FingerprintV1, doc.FingerprintVersion)
+	v1, err := report.FingerprintOf(doc.Events[0].ReportEvent, report.FingerprintV1)
+	assert.NoError(t, err)
+	assert.Equal(t, v1, doc.Events[0].Fingerprint)
+
+	doc, err = Parse([]byte(""))
+	assert.NoError(t, err)
+	assert.Len(t, doc.Events, 0)
+
+	current := `{"schema_version": 1, "metadata": {}, "events": [{"id": "sha256:aa", "fingerprint": "fp"}]}`
+	doc, err = Parse([]byte(current))
+	assert.NoError(t, err)
+	assert.Equal(t, "fp", doc.Events[0].Fingerprint)
+
+	versioned := `{"schema_version": 1, "fingerprint_version": 2, "metadata": {}, "events": [{"id": "sha256:aa"}]}`
+	doc, err = Parse([]byte(versioned))
+	assert.NoError(t, err)
+	assert.Equal(t, report.FingerprintV2, doc.FingerprintVersion)
+	assert.Equal(t, Fingerprint(doc.Events[0].ReportEvent), doc.Events[0].Fingerprint)
+
+	_, err = Parse([]byte(`{"schema_version": 999, "events": []}`))
+	assert.Error(t, err)
+
+	_, err = Parse([]byte(`{"events": []}`))
+	assert.Error(t, err)
+}
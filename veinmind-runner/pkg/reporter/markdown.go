@@ -0,0 +1,246 @@
+package reporter
+
+import (
+	"fmt"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/cibuild"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/kubelet"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layer"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/target"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// MarkdownMaxRows limits rows of the markdown event table, so that
+// the summary fits into comments of code review platforms
+const MarkdownMaxRows = 100
+
+// WriteMarkdown renders summary of report as markdown
+func WriteMarkdown(w io.Writer, doc Report) error {
+	b := &strings.Builder{}
+	b.WriteString("## veinmind-runner scan result\n\n")
+	if doc.Metadata.Build != nil {
+		b.WriteString("Build: " + markdownBuild(*doc.Metadata.Build.Ref()) + "\n\n")
+	}
+	if doc.Metadata.Progress != nil {
+		b.WriteString("> " + doc.Metadata.Progress.String() + "\n\n")
+	}
+
+	if len(doc.Events) == 0 {
+		b.WriteString("No security issue found.\n")
+	} else {
+		writeMarkdownEvents(b, doc.Events)
+	}
+	writeMarkdownSuppressions(b, doc.Metadata.Suppressions)
+	writeMarkdownFailedTargets(b, doc.Metadata.FailedTargets)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMarkdownEvents(b *strings.Builder, events []Event) {
+	counts := map[report.Level]int{}
+	for _, evt := range events {
+		counts[evt.Level]++
+	}
+
+	b.WriteString("| Level | Count |\n| --- | --- |\n")
+	for _, l := range Levels {
+		if counts[l] > 0 {
+			b.WriteString(fmt.Sprintf("| %s | %d |\n", LevelString(l), counts[l]))
+		}
+	}
+
+	b.WriteString("\n| Image | Level | Alert | Detail |\n| --- | --- | --- | --- |\n")
+	for i, evt := range events {
+		if i >= MarkdownMaxRows {
+			b.WriteString(fmt.Sprintf("\n%d more events are omitted, see the full report.\n", len(events)-MarkdownMaxRows))
+			break
+		}
+
+		image := displayImage(evt) + workloadNote(evt.Workloads)
+		if evt.Allowlisted {
+			image += " (allowlisted)"
+		}
+		if evt.Suppressed != nil {
+			image += fmt.Sprintf(" (%d events collapsed)", evt.Suppressed.Suppressed)
+		}
+		if evt.Monitor != nil {
+			image += " (monitor-only)"
+		}
+		if evt.Build != nil {
+			image += " (built by " + markdownBuild(*evt.Build) + ")"
+		}
+
+		b.WriteString(fmt.Sprintf("| %s | %s | %s | %s%s |\n",
+			escapeMarkdown(image), LevelString(evt.Level),
+			AlertTypeString(evt.AlertType), escapeMarkdown(Describe(evt.AlertDetails)+readableNote(evt)+encodingNote(evt)),
+			markdownLayers(evt.Layers)+markdownArtifactLinks(evt.Artifacts)+markdownRemediation(evt.Remediation)))
+	}
+}
+
+// displayImage returns image of event for readers, canonical digest
+// is the key of image and reference is kept alongside
+func displayImage(evt Event) string {
+	if evt.Image != nil {
+		image := evt.Image.Digest
+		if name := evt.Image.Name(); name != evt.Image.Digest {
+			image += " (" + name + ")"
+		}
+		return image + platformNote(evt)
+	}
+
+	if len(evt.ImageRefs) > 0 {
+		return evt.ImageRefs[0]
+	}
+	return evt.ID
+}
+
+// platformNote returns platforms of grouped event for display
+func platformNote(evt Event) string {
+	if len(evt.Platforms) == 0 {
+		return ""
+	}
+	note := " [" + strings.Join(evt.Platforms, ", ")
+	if evt.PlatformSpecific {
+		note += " only"
+	}
+	return note + "]"
+}
+
+// workloadNote returns pods running image of event for display
+func workloadNote(workloads []kubelet.Workload) string {
+	pods := []string{}
+	seen := map[string]struct{}{}
+	for _, w := range workloads {
+		pod := w.Namespace + "/" + w.Pod
+		if _, ok := seen[pod]; !ok {
+			seen[pod] = struct{}{}
+			pods = append(pods, pod)
+		}
+	}
+	if len(pods) == 0 {
+		return ""
+	}
+	return " (pods: " + strings.Join(pods, ", ") + ")"
+}
+
+func writeMarkdownFailedTargets(b *strings.Builder, failures []target.Failure) {
+	if len(failures) == 0 {
+		return
+	}
+
+	b.WriteString(fmt.Sprintf("\n### %d target(s) failed to be scanned\n\n", len(failures)))
+	b.WriteString("| Target | Stage | Code | Error |\n| --- | --- | --- | --- |\n")
+	for _, f := range failures {
+		b.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n",
+			escapeMarkdown(f.Target), f.Stage, f.Code, escapeMarkdown(f.Error)))
+	}
+}
+
+func writeMarkdownSuppressions(b *strings.Builder, suppressions []Suppression) {
+	if len(suppressions) == 0 {
+		return
+	}
+
+	b.WriteString(fmt.Sprintf("\n### %d plugin execution(s) exceeded event limit\n\n", len(suppressions)))
+	b.WriteString("| Image | Plugin | Events | Kept | Collapsed |\n| --- | --- | --- | --- | --- |\n")
+	for _, s := range suppressions {
+		b.WriteString(fmt.Sprintf("| %s | %s | %d | %d | %d |\n",
+			escapeMarkdown(s.ImageID), escapeMarkdown(s.Plugin), s.Total, s.Limit, s.Suppressed))
+	}
+}
+
+// Describe returns a short description of alert details
+func Describe(details []report.AlertDetail) string {
+	desc := []string{}
+	for _, d := range details {
+		switch {
+		case d.MaliciousFileDetail != nil:
+			desc = append(desc, d.MaliciousFileDetail.Path+": "+d.MaliciousFileDetail.MaliciousName)
+		case d.WeakpassDetail != nil:
+			desc = append(desc, "weak password of user "+d.WeakpassDetail.Username)
+		case d.BackdoorDetail != nil:
+			desc = append(desc, d.BackdoorDetail.Path+": "+d.BackdoorDetail.Description)
+		case d.SensitiveFileDetail != nil:
+			desc = append(desc, d.SensitiveFileDetail.Path+": "+d.SensitiveFileDetail.RuleDescription)
+		case d.SensitiveEnvDetail != nil:
+			desc = append(desc, d.SensitiveEnvDetail.Key+": "+d.SensitiveEnvDetail.RuleDescription)
+		case d.HistoryDetail != nil:
+			desc = append(desc, d.HistoryDetail.Instruction+": "+d.HistoryDetail.Description)
+		case d.SignatureDetail != nil:
+			desc = append(desc, d.SignatureDetail.Scheme+": "+d.SignatureDetail.Reason)
+		case d.BuildDetail != nil:
+			desc = append(desc, d.BuildDetail.Instruction+": "+d.BuildDetail.Description)
+		case d.ArchiveDetail != nil:
+			desc = append(desc, fmt.Sprintf("%s: %s limit %d exceeded at %s",
+				d.ArchiveDetail.Path, d.ArchiveDetail.Limit, d.ArchiveDetail.Max, d.ArchiveDetail.Member))
+		}
+	}
+
+	return strings.Join(desc, "; ")
+}
+
+// markdownLayers renders instructions introducing files of event, so
+// that developers see which line of Dockerfile to fix
+func markdownLayers(layers []layer.Provenance) string {
+	b := &strings.Builder{}
+	for _, l := range layers {
+		b.WriteString("<br>")
+		b.WriteString(escapeMarkdown(l.Path + " " + introducedBy(l)))
+	}
+	return b.String()
+}
+
+// markdownArtifactLinks links artifacts of event by their file names
+func markdownArtifactLinks(artifacts []string) string {
+	links := []string{}
+	for _, a := range artifacts {
+		link := (&url.URL{Path: filepath.ToSlash(a)}).String()
+		links = append(links, fmt.Sprintf("[%s](%s)", escapeLinkText(filepath.Base(a)), link))
+	}
+
+	if len(links) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(links, ", ") + ")"
+}
+
+// markdownBuild links build by its url if it has one
+func markdownBuild(ref cibuild.Ref) string {
+	if ref.URL == "" {
+		return escapeMarkdown(ref.String())
+	}
+	return fmt.Sprintf("[%s](%s)", escapeMarkdown(ref.String()), ref.URL)
+}
+
+// markdownRemediation renders suggestions of event under its detail,
+// a line of code per line of suggestion
+func markdownRemediation(suggestions []string) string {
+	if len(suggestions) == 0 {
+		return ""
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("<br>**Remediation:**")
+	for _, s := range suggestions {
+		for _, line := range strings.Split(s, "\n") {
+			b.WriteString("<br>`" + strings.ReplaceAll(escapeMarkdown(line), "`", "'") + "`")
+		}
+	}
+	return b.String()
+}
+
+func escapeMarkdown(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// escapeLinkText escapes text of link, brackets in names of files would
+// end the text early
+func escapeLinkText(s string) string {
+	s = strings.ReplaceAll(s, "[", `\[`)
+	return escapeMarkdown(strings.ReplaceAll(s, "]", `\]`))
+}
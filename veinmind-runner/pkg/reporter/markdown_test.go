@@ -0,0 +1,24 @@
+package reporter
+
+import (
+	"bytes"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMarkdownArtifactLinks(t *testing.T) {
+	doc := Report{SchemaVersion: SchemaVersion, Events: []Event{{
+		ReportEvent: report.ReportEvent{ID: "sha256:aa", Level: report.High, AlertType: report.Backdoor},
+		Artifacts: []string{
+			"artifacts/sha256:aa/evt-1/yara.json",
+			"artifacts/sha256:aa/evt-1/match [1]|x.txt",
+		},
+	}}}
+
+	b := &bytes.Buffer{}
+	require.NoError(t, WriteMarkdown(b, doc))
+	assert.Contains(t, b.String(), " ([yara.json](artifacts/sha256:aa/evt-1/yara.json), "+
+		`[match \[1\]\|x.txt](artifacts/sha256:aa/evt-1/match%20%5B1%5D%7Cx.txt)) |`)
+}
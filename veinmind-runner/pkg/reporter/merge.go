@@ -0,0 +1,116 @@
+package reporter
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/hashcache"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layercache"
+	"github.com/pkg/errors"
+)
+
+// Source is a report merged into a report document
+type Source struct {
+	Report string `json:"report"`
+	Events int    `json:"events"`
+	// Duplicates is number of events of report already in reports
+	// merged before it
+	Duplicates int `json:"duplicates,omitempty"`
+	// Partial tells report is flushed while its scan is running
+	Partial bool `json:"partial,omitempty"`
+}
+
+// Merge merges report documents loaded from sources, events are
+// deduplicated by fingerprint in order of documents and metadata
+// sections are concatenated. Sources of documents which are merged
+// themselves are carried over instead of the document. Fingerprints of
+// documents are migrated to the newest version among them before
+// deduplication. Events of references scanned for several platforms
+// are grouped afterwards
+func Merge(sources []string, docs []*Report) (Report, error) {
+	merged := Report{
+		SchemaVersion: SchemaVersion,
+		Events:        []Event{},
+	}
+	if len(sources) != len(docs) {
+		return merged, errors.New("number of sources doesn't match number of reports")
+	}
+	for _, doc := range docs {
+		if v := doc.fingerprintVersion(); v > merged.FingerprintVersion {
+			merged.FingerprintVersion = v
+		}
+	}
+
+	seen := map[string]struct{}{}
+	for i, doc := range docs {
+		if doc.SchemaVersion != SchemaVersion {
+			return merged, errors.Errorf("report %#v has schema version %d, expect %d",
+				sources[i], doc.SchemaVersion, SchemaVersion)
+		}
+		if doc.fingerprintVersion() != merged.FingerprintVersion {
+			migrated := *doc
+			migrated.Events = append([]Event(nil), doc.Events...)
+			m, err := migrated.MigrateFingerprints(merged.FingerprintVersion)
+			if err != nil {
+				return merged, errors.Wrapf(err, "report %#v", sources[i])
+			}
+			if m.Kept > 0 {
+				log.Warnf("Report %#v: %d redacted event(s) keep fingerprints of version %d\n", sources[i], m.Kept, m.From)
+			}
+			doc = &migrated
+		}
+
+		source := Source{Report: sources[i], Events: len(doc.Events), Partial: doc.Metadata.Progress != nil}
+		for _, evt := range doc.Events {
+			if _, ok := seen[evt.Fingerprint]; ok {
+				source.Duplicates++
+				continue
+			}
+			seen[evt.Fingerprint] = struct{}{}
+			merged.Events = append(merged.Events, evt)
+		}
+
+		m := &merged.Metadata
+		if len(doc.Metadata.Sources) > 0 {
+			m.Sources = append(m.Sources, doc.Metadata.Sources...)
+		} else {
+			m.Sources = append(m.Sources, source)
+		}
+		m.Signatures = append(m.Signatures, doc.Metadata.Signatures...)
+		m.BaseImages = append(m.BaseImages, doc.Metadata.BaseImages...)
+		m.Coverage = append(m.Coverage, doc.Metadata.Coverage...)
+		m.FailedTargets = append(m.FailedTargets, doc.Metadata.FailedTargets...)
+		m.Pulls = append(m.Pulls, doc.Metadata.Pulls...)
+		m.Artifacts = append(m.Artifacts, doc.Metadata.Artifacts...)
+		m.Suppressions = append(m.Suppressions, doc.Metadata.Suppressions...)
+		m.Superseded = append(m.Superseded, doc.Metadata.Superseded...)
+		m.BuildHistories = append(m.BuildHistories, doc.Metadata.BuildHistories...)
+		m.Platforms = append(m.Platforms, doc.Metadata.Platforms...)
+		m.Walks = append(m.Walks, doc.Metadata.Walks...)
+		m.AdaptiveThreads = append(m.AdaptiveThreads, doc.Metadata.AdaptiveThreads...)
+		if s := doc.Metadata.HashCache; s != nil {
+			if m.HashCache == nil {
+				m.HashCache = &hashcache.Stats{}
+			}
+			m.HashCache.Hits += s.Hits
+			m.HashCache.Misses += s.Misses
+			m.HashCache.Evictions += s.Evictions
+		}
+		if s := doc.Metadata.LayerCache; s != nil {
+			if m.LayerCache == nil {
+				m.LayerCache = &layercache.Stats{}
+			}
+			m.LayerCache.Hits += s.Hits
+			m.LayerCache.Misses += s.Misses
+			m.LayerCache.Avoided += s.Avoided
+			m.LayerCache.Uncacheable += s.Uncacheable
+		}
+		// Events carry builds of their own, the build of the first
+		// report run in CI is kept
+		if m.Build == nil {
+			m.Build = doc.Metadata.Build
+		}
+		// Event channel, schedule, registry and throttle statistics,
+		// configuration and progress are of a single runner process
+		// and aren't merged
+	}
+	return GroupPlatforms(merged), nil
+}
@@ -0,0 +1,88 @@
+package reporter
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/cibuild"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/hashcache"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layercache"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/target"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	a := &Report{
+		SchemaVersion: SchemaVersion,
+		Metadata: Metadata{
+			Coverage:   []Coverage{{ImageID: "sha256:aa", Scope: ScopeFullImage}},
+			HashCache:  &hashcache.Stats{Hits: 1, Misses: 2},
+			LayerCache: &layercache.Stats{Hits: 2, Avoided: 2},
+		},
+		Events: []Event{{Fingerprint: "fp1"}, {Fingerprint: "fp2"}},
+	}
+	b := &Report{
+		SchemaVersion: SchemaVersion,
+		Metadata: Metadata{
+			Coverage:      []Coverage{{ImageID: "sha256:bb", Scope: ScopeLayers}},
+			FailedTargets: []target.Failure{{Target: "redis"}},
+			HashCache:     &hashcache.Stats{Hits: 3, Evictions: 1},
+			LayerCache:    &layercache.Stats{Hits: 1, Misses: 3, Avoided: 1, Uncacheable: 1},
+			Build:         &cibuild.Build{Provider: "github", ID: "42"},
+		},
+		Events: []Event{{Fingerprint: "fp2"}, {Fingerprint: "fp3"}},
+	}
+
+	merged, err := Merge([]string{"a.json", "b.json"}, []*Report{a, b})
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaVersion, merged.SchemaVersion)
+	assert.Equal(t, []Event{{Fingerprint: "fp1"}, {Fingerprint: "fp2"}, {Fingerprint: "fp3"}}, merged.Events)
+	assert.Equal(t, []Coverage{a.Metadata.Coverage[0], b.Metadata.Coverage[0]}, merged.Metadata.Coverage)
+	assert.Equal(t, b.Metadata.FailedTargets, merged.Metadata.FailedTargets)
+	assert.Equal(t, &hashcache.Stats{Hits: 4, Misses: 2, Evictions: 1}, merged.Metadata.HashCache)
+	assert.Equal(t, &layercache.Stats{Hits: 3, Misses: 3, Avoided: 3, Uncacheable: 1}, merged.Metadata.LayerCache)
+	assert.Equal(t, b.Metadata.Build, merged.Metadata.Build)
+	assert.Equal(t, []Source{
+		{Report: "a.json", Events: 2},
+		{Report: "b.json", Events: 2, Duplicates: 1},
+	}, merged.Metadata.Sources)
+
+	// Sources of merged reports are carried over
+	c := &Report{SchemaVersion: SchemaVersion, Events: []Event{{Fingerprint: "fp4"}}}
+	again, err := Merge([]string{"merged.json", "c.json"}, []*Report{&merged, c})
+	assert.NoError(t, err)
+	assert.Len(t, again.Events, 4)
+	assert.Equal(t, []Source{
+		{Report: "a.json", Events: 2},
+		{Report: "b.json", Events: 2, Duplicates: 1},
+		{Report: "c.json", Events: 1},
+	}, again.Metadata.Sources)
+
+	_, err = Merge([]string{"a.json", "old.json"}, []*Report{a, {SchemaVersion: SchemaVersion + 1}})
+	assert.EqualError(t, err, `report "old.json" has schema version 2, expect 1`)
+}
+
+func TestMergeFingerprintVersions(t *testing.T) {
+	event := report.ReportEvent{ID: "sha256:aa", AlertType: report.Backdoor, AlertDetails: []report.AlertDetail{
+		{BackdoorDetail: &report.BackdoorDetail{FileDetail: report.FileDetail{Path: "/etc/cron.d/job"}}},
+	}}
+	v1, err := report.FingerprintOf(event, report.FingerprintV1)
+	assert.NoError(t, err)
+
+	old := &Report{
+		SchemaVersion:      SchemaVersion,
+		FingerprintVersion: report.FingerprintV1,
+		Events:             []Event{{ReportEvent: event, Fingerprint: v1}},
+	}
+	current := &Report{
+		SchemaVersion:      SchemaVersion,
+		FingerprintVersion: report.FingerprintVersion,
+		Events:             []Event{{ReportEvent: event, Fingerprint: Fingerprint(event)}},
+	}
+	merged, err := Merge([]string{"old.json", "current.json"}, []*Report{old, current})
+	assert.NoError(t, err)
+	assert.Equal(t, report.FingerprintVersion, merged.FingerprintVersion)
+	assert.Len(t, merged.Events, 1)
+	assert.Equal(t, Fingerprint(event), merged.Events[0].Fingerprint)
+	// Merged reports are left as they are
+	assert.Equal(t, v1, old.Events[0].Fingerprint)
+}
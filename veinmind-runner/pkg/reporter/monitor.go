@@ -0,0 +1,61 @@
+package reporter
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Enforcement modes of plugins
+const (
+	// ModeEnforce counts events of plugin toward exit code
+	ModeEnforce = "enforce"
+	// ModeMonitor reports events of plugin as monitor-only, which
+	// never fail the scan
+	ModeMonitor = "monitor"
+	// ModeDisabled doesn't run plugin
+	ModeDisabled = "disabled"
+)
+
+var Modes = []string{ModeEnforce, ModeMonitor, ModeDisabled}
+
+// CheckMode checks mode is one of Modes
+func CheckMode(mode string) error {
+	for _, m := range Modes {
+		if m == mode {
+			return nil
+		}
+	}
+	return errors.Errorf("unknown mode %#v, expect one of %s", mode, strings.Join(Modes, ","))
+}
+
+// Monitor marks event of plugin in monitor mode
+type Monitor struct {
+	Plugin string `json:"plugin"`
+}
+
+// AddMonitored appends event of plugin in monitor mode, which is marked
+// as monitor-only
+func (r *Reporter) AddMonitored(plugin string, event report.ReportEvent) {
+	evt, err := r.convert(event)
+	if err != nil {
+		log.Error(err)
+	}
+	evt.Monitor = &Monitor{Plugin: plugin}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, evt)
+}
+
+// Monitored returns number of monitor-only events in doc
+func (doc Report) Monitored() int {
+	n := 0
+	for _, evt := range doc.Events {
+		if evt.Monitor != nil {
+			n++
+		}
+	}
+	return n
+}
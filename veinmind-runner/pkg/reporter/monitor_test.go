@@ -0,0 +1,30 @@
+package reporter
+
+import (
+	"bytes"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMonitored(t *testing.T) {
+	doc := Report{
+		SchemaVersion: SchemaVersion,
+		Events: []Event{
+			{ReportEvent: report.ReportEvent{ID: testImageID, Level: report.High, AlertType: report.Weakpass}},
+			{
+				ReportEvent: report.ReportEvent{ID: testImageID, Level: report.Critical, AlertType: report.MaliciousFile},
+				Monitor:     &Monitor{Plugin: "veinmind-new"},
+			},
+		},
+	}
+	assert.Equal(t, 1, doc.Monitored())
+
+	b := &bytes.Buffer{}
+	assert.NoError(t, WriteTable(b, doc))
+	assert.Contains(t, b.String(), testImageID+" (monitor-only)")
+	assert.Contains(t, b.String(), "2 event(s), 1 of them monitor-only\n")
+
+	assert.NoError(t, CheckMode(ModeMonitor))
+	assert.Error(t, CheckMode("audit"))
+}
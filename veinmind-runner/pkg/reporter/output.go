@@ -0,0 +1,120 @@
+package reporter
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+)
+
+// Formats of report outputs
+const (
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+	FormatTable    = "table"
+	FormatSARIF    = "sarif"
+)
+
+var Formats = []string{FormatJSON, FormatMarkdown, FormatTable, FormatSARIF}
+
+// Stdout is the path of output written to stdout
+const Stdout = "-"
+
+// Output is a report output, written to stdout if Path is Stdout.
+// Legacy outputs are given by a bare path, which writes json to both
+// path and stdout as runner did before outputs were selectable
+type Output struct {
+	Format string
+	Path   string
+	Legacy bool
+}
+
+func (o Output) String() string {
+	return o.Format + "=" + o.Path
+}
+
+// ParseOutput parses output in form of format=path, a value without
+// known format is taken as a legacy path
+func ParseOutput(s string) (Output, error) {
+	if i := strings.Index(s, "="); i != -1 {
+		format, path := s[:i], s[i+1:]
+		if err := checkFormat(format); err == nil {
+			if path == "" {
+				return Output{}, errors.Errorf("empty path of output %#v", s)
+			}
+			return Output{Format: format, Path: path}, nil
+		} else if !strings.ContainsAny(format, `./\`) {
+			return Output{}, err
+		}
+	}
+
+	if s == "" {
+		return Output{}, errors.New("empty output")
+	}
+	return Output{Format: FormatJSON, Path: s, Legacy: true}, nil
+}
+
+// ParseOutputs parses outputs, legacy outputs are expanded to the
+// file and stdout
+func ParseOutputs(values []string) ([]Output, error) {
+	outputs := []Output{}
+	for _, v := range values {
+		o, err := ParseOutput(v)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, o)
+		if o.Legacy {
+			outputs = append(outputs, Output{Format: FormatJSON, Path: Stdout, Legacy: true})
+		}
+	}
+	return outputs, nil
+}
+
+// HasStdout tells if any of outputs is written to stdout
+func HasStdout(outputs []Output) bool {
+	for _, o := range outputs {
+		if o.Path == Stdout {
+			return true
+		}
+	}
+	return false
+}
+
+func checkFormat(format string) error {
+	for _, f := range Formats {
+		if f == format {
+			return nil
+		}
+	}
+	return errors.Errorf("unknown output format %#v, expect one of %s",
+		format, strings.Join(Formats, ","))
+}
+
+// Render writes report document in format
+func Render(w io.Writer, format string, doc Report) error {
+	switch format {
+	case FormatJSON:
+		return WriteJSON(w, doc)
+	case FormatMarkdown:
+		return WriteMarkdown(w, doc)
+	case FormatTable:
+		return WriteTable(w, doc)
+	case FormatSARIF:
+		return WriteSARIF(w, doc)
+	default:
+		return checkFormat(format)
+	}
+}
+
+// RenderWhole renders report document in format and writes it to w in
+// a single write, so that the report is contiguous on a stream shared
+// with logs
+func RenderWhole(w io.Writer, format string, doc Report) error {
+	buf := &bytes.Buffer{}
+	if err := Render(buf, format, doc); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
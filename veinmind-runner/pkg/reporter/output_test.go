@@ -0,0 +1,173 @@
+package reporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/cibuild"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layer"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/pluginlog"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/summary"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseOutputs(t *testing.T) {
+	outputs, err := ParseOutputs([]string{"json=report.json", "sarif=out/report.sarif", "table=-", "out/a=b.json"})
+	assert.Nil(t, err)
+	assert.Equal(t, []Output{
+		{Format: FormatJSON, Path: "report.json"},
+		{Format: FormatSARIF, Path: "out/report.sarif"},
+		{Format: FormatTable, Path: Stdout},
+		{Format: FormatJSON, Path: "out/a=b.json", Legacy: true},
+		{Format: FormatJSON, Path: Stdout, Legacy: true},
+	}, outputs)
+
+	for _, v := range []string{"", "xml=report.xml", "json="} {
+		_, err := ParseOutput(v)
+		assert.Error(t, err, v)
+	}
+}
+
+func TestRender(t *testing.T) {
+	doc := Report{
+		SchemaVersion: SchemaVersion,
+		Events: []Event{{
+			ReportEvent: report.ReportEvent{
+				ID:        testImageID,
+				Level:     report.High,
+				AlertType: report.Backdoor,
+				AlertDetails: []report.AlertDetail{{
+					BackdoorDetail: &report.BackdoorDetail{
+						FileDetail:  report.FileDetail{Path: "/etc/cron.d/backdoor"},
+						Description: "crontab backdoor",
+					},
+				}},
+			},
+			Image: &Image{ID: testImageID, Digest: testImageDigest, RepoRefs: []string{"nginx:1.21"}},
+			Layers: []layer.Provenance{{
+				Path:      "/etc/cron.d/backdoor",
+				Index:     2,
+				Digest:    "sha256:l2",
+				CreatedBy: "COPY backdoor /etc/cron.d/",
+			}},
+		}},
+	}
+
+	for _, format := range Formats {
+		b := &bytes.Buffer{}
+		assert.Nil(t, Render(b, format, doc), format)
+		assert.Contains(t, b.String(), testImageDigest, format)
+	}
+	assert.Error(t, Render(&bytes.Buffer{}, "xml", doc))
+
+	b := &bytes.Buffer{}
+	assert.Nil(t, WriteSARIF(b, doc))
+	sarif := sarifLog{}
+	assert.Nil(t, json.Unmarshal(b.Bytes(), &sarif))
+	if assert.Len(t, sarif.Runs, 1) && assert.Len(t, sarif.Runs[0].Results, 1) {
+		result := sarif.Runs[0].Results[0]
+		assert.Equal(t, "error", result.Level)
+		assert.Equal(t, AlertTypeString(report.Backdoor), result.RuleID)
+		assert.Equal(t, "etc/cron.d/backdoor", result.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+		assert.Equal(t, "introduced by layer 2: COPY backdoor /etc/cron.d/", result.Locations[0].Message.Text)
+	}
+
+	b = &bytes.Buffer{}
+	assert.Nil(t, WriteMarkdown(b, doc))
+	assert.Contains(t, b.String(), "/etc/cron.d/backdoor introduced by layer 2: COPY backdoor /etc/cron.d/")
+}
+
+func TestMarkdownBuild(t *testing.T) {
+	build := cibuild.Build{Provider: "github", ID: "42", URL: "https://github.com/chaitin/app/actions/runs/42"}
+	doc := Report{
+		Metadata: Metadata{Build: &build},
+		Events: []Event{
+			{ReportEvent: report.ReportEvent{ID: "sha256:aa", AlertType: report.Backdoor}, Build: build.Ref()},
+			{ReportEvent: report.ReportEvent{ID: "sha256:bb", AlertType: report.Backdoor}},
+		},
+	}
+
+	b := &bytes.Buffer{}
+	assert.NoError(t, WriteMarkdown(b, doc))
+	assert.Contains(t, b.String(), "Build: [github #42](https://github.com/chaitin/app/actions/runs/42)\n")
+	assert.Equal(t, 1, strings.Count(b.String(), "(built by [github #42]"))
+}
+
+// writeCounter counts writes to buffer
+type writeCounter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *writeCounter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+// TestStdoutReport shuts down a scan the way runner does while a stub
+// plugin logs right up to exit and another is still logging, stdout
+// must hold exactly one report
+func TestStdoutReport(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+
+	stdout := &writeCounter{}
+	stderr := &bytes.Buffer{}
+	out := pluginlog.New(stderr, false)
+
+	// Plugin logging to both stdout and stderr until it exits, the
+	// last line has no newline
+	stub := exec.Command("sh", "-c", `i=0; while [ $i -lt 500 ]; do echo "log $i"; echo "warn $i" >&2; i=$((i+1)); done; printf bye`)
+	w := out.Writer("stub/nginx:latest")
+	stub.Stdout = w
+	stub.Stderr = w
+
+	// Plugin which keeps logging through shutdown
+	late := out.Writer("late/nginx:latest")
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				late.Write([]byte("{\"late\": true}\n"))
+			}
+		}
+	}()
+
+	assert.NoError(t, stub.Run())
+	w.Close()
+	out.Close()
+
+	doc := Report{
+		SchemaVersion: SchemaVersion,
+		Events:        []Event{{ReportEvent: report.ReportEvent{ID: testImageID, Level: report.High, AlertType: report.Weakpass}}},
+	}
+	assert.NoError(t, RenderWhole(stdout, FormatJSON, doc))
+	summary.NewEmitter(stderr, func() summary.Summary { return summary.Summary{Scanned: 1, Events: 1} }).Emit(0)
+	close(stop)
+	wg.Wait()
+
+	assert.Equal(t, 1, stdout.writes)
+	dec := json.NewDecoder(&stdout.Buffer)
+	var got Report
+	assert.NoError(t, dec.Decode(&got))
+	assert.Len(t, got.Events, 1)
+	assert.Equal(t, io.EOF, dec.Decode(&got))
+
+	lines := strings.Split(strings.TrimSuffix(stderr.String(), "\n"), "\n")
+	assert.Contains(t, lines, "[stub/nginx:latest] log 499")
+	assert.Contains(t, lines, "[stub/nginx:latest] warn 499")
+	assert.Contains(t, lines, "[stub/nginx:latest] bye")
+	assert.True(t, strings.HasPrefix(lines[len(lines)-1], summary.Prefix), lines[len(lines)-1])
+}
@@ -0,0 +1,128 @@
+package reporter
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// PlatformImage is image scanned for a platform of reference
+type PlatformImage struct {
+	Reference string `json:"reference"`
+	Platform  string `json:"platform"`
+	ImageID   string `json:"image_id"`
+}
+
+// Platform returns platform of image as "os/architecture", empty if
+// either is unknown
+func (i Image) Platform() string {
+	if i.OS == "" || i.Architecture == "" {
+		return ""
+	}
+	return i.OS + "/" + i.Architecture
+}
+
+// platformImages returns images recorded with known platform, sorted by
+// reference and platform
+func platformImages(images map[string]Image) []PlatformImage {
+	result := []PlatformImage{}
+	for _, img := range images {
+		if img.Platform() == "" {
+			continue
+		}
+		result = append(result, PlatformImage{
+			Reference: img.Name(),
+			Platform:  img.Platform(),
+			ImageID:   img.ID,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Reference != result[j].Reference {
+			return result[i].Reference < result[j].Reference
+		}
+		return result[i].Platform < result[j].Platform
+	})
+	return result
+}
+
+// eventPlatforms returns reference and platforms of event, platforms of
+// event grouped before are kept
+func eventPlatforms(evt Event) (string, []string) {
+	if evt.Image == nil {
+		return "", nil
+	}
+	if len(evt.Platforms) > 0 {
+		return evt.Image.Name(), evt.Platforms
+	}
+	if p := evt.Image.Platform(); p != "" {
+		return evt.Image.Name(), []string{p}
+	}
+	return "", nil
+}
+
+// GroupPlatforms groups events of references scanned for more than one
+// platform, events with the same alert and details on different
+// platforms of a reference are reported once with their platforms.
+// Grouped events of findings missing on some platforms of reference are
+// marked platform specific. Events of other references are kept as is
+func GroupPlatforms(doc Report) Report {
+	scanned := map[string]map[string]struct{}{}
+	addPlatform := func(ref string, platform string) {
+		if scanned[ref] == nil {
+			scanned[ref] = map[string]struct{}{}
+		}
+		scanned[ref][platform] = struct{}{}
+	}
+	for _, p := range doc.Metadata.Platforms {
+		addPlatform(p.Reference, p.Platform)
+	}
+	for _, evt := range doc.Events {
+		ref, platforms := eventPlatforms(evt)
+		for _, p := range platforms {
+			addPlatform(ref, p)
+		}
+	}
+
+	events := []Event{}
+	groups := map[string]int{}
+	for _, evt := range doc.Events {
+		ref, platforms := eventPlatforms(evt)
+		if len(scanned[ref]) < 2 {
+			events = append(events, evt)
+			continue
+		}
+
+		key := groupKey(ref, evt)
+		i, ok := groups[key]
+		if !ok {
+			i = len(events)
+			groups[key] = i
+			evt.Platforms = nil
+			events = append(events, evt)
+		}
+		events[i].Platforms = mergePlatforms(events[i].Platforms, platforms)
+		events[i].PlatformSpecific = len(events[i].Platforms) < len(scanned[ref])
+	}
+
+	doc.Events = events
+	return doc
+}
+
+// groupKey identifies finding of event regardless of platform of image
+func groupKey(ref string, evt Event) string {
+	details, _ := json.Marshal(struct {
+		Reference    string      `json:"reference"`
+		DetectType   interface{} `json:"detect_type"`
+		EventType    interface{} `json:"event_type"`
+		AlertType    interface{} `json:"alert_type"`
+		AlertDetails interface{} `json:"alert_details"`
+	}{ref, evt.DetectType, evt.EventType, evt.AlertType, evt.AlertDetails})
+	return string(details)
+}
+
+func mergePlatforms(platforms []string, more []string) []string {
+	set := map[string]struct{}{}
+	for _, p := range append(append([]string{}, platforms...), more...) {
+		set[p] = struct{}{}
+	}
+	return sortedKeys(set)
+}
@@ -0,0 +1,116 @@
+package reporter
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func platformEvent(id string, arch string, path string) Event {
+	return Event{
+		ReportEvent: report.ReportEvent{
+			ID:        id,
+			AlertType: report.Backdoor,
+			AlertDetails: []report.AlertDetail{{BackdoorDetail: &report.BackdoorDetail{
+				FileDetail: report.FileDetail{Path: path},
+			}}},
+		},
+		Image: &Image{
+			ID:           id,
+			Digest:       id,
+			RepoRefs:     []string{"nginx:latest"},
+			OS:           "linux",
+			Architecture: arch,
+		},
+		Fingerprint: id + path,
+	}
+}
+
+func TestGroupPlatforms(t *testing.T) {
+	doc := Report{
+		SchemaVersion: SchemaVersion,
+		Metadata: Metadata{Platforms: []PlatformImage{
+			{Reference: "nginx:latest", Platform: "linux/amd64", ImageID: "sha256:aa"},
+			{Reference: "nginx:latest", Platform: "linux/arm64", ImageID: "sha256:bb"},
+		}},
+		Events: []Event{
+			platformEvent("sha256:aa", "amd64", "/etc/shared"),
+			platformEvent("sha256:aa", "amd64", "/etc/amd64"),
+			platformEvent("sha256:bb", "arm64", "/etc/shared"),
+			platformEvent("sha256:bb", "arm64", "/etc/arm64"),
+			{ReportEvent: report.ReportEvent{ID: "sha256:cc"}, Fingerprint: "other"},
+		},
+	}
+
+	grouped := GroupPlatforms(doc)
+	assert.Len(t, grouped.Events, 4)
+
+	shared := grouped.Events[0]
+	assert.Equal(t, []string{"linux/amd64", "linux/arm64"}, shared.Platforms)
+	assert.False(t, shared.PlatformSpecific)
+	assert.Equal(t, "sha256:aa/etc/shared", shared.Fingerprint)
+
+	assert.Equal(t, []string{"linux/amd64"}, grouped.Events[1].Platforms)
+	assert.True(t, grouped.Events[1].PlatformSpecific)
+	assert.Equal(t, []string{"linux/arm64"}, grouped.Events[2].Platforms)
+	assert.True(t, grouped.Events[2].PlatformSpecific)
+	assert.Nil(t, grouped.Events[3].Platforms)
+
+	// Grouping is idempotent
+	assert.Equal(t, grouped.Events, GroupPlatforms(grouped).Events)
+	assert.Len(t, doc.Events, 5)
+
+	assert.Equal(t, "sha256:aa (nginx:latest) [linux/amd64 only]", displayImage(grouped.Events[1]))
+}
+
+func TestGroupPlatformsSinglePlatform(t *testing.T) {
+	doc := Report{Events: []Event{
+		platformEvent("sha256:aa", "amd64", "/etc/a"),
+		platformEvent("sha256:aa", "amd64", "/etc/b"),
+	}}
+	assert.Equal(t, doc.Events, GroupPlatforms(doc).Events)
+}
+
+func TestMergePlatforms(t *testing.T) {
+	a := &Report{
+		SchemaVersion: SchemaVersion,
+		Metadata: Metadata{Platforms: []PlatformImage{
+			{Reference: "nginx:latest", Platform: "linux/amd64", ImageID: "sha256:aa"},
+		}},
+		Events: []Event{platformEvent("sha256:aa", "amd64", "/etc/shared")},
+	}
+	b := &Report{
+		SchemaVersion: SchemaVersion,
+		Metadata: Metadata{Platforms: []PlatformImage{
+			{Reference: "nginx:latest", Platform: "linux/arm64", ImageID: "sha256:bb"},
+		}},
+	}
+
+	merged, err := Merge([]string{"amd64.json", "arm64.json"}, []*Report{a, b})
+	assert.NoError(t, err)
+	assert.Len(t, merged.Events, 1)
+	assert.Equal(t, []string{"linux/amd64"}, merged.Events[0].Platforms)
+	assert.True(t, merged.Events[0].PlatformSpecific)
+}
+
+func TestResetGroupsPlatforms(t *testing.T) {
+	r, err := NewReporter()
+	assert.NoError(t, err)
+	go r.Listen()
+
+	// Long running modes ship documents of Reset, which are grouped as
+	// the ones written at exit
+	for _, evt := range []Event{
+		platformEvent("sha256:aa", "amd64", "/etc/shared"),
+		platformEvent("sha256:bb", "arm64", "/etc/shared"),
+	} {
+		r.SetImage(*evt.Image)
+		r.Send(evt.ReportEvent)
+	}
+	r.StopListen()
+
+	doc := r.Reset()
+	if assert.Len(t, doc.Events, 1) {
+		assert.Equal(t, []string{"linux/amd64", "linux/arm64"}, doc.Events[0].Platforms)
+	}
+}
@@ -0,0 +1,24 @@
+package reporter
+
+import (
+	"fmt"
+	"time"
+)
+
+// Progress marks report flushed while scan is running, reports written
+// once scan completes have none. Flushes is number of partial reports
+// flushed including the report
+type Progress struct {
+	Partial bool          `json:"partial"`
+	Started time.Time     `json:"started"`
+	Flushed time.Time     `json:"flushed"`
+	Elapsed time.Duration `json:"elapsed"`
+	Scanned int           `json:"scanned"`
+	Failed  int           `json:"failed"`
+	Flushes int           `json:"flushes"`
+}
+
+func (p Progress) String() string {
+	return fmt.Sprintf("partial report flushed at %s while scan is running: %d image(s) scanned, %d target(s) failed in %s",
+		p.Flushed.UTC().Format(time.RFC3339), p.Scanned, p.Failed, p.Elapsed.Round(time.Second))
+}
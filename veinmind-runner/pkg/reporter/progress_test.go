@@ -0,0 +1,51 @@
+package reporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	started := time.Date(2022, 4, 15, 5, 0, 0, 0, time.UTC)
+	p := &Progress{
+		Partial: true,
+		Started: started,
+		Flushed: started.Add(90 * time.Minute),
+		Elapsed: 90*time.Minute + 400*time.Millisecond,
+		Scanned: 12,
+		Failed:  1,
+		Flushes: 3,
+	}
+	line := "partial report flushed at 2022-04-15T06:30:00Z while scan is running: 12 image(s) scanned, 1 target(s) failed in 1h30m0s"
+	assert.Equal(t, line, p.String())
+
+	doc := Report{SchemaVersion: SchemaVersion, Metadata: Metadata{Progress: p}, Events: []Event{}}
+	b := &bytes.Buffer{}
+	require.NoError(t, WriteTable(b, doc))
+	assert.Equal(t, "IMAGE  LEVEL  ALERT  DETAIL\n0 event(s)\n"+line+"\n", b.String())
+
+	b.Reset()
+	require.NoError(t, WriteMarkdown(b, doc))
+	assert.Contains(t, b.String(), "> "+line+"\n")
+
+	b.Reset()
+	require.NoError(t, WriteSARIF(b, doc))
+	sarif := sarifLog{}
+	require.NoError(t, json.Unmarshal(b.Bytes(), &sarif))
+	assert.Equal(t, true, sarif.Runs[0].Properties[sarifProgress].(map[string]interface{})["partial"])
+
+	// Final reports carry no progress
+	b.Reset()
+	require.NoError(t, WriteSARIF(b, Report{SchemaVersion: SchemaVersion}))
+	assert.NotContains(t, b.String(), sarifProgress)
+
+	// Merged reports record which sources are partial
+	merged, err := Merge([]string{"partial.json", "final.json"}, []*Report{&doc, {SchemaVersion: SchemaVersion}})
+	require.NoError(t, err)
+	assert.Nil(t, merged.Metadata.Progress)
+	assert.Equal(t, []Source{{Report: "partial.json", Partial: true}, {Report: "final.json"}}, merged.Metadata.Sources)
+}
@@ -2,66 +2,887 @@ package reporter
 
 import (
 	"encoding/json"
+	"fmt"
 	api "github.com/chaitin/libveinmind/go"
 	"github.com/chaitin/libveinmind/go/containerd"
 	"github.com/chaitin/libveinmind/go/docker"
 	"github.com/chaitin/libveinmind/go/plugin/log"
 	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/adaptive"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/buildhistory"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/cibuild"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/hashcache"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/kubelet"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layer"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layercache"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/normalize"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/remediation"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/rootfs"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/scanconfig"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/schedule"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/target"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/throttle"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/walk"
 	"github.com/pkg/errors"
 	"io"
+	"sync"
+	"time"
 )
 
-type reportEvent struct {
+// SchemaVersion is the version of report document, reports written
+// by runner before the document was versioned are a bare array of events
+const SchemaVersion = 1
+
+// Origins of event, whether file of event lives in a base image layer
+// or an app layer
+const (
+	OriginBase = "base"
+	OriginApp  = "app"
+)
+
+type Event struct {
 	report.ReportEvent
-	ImageRefs []string `json:"image_refs"`
+	// Image is the canonical block of image of event
+	Image       *Image   `json:"image,omitempty"`
+	ImageRefs   []string `json:"image_refs"`
+	Fingerprint string   `json:"fingerprint"`
+	Allowlisted bool     `json:"allowlisted,omitempty"`
+	Origin      string   `json:"origin,omitempty"`
+	// Layers is provenance of files of event, the layers which
+	// introduced them and the instructions creating the layers
+	Layers []layer.Provenance `json:"layers,omitempty"`
+	// Runtime is the runtime where image of event is scanned from
+	Runtime string `json:"runtime,omitempty"`
+	// Workloads are containers of pods running image of event
+	Workloads []kubelet.Workload `json:"workloads,omitempty"`
+	// Quarantine is paths of quarantined copies of files of event
+	Quarantine []string `json:"quarantine,omitempty"`
+	// Artifacts is paths of artifacts registered by plugins for files
+	// of event
+	Artifacts []string `json:"artifacts,omitempty"`
+	// ThreatIntel is matches of file hashes of event
+	ThreatIntel []ThreatIntel `json:"threat_intel,omitempty"`
+	// Suppressed marks aggregated event of events over event limit of
+	// plugin, details of event are a sample of them
+	Suppressed *Suppression `json:"suppressed,omitempty"`
+	// Monitor marks event of plugin in monitor mode, which is reported
+	// but never fails the scan
+	Monitor *Monitor `json:"monitor,omitempty"`
+	// Platforms are platforms of reference where finding of event is
+	// reported, it's set when reference is scanned for more than one
+	// platform
+	Platforms []string `json:"platforms,omitempty"`
+	// PlatformSpecific marks finding which isn't reported on all
+	// platforms of reference
+	PlatformSpecific bool `json:"platform_specific,omitempty"`
+	// Encodings are fields of event which are encoded as base64 or
+	// truncated, as they aren't valid UTF-8 or are too large
+	Encodings []FieldEncoding `json:"encodings,omitempty"`
+	// Tenant is the team owning image of event on shared scanners
+	Tenant string `json:"tenant,omitempty"`
+	// Remediation is suggested changes of Dockerfile fixing findings
+	// of event, it's empty if no remediation rule matches
+	Remediation []string `json:"remediation,omitempty"`
+	// Build is the CI build which produced image of event
+	Build *cibuild.Ref `json:"build,omitempty"`
+	// Readable is human-readable timestamps and sizes of event in
+	// timezone of report
+	Readable *Readable `json:"readable,omitempty"`
+}
+
+type ThreatIntel struct {
+	SHA256 string `json:"sha256"`
+	Tag    string `json:"tag,omitempty"`
+	Source string `json:"source"`
+}
+
+// Report is the document written by reporter
+type Report struct {
+	SchemaVersion int `json:"schema_version"`
+	// FingerprintVersion is version of fingerprints of events, reports
+	// before it's recorded have fingerprints of version 1
+	FingerprintVersion int      `json:"fingerprint_version,omitempty"`
+	Metadata           Metadata `json:"metadata"`
+	Events             []Event  `json:"events"`
+}
+
+type Metadata struct {
+	Signatures []SignatureVerification `json:"signatures,omitempty"`
+	BaseImages []BaseImage             `json:"base_images,omitempty"`
+	Coverage   []Coverage              `json:"coverage,omitempty"`
+	HashCache  *hashcache.Stats        `json:"hash_cache,omitempty"`
+	// LayerCache is statistics of events of layer-local plugins
+	// assembled from layers cached
+	LayerCache *layercache.Stats `json:"layer_cache,omitempty"`
+	// FailedTargets are targets which failed to be scanned
+	FailedTargets []target.Failure `json:"failed_targets,omitempty"`
+	// Pulls records whether registry images are pulled or found locally
+	Pulls []Pull `json:"pulls,omitempty"`
+	// EventChannel is statistics of event channel of reporter
+	EventChannel *ChannelStats `json:"event_channel,omitempty"`
+	// Artifacts are artifacts registered by plugins
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+	// Suppressions are plugin executions whose events exceed limit
+	Suppressions []Suppression `json:"suppressions,omitempty"`
+	// Sources are reports merged into the report
+	Sources []Source `json:"sources,omitempty"`
+	// Superseded are failures of reports rescanned, which are replaced
+	// by results of the rescans
+	Superseded []Superseded `json:"superseded,omitempty"`
+	// BuildHistories are Dockerfiles of images reconstructed from
+	// their history
+	BuildHistories []BuildHistory `json:"build_histories,omitempty"`
+	// Platforms are images scanned with their platforms
+	Platforms []PlatformImage `json:"platforms,omitempty"`
+	// Schedule is queue statistics of pools of plugin concurrency
+	// classes
+	Schedule []schedule.Stat `json:"schedule,omitempty"`
+	// Registries is throughput of targets of registry domains scanned
+	// by scan-registry
+	Registries []schedule.DomainStat `json:"registries,omitempty"`
+	// Throttle is time and events of scans throttled while the host
+	// is under load
+	Throttle *throttle.Stats `json:"throttle,omitempty"`
+	// Walks are walks of images shared by plugins using walk service,
+	// with wall time they spared
+	Walks []walk.Stat `json:"walks,omitempty"`
+	// AdaptiveThreads are parallelism of plugins picked for images by
+	// their sizes with --threads adaptive
+	AdaptiveThreads []adaptive.Choice `json:"adaptive_threads,omitempty"`
+	// Trends are comparisons of images against their baselines of
+	// historical runs by trend gate
+	Trends []Trend `json:"trends,omitempty"`
+	// Configuration is effective configuration of the scan, secrets
+	// of it are redacted
+	Configuration *scanconfig.Config `json:"configuration,omitempty"`
+	// Build is the CI build the scan runs in
+	Build *cibuild.Build `json:"build,omitempty"`
+	// Progress marks report flushed while scan is running
+	Progress *Progress `json:"progress,omitempty"`
+}
+
+// BuildHistory is the reconstructed Dockerfile of image, values of
+// secrets in it are redacted
+type BuildHistory struct {
+	ImageID string              `json:"image_id"`
+	Steps   []buildhistory.Step `json:"steps"`
+}
+
+// Artifact records an artifact registered by plugin for event, Path
+// is the file of event within image and Artifact is the stored path
+type Artifact struct {
+	ImageID  string `json:"image_id"`
+	EventID  string `json:"event_id"`
+	Plugin   string `json:"plugin"`
+	Name     string `json:"name"`
+	Path     string `json:"path,omitempty"`
+	Artifact string `json:"artifact"`
+}
+
+// Sources of registry images
+const (
+	SourcePulled = "pulled"
+	SourceCached = "cached"
+)
+
+// Pull records source of image of registry target, images whose digest
+// is present locally are scanned from local cache instead of pulling
+type Pull struct {
+	Ref    string `json:"ref"`
+	Digest string `json:"digest,omitempty"`
+	Source string `json:"source"`
+}
+
+// Scopes of coverage
+const (
+	ScopeLayers    = "layers"
+	ScopeFullImage = "full-image"
+	ScopeFailed    = "failed"
+	ScopeSkipped   = "skipped"
+	// ScopeIncompatible marks plugins skipped for all images
+	ScopeIncompatible = "incompatible"
+	// ScopeServerMismatch marks references whose registry differs
+	// from the server scanned
+	ScopeServerMismatch = "server-mismatch"
+	// ScopeOverrun marks plugins which ran over their slice of image
+	// time budget
+	ScopeOverrun = "budget-overrun"
+	// ScopeCrashed marks plugin executions exiting abnormally
+	ScopeCrashed = "crashed"
+	// ScopeSoftFailed marks failed executions of soft-fail plugins,
+	// which never fail the scan
+	ScopeSoftFailed = "soft-failed"
+	// ScopeNotReached marks targets left unscanned when the scan
+	// timed out
+	ScopeNotReached = "not-reached"
+	// ScopeRepulled marks images pulled again since their content
+	// disappeared during scan
+	ScopeRepulled = "repulled"
+	// ScopeMaterialized marks images whose rootfs is materialized for
+	// plugins, with time and disk spent
+	ScopeMaterialized = "materialized"
+)
+
+// Coverage records the layers scanned by a plugin execution, plugins
+// which can't honor the layer scope are marked as full-image. Images
+// which failed to be opened or verified are marked as failed with
+// the categorized reason, plugins skipped for an image are marked as
+// skipped with the source of skip as reason, and images left out of
+// interactive selection are marked as skipped without plugin. Plugins
+// with incompatible API version are marked as incompatible without
+// image, references whose registry differs from the server are marked
+// as server-mismatch with the decision as reason, plugin executions
+// exceeding their time budget are marked as budget-overrun, plugin
+// executions exiting abnormally are marked as crashed with their
+// diagnostics, and failures of soft-fail plugins of either kind are
+// marked as soft-failed. Targets left when the scan timed out are
+// marked as not-reached
+type Coverage struct {
+	ImageID string   `json:"image_id"`
+	Ref     string   `json:"ref,omitempty"`
+	Plugin  string   `json:"plugin,omitempty"`
+	Scope   string   `json:"scope"`
+	Layers  []string `json:"layers,omitempty"`
+	Reason  string   `json:"reason,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	// Code classifies failure of entry for automation
+	Code errcode.Code `json:"code,omitempty"`
+	// Diagnostics is the diagnostics bundle of crashed execution
+	Diagnostics string `json:"diagnostics,omitempty"`
+	// Target is the scan target of image, which is rescanned if the
+	// image failed
+	Target *Target `json:"target,omitempty"`
+	// Tenant is the team owning the image on shared scanners
+	Tenant string `json:"tenant,omitempty"`
+	// Rootfs is rootfs of image materialized for plugins
+	Rootfs *rootfs.Stat `json:"rootfs,omitempty"`
+}
+
+// BaseImage is the detected base image of a scanned image
+type BaseImage struct {
+	ImageID string `json:"image_id"`
+	Ref     string `json:"ref"`
+	Layers  int    `json:"layers"`
+}
+
+// SignatureVerification is the result of verifying an image signature
+// before pulling, results of different schemes are comparable
+type SignatureVerification struct {
+	Scheme    string `json:"scheme"`
+	Reference string `json:"reference"`
+	Digest    string `json:"digest,omitempty"`
+	Verified  bool   `json:"verified"`
+	Error     string `json:"error,omitempty"`
+	Signer    string `json:"signer,omitempty"`
+	Issuer    string `json:"issuer,omitempty"`
+	// Role is the notary role signing the tag
+	Role        string           `json:"role,omitempty"`
+	Certificate *CertificateInfo `json:"certificate,omitempty"`
+}
+
+type CertificateInfo struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
 }
 
 type Reporter struct {
+	// EventChannel receives events, Send should be used to honor the
+	// overflow policy of reporter
 	EventChannel chan report.ReportEvent
+	channel      *eventChannel
+	workers      int
+	normalizer   *normalize.Normalizer
+	remediation  *remediation.Suggester
+	location     *time.Location
 	closeCh      chan struct{}
-	events       []reportEvent
+	listenOnce   sync.Once
+	stopOnce     sync.Once
+	events       []Event
+	metadata     Metadata
+	allowlisted  map[string]struct{}
+	runtimes     map[string]string
+	workloads    map[string][]kubelet.Workload
+	images       map[string]Image
+	targets      map[string]Target
+	bases        map[string]baseLocator
+	indexes      map[string]*layer.Index
+	quarantined  map[fileKey]string
+	artifacts    map[fileKey][]string
+	mu           sync.Mutex
+}
+
+type fileKey struct {
+	imageID string
+	path    string
+}
+
+type baseLocator struct {
+	layers int
+	locate layer.Locator
+}
+
+type options struct {
+	capacity    int
+	overflow    string
+	spillDir    string
+	workers     int
+	normalizer  *normalize.Normalizer
+	remediation *remediation.Suggester
+	location    *time.Location
 }
 
-func NewReporter() (*Reporter, error) {
+type Option func(o *options)
+
+// WithCapacity sets capacity of event channel
+func WithCapacity(capacity int) Option {
+	return func(o *options) {
+		o.capacity = capacity
+	}
+}
+
+// WithOverflow sets policy when event channel is full, spilled events
+// are written to a temporary file under spillDir
+func WithOverflow(policy string, spillDir string) Option {
+	return func(o *options) {
+		o.overflow = policy
+		o.spillDir = spillDir
+	}
+}
+
+// WithListenWorkers sets number of goroutines of Listen converting
+// events, events are appended in order only with a single worker
+func WithListenWorkers(workers int) Option {
+	return func(o *options) {
+		o.workers = workers
+	}
+}
+
+// WithNormalizer sets normalizer of levels reported by plugins
+func WithNormalizer(n *normalize.Normalizer) Option {
+	return func(o *options) {
+		o.normalizer = n
+	}
+}
+
+// WithRemediation sets suggester of remediation of events
+func WithRemediation(s *remediation.Suggester) Option {
+	return func(o *options) {
+		o.remediation = s
+	}
+}
+
+// WithTimezone sets timezone of human-readable timestamps of events,
+// UTC by default
+func WithTimezone(loc *time.Location) Option {
+	return func(o *options) {
+		o.location = loc
+	}
+}
+
+func NewReporter(opts ...Option) (*Reporter, error) {
+	o := &options{
+		capacity: DefaultCapacity,
+		overflow: OverflowBlock,
+		workers:  1,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	channel, err := newEventChannel(o.capacity, o.overflow, o.spillDir)
+	if err != nil {
+		return nil, err
+	}
+	if o.workers <= 0 {
+		return nil, errors.Errorf("invalid number of listen workers: %d", o.workers)
+	}
+
 	return &Reporter{
-		EventChannel: make(chan report.ReportEvent, 1<<8),
+		EventChannel: channel.ch,
+		channel:      channel,
+		workers:      o.workers,
+		normalizer:   o.normalizer,
+		remediation:  o.remediation,
+		location:     o.location,
 		closeCh:      make(chan struct{}),
-		events:       []reportEvent{},
+		events:       []Event{},
+		allowlisted:  map[string]struct{}{},
+		runtimes:     map[string]string{},
+		workloads:    map[string][]kubelet.Workload{},
+		images:       map[string]Image{},
+		targets:      map[string]Target{},
+		bases:        map[string]baseLocator{},
+		indexes:      map[string]*layer.Index{},
+		quarantined:  map[fileKey]string{},
+		artifacts:    map[fileKey][]string{},
 	}, nil
 }
 
+// MarkAllowlisted marks events of image id as allowlisted
+func (r *Reporter) MarkAllowlisted(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.allowlisted[id] = struct{}{}
+}
+
+// SetRuntime records runtime which image id is scanned from, events
+// of the image are tagged with it
+func (r *Reporter) SetRuntime(id string, runtime string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runtimes[id] = runtime
+}
+
+// SetWorkloads records containers of pods running image id, events of
+// the image are annotated with them
+func (r *Reporter) SetWorkloads(id string, workloads []kubelet.Workload) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.workloads[id] = workloads
+}
+
+func (r *Reporter) imageWorkloads(id string) []kubelet.Workload {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.workloads[id]
+}
+
+func (r *Reporter) runtime(id string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.runtimes[id]
+}
+
+// Normalize returns event reported by plugin with level normalized,
+// value is level as reported by plugin. Events are returned as they
+// are without normalizer
+func (r *Reporter) Normalize(plugin string, value string, evt report.ReportEvent) report.ReportEvent {
+	if r.normalizer == nil {
+		return evt
+	}
+	evt.Level = r.normalizer.Normalize(plugin, value, evt)
+	return evt
+}
+
+// SetImage records canonical block of image, events of the image are
+// enriched with it
+func (r *Reporter) SetImage(img Image) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.images[img.ID] = img
+}
+
+// Image returns canonical block of image id, nil if it isn't recorded
+func (r *Reporter) Image(id string) *Image {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	img, ok := r.images[id]
+	if !ok {
+		return nil
+	}
+	return &img
+}
+
+// AddSignature records signature verification result in metadata
+func (r *Reporter) AddSignature(v SignatureVerification) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.Signatures = append(r.metadata.Signatures, v)
+}
+
+// SetHashCacheStats records statistics of hash cache shared by plugins
+func (r *Reporter) SetHashCacheStats(stats hashcache.Stats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.HashCache = &stats
+}
+
+// SetLayerCacheStats records statistics of layer cache of plugins
+func (r *Reporter) SetLayerCacheStats(stats layercache.Stats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.LayerCache = &stats
+}
+
+// SetThrottleStats records statistics of scans throttled under load
+func (r *Reporter) SetThrottleStats(stats throttle.Stats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.Throttle = &stats
+}
+
+// SetScheduleStats records queue statistics of pools of plugin
+// concurrency classes
+func (r *Reporter) SetScheduleStats(stats []schedule.Stat) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.Schedule = stats
+}
+
+// SetRegistryStats records throughput of targets of registry domains
+func (r *Reporter) SetRegistryStats(stats []schedule.DomainStat) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.Registries = stats
+}
+
+// SetConfiguration records effective configuration of the scan
+func (r *Reporter) SetConfiguration(c scanconfig.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.Configuration = &c
+}
+
+// SetBuild records CI build the scan runs in
+func (r *Reporter) SetBuild(b cibuild.Build) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.Build = &b
+}
+
+// SetFailedTargets records targets which failed to be scanned
+func (r *Reporter) SetFailedTargets(failures []target.Failure) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.FailedTargets = failures
+}
+
+// AddPull records source of image of registry target
+func (r *Reporter) AddPull(p Pull) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.Pulls = append(r.metadata.Pulls, p)
+}
+
+// AddCoverage records layers scanned by a plugin execution
+func (r *Reporter) AddCoverage(c Coverage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.targets[c.ImageID]; ok && c.Target == nil {
+		c.Target = &t
+	}
+	r.metadata.Coverage = append(r.metadata.Coverage, c)
+}
+
+// AddQuarantine records quarantined artifact of file of image, events
+// reported afterwards for the file point at the artifact
+func (r *Reporter) AddQuarantine(imageID string, path string, artifact string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.quarantined[fileKey{imageID, path}] = artifact
+}
+
+func (r *Reporter) quarantine(event report.ReportEvent) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	artifacts := []string{}
+	for _, p := range Paths(event.AlertDetails) {
+		if a, ok := r.quarantined[fileKey{event.ID, p}]; ok {
+			artifacts = append(artifacts, a)
+		}
+	}
+
+	if len(artifacts) == 0 {
+		return nil
+	}
+	return artifacts
+}
+
+// AddArtifact records artifact registered by plugin, events reported
+// afterwards for the file of artifact point at it
+func (r *Reporter) AddArtifact(a Artifact) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.Artifacts = append(r.metadata.Artifacts, a)
+	if a.Path != "" {
+		key := fileKey{a.ImageID, a.Path}
+		r.artifacts[key] = append(r.artifacts[key], a.Artifact)
+	}
+}
+
+func (r *Reporter) eventArtifacts(event report.ReportEvent) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	artifacts := []string{}
+	for _, p := range Paths(event.AlertDetails) {
+		artifacts = append(artifacts, r.artifacts[fileKey{event.ID, p}]...)
+	}
+
+	if len(artifacts) == 0 {
+		return nil
+	}
+	return artifacts
+}
+
+// AddWalk records walk of image shared by plugins
+func (r *Reporter) AddWalk(s walk.Stat) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.Walks = append(r.metadata.Walks, s)
+}
+
+// AddAdaptiveThreads records parallelism of plugins picked for image
+func (r *Reporter) AddAdaptiveThreads(c adaptive.Choice) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.AdaptiveThreads = append(r.metadata.AdaptiveThreads, c)
+}
+
+// AddBuildHistory records reconstructed build history of image
+func (r *Reporter) AddBuildHistory(h BuildHistory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.BuildHistories = append(r.metadata.BuildHistories, h)
+}
+
+// SetBaseImage records base image of image, events of the image are
+// annotated with origin by locating their files in layers
+func (r *Reporter) SetBaseImage(base BaseImage, locate layer.Locator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.BaseImages = append(r.metadata.BaseImages, base)
+	if locate != nil {
+		r.bases[base.ImageID] = baseLocator{layers: base.Layers, locate: locate}
+	}
+}
+
+// SetLayerIndex records layer index of image, events of the image are
+// annotated with provenance of their files
+func (r *Reporter) SetLayerIndex(imageID string, index *layer.Index) {
+	if index == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.indexes[imageID] = index
+}
+
+// provenance returns layers introducing files of event
+func (r *Reporter) provenance(event report.ReportEvent) []layer.Provenance {
+	r.mu.Lock()
+	index, ok := r.indexes[event.ID]
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	var layers []layer.Provenance
+	for _, p := range Paths(event.AlertDetails) {
+		if prov, ok := index.Lookup(p); ok {
+			layers = append(layers, prov)
+		}
+	}
+	return layers
+}
+
+// eventLayer returns provenance of path of event
+func eventLayer(evt Event, path string) (layer.Provenance, bool) {
+	for _, l := range evt.Layers {
+		if l.Path == path {
+			return l, true
+		}
+	}
+	return layer.Provenance{}, false
+}
+
+// introducedBy describes the layer introducing a file for readers
+func introducedBy(l layer.Provenance) string {
+	if l.CreatedBy == "" {
+		return fmt.Sprintf("introduced by layer %d (%s)", l.Index, l.Digest)
+	}
+	return fmt.Sprintf("introduced by layer %d: %s", l.Index, l.CreatedBy)
+}
+
+// origin returns origin of event, empty string is returned when no
+// file of event is located
+func (r *Reporter) origin(event report.ReportEvent) string {
+	r.mu.Lock()
+	base, ok := r.bases[event.ID]
+	r.mu.Unlock()
+	if !ok {
+		return ""
+	}
+
+	origin := ""
+	for _, p := range Paths(event.AlertDetails) {
+		l, ok := base.locate(p)
+		if !ok {
+			continue
+		}
+
+		if l.Index >= base.layers {
+			return OriginApp
+		}
+		origin = OriginBase
+	}
+
+	return origin
+}
+
+// Send sends event to reporter, it blocks, drops the oldest event or
+// spills events to disk when channel is full following overflow policy
+func (r *Reporter) Send(evt report.ReportEvent) {
+	r.channel.send(evt)
+}
+
+// ChannelStats returns statistics of event channel
+func (r *Reporter) ChannelStats() ChannelStats {
+	return r.channel.stats()
+}
+
+// merge merges events spilled to disk, it's called before events are
+// read so that no event is lost
+func (r *Reporter) merge() {
+	spilled, err := r.channel.drain()
+	if err != nil {
+		log.Error(err)
+	}
+
+	for _, evt := range spilled {
+		r.add(evt)
+	}
+}
+
+// add converts event and appends it to events
+func (r *Reporter) add(evt report.ReportEvent) {
+	evtN, err := r.convert(evt)
+	if err != nil {
+		log.Error(err)
+	}
+	evtN.Readable = NewReadable(evtN, r.location)
+	r.mu.Lock()
+	r.events = append(r.events, evtN)
+	r.mu.Unlock()
+}
+
+// metadataLocked returns metadata with statistics of event channel,
+// r.mu must be held
+func (r *Reporter) metadataLocked() Metadata {
+	metadata := r.metadata
+	stats := r.channel.stats()
+	metadata.EventChannel = &stats
+	metadata.Platforms = platformImages(r.images)
+	return metadata
+}
+
+// Listen converts events of channel with workers until StopListen,
+// only the first call listens and later calls return after it stops
 func (r *Reporter) Listen() {
+	r.listenOnce.Do(func() {
+		wg := sync.WaitGroup{}
+		for i := 0; i < r.workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.listen()
+			}()
+		}
+		wg.Wait()
+		log.Info("Stop reporter listen")
+	})
+}
+
+func (r *Reporter) listen() {
 	for {
 		select {
 		case evt := <-r.EventChannel:
-			evtN, err := r.convert(evt)
-			if err != nil {
-				log.Error(err)
-			}
-			r.events = append(r.events, evtN)
+			r.add(evt)
 		case <-r.closeCh:
-			goto END
+			// Events sent before stop are kept
+			for {
+				select {
+				case evt := <-r.EventChannel:
+					r.add(evt)
+				default:
+					return
+				}
+			}
 		}
 	}
-END:
-	log.Info("Stop reporter listen")
 }
 
+// StopListen stops Listen and returns after events in channel are
+// drained, events are drained by StopListen itself if Listen hasn't
+// started yet. It can be called more than once
 func (r *Reporter) StopListen() {
-	r.closeCh <- struct{}{}
+	r.stopOnce.Do(func() {
+		close(r.closeCh)
+	})
+	r.Listen()
 }
 
-func (r *Reporter) Write(writer io.Writer) error {
-	if len(r.events) == 0 {
-		return nil
+// Update modifies events in place, e.g. enrichment after scan
+func (r *Reporter) Update(fn func(events []Event)) {
+	r.merge()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(r.events)
+}
+
+// Reset returns the report document of current events and clears
+// events and metadata, it's used by long running modes between runs
+func (r *Reporter) Reset() Report {
+	r.merge()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	doc := Report{
+		SchemaVersion:      SchemaVersion,
+		FingerprintVersion: report.FingerprintVersion,
+		Metadata:           r.metadataLocked(),
+		Events:             r.events,
 	}
+	r.events = []Event{}
+	// Configuration and build are the same for all runs of the process
+	r.metadata = Metadata{Configuration: r.metadata.Configuration, Build: r.metadata.Build}
+	r.channel.reset()
+	r.allowlisted = map[string]struct{}{}
+	r.runtimes = map[string]string{}
+	r.workloads = map[string][]kubelet.Workload{}
+	r.images = map[string]Image{}
+	r.targets = map[string]Target{}
+	r.bases = map[string]baseLocator{}
+	r.indexes = map[string]*layer.Index{}
+	r.quarantined = map[fileKey]string{}
+	r.artifacts = map[fileKey][]string{}
+	return GroupPlatforms(doc)
+}
+
+// Snapshot returns the report document of current events
+func (r *Reporter) Snapshot() Report {
+	r.merge()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := make([]Event, len(r.events))
+	copy(events, r.events)
+	return GroupPlatforms(Report{
+		SchemaVersion:      SchemaVersion,
+		FingerprintVersion: report.FingerprintVersion,
+		Metadata:           r.metadataLocked(),
+		Events:             events,
+	})
+}
 
-	eventsBytes, err := json.MarshalIndent(r.events, "", "  ")
+func (r *Reporter) Write(writer io.Writer) error {
+	return WriteJSON(writer, r.Snapshot())
+}
+
+// WriteJSON writes report document as indented json
+func WriteJSON(writer io.Writer, doc Report) error {
+	reportBytes, err := json.MarshalIndent(doc, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	_, err = writer.Write(eventsBytes)
+	_, err = writer.Write(reportBytes)
 	if err != nil {
 		return err
 	}
@@ -70,16 +891,34 @@ func (r *Reporter) Write(writer io.Writer) error {
 	return err
 }
 
-func (r *Reporter) GetEvents() ([]reportEvent, error) {
-	return r.events, nil
+// Events returns a copy of events reported so far, it's safe to call
+// during an active scan while events are still being reported
+func (r *Reporter) Events() []Event {
+	r.merge()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := make([]Event, len(r.events))
+	copy(events, r.events)
+	return events
+}
+
+// GetEvents returns a copy of events reported so far
+//
+// Deprecated: use Events instead
+func (r *Reporter) GetEvents() ([]Event, error) {
+	return r.Events(), nil
 }
 
-func (r *Reporter) convert(event report.ReportEvent) (reportEvent, error) {
+func (r *Reporter) convert(event report.ReportEvent) (Event, error) {
+	// Raw bytes of plugins break json of report
+	event, encodings := sanitizeEvent(event)
+	evt := r.newEvent(event, encodings)
+
 	dr, _ := docker.New()
 	cr, _ := containerd.New()
 	runtimes := []api.Runtime{dr, cr}
 	var image api.Image
-	find := false
 	for _, runtime := range runtimes {
 		if runtime != nil {
 			i, err := runtime.OpenImageByID(event.ID)
@@ -87,28 +926,49 @@ func (r *Reporter) convert(event report.ReportEvent) (reportEvent, error) {
 				continue
 			}
 			image = i
-			find = true
 			break
 		}
 	}
-	if !find || image == nil {
-		return reportEvent{}, errors.New("Can't get image object")
+	if image == nil {
+		// Keep event whose image is gone, e.g. events generated by runner
+		// or image removed after registry scan
+		if evt.Image != nil && len(evt.Image.RepoRefs) > 0 {
+			evt.ImageRefs = evt.Image.RepoRefs
+		}
+		return evt, errors.New("Can't get image object")
 	}
+	defer image.Close()
 
 	refs, err := image.RepoRefs()
 	if err != nil {
-		refs = []string{}
 		log.Error(err)
+	} else {
+		evt.ImageRefs = refs
 	}
 
-	//oci, err := image.OCISpecV1()
-	//if err != nil {
-	//	oci = nil
-	//	log.Error(err)
-	//}
+	return evt, nil
+}
+
+// newEvent returns event annotated with what reporter records of its
+// image, which is kept after the image is removed
+func (r *Reporter) newEvent(event report.ReportEvent, encodings []FieldEncoding) Event {
+	r.mu.Lock()
+	_, allowlisted := r.allowlisted[event.ID]
+	r.mu.Unlock()
 
-	return reportEvent{
-		ImageRefs:   refs,
+	return Event{
+		Image:       r.Image(event.ID),
+		ImageRefs:   []string{},
 		ReportEvent: event,
-	}, nil
+		Fingerprint: Fingerprint(event),
+		Allowlisted: allowlisted,
+		Origin:      r.origin(event),
+		Layers:      r.provenance(event),
+		Runtime:     r.runtime(event.ID),
+		Workloads:   r.imageWorkloads(event.ID),
+		Quarantine:  r.quarantine(event),
+		Artifacts:   r.eventArtifacts(event),
+		Encodings:   encodings,
+		Remediation: r.remediation.Suggest(event),
+	}
 }
@@ -0,0 +1,119 @@
+package reporter
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/target"
+)
+
+// Sources of scan targets
+const (
+	TargetHost     = "host"
+	TargetRegistry = "registry"
+)
+
+// Target is where image is scanned from, Ref is the image ID of host
+// targets and the reference of registry targets
+type Target struct {
+	Source  string `json:"source"`
+	Runtime string `json:"runtime"`
+	Ref     string `json:"ref"`
+}
+
+// Superseded records failures of rescanned report replaced by the
+// rescan
+type Superseded struct {
+	Report        string           `json:"report"`
+	FailedTargets []target.Failure `json:"failed_targets,omitempty"`
+	Coverage      []Coverage       `json:"coverage,omitempty"`
+}
+
+// SetTarget records scan target of image id, coverage of the image
+// added afterwards carries it
+func (r *Reporter) SetTarget(id string, t Target) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.targets[id] = t
+}
+
+// failedScopes are scopes of coverage whose image is rescanned
+var failedScopes = map[string]struct{}{
+	ScopeFailed:  {},
+	ScopeCrashed: {},
+	ScopeOverrun: {},
+}
+
+// FailedTargets returns targets of doc which failed to be scanned, pull
+// and plugin failures and plugins running out of time included. Images
+// failing to be removed are scanned and aren't returned, neither are
+// entries without source of target, which are written by older runners
+func FailedTargets(doc Report) []Target {
+	targets := []Target{}
+	seen := map[Target]struct{}{}
+	add := func(t Target) {
+		if _, ok := seen[t]; !ok {
+			seen[t] = struct{}{}
+			targets = append(targets, t)
+		}
+	}
+
+	for _, f := range doc.Metadata.FailedTargets {
+		if t, ok := failureTarget(f); ok {
+			add(t)
+		}
+	}
+	for _, c := range doc.Metadata.Coverage {
+		if t, ok := coverageTarget(c); ok {
+			add(t)
+		}
+	}
+	return targets
+}
+
+func failureTarget(f target.Failure) (Target, bool) {
+	if f.Stage == target.StageRemove || f.Source == "" {
+		return Target{}, false
+	}
+	return Target{Source: f.Source, Runtime: f.Runtime, Ref: f.Target}, true
+}
+
+func coverageTarget(c Coverage) (Target, bool) {
+	if _, ok := failedScopes[c.Scope]; !ok || c.Target == nil {
+		return Target{}, false
+	}
+	return *c.Target, true
+}
+
+// Supersede returns doc of report with failures of targets moved into
+// superseded metadata, results of rescanning targets replace them
+func Supersede(report string, doc Report, targets []Target) Report {
+	rescanned := map[Target]struct{}{}
+	for _, t := range targets {
+		rescanned[t] = struct{}{}
+	}
+
+	superseded := Superseded{Report: report}
+	failures := []target.Failure{}
+	for _, f := range doc.Metadata.FailedTargets {
+		if t, ok := failureTarget(f); ok {
+			if _, ok := rescanned[t]; ok {
+				superseded.FailedTargets = append(superseded.FailedTargets, f)
+				continue
+			}
+		}
+		failures = append(failures, f)
+	}
+	coverage := []Coverage{}
+	for _, c := range doc.Metadata.Coverage {
+		if t, ok := coverageTarget(c); ok {
+			if _, ok := rescanned[t]; ok {
+				superseded.Coverage = append(superseded.Coverage, c)
+				continue
+			}
+		}
+		coverage = append(coverage, c)
+	}
+
+	doc.Metadata.FailedTargets = failures
+	doc.Metadata.Coverage = coverage
+	doc.Metadata.Superseded = append(doc.Metadata.Superseded, superseded)
+	return doc
+}
@@ -0,0 +1,63 @@
+package reporter
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/target"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCoverageTarget(t *testing.T) {
+	r, err := NewReporter()
+	assert.NoError(t, err)
+
+	r.SetTarget("sha256:aa", Target{Source: TargetRegistry, Runtime: "docker", Ref: "nginx:latest"})
+	r.AddCoverage(Coverage{ImageID: "sha256:aa", Plugin: "veinmind-weakpass", Scope: ScopeCrashed})
+	r.AddCoverage(Coverage{ImageID: "sha256:bb", Scope: ScopeFailed})
+
+	coverage := r.Snapshot().Metadata.Coverage
+	assert.Equal(t, &Target{Source: TargetRegistry, Runtime: "docker", Ref: "nginx:latest"}, coverage[0].Target)
+	assert.Nil(t, coverage[1].Target)
+
+	// Targets of the previous run of long running modes aren't carried
+	// by coverage of later runs
+	r.Reset()
+	r.AddCoverage(Coverage{ImageID: "sha256:aa", Scope: ScopeFailed})
+	assert.Nil(t, r.Snapshot().Metadata.Coverage[0].Target)
+	assert.Empty(t, r.targets)
+}
+
+func TestFailedTargets(t *testing.T) {
+	host := Target{Source: TargetHost, Runtime: "containerd", Ref: "sha256:bb"}
+	doc := Report{
+		SchemaVersion: SchemaVersion,
+		Metadata: Metadata{
+			FailedTargets: []target.Failure{
+				{Target: "nginx:latest", Stage: target.StagePull, Source: TargetRegistry, Runtime: "docker"},
+				{Target: "redis:latest", Stage: target.StageRemove, Source: TargetRegistry, Runtime: "docker"},
+				{Target: "mysql:latest", Stage: target.StagePull},
+			},
+			Coverage: []Coverage{
+				{ImageID: "sha256:bb", Scope: ScopeFailed, Target: &host},
+				{ImageID: "sha256:bb", Plugin: "veinmind-weakpass", Scope: ScopeOverrun, Target: &host},
+				{ImageID: "sha256:cc", Plugin: "veinmind-weakpass", Scope: ScopeFullImage, Target: &Target{Source: TargetHost, Runtime: "docker", Ref: "sha256:cc"}},
+				{ImageID: "sha256:dd", Scope: ScopeFailed},
+			},
+		},
+		Events: []Event{},
+	}
+
+	targets := FailedTargets(doc)
+	assert.Equal(t, []Target{
+		{Source: TargetRegistry, Runtime: "docker", Ref: "nginx:latest"},
+		host,
+	}, targets)
+
+	superseded := Supersede("report.json", doc, targets)
+	assert.Equal(t, []target.Failure{doc.Metadata.FailedTargets[1], doc.Metadata.FailedTargets[2]}, superseded.Metadata.FailedTargets)
+	assert.Equal(t, []Coverage{doc.Metadata.Coverage[2], doc.Metadata.Coverage[3]}, superseded.Metadata.Coverage)
+	assert.Equal(t, []Superseded{{
+		Report:        "report.json",
+		FailedTargets: doc.Metadata.FailedTargets[:1],
+		Coverage:      doc.Metadata.Coverage[:2],
+	}}, superseded.Metadata.Superseded)
+}
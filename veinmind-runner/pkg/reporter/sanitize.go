@@ -0,0 +1,189 @@
+package reporter
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxFieldSize caps bytes of a string field of event, values over it
+// are truncated
+const MaxFieldSize = 64 * 1024
+
+// EncodingBase64 marks field whose value is base64 of raw bytes which
+// aren't valid UTF-8
+const EncodingBase64 = "base64"
+
+// TruncatedMarker ends text truncated to MaxFieldSize, values encoded
+// as base64 are truncated before encoding and carry no marker
+const TruncatedMarker = "...[truncated]"
+
+// FieldEncoding marks a string field of event whose value isn't kept
+// as reported, Field is the path of json names of the field, e.g.
+// alert_details.0.backdoor_detail.path
+type FieldEncoding struct {
+	Field    string `json:"field"`
+	Encoding string `json:"encoding,omitempty"`
+	// Truncated is number of bytes of raw value cut off
+	Truncated int `json:"truncated,omitempty"`
+}
+
+// Decode returns raw bytes of value of field marked by e
+func (e FieldEncoding) Decode(value string) ([]byte, error) {
+	if e.Encoding == EncodingBase64 {
+		return base64.StdEncoding.DecodeString(value)
+	}
+	return []byte(value), nil
+}
+
+// sanitizeEvent returns event whose string fields are valid UTF-8 and
+// fit in MaxFieldSize, fields which aren't are encoded or truncated
+// in a copy of event so that the reported one is left untouched
+func sanitizeEvent(event report.ReportEvent) (report.ReportEvent, []FieldEncoding) {
+	if len(walkStrings(reflect.ValueOf(event), "", false)) == 0 {
+		return event, nil
+	}
+
+	sanitized := copyValue(reflect.ValueOf(event)).Interface().(report.ReportEvent)
+	encodings := walkStrings(reflect.ValueOf(&sanitized).Elem(), "", true)
+	return sanitized, encodings
+}
+
+// walkStrings finds string fields of v which are invalid UTF-8 or too
+// large, they are sanitized in place if fix is set and v is settable
+func walkStrings(v reflect.Value, path string, fix bool) []FieldEncoding {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return walkStrings(v.Elem(), path, fix)
+	case reflect.Slice, reflect.Array:
+		encodings := []FieldEncoding{}
+		for i := 0; i < v.Len(); i++ {
+			encodings = append(encodings, walkStrings(v.Index(i), joinPath(path, strconv.Itoa(i)), fix)...)
+		}
+		return encodings
+	case reflect.Struct:
+		encodings := []FieldEncoding{}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			fieldPath := path
+			if !f.Anonymous || name != "" {
+				if name == "" {
+					name = f.Name
+				}
+				fieldPath = joinPath(path, name)
+			}
+			encodings = append(encodings, walkStrings(v.Field(i), fieldPath, fix)...)
+		}
+		return encodings
+	case reflect.String:
+		value, encoding, ok := sanitizeString(v.String())
+		if ok {
+			return nil
+		}
+		if fix && v.CanSet() {
+			v.SetString(value)
+		}
+		encoding.Field = path
+		return []FieldEncoding{encoding}
+	}
+	return nil
+}
+
+// sanitizeString returns s encoded or truncated, ok is set if s is
+// kept as is
+func sanitizeString(s string) (string, FieldEncoding, bool) {
+	if utf8.ValidString(s) {
+		if len(s) <= MaxFieldSize {
+			return s, FieldEncoding{}, true
+		}
+
+		cut := MaxFieldSize - len(TruncatedMarker)
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		return s[:cut] + TruncatedMarker, FieldEncoding{Truncated: len(s) - cut}, false
+	}
+
+	encoding := FieldEncoding{Encoding: EncodingBase64}
+	raw := s
+	if limit := base64.StdEncoding.DecodedLen(MaxFieldSize); len(raw) > limit {
+		encoding.Truncated = len(raw) - limit
+		raw = raw[:limit]
+	}
+	return base64.StdEncoding.EncodeToString([]byte(raw)), encoding, false
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// copyValue deep copies pointers and slices of v, so that fields of
+// the copy can be changed without touching v
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(copyValue(v.Elem()))
+		return p
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return s
+	case reflect.Struct:
+		s := reflect.New(v.Type()).Elem()
+		s.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if s.Field(i).CanSet() {
+				s.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+		return s
+	}
+	return v
+}
+
+// encodingNote returns fields of event which aren't kept as reported
+// for display
+func encodingNote(evt Event) string {
+	if len(evt.Encodings) == 0 {
+		return ""
+	}
+	fields := []string{}
+	for _, e := range evt.Encodings {
+		field := e.Field
+		if e.Encoding != "" {
+			field += " " + e.Encoding
+		}
+		if e.Truncated > 0 {
+			field += fmt.Sprintf(" truncated %d bytes", e.Truncated)
+		}
+		fields = append(fields, field)
+	}
+	return " (" + strings.Join(fields, ", ") + ")"
+}
@@ -0,0 +1,94 @@
+package reporter
+
+import (
+	"bytes"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeEvent(t *testing.T) {
+	raw := "ELF\x7f\xff\xfe\x00binary"
+	event := report.ReportEvent{
+		ID:        "sha256:aa",
+		AlertType: report.Backdoor,
+		AlertDetails: []report.AlertDetail{
+			{BackdoorDetail: &report.BackdoorDetail{FileDetail: report.FileDetail{Path: raw}}},
+			{HistoryDetail: &report.HistoryDetail{Content: strings.Repeat("é", MaxFieldSize)}},
+		},
+	}
+
+	sanitized, encodings := sanitizeEvent(event)
+	assert.Equal(t, raw, event.AlertDetails[0].BackdoorDetail.Path, "reported event is untouched")
+	assert.Len(t, encodings, 2)
+
+	assert.Equal(t, "alert_details.0.backdoor_detail.path", encodings[0].Field)
+	assert.Equal(t, EncodingBase64, encodings[0].Encoding)
+	decoded, err := encodings[0].Decode(sanitized.AlertDetails[0].BackdoorDetail.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, raw, string(decoded))
+
+	content := sanitized.AlertDetails[1].HistoryDetail.Content
+	assert.Equal(t, "alert_details.1.history_detail.content", encodings[1].Field)
+	assert.True(t, utf8.ValidString(content))
+	assert.True(t, len(content) <= MaxFieldSize)
+	assert.True(t, strings.HasSuffix(content, TruncatedMarker))
+	assert.Equal(t, 2*MaxFieldSize-len(content)+len(TruncatedMarker), encodings[1].Truncated)
+
+	kept, encodings := sanitizeEvent(report.ReportEvent{ID: "sha256:aa"})
+	assert.Nil(t, encodings)
+	assert.Equal(t, "sha256:aa", kept.ID)
+}
+
+// TestSanitizeRoundTrip feeds random bytes through event, json of report
+// and parsing it back
+func TestSanitizeRoundTrip(t *testing.T) {
+	r, err := NewReporter()
+	assert.NoError(t, err)
+
+	rnd := rand.New(rand.NewSource(1))
+	randomString := func() string {
+		b := make([]byte, rnd.Intn(64))
+		if rnd.Intn(10) == 0 {
+			b = make([]byte, MaxFieldSize+rnd.Intn(MaxFieldSize))
+		}
+		rnd.Read(b)
+		return string(b)
+	}
+
+	for i := 0; i < 200; i++ {
+		event := report.ReportEvent{
+			ID:        randomString(),
+			AlertType: report.Sensitive,
+			AlertDetails: []report.AlertDetail{
+				{SensitiveFileDetail: &report.SensitveFileDetail{
+					FileDetail: report.FileDetail{Path: randomString()},
+					RuleName:   randomString(),
+				}},
+				{SensitiveEnvDetail: &report.SensitiveEnvDetail{Key: randomString(), Value: randomString()}},
+				{BasicDetail: &report.BasicDetail{Env: []string{randomString(), randomString()}}},
+			},
+		}
+
+		evt, _ := r.convert(event)
+		b := &bytes.Buffer{}
+		assert.NoError(t, WriteJSON(b, Report{SchemaVersion: SchemaVersion, Events: []Event{evt}}))
+		doc, err := Parse(b.Bytes())
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Equal(t, evt.ReportEvent.AlertDetails, doc.Events[0].AlertDetails)
+
+		// Raw values are recovered from fields encoded without truncation
+		for _, e := range doc.Events[0].Encodings {
+			if e.Field == "alert_details.1.sensitive_env_detail.value" && e.Truncated == 0 {
+				decoded, err := e.Decode(doc.Events[0].AlertDetails[1].SensitiveEnvDetail.Value)
+				assert.NoError(t, err)
+				assert.Equal(t, event.AlertDetails[1].SensitiveEnvDetail.Value, string(decoded))
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package reporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	// sarifImageRoot is base of uris of files in images, it's resolved to
+	// root of the image in logical location of result
+	sarifImageRoot = "IMAGEROOT"
+	// sarifFingerprint is key of fingerprints of events in partial
+	// fingerprints, which deduplicate results across runs. It's
+	// suffixed by version of fingerprints, e.g. veinmindFingerprint/v2
+	sarifFingerprint = "veinmindFingerprint"
+	// sarifSecuritySeverity is property of rules which code scanning of
+	// GitHub ranks alerts by
+	sarifSecuritySeverity = "security-severity"
+	// sarifProgress is property of runs of partial reports
+	sarifProgress = "veinmindProgress"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult                    `json:"results"`
+	// Properties carry progress of partial reports
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string              `json:"id"`
+	ShortDescription     sarifMessage        `json:"shortDescription"`
+	DefaultConfiguration *sarifConfiguration `json:"defaultConfiguration,omitempty"`
+	Properties           map[string]string   `json:"properties,omitempty"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations,omitempty"`
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+}
+
+type sarifLocation struct {
+	Message          *sarifMessage          `json:"message,omitempty"`
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI         string        `json:"uri"`
+	URIBaseID   string        `json:"uriBaseId,omitempty"`
+	Description *sarifMessage `json:"description,omitempty"`
+}
+
+type sarifLogicalLocation struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// sarifLevel maps level of event to level of SARIF result by
+// severities, levels without severity are mapped by default
+func sarifLevel(l report.Level) string {
+	if s := severityOf(l); s.SARIFLevel != "" {
+		return s.SARIFLevel
+	}
+	switch l {
+	case report.Critical, report.High:
+		return "error"
+	case report.Medium:
+		return "warning"
+	case report.Low:
+		return "note"
+	default:
+		return "none"
+	}
+}
+
+// sarifRuleSeverity sets default level and security severity of rule
+// by the most severe level of its results
+func sarifRuleSeverity(rule *sarifRule, l report.Level) {
+	rule.DefaultConfiguration = &sarifConfiguration{Level: sarifLevel(l)}
+	if s := severityOf(l); s.SecuritySeverity != nil {
+		rule.Properties = map[string]string{sarifSecuritySeverity: strconv.FormatFloat(*s.SecuritySeverity, 'f', 1, 64)}
+	}
+}
+
+// WriteSARIF renders events of report as SARIF, alert types are rules
+// and images are logical locations of results. Paths of files are
+// relative to root of images, and rules are scored by severities
+func WriteSARIF(w io.Writer, doc Report) error {
+	rules := []sarifRule{}
+	ruleIndex := map[string]int{}
+	ruleLevels := map[string]report.Level{}
+	results := []sarifResult{}
+	fingerprintKey := fmt.Sprintf("%s/v%d", sarifFingerprint, doc.fingerprintVersion())
+	for _, evt := range doc.Events {
+		rule := AlertTypeString(evt.AlertType)
+		if _, ok := ruleIndex[rule]; !ok {
+			ruleIndex[rule] = len(rules)
+			ruleLevels[rule] = evt.Level
+			rules = append(rules, sarifRule{ID: rule, ShortDescription: sarifMessage{Text: rule + " issue of image"}})
+		} else if LevelRank(evt.Level) > LevelRank(ruleLevels[rule]) {
+			ruleLevels[rule] = evt.Level
+		}
+
+		image := sarifLogicalLocation{Name: displayImage(evt), Kind: "image"}
+		locations := []sarifLocation{}
+		for _, p := range Paths(evt.AlertDetails) {
+			location := sarifLocation{
+				PhysicalLocation: &sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: strings.TrimPrefix(p, "/"), URIBaseID: sarifImageRoot},
+				},
+				LogicalLocations: []sarifLogicalLocation{image},
+			}
+			if l, ok := eventLayer(evt, p); ok {
+				location.Message = &sarifMessage{Text: introducedBy(l)}
+			}
+			locations = append(locations, location)
+		}
+		if len(locations) == 0 {
+			locations = append(locations, sarifLocation{LogicalLocations: []sarifLogicalLocation{image}})
+		}
+
+		message := Describe(evt.AlertDetails) + encodingNote(evt)
+		if message == "" {
+			message = rule + " issue of image " + image.Name
+		}
+		for _, l := range evt.Layers {
+			message += "\n" + l.Path + " " + introducedBy(l)
+		}
+		result := sarifResult{
+			RuleID:    rule,
+			Level:     sarifLevel(evt.Level),
+			Message:   sarifMessage{Text: message},
+			Locations: locations,
+		}
+		if evt.Fingerprint != "" {
+			result.PartialFingerprints = map[string]string{fingerprintKey: evt.Fingerprint}
+		}
+		results = append(results, result)
+	}
+	for rule, i := range ruleIndex {
+		sarifRuleSeverity(&rules[i], ruleLevels[rule])
+	}
+
+	sarif := sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "veinmind-runner",
+				InformationURI: "https://github.com/chaitin/veinmind-tools",
+				Rules:          rules,
+			}},
+			OriginalURIBaseIDs: map[string]sarifArtifactLocation{
+				sarifImageRoot: {
+					URI:         "file:///",
+					Description: &sarifMessage{Text: "root of filesystem of the image in logical location of result"},
+				},
+			},
+			Results: results,
+		}},
+	}
+	if p := doc.Metadata.Progress; p != nil {
+		sarif.Runs[0].Properties = map[string]interface{}{sarifProgress: p}
+	}
+
+	b, err := json.MarshalIndent(sarif, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
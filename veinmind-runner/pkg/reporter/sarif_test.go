@@ -0,0 +1,112 @@
+package reporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/normalize"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func sarifTestReport() Report {
+	backdoor := func(level report.Level, path string, fingerprint string) Event {
+		return Event{
+			ReportEvent: report.ReportEvent{
+				ID:        testImageID,
+				Level:     level,
+				AlertType: report.Backdoor,
+				AlertDetails: []report.AlertDetail{{
+					BackdoorDetail: &report.BackdoorDetail{
+						FileDetail:  report.FileDetail{Path: path},
+						Description: "crontab backdoor",
+					},
+				}},
+			},
+			Image:       &Image{ID: testImageID, Digest: testImageDigest, RepoRefs: []string{"nginx:1.21"}},
+			Fingerprint: fingerprint,
+		}
+	}
+	return Report{
+		SchemaVersion: SchemaVersion,
+		Events: []Event{
+			backdoor(report.Medium, "/etc/cron.d/a", "fp1"),
+			backdoor(report.Critical, "/etc/cron.d/b", "fp2"),
+			{ReportEvent: report.ReportEvent{ID: testImageID, Level: report.Low, AlertType: report.Weakpass}},
+		},
+	}
+}
+
+// TestSARIFSchema validates SARIF against excerpt of the official
+// schema in testdata
+func TestSARIFSchema(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/sarif-schema-2.1.0.json")
+	assert.Nil(t, err)
+	schema := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(b, &schema))
+
+	out := &bytes.Buffer{}
+	assert.Nil(t, WriteSARIF(out, sarifTestReport()))
+	var doc interface{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &doc))
+	assert.Empty(t, ValidateSchema(schema, doc))
+
+	// Schema catches unknown fields and levels
+	var invalid interface{}
+	assert.Nil(t, json.Unmarshal([]byte(strings.Replace(out.String(), `"level": "error"`, `"level": "fatal"`, 1)), &invalid))
+	assert.NotEmpty(t, ValidateSchema(schema, invalid))
+	assert.Nil(t, json.Unmarshal([]byte(strings.Replace(out.String(), `"ruleId"`, `"rule_id"`, 1)), &invalid))
+	assert.NotEmpty(t, ValidateSchema(schema, invalid))
+}
+
+func TestSARIFSeverities(t *testing.T) {
+	out := &bytes.Buffer{}
+	assert.Nil(t, WriteSARIF(out, sarifTestReport()))
+	sarif := sarifLog{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &sarif))
+
+	run := sarif.Runs[0]
+	assert.Equal(t, "file:///", run.OriginalURIBaseIDs[sarifImageRoot].URI)
+	// Rules are scored by their most severe results
+	rules := run.Tool.Driver.Rules
+	assert.Equal(t, AlertTypeString(report.Backdoor), rules[0].ID)
+	assert.Equal(t, "9.5", rules[0].Properties[sarifSecuritySeverity])
+	assert.Equal(t, "error", rules[0].DefaultConfiguration.Level)
+	assert.Equal(t, "2.0", rules[1].Properties[sarifSecuritySeverity])
+
+	results := run.Results
+	assert.Equal(t, "warning", results[0].Level)
+	assert.Equal(t, map[string]string{"veinmindFingerprint/v1": "fp1"}, results[0].PartialFingerprints)
+	assert.Equal(t, sarifImageRoot, results[0].Locations[0].PhysicalLocation.ArtifactLocation.URIBaseID)
+	assert.Nil(t, results[2].PartialFingerprints)
+
+	// Severities of normalize rules override the defaults
+	score := 6.5
+	n, err := normalize.New(normalize.Merge(normalize.Default, normalize.Rules{Severities: map[string]normalize.Severity{
+		"high":   {SARIFLevel: "warning"},
+		"medium": {SecuritySeverity: &score},
+	}}))
+	assert.Nil(t, err)
+	SetSeverities(n.Severities())
+	defer SetSeverities(defaultSeverities())
+
+	assert.Equal(t, "warning", sarifLevel(report.High))
+	rule := sarifRule{}
+	sarifRuleSeverity(&rule, report.Medium)
+	assert.Equal(t, "6.5", rule.Properties[sarifSecuritySeverity])
+}
+
+func TestWriteColorTable(t *testing.T) {
+	out := &bytes.Buffer{}
+	assert.Nil(t, WriteColorTable(out, sarifTestReport()))
+	lines := strings.Split(out.String(), "\n")
+	assert.Contains(t, lines[1], "\x1b[0;33mMedium\x1b[0m")
+	assert.Contains(t, lines[2], "\x1b[1;31mCritical\x1b[0m")
+	// Alert types are aligned after colored levels
+	column := strings.Index(lines[0], "ALERT")
+	for i, alert := range []report.AlertType{report.Backdoor, report.Backdoor, report.Weakpass} {
+		assert.Equal(t, column, strings.Index(lines[i+1], AlertTypeString(alert)), lines[i+1])
+	}
+}
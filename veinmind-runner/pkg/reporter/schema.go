@@ -0,0 +1,401 @@
+package reporter
+
+import (
+	"embed"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// schemaFS holds JSON schemas of report documents of every version as
+// schema/report-v<version>.json, schemas are additive within a version
+//
+//go:embed schema
+var schemaFS embed.FS
+
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// SchemaFile returns path of schema of version in schemaFS
+func SchemaFile(version int) string {
+	return fmt.Sprintf("schema/report-v%d.json", version)
+}
+
+// Schema returns JSON schema of report document of version
+func Schema(version int) ([]byte, error) {
+	b, err := schemaFS.ReadFile(SchemaFile(version))
+	if err != nil {
+		return nil, errors.Errorf("no schema of report version %d", version)
+	}
+	return b, nil
+}
+
+// GenerateSchema derives JSON schema of report document of
+// SchemaVersion from Report. Fields which are always written are
+// required, and fields which can be written as null accept null
+func GenerateSchema() ([]byte, error) {
+	s := typeSchema(reflect.TypeOf(Report{}))
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["title"] = fmt.Sprintf("veinmind-runner report v%d", SchemaVersion)
+	s["properties"].(map[string]interface{})["schema_version"] = map[string]interface{}{
+		"type":  "integer",
+		"const": SchemaVersion,
+	}
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		return nullable(typeSchema(t.Elem()))
+	}
+
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return marshalerSchema(t)
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": []interface{}{"string", "null"}}
+		}
+		return map[string]interface{}{"type": []interface{}{"array", "null"}, "items": typeSchema(t.Elem())}
+	case reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": []interface{}{"object", "null"}, "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return map[string]interface{}{}
+}
+
+// marshalerSchema returns schema of type marshaling itself by type of
+// JSON its zero value is marshaled to
+func marshalerSchema(t reflect.Type) map[string]interface{} {
+	b, err := json.Marshal(reflect.New(t).Interface())
+	if err != nil || len(b) == 0 {
+		return map[string]interface{}{}
+	}
+
+	switch b[0] {
+	case '"':
+		return map[string]interface{}{"type": "string"}
+	case '{':
+		return map[string]interface{}{"type": "object"}
+	case '[':
+		return map[string]interface{}{"type": "array"}
+	case 't', 'f':
+		return map[string]interface{}{"type": "boolean"}
+	}
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := map[string]bool{}
+	collectFields(t, properties, required)
+
+	names := []interface{}{}
+	for name, ok := range required {
+		if ok {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i].(string) < names[j].(string)
+	})
+
+	s := map[string]interface{}{"type": "object", "properties": properties}
+	if len(names) > 0 {
+		s["required"] = names
+	}
+	return s
+}
+
+// collectFields collects JSON fields of struct, fields of embedded
+// structs are promoted unless fields of outer struct shadow them
+func collectFields(t reflect.Type, properties map[string]interface{}, required map[string]bool) {
+	embedded := []reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i:]
+		}
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		properties[name] = typeSchema(f.Type)
+		required[name] = !strings.Contains(opts, ",omitempty")
+	}
+
+	for _, et := range embedded {
+		promoted := map[string]interface{}{}
+		promotedRequired := map[string]bool{}
+		collectFields(et, promoted, promotedRequired)
+		for name, s := range promoted {
+			if _, ok := properties[name]; !ok {
+				properties[name] = s
+				required[name] = promotedRequired[name]
+			}
+		}
+	}
+}
+
+// nullable adds null to types of schema
+func nullable(s map[string]interface{}) map[string]interface{} {
+	switch t := s["type"].(type) {
+	case string:
+		s["type"] = []interface{}{t, "null"}
+	case []interface{}:
+		for _, v := range t {
+			if v == "null" {
+				return s
+			}
+		}
+		s["type"] = append(t, "null")
+	}
+	return s
+}
+
+// Violation is a value of report document violating schema, Path is
+// JSON path of the value, e.g. $.events[0].level
+type Violation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return v.Path + ": " + v.Message
+}
+
+// Validate validates report document against schema of the version
+// it declares, documents without version are validated against schema
+// of SchemaVersion
+func Validate(b []byte) ([]Violation, error) {
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, errors.Wrap(err, "parse report")
+	}
+
+	version := SchemaVersion
+	if obj, ok := doc.(map[string]interface{}); ok {
+		if v, ok := obj["schema_version"].(float64); ok && v == math.Trunc(v) && v >= 1 {
+			version = int(v)
+		}
+	}
+
+	raw, err := Schema(version)
+	if err != nil {
+		return nil, err
+	}
+	schema := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, errors.Wrapf(err, "parse schema of report version %d", version)
+	}
+
+	return ValidateSchema(schema, doc), nil
+}
+
+// ValidateSchema validates document against JSON schema, keywords of
+// types, objects and arrays are validated along with const, enum and
+// local $ref to definitions
+func ValidateSchema(schema map[string]interface{}, doc interface{}) []Violation {
+	violations := []Violation{}
+	validateValue(schema, schema, doc, "$", &violations)
+	return violations
+}
+
+func validateValue(root map[string]interface{}, schema map[string]interface{}, v interface{}, path string, violations *[]Violation) {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := resolveRef(root, ref)
+		if err != nil {
+			*violations = append(*violations, Violation{Path: path, Message: err.Error()})
+			return
+		}
+		schema = resolved
+	}
+
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, v) {
+		*violations = append(*violations, Violation{Path: path, Message: fmt.Sprintf("expect %v, got %s", c, jsonValue(v))})
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && !containsValue(enum, v) {
+		*violations = append(*violations, Violation{Path: path, Message: fmt.Sprintf("expect one of %s, got %s", jsonValue(enum), jsonValue(v))})
+		return
+	}
+
+	if t, ok := schema["type"]; ok {
+		types := []string{}
+		switch t := t.(type) {
+		case string:
+			types = append(types, t)
+		case []interface{}:
+			for _, s := range t {
+				types = append(types, fmt.Sprint(s))
+			}
+		}
+		if !matchType(types, v) {
+			*violations = append(*violations, Violation{
+				Path:    path,
+				Message: fmt.Sprintf("expect %s, got %s", strings.Join(types, " or "), jsonType(v)),
+			})
+			return
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := v[name.(string)]; !ok {
+					*violations = append(*violations, Violation{Path: childPath(path, name.(string)), Message: "required field is missing"})
+				}
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if s, ok := properties[k].(map[string]interface{}); ok {
+				validateValue(root, s, v[k], childPath(path, k), violations)
+			} else if s, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+				validateValue(root, s, v[k], childPath(path, k), violations)
+			} else if schema["additionalProperties"] == false {
+				*violations = append(*violations, Violation{Path: childPath(path, k), Message: "unknown field"})
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validateValue(root, items, item, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+	}
+}
+
+// resolveRef resolves local reference of schema, e.g.
+// #/definitions/result
+func resolveRef(root map[string]interface{}, ref string) (map[string]interface{}, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, errors.Errorf("unsupported reference %#v", ref)
+	}
+
+	schema := root
+	for _, name := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		next, ok := schema[name].(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("unresolved reference %#v", ref)
+		}
+		schema = next
+	}
+	return schema, nil
+}
+
+func containsValue(values []interface{}, v interface{}) bool {
+	for _, value := range values {
+		if reflect.DeepEqual(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchType(types []string, v interface{}) bool {
+	actual := jsonType(v)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func jsonValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return jsonType(v)
+	}
+	return string(b)
+}
+
+func childPath(path string, name string) string {
+	for _, r := range name {
+		if !(r == '_' || r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return fmt.Sprintf("%s[%q]", path, name)
+		}
+	}
+	return path + "." + name
+}
@@ -0,0 +1,139 @@
+package reporter
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+var updateSchema = flag.Bool("update-schema", false, "rewrite schema of SchemaVersion generated from Report")
+
+// TestSchema fails if fields of report change without updating schema
+// of SchemaVersion, and if schema changes in a breaking way, which
+// requires bumping SchemaVersion instead
+func TestSchema(t *testing.T) {
+	generated, err := GenerateSchema()
+	assert.NoError(t, err)
+
+	embedded, err := Schema(SchemaVersion)
+	if err == nil {
+		old, current := map[string]interface{}{}, map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(embedded, &old))
+		assert.NoError(t, json.Unmarshal(generated, &current))
+		breaks := schemaBreaks(old, current, "$")
+		if !assert.Empty(t, breaks, "breaking change of report requires bumping SchemaVersion") {
+			return
+		}
+	}
+
+	if *updateSchema {
+		assert.NoError(t, ioutil.WriteFile(SchemaFile(SchemaVersion), generated, 0644))
+		return
+	}
+	assert.Equal(t, string(embedded), string(generated),
+		"schema of report is outdated, run go test ./pkg/reporter -run TestSchema -update-schema")
+}
+
+// schemaBreaks returns changes from old to current schema which can
+// break consumers, fields can only be added
+func schemaBreaks(old map[string]interface{}, current map[string]interface{}, path string) []string {
+	breaks := []string{}
+	if !reflect.DeepEqual(old["type"], current["type"]) {
+		return append(breaks, fmt.Sprintf("%s: type changed from %v to %v", path, old["type"], current["type"]))
+	}
+
+	required := map[interface{}]bool{}
+	if r, ok := current["required"].([]interface{}); ok {
+		for _, name := range r {
+			required[name] = true
+		}
+	}
+	if r, ok := old["required"].([]interface{}); ok {
+		for _, name := range r {
+			if !required[name] {
+				breaks = append(breaks, fmt.Sprintf("%s.%s: no longer required", path, name))
+			}
+		}
+	}
+
+	oldProperties, _ := old["properties"].(map[string]interface{})
+	currentProperties, _ := current["properties"].(map[string]interface{})
+	names := []string{}
+	for name := range oldProperties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c, ok := currentProperties[name].(map[string]interface{})
+		if !ok {
+			breaks = append(breaks, fmt.Sprintf("%s.%s: removed", path, name))
+			continue
+		}
+		breaks = append(breaks, schemaBreaks(oldProperties[name].(map[string]interface{}), c, path+"."+name)...)
+	}
+
+	for _, key := range []string{"items", "additionalProperties"} {
+		o, ok := old[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		c, ok := current[key].(map[string]interface{})
+		if !ok {
+			breaks = append(breaks, fmt.Sprintf("%s: %s removed", path, key))
+			continue
+		}
+		breaks = append(breaks, schemaBreaks(o, c, path+"[]")...)
+	}
+	return breaks
+}
+
+func TestValidate(t *testing.T) {
+	doc := Report{
+		SchemaVersion: SchemaVersion,
+		Metadata:      Metadata{Coverage: []Coverage{{ImageID: testImageID, Scope: ScopeFullImage}}},
+		Events: []Event{{
+			ReportEvent: report.ReportEvent{
+				ID:        testImageID,
+				Time:      time.Now(),
+				Level:     report.High,
+				AlertType: report.Weakpass,
+				AlertDetails: []report.AlertDetail{
+					{MaliciousFileDetail: &report.MaliciousFileDetail{}},
+				},
+			},
+			ImageRefs:   []string{"app:latest"},
+			Fingerprint: "fp",
+			Monitor:     &Monitor{Plugin: "veinmind-new"},
+		}},
+	}
+	b, err := json.Marshal(doc)
+	assert.NoError(t, err)
+	violations, err := Validate(b)
+	assert.NoError(t, err)
+	assert.Empty(t, violations)
+
+	violations, err = Validate([]byte(`{"schema_version": 1, "metadata": {"coverage": [{"scope": 1}]},
+		"events": [{"id": 1, "time": "2022-01-01T00:00:00Z", "level": "High", "detect_type": "Image", "event_type": "Risk",
+		"alert_type": "Weakpass", "alert_details": null, "image_refs": null}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Violation{
+		{Path: "$.events[0].fingerprint", Message: "required field is missing"},
+		{Path: "$.events[0].id", Message: "expect string, got integer"},
+		{Path: "$.metadata.coverage[0].image_id", Message: "required field is missing"},
+		{Path: "$.metadata.coverage[0].scope", Message: "expect string, got integer"},
+	}, violations)
+
+	violations, err = Validate([]byte(`{"schema_version": "1"}`))
+	assert.NoError(t, err)
+	assert.Contains(t, violations, Violation{Path: "$.schema_version", Message: `expect 1, got "1"`})
+
+	_, err = Validate([]byte(`{"schema_version": 999}`))
+	assert.Error(t, err)
+}
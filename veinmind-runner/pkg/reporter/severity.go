@@ -0,0 +1,48 @@
+package reporter
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/normalize"
+	"sync"
+)
+
+var (
+	severitiesMu sync.RWMutex
+	// severities are presentation of levels in SARIF and colored tables
+	severities = defaultSeverities()
+)
+
+func defaultSeverities() map[report.Level]normalize.Severity {
+	n, err := normalize.New(normalize.Rules{Severities: normalize.DefaultSeverities})
+	if err != nil {
+		panic(err)
+	}
+	return n.Severities()
+}
+
+// SetSeverities sets presentation of levels, usually severities of
+// normalize rules
+func SetSeverities(s map[report.Level]normalize.Severity) {
+	severitiesMu.Lock()
+	defer severitiesMu.Unlock()
+	severities = s
+}
+
+func severityOf(l report.Level) normalize.Severity {
+	severitiesMu.RLock()
+	defer severitiesMu.RUnlock()
+	return severities[l]
+}
+
+// colorLevel returns name of level in its color, every colored cell
+// is longer by escape codes of the same length
+func colorLevel(l report.Level) string {
+	return colorText(normalize.Colors[severityOf(l).Color], LevelString(l))
+}
+
+func colorText(code string, s string) string {
+	if code == "" {
+		code = normalize.NoColor
+	}
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
@@ -0,0 +1,48 @@
+package reporter
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+)
+
+// Suppression records events of a plugin execution over its event
+// limit, they are collapsed into a single aggregated event
+type Suppression struct {
+	ImageID string `json:"image_id"`
+	Plugin  string `json:"plugin"`
+	Limit   int    `json:"limit"`
+	// Total is number of events reported, Suppressed of them are
+	// collapsed
+	Total      int `json:"total"`
+	Suppressed int `json:"suppressed"`
+	// Monitor is set if plugin is in monitor mode
+	Monitor bool `json:"monitor,omitempty"`
+}
+
+// AddSuppressed records suppression in metadata and appends the
+// aggregated event of suppressed events, which is marked with it.
+// Aggregated event of plugin in monitor mode is monitor-only too
+func (r *Reporter) AddSuppressed(s Suppression, aggregated report.ReportEvent) {
+	evt, err := r.convert(aggregated)
+	if err != nil {
+		log.Error(err)
+	}
+	evt.Suppressed = &s
+	if s.Monitor {
+		evt.Monitor = &Monitor{Plugin: s.Plugin}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata.Suppressions = append(r.metadata.Suppressions, s)
+	r.events = append(r.events, evt)
+}
+
+// Suppressed returns number of events suppressed in doc
+func (doc Report) Suppressed() int {
+	n := 0
+	for _, s := range doc.Metadata.Suppressions {
+		n += s.Suppressed
+	}
+	return n
+}
@@ -0,0 +1,53 @@
+package reporter
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// WriteTable renders events of report as a table for terminals
+func WriteTable(w io.Writer, doc Report) error {
+	return writeTable(w, doc, false)
+}
+
+// WriteColorTable renders events of report as a table with levels in
+// colors of their severities
+func WriteColorTable(w io.Writer, doc Report) error {
+	return writeTable(w, doc, true)
+}
+
+func writeTable(w io.Writer, doc Report, color bool) error {
+	level, header := LevelString, "LEVEL"
+	if color {
+		level, header = colorLevel, colorText("", header)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "IMAGE\t%s\tALERT\tDETAIL\n", header)
+	for _, evt := range doc.Events {
+		image := displayImage(evt)
+		if evt.Allowlisted {
+			image += " (allowlisted)"
+		}
+		if evt.Monitor != nil {
+			image += " (monitor-only)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", image, level(evt.Level),
+			AlertTypeString(evt.AlertType), Describe(evt.AlertDetails)+readableNote(evt)+encodingNote(evt))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	var err error
+	if monitored := doc.Monitored(); monitored > 0 {
+		_, err = fmt.Fprintf(w, "%d event(s), %d of them monitor-only\n", len(doc.Events), monitored)
+	} else {
+		_, err = fmt.Fprintf(w, "%d event(s)\n", len(doc.Events))
+	}
+	if err == nil && doc.Metadata.Progress != nil {
+		_, err = fmt.Fprintln(w, doc.Metadata.Progress.String())
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package reporter
+
+// Statuses of trend of image
+const (
+	// TrendCompared is image compared against its baseline
+	TrendCompared = "compared"
+	// TrendNoBaseline is image without historical runs in window,
+	// which is decided by static threshold
+	TrendNoBaseline = "no baseline"
+)
+
+// Trend is comparison of findings of image against its baseline, which
+// is the median of historical runs of the image in window
+type Trend struct {
+	Image  string `json:"image"`
+	Status string `json:"status"`
+	// Runs is the number of historical runs of baseline
+	Runs int `json:"runs"`
+	// Level is the level whose events are counted
+	Level       string  `json:"level"`
+	Count       int     `json:"count"`
+	MedianCount float64 `json:"median_count"`
+	// Score is the sum of weights of levels of events, low weighs 1
+	// and critical weighs 4
+	Score       int     `json:"score"`
+	MedianScore float64 `json:"median_score"`
+	// NewAlertTypes are alert types firing which never fired in runs
+	// of baseline
+	NewAlertTypes []string `json:"new_alert_types,omitempty"`
+	// Regressions are rules failed by image
+	Regressions []string `json:"regressions,omitempty"`
+	Fail        bool     `json:"fail"`
+}
+
+// Score returns the sum of weights of levels of events, events of None
+// level weigh nothing
+func Score(events []Event) int {
+	score := 0
+	for _, evt := range events {
+		if rank := LevelRank(evt.Level); rank >= 0 {
+			score += rank + 1
+		}
+	}
+	return score
+}
+
+// ImageKey returns key of image of event in trends and gate reasons,
+// the first reference of image or id if it has none
+func ImageKey(evt Event) string {
+	if len(evt.ImageRefs) > 0 {
+		return evt.ImageRefs[0]
+	}
+	return evt.ID
+}
@@ -0,0 +1,34 @@
+package reporter
+
+import (
+	"bytes"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/kubelet"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWorkloads(t *testing.T) {
+	r, err := NewReporter()
+	assert.NoError(t, err)
+	go r.Listen()
+
+	workloads := []kubelet.Workload{
+		{Namespace: "prod", Pod: "web-0", Container: "nginx"},
+		{Namespace: "prod", Pod: "web-0", Container: "sidecar"},
+		{Namespace: "staging", Pod: "web-0", Container: "nginx"},
+	}
+	r.SetWorkloads("sha256:aa", workloads)
+	r.Send(report.ReportEvent{ID: "sha256:aa", AlertType: report.Backdoor})
+	r.Send(report.ReportEvent{ID: "sha256:bb", AlertType: report.Backdoor})
+	r.StopListen()
+
+	doc := r.Snapshot()
+	assert.Len(t, doc.Events, 2)
+	assert.Equal(t, workloads, doc.Events[0].Workloads)
+	assert.Nil(t, doc.Events[1].Workloads)
+
+	b := &bytes.Buffer{}
+	assert.NoError(t, WriteMarkdown(b, doc))
+	assert.Contains(t, b.String(), "sha256:aa (pods: prod/web-0, staging/web-0)")
+}
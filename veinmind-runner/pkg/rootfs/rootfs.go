@@ -0,0 +1,353 @@
+// Package rootfs materializes merged filesystem of images into plain
+// directories for plugins which can't use the filesystem API, e.g.
+// external antivirus engines. Regular files are hard linked from the
+// content opened by the runtime where it lives on the same filesystem
+// and copied otherwise. Rootfs of images in flight share a disk budget
+// and a cap of how many exist at once
+package rootfs
+
+import (
+	"context"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/prune"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DirPrefix is prefix of directories of rootfs
+const DirPrefix = "veinmind-rootfs-"
+
+// FileSystem is the file system of image materialized
+type FileSystem interface {
+	Walk(root string, fn filepath.WalkFunc) error
+	Readlink(path string) (string, error)
+	Open(path string) (io.ReadCloser, error)
+}
+
+// Stat is rootfs of image materialized for plugins, Copied is bytes
+// written to disk and Linked is files hard linked instead of copied.
+// Wait is time waited for disk budget or a slot
+type Stat struct {
+	ImageID string        `json:"image_id"`
+	Plugins []string      `json:"plugins"`
+	Files   int           `json:"files"`
+	Linked  int           `json:"linked"`
+	Copied  int64         `json:"copied"`
+	Wait    time.Duration `json:"wait"`
+	Elapsed time.Duration `json:"elapsed"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// Pool limits rootfs existing at once by number and by bytes copied,
+// 0 is unlimited for either
+type Pool struct {
+	dir     string
+	budget  int64
+	max     int
+	link    bool
+	mu      sync.Mutex
+	used    int64
+	running int
+	changed chan struct{}
+}
+
+// NewPool returns pool materializing rootfs under dir, temporary
+// directory if it's empty. Files are always copied unless link
+func NewPool(dir string, budget int64, max int, link bool) (*Pool, error) {
+	if budget < 0 {
+		return nil, errors.New("rootfs: disk budget must not be negative")
+	}
+	if max < 0 {
+		return nil, errors.New("rootfs: concurrency must not be negative")
+	}
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return &Pool{dir: dir, budget: budget, max: max, link: link, changed: make(chan struct{})}, nil
+}
+
+// acquire waits until a rootfs of size bytes fits into the pool, time
+// waited is returned. Size exceeding the budget alone never fits
+func (p *Pool) acquire(ctx context.Context, size int64) (time.Duration, error) {
+	if p.budget > 0 && size > p.budget {
+		return 0, errors.Errorf("rootfs: image of %d bytes exceeds disk budget of %d bytes", size, p.budget)
+	}
+
+	start := time.Now()
+	for {
+		p.mu.Lock()
+		if (p.max == 0 || p.running < p.max) && (p.budget == 0 || p.used+size <= p.budget) {
+			p.running++
+			p.used += size
+			p.mu.Unlock()
+			return time.Since(start), nil
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return time.Since(start), ctx.Err()
+		}
+	}
+}
+
+// release returns size bytes to pool, and the slot if slot is set
+func (p *Pool) release(size int64, slot bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.used -= size
+	if slot {
+		p.running--
+	}
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// Shared is rootfs of image materialized on the first request of
+// plugins, it's removed by Close
+type Shared struct {
+	pool     *Pool
+	imageID  string
+	fsys     FileSystem
+	size     func() (int64, error)
+	once     sync.Once
+	path     string
+	err      error
+	reserved int64
+	mu       sync.Mutex
+	stat     Stat
+	plugins  map[string]struct{}
+}
+
+// New returns rootfs of image shared by plugins, size returns bytes of
+// regular files of image which are reserved from disk budget before
+// materializing
+func (p *Pool) New(imageID string, fsys FileSystem, size func() (int64, error)) *Shared {
+	return &Shared{
+		pool:    p,
+		imageID: imageID,
+		fsys:    fsys,
+		size:    size,
+		stat:    Stat{ImageID: imageID},
+		plugins: map[string]struct{}{},
+	}
+}
+
+// Path returns directory of rootfs for plugin, rootfs is materialized
+// on the first call and its error is returned to every plugin
+func (s *Shared) Path(ctx context.Context, plugin string) (string, error) {
+	s.mu.Lock()
+	s.plugins[plugin] = struct{}{}
+	s.mu.Unlock()
+
+	s.once.Do(func() {
+		s.path, s.err = s.materialize(ctx)
+		if s.err != nil {
+			s.mu.Lock()
+			s.stat.Error = s.err.Error()
+			s.mu.Unlock()
+		}
+	})
+	return s.path, s.err
+}
+
+// materialize reserves disk budget and writes rootfs of image, bytes
+// of files linked are returned to pool afterwards
+func (s *Shared) materialize(ctx context.Context) (string, error) {
+	size, err := s.size()
+	if err != nil {
+		return "", errors.Wrap(err, "rootfs: size image")
+	}
+	wait, err := s.pool.acquire(ctx, size)
+	s.mu.Lock()
+	s.stat.Wait = wait
+	s.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	s.reserved = size
+
+	start := time.Now()
+	dir, err := ioutil.TempDir(s.pool.dir, DirPrefix)
+	if err == nil {
+		err = s.write(ctx, dir, size)
+	}
+	s.mu.Lock()
+	s.stat.Elapsed = time.Since(start)
+	copied := s.stat.Copied
+	s.mu.Unlock()
+	if err != nil {
+		if dir != "" {
+			_ = os.RemoveAll(dir)
+		}
+		s.pool.release(s.reserved, true)
+		s.reserved = 0
+		return "", err
+	}
+
+	s.pool.release(s.reserved-copied, false)
+	s.reserved = copied
+	return dir, nil
+}
+
+// write writes entries of image into dir, unreadable paths are skipped
+// as the walk service does. Copies beyond size fail, so that the disk
+// budget holds even if image changed since it's sized
+func (s *Shared) write(ctx context.Context, dir string, size int64) error {
+	return s.fsys.Walk("/", func(p string, info os.FileInfo, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil || info == nil {
+			return nil
+		}
+		target := filepath.Join(dir, filepath.FromSlash(p))
+		if !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+			// The root itself
+			return nil
+		}
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			return os.MkdirAll(target, 0755)
+		case mode&os.ModeSymlink != 0:
+			dest, err := s.fsys.Readlink(p)
+			if err != nil {
+				return nil
+			}
+			return os.Symlink(dest, target)
+		case mode.IsRegular():
+			linked, copied, err := s.file(p, target, mode.Perm(), size)
+			if err != nil {
+				return err
+			}
+			s.mu.Lock()
+			s.stat.Files++
+			if linked {
+				s.stat.Linked++
+			}
+			s.stat.Copied += copied
+			s.mu.Unlock()
+		}
+		// Devices, pipes and sockets aren't materialized
+		return nil
+	})
+}
+
+// file hard links or copies regular file p of image to target, bytes
+// copied are returned. Files which can't be opened are skipped
+func (s *Shared) file(p string, target string, perm os.FileMode, size int64) (bool, int64, error) {
+	f, err := s.fsys.Open(p)
+	if err != nil {
+		return false, 0, nil
+	}
+	defer f.Close()
+
+	if s.pool.link {
+		if host, ok := hostPath(f); ok && os.Link(host, target) == nil {
+			return true, 0, nil
+		}
+	}
+
+	s.mu.Lock()
+	left := size - s.stat.Copied
+	s.mu.Unlock()
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return false, 0, err
+	}
+	n, err := io.Copy(out, io.LimitReader(f, left+1))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, n, err
+	}
+	if n > left {
+		return false, n, errors.Errorf("rootfs: image grew beyond %d bytes reserved", size)
+	}
+	return false, n, nil
+}
+
+// hostPath returns path of file opened by runtime on host, if it's an
+// open file of host whose path still refers to it, so that it can be
+// hard linked instead of copied
+func hostPath(f io.ReadCloser) (string, bool) {
+	file, ok := f.(interface {
+		Fd() uintptr
+		Stat() (os.FileInfo, error)
+	})
+	if !ok {
+		return "", false
+	}
+	host, err := os.Readlink("/proc/self/fd/" + strconv.FormatUint(uint64(file.Fd()), 10))
+	if err != nil || !filepath.IsAbs(host) {
+		return "", false
+	}
+	opened, err := file.Stat()
+	if err != nil {
+		return "", false
+	}
+	info, err := os.Lstat(host)
+	if err != nil || !os.SameFile(opened, info) {
+		return "", false
+	}
+	return host, true
+}
+
+// Used returns whether any plugin asked for rootfs of image
+func (s *Shared) Used() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.plugins) > 0
+}
+
+// Stat returns statistics of rootfs
+func (s *Shared) Stat() Stat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat := s.stat
+	stat.Plugins = []string{}
+	for p := range s.plugins {
+		stat.Plugins = append(stat.Plugins, p)
+	}
+	sort.Strings(stat.Plugins)
+	return stat
+}
+
+// Close removes rootfs of image and returns its disk budget and slot
+// to pool, later requests of plugins fail
+func (s *Shared) Close() error {
+	s.once.Do(func() {
+		s.err = errors.New("rootfs: image is scanned")
+	})
+	if s.path == "" {
+		return nil
+	}
+
+	err := os.RemoveAll(s.path)
+	s.pool.release(s.reserved, true)
+	s.path, s.reserved = "", 0
+	s.err = errors.New("rootfs: image is scanned")
+	return err
+}
+
+// Expired lists rootfs under dir left by runs before, temporary
+// directory is used if dir is empty
+func Expired(dir string, before time.Time) ([]prune.Item, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return prune.Entries(prune.KindRootfs, dir, before, func(info os.FileInfo) bool {
+		return info.IsDir() && strings.HasPrefix(info.Name(), DirPrefix)
+	})
+}
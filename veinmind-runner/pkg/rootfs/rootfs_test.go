@@ -0,0 +1,193 @@
+package rootfs
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dirImage is image whose filesystem is directory root, opened files
+// are host files unless reader is set
+type dirImage struct {
+	root   string
+	reader bool
+}
+
+func (d dirImage) Walk(root string, fn filepath.WalkFunc) error {
+	return filepath.Walk(filepath.Join(d.root, root), func(p string, info os.FileInfo, err error) error {
+		rel, _ := filepath.Rel(d.root, p)
+		return fn("/"+filepath.ToSlash(strings.TrimPrefix(rel, ".")), info, err)
+	})
+}
+
+func (d dirImage) Open(p string) (io.ReadCloser, error) {
+	if !d.reader {
+		return os.Open(filepath.Join(d.root, p))
+	}
+	b, err := ioutil.ReadFile(filepath.Join(d.root, p))
+	return ioutil.NopCloser(bytes.NewReader(b)), err
+}
+
+func (d dirImage) Readlink(p string) (string, error) {
+	return os.Readlink(filepath.Join(d.root, p))
+}
+
+func (d dirImage) size() (int64, error) {
+	return 10, nil
+}
+
+func newImage(t *testing.T, reader bool) dirImage {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "bin"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "bin", "sh"), []byte("shell"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "motd"), []byte("hello"), 0644))
+	require.NoError(t, os.Symlink("/bin/sh", filepath.Join(root, "bin", "bash")))
+	return dirImage{root: root, reader: reader}
+}
+
+func TestShared(t *testing.T) {
+	for _, link := range []bool{true, false} {
+		img := newImage(t, false)
+		pool, err := NewPool(t.TempDir(), 100, 1, link)
+		require.NoError(t, err)
+
+		s := pool.New("sha256:aa", img, img.size)
+		assert.False(t, s.Used())
+		dir, err := s.Path(context.Background(), "veinmind-av")
+		require.NoError(t, err)
+		again, err := s.Path(context.Background(), "veinmind-clam")
+		require.NoError(t, err)
+		assert.Equal(t, dir, again)
+		assert.True(t, strings.HasPrefix(filepath.Base(dir), DirPrefix))
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, "bin", "sh"))
+		require.NoError(t, err)
+		assert.Equal(t, "shell", string(b))
+		info, err := os.Stat(filepath.Join(dir, "bin", "sh"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+		dest, err := os.Readlink(filepath.Join(dir, "bin", "bash"))
+		require.NoError(t, err)
+		assert.Equal(t, "/bin/sh", dest)
+
+		orig, err := os.Stat(filepath.Join(img.root, "motd"))
+		require.NoError(t, err)
+		materialized, err := os.Stat(filepath.Join(dir, "motd"))
+		require.NoError(t, err)
+		assert.Equal(t, link, os.SameFile(orig, materialized))
+
+		stat := s.Stat()
+		assert.Equal(t, []string{"veinmind-av", "veinmind-clam"}, stat.Plugins)
+		assert.Equal(t, 2, stat.Files)
+		if link {
+			assert.Equal(t, 2, stat.Linked)
+			assert.Equal(t, int64(0), stat.Copied)
+			assert.Equal(t, int64(0), pool.used)
+		} else {
+			assert.Equal(t, 0, stat.Linked)
+			assert.Equal(t, int64(10), stat.Copied)
+			assert.Equal(t, int64(10), pool.used)
+		}
+
+		require.NoError(t, s.Close())
+		_, err = os.Stat(dir)
+		assert.True(t, os.IsNotExist(err))
+		assert.Equal(t, int64(0), pool.used)
+		assert.Equal(t, 0, pool.running)
+		_, err = s.Path(context.Background(), "veinmind-av")
+		assert.Error(t, err)
+	}
+}
+
+func TestSharedCopy(t *testing.T) {
+	img := newImage(t, true)
+	pool, err := NewPool(t.TempDir(), 0, 0, true)
+	require.NoError(t, err)
+
+	s := pool.New("sha256:aa", img, img.size)
+	dir, err := s.Path(context.Background(), "veinmind-av")
+	require.NoError(t, err)
+	b, err := ioutil.ReadFile(filepath.Join(dir, "motd"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+	assert.Equal(t, 0, s.Stat().Linked)
+	require.NoError(t, s.Close())
+}
+
+func TestSharedBudget(t *testing.T) {
+	img := newImage(t, true)
+	parent := t.TempDir()
+	pool, err := NewPool(parent, 8, 0, false)
+	require.NoError(t, err)
+
+	// Image larger than the budget fails right away
+	s := pool.New("sha256:aa", img, img.size)
+	_, err = s.Path(context.Background(), "veinmind-av")
+	assert.Error(t, err)
+	assert.Equal(t, err.Error(), s.Stat().Error)
+	require.NoError(t, s.Close())
+
+	// Image growing beyond its size is removed
+	small := pool.New("sha256:bb", img, func() (int64, error) { return 7, nil })
+	_, err = small.Path(context.Background(), "veinmind-av")
+	assert.Error(t, err)
+	infos, err := ioutil.ReadDir(parent)
+	require.NoError(t, err)
+	assert.Empty(t, infos)
+	assert.Equal(t, int64(0), pool.used)
+	assert.Equal(t, 0, pool.running)
+}
+
+func TestPoolWait(t *testing.T) {
+	img := newImage(t, true)
+	pool, err := NewPool(t.TempDir(), 0, 1, false)
+	require.NoError(t, err)
+
+	first := pool.New("sha256:aa", img, img.size)
+	_, err = first.Path(context.Background(), "veinmind-av")
+	require.NoError(t, err)
+
+	// The second rootfs waits for the first to be removed
+	second := pool.New("sha256:bb", img, img.size)
+	done := make(chan error)
+	go func() {
+		_, err := second.Path(context.Background(), "veinmind-av")
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("rootfs materialized over concurrency")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.NoError(t, first.Close())
+	require.NoError(t, <-done)
+	assert.True(t, second.Stat().Wait >= 50*time.Millisecond)
+	require.NoError(t, second.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = pool.New("sha256:cc", img, img.size).Path(ctx, "veinmind-av")
+	assert.Error(t, err)
+}
+
+func TestExpired(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{DirPrefix + "a", "other"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, name), 0755))
+		require.NoError(t, os.Chtimes(filepath.Join(dir, name), old, old))
+	}
+
+	items, err := Expired(dir, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, filepath.Join(dir, DirPrefix+"a"), items[0].Path)
+}
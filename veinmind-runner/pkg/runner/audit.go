@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/audit"
+	"github.com/pkg/errors"
+	"os/exec"
+	"time"
+)
+
+// recordAudit appends execution of plugin for image to audit log if
+// runner has one, failure to record is logged without failing the scan
+func (r *Runner) recordAudit(plug *plugin.Plugin, c *plugin.Command, imageID string, start time.Time, err error) {
+	if r.Audit == nil {
+		return
+	}
+
+	e := audit.Entry{
+		Plugin:     plug.Name,
+		PluginPath: plug.Path,
+		Command:    c.Path,
+		Args:       []string{imageID},
+		ImageID:    imageID,
+		Start:      start,
+		End:        time.Now(),
+		ExitCode:   exitCode(err),
+	}
+	if img := r.Reporter.Image(imageID); img != nil {
+		e.ImageDigest = img.Digest
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if err := r.Audit.Record(e); err != nil {
+		log.Errorf("Record audit of plugin %#v: %s\n", plug.Name, err.Error())
+	}
+}
+
+// exitCode returns exit status of plugin process, -1 if it isn't known
+// from err
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
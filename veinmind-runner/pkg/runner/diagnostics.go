@@ -0,0 +1,81 @@
+package runner
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go/plugin"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/diagnostics"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// DefaultDiagnosticsKeep is number of diagnostics bundles kept by default
+const DefaultDiagnosticsKeep = 20
+
+// withDiagnostics records plugin process into rec
+func withDiagnostics(rec *diagnostics.Recorder) plugin.ExecOption {
+	return plugin.WithPrepareExec(func(ctx context.Context, cmd *exec.Cmd) (func(error) error, error) {
+		rec.Prepare(cmd)
+		return nil, nil
+	})
+}
+
+// diagnosticsDir returns where diagnostics bundles are written, which
+// is under work dir unless DiagnosticsDir is set
+func (r *Runner) diagnosticsDir() string {
+	if r.DiagnosticsDir != "" {
+		return r.DiagnosticsDir
+	}
+	return DefaultDiagnosticsDir(r.WorkDir)
+}
+
+// DefaultDiagnosticsDir returns where diagnostics bundles are written
+// under work dir, temporary directory is used if it's empty
+func DefaultDiagnosticsDir(workDir string) string {
+	if workDir == "" {
+		workDir = os.TempDir()
+	}
+	return filepath.Join(workDir, "veinmind-diagnostics")
+}
+
+// diagnose writes diagnostics bundle of plugin exiting abnormally and
+// returns its path, which is referenced by coverage of the execution
+func (r *Runner) diagnose(rec *diagnostics.Recorder, plug *plugin.Plugin, c *plugin.Command, imageID string, err error) string {
+	if !diagnostics.Abnormal(err) {
+		return ""
+	}
+
+	b := rec.Bundle(err)
+	b.Plugin = plug.Name
+	b.PluginPath = plug.Path
+	b.Command = c.Path
+	b.ImageID = imageID
+	if img := r.Reporter.Image(imageID); img != nil {
+		b.ImageDigest = img.Digest
+	}
+	b.Runner = diagnostics.Runner{
+		PID:     os.Getpid(),
+		Threads: r.threads,
+		Uptime:  time.Since(r.started).Round(time.Second).String(),
+	}
+	b.Runner.Host, _ = os.Hostname()
+
+	dir := r.diagnosticsDir()
+	bundle, werr := rec.Write(dir, b)
+	if werr != nil {
+		log.Errorf("Write diagnostics of plugin %#v error: %s\n", plug.Name, werr.Error())
+	} else {
+		log.Warnf("Plugin %#v exited abnormally: %s, diagnostics: %#v\n", plug.Name, err.Error(), bundle)
+	}
+
+	keep := r.DiagnosticsKeep
+	if keep <= 0 {
+		keep = DefaultDiagnosticsKeep
+	}
+	if err := diagnostics.Prune(dir, keep); err != nil {
+		log.Errorf("Prune diagnostics %#v error: %s\n", dir, err.Error())
+	}
+	return bundle
+}
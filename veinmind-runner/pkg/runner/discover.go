@@ -0,0 +1,147 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"github.com/chaitin/libveinmind/go/plugin"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/compat"
+	"github.com/pkg/errors"
+	"path/filepath"
+	"strings"
+)
+
+// DiscoverOptions selects plugins to discover, plugins are discovered
+// under working directory if Dir is empty
+type DiscoverOptions struct {
+	Dir   string
+	Glob  string
+	Names []string
+	// AllowEmpty allows no plugin to be discovered
+	AllowEmpty bool
+	// StrictCompat fails discovery if any plugin has incompatible API
+	// version, otherwise such plugins are skipped
+	StrictCompat bool
+}
+
+// Incompatible is a plugin skipped for incompatible API version
+type Incompatible struct {
+	Plugin string
+	Path   string
+	compat.Result
+}
+
+// NoPluginError is returned when no plugin is discovered, it carries
+// where plugins are searched
+type NoPluginError struct {
+	Dir   string
+	Glob  string
+	Names []string
+}
+
+func (e *NoPluginError) Error() string {
+	searched := []string{fmt.Sprintf("directory %s", e.Dir)}
+	if e.Glob != "" {
+		searched = append(searched, fmt.Sprintf("glob %#v", e.Glob))
+	}
+	if len(e.Names) > 0 {
+		searched = append(searched, fmt.Sprintf("plugins %s", strings.Join(e.Names, ",")))
+	}
+	return fmt.Sprintf("no plugin discovered (searched %s), run from the directory of plugins "+
+		"or pass --allow-no-plugins", strings.Join(searched, ", "))
+}
+
+// Discover discovers plugins, an error is returned if none is found
+// unless empty result is allowed. Plugins with incompatible API version
+// are skipped and returned
+func Discover(ctx context.Context, opts DiscoverOptions) ([]*plugin.Plugin, []Incompatible, error) {
+	dir := opts.Dir
+	if dir == "" {
+		dir = "."
+	}
+
+	var (
+		ps  []*plugin.Plugin
+		err error
+	)
+	if opts.Glob != "" {
+		ps, err = plugin.DiscoverPlugins(ctx, dir, plugin.WithGlob(opts.Glob))
+	} else {
+		ps, err = plugin.DiscoverPlugins(ctx, dir)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	ps = selectPlugins(ps, opts.Names)
+
+	ps, incompatible := checkCompat(ps)
+	for _, i := range incompatible {
+		log.Warnf("!!! Skip incompatible plugin %#v (%s): %s\n", i.Plugin, i.Path, i.Reason)
+	}
+	if opts.StrictCompat && len(incompatible) > 0 {
+		names := []string{}
+		for _, i := range incompatible {
+			names = append(names, i.Plugin)
+		}
+		return nil, nil, errors.Errorf("incompatible plugins: %s", strings.Join(names, ","))
+	}
+
+	if len(ps) == 0 {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			abs = dir
+		}
+		noPlugin := &NoPluginError{Dir: abs, Glob: opts.Glob, Names: opts.Names}
+		if !opts.AllowEmpty {
+			return nil, incompatible, noPlugin
+		}
+		log.Warn(noPlugin.Error())
+	}
+
+	for _, p := range ps {
+		log.Infof("Discovered plugin: %#v\n", p.Name)
+	}
+	return ps, incompatible, nil
+}
+
+// checkCompat splits plugins by compatibility of their API version
+func checkCompat(ps []*plugin.Plugin) ([]*plugin.Plugin, []Incompatible) {
+	compatible := []*plugin.Plugin{}
+	var incompatible []Incompatible
+	for _, p := range ps {
+		r := compat.Check(p.ManifestVersion)
+		if r.Compatible() {
+			compatible = append(compatible, p)
+			continue
+		}
+		incompatible = append(incompatible, Incompatible{Plugin: p.Name, Path: p.Path, Result: r})
+	}
+	return compatible, incompatible
+}
+
+// selectPlugins returns plugins of names, all plugins are returned if
+// no name is specified
+func selectPlugins(ps []*plugin.Plugin, names []string) []*plugin.Plugin {
+	if len(names) == 0 {
+		return ps
+	}
+
+	selected := []*plugin.Plugin{}
+	found := map[string]bool{}
+	for _, p := range ps {
+		for _, name := range names {
+			if p.Name == name {
+				selected = append(selected, p)
+				found[name] = true
+				break
+			}
+		}
+	}
+
+	for _, name := range names {
+		if !found[name] {
+			log.Warnf("Plugin not found: %#v\n", name)
+		}
+	}
+	return selected
+}
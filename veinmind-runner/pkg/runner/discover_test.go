@@ -0,0 +1,44 @@
+package runner
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/compat"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSelectPlugins(t *testing.T) {
+	ps := []*plugin.Plugin{
+		{Manifest: plugin.Manifest{Name: "veinmind-weakpass"}},
+		{Manifest: plugin.Manifest{Name: "veinmind-malicious"}},
+	}
+
+	assert.Equal(t, ps, selectPlugins(ps, nil))
+	assert.Equal(t, ps[1:], selectPlugins(ps, []string{"veinmind-malicious", "veinmind-typo"}))
+	assert.Empty(t, selectPlugins(ps, []string{"veinmind-typo"}))
+}
+
+func TestCheckCompat(t *testing.T) {
+	ps := []*plugin.Plugin{
+		{Manifest: plugin.Manifest{Name: "veinmind-weakpass", ManifestVersion: compat.MinAPIVersion}},
+		{Manifest: plugin.Manifest{Name: "veinmind-legacy"}, Path: "plugins/veinmind-legacy"},
+		{Manifest: plugin.Manifest{Name: "veinmind-future", ManifestVersion: compat.MaxAPIVersion + 1}},
+	}
+
+	compatible, incompatible := checkCompat(ps)
+	assert.Equal(t, ps[:1], compatible)
+	assert.Len(t, incompatible, 2)
+	assert.Equal(t, "veinmind-legacy", incompatible[0].Plugin)
+	assert.Equal(t, "plugins/veinmind-legacy", incompatible[0].Path)
+	assert.Equal(t, compat.StatusTooOld, incompatible[0].Status)
+	assert.Equal(t, compat.StatusTooNew, incompatible[1].Status)
+}
+
+func TestNoPluginError(t *testing.T) {
+	err := &NoPluginError{Dir: "/opt/veinmind", Glob: "**/veinmind-weak*", Names: []string{"veinmind-weakpass"}}
+	assert.Equal(t, `no plugin discovered (searched directory /opt/veinmind, glob "**/veinmind-weak*", `+
+		`plugins veinmind-weakpass), run from the directory of plugins or pass --allow-no-plugins`, err.Error())
+
+	err = &NoPluginError{Dir: "/opt/veinmind"}
+	assert.Contains(t, err.Error(), "(searched directory /opt/veinmind)")
+}
@@ -0,0 +1,132 @@
+package runner
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/scope"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layercache"
+	"sync"
+	"time"
+)
+
+// mergedViewService tells whether plugin execution has been served the
+// merged filesystem of image, e.g. by the walk service. Files of layers
+// may be hidden by those above in it, so events of the execution can't
+// be cached per layer
+type mergedViewService interface {
+	MergedView() bool
+}
+
+// layerScan is scan of image by a layer-local plugin through the layer
+// cache, the plugin is scoped to layers not cached and events of cached
+// layers are replayed after it
+type layerScan struct {
+	cache   *layercache.Cache
+	plugin  string
+	version string
+	imageID string
+	plan    layercache.Plan
+	scope   *scope.ScopeService
+	locate  layercache.Locator
+	mu      sync.Mutex
+	events  []layercache.Event
+}
+
+// newLayerScan plans scan of image by plugin through layer cache, scope
+// service of services is replaced by one of layers to scan. Nil is
+// returned if events of plugin aren't cached
+func (r *Runner) newLayerScan(plug *plugin.Plugin, imageID string, o *scanOption, services []Service) (*layerScan, []Service) {
+	if r.LayerCache == nil || o.layers == nil || o.locate == nil || !layercache.LayerLocal(plug.Tags) {
+		return nil, services
+	}
+	// Processes of pool outlive scans and aren't scoped by them
+	if plug.Version == "" || (r.Pool != nil && supportsPool(plug)) {
+		return nil, services
+	}
+
+	s := &layerScan{
+		cache:   r.LayerCache,
+		plugin:  plug.Name,
+		version: plug.Version,
+		imageID: imageID,
+		plan:    r.LayerCache.Plan(plug.Name, plug.Version, o.layers),
+		locate:  o.locate,
+	}
+	s.scope = scope.NewScopeService(imageID, s.plan.Scan)
+
+	scoped := []Service{}
+	for _, svc := range services {
+		if _, ok := svc.(*scope.ScopeService); !ok {
+			scoped = append(scoped, svc)
+		}
+	}
+	return s, append(scoped, s.scope)
+}
+
+// skip reports whether all layers are cached, so that plugin needn't be
+// executed at all
+func (s *layerScan) skip() bool {
+	return len(s.plan.Scan) == 0
+}
+
+// record keeps event reported by plugin for caching
+func (s *layerScan) record(evt reportedEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, layercache.Event{Event: evt.ReportEvent, Level: evt.level})
+}
+
+// finish caches events of layers scanned and replays events of cached
+// layers into report of plugin. Plugins which haven't queried the scope
+// service scanned the whole image, events of cached layers are among
+// theirs and aren't replayed
+func (s *layerScan) finish(pluginReport *pluginReportService, services []Service, err error) {
+	// Plugin not executed is scoped to layers of image by cache
+	if s.skip() {
+		s.scope.Layers(s.imageID)
+	}
+	scoped := s.scope.Queried()
+	if err == nil {
+		s.store(scoped, services)
+	}
+	if !scoped {
+		return
+	}
+
+	s.cache.Avoided(len(s.plan.Cached))
+	for _, e := range layercache.Assemble(s.imageID, s.plan.Layers, s.plan.Cached, time.Now()) {
+		pluginReport.report(reportedEvent{ReportEvent: e.Event, level: e.Level})
+	}
+}
+
+// store caches events of layers scanned, events which can't be told
+// which layer they're of leave the execution uncached
+func (s *layerScan) store(scoped bool, services []Service) {
+	if s.skip() {
+		return
+	}
+	for _, svc := range services {
+		if m, ok := svc.(mergedViewService); ok && m.MergedView() {
+			s.cache.Uncacheable()
+			return
+		}
+	}
+
+	scanned := s.plan.Scan
+	if !scoped {
+		scanned = s.plan.Layers
+	}
+	s.mu.Lock()
+	events := s.events
+	s.mu.Unlock()
+
+	results, err := layercache.Attribute(events, scanned, s.locate)
+	if err != nil {
+		log.Debugf("Events of plugin %s aren't cached: %s\n", s.plugin, err)
+		s.cache.Uncacheable()
+		return
+	}
+	if err := s.cache.Store(s.plugin, s.version, results); err != nil {
+		log.Warnf("Cache events of plugin %s: %s\n", s.plugin, err)
+	}
+}
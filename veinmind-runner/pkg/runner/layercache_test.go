@@ -0,0 +1,158 @@
+package runner
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/scope"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layercache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type mergedView bool
+
+func (m mergedView) MergedView() bool {
+	return bool(m)
+}
+
+func (m mergedView) Add(registry *service.Registry) {}
+
+func malicious(imageID string, path string) reportedEvent {
+	return reportedEvent{
+		ReportEvent: report.ReportEvent{
+			ID:        imageID,
+			Level:     report.High,
+			AlertType: report.MaliciousFile,
+			AlertDetails: []report.AlertDetail{{
+				MaliciousFileDetail: &report.MaliciousFileDetail{FileDetail: report.FileDetail{Path: path}},
+			}},
+		},
+		level: "high",
+	}
+}
+
+// scanLayers scans image of layers with plugin through layer cache as
+// runner does, files are found in layers by their paths
+func scanLayers(t *testing.T, r *Runner, plug *plugin.Plugin, imageID string, layers []string, files map[string][]string, extra ...Service) []report.ReportEvent {
+	sent := []report.ReportEvent{}
+	pluginReport := &pluginReportService{
+		send:   func(evt report.ReportEvent) { sent = append(sent, evt) },
+		plugin: plug.Name,
+	}
+	o := &scanOption{layers: layers, locate: func(evt report.ReportEvent) []string {
+		located := []string{}
+		for _, d := range evt.AlertDetails {
+			located = append(located, files[d.MaliciousFileDetail.Path]...)
+		}
+		return located
+	}}
+
+	s, services := r.newLayerScan(plug, imageID, o, append([]Service{scope.NewScopeService(imageID, layers)}, extra...))
+	require.NotNil(t, s)
+	pluginReport.record = s.record
+	if !s.skip() {
+		// Plugin scans layers in scope served to it
+		var svc *scope.ScopeService
+		for _, v := range services {
+			if v, ok := v.(*scope.ScopeService); ok {
+				assert.Nil(t, svc, "scope service is replaced")
+				svc = v
+			}
+		}
+		scoped, err := svc.Layers(imageID)
+		require.NoError(t, err)
+		for path, holders := range files {
+			for _, l := range holders {
+				if contains(scoped, l) {
+					pluginReport.Report(malicious(imageID, path))
+					break
+				}
+			}
+		}
+	}
+	s.finish(pluginReport, services, nil)
+	pluginReport.flush(imageID)
+	return sent
+}
+
+func paths(events []report.ReportEvent) []string {
+	ps := []string{}
+	for _, evt := range events {
+		ps = append(ps, evt.ID+":"+evt.AlertDetails[0].MaliciousFileDetail.Path)
+	}
+	return ps
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNewLayerScan(t *testing.T) {
+	cache, err := layercache.Open("")
+	require.NoError(t, err)
+	r := &Runner{LayerCache: cache}
+	o := &scanOption{layers: []string{"a"}, locate: func(report.ReportEvent) []string { return nil }}
+	plug := &plugin.Plugin{Manifest: plugin.Manifest{Name: "veinmind-malicious", Version: "1.0", Tags: []string{layercache.Tag}}}
+
+	s, _ := r.newLayerScan(plug, "sha256:aa", o, nil)
+	assert.NotNil(t, s)
+
+	// Plugins not layer-local, without version, images without layers
+	// and runners without cache aren't cached
+	for _, p := range []*plugin.Plugin{
+		{Manifest: plugin.Manifest{Name: "veinmind-history", Version: "1.0"}},
+		{Manifest: plugin.Manifest{Name: "veinmind-malicious", Tags: []string{layercache.Tag}}},
+	} {
+		s, _ := r.newLayerScan(p, "sha256:aa", o, nil)
+		assert.Nil(t, s)
+	}
+	s, _ = r.newLayerScan(plug, "sha256:aa", &scanOption{}, nil)
+	assert.Nil(t, s)
+	s, _ = (&Runner{}).newLayerScan(plug, "sha256:aa", o, nil)
+	assert.Nil(t, s)
+}
+
+func TestLayerScan(t *testing.T) {
+	cache, err := layercache.Open("")
+	require.NoError(t, err)
+	r := &Runner{LayerCache: cache}
+	plug := &plugin.Plugin{Manifest: plugin.Manifest{Name: "veinmind-malicious", Version: "1.0", Tags: []string{layercache.Tag}}}
+	files := map[string][]string{"/bin/x": {"a"}, "/bin/y": {"c"}}
+
+	sent := scanLayers(t, r, plug, "sha256:base", []string{"a", "b"}, files)
+	assert.Equal(t, []string{"sha256:base:/bin/x"}, paths(sent))
+
+	// Image built on base only scans its own layer
+	sent = scanLayers(t, r, plug, "sha256:app", []string{"a", "b", "c"}, files)
+	assert.ElementsMatch(t, []string{"sha256:app:/bin/y", "sha256:app:/bin/x"}, paths(sent))
+	assert.Equal(t, layercache.Stats{Hits: 2, Misses: 3, Avoided: 2}, cache.Stats())
+
+	// Image of cached layers isn't scanned at all
+	sent = scanLayers(t, r, plug, "sha256:retag", []string{"a", "b", "c"}, files)
+	assert.ElementsMatch(t, []string{"sha256:retag:/bin/y", "sha256:retag:/bin/x"}, paths(sent))
+	assert.Equal(t, int64(5), cache.Stats().Avoided)
+}
+
+func TestLayerScanUncacheable(t *testing.T) {
+	cache, err := layercache.Open("")
+	require.NoError(t, err)
+	r := &Runner{LayerCache: cache}
+	plug := &plugin.Plugin{Manifest: plugin.Manifest{Name: "veinmind-malicious", Version: "1.0", Tags: []string{layercache.Tag}}}
+
+	// File of both layers can't be told which layer it's found in
+	scanLayers(t, r, plug, "sha256:aa", []string{"a", "b"}, map[string][]string{"/bin/x": {"a", "b"}})
+	// Plugin walking merged filesystem may miss files hidden above
+	scanLayers(t, r, plug, "sha256:bb", []string{"c"}, map[string][]string{"/bin/x": {"c"}}, mergedView(true))
+	assert.Equal(t, layercache.Stats{Misses: 3, Uncacheable: 2}, cache.Stats())
+
+	sent := scanLayers(t, r, plug, "sha256:cc", []string{"a", "c"}, map[string][]string{"/bin/x": {"a"}})
+	assert.Equal(t, []string{"sha256:cc:/bin/x"}, paths(sent))
+	assert.Equal(t, int64(0), cache.Stats().Avoided)
+}
@@ -0,0 +1,124 @@
+package runner
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SampleDetails is number of details of suppressed events kept in the
+// aggregated event
+const SampleDetails = 5
+
+// EventLimits limits events kept of each plugin execution, zero means
+// unlimited
+type EventLimits struct {
+	Default int
+	Plugins map[string]int
+}
+
+// Limit returns event limit of plugin
+func (l EventLimits) Limit(plugin string) int {
+	if n, ok := l.Plugins[plugin]; ok {
+		return n
+	}
+	return l.Default
+}
+
+// ParseEventLimits parses values of name=N into limits of plugins, a
+// bare N is the default limit of all plugins
+func ParseEventLimits(values []string) (EventLimits, error) {
+	limits := EventLimits{Plugins: map[string]int{}}
+	for _, v := range values {
+		name, value := "", v
+		if i := strings.LastIndex(v, "="); i >= 0 {
+			name, value = v[:i], v[i+1:]
+			if name == "" {
+				return EventLimits{}, errors.Errorf("invalid event limit %#v, expect name=N or N", v)
+			}
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return EventLimits{}, errors.Errorf("invalid event limit %#v, expect name=N or N", v)
+		}
+		if name == "" {
+			limits.Default = n
+		} else {
+			limits.Plugins[name] = n
+		}
+	}
+	return limits, nil
+}
+
+// buffer keeps event of plugin with limit until the execution ends, it
+// returns false if event should be sent right away
+func (s *pluginReportService) buffer(evt report.ReportEvent) bool {
+	if s.limit <= 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.flushed {
+		return false
+	}
+	s.buffered = append(s.buffered, evt)
+	return true
+}
+
+// flush sends the most severe events within limit after execution of
+// plugin, the others are collapsed into an aggregated event carrying
+// the most severe level and a sample of their details
+func (s *pluginReportService) flush(imageID string) {
+	s.mu.Lock()
+	events := s.buffered
+	s.buffered = nil
+	s.flushed = true
+	s.mu.Unlock()
+
+	if len(events) <= s.limit {
+		for _, evt := range events {
+			s.send(evt)
+		}
+		return
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return reporter.LevelRank(events[i].Level) > reporter.LevelRank(events[j].Level)
+	})
+	for _, evt := range events[:s.limit] {
+		s.send(evt)
+	}
+
+	rest := events[s.limit:]
+	aggregated := report.ReportEvent{
+		ID:         imageID,
+		Time:       time.Now(),
+		Level:      rest[0].Level,
+		DetectType: rest[0].DetectType,
+		EventType:  rest[0].EventType,
+		AlertType:  rest[0].AlertType,
+	}
+	for _, evt := range rest {
+		if len(aggregated.AlertDetails) >= SampleDetails {
+			break
+		}
+		if len(evt.AlertDetails) > 0 {
+			aggregated.AlertDetails = append(aggregated.AlertDetails, evt.AlertDetails[0])
+		}
+	}
+
+	s.suppress(reporter.Suppression{
+		ImageID:    imageID,
+		Plugin:     s.plugin,
+		Limit:      s.limit,
+		Total:      len(events),
+		Suppressed: len(rest),
+		Monitor:    s.monitor,
+	}, aggregated)
+}
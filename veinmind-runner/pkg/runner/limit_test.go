@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestParseEventLimits(t *testing.T) {
+	limits, err := ParseEventLimits([]string{"100", "veinmind-sensitive=10", "veinmind-backdoor=0"})
+	assert.NoError(t, err)
+	assert.Equal(t, 10, limits.Limit("veinmind-sensitive"))
+	assert.Equal(t, 0, limits.Limit("veinmind-backdoor"))
+	assert.Equal(t, 100, limits.Limit("veinmind-weakpass"))
+
+	for _, v := range []string{"=1", "veinmind-sensitive=", "veinmind-sensitive=-1", "many"} {
+		_, err := ParseEventLimits([]string{v})
+		assert.Error(t, err, v)
+	}
+}
+
+func TestPluginReportLimit(t *testing.T) {
+	sent := []report.ReportEvent{}
+	var (
+		suppression reporter.Suppression
+		aggregated  report.ReportEvent
+	)
+	s := &pluginReportService{
+		send:   func(evt report.ReportEvent) { sent = append(sent, evt) },
+		plugin: "veinmind-sensitive",
+		limit:  2,
+		suppress: func(s reporter.Suppression, evt report.ReportEvent) {
+			suppression, aggregated = s, evt
+		},
+	}
+
+	levels := []report.Level{report.Low, report.None, report.High, report.Medium, report.Critical, report.Low, report.Medium}
+	for i, l := range levels {
+		s.forward(report.ReportEvent{
+			ID:           "sha256:aa",
+			Level:        l,
+			AlertType:    report.Sensitive,
+			AlertDetails: []report.AlertDetail{{SensitiveFileDetail: &report.SensitveFileDetail{}}},
+		})
+		assert.Empty(t, sent, strconv.Itoa(i))
+	}
+	s.flush("sha256:aa")
+
+	assert.Equal(t, int64(7), s.Count())
+	assert.Len(t, sent, 2)
+	assert.Equal(t, report.Critical, sent[0].Level)
+	assert.Equal(t, report.High, sent[1].Level)
+	assert.Equal(t, reporter.Suppression{
+		ImageID:    "sha256:aa",
+		Plugin:     "veinmind-sensitive",
+		Limit:      2,
+		Total:      7,
+		Suppressed: 5,
+	}, suppression)
+	assert.Equal(t, report.Medium, aggregated.Level)
+	assert.Equal(t, report.Sensitive, aggregated.AlertType)
+	assert.Len(t, aggregated.AlertDetails, SampleDetails)
+
+	// Events reported after flush, e.g. by pooled process of a canceled
+	// scan, aren't held back
+	s.forward(report.ReportEvent{ID: "sha256:aa"})
+	assert.Len(t, sent, 3)
+}
+
+func TestPluginReportWithinLimit(t *testing.T) {
+	sent := 0
+	s := &pluginReportService{
+		send:  func(evt report.ReportEvent) { sent++ },
+		limit: 3,
+		suppress: func(s reporter.Suppression, evt report.ReportEvent) {
+			t.Fatal("events within limit are suppressed")
+		},
+	}
+	for i := 0; i < 3; i++ {
+		s.forward(report.ReportEvent{})
+	}
+	s.flush("sha256:aa")
+	assert.Equal(t, 3, sent)
+}
@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"fmt"
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"os"
+	"strings"
+	"time"
+)
+
+// reasons why an image can't be opened
+const (
+	// ReasonTransient is an error which persists through retries
+	ReasonTransient = "transient"
+	// ReasonRemoved is an image removed while it's being scanned
+	ReasonRemoved = "removed"
+	// ReasonCorrupted is an image whose layers are missing or corrupted
+	ReasonCorrupted = "corrupted"
+)
+
+// ImageLister opens images and lists ids of images, it's satisfied by
+// api.Runtime
+type ImageLister interface {
+	OpenImageByID(id string) (api.Image, error)
+	ListImageIDs() ([]string, error)
+}
+
+// OpenError reports an image which can't be opened and why
+type OpenError struct {
+	ID     string
+	Reason string
+	Err    error
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("open image %s (%s): %s", e.ID, e.Reason, e.Err.Error())
+}
+
+func (e *OpenError) Unwrap() error {
+	return e.Err
+}
+
+// OpenImage opens image with bounded retries, failures are categorized
+// by whether the image is still listed by runtime and whether files of
+// the image are missing
+func OpenImage(rt ImageLister, id string, attempts int, backoff time.Duration) (api.Image, error) {
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			log.Warnf("Retry opening image %#v: %s\n", id, err.Error())
+			time.Sleep(time.Duration(i) * backoff)
+		}
+
+		var image api.Image
+		image, err = rt.OpenImageByID(id)
+		if err == nil {
+			return image, nil
+		}
+		if !listed(rt, id) {
+			return nil, &OpenError{ID: id, Reason: ReasonRemoved, Err: err}
+		}
+	}
+
+	reason := ReasonTransient
+	if missing(err) {
+		reason = ReasonCorrupted
+	}
+	return nil, &OpenError{ID: id, Reason: reason, Err: err}
+}
+
+func listed(rt ImageLister, id string) bool {
+	ids, err := rt.ListImageIDs()
+	if err != nil {
+		// Runtime is unreachable, assume the image is still there
+		return true
+	}
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// missing reports whether err is caused by missing files, errors of
+// libveinmind aren't wrapped with os errors so messages are checked too
+func missing(err error) bool {
+	if os.IsNotExist(err) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "no such file") || strings.Contains(msg, "not found")
+}
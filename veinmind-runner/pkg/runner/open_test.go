@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"github.com/chaitin/libveinmind/go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type fakeLister struct {
+	errs  []error
+	ids   []string
+	opens int
+}
+
+func (f *fakeLister) OpenImageByID(id string) (api.Image, error) {
+	f.opens++
+	if len(f.errs) == 0 {
+		return nil, nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return nil, err
+}
+
+func (f *fakeLister) ListImageIDs() ([]string, error) {
+	return f.ids, nil
+}
+
+func TestOpenImage(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		lister *fakeLister
+		reason string
+		opens  int
+	}{
+		{
+			name:   "retried",
+			lister: &fakeLister{errs: []error{errors.New("device busy")}, ids: []string{"sha256:aa"}},
+			opens:  2,
+		},
+		{
+			name:   "transient",
+			lister: &fakeLister{errs: []error{errors.New("busy"), errors.New("busy"), errors.New("busy")}, ids: []string{"sha256:aa"}},
+			reason: ReasonTransient,
+			opens:  3,
+		},
+		{
+			name:   "removed",
+			lister: &fakeLister{errs: []error{errors.New("busy")}},
+			reason: ReasonRemoved,
+			opens:  1,
+		},
+		{
+			name: "corrupted",
+			lister: &fakeLister{errs: []error{
+				errors.New("open /var/lib/docker/overlay2/aa/diff: no such file or directory"),
+				errors.New("open /var/lib/docker/overlay2/aa/diff: no such file or directory"),
+				errors.New("open /var/lib/docker/overlay2/aa/diff: no such file or directory"),
+			}, ids: []string{"sha256:aa"}},
+			reason: ReasonCorrupted,
+			opens:  3,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := OpenImage(tc.lister, "sha256:aa", 3, 0)
+			assert.Equal(t, tc.opens, tc.lister.opens)
+			if tc.reason == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var openErr *OpenError
+			assert.True(t, errors.As(err, &openErr))
+			assert.Equal(t, tc.reason, openErr.Reason)
+		})
+	}
+}
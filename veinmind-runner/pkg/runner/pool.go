@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go/plugin"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/pool"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/diagnostics"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/pluginpool"
+	"path"
+	"time"
+)
+
+// supportsPool reports whether plugin advertises pool support
+func supportsPool(plug *plugin.Plugin) bool {
+	for _, tag := range plug.Tags {
+		if tag == pool.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// scanPooled scans image with a warm process of plugin, a process is
+// started by next for the image if none is idle. Process started
+// outlives the scan, so it's bound to services of pool instead of those
+// of the scan, and its events are sent to the scan it's scanning
+func (r *Runner) scanPooled(ctx context.Context, plug *plugin.Plugin, c *plugin.Command,
+	next func(context.Context, ...plugin.ExecOption) error, imageID string, pluginReport *pluginReportService, soft bool) error {
+	return r.Pool.Scan(ctx, plug.Name, []string{imageID}, pluginReport.forward,
+		func(ctx context.Context, ids []string, services *pluginpool.Services) error {
+			reg := service.NewRegistry()
+			reg.AddServices(log.WithFields(log.Fields{
+				"plugin":  plug.Name,
+				"command": path.Join(c.Path...),
+				"pooled":  true,
+			}))
+			reg.AddServices(&pluginReportService{
+				send:      services.Report,
+				plugin:    plug.Name,
+				normalize: r.Reporter.Normalize,
+			})
+			reg.AddServices(services.Pool)
+
+			dir, err := newWorkDir(r.WorkDir, plug.Name)
+			if err != nil {
+				return err
+			}
+			env := append([]string{WorkDirEnv + "=" + dir}, r.PluginEnv[plug.Name]...)
+
+			log.Infof("Start pooled plugin %#v\n", plug.Name)
+			start := time.Now()
+			rec := diagnostics.NewRecorder(diagnostics.DefaultTailSize)
+			err = next(ctx, reg.Bind(), withPluginEnv(env), withPluginDir(dir), withDiagnostics(rec))
+			r.recordAudit(plug, c, imageID, start, err)
+			bundle := r.diagnose(rec, plug, c, imageID, err)
+			r.recordFailure(imageID, plug.Name, soft, err, bundle, "")
+			removeWorkDir(dir, err, r.KeepFailedWorkDirs)
+			log.Infof("Pooled plugin %#v exited\n", plug.Name)
+			return err
+		})
+}
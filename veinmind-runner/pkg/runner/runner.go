@@ -0,0 +1,438 @@
+// Package runner scans images with plugins and collects reported
+// events, it's shared by scan commands and server mode
+package runner
+
+import (
+	"context"
+	"fmt"
+	"github.com/chaitin/libveinmind/go"
+	"github.com/chaitin/libveinmind/go/cmd"
+	"github.com/chaitin/libveinmind/go/plugin"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/audit"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/budget"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/diagnostics"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/layercache"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/pluginlog"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/pluginpool"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/schedule"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/trace"
+	"path"
+	"sync"
+	"time"
+)
+
+// Service is registered into service registry of plugin execution
+type Service interface {
+	Add(registry *service.Registry)
+}
+
+type Runner struct {
+	Plugins       []*plugin.Plugin
+	Reporter      *reporter.Reporter
+	ReportService *report.ReportService
+	// WorkDir is where isolated working directories of plugin
+	// executions are created, temporary directory is used if empty
+	WorkDir string
+	// KeepFailedWorkDirs keeps working directories of failed plugin
+	// executions for debugging
+	KeepFailedWorkDirs bool
+	// PluginEnv is extra environment variables of each plugin
+	PluginEnv map[string][]string
+	// ImageTimeout is time budget of scanning an image shared by its
+	// plugins, zero means unlimited
+	ImageTimeout time.Duration
+	// Timings are durations of plugin executions, historically fast
+	// plugins run first and budget is weighted by them
+	Timings *budget.Timings
+	// EventLimits limits events kept of each plugin execution
+	EventLimits EventLimits
+	// Pool keeps processes of plugins supporting pool warm between
+	// scans, it's shared by runners of server mode
+	Pool *pluginpool.Pool
+	// Audit records every plugin execution if set
+	Audit *audit.Log
+	// DiagnosticsDir is where bundles of plugins exiting abnormally are
+	// written, a directory under WorkDir is used if empty. Only the
+	// latest DiagnosticsKeep bundles are kept
+	DiagnosticsDir  string
+	DiagnosticsKeep int
+	// Output receives stdout and stderr of plugin processes prefixed
+	// by plugin and image, processes inherit those of runner if nil
+	Output *pluginlog.Output
+	// Monitor is plugins in monitor mode, whose events are reported as
+	// monitor-only and never fail the scan
+	Monitor map[string]struct{}
+	// SoftFail is plugins whose failures are recorded as soft-failed
+	// and never fail the scan, plugins declaring SoftFailTag are soft
+	// as well
+	SoftFail SoftFail
+	// Classes schedules plugin executions in pools of their concurrency
+	// classes instead of a single pool of threads if set
+	Classes *schedule.Pools
+	// LayerCache caches events of layer-local plugins per layer, so
+	// that they only scan layers of image not cached if set
+	LayerCache *layercache.Cache
+	threads    int
+	started    time.Time
+	closeOnce  sync.Once
+	closeCh    chan struct{}
+	doneCh     chan struct{}
+}
+
+type scanOption struct {
+	services  func(plug *plugin.Plugin) []Service
+	afterExec func(plug *plugin.Plugin, services []Service, events int64, err error)
+	skip      map[string]struct{}
+	threads   int
+	layers    []string
+	locate    layercache.Locator
+}
+
+type ScanOption func(o *scanOption)
+
+// WithServices registers additional services for plugin execution
+func WithServices(fn func(plug *plugin.Plugin) []Service) ScanOption {
+	return func(o *scanOption) {
+		o.services = fn
+	}
+}
+
+// WithAfterExec is called after plugin execution with services
+// registered by WithServices and number of events reported by the plugin
+func WithAfterExec(fn func(plug *plugin.Plugin, services []Service, events int64, err error)) ScanOption {
+	return func(o *scanOption) {
+		o.afterExec = fn
+	}
+}
+
+// WithSkipPlugins skips plugins of names for the image
+func WithSkipPlugins(names []string) ScanOption {
+	return func(o *scanOption) {
+		o.skip = map[string]struct{}{}
+		for _, name := range names {
+			o.skip[name] = struct{}{}
+		}
+	}
+}
+
+// WithThreads executes threads plugins in parallel for the image
+// instead of threads of runner, unless classes are scheduled
+func WithThreads(threads int) ScanOption {
+	return func(o *scanOption) {
+		o.threads = threads
+	}
+}
+
+// WithLayers scans layers of diff ids of image through layer cache,
+// events of plugins are located in layers by locate. Image isn't
+// scanned through layer cache if layers is nil
+func WithLayers(layers []string, locate layercache.Locator) ScanOption {
+	return func(o *scanOption) {
+		o.layers = layers
+		o.locate = locate
+	}
+}
+
+// New creates runner and starts collecting events, runner must be
+// closed to stop collecting
+func New(plugins []*plugin.Plugin, threads int, opts ...reporter.Option) (*Runner, error) {
+	r, err := reporter.NewReporter(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if threads <= 0 {
+		threads = 5
+	}
+
+	runner := &Runner{
+		Plugins:       plugins,
+		Reporter:      r,
+		ReportService: report.NewReportService(),
+		Timings:       budget.NewTimings(),
+		threads:       threads,
+		started:       time.Now(),
+		closeCh:       make(chan struct{}),
+		doneCh:        make(chan struct{}),
+	}
+
+	// Reporter Channel Listen
+	go r.Listen()
+
+	// Event Channel Listen
+	go func() {
+		defer close(runner.doneCh)
+		for {
+			select {
+			case evt := <-runner.ReportService.EventChannel:
+				r.Send(evt)
+			case <-runner.closeCh:
+				return
+			}
+		}
+	}()
+
+	return runner, nil
+}
+
+// ScanImage scans image with plugins
+func (r *Runner) ScanImage(ctx context.Context, image api.Image, opts ...ScanOption) error {
+	o := &scanOption{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	refs, err := image.RepoRefs()
+	ref := ""
+	if err == nil && len(refs) > 0 {
+		ref = refs[0]
+	} else {
+		ref = image.ID()
+	}
+
+	imageCtx, imageSpan := trace.Start(ctx, "scan image",
+		trace.String("image.id", image.ID()), trace.String("image.ref", ref))
+	defer imageSpan.End()
+	if o.threads > 0 {
+		imageSpan.SetAttributes(trace.Int("image.threads", o.threads))
+	}
+
+	plugins := r.Plugins
+	if len(o.skip) > 0 {
+		plugins = []*plugin.Plugin{}
+		for _, p := range r.Plugins {
+			if _, ok := o.skip[p.Name]; !ok {
+				plugins = append(plugins, p)
+			}
+		}
+	}
+	plugins = r.orderPlugins(plugins)
+
+	var b *budget.Budget
+	if r.ImageTimeout > 0 {
+		var cancel context.CancelFunc
+		imageCtx, cancel = context.WithTimeout(imageCtx, r.ImageTimeout)
+		defer cancel()
+
+		deadline, _ := imageCtx.Deadline()
+		b = budget.New(deadline, pluginNames(plugins), r.parallelism(plugins, o.threads), r.Timings)
+	}
+
+	log.Infof("Scan image: %#v\n", ref)
+	if err := cmd.ScanImage(imageCtx, plugins, image,
+		plugin.WithExecInterceptor(func(
+			ctx context.Context, plug *plugin.Plugin, c *plugin.Command,
+			next func(context.Context, ...plugin.ExecOption) error,
+		) error {
+			// Register Service
+			reg := service.NewRegistry()
+			reg.AddServices(log.WithFields(log.Fields{
+				"plugin":  plug.Name,
+				"command": path.Join(c.Path...),
+			}))
+			pluginReport := &pluginReportService{
+				send:      r.ReportService.Report,
+				plugin:    plug.Name,
+				normalize: r.Reporter.Normalize,
+				limit:     r.EventLimits.Limit(plug.Name),
+				suppress:  r.Reporter.AddSuppressed,
+			}
+			if _, ok := r.Monitor[plug.Name]; ok {
+				name := plug.Name
+				pluginReport.monitor = true
+				pluginReport.send = func(evt report.ReportEvent) {
+					r.Reporter.AddMonitored(name, evt)
+				}
+			}
+			reg.AddServices(pluginReport)
+			var services []Service
+			if o.services != nil {
+				services = o.services(plug)
+			}
+			layerScan, services := r.newLayerScan(plug, image.ID(), o, services)
+			if layerScan != nil {
+				pluginReport.record = layerScan.record
+			}
+			for _, s := range services {
+				reg.AddServices(s)
+			}
+
+			soft := r.SoftFail.Soft(plug.Name, plug.Tags)
+			ctx, pluginSpan := trace.Start(ctx, "plugin",
+				trace.String("plugin.name", plug.Name),
+				trace.String("plugin.command", path.Join(c.Path...)),
+				trace.String("image.id", image.ID()))
+			defer pluginSpan.End()
+
+			// Events of all layers are cached, the plugin isn't executed
+			if layerScan != nil && layerScan.skip() {
+				layerScan.finish(pluginReport, services, nil)
+				pluginReport.flush(image.ID())
+				pluginSpan.SetAttributes(trace.Int("events", pluginReport.Count()), trace.Bool("layer_cache.skipped", true))
+				if o.afterExec != nil {
+					o.afterExec(plug, services, pluginReport.Count(), nil)
+				}
+				return nil
+			}
+
+			// Time waiting for slot of class isn't taken from budget
+			if r.Classes != nil {
+				release, wait, err := r.Classes.Acquire(ctx, schedule.Class(plug.Tags))
+				if err != nil {
+					pluginSpan.SetError(err)
+					return err
+				}
+				defer release()
+				pluginSpan.SetAttributes(
+					trace.String("queue.class", r.Classes.Pool(schedule.Class(plug.Tags))),
+					trace.Int("queue.wait_ms", wait.Milliseconds()))
+			}
+
+			// Plugins supporting pool scan with warm processes, others
+			// and those the pool can't take are executed as usual
+			if r.Pool != nil && supportsPool(plug) {
+				err := r.scanPooled(ctx, plug, c, next, image.ID(), pluginReport, soft)
+				if err != pluginpool.ErrUnavailable {
+					pluginReport.flush(image.ID())
+					pluginSpan.SetAttributes(trace.Int("events", pluginReport.Count()))
+					pluginSpan.SetError(err)
+					if o.afterExec != nil {
+						o.afterExec(plug, services, pluginReport.Count(), err)
+					}
+					if soft {
+						return nil
+					}
+					return err
+				}
+			}
+
+			// Plugins running in parallel don't share scratch files
+			dir, err := newWorkDir(r.WorkDir, plug.Name)
+			if err != nil {
+				pluginSpan.SetError(err)
+				return err
+			}
+			env := append(trace.Environ(ctx), WorkDirEnv+"="+dir)
+			env = append(env, r.PluginEnv[plug.Name]...)
+
+			// Plugin is killed when its slice of image budget is used up
+			start := time.Now()
+			var slice time.Duration
+			if b != nil {
+				slice = b.Start(plug.Name, start)
+				defer b.Finish(plug.Name)
+
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, slice)
+				defer cancel()
+				for _, s := range services {
+					if s, ok := s.(deadlineService); ok {
+						s.SetDeadline(start.Add(slice))
+					}
+				}
+			}
+
+			// Next Plugin
+			rec := diagnostics.NewRecorder(diagnostics.DefaultTailSize)
+			execOpts := []plugin.ExecOption{reg.Bind(), withPluginEnv(env), withPluginDir(dir)}
+			var output *pluginlog.Writer
+			if r.Output != nil {
+				output = r.Output.Writer(plug.Name + "/" + ref)
+				execOpts = append(execOpts, withOutput(output))
+			}
+			err = next(ctx, append(execOpts, withDiagnostics(rec))...)
+			if output != nil {
+				output.Close()
+			}
+			r.recordAudit(plug, c, image.ID(), start, err)
+			bundle := r.diagnose(rec, plug, c, image.ID(), err)
+			removeWorkDir(dir, err, r.KeepFailedWorkDirs)
+			if layerScan != nil {
+				layerScan.finish(pluginReport, services, err)
+			}
+			pluginReport.flush(image.ID())
+			elapsed := time.Since(start)
+			r.Timings.Observe(plug.Name, elapsed)
+			overrun := ""
+			if b != nil && elapsed > slice {
+				overrun = fmt.Sprintf("ran %s over budget of %s", elapsed.Round(time.Millisecond), slice.Round(time.Millisecond))
+			}
+			r.recordFailure(image.ID(), plug.Name, soft, err, bundle, overrun)
+			pluginSpan.SetAttributes(trace.Int("events", pluginReport.Count()))
+			pluginSpan.SetError(err)
+			if o.afterExec != nil {
+				o.afterExec(plug, services, pluginReport.Count(), err)
+			}
+			// Failures of soft-fail plugins never fail the scan
+			if soft {
+				return nil
+			}
+			return err
+		}), plugin.WithExecParallelism(r.parallelism(plugins, o.threads))); err != nil {
+		imageSpan.SetError(err)
+		return err
+	}
+	return nil
+}
+
+// parallelism returns number of plugins executed in parallel, threads
+// of image if set, which is limited by pools of classes instead when
+// they're set
+func (r *Runner) parallelism(plugins []*plugin.Plugin, threads int) int {
+	if r.Classes != nil && len(plugins) > 0 {
+		return len(plugins)
+	}
+	if threads > 0 {
+		return threads
+	}
+	return r.threads
+}
+
+// deadlineService is told the deadline of plugin execution
+type deadlineService interface {
+	SetDeadline(deadline time.Time)
+}
+
+// orderPlugins orders plugins so that historically fast ones run first
+func (r *Runner) orderPlugins(plugins []*plugin.Plugin) []*plugin.Plugin {
+	byName := map[string][]*plugin.Plugin{}
+	for _, p := range plugins {
+		byName[p.Name] = append(byName[p.Name], p)
+	}
+
+	ordered := []*plugin.Plugin{}
+	for _, name := range r.Timings.Order(pluginNames(plugins)) {
+		ordered = append(ordered, byName[name][0])
+		byName[name] = byName[name][1:]
+	}
+	return ordered
+}
+
+func pluginNames(plugins []*plugin.Plugin) []string {
+	names := []string{}
+	for _, p := range plugins {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// Wait waits for reported events to reach reporter
+func (r *Runner) Wait() {
+	for len(r.ReportService.EventChannel) > 0 || len(r.Reporter.EventChannel) > 0 {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Close stops collecting events after reported events reach reporter
+func (r *Runner) Close() {
+	r.closeOnce.Do(func() {
+		r.Wait()
+		close(r.closeCh)
+		<-r.doneCh
+		r.Reporter.StopListen()
+	})
+}
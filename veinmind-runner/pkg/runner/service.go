@@ -0,0 +1,113 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/chaitin/libveinmind/go/plugin"
+	"github.com/chaitin/libveinmind/go/plugin/service"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/pluginlog"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// pluginReportService counts events reported by a plugin execution,
+// levels of events are normalized as plugin is known here. Events of
+// plugin with limit are buffered until flush, events of plugin in
+// monitor mode are sent as monitor-only
+type pluginReportService struct {
+	send      func(evt report.ReportEvent)
+	plugin    string
+	normalize func(plugin string, value string, evt report.ReportEvent) report.ReportEvent
+	count     int64
+	limit     int
+	suppress  func(s reporter.Suppression, aggregated report.ReportEvent)
+	monitor   bool
+	mu        sync.Mutex
+	buffered  []report.ReportEvent
+	flushed   bool
+	// record receives events as reported by plugin if set
+	record func(evt reportedEvent)
+}
+
+// reportedEvent is event reported by plugin with level kept as it's
+// reported, as levels not in the vocabulary of report are lost once
+// decoded
+type reportedEvent struct {
+	report.ReportEvent
+	level string
+}
+
+func (e *reportedEvent) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &e.ReportEvent); err != nil {
+		return err
+	}
+
+	raw := struct {
+		Level json.RawMessage `json:"level"`
+	}{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	e.level = strings.Trim(string(raw.Level), `"`)
+	return nil
+}
+
+func (s *pluginReportService) Report(evt reportedEvent) {
+	if s.record != nil {
+		s.record(evt)
+	}
+	s.report(evt)
+}
+
+// report normalizes level of event and forwards it, events of cached
+// layers are replayed through it as well
+func (s *pluginReportService) report(evt reportedEvent) {
+	if s.normalize != nil {
+		evt.ReportEvent = s.normalize(s.plugin, evt.level, evt.ReportEvent)
+	}
+	s.forward(evt.ReportEvent)
+}
+
+// forward counts and sends event whose level is normalized
+func (s *pluginReportService) forward(evt report.ReportEvent) {
+	atomic.AddInt64(&s.count, 1)
+	if !s.buffer(evt) {
+		s.send(evt)
+	}
+}
+
+func (s *pluginReportService) Add(registry *service.Registry) {
+	registry.Define(report.Namespace, struct{}{})
+	registry.AddService(report.Namespace, "report", s.Report)
+}
+
+func (s *pluginReportService) Count() int64 {
+	return atomic.LoadInt64(&s.count)
+}
+
+// withPluginEnv appends environment variables to plugin process
+func withPluginEnv(env []string) plugin.ExecOption {
+	return plugin.WithEnv(env...)
+}
+
+// withPluginDir sets working directory of plugin process
+func withPluginDir(dir string) plugin.ExecOption {
+	return plugin.WithPrepareExec(func(ctx context.Context, cmd *exec.Cmd) (func(error) error, error) {
+		cmd.Dir = dir
+		return nil, nil
+	})
+}
+
+// withOutput routes stdout and stderr of plugin process to w, which
+// never splits lines of plugins running in parallel
+func withOutput(w *pluginlog.Writer) plugin.ExecOption {
+	return plugin.WithPrepareExec(func(ctx context.Context, cmd *exec.Cmd) (func(error) error, error) {
+		cmd.Stdout = w
+		cmd.Stderr = w
+		return nil, nil
+	})
+}
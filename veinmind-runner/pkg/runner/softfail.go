@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/diagnostics"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+)
+
+// SoftFailTag is declared in tags of manifest by plugins whose failures
+// shouldn't fail the scan
+const SoftFailTag = "soft-fail"
+
+// SoftFail is names of plugins whose failures are soft
+type SoftFail map[string]struct{}
+
+// NewSoftFail creates soft-fail plugins of names
+func NewSoftFail(names []string) SoftFail {
+	s := SoftFail{}
+	for _, name := range names {
+		if name != "" {
+			s[name] = struct{}{}
+		}
+	}
+	return s
+}
+
+// Soft reports whether failures of plugin are soft, either it's named
+// or it declares SoftFailTag
+func (s SoftFail) Soft(name string, tags []string) bool {
+	if _, ok := s[name]; ok {
+		return true
+	}
+	for _, tag := range tags {
+		if tag == SoftFailTag {
+			return true
+		}
+	}
+	return false
+}
+
+// recordFailure records failure of plugin execution in coverage, crash
+// is recorded with diagnostics bundle and overrun is the reason if the
+// execution ran over budget. Failures of soft-fail plugins, including
+// running over budget, are recorded once as soft-failed instead
+func (r *Runner) recordFailure(imageID string, plugin string, soft bool, err error, bundle string, overrun string) {
+	if soft {
+		if err == nil && overrun == "" {
+			return
+		}
+
+		reason := overrun
+		if err != nil {
+			if reason != "" {
+				reason += ": "
+			}
+			reason += err.Error()
+		}
+		log.Warnf("Plugin %#v soft-failed on image %#v: %s\n", plugin, imageID, reason)
+		r.Reporter.AddCoverage(reporter.Coverage{
+			ImageID:     imageID,
+			Plugin:      plugin,
+			Scope:       reporter.ScopeSoftFailed,
+			Reason:      reason,
+			Code:        pluginCode(err, overrun),
+			Diagnostics: bundle,
+		})
+		return
+	}
+
+	if overrun != "" {
+		r.Reporter.AddCoverage(reporter.Coverage{
+			ImageID: imageID,
+			Plugin:  plugin,
+			Scope:   reporter.ScopeOverrun,
+			Reason:  overrun,
+			Code:    errcode.PluginTimeout,
+		})
+	}
+	if diagnostics.Abnormal(err) {
+		r.Reporter.AddCoverage(reporter.Coverage{
+			ImageID:     imageID,
+			Plugin:      plugin,
+			Scope:       reporter.ScopeCrashed,
+			Reason:      err.Error(),
+			Code:        errcode.PluginCrashed,
+			Diagnostics: bundle,
+		})
+	}
+}
+
+// pluginCode returns code of failure of plugin execution
+func pluginCode(err error, overrun string) errcode.Code {
+	switch {
+	case diagnostics.Abnormal(err):
+		return errcode.PluginCrashed
+	case overrun != "":
+		return errcode.PluginTimeout
+	}
+	return errcode.PluginFailed
+}
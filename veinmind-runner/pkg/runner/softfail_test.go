@@ -0,0 +1,54 @@
+package runner
+
+import (
+	"context"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/stretchr/testify/assert"
+	"os/exec"
+	"testing"
+)
+
+func TestSoftFail(t *testing.T) {
+	s := NewSoftFail([]string{"veinmind-community", ""})
+	assert.True(t, s.Soft("veinmind-community", nil))
+	assert.True(t, s.Soft("veinmind-exotic", []string{"os:linux", SoftFailTag}))
+	assert.False(t, s.Soft("veinmind-backdoor", []string{"os:linux"}))
+	assert.False(t, SoftFail(nil).Soft("veinmind-backdoor", nil))
+}
+
+func TestRecordFailure(t *testing.T) {
+	rep, err := reporter.NewReporter()
+	assert.NoError(t, err)
+	r := &Runner{Reporter: rep}
+
+	crash := &exec.ExitError{}
+	overrun := "ran 2s over budget of 1s"
+
+	// Failures of other plugins keep their scopes
+	r.recordFailure("sha256:aa", "veinmind-backdoor", false, crash, "bundle.tar.gz", "")
+	r.recordFailure("sha256:aa", "veinmind-sensitive", false, context.DeadlineExceeded, "", overrun)
+	r.recordFailure("sha256:aa", "veinmind-weakpass", false, nil, "", "")
+
+	// Crash and timeout of soft-fail plugin are both soft
+	r.recordFailure("sha256:aa", "veinmind-community", true, crash, "bundle.tar.gz", "")
+	r.recordFailure("sha256:aa", "veinmind-community", true, context.DeadlineExceeded, "", overrun)
+	r.recordFailure("sha256:aa", "veinmind-community", true, nil, "", overrun)
+	r.recordFailure("sha256:aa", "veinmind-community", true, nil, "", "")
+
+	doc := rep.Snapshot()
+	failed := doc.FailedExecutions()
+	assert.Len(t, failed, 2)
+	assert.Equal(t, reporter.ScopeCrashed, failed[0].Scope)
+	assert.Equal(t, "bundle.tar.gz", failed[0].Diagnostics)
+	assert.Equal(t, reporter.ScopeOverrun, failed[1].Scope)
+	assert.Equal(t, errcode.PluginCrashed, failed[0].Code)
+	assert.Equal(t, errcode.PluginTimeout, failed[1].Code)
+
+	soft := doc.SoftFailures()
+	assert.Len(t, soft, 3)
+	assert.Equal(t, "bundle.tar.gz", soft[0].Diagnostics)
+	assert.Equal(t, overrun+": "+context.DeadlineExceeded.Error(), soft[1].Reason)
+	assert.Equal(t, overrun, soft[2].Reason)
+	assert.Equal(t, errcode.PluginTimeout, soft[1].Code)
+}
@@ -0,0 +1,74 @@
+package runner
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/prune"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// WorkDirEnv is environment variable of working directory of plugin
+// execution passed to plugins
+const WorkDirEnv = "VEINMIND_PLUGIN_WORKDIR"
+
+// WorkDirPrefix prefixes working directories of plugin executions, so
+// that those left in a shared base are told apart
+const WorkDirPrefix = "veinmind-work-"
+
+// newWorkDir creates isolated working directory of a plugin execution
+// under base, temporary directory is used if base is empty
+func newWorkDir(base string, plugin string) (string, error) {
+	if base != "" {
+		if err := os.MkdirAll(base, 0700); err != nil {
+			return "", errors.Wrap(err, "create work dir")
+		}
+	}
+
+	prefix := WorkDirPrefix + strings.NewReplacer("/", "-", string(os.PathSeparator), "-").Replace(plugin) + "-"
+	dir, err := ioutil.TempDir(base, prefix)
+	if err != nil {
+		return "", errors.Wrap(err, "create work dir")
+	}
+	return dir, nil
+}
+
+// removeWorkDir removes working directory after plugin exits, it's
+// kept for debugging if plugin failed and keepFailed is set
+func removeWorkDir(dir string, execErr error, keepFailed bool) {
+	if execErr != nil && keepFailed {
+		log.Warnf("Keep work dir of failed plugin: %#v\n", dir)
+		return
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		log.Errorf("Remove work dir %#v error: %s\n", dir, err.Error())
+	}
+}
+
+// ExpiredWorkDirs lists working directories under base left by plugin
+// executions before, temporary directory is used if base is empty
+func ExpiredWorkDirs(base string, before time.Time) ([]prune.Item, error) {
+	if base == "" {
+		base = os.TempDir()
+	}
+	return prune.Entries(prune.KindWorkDir, base, before, func(info os.FileInfo) bool {
+		return info.IsDir() && strings.HasPrefix(info.Name(), WorkDirPrefix)
+	})
+}
+
+// ParsePluginEnv parses values of name=KEY=VALUE into environment
+// variables of each plugin
+func ParsePluginEnv(values []string) (map[string][]string, error) {
+	env := map[string][]string{}
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("invalid plugin env %#v, expect name=KEY=VALUE", v)
+		}
+		env[parts[0]] = append(env[parts[0]], parts[1]+"="+parts[2])
+	}
+	return env, nil
+}
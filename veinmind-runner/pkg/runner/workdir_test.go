@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkDir(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "work")
+
+	a, err := newWorkDir(base, "veinmind-malicious")
+	assert.Nil(t, err)
+	b, err := newWorkDir(base, "veinmind-malicious")
+	assert.Nil(t, err)
+	assert.NotEqual(t, a, b)
+	assert.Equal(t, base, filepath.Dir(a))
+	assert.True(t, strings.HasPrefix(filepath.Base(a), WorkDirPrefix+"veinmind-malicious-"))
+
+	// Work dirs left before are expired, other entries of base aren't
+	past := time.Now().Add(-48 * time.Hour)
+	assert.Nil(t, os.Chtimes(b, past, past))
+	assert.Nil(t, os.Mkdir(filepath.Join(base, "other"), 0700))
+	assert.Nil(t, os.Chtimes(filepath.Join(base, "other"), past, past))
+	items, err := ExpiredWorkDirs(base, time.Now().Add(-24*time.Hour))
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, b, items[0].Path)
+
+	removeWorkDir(a, nil, true)
+	_, err = os.Stat(a)
+	assert.True(t, os.IsNotExist(err))
+
+	removeWorkDir(b, errors.New("exit status 1"), true)
+	_, err = os.Stat(b)
+	assert.Nil(t, err)
+
+	removeWorkDir(b, errors.New("exit status 1"), false)
+	_, err = os.Stat(b)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestParsePluginEnv(t *testing.T) {
+	env, err := ParsePluginEnv([]string{
+		"veinmind-weakpass=DICT=/data/dict.txt",
+		"veinmind-weakpass=MODE=fast",
+		"veinmind-malicious=RULES=a=b",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{
+		"veinmind-weakpass":  {"DICT=/data/dict.txt", "MODE=fast"},
+		"veinmind-malicious": {"RULES=a=b"},
+	}, env)
+
+	for _, v := range []string{"KEY=VALUE", "=KEY=VALUE", "name==VALUE"} {
+		_, err := ParsePluginEnv([]string{v})
+		assert.NotNil(t, err, v)
+	}
+}
@@ -0,0 +1,203 @@
+// Package scanconfig records effective configuration of a scan in its
+// report, so that the scan can be reproduced when findings are disputed
+package scanconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Redacted replaces secrets in configuration
+const Redacted = "<redacted>"
+
+var (
+	// sensitiveName matches names of flags and variables whose values
+	// are secrets
+	sensitiveName = regexp.MustCompile(`(?i)(passw|secret|token|credential|api_?key|auth)`)
+	// referenceSuffix matches names of flags whose values refer to
+	// secrets instead of holding them, e.g. --ci-token-env
+	referenceSuffix = regexp.MustCompile(`-(env|file|path|dir)$`)
+	// assignment matches name=value in values, e.g. plugin env and
+	// query parameters of urls
+	assignment = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_.-]*)=([^,&;\s\]]*)`)
+	// userinfo matches password of urls
+	userinfo = regexp.MustCompile(`(://[^/@\s:]*):[^/@\s]*@`)
+	// shellSafe matches arguments which don't need quoting
+	shellSafe = regexp.MustCompile(`^[A-Za-z0-9_./:=@,+%-]+$`)
+)
+
+// Config is effective configuration of a scan, secrets of it are
+// redacted
+type Config struct {
+	// Command is path of command, e.g. veinmind-runner scan-host
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	// Flags are all flags of command with resolved values, sorted by
+	// name
+	Flags []Flag `json:"flags"`
+	// Files are files of configuration given by flags
+	Files   []File   `json:"files,omitempty"`
+	Plugins []Plugin `json:"plugins,omitempty"`
+	// Profile is resolution of profile presetting flags
+	Profile *Profile `json:"profile,omitempty"`
+}
+
+// Flag is a flag of command, Changed flags are given on command line
+// while the others have their default values or values of Profile
+type Flag struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Value   string `json:"value"`
+	Changed bool   `json:"changed,omitempty"`
+	Profile string `json:"profile,omitempty"`
+}
+
+// Profile is how profile presetting flags is resolved, Applied are
+// flags set by profile, Overridden are flags of profile given on
+// command line and Unsupported are flags of profile which command
+// doesn't have
+type Profile struct {
+	Name        string   `json:"name"`
+	Source      string   `json:"source"`
+	Applied     []string `json:"applied,omitempty"`
+	Overridden  []string `json:"overridden,omitempty"`
+	Unsupported []string `json:"unsupported,omitempty"`
+}
+
+// File is file of configuration given by flag, Error is failure of
+// hashing it
+type File struct {
+	Flag   string `json:"flag"`
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Plugin is a plugin of scan with hash of its binary
+type Plugin struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Path    string `json:"path"`
+	SHA256  string `json:"sha256,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Redact returns value of flag name with secrets redacted. Values of
+// flags whose names look sensitive are redacted as a whole, unless the
+// flags refer to secrets by name of variable or path of file. In any
+// value, passwords of urls and sensitive assignments are redacted
+func Redact(name string, value string) string {
+	if value == "" {
+		return value
+	}
+	if sensitiveName.MatchString(name) && !referenceSuffix.MatchString(name) {
+		return Redacted
+	}
+
+	value = userinfo.ReplaceAllString(value, "$1:"+Redacted+"@")
+	return assignment.ReplaceAllStringFunc(value, func(kv string) string {
+		m := assignment.FindStringSubmatch(kv)
+		if !sensitiveName.MatchString(m[1]) || m[2] == "" {
+			return kv
+		}
+		return m[1] + "=" + Redacted
+	})
+}
+
+// NewFlag returns flag with its value redacted
+func NewFlag(name string, typ string, value string, changed bool) Flag {
+	return Flag{Name: name, Type: typ, Value: Redact(name, value), Changed: changed}
+}
+
+// SortFlags sorts flags by name
+func SortFlags(flags []Flag) {
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+}
+
+// Hash returns sha256 of file at path in hex
+func Hash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NewFile returns file of flag with its hash
+func NewFile(flag string, path string) File {
+	f := File{Flag: flag, Path: path}
+	sum, err := Hash(path)
+	if err != nil {
+		f.Error = err.Error()
+	}
+	f.SHA256 = sum
+	return f
+}
+
+// NewPlugin returns plugin with hash of its binary at path
+func NewPlugin(name string, version string, path string) Plugin {
+	p := Plugin{Name: name, Version: version, Path: path}
+	sum, err := Hash(path)
+	if err != nil {
+		p.Error = err.Error()
+	}
+	p.SHA256 = sum
+	return p
+}
+
+// Reproduce returns command line reproducing the scan with changed
+// flags, redacted secrets have to be filled in. Flags set by profile are
+// spelled out, since profiles may change between releases
+func (c Config) Reproduce() string {
+	words := []string{c.Command}
+	for _, f := range c.Flags {
+		if !f.Changed && f.Profile == "" {
+			continue
+		}
+		if isList(f.Type) {
+			for _, v := range listValues(f.Value) {
+				words = append(words, "--"+f.Name+"="+quote(v))
+			}
+			continue
+		}
+		words = append(words, "--"+f.Name+"="+quote(f.Value))
+	}
+	for _, arg := range c.Args {
+		words = append(words, quote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// isList reports whether flag of type is given repeatedly for values
+func isList(typ string) bool {
+	return strings.HasSuffix(typ, "Slice") || strings.HasSuffix(typ, "Array")
+}
+
+// listValues splits value of list flag in form of [a,b]
+func listValues(value string) []string {
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func quote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
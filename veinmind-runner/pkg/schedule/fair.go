@@ -0,0 +1,195 @@
+package schedule
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DomainStat is throughput of targets of a registry domain, Busy is
+// time targets of domain were running and Elapsed is time from start of
+// the first target to end of the last one
+type DomainStat struct {
+	Domain     string        `json:"domain"`
+	Targets    int           `json:"targets"`
+	Completed  int           `json:"completed"`
+	MaxRunning int           `json:"max_running"`
+	Busy       time.Duration `json:"busy"`
+	Elapsed    time.Duration `json:"elapsed"`
+}
+
+// Throughput returns targets of domain completed per minute
+func (s DomainStat) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Completed) / s.Elapsed.Minutes()
+}
+
+type domainQueue struct {
+	pending []string
+	running int
+	first   time.Time
+	stat    DomainStat
+}
+
+// Fair runs targets by a pool of workers, taking targets of registry
+// domains in turn so that one registry isn't hammered while others sit
+// idle. Targets of a domain are run in the order they're given, and at
+// most perDomain of them at a time if perDomain is positive
+type Fair struct {
+	workers   int
+	perDomain int
+	domains   []string
+	queues    map[string]*domainQueue
+	next      int
+	stopped   bool
+	mu        sync.Mutex
+	cond      *sync.Cond
+}
+
+// NewFair queues targets by their domains, domains are taken in turn in
+// the order they first appear in targets
+func NewFair(targets []string, domain func(target string) string, workers int, perDomain int) *Fair {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	f := &Fair{workers: workers, perDomain: perDomain, queues: map[string]*domainQueue{}}
+	f.cond = sync.NewCond(&f.mu)
+	for _, t := range targets {
+		d := domain(t)
+		q, ok := f.queues[d]
+		if !ok {
+			q = &domainQueue{stat: DomainStat{Domain: d}}
+			f.queues[d] = q
+			f.domains = append(f.domains, d)
+		}
+		q.pending = append(q.pending, t)
+		q.stat.Targets++
+	}
+	return f
+}
+
+// Run runs fn on targets until all targets are run, fn fails or stop
+// returns true, stop is checked before a target is taken. Targets left
+// are returned along with the first error of fn
+func (f *Fair) Run(fn func(target string) error, stop func() bool) ([]string, error) {
+	var (
+		wg    sync.WaitGroup
+		first error
+		once  sync.Once
+	)
+	for i := 0; i < f.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				t, d, ok := f.take(stop)
+				if !ok {
+					return
+				}
+				start := time.Now()
+				err := fn(t)
+				f.done(d, start)
+				if err != nil {
+					once.Do(func() { first = err })
+					f.stop()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return f.left(), first
+}
+
+// take waits for a target of the next domain in turn which is under its
+// limit, ok is false once no target is left or run is stopped
+func (f *Fair) take(stop func() bool) (string, string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for {
+		if !f.stopped && stop != nil && stop() {
+			f.stopped = true
+			f.cond.Broadcast()
+		}
+		if f.stopped {
+			return "", "", false
+		}
+
+		pending := false
+		for i := range f.domains {
+			d := f.domains[(f.next+i)%len(f.domains)]
+			q := f.queues[d]
+			if len(q.pending) == 0 {
+				continue
+			}
+			pending = true
+			if f.perDomain > 0 && q.running >= f.perDomain {
+				continue
+			}
+
+			t := q.pending[0]
+			q.pending = q.pending[1:]
+			q.running++
+			if q.running > q.stat.MaxRunning {
+				q.stat.MaxRunning = q.running
+			}
+			if q.first.IsZero() {
+				q.first = time.Now()
+			}
+			f.next = (f.next + i + 1) % len(f.domains)
+			return t, d, true
+		}
+		if !pending {
+			return "", "", false
+		}
+		// All domains with targets left are at their limits
+		f.cond.Wait()
+	}
+}
+
+func (f *Fair) done(domain string, start time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q := f.queues[domain]
+	q.running--
+	now := time.Now()
+	q.stat.Busy += now.Sub(start)
+	q.stat.Elapsed = now.Sub(q.first)
+	q.stat.Completed++
+	f.cond.Broadcast()
+}
+
+func (f *Fair) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopped = true
+	f.cond.Broadcast()
+}
+
+// left returns targets not taken, in order of their domains
+func (f *Fair) left() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	left := []string{}
+	for _, d := range f.domains {
+		left = append(left, f.queues[d].pending...)
+	}
+	return left
+}
+
+// Stats returns throughput of domains sorted by domain
+func (f *Fair) Stats() []DomainStat {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := []DomainStat{}
+	for _, q := range f.queues {
+		stats = append(stats, q.stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Domain < stats[j].Domain
+	})
+	return stats
+}
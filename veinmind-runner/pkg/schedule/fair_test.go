@@ -0,0 +1,98 @@
+package schedule
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func registryOf(target string) string {
+	return strings.SplitN(target, "/", 2)[0]
+}
+
+func TestFairOrder(t *testing.T) {
+	targets := []string{"a.io/1", "a.io/2", "a.io/3", "b.io/1", "b.io/2", "c.io/1"}
+	f := NewFair(targets, registryOf, 1, 0)
+
+	ran := []string{}
+	left, err := f.Run(func(target string) error {
+		ran = append(ran, target)
+		return nil
+	}, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, left)
+	// Registries are taken in turn, targets of a registry keep their order
+	assert.Equal(t, []string{"a.io/1", "b.io/1", "c.io/1", "a.io/2", "b.io/2", "a.io/3"}, ran)
+
+	stats := f.Stats()
+	assert.Len(t, stats, 3)
+	assert.Equal(t, "a.io", stats[0].Domain)
+	assert.Equal(t, 3, stats[0].Targets)
+	assert.Equal(t, 3, stats[0].Completed)
+	assert.Equal(t, 1, stats[0].MaxRunning)
+}
+
+func TestFairPerDomain(t *testing.T) {
+	targets := []string{}
+	for i := 0; i < 6; i++ {
+		targets = append(targets, "a.io/"+string(rune('a'+i)))
+	}
+	targets = append(targets, "b.io/a", "b.io/b")
+	f := NewFair(targets, registryOf, 4, 2)
+
+	var (
+		mu      sync.Mutex
+		running = map[string]int{}
+		peak    = map[string]int{}
+	)
+	left, err := f.Run(func(target string) error {
+		d := registryOf(target)
+		mu.Lock()
+		running[d]++
+		if running[d] > peak[d] {
+			peak[d] = running[d]
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running[d]--
+		mu.Unlock()
+		return nil
+	}, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, left)
+	assert.Equal(t, 2, peak["a.io"])
+	assert.Equal(t, 2, peak["b.io"])
+
+	for _, s := range f.Stats() {
+		assert.Equal(t, s.Targets, s.Completed)
+		assert.LessOrEqual(t, s.MaxRunning, 2)
+		assert.True(t, s.Throughput() > 0)
+	}
+}
+
+func TestFairStop(t *testing.T) {
+	targets := []string{"a.io/1", "b.io/1", "a.io/2", "b.io/2"}
+
+	ran := 0
+	left, err := NewFair(targets, registryOf, 1, 0).Run(func(target string) error {
+		ran++
+		return nil
+	}, func() bool {
+		return ran >= 2
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.io/2", "b.io/2"}, left)
+
+	// The first error stops the run
+	left, err = NewFair(targets, registryOf, 1, 0).Run(func(target string) error {
+		return errors.New("fail fast")
+	}, nil)
+	assert.EqualError(t, err, "fail fast")
+	assert.Len(t, left, 3)
+}
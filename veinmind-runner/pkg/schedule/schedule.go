@@ -0,0 +1,156 @@
+// Package schedule runs plugin executions in separate pools by the
+// concurrency class plugins declare, so that IO-heavy plugins don't
+// thrash disk and CPU-heavy plugins don't starve light ones, and pulls
+// targets of registries in turn so that no registry is hammered
+package schedule
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClassTagPrefix declares concurrency class of plugin in tags of its
+// manifest, e.g. class:io
+const ClassTagPrefix = "class:"
+
+// Concurrency classes of plugins
+const (
+	// ClassIO is plugins walking filesystem of images
+	ClassIO = "io"
+	// ClassCPU is plugins bound by computation, e.g. YARA matching
+	ClassCPU = "cpu"
+	// ClassLight is plugins which are cheap to run
+	ClassLight = "light"
+	// ClassDefault is plugins declaring no known class, and the pool
+	// of classes without pool of their own
+	ClassDefault = "default"
+)
+
+// Class returns concurrency class declared in tags of plugin,
+// ClassDefault if none or an unknown class is declared
+func Class(tags []string) string {
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, ClassTagPrefix) {
+			continue
+		}
+		switch class := strings.ToLower(strings.TrimPrefix(tag, ClassTagPrefix)); class {
+		case ClassIO, ClassCPU, ClassLight:
+			return class
+		}
+	}
+	return ClassDefault
+}
+
+// Stat is queue statistics of a pool, wait is time executions spent
+// waiting for a slot of pool
+type Stat struct {
+	Class      string        `json:"class"`
+	Size       int           `json:"size"`
+	Executions int64         `json:"executions"`
+	Wait       time.Duration `json:"wait"`
+	MaxWait    time.Duration `json:"max_wait"`
+}
+
+// AverageWait returns average wait of executions of pool
+func (s Stat) AverageWait() time.Duration {
+	if s.Executions == 0 {
+		return 0
+	}
+	return s.Wait / time.Duration(s.Executions)
+}
+
+type pool struct {
+	slots chan struct{}
+	mu    sync.Mutex
+	stat  Stat
+}
+
+// Pools are semaphores of concurrency classes
+type Pools struct {
+	pools map[string]*pool
+}
+
+// New creates pools of classes sized by sizes, classes whose size isn't
+// positive share the default pool with plugins declaring no class
+func New(sizes map[string]int, defaultSize int) *Pools {
+	if defaultSize <= 0 {
+		defaultSize = 1
+	}
+
+	p := &Pools{pools: map[string]*pool{}}
+	p.add(ClassDefault, defaultSize)
+	for class, size := range sizes {
+		if class != ClassDefault && size > 0 {
+			p.add(class, size)
+		}
+	}
+	return p
+}
+
+func (p *Pools) add(class string, size int) {
+	p.pools[class] = &pool{
+		slots: make(chan struct{}, size),
+		stat:  Stat{Class: class, Size: size},
+	}
+}
+
+// Size returns number of slots of all pools
+func (p *Pools) Size() int {
+	size := 0
+	for _, pl := range p.pools {
+		size += pl.stat.Size
+	}
+	return size
+}
+
+// Pool returns pool executions of class are scheduled in
+func (p *Pools) Pool(class string) string {
+	if _, ok := p.pools[class]; ok {
+		return class
+	}
+	return ClassDefault
+}
+
+// Acquire waits for a slot of pool of class, release must be called
+// once the execution finishes. Time waited is returned
+func (p *Pools) Acquire(ctx context.Context, class string) (func(), time.Duration, error) {
+	pl := p.pools[p.Pool(class)]
+
+	start := time.Now()
+	select {
+	case pl.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, time.Since(start), ctx.Err()
+	}
+	wait := time.Since(start)
+
+	pl.mu.Lock()
+	pl.stat.Executions++
+	pl.stat.Wait += wait
+	if wait > pl.stat.MaxWait {
+		pl.stat.MaxWait = wait
+	}
+	pl.mu.Unlock()
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() { <-pl.slots })
+	}, wait, nil
+}
+
+// Stats returns statistics of pools sorted by class
+func (p *Pools) Stats() []Stat {
+	stats := []Stat{}
+	for _, pl := range p.pools {
+		pl.mu.Lock()
+		stats = append(stats, pl.stat)
+		pl.mu.Unlock()
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Class < stats[j].Class
+	})
+	return stats
+}
@@ -0,0 +1,76 @@
+package schedule
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClass(t *testing.T) {
+	assert.Equal(t, ClassIO, Class([]string{"os:linux", "class:io"}))
+	assert.Equal(t, ClassCPU, Class([]string{"class:CPU"}))
+	assert.Equal(t, ClassDefault, Class([]string{"class:gpu"}))
+	assert.Equal(t, ClassDefault, Class(nil))
+}
+
+func TestPools(t *testing.T) {
+	p := New(map[string]int{ClassIO: 1, ClassCPU: 0}, 2)
+	assert.Equal(t, 3, p.Size())
+	assert.Equal(t, ClassIO, p.Pool(ClassIO))
+	assert.Equal(t, ClassDefault, p.Pool(ClassCPU))
+	assert.Equal(t, ClassDefault, p.Pool(ClassLight))
+
+	var running, peak int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, _, err := p.Acquire(context.Background(), ClassIO)
+			assert.NoError(t, err)
+			defer release()
+
+			n := atomic.AddInt64(&running, 1)
+			for {
+				old := atomic.LoadInt64(&peak)
+				if n <= old || atomic.CompareAndSwapInt64(&peak, old, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt64(&running, -1)
+		}()
+	}
+
+	// Default pool isn't blocked by executions of io
+	release, wait, err := p.Acquire(context.Background(), ClassLight)
+	assert.NoError(t, err)
+	assert.True(t, wait < 10*time.Millisecond)
+	release()
+	wg.Wait()
+
+	assert.Equal(t, int64(1), peak)
+	stats := p.Stats()
+	assert.Len(t, stats, 2)
+	assert.Equal(t, ClassDefault, stats[0].Class)
+	assert.Equal(t, int64(1), stats[0].Executions)
+	assert.Equal(t, ClassIO, stats[1].Class)
+	assert.Equal(t, int64(4), stats[1].Executions)
+	assert.True(t, stats[1].MaxWait >= 20*time.Millisecond)
+	assert.True(t, stats[1].AverageWait() > 0)
+}
+
+func TestAcquireCanceled(t *testing.T) {
+	p := New(nil, 1)
+	release, _, err := p.Acquire(context.Background(), ClassDefault)
+	assert.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = p.Acquire(ctx, ClassDefault)
+	assert.Equal(t, context.Canceled, err)
+}
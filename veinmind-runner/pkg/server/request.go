@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+)
+
+const (
+	TargetImage    = "image"
+	TargetRegistry = "registry"
+	TargetHost     = "host"
+)
+
+// Request specifies target of a scan, ref is an image reference for
+// image target, a repo for registry target and an optional image
+// reference pattern for host target
+type Request struct {
+	Type    string `json:"type"`
+	Ref     string `json:"ref,omitempty"`
+	Runtime string `json:"runtime,omitempty"`
+	Threads int    `json:"threads,omitempty"`
+}
+
+// DecodeRequest decodes and validates request, unknown fields are rejected
+func DecodeRequest(r io.Reader) (Request, error) {
+	req := Request{}
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&req); err != nil {
+		return req, errors.Wrap(err, "decode request")
+	}
+	if d.More() {
+		return req, errors.New("decode request: unexpected data after request")
+	}
+	if err := req.Validate(); err != nil {
+		return req, err
+	}
+	if req.Runtime == "" {
+		req.Runtime = "docker"
+	}
+	return req, nil
+}
+
+func (r Request) Validate() error {
+	switch r.Type {
+	case TargetImage, TargetRegistry:
+		if r.Ref == "" {
+			return errors.Errorf("ref is required by %s target", r.Type)
+		}
+	case TargetHost:
+	case "":
+		return errors.New("type is required")
+	default:
+		return errors.Errorf("unknown target type: %#v", r.Type)
+	}
+
+	switch r.Runtime {
+	case "", "docker", "containerd":
+	default:
+		return errors.Errorf("unknown runtime: %#v", r.Runtime)
+	}
+
+	if r.Threads < 0 {
+		return errors.New("threads must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,392 @@
+// Package server serves on-demand scans over HTTP, scans are run
+// by an Executor with limited concurrency and kept in memory
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// Executor runs a scan and reports progress in number of images
+type Executor interface {
+	Execute(ctx context.Context, req Request, progress func(done, total int)) (reporter.Report, error)
+}
+
+type Options struct {
+	// Token authenticates requests as bearer token
+	Token string
+	// MaxConcurrent limits scans running at the same time
+	MaxConcurrent int
+	// MaxQueued limits scans waiting to run, exceeded requests are
+	// refused with 429
+	MaxQueued int
+	// Retention is how long finished scans are kept
+	Retention time.Duration
+	// Metrics returns extra metrics served under "executor" of
+	// /metrics, e.g. stats of plugin pool
+	Metrics func() interface{}
+}
+
+// Metrics are latencies of executed scans, failed and canceled scans
+// included
+type Metrics struct {
+	Scans       int64         `json:"scans"`
+	MeanLatency time.Duration `json:"mean_latency"`
+	MaxLatency  time.Duration `json:"max_latency"`
+	Executor    interface{}   `json:"executor,omitempty"`
+}
+
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+type Scan struct {
+	ID         string     `json:"id"`
+	Request    Request    `json:"request"`
+	Status     string     `json:"status"`
+	Progress   Progress   `json:"progress"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	report *reporter.Report
+	cancel context.CancelFunc
+}
+
+type Server struct {
+	exec  Executor
+	opts  Options
+	sem   chan struct{}
+	mu    sync.Mutex
+	scans map[string]*Scan
+	wg    sync.WaitGroup
+
+	executed   int64
+	latencies  time.Duration
+	maxLatency time.Duration
+}
+
+func New(exec Executor, opts Options) (*Server, error) {
+	if opts.Token == "" {
+		return nil, errors.New("api token is required")
+	}
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = 1
+	}
+	if opts.MaxQueued < 0 {
+		opts.MaxQueued = 0
+	}
+
+	return &Server{
+		exec:  exec,
+		opts:  opts,
+		sem:   make(chan struct{}, opts.MaxConcurrent),
+		scans: map[string]*Scan{},
+	}, nil
+}
+
+// Close cancels all scans and waits for them to finish
+func (s *Server) Close() {
+	s.mu.Lock()
+	for _, scan := range s.scans {
+		scan.cancel()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="veinmind-runner"`)
+		writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 1 && parts[0] == "metrics" {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		writeJSON(w, http.StatusOK, s.Metrics())
+		return
+	}
+	if parts[0] != "scans" || len(parts) > 3 {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		s.create(w, r)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		s.get(w, parts[1])
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+		s.delete(w, parts[1])
+	case len(parts) == 3 && parts[2] == "report" && r.Method == http.MethodGet:
+		s.report(w, parts[1], r.URL.Query().Get("format"))
+	case len(parts) == 3 && parts[2] != "report":
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) == 1
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	req, err := DecodeRequest(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, err := newID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.mu.Lock()
+	s.expire()
+	queued := 0
+	for _, scan := range s.scans {
+		if scan.Status == StatusQueued {
+			queued++
+		}
+	}
+	if queued >= s.opts.MaxQueued+cap(s.sem)-s.running() {
+		s.mu.Unlock()
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusTooManyRequests, errors.New("too many scans"))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scan := &Scan{
+		ID:        id,
+		Request:   req,
+		Status:    StatusQueued,
+		CreatedAt: time.Now(),
+		cancel:    cancel,
+	}
+	s.scans[id] = scan
+	view := *scan
+	s.mu.Unlock()
+
+	log.Infof("Accept scan %s: %#v\n", id, req)
+	s.wg.Add(1)
+	go s.run(ctx, scan)
+
+	w.Header().Set("Location", "/scans/"+id)
+	writeJSON(w, http.StatusAccepted, view)
+}
+
+// running returns number of running scans, mu must be held
+func (s *Server) running() int {
+	n := 0
+	for _, scan := range s.scans {
+		if scan.Status == StatusRunning {
+			n++
+		}
+	}
+	return n
+}
+
+// expire removes finished scans exceeding retention, mu must be held
+func (s *Server) expire() {
+	if s.opts.Retention <= 0 {
+		return
+	}
+	for id, scan := range s.scans {
+		if scan.FinishedAt != nil && time.Since(*scan.FinishedAt) > s.opts.Retention {
+			delete(s.scans, id)
+		}
+	}
+}
+
+func (s *Server) run(ctx context.Context, scan *Scan) {
+	defer s.wg.Done()
+	defer scan.cancel()
+
+	select {
+	case s.sem <- struct{}{}:
+		defer func() { <-s.sem }()
+	case <-ctx.Done():
+		s.finish(scan, nil, ctx.Err())
+		return
+	}
+
+	s.mu.Lock()
+	if ctx.Err() != nil {
+		s.mu.Unlock()
+		s.finish(scan, nil, ctx.Err())
+		return
+	}
+	now := time.Now()
+	scan.Status = StatusRunning
+	scan.StartedAt = &now
+	s.mu.Unlock()
+
+	doc, err := s.exec.Execute(ctx, scan.Request, func(done, total int) {
+		s.mu.Lock()
+		scan.Progress = Progress{Done: done, Total: total}
+		s.mu.Unlock()
+	})
+	s.observe(time.Since(now))
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	s.finish(scan, &doc, err)
+}
+
+func (s *Server) observe(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.executed++
+	s.latencies += latency
+	if latency > s.maxLatency {
+		s.maxLatency = latency
+	}
+}
+
+// Metrics returns latencies of scans executed so far
+func (s *Server) Metrics() Metrics {
+	s.mu.Lock()
+	m := Metrics{Scans: s.executed, MaxLatency: s.maxLatency}
+	if s.executed > 0 {
+		m.MeanLatency = s.latencies / time.Duration(s.executed)
+	}
+	s.mu.Unlock()
+
+	if s.opts.Metrics != nil {
+		m.Executor = s.opts.Metrics()
+	}
+	return m
+}
+
+func (s *Server) finish(scan *Scan, doc *reporter.Report, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	scan.FinishedAt = &now
+	switch {
+	case errors.Is(err, context.Canceled):
+		scan.Status = StatusCanceled
+	case err != nil:
+		scan.Status = StatusFailed
+		scan.Error = err.Error()
+	default:
+		scan.Status = StatusSucceeded
+		scan.report = doc
+	}
+	log.Infof("Scan %s %s\n", scan.ID, scan.Status)
+}
+
+func (s *Server) lookup(id string) (Scan, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scan, ok := s.scans[id]
+	if !ok {
+		return Scan{}, false
+	}
+	return *scan, true
+}
+
+func (s *Server) get(w http.ResponseWriter, id string) {
+	scan, ok := s.lookup(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.Errorf("scan %s not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, scan)
+}
+
+func (s *Server) delete(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	scan, ok := s.scans[id]
+	if ok && scan.FinishedAt == nil {
+		scan.cancel()
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.Errorf("scan %s not found", id))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) report(w http.ResponseWriter, id string, format string) {
+	scan, ok := s.lookup(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.Errorf("scan %s not found", id))
+		return
+	}
+	if scan.report == nil {
+		writeError(w, http.StatusConflict, errors.Errorf("report of %s scan is unavailable", scan.Status))
+		return
+	}
+
+	switch format {
+	case "", "json":
+		writeJSON(w, http.StatusOK, scan.report)
+	case "markdown":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		if err := reporter.WriteMarkdown(w, *scan.report); err != nil {
+			log.Error(err)
+		}
+	default:
+		writeError(w, http.StatusBadRequest, errors.Errorf("unknown report format: %#v", format))
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error(err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingExecutor runs until released or canceled
+type blockingExecutor struct {
+	release chan struct{}
+}
+
+func (e *blockingExecutor) Execute(ctx context.Context, req Request, progress func(done, total int)) (reporter.Report, error) {
+	progress(1, 2)
+	select {
+	case <-e.release:
+	case <-ctx.Done():
+		return reporter.Report{}, ctx.Err()
+	}
+	progress(2, 2)
+	return reporter.Report{Events: []reporter.Event{{ReportEvent: report.ReportEvent{
+		ID:        "sha256:aa",
+		Level:     report.High,
+		AlertType: report.Weakpass,
+	}}}}, nil
+}
+
+func do(t *testing.T, ts *httptest.Server, method string, path string, body string) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := ts.Client().Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp, b
+}
+
+func status(t *testing.T, ts *httptest.Server, id string) Scan {
+	_, b := do(t, ts, http.MethodGet, "/scans/"+id, "")
+	scan := Scan{}
+	assert.NoError(t, json.Unmarshal(b, &scan))
+	return scan
+}
+
+func TestDecodeRequest(t *testing.T) {
+	req, err := DecodeRequest(strings.NewReader(`{"type":"image","ref":"nginx:latest"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "docker", req.Runtime)
+
+	for _, body := range []string{
+		`{"type":"image"}`,
+		`{"type":"cluster","ref":"nginx"}`,
+		`{"type":"host","runtime":"podman"}`,
+		`{"type":"host","threads":-1}`,
+		`{"type":"host","unknown":true}`,
+		`{"type":"host"} {}`,
+	} {
+		_, err := DecodeRequest(strings.NewReader(body))
+		assert.Error(t, err, body)
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	_, err := New(&blockingExecutor{}, Options{})
+	assert.Error(t, err)
+
+	s, err := New(&blockingExecutor{}, Options{Token: "secret"})
+	assert.NoError(t, err)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/scans/1")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestServerScan(t *testing.T) {
+	exec := &blockingExecutor{release: make(chan struct{})}
+	s, err := New(exec, Options{Token: "secret", MaxConcurrent: 1})
+	assert.NoError(t, err)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	defer s.Close()
+
+	resp, b := do(t, ts, http.MethodPost, "/scans", `{"type":"host"}`)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	created := Scan{}
+	assert.NoError(t, json.Unmarshal(b, &created))
+	assert.NotEmpty(t, created.ID)
+
+	assert.Eventually(t, func() bool {
+		return status(t, ts, created.ID).Progress == Progress{Done: 1, Total: 2}
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, StatusRunning, status(t, ts, created.ID).Status)
+
+	// Concurrency is exhausted and no scan is allowed to wait
+	resp, _ = do(t, ts, http.MethodPost, "/scans", `{"type":"host"}`)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	resp, _ = do(t, ts, http.MethodGet, "/scans/"+created.ID+"/report", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	close(exec.release)
+	assert.Eventually(t, func() bool {
+		return status(t, ts, created.ID).Status == StatusSucceeded
+	}, time.Second, 10*time.Millisecond)
+
+	resp, b = do(t, ts, http.MethodGet, "/scans/"+created.ID+"/report?format=json", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	doc := reporter.Report{}
+	assert.NoError(t, json.Unmarshal(b, &doc))
+	assert.Len(t, doc.Events, 1)
+
+	resp, _ = do(t, ts, http.MethodGet, "/scans/"+created.ID+"/report?format=xml", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestServerCancel(t *testing.T) {
+	exec := &blockingExecutor{release: make(chan struct{})}
+	s, err := New(exec, Options{Token: "secret", MaxConcurrent: 1, MaxQueued: 1})
+	assert.NoError(t, err)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	defer s.Close()
+
+	ids := []string{}
+	for i := 0; i < 2; i++ {
+		resp, b := do(t, ts, http.MethodPost, "/scans", `{"type":"image","ref":"nginx"}`)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		scan := Scan{}
+		assert.NoError(t, json.Unmarshal(b, &scan))
+		ids = append(ids, scan.ID)
+		assert.Eventually(t, func() bool {
+			return status(t, ts, ids[0]).Status == StatusRunning
+		}, time.Second, 10*time.Millisecond)
+	}
+	assert.Equal(t, StatusQueued, status(t, ts, ids[1]).Status)
+
+	// Both running and queued scans are canceled
+	for _, id := range ids {
+		resp, _ := do(t, ts, http.MethodDelete, "/scans/"+id, "")
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	}
+	for _, id := range ids {
+		id := id
+		assert.Eventually(t, func() bool {
+			return status(t, ts, id).Status == StatusCanceled
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	resp, _ := do(t, ts, http.MethodDelete, "/scans/unknown", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServerMetrics(t *testing.T) {
+	exec := &blockingExecutor{release: make(chan struct{})}
+	close(exec.release)
+	s, err := New(exec, Options{Token: "secret", Metrics: func() interface{} {
+		return map[string]int{"warm": 1}
+	}})
+	assert.NoError(t, err)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	defer s.Close()
+
+	resp, b := do(t, ts, http.MethodPost, "/scans", `{"type":"host"}`)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	created := Scan{}
+	assert.NoError(t, json.Unmarshal(b, &created))
+	assert.Eventually(t, func() bool {
+		return status(t, ts, created.ID).Status == StatusSucceeded
+	}, time.Second, 10*time.Millisecond)
+
+	resp, b = do(t, ts, http.MethodGet, "/metrics", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	m := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(b, &m))
+	assert.Equal(t, float64(1), m["scans"])
+	assert.Equal(t, map[string]interface{}{"warm": float64(1)}, m["executor"])
+
+	resp, _ = do(t, ts, http.MethodPost, "/metrics", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
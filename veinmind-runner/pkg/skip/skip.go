@@ -0,0 +1,59 @@
+// Package skip parses labels of images which opt out of plugins, e.g.
+// images known to be false positive heavy for a plugin
+package skip
+
+import (
+	"github.com/pkg/errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Label lists plugins skipped for the image, separated by comma
+const Label = "veinmind.skip-plugins"
+
+var pluginName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Result is plugins skipped by labels of an image, Unknown is names
+// which don't match any plugin
+type Result struct {
+	Plugins []string
+	Unknown []string
+}
+
+// Parse parses skip label of labels against known plugin names, the
+// label is malformed if any entry is empty or not a valid plugin name
+func Parse(labels map[string]string, known []string) (Result, error) {
+	value, ok := labels[Label]
+	if !ok {
+		return Result{}, nil
+	}
+
+	knownSet := map[string]struct{}{}
+	for _, name := range known {
+		knownSet[name] = struct{}{}
+	}
+
+	result := Result{}
+	seen := map[string]struct{}{}
+	for _, entry := range strings.Split(value, ",") {
+		name := strings.TrimSpace(entry)
+		if !pluginName.MatchString(name) {
+			return Result{}, errors.Errorf("malformed label %s=%#v: invalid plugin name %#v", Label, value, name)
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+
+		if _, ok := knownSet[name]; ok {
+			result.Plugins = append(result.Plugins, name)
+		} else {
+			result.Unknown = append(result.Unknown, name)
+		}
+	}
+
+	sort.Strings(result.Plugins)
+	sort.Strings(result.Unknown)
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package skip
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// imageConfig is the part of OCI image config holding labels
+type imageConfig struct {
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+func TestParse(t *testing.T) {
+	known := []string{"veinmind-weakpass", "veinmind-malicious", "veinmind-sensitive"}
+
+	tests := []struct {
+		name   string
+		config string
+		want   Result
+		err    bool
+	}{
+		{
+			name:   "no labels",
+			config: `{"config":{}}`,
+		},
+		{
+			name:   "other labels",
+			config: `{"config":{"Labels":{"maintainer":"team-a"}}}`,
+		},
+		{
+			name:   "single",
+			config: `{"config":{"Labels":{"veinmind.skip-plugins":"veinmind-weakpass"}}}`,
+			want:   Result{Plugins: []string{"veinmind-weakpass"}},
+		},
+		{
+			name:   "multiple with spaces and duplicates",
+			config: `{"config":{"Labels":{"veinmind.skip-plugins":"veinmind-weakpass, veinmind-malicious,veinmind-weakpass"}}}`,
+			want:   Result{Plugins: []string{"veinmind-malicious", "veinmind-weakpass"}},
+		},
+		{
+			name:   "unknown",
+			config: `{"config":{"Labels":{"veinmind.skip-plugins":"veinmind-weakpass,veinmind-typo"}}}`,
+			want:   Result{Plugins: []string{"veinmind-weakpass"}, Unknown: []string{"veinmind-typo"}},
+		},
+		{
+			name:   "empty",
+			config: `{"config":{"Labels":{"veinmind.skip-plugins":""}}}`,
+			err:    true,
+		},
+		{
+			name:   "empty entry",
+			config: `{"config":{"Labels":{"veinmind.skip-plugins":"veinmind-weakpass,,veinmind-malicious"}}}`,
+			err:    true,
+		},
+		{
+			name:   "wrong separator",
+			config: `{"config":{"Labels":{"veinmind.skip-plugins":"veinmind-weakpass;veinmind-malicious"}}}`,
+			err:    true,
+		},
+		{
+			name:   "wildcard",
+			config: `{"config":{"Labels":{"veinmind.skip-plugins":"*"}}}`,
+			err:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config imageConfig
+			assert.Nil(t, json.Unmarshal([]byte(tt.config), &config))
+
+			got, err := Parse(config.Config.Labels, known)
+			if tt.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Package summary formats the one-line result of a scan written to
+// stderr, the format is a contract parsed by CI scripts and must be
+// kept stable
+package summary
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix starts every summary line
+const Prefix = "veinmind:"
+
+type Summary struct {
+	Scanned  int
+	Failed   int
+	Events   int
+	Critical int
+	High     int
+	Duration time.Duration
+	Exit     int
+	// Suppressed is number of events collapsed by event limits, they
+	// aren't counted in Events
+	Suppressed int
+	// SoftFailed is number of failures of soft-fail plugins, which
+	// don't affect Exit
+	SoftFailed int
+	// BlobHits and BlobMisses are lookups of blob cache, BlobSaved is
+	// bytes not downloaded thanks to hits
+	BlobHits   int64
+	BlobMisses int64
+	BlobSaved  int64
+	// Monitored is number of events of plugins in monitor mode, they
+	// aren't counted in Events
+	Monitored int
+	// LayerScansAvoided is number of layers of images whose events of
+	// a plugin are assembled from layer cache instead of scanned
+	LayerScansAvoided int64
+	// Codes are distinct codes of failures of the scan, e.g.
+	// registry-auth
+	Codes []string
+}
+
+// String formats summary as space separated key=value pairs in fixed
+// order, duration is rounded to seconds. Suppressed, soft failures,
+// blob cache lookups, monitor-only events, layer scans avoided and
+// codes of failures are appended only if there is any so that existing
+// lines are unchanged
+func (s Summary) String() string {
+	line := fmt.Sprintf("%s scanned=%d failed=%d events=%d critical=%d high=%d duration=%ds exit=%d",
+		Prefix, s.Scanned, s.Failed, s.Events, s.Critical, s.High,
+		int64(s.Duration.Round(time.Second)/time.Second), s.Exit)
+	if s.Suppressed > 0 {
+		line += fmt.Sprintf(" suppressed=%d", s.Suppressed)
+	}
+	if s.SoftFailed > 0 {
+		line += fmt.Sprintf(" soft_failed=%d", s.SoftFailed)
+	}
+	if s.BlobHits+s.BlobMisses > 0 {
+		line += fmt.Sprintf(" blob_cache_hits=%d blob_cache_misses=%d blob_cache_saved=%d",
+			s.BlobHits, s.BlobMisses, s.BlobSaved)
+	}
+	if s.Monitored > 0 {
+		line += fmt.Sprintf(" monitored=%d", s.Monitored)
+	}
+	if s.LayerScansAvoided > 0 {
+		line += fmt.Sprintf(" layer_scans_avoided=%d", s.LayerScansAvoided)
+	}
+	if len(s.Codes) > 0 {
+		line += " codes=" + strings.Join(s.Codes, ",")
+	}
+	return line
+}
+
+// Emitter writes summary once, whichever of completion, error and
+// interruption comes first
+type Emitter struct {
+	w       io.Writer
+	collect func() Summary
+	once    sync.Once
+}
+
+// NewEmitter creates emitter writing to w, summary is collected when
+// it's emitted
+func NewEmitter(w io.Writer, collect func() Summary) *Emitter {
+	return &Emitter{w: w, collect: collect}
+}
+
+// Emit writes summary with exit code, later calls are ignored
+func (e *Emitter) Emit(exit int) {
+	e.once.Do(func() {
+		s := e.collect()
+		s.Exit = exit
+		fmt.Fprintln(e.w, s.String())
+	})
+}
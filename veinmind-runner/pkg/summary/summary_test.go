@@ -0,0 +1,58 @@
+package summary
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestString(t *testing.T) {
+	s := Summary{
+		Scanned:  12,
+		Failed:   1,
+		Events:   34,
+		Critical: 2,
+		High:     5,
+		Duration: 183*time.Second + 400*time.Millisecond,
+		Exit:     1,
+	}
+	assert.Equal(t, "veinmind: scanned=12 failed=1 events=34 critical=2 high=5 duration=183s exit=1", s.String())
+	assert.Equal(t, "veinmind: scanned=0 failed=0 events=0 critical=0 high=0 duration=0s exit=0", Summary{}.String())
+
+	s.Suppressed = 49990
+	assert.Equal(t, "veinmind: scanned=12 failed=1 events=34 critical=2 high=5 duration=183s exit=1 suppressed=49990", s.String())
+
+	s.SoftFailed = 2
+	assert.Equal(t, "veinmind: scanned=12 failed=1 events=34 critical=2 high=5 duration=183s exit=1 suppressed=49990 soft_failed=2", s.String())
+
+	s.BlobHits, s.BlobMisses, s.BlobSaved = 40, 3, 1610612736
+	assert.Equal(t, "veinmind: scanned=12 failed=1 events=34 critical=2 high=5 duration=183s exit=1 suppressed=49990 soft_failed=2 "+
+		"blob_cache_hits=40 blob_cache_misses=3 blob_cache_saved=1610612736", s.String())
+
+	s.Monitored = 6
+	assert.Equal(t, "veinmind: scanned=12 failed=1 events=34 critical=2 high=5 duration=183s exit=1 suppressed=49990 soft_failed=2 "+
+		"blob_cache_hits=40 blob_cache_misses=3 blob_cache_saved=1610612736 monitored=6", s.String())
+
+	s.LayerScansAvoided = 17
+	assert.Equal(t, "veinmind: scanned=12 failed=1 events=34 critical=2 high=5 duration=183s exit=1 suppressed=49990 soft_failed=2 "+
+		"blob_cache_hits=40 blob_cache_misses=3 blob_cache_saved=1610612736 monitored=6 layer_scans_avoided=17", s.String())
+
+	s.Codes = []string{"plugin-crashed", "registry-auth"}
+	assert.Equal(t, "veinmind: scanned=12 failed=1 events=34 critical=2 high=5 duration=183s exit=1 suppressed=49990 soft_failed=2 "+
+		"blob_cache_hits=40 blob_cache_misses=3 blob_cache_saved=1610612736 monitored=6 layer_scans_avoided=17 codes=plugin-crashed,registry-auth", s.String())
+}
+
+func TestEmitOnce(t *testing.T) {
+	b := &bytes.Buffer{}
+	collected := 0
+	e := NewEmitter(b, func() Summary {
+		collected++
+		return Summary{Scanned: 3, Duration: 1500 * time.Millisecond}
+	})
+
+	e.Emit(130)
+	e.Emit(0)
+	assert.Equal(t, 1, collected)
+	assert.Equal(t, "veinmind: scanned=3 failed=0 events=0 critical=0 high=0 duration=2s exit=130\n", b.String())
+}
@@ -0,0 +1,81 @@
+package target
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// Stage is number of targets left after a stage of resolving targets,
+// Filters are what narrowed targets down at the stage
+type Stage struct {
+	Name    string   `json:"name"`
+	Count   int      `json:"count"`
+	Filters []string `json:"filters,omitempty"`
+}
+
+// Funnel records targets left at each stage, so that a scan scanning
+// nothing can tell where its targets were lost
+type Funnel struct {
+	mu     sync.Mutex
+	stages []Stage
+}
+
+// Record adds count of targets left at stage, counts of the same stage
+// are summed, e.g. images listed from each runtime of host
+func (f *Funnel) Record(name string, count int, filters ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.stages {
+		if f.stages[i].Name != name {
+			continue
+		}
+		f.stages[i].Count += count
+		for _, filter := range filters {
+			if !contains(f.stages[i].Filters, filter) {
+				f.stages[i].Filters = append(f.stages[i].Filters, filter)
+			}
+		}
+		return
+	}
+	f.stages = append(f.stages, Stage{Name: name, Count: count, Filters: append([]string(nil), filters...)})
+}
+
+// Stages returns stages in order they were first recorded
+func (f *Funnel) Stages() []Stage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stages := make([]Stage, 0, len(f.stages))
+	for _, s := range f.stages {
+		s.Filters = append([]string(nil), s.Filters...)
+		stages = append(stages, s)
+	}
+	return stages
+}
+
+// Write prints table of stages
+func (f *Funnel) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "STAGE\tTARGETS\tFILTERS\n")
+	for _, s := range f.Stages() {
+		filters := "-"
+		if len(s.Filters) > 0 {
+			filters = strings.Join(s.Filters, " ")
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", s.Name, s.Count, filters)
+	}
+	return tw.Flush()
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package target
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFunnel(t *testing.T) {
+	f := &Funnel{}
+	f.Record("listed", 3, "args=nginx")
+	f.Record("listed", 2, "args=nginx")
+	f.Record("opened", 0)
+	f.Record("scanned", 0)
+
+	assert.Equal(t, []Stage{
+		{Name: "listed", Count: 5, Filters: []string{"args=nginx"}},
+		{Name: "opened", Count: 0},
+		{Name: "scanned", Count: 0},
+	}, f.Stages())
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, f.Write(buf))
+	assert.Equal(t, "STAGE    TARGETS  FILTERS\n"+
+		"listed   5        args=nginx\n"+
+		"opened   0        -\n"+
+		"scanned  0        -\n", buf.String())
+}
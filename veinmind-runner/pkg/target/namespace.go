@@ -0,0 +1,130 @@
+package target
+
+import (
+	"github.com/pkg/errors"
+	"path"
+	"sort"
+	"strings"
+)
+
+var dockerHubDomains = map[string]struct{}{
+	"docker.io":            {},
+	"index.docker.io":      {},
+	"registry-1.docker.io": {},
+}
+
+// NamespaceFilter filters repos by namespaces of their paths, e.g.
+// team-a/serviceX of harbor.example.com/team-a/serviceX/app. Patterns
+// are OR'd, a pattern matches namespace or any of its parents, either
+// literally or as glob of path.Match. Server is the registry of repos
+// without domain, official images of docker hub are in library
+type NamespaceFilter struct {
+	Patterns []string
+	Server   string
+}
+
+// NewNamespaceFilter checks patterns and creates filter of them
+func NewNamespaceFilter(server string, patterns []string) (*NamespaceFilter, error) {
+	f := &NamespaceFilter{Server: server}
+	for _, p := range patterns {
+		p = strings.Trim(p, "/")
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, errors.Wrapf(err, "namespace %#v", p)
+		}
+		f.Patterns = append(f.Patterns, p)
+	}
+	return f, nil
+}
+
+// Namespace returns namespace of repo, empty for repos at top level
+func (f *NamespaceFilter) Namespace(repo string) string {
+	dir := path.Dir(f.repoPath(repo))
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// Match reports whether namespace of repo matches any pattern, every
+// repo matches filter without pattern
+func (f *NamespaceFilter) Match(repo string) bool {
+	if len(f.Patterns) == 0 {
+		return true
+	}
+
+	for ns := f.Namespace(repo); ns != "" && ns != "."; ns = path.Dir(ns) {
+		for _, p := range f.Patterns {
+			if ok, _ := path.Match(p, ns); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Filter returns repos matching filter, error listing namespaces of
+// repos is returned if none of them matches
+func (f *NamespaceFilter) Filter(repos []string) ([]string, error) {
+	if len(f.Patterns) == 0 {
+		return repos, nil
+	}
+
+	matched := []string{}
+	for _, repo := range repos {
+		if f.Match(repo) {
+			matched = append(matched, repo)
+		}
+	}
+	if len(matched) == 0 {
+		namespaces := f.Namespaces(repos)
+		if len(namespaces) == 0 {
+			return nil, errors.Errorf("namespace %s doesn't match any repos, no namespace is available", strings.Join(f.Patterns, ","))
+		}
+		return nil, errors.Errorf("namespace %s doesn't match any repos, available namespaces: %s",
+			strings.Join(f.Patterns, ","), strings.Join(namespaces, ", "))
+	}
+	return matched, nil
+}
+
+// Namespaces returns sorted namespaces of repos and their parents
+func (f *NamespaceFilter) Namespaces(repos []string) []string {
+	seen := map[string]struct{}{}
+	for _, repo := range repos {
+		for ns := f.Namespace(repo); ns != "" && ns != "."; ns = path.Dir(ns) {
+			seen[ns] = struct{}{}
+		}
+	}
+
+	namespaces := make([]string, 0, len(seen))
+	for ns := range seen {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// repoPath returns path of repo without domain, tag and digest
+func (f *NamespaceFilter) repoPath(repo string) string {
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo = repo[:i]
+	}
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+
+	domain := f.Server
+	if i := strings.Index(repo, "/"); i >= 0 {
+		first := repo[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			domain, repo = first, repo[i+1:]
+		}
+	}
+
+	if _, ok := dockerHubDomains[domain]; ok && !strings.Contains(repo, "/") {
+		repo = "library/" + repo
+	}
+	return repo
+}
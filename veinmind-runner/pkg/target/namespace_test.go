@@ -0,0 +1,67 @@
+package target
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNamespaceFilter(t *testing.T) {
+	repos := []string{
+		"harbor.example.com/team-a/serviceX/api:v1",
+		"harbor.example.com/team-a/serviceY/web",
+		"harbor.example.com/team-b/db@sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		"harbor.example.com/top",
+	}
+
+	f, err := NewNamespaceFilter("harbor.example.com", []string{"team-a/serviceX"})
+	assert.NoError(t, err)
+	assert.Equal(t, repos[:1], mustFilter(t, f, repos))
+
+	// First segment keeps matching every namespace under it
+	f, _ = NewNamespaceFilter("harbor.example.com", []string{"team-a"})
+	assert.Equal(t, repos[:2], mustFilter(t, f, repos))
+
+	// Patterns are OR'd and can be globs
+	f, _ = NewNamespaceFilter("harbor.example.com", []string{"team-a/*Y", "team-b"})
+	assert.Equal(t, repos[1:3], mustFilter(t, f, repos))
+	f, _ = NewNamespaceFilter("harbor.example.com", []string{"team-?"})
+	assert.Equal(t, repos[:3], mustFilter(t, f, repos))
+
+	_, err = NewNamespaceFilter("harbor.example.com", []string{"team-["})
+	assert.Error(t, err)
+
+	// Candidates are listed if nothing matches
+	f, _ = NewNamespaceFilter("harbor.example.com", []string{"team-c"})
+	_, err = f.Filter(repos)
+	assert.EqualError(t, err, "namespace team-c doesn't match any repos, available namespaces: "+
+		"team-a, team-a/serviceX, team-a/serviceY, team-b")
+
+	// Filter without pattern keeps every repo
+	f, _ = NewNamespaceFilter("harbor.example.com", nil)
+	assert.Equal(t, repos, mustFilter(t, f, repos))
+}
+
+func TestNamespaceFilterDockerHub(t *testing.T) {
+	// Official images of docker hub are in library namespace, whether
+	// domain is given or implied by server
+	f, _ := NewNamespaceFilter("index.docker.io", []string{"library"})
+	assert.True(t, f.Match("nginx"))
+	assert.True(t, f.Match("nginx:1.21"))
+	assert.True(t, f.Match("library/nginx"))
+	assert.True(t, f.Match("docker.io/nginx"))
+	assert.False(t, f.Match("bitnami/nginx"))
+	assert.Equal(t, "library", f.Namespace("docker.io/library/redis:7"))
+
+	// Repos at top level of other registries have no namespace
+	f, _ = NewNamespaceFilter("harbor.example.com", []string{"library"})
+	assert.False(t, f.Match("nginx"))
+	assert.True(t, f.Match("docker.io/nginx"))
+	assert.Equal(t, "", f.Namespace("localhost:5000/nginx"))
+	assert.Equal(t, []string{"library"}, f.Namespaces([]string{"nginx", "docker.io/nginx"}))
+}
+
+func mustFilter(t *testing.T, f *NamespaceFilter, repos []string) []string {
+	matched, err := f.Filter(repos)
+	assert.NoError(t, err)
+	return matched
+}
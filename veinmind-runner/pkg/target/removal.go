@@ -0,0 +1,154 @@
+package target
+
+import "sync"
+
+// Removals defers removal of pulled images while scans of images
+// sharing their layers are in flight, e.g. tags of the same image or
+// images of the same base scanned concurrently. Images are removed
+// once no active scan references any of their layers, images left at
+// the end of the run are removed by Sweep
+type Removals struct {
+	layers func(id string) ([]string, error)
+	remove func(id string) error
+	tally  *Tally
+
+	mu      sync.Mutex
+	refs    map[string]int
+	keys    map[string][]string
+	pending []removal
+}
+
+type removal struct {
+	target string
+	id     string
+}
+
+// NewRemovals returns removals of images by remove, layers returns
+// layers of image, e.g. diff ids. Images whose layers are unknown only
+// share content with images of the same id. Failed removals are tallied
+func NewRemovals(layers func(id string) ([]string, error), remove func(id string) error, tally *Tally) *Removals {
+	return &Removals{
+		layers: layers,
+		remove: remove,
+		tally:  tally,
+		refs:   map[string]int{},
+		keys:   map[string][]string{},
+	}
+}
+
+// keysOf returns keys of content of image, its id and its layers
+func (r *Removals) keysOf(id string) []string {
+	r.mu.Lock()
+	keys, ok := r.keys[id]
+	r.mu.Unlock()
+	if ok {
+		return keys
+	}
+
+	keys = []string{id}
+	if r.layers != nil {
+		if layers, err := r.layers(id); err == nil {
+			keys = append(keys, layers...)
+		}
+	}
+
+	r.mu.Lock()
+	r.keys[id] = keys
+	r.mu.Unlock()
+	return keys
+}
+
+// Acquire marks content of images as referenced by an active scan, it
+// waits for removals in progress
+func (r *Removals) Acquire(ids []string) {
+	keys := [][]string{}
+	for _, id := range ids {
+		keys = append(keys, r.keysOf(id))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, k := range keys {
+		for _, key := range k {
+			r.refs[key]++
+		}
+	}
+}
+
+// Release releases content of images after their scans, removals
+// deferred for them are done. An error is returned only when tally
+// fails fast
+func (r *Removals) Release(ids []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		for _, key := range r.keys[id] {
+			if r.refs[key]--; r.refs[key] <= 0 {
+				delete(r.refs, key)
+			}
+		}
+	}
+	return r.removePending(false)
+}
+
+// Remove removes image of target once no active scan references its
+// content. An error is returned only when tally fails fast
+func (r *Removals) Remove(target string, id string) error {
+	r.keysOf(id)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Tags of the same image are removed along with the image
+	for _, p := range r.pending {
+		if p.id == id {
+			return nil
+		}
+	}
+	r.pending = append(r.pending, removal{target: target, id: id})
+	return r.removePending(false)
+}
+
+// Sweep removes images whose removals are still deferred, it's called
+// once no scan is left
+func (r *Removals) Sweep() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.removePending(true)
+}
+
+// Pending returns number of deferred removals
+func (r *Removals) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+// removePending removes images of pending removals whose content isn't
+// referenced, all of them if force. Images are removed with lock held so
+// that no scan acquires them meanwhile
+func (r *Removals) removePending(force bool) error {
+	var abort error
+	left := []removal{}
+	for _, p := range r.pending {
+		if !force && r.referenced(p.id) {
+			left = append(left, p)
+			continue
+		}
+		if err := r.remove(p.id); err != nil {
+			if err := r.tally.Fail(p.target, StageRemove, err); err != nil && abort == nil {
+				abort = err
+			}
+		}
+	}
+	r.pending = left
+	return abort
+}
+
+func (r *Removals) referenced(id string) bool {
+	for _, key := range r.keys[id] {
+		if r.refs[key] > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package target
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRuntime flags removal of image while a scan of an image sharing
+// its layers is active
+type fakeRuntime struct {
+	mu         sync.Mutex
+	layers     map[string][]string
+	present    map[string]bool
+	scanning   map[string]int
+	removed    []string
+	violations []string
+}
+
+func newFakeRuntime(layers map[string][]string) *fakeRuntime {
+	return &fakeRuntime{layers: layers, present: map[string]bool{}, scanning: map[string]int{}}
+}
+
+func (r *fakeRuntime) pull(target string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.present[target] = true
+	return target, nil
+}
+
+func (r *fakeRuntime) find(id string) ([]string, error) {
+	return []string{id}, nil
+}
+
+func (r *fakeRuntime) scan(id string) error {
+	r.mu.Lock()
+	if !r.present[id] {
+		r.mu.Unlock()
+		return errors.Errorf("layer of %s not found", id)
+	}
+	for _, l := range r.layers[id] {
+		r.scanning[l]++
+	}
+	r.mu.Unlock()
+
+	time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range r.layers[id] {
+		r.scanning[l]--
+	}
+	return nil
+}
+
+func (r *fakeRuntime) remove(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range r.layers[id] {
+		if r.scanning[l] > 0 {
+			r.violations = append(r.violations, fmt.Sprintf("%s removed while layer %s is scanned", id, l))
+		}
+	}
+	r.present[id] = false
+	r.removed = append(r.removed, id)
+	return nil
+}
+
+func (r *fakeRuntime) imageLayers(id string) ([]string, error) {
+	return r.layers[id], nil
+}
+
+func TestRemovalsStress(t *testing.T) {
+	layers := map[string][]string{}
+	targets := []string{}
+	for i := 0; i < 40; i++ {
+		id := fmt.Sprintf("image-%d", i)
+		// Images share base layers of their group
+		layers[id] = []string{fmt.Sprintf("base-%d", i%4), "layer-" + id}
+		targets = append(targets, id)
+	}
+	runtime := newFakeRuntime(layers)
+
+	tally := &Tally{}
+	steps := Steps{
+		Pull: runtime.pull,
+		Find: runtime.find,
+		Scan: runtime.scan,
+	}
+	steps.Removals = NewRemovals(runtime.imageLayers, runtime.remove, tally)
+
+	ch := make(chan string)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range ch {
+				assert.NoError(t, Run(target, steps, tally))
+			}
+		}()
+	}
+	for _, target := range targets {
+		ch <- target
+	}
+	close(ch)
+	wg.Wait()
+	assert.NoError(t, steps.Removals.Sweep())
+
+	assert.Empty(t, runtime.violations)
+	assert.Empty(t, tally.Failures())
+	assert.Len(t, runtime.removed, len(targets))
+	assert.Equal(t, 0, steps.Removals.Pending())
+}
+
+func TestRemovalsShared(t *testing.T) {
+	var removed []string
+	r := NewRemovals(func(id string) ([]string, error) {
+		return []string{"base"}, nil
+	}, func(id string) error {
+		removed = append(removed, id)
+		return nil
+	}, &Tally{})
+
+	// Tags of the same image are removed once the last scan of it ends
+	r.Acquire([]string{"a"})
+	r.Acquire([]string{"a"})
+	assert.NoError(t, r.Remove("nginx:1", "a"))
+	assert.NoError(t, r.Release([]string{"a"}))
+	assert.NoError(t, r.Remove("nginx:latest", "a"))
+	assert.Empty(t, removed)
+	assert.NoError(t, r.Release([]string{"a"}))
+	assert.Equal(t, []string{"a"}, removed)
+
+	// Removal is deferred while an image of the same base is scanned
+	r.Acquire([]string{"b"})
+	assert.NoError(t, r.Remove("redis", "c"))
+	assert.Equal(t, 1, r.Pending())
+	assert.NoError(t, r.Sweep())
+	assert.Equal(t, []string{"a", "c"}, removed)
+}
+
+func TestRemovalsFailure(t *testing.T) {
+	tally := &Tally{FailFast: true}
+	r := NewRemovals(nil, func(id string) error {
+		return errors.New("fake")
+	}, tally)
+
+	r.Acquire([]string{"a"})
+	assert.NoError(t, r.Remove("nginx", "a"))
+	assert.EqualError(t, r.Release([]string{"a"}), "remove nginx: fake")
+	assert.Len(t, tally.Failures(), 1)
+}
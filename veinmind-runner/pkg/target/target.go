@@ -0,0 +1,171 @@
+// Package target runs per-target steps of registry scans, failures of
+// a target are tallied instead of aborting the whole run
+package target
+
+import (
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// stages where a target fails, StageThrottle is waiting for throttled
+// scans before the target starts
+const (
+	StageThrottle = "throttle"
+	StageResolve  = "resolve"
+	StagePull     = "pull"
+	StageFind     = "find"
+	StageScan     = "scan"
+	StageRemove   = "remove"
+)
+
+var ErrNoImage = errors.New("no image found for pulled reference")
+
+type Failure struct {
+	Target string `json:"target"`
+	Stage  string `json:"stage"`
+	Error  string `json:"error"`
+	// Source and Runtime are where target is scanned from, so that it
+	// can be rescanned
+	Source  string `json:"source,omitempty"`
+	Runtime string `json:"runtime,omitempty"`
+	// Code classifies the error for automation
+	Code errcode.Code `json:"code,omitempty"`
+}
+
+// Tally collects failures of targets, with FailFast the first failure
+// is returned to abort the run. Failures are marked with Source and
+// Runtime of tally
+type Tally struct {
+	FailFast bool
+	Source   string
+	Runtime  string
+
+	mu       sync.Mutex
+	failures []Failure
+}
+
+// Fail records failure of target, an error is returned only when
+// tally fails fast
+func (t *Tally) Fail(target string, stage string, err error) error {
+	log.Errorf("Target %#v failed to %s: %s\n", target, stage, err.Error())
+	if hint := errcode.Of(err).Hint; hint != "" {
+		log.Warnf("hint: %s\n", hint)
+	}
+
+	t.mu.Lock()
+	t.failures = append(t.failures, Failure{
+		Target:  target,
+		Stage:   stage,
+		Error:   err.Error(),
+		Source:  t.Source,
+		Runtime: t.Runtime,
+		Code:    errcode.CodeOf(err),
+	})
+	t.mu.Unlock()
+
+	if t.FailFast {
+		return errors.Wrapf(err, "%s %s", stage, target)
+	}
+	return nil
+}
+
+func (t *Tally) Failures() []Failure {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Failure(nil), t.failures...)
+}
+
+// Steps of a registry target, Skip and Verify are optional and targets
+// they reject are skipped without failure. Local is optional too,
+// images of target it finds locally are scanned without pulling or
+// removal. With Removals images are removed by it instead of Remove
+// once no scan of targets run concurrently shares their content
+type Steps struct {
+	Skip   func(target string) bool
+	Verify func(target string) bool
+	Local  func(target string) ([]string, bool)
+	Pull   func(target string) (string, error)
+	Find   func(pulled string) ([]string, error)
+	Scan   func(id string) error
+	Remove func(id string) error
+
+	Removals *Removals
+}
+
+// Run pulls target, scans images found and removes them afterwards,
+// images are removed even if scanning failed, images already present
+// locally are kept
+func Run(target string, steps Steps, tally *Tally) error {
+	if steps.Skip != nil && steps.Skip(target) {
+		return nil
+	}
+	if steps.Verify != nil && !steps.Verify(target) {
+		log.Warnf("Skip unsigned image: %#v\n", target)
+		return nil
+	}
+
+	if steps.Local != nil {
+		if ids, ok := steps.Local(target); ok {
+			return scanIDs(target, ids, steps, tally, false)
+		}
+	}
+
+	pulled, err := steps.Pull(target)
+	if err != nil {
+		return tally.Fail(target, StagePull, err)
+	}
+
+	ids, err := steps.Find(pulled)
+	if err == nil && len(ids) == 0 {
+		err = ErrNoImage
+	}
+	if err != nil {
+		return tally.Fail(target, StageFind, err)
+	}
+	return scanIDs(target, ids, steps, tally, true)
+}
+
+// scanIDs scans images of target and removes them afterwards if remove,
+// images are removed even if scanning failed. With Removals content of
+// images is referenced meanwhile, and removals are requested before it
+// is released so that tags of the same image are removed once
+func scanIDs(target string, ids []string, steps Steps, tally *Tally, remove bool) error {
+	if steps.Removals != nil {
+		steps.Removals.Acquire(ids)
+	}
+
+	var abort error
+	for _, id := range ids {
+		if err := steps.Scan(id); err != nil {
+			if abort = tally.Fail(target, StageScan, err); abort != nil {
+				break
+			}
+		}
+	}
+
+	for _, id := range ids {
+		if !remove {
+			break
+		}
+
+		var err error
+		if steps.Removals != nil {
+			err = steps.Removals.Remove(target, id)
+		} else if err = steps.Remove(id); err != nil {
+			err = tally.Fail(target, StageRemove, err)
+		}
+		if err != nil && abort == nil {
+			abort = err
+		}
+	}
+
+	if steps.Removals != nil {
+		if err := steps.Removals.Release(ids); err != nil && abort == nil {
+			abort = err
+		}
+	}
+	return abort
+}
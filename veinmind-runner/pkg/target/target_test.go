@@ -0,0 +1,166 @@
+package target
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/errcode"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	errFake := errors.New("fake")
+
+	for _, tc := range []struct {
+		name     string
+		steps    func(removed *[]string) Steps
+		failures []Failure
+		removed  []string
+	}{
+		{
+			name: "success",
+			steps: func(removed *[]string) Steps {
+				return Steps{
+					Pull:   func(string) (string, error) { return "nginx", nil },
+					Find:   func(string) ([]string, error) { return []string{"a", "b"}, nil },
+					Scan:   func(string) error { return nil },
+					Remove: func(id string) error { *removed = append(*removed, id); return nil },
+				}
+			},
+			removed: []string{"a", "b"},
+		},
+		{
+			name: "unsigned",
+			steps: func(removed *[]string) Steps {
+				return Steps{
+					Verify: func(string) bool { return false },
+					Pull:   func(string) (string, error) { panic("pulled unsigned image") },
+				}
+			},
+		},
+		{
+			name: "artifact",
+			steps: func(removed *[]string) Steps {
+				return Steps{
+					Skip:   func(string) bool { return true },
+					Verify: func(string) bool { panic("verified artifact") },
+					Pull:   func(string) (string, error) { panic("pulled artifact") },
+				}
+			},
+		},
+		{
+			name: "local",
+			steps: func(removed *[]string) Steps {
+				return Steps{
+					Local:  func(string) ([]string, bool) { return []string{"a"}, true },
+					Pull:   func(string) (string, error) { panic("pulled local image") },
+					Scan:   func(string) error { return nil },
+					Remove: func(id string) error { *removed = append(*removed, id); return nil },
+				}
+			},
+		},
+		{
+			name: "not local",
+			steps: func(removed *[]string) Steps {
+				return Steps{
+					Local:  func(string) ([]string, bool) { return nil, false },
+					Pull:   func(string) (string, error) { return "nginx", nil },
+					Find:   func(string) ([]string, error) { return []string{"a"}, nil },
+					Scan:   func(string) error { return nil },
+					Remove: func(id string) error { *removed = append(*removed, id); return nil },
+				}
+			},
+			removed: []string{"a"},
+		},
+		{
+			name: "pull",
+			steps: func(removed *[]string) Steps {
+				return Steps{
+					Pull: func(string) (string, error) { return "", errFake },
+				}
+			},
+			failures: []Failure{{Target: "nginx", Stage: StagePull, Error: "fake", Code: errcode.Unknown}},
+		},
+		{
+			name: "find",
+			steps: func(removed *[]string) Steps {
+				return Steps{
+					Pull: func(string) (string, error) { return "nginx", nil },
+					Find: func(string) ([]string, error) { return nil, errFake },
+				}
+			},
+			failures: []Failure{{Target: "nginx", Stage: StageFind, Error: "fake", Code: errcode.Unknown}},
+		},
+		{
+			name: "no image",
+			steps: func(removed *[]string) Steps {
+				return Steps{
+					Pull: func(string) (string, error) { return "nginx", nil },
+					Find: func(string) ([]string, error) { return nil, nil },
+				}
+			},
+			failures: []Failure{{Target: "nginx", Stage: StageFind, Error: ErrNoImage.Error(), Code: errcode.Unknown}},
+		},
+		{
+			name: "scan",
+			steps: func(removed *[]string) Steps {
+				return Steps{
+					Pull: func(string) (string, error) { return "nginx", nil },
+					Find: func(string) ([]string, error) { return []string{"a", "b"}, nil },
+					Scan: func(id string) error {
+						if id == "a" {
+							return errFake
+						}
+						return nil
+					},
+					Remove: func(id string) error { *removed = append(*removed, id); return nil },
+				}
+			},
+			failures: []Failure{{Target: "nginx", Stage: StageScan, Error: "fake", Code: errcode.Unknown}},
+			removed:  []string{"a", "b"},
+		},
+		{
+			name: "remove",
+			steps: func(removed *[]string) Steps {
+				return Steps{
+					Pull:   func(string) (string, error) { return "nginx", nil },
+					Find:   func(string) ([]string, error) { return []string{"a"}, nil },
+					Scan:   func(string) error { return nil },
+					Remove: func(string) error { return errFake },
+				}
+			},
+			failures: []Failure{{Target: "nginx", Stage: StageRemove, Error: "fake", Code: errcode.Unknown}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var removed []string
+			tally := &Tally{}
+			assert.NoError(t, Run("nginx", tc.steps(&removed), tally))
+			assert.Equal(t, tc.failures, tally.Failures())
+			assert.Equal(t, tc.removed, removed)
+		})
+	}
+}
+
+func TestRunFailFast(t *testing.T) {
+	var (
+		scanned []string
+		removed []string
+	)
+	steps := Steps{
+		Pull: func(string) (string, error) { return "nginx", nil },
+		Find: func(string) ([]string, error) { return []string{"a", "b"}, nil },
+		Scan: func(id string) error {
+			scanned = append(scanned, id)
+			return errors.New("fake")
+		},
+		Remove: func(id string) error { removed = append(removed, id); return nil },
+	}
+
+	tally := &Tally{FailFast: true}
+	err := Run("nginx", steps, tally)
+	assert.EqualError(t, err, "scan nginx: fake")
+	assert.Equal(t, []string{"a"}, scanned)
+	// Pulled images are removed even if the run is aborted
+	assert.Equal(t, []string{"a", "b"}, removed)
+	assert.Len(t, tally.Failures(), 1)
+}
@@ -0,0 +1,227 @@
+// Package tenant tags findings of scanners shared by teams with tenants
+// owning their images, so that reports, notifications and gates are
+// separated per tenant
+package tenant
+
+import (
+	"bufio"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/distribution/distribution/reference"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Default is tenant of targets which no rule tags
+const Default = "default"
+
+// validName matches names of tenants, which are used as directories of
+// split outputs
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Rule tags targets matching Pattern with Tenant, Pattern is matched by
+// path.Match against image id and references in both normalized and
+// familiar forms, e.g. docker.io/library/nginx:1.21 and nginx:1.21
+type Rule struct {
+	Tenant  string
+	Pattern string
+}
+
+// Config is tenants file, rules are tried in order of file. Webhooks
+// are urls notified of findings of tenants
+type Config struct {
+	Rules    []Rule
+	Webhooks map[string]string
+}
+
+// CheckName checks whether name is a valid name of tenant
+func CheckName(name string) error {
+	if !validName.MatchString(name) {
+		return errors.Errorf("invalid tenant name %#v", name)
+	}
+	return nil
+}
+
+// Load reads tenants file, see Parse
+func Load(name string) (*Config, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c, err := Parse(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "tenants file %#v", name)
+	}
+	return c, nil
+}
+
+// Parse parses lines of "tenant=<name> image=<pattern>" tagging images
+// and "tenant=<name> webhook=<url>" routing notifications, both can be
+// given in one line. Blank lines and lines starting with # are ignored
+func Parse(r io.Reader) (*Config, error) {
+	c := &Config{Webhooks: map[string]string{}}
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := map[string]string{}
+		for _, f := range strings.Fields(line) {
+			i := strings.Index(f, "=")
+			if i <= 0 {
+				return nil, errors.Errorf("line %d: expect key=value, got %#v", n, f)
+			}
+			key, value := f[:i], f[i+1:]
+			switch key {
+			case "tenant", "image", "webhook":
+			default:
+				return nil, errors.Errorf("line %d: unknown key %#v", n, key)
+			}
+			if _, ok := fields[key]; ok {
+				return nil, errors.Errorf("line %d: duplicated key %#v", n, key)
+			}
+			fields[key] = value
+		}
+
+		name := fields["tenant"]
+		if err := CheckName(name); err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+		image, hasImage := fields["image"]
+		webhook, hasWebhook := fields["webhook"]
+		if !hasImage && !hasWebhook {
+			return nil, errors.Errorf("line %d: expect image or webhook of tenant %#v", n, name)
+		}
+		if hasImage {
+			if _, err := path.Match(image, ""); err != nil || image == "" {
+				return nil, errors.Errorf("line %d: invalid image pattern %#v", n, image)
+			}
+			c.Rules = append(c.Rules, Rule{Tenant: name, Pattern: image})
+		}
+		if hasWebhook {
+			if previous, ok := c.Webhooks[name]; ok && previous != webhook {
+				return nil, errors.Errorf("line %d: tenant %#v has more than one webhook", n, name)
+			}
+			c.Webhooks[name] = webhook
+		}
+	}
+	return c, scanner.Err()
+}
+
+func (r Rule) match(refs []string) bool {
+	candidates := []string{}
+	for _, ref := range refs {
+		candidates = append(candidates, ref)
+		if named, err := reference.ParseDockerRef(ref); err == nil {
+			candidates = append(candidates, named.String(), reference.FamiliarString(named))
+		}
+	}
+
+	for _, c := range candidates {
+		if ok, _ := path.Match(r.Pattern, c); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Tagger resolves tenants of targets, targets no rule of Config tags
+// belong to Fallback, or Default if it's empty
+type Tagger struct {
+	Config   *Config
+	Fallback string
+}
+
+// Tenant returns tenant of target of refs
+func (t Tagger) Tenant(refs []string) string {
+	if t.Config != nil {
+		for _, r := range t.Config.Rules {
+			if r.match(refs) {
+				return r.Tenant
+			}
+		}
+	}
+	if t.Fallback != "" {
+		return t.Fallback
+	}
+	return Default
+}
+
+// Tag stamps tenants on events and coverage of report. Coverage is
+// matched by references of events of its image as well as its own
+func (t Tagger) Tag(doc *reporter.Report) {
+	imageRefs := map[string][]string{}
+	for i := range doc.Events {
+		evt := &doc.Events[i]
+		refs := eventRefs(*evt)
+		evt.Tenant = t.Tenant(refs)
+		imageRefs[evt.ID] = append(imageRefs[evt.ID], refs...)
+	}
+
+	for i := range doc.Metadata.Coverage {
+		c := &doc.Metadata.Coverage[i]
+		refs := append([]string{c.ImageID}, imageRefs[c.ImageID]...)
+		if c.Ref != "" {
+			refs = append(refs, c.Ref)
+		}
+		c.Tenant = t.Tenant(refs)
+	}
+}
+
+func eventRefs(evt reporter.Event) []string {
+	refs := append([]string{evt.ID}, evt.ImageRefs...)
+	if evt.Image != nil {
+		refs = append(refs, evt.Image.RepoRefs...)
+		refs = append(refs, evt.Image.RepoDigests...)
+	}
+	return refs
+}
+
+// Tenants returns sorted tenants of events and coverage of report
+func Tenants(doc reporter.Report) []string {
+	seen := map[string]struct{}{}
+	for _, evt := range doc.Events {
+		seen[evt.Tenant] = struct{}{}
+	}
+	for _, c := range doc.Metadata.Coverage {
+		seen[c.Tenant] = struct{}{}
+	}
+	delete(seen, "")
+
+	tenants := []string{}
+	for name := range seen {
+		tenants = append(tenants, name)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// Filter returns report of tenant, events and coverage of the other
+// tenants are dropped while the rest of metadata is kept
+func Filter(doc reporter.Report, tenant string) reporter.Report {
+	filtered := doc
+	filtered.Events = []reporter.Event{}
+	for _, evt := range doc.Events {
+		if evt.Tenant == tenant {
+			filtered.Events = append(filtered.Events, evt)
+		}
+	}
+
+	filtered.Metadata.Coverage = nil
+	for _, c := range doc.Metadata.Coverage {
+		if c.Tenant == tenant {
+			filtered.Metadata.Coverage = append(filtered.Metadata.Coverage, c)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,114 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/cibuild"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	c, err := Parse(strings.NewReader(`
+# payments team
+tenant=payments image=registry.internal/payments/*
+tenant=payments image=redis:* webhook=https://hooks.internal/payments
+tenant=search webhook=https://hooks.internal/search
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Rule{
+		{Tenant: "payments", Pattern: "registry.internal/payments/*"},
+		{Tenant: "payments", Pattern: "redis:*"},
+	}, c.Rules)
+	assert.Equal(t, map[string]string{
+		"payments": "https://hooks.internal/payments",
+		"search":   "https://hooks.internal/search",
+	}, c.Webhooks)
+
+	for _, line := range []string{
+		"image=nginx:*",
+		"tenant=../payments image=nginx:*",
+		"tenant=payments",
+		"tenant=payments image=[",
+		"tenant=payments team=payments",
+		"tenant=payments image=a image=b",
+		"tenant=payments webhook=https://a\ntenant=payments webhook=https://b",
+	} {
+		_, err := Parse(strings.NewReader(line))
+		assert.Error(t, err, line)
+	}
+}
+
+func TestTagger(t *testing.T) {
+	tagger := Tagger{Config: &Config{Rules: []Rule{
+		{Tenant: "payments", Pattern: "registry.internal/payments/*"},
+		{Tenant: "cache", Pattern: "redis:*"},
+	}}}
+	assert.Equal(t, "payments", tagger.Tenant([]string{"registry.internal/payments/api:1.0"}))
+	// Familiar and normalized forms of references are matched
+	assert.Equal(t, "cache", tagger.Tenant([]string{"docker.io/library/redis:6"}))
+	assert.Equal(t, Default, tagger.Tenant([]string{"nginx:1.21"}))
+
+	tagger.Fallback = "platform"
+	assert.Equal(t, "platform", tagger.Tenant([]string{"nginx:1.21"}))
+}
+
+func TestTag(t *testing.T) {
+	doc := reporter.Report{
+		Events: []reporter.Event{
+			{ReportEvent: report.ReportEvent{ID: "sha256:a"}, ImageRefs: []string{"redis:6"}},
+			{ReportEvent: report.ReportEvent{ID: "sha256:b"}, ImageRefs: []string{"nginx:1.21"}},
+		},
+		Metadata: reporter.Metadata{Coverage: []reporter.Coverage{
+			{ImageID: "sha256:a", Scope: reporter.ScopeFullImage},
+			{ImageID: "sha256:c", Ref: "redis:7", Scope: reporter.ScopeFailed},
+			{ImageID: "sha256:d", Scope: reporter.ScopeFullImage},
+		}},
+	}
+	Tagger{Config: &Config{Rules: []Rule{{Tenant: "cache", Pattern: "redis:*"}}}}.Tag(&doc)
+
+	assert.Equal(t, "cache", doc.Events[0].Tenant)
+	assert.Equal(t, Default, doc.Events[1].Tenant)
+	// Coverage is tagged by references of events of its image
+	assert.Equal(t, "cache", doc.Metadata.Coverage[0].Tenant)
+	assert.Equal(t, "cache", doc.Metadata.Coverage[1].Tenant)
+	assert.Equal(t, Default, doc.Metadata.Coverage[2].Tenant)
+
+	assert.Equal(t, []string{"cache", Default}, Tenants(doc))
+	cache := Filter(doc, "cache")
+	assert.Len(t, cache.Events, 1)
+	assert.Len(t, cache.Metadata.Coverage, 2)
+	// The whole report is kept
+	assert.Len(t, doc.Events, 2)
+}
+
+func TestNotify(t *testing.T) {
+	var received Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	doc := reporter.Report{Events: []reporter.Event{
+		{ReportEvent: report.ReportEvent{ID: "sha256:a", Level: report.High}},
+		{ReportEvent: report.ReportEvent{ID: "sha256:a", Level: report.High}},
+	}}
+	doc.Metadata.Build = &cibuild.Build{Provider: "gitlab", ID: "7", URL: "https://gitlab.example.com/team/app/-/pipelines/7", Commit: "abc"}
+	assert.NoError(t, Notify(context.Background(), server.Client(), server.URL, NewNotification("cache", doc)))
+	assert.Equal(t, "cache", received.Tenant)
+	assert.Equal(t, 2, received.Events)
+	assert.Equal(t, map[string]int{"High": 2}, received.Levels)
+	assert.Equal(t, &cibuild.Ref{Provider: "gitlab", ID: "7", URL: "https://gitlab.example.com/team/app/-/pipelines/7"}, received.Build)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad hook", http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	assert.Error(t, Notify(context.Background(), failing.Client(), failing.URL, NewNotification("cache", doc)))
+}
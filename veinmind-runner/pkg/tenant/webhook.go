@@ -0,0 +1,61 @@
+package tenant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/cibuild"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Notification is posted to webhook of tenant after scan, Levels are
+// numbers of events by level and Build links CI build of the scan
+type Notification struct {
+	Tenant string          `json:"tenant"`
+	Events int             `json:"events"`
+	Levels map[string]int  `json:"levels"`
+	Build  *cibuild.Ref    `json:"build,omitempty"`
+	Report reporter.Report `json:"report"`
+}
+
+// NewNotification returns notification of report of tenant
+func NewNotification(tenant string, doc reporter.Report) Notification {
+	n := Notification{Tenant: tenant, Events: len(doc.Events), Levels: map[string]int{}, Report: doc}
+	for _, evt := range doc.Events {
+		n.Levels[reporter.LevelString(evt.Level)]++
+	}
+	if doc.Metadata.Build != nil {
+		n.Build = doc.Metadata.Build.Ref()
+	}
+	return n
+}
+
+// Notify posts notification to webhook url
+func Notify(ctx context.Context, client *http.Client, url string, n Notification) error {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("webhook of tenant %#v: %s %s", n.Tenant, resp.Status, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package threatintel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"net/http"
+	"time"
+)
+
+const DefaultBatchSize = 100
+
+// API looks up hashes through HTTP, hashes are posted in batches as
+// {"hashes": [...]} and matches are responded as {"matches": [...]}
+type API struct {
+	URL       string
+	Token     string
+	BatchSize int
+	Client    *http.Client
+}
+
+func NewAPI(url string, token string) *API {
+	return &API{
+		URL:       url,
+		Token:     token,
+		BatchSize: DefaultBatchSize,
+		Client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (a *API) Lookup(ctx context.Context, hashes []string) (map[string]reporter.ThreatIntel, error) {
+	matches := map[string]reporter.ThreatIntel{}
+	for start := 0; start < len(hashes); start += a.BatchSize {
+		end := start + a.BatchSize
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+
+		batch, err := a.lookup(ctx, hashes[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range batch {
+			if m.Source == "" {
+				m.Source = "api"
+			}
+			matches[m.SHA256] = m
+		}
+	}
+
+	return matches, nil
+}
+
+func (a *API) lookup(ctx context.Context, hashes []string) ([]reporter.ThreatIntel, error) {
+	body, err := json.Marshal(map[string][]string{"hashes": hashes})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.Errorf("threat intelligence api: %s", resp.Status)
+	}
+
+	result := struct {
+		Matches []reporter.ThreatIntel `json:"matches"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return result.Matches, nil
+}
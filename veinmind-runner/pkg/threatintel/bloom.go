@@ -0,0 +1,141 @@
+package threatintel
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// bloomMagic is the header of bloom filter file, followed by number of
+// hash functions (uint32), number of bits (uint64) and the bits, all
+// integers are big endian
+const bloomMagic = "VMBF"
+
+// Bloom is a bloom filter of sha256, matches may be false positive
+type Bloom struct {
+	Source string
+	k      uint32
+	m      uint64
+	bits   []uint64
+}
+
+// NewBloom creates bloom filter of m bits and k hash functions
+func NewBloom(m uint64, k uint32) *Bloom {
+	if m == 0 {
+		m = 1
+	}
+	if k == 0 {
+		k = 1
+	}
+
+	return &Bloom{
+		k:    k,
+		m:    m,
+		bits: make([]uint64, (m+63)/64),
+	}
+}
+
+func ReadBloom(r io.Reader) (*Bloom, error) {
+	header := struct {
+		Magic [4]byte
+		K     uint32
+		M     uint64
+	}{}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+
+	if string(header.Magic[:]) != bloomMagic {
+		return nil, errors.New("bloom: invalid magic")
+	}
+	if header.K == 0 || header.M == 0 {
+		return nil, errors.New("bloom: invalid parameters")
+	}
+
+	b := NewBloom(header.M, header.K)
+	if err := binary.Read(r, binary.BigEndian, b.bits); err != nil {
+		return nil, errors.Wrap(err, "bloom: truncated bits")
+	}
+
+	return b, nil
+}
+
+func (b *Bloom) WriteTo(w io.Writer) (int64, error) {
+	header := struct {
+		Magic [4]byte
+		K     uint32
+		M     uint64
+	}{K: b.k, M: b.m}
+	copy(header.Magic[:], bloomMagic)
+
+	if err := binary.Write(w, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	if err := binary.Write(w, binary.BigEndian, b.bits); err != nil {
+		return 16, err
+	}
+
+	return 16 + int64(len(b.bits))*8, nil
+}
+
+// Add adds sha256 in hex to bloom filter
+func (b *Bloom) Add(sha256 string) error {
+	sum, err := decodeSHA256(sha256)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range b.indexes(sum) {
+		b.bits[i/64] |= 1 << (i % 64)
+	}
+	return nil
+}
+
+// Test reports whether sha256 in hex may be in bloom filter
+func (b *Bloom) Test(sha256 string) bool {
+	sum, err := decodeSHA256(sha256)
+	if err != nil {
+		return false
+	}
+
+	for _, i := range b.indexes(sum) {
+		if b.bits[i/64]&(1<<(i%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Bloom) Lookup(ctx context.Context, hashes []string) (map[string]reporter.ThreatIntel, error) {
+	matches := map[string]reporter.ThreatIntel{}
+	for _, h := range hashes {
+		if b.Test(h) {
+			matches[h] = reporter.ThreatIntel{SHA256: h, Tag: "blacklist", Source: b.Source}
+		}
+	}
+
+	return matches, nil
+}
+
+// indexes derives k bit indexes from sha256 by double hashing, sha256
+// is uniform so that no further hashing is needed
+func (b *Bloom) indexes(sum []byte) []uint64 {
+	h1 := binary.BigEndian.Uint64(sum[0:8])
+	h2 := binary.BigEndian.Uint64(sum[8:16]) | 1
+
+	indexes := make([]uint64, b.k)
+	for i := uint64(0); i < uint64(b.k); i++ {
+		indexes[i] = (h1 + i*h2) % b.m
+	}
+	return indexes
+}
+
+func decodeSHA256(s string) ([]byte, error) {
+	if !sha256Regexp.MatchString(s) {
+		return nil, errors.Errorf("bloom: %#v isn't a sha256", s)
+	}
+	return hex.DecodeString(s)
+}
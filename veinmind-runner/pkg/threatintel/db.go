@@ -0,0 +1,77 @@
+// Package threatintel looks up file hashes of events against hash
+// blacklists and threat intelligence APIs
+package threatintel
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var sha256Regexp = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// Lookuper returns matches of hashes, hashes without match are absent
+type Lookuper interface {
+	Lookup(ctx context.Context, hashes []string) (map[string]reporter.ThreatIntel, error)
+}
+
+// LoadDB loads hash database, the file is either a bloom filter written
+// by Bloom.WriteTo or a list of sha256 with one per line
+func LoadDB(path string) (Lookuper, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	source := filepath.Base(path)
+	if bytes.HasPrefix(b, []byte(bloomMagic)) {
+		bloom, err := ReadBloom(bytes.NewReader(b))
+		if err != nil {
+			return nil, errors.Wrapf(err, "hash db %#v", path)
+		}
+		bloom.Source = source
+		return bloom, nil
+	}
+
+	set := &HashSet{Source: source, hashes: map[string]struct{}{}}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if !sha256Regexp.MatchString(line) {
+			return nil, errors.Errorf("hash db %#v: line %d isn't a sha256", path, n)
+		}
+		set.hashes[line] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+type HashSet struct {
+	Source string
+	hashes map[string]struct{}
+}
+
+func (s *HashSet) Lookup(ctx context.Context, hashes []string) (map[string]reporter.ThreatIntel, error) {
+	matches := map[string]reporter.ThreatIntel{}
+	for _, h := range hashes {
+		if _, ok := s.hashes[h]; ok {
+			matches[h] = reporter.ThreatIntel{SHA256: h, Tag: "blacklist", Source: s.Source}
+		}
+	}
+
+	return matches, nil
+}
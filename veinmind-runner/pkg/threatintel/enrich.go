@@ -0,0 +1,96 @@
+package threatintel
+
+import (
+	"context"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"sort"
+)
+
+// Enricher looks up hashes of events and caches results of the run
+type Enricher struct {
+	lookupers []Lookuper
+	// cache holds results of looked up hashes, nil means no match
+	cache map[string]*reporter.ThreatIntel
+}
+
+func NewEnricher(lookupers ...Lookuper) *Enricher {
+	return &Enricher{
+		lookupers: lookupers,
+		cache:     map[string]*reporter.ThreatIntel{},
+	}
+}
+
+// Enrich adds threat intelligence to events whose hashes are matched and
+// elevates their level to critical, number of matched events is returned.
+// Failed lookups are skipped with warning rather than failing the scan
+func (e *Enricher) Enrich(ctx context.Context, events []reporter.Event, hashesOf func(evt reporter.Event) []string) int {
+	pending := []string{}
+	seen := map[string]struct{}{}
+	for _, evt := range events {
+		for _, h := range hashesOf(evt) {
+			if _, ok := e.cache[h]; ok {
+				continue
+			}
+			if _, ok := seen[h]; ok {
+				continue
+			}
+			seen[h] = struct{}{}
+			pending = append(pending, h)
+		}
+	}
+	sort.Strings(pending)
+
+	if len(pending) > 0 {
+		found := map[string]reporter.ThreatIntel{}
+		failed := false
+		for _, l := range e.lookupers {
+			matches, err := l.Lookup(ctx, pending)
+			if err != nil {
+				log.Warnf("Threat intelligence lookup error, events are not enriched by it: %s\n", err.Error())
+				failed = true
+				continue
+			}
+
+			for h, m := range matches {
+				if _, ok := found[h]; !ok {
+					found[h] = m
+				}
+			}
+		}
+
+		for _, h := range pending {
+			if m, ok := found[h]; ok {
+				m := m
+				e.cache[h] = &m
+			} else if !failed {
+				// Hashes aren't cached as unmatched when a lookup failed,
+				// so that they're looked up again
+				e.cache[h] = nil
+			}
+		}
+	}
+
+	matched := 0
+	for i := range events {
+		evt := &events[i]
+		for _, h := range hashesOf(*evt) {
+			m := e.cache[h]
+			if m == nil {
+				continue
+			}
+
+			evt.ThreatIntel = append(evt.ThreatIntel, *m)
+		}
+
+		if len(evt.ThreatIntel) > 0 {
+			matched++
+			if reporter.LevelRank(evt.Level) < reporter.LevelRank(report.Critical) {
+				evt.Level = report.Critical
+			}
+		}
+	}
+
+	return matched
+}
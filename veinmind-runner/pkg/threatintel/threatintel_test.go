@@ -0,0 +1,131 @@
+package threatintel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	evil   = strings.Repeat("e", 64)
+	benign = strings.Repeat("b", 64)
+)
+
+func newEvent(sha256 string) reporter.Event {
+	return reporter.Event{ReportEvent: report.ReportEvent{
+		ID:        "sha256:aa",
+		Level:     report.Medium,
+		AlertType: report.MaliciousFile,
+		AlertDetails: []report.AlertDetail{{
+			MaliciousFileDetail: &report.MaliciousFileDetail{
+				FileDetail: report.FileDetail{Path: "/bin/miner", SHA256: sha256},
+			},
+		}},
+	}}
+}
+
+func hashesOf(evt reporter.Event) []string {
+	return reporter.Hashes(evt.AlertDetails)
+}
+
+func TestLoadDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "threatintel")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	list := filepath.Join(dir, "hashes.txt")
+	assert.NoError(t, ioutil.WriteFile(list, []byte("# blacklist\n"+strings.ToUpper(evil)+"\n\n"), 0644))
+	db, err := LoadDB(list)
+	assert.NoError(t, err)
+	matches, err := db.Lookup(context.Background(), []string{evil, benign})
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+	assert.Equal(t, "hashes.txt", matches[evil].Source)
+
+	malformed := filepath.Join(dir, "malformed.txt")
+	assert.NoError(t, ioutil.WriteFile(malformed, []byte(evil+"\nmd5\n"), 0644))
+	_, err = LoadDB(malformed)
+	assert.Error(t, err)
+
+	bloom := NewBloom(1024, 4)
+	assert.NoError(t, bloom.Add(evil))
+	buf := &bytes.Buffer{}
+	_, err = bloom.WriteTo(buf)
+	assert.NoError(t, err)
+
+	bloomPath := filepath.Join(dir, "hashes.bloom")
+	assert.NoError(t, ioutil.WriteFile(bloomPath, buf.Bytes(), 0644))
+	db, err = LoadDB(bloomPath)
+	assert.NoError(t, err)
+	matches, err = db.Lookup(context.Background(), []string{evil, benign})
+	assert.NoError(t, err)
+	assert.Contains(t, matches, evil)
+	assert.NotContains(t, matches, benign)
+
+	truncated := filepath.Join(dir, "truncated.bloom")
+	assert.NoError(t, ioutil.WriteFile(truncated, buf.Bytes()[:20], 0644))
+	_, err = LoadDB(truncated)
+	assert.Error(t, err)
+}
+
+func TestEnrich(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		req := struct {
+			Hashes []string `json:"hashes"`
+		}{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.LessOrEqual(t, len(req.Hashes), 1)
+
+		matches := []reporter.ThreatIntel{}
+		for _, h := range req.Hashes {
+			if h == evil {
+				matches = append(matches, reporter.ThreatIntel{SHA256: h, Tag: "miner"})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"matches": matches})
+	}))
+	defer server.Close()
+
+	api := NewAPI(server.URL, "secret")
+	api.BatchSize = 1
+	e := NewEnricher(api)
+
+	events := []reporter.Event{newEvent(evil), newEvent(benign), newEvent(evil)}
+	assert.Equal(t, 2, e.Enrich(context.Background(), events, hashesOf))
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, report.Critical, events[0].Level)
+	assert.Equal(t, []reporter.ThreatIntel{{SHA256: evil, Tag: "miner", Source: "api"}}, events[0].ThreatIntel)
+	assert.Equal(t, report.Medium, events[1].Level)
+
+	// Results are cached in the run
+	events = []reporter.Event{newEvent(evil), newEvent(benign)}
+	assert.Equal(t, 1, e.Enrich(context.Background(), events, hashesOf))
+	assert.Equal(t, 2, requests)
+}
+
+func TestEnrichFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	e := NewEnricher(NewAPI(server.URL, ""))
+	events := []reporter.Event{newEvent(evil)}
+	assert.Equal(t, 0, e.Enrich(context.Background(), events, hashesOf))
+	assert.Equal(t, report.Medium, events[0].Level)
+	assert.Empty(t, events[0].ThreatIntel)
+}
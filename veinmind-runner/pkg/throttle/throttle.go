@@ -0,0 +1,244 @@
+// Package throttle lowers concurrency of scans while the host is under
+// load, so that scans of production hosts don't compete with workloads.
+// Responsiveness of the runtime daemon and load average of the host are
+// sampled periodically, scans are throttled to a single image and plugin
+// once either exceeds its threshold and resumed once both settle
+package throttle
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Actions of events
+const (
+	ActionThrottle = "throttle"
+	ActionResume   = "resume"
+)
+
+// resumeRatio and resumeSamples are hysteresis of resuming, samples
+// must stay below resumeRatio of thresholds for resumeSamples in a row
+const (
+	resumeRatio   = 0.8
+	resumeSamples = 3
+)
+
+// Sample is responsiveness of daemon and load average of host at Time,
+// Latency is how long the daemon took to answer a ping and Load is load
+// average of the last minute. Err is set if daemon didn't answer
+type Sample struct {
+	Time    time.Time
+	Latency time.Duration
+	Load    float64
+	Err     error
+}
+
+// Thresholds over which scans are throttled, 0 disables a threshold
+type Thresholds struct {
+	Latency time.Duration
+	Load    float64
+}
+
+// Event is scans throttled or resumed, with the sample causing it
+type Event struct {
+	Time    time.Time     `json:"time"`
+	Action  string        `json:"action"`
+	Reason  string        `json:"reason"`
+	Latency time.Duration `json:"latency"`
+	Load    float64       `json:"load"`
+}
+
+// Stats of throttle, Throttled is total time scans were throttled and
+// Waited is total time images waited to be scanned while throttled
+type Stats struct {
+	Samples   int           `json:"samples"`
+	Throttled time.Duration `json:"throttled"`
+	Waited    time.Duration `json:"waited"`
+	Events    []Event       `json:"events,omitempty"`
+}
+
+// Throttle decides whether scans are throttled from samples
+type Throttle struct {
+	thresholds Thresholds
+	// notify is called with events of throttle, e.g. to log them
+	notify func(Event)
+
+	mu        sync.Mutex
+	throttled bool
+	since     time.Time
+	calm      int
+	running   int
+	changed   chan struct{}
+	stats     Stats
+}
+
+// New returns throttle of thresholds, notify is called on every event
+func New(thresholds Thresholds, notify func(Event)) (*Throttle, error) {
+	if thresholds.Latency < 0 || thresholds.Load < 0 {
+		return nil, errors.New("throttle thresholds must not be negative")
+	}
+	if thresholds.Latency == 0 && thresholds.Load == 0 {
+		return nil, errors.New("no throttle threshold")
+	}
+	if notify == nil {
+		notify = func(Event) {}
+	}
+	return &Throttle{thresholds: thresholds, notify: notify, changed: make(chan struct{}), stats: Stats{Events: []Event{}}}, nil
+}
+
+// reason returns why sample exceeds thresholds scaled by ratio, empty
+// string is returned if it doesn't
+func (t *Throttle) reason(s Sample, ratio float64) string {
+	reasons := []string{}
+	if t.thresholds.Latency > 0 {
+		if s.Err != nil {
+			reasons = append(reasons, "daemon unresponsive: "+s.Err.Error())
+		} else if float64(s.Latency) > float64(t.thresholds.Latency)*ratio {
+			reasons = append(reasons, "ping latency "+s.Latency.Round(time.Millisecond).String())
+		}
+	}
+	if t.thresholds.Load > 0 && s.Load > t.thresholds.Load*ratio {
+		reasons = append(reasons, "load average "+strconv.FormatFloat(s.Load, 'f', 2, 64))
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// Observe throttles scans if sample exceeds thresholds, and resumes
+// them once samples stay below thresholds for a while
+func (t *Throttle) Observe(s Sample) {
+	t.mu.Lock()
+	t.stats.Samples++
+
+	var evt *Event
+	if !t.throttled {
+		if reason := t.reason(s, 1); reason != "" {
+			t.throttled, t.since, t.calm = true, s.Time, 0
+			evt = &Event{Time: s.Time, Action: ActionThrottle, Reason: reason, Latency: s.Latency, Load: s.Load}
+		}
+	} else if t.reason(s, resumeRatio) != "" {
+		t.calm = 0
+	} else if t.calm++; t.calm >= resumeSamples {
+		t.throttled = false
+		t.stats.Throttled += s.Time.Sub(t.since)
+		evt = &Event{Time: s.Time, Action: ActionResume, Reason: "load settled", Latency: s.Latency, Load: s.Load}
+		t.broadcast()
+	}
+	if evt != nil {
+		t.stats.Events = append(t.stats.Events, *evt)
+	}
+	t.mu.Unlock()
+
+	if evt != nil {
+		t.notify(*evt)
+	}
+}
+
+// broadcast wakes up waiters of Acquire, mu must be held
+func (t *Throttle) broadcast() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// Throttled reports whether scans are throttled
+func (t *Throttle) Throttled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.throttled
+}
+
+// Threads returns parallelism of plugins of image to scan, which is a
+// single plugin while throttled and threads otherwise
+func (t *Throttle) Threads(threads int) int {
+	if t.Throttled() {
+		return 1
+	}
+	return threads
+}
+
+// Acquire waits until an image may be scanned, images are scanned one
+// at a time while throttled. Release must be called once scan of image
+// finishes, time waited is returned
+func (t *Throttle) Acquire(ctx context.Context) (func(), time.Duration, error) {
+	start := time.Now()
+	for {
+		t.mu.Lock()
+		if !t.throttled || t.running == 0 {
+			t.running++
+			t.stats.Waited += time.Since(start)
+			t.mu.Unlock()
+			break
+		}
+		changed := t.changed
+		t.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			t.mu.Lock()
+			t.stats.Waited += time.Since(start)
+			t.mu.Unlock()
+			return nil, time.Since(start), ctx.Err()
+		}
+	}
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.running--
+			t.broadcast()
+		})
+	}, time.Since(start), nil
+}
+
+// Run observes samples taken by probe every interval until ctx is done,
+// sample interrupted by ctx is dropped
+func (t *Throttle) Run(ctx context.Context, interval time.Duration, probe func(ctx context.Context) Sample) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s := probe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		t.Observe(s)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stats returns statistics of throttle, time throttled so far is
+// counted if scans are still throttled at now
+func (t *Throttle) Stats(now time.Time) Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := t.stats
+	stats.Events = append([]Event{}, t.stats.Events...)
+	if t.throttled {
+		stats.Throttled += now.Sub(t.since)
+	}
+	return stats
+}
+
+// ReadLoadAvg reads load average of the last minute from file of
+// format of /proc/loadavg
+func ReadLoadAvg(path string) (float64, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return 0, errors.Errorf("%s is empty", path)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
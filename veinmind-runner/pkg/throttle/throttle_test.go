@@ -0,0 +1,127 @@
+package throttle
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(Thresholds{}, nil)
+	assert.Error(t, err)
+	_, err = New(Thresholds{Load: -1}, nil)
+	assert.Error(t, err)
+}
+
+func TestObserve(t *testing.T) {
+	events := []Event{}
+	th, err := New(Thresholds{Latency: 200 * time.Millisecond, Load: 4}, func(evt Event) {
+		events = append(events, evt)
+	})
+	require.NoError(t, err)
+
+	start := time.Unix(1700000000, 0)
+	at := func(i int) time.Time { return start.Add(time.Duration(i) * 10 * time.Second) }
+
+	th.Observe(Sample{Time: at(0), Latency: 10 * time.Millisecond, Load: 1})
+	assert.False(t, th.Throttled())
+	assert.Equal(t, 8, th.Threads(8))
+
+	th.Observe(Sample{Time: at(1), Latency: 500 * time.Millisecond, Load: 1})
+	assert.True(t, th.Throttled())
+	assert.Equal(t, 1, th.Threads(8))
+	assert.Equal(t, 1, th.Threads(0))
+
+	// Samples just below thresholds don't resume yet, calm samples in
+	// a row do
+	th.Observe(Sample{Time: at(2), Latency: 190 * time.Millisecond, Load: 1})
+	th.Observe(Sample{Time: at(3), Latency: 10 * time.Millisecond, Load: 1})
+	th.Observe(Sample{Time: at(4), Latency: 10 * time.Millisecond, Load: 1})
+	assert.True(t, th.Throttled())
+	th.Observe(Sample{Time: at(5), Latency: 10 * time.Millisecond, Load: 1})
+	assert.False(t, th.Throttled())
+
+	// Unresponsive daemon and high load throttle as well
+	th.Observe(Sample{Time: at(6), Err: errors.New("timeout"), Load: 5})
+
+	stats := th.Stats(at(8))
+	assert.Equal(t, 7, stats.Samples)
+	assert.Equal(t, 60*time.Second, stats.Throttled)
+	require.Len(t, stats.Events, 3)
+	assert.Equal(t, events, stats.Events)
+	assert.Equal(t, Event{Time: at(1), Action: ActionThrottle, Reason: "ping latency 500ms", Latency: 500 * time.Millisecond, Load: 1}, events[0])
+	assert.Equal(t, ActionResume, events[1].Action)
+	assert.Equal(t, "daemon unresponsive: timeout, load average 5.00", events[2].Reason)
+}
+
+func TestAcquire(t *testing.T) {
+	th, err := New(Thresholds{Load: 4}, nil)
+	require.NoError(t, err)
+
+	// Images are scanned concurrently until throttled
+	r1, _, err := th.Acquire(context.Background())
+	require.NoError(t, err)
+	r2, _, err := th.Acquire(context.Background())
+	require.NoError(t, err)
+
+	th.Observe(Sample{Time: time.Now(), Load: 8})
+	acquired := make(chan func())
+	go func() {
+		r, _, err := th.Acquire(context.Background())
+		assert.NoError(t, err)
+		acquired <- r
+	}()
+
+	r1()
+	select {
+	case <-acquired:
+		t.Fatal("acquired while another image is scanned")
+	case <-time.After(50 * time.Millisecond):
+	}
+	r2()
+	r3 := <-acquired
+	r3()
+	assert.True(t, th.Stats(time.Now()).Waited >= 50*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r4, _, err := th.Acquire(ctx)
+	require.NoError(t, err)
+	cancel()
+	_, _, err = th.Acquire(ctx)
+	assert.Equal(t, context.Canceled, err)
+	r4()
+}
+
+func TestReadLoadAvg(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "loadavg")
+	require.NoError(t, ioutil.WriteFile(path, []byte("3.52 2.10 1.05 2/812 12345\n"), 0644))
+	load, err := ReadLoadAvg(path)
+	require.NoError(t, err)
+	assert.Equal(t, 3.52, load)
+
+	require.NoError(t, ioutil.WriteFile(path, nil, 0644))
+	_, err = ReadLoadAvg(path)
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	th, err := New(Thresholds{Latency: time.Second}, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	probes := 0
+	th.Run(ctx, time.Millisecond, func(ctx context.Context) Sample {
+		if probes++; probes == 3 {
+			cancel()
+			return Sample{Time: time.Now(), Err: ctx.Err()}
+		}
+		return Sample{Time: time.Now(), Latency: time.Millisecond}
+	})
+	assert.Equal(t, 2, th.Stats(time.Now()).Samples)
+	assert.False(t, th.Throttled())
+}
@@ -0,0 +1,229 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	exportInterval  = 5 * time.Second
+	exportBatchSize = 512
+	serviceName     = "veinmind-runner"
+)
+
+// exporter batches finished spans and posts them as OTLP/HTTP JSON
+type exporter struct {
+	endpoint string
+	client   *http.Client
+	mu       sync.Mutex
+	spans    []*Span
+	closeCh  chan struct{}
+	doneCh   chan struct{}
+}
+
+func newExporter(endpoint string) (*exporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("trace: endpoint %#v must be http or https url", endpoint)
+	}
+
+	if !strings.HasSuffix(u.Path, "/v1/traces") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/traces"
+	}
+
+	e := &exporter{
+		endpoint: u.String(),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		closeCh:  make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	go e.loop()
+
+	return e, nil
+}
+
+func (e *exporter) add(s *Span) {
+	e.mu.Lock()
+	e.spans = append(e.spans, s)
+	full := len(e.spans) >= exportBatchSize
+	e.mu.Unlock()
+
+	if full {
+		go e.flush(context.Background())
+	}
+}
+
+func (e *exporter) loop() {
+	defer close(e.doneCh)
+
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.flush(context.Background())
+		case <-e.closeCh:
+			return
+		}
+	}
+}
+
+func (e *exporter) shutdown(ctx context.Context) error {
+	close(e.closeCh)
+	<-e.doneCh
+	return e.flush(ctx)
+}
+
+// flush exports pending spans, failure never fails the scan so that
+// spans are dropped with a warning
+func (e *exporter) flush(ctx context.Context) error {
+	e.mu.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.mu.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(encode(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		log.Warnf("Export %d spans error: %s\n", len(spans), err.Error())
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err = errors.Errorf("trace: export spans: %s", resp.Status)
+		log.Warn(err)
+		return err
+	}
+
+	return nil
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func encodeAttribute(a Attribute) otlpAttribute {
+	attr := otlpAttribute{Key: a.Key}
+	switch v := a.Value.(type) {
+	case string:
+		attr.Value.StringValue = &v
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		attr.Value.IntValue = &s
+	case bool:
+		attr.Value.BoolValue = &v
+	}
+
+	return attr
+}
+
+func encode(spans []*Span) otlpRequest {
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = serviceName
+
+	rs := otlpResourceSpans{}
+	rs.Resource.Attributes = []otlpAttribute{encodeAttribute(String("service.name", serviceName))}
+
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.ctx.traceID[:]),
+			SpanID:            hex.EncodeToString(s.ctx.spanID[:]),
+			Name:              s.name,
+			Kind:              1,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: 1},
+		}
+
+		if s.parentID != ([8]byte{}) {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+
+		for _, a := range s.attrs {
+			span.Attributes = append(span.Attributes, encodeAttribute(a))
+		}
+
+		if s.err != "" {
+			span.Status = otlpStatus{Code: 2, Message: s.err}
+		}
+		s.mu.Unlock()
+
+		scope.Spans = append(scope.Spans, span)
+	}
+
+	rs.ScopeSpans = []otlpScopeSpans{scope}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{rs}}
+}
@@ -0,0 +1,204 @@
+// Package trace records spans of the scan pipeline and exports them
+// through OTLP/HTTP, every function is a no-op until Init is called
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnvTraceParent carries W3C trace context into plugin processes
+const EnvTraceParent = "TRACEPARENT"
+
+var (
+	globalMu sync.RWMutex
+	global   *Tracer
+)
+
+type spanKey struct{}
+
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key string, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+func Int(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+type Tracer struct {
+	exporter *exporter
+	// remote is the parent of root spans, it's set when runner itself
+	// runs inside a trace
+	remote *spanContext
+}
+
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+}
+
+type Span struct {
+	tracer   *Tracer
+	ctx      spanContext
+	parentID [8]byte
+	name     string
+	start    time.Time
+	end      time.Time
+	mu       sync.Mutex
+	attrs    []Attribute
+	err      string
+}
+
+// Init enables tracing and exports spans to OTLP/HTTP endpoint
+func Init(endpoint string) (*Tracer, error) {
+	e, err := newExporter(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tracer{exporter: e}
+	if sc, ok := parseTraceParent(os.Getenv(EnvTraceParent)); ok {
+		t.remote = &sc
+	}
+
+	globalMu.Lock()
+	global = t
+	globalMu.Unlock()
+
+	return t, nil
+}
+
+// Shutdown exports pending spans and disables tracing
+func Shutdown(ctx context.Context) error {
+	globalMu.Lock()
+	t := global
+	global = nil
+	globalMu.Unlock()
+
+	if t == nil {
+		return nil
+	}
+
+	return t.exporter.shutdown(ctx)
+}
+
+// Start starts a span as child of the span in ctx, nil span is
+// returned when tracing is disabled
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	globalMu.RLock()
+	t := global
+	globalMu.RUnlock()
+
+	if t == nil {
+		return ctx, nil
+	}
+
+	s := &Span{
+		tracer: t,
+		name:   name,
+		start:  time.Now(),
+		attrs:  attrs,
+	}
+
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && parent != nil {
+		s.ctx.traceID = parent.ctx.traceID
+		s.parentID = parent.ctx.spanID
+	} else if t.remote != nil {
+		s.ctx.traceID = t.remote.traceID
+		s.parentID = t.remote.spanID
+	} else {
+		_, _ = rand.Read(s.ctx.traceID[:])
+	}
+	_, _ = rand.Read(s.ctx.spanID[:])
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// SetError marks span as failed if err isn't nil
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.exporter.add(s)
+}
+
+// TraceParent returns W3C traceparent header of span
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.ctx.traceID[:]), hex.EncodeToString(s.ctx.spanID[:]))
+}
+
+// Environ returns environment variables which propagate the span in
+// ctx into child processes, nil is returned when tracing is disabled
+func Environ(ctx context.Context) []string {
+	s, ok := ctx.Value(spanKey{}).(*Span)
+	if !ok || s == nil {
+		return nil
+	}
+
+	return []string{EnvTraceParent + "=" + s.TraceParent()}
+}
+
+func parseTraceParent(v string) (spanContext, bool) {
+	sc := spanContext{}
+	parts := strings.Split(v, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return sc, false
+	}
+
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return sc, false
+	}
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return sc, false
+	}
+
+	copy(sc.traceID[:], traceID)
+	copy(sc.spanID[:], spanID)
+	return sc, true
+}
@@ -0,0 +1,76 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDisabled(t *testing.T) {
+	ctx, span := Start(context.Background(), "run")
+	assert.Nil(t, span)
+	assert.Nil(t, Environ(ctx))
+
+	// Methods of nil span are no-op
+	span.SetAttributes(String("image.id", "sha256:aa"))
+	span.SetError(errors.New("failed"))
+	span.End()
+	assert.NoError(t, Shutdown(context.Background()))
+}
+
+func TestExport(t *testing.T) {
+	requests := []otlpRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		req := otlpRequest{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+	}))
+	defer server.Close()
+
+	_, err := Init(server.URL)
+	assert.NoError(t, err)
+
+	ctx, run := Start(context.Background(), "run")
+	pluginCtx, plugin := Start(ctx, "plugin", String("plugin.name", "veinmind-weakpass"))
+	plugin.SetAttributes(Int("events", 3))
+	plugin.SetError(errors.New("exit status 1"))
+	plugin.End()
+	run.End()
+
+	env := Environ(pluginCtx)
+	assert.Len(t, env, 1)
+	assert.True(t, strings.HasPrefix(env[0], EnvTraceParent+"=00-"))
+
+	assert.NoError(t, Shutdown(context.Background()))
+	assert.Len(t, requests, 1)
+
+	spans := requests[0].ResourceSpans[0].ScopeSpans[0].Spans
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "plugin", spans[0].Name)
+	assert.Equal(t, spans[1].TraceID, spans[0].TraceID)
+	assert.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+	assert.Equal(t, 2, spans[0].Status.Code)
+	assert.Equal(t, "events", spans[0].Attributes[1].Key)
+	assert.Equal(t, "3", *spans[0].Attributes[1].Value.IntValue)
+	assert.Equal(t, "", spans[1].ParentSpanID)
+
+	// Tracing is disabled after shutdown
+	_, span := Start(context.Background(), "run")
+	assert.Nil(t, span)
+}
+
+func TestParseTraceParent(t *testing.T) {
+	sc, ok := parseTraceParent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	assert.True(t, ok)
+	assert.Equal(t, byte(0x0a), sc.traceID[0])
+	assert.Equal(t, byte(0x31), sc.spanID[7])
+
+	_, ok = parseTraceParent("garbage")
+	assert.False(t, ok)
+}
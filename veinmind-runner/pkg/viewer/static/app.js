@@ -0,0 +1,109 @@
+// Events are paginated by the server, the page only holds one window
+// of filtered events at a time
+(function () {
+  var limit = 100;
+  var offset = 0;
+  var total = 0;
+  var form = document.getElementById("filter");
+
+  function query(extra) {
+    var params = new URLSearchParams(new FormData(form));
+    Object.keys(extra || {}).forEach(function (k) { params.set(k, extra[k]); });
+    return params.toString();
+  }
+
+  function cell(row, text, cls) {
+    var td = document.createElement("td");
+    td.textContent = text;
+    if (cls) { td.className = cls; }
+    row.appendChild(td);
+    return td;
+  }
+
+  // Suggestions are text, they're never rendered as html
+  function remediation(td, evt) {
+    (evt.remediation || []).forEach(function (s) {
+      var pre = document.createElement("pre");
+      pre.className = "remediation";
+      pre.textContent = s;
+      td.appendChild(pre);
+    });
+  }
+
+  function describe(evt) {
+    return (evt.alert_details || []).map(function (d) {
+      var detail = Object.keys(d).map(function (k) { return d[k]; })[0] || {};
+      return [detail.path, detail.username, detail.key, detail.instruction, detail.scheme,
+        detail.malicious_name || detail.description || detail.rule_description || detail.reason]
+        .filter(Boolean).join(": ");
+    }).join("; ");
+  }
+
+  function imageName(evt) {
+    var image = evt.image;
+    if (image) {
+      return (image.repo_refs || [])[0] || (image.repo_digests || [])[0] || image.id;
+    }
+    if (evt.image_refs && evt.image_refs.length) { return evt.image_refs[0]; }
+    return evt.id;
+  }
+
+  function load() {
+    fetch("api/events?" + query({ offset: offset, limit: limit }))
+      .then(function (resp) { return resp.json(); })
+      .then(function (page) {
+        total = page.total;
+        var body = document.getElementById("events");
+        body.innerHTML = "";
+        page.events.forEach(function (evt) {
+          var row = document.createElement("tr");
+          cell(row, imageName(evt));
+          cell(row, evt.level, evt.level);
+          cell(row, evt.alert_type);
+          remediation(cell(row, describe(evt), "detail"), evt);
+          body.appendChild(row);
+        });
+        var end = Math.min(offset + page.events.length, total);
+        document.getElementById("position").textContent =
+          (total ? offset + 1 : 0) + "-" + end + " of " + total;
+        document.getElementById("export-json").href = "api/export?" + query({ format: "json" });
+        document.getElementById("export-csv").href = "api/export?" + query({ format: "csv" });
+      });
+  }
+
+  function facets() {
+    fetch("api/facets")
+      .then(function (resp) { return resp.json(); })
+      .then(function (f) {
+        [["image", f.images], ["plugin", f.plugins], ["level", f.levels], ["alert", f.alerts]]
+          .forEach(function (pair) {
+            var select = form.elements[pair[0]];
+            pair[1].forEach(function (facet) {
+              var option = document.createElement("option");
+              option.value = facet.value;
+              option.textContent = facet.value + " (" + facet.count + ")";
+              select.appendChild(option);
+            });
+          });
+      });
+  }
+
+  form.addEventListener("submit", function (e) {
+    e.preventDefault();
+    offset = 0;
+    load();
+  });
+  document.getElementById("prev").addEventListener("click", function () {
+    offset = Math.max(0, offset - limit);
+    load();
+  });
+  document.getElementById("next").addEventListener("click", function () {
+    if (offset + limit < total) {
+      offset += limit;
+      load();
+    }
+  });
+
+  facets();
+  load();
+})();
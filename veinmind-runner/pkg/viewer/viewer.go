@@ -0,0 +1,354 @@
+package viewer
+
+import (
+	"embed"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/chaitin/libveinmind/go/plugin/log"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/pkg/errors"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Limits of events in a page, the UI never loads the whole report so
+// that reports with hundreds of thousands of events stay responsive
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Export formats of filtered events
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+//go:embed static
+var static embed.FS
+
+// Viewer serves the events of a report and the single page UI browsing
+// them, all assets are embedded so that it works offline
+type Viewer struct {
+	doc    *reporter.Report
+	rows   []row
+	static http.Handler
+}
+
+// row is the searchable fields of an event, they are computed once
+// since every request scans all of them
+type row struct {
+	image  string
+	plugin string
+	level  string
+	alert  string
+	text   string
+}
+
+// Filter selects events, empty fields match everything and Query
+// matches details of event case-insensitively
+type Filter struct {
+	Image  string
+	Plugin string
+	Level  string
+	Alert  string
+	Query  string
+}
+
+// Page is a window of filtered events, Total is the number of all
+// filtered events
+type Page struct {
+	Total  int              `json:"total"`
+	Offset int              `json:"offset"`
+	Limit  int              `json:"limit"`
+	Events []reporter.Event `json:"events"`
+}
+
+type Facet struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets is the distinct values of filterable fields of report
+type Facets struct {
+	Images  []Facet `json:"images"`
+	Plugins []Facet `json:"plugins"`
+	Levels  []Facet `json:"levels"`
+	Alerts  []Facet `json:"alerts"`
+}
+
+func New(doc *reporter.Report) (*Viewer, error) {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		return nil, err
+	}
+
+	// Events don't record their plugin, it's known from the
+	// suppression or the artifacts registered for the event
+	artifacts := map[string]string{}
+	for _, a := range doc.Metadata.Artifacts {
+		artifacts[a.Artifact] = a.Plugin
+	}
+
+	v := &Viewer{doc: doc, static: http.FileServer(http.FS(sub))}
+	for _, evt := range doc.Events {
+		r := row{
+			image: displayImage(evt),
+			level: reporter.LevelString(evt.Level),
+			alert: reporter.AlertTypeString(evt.AlertType),
+		}
+		if evt.Suppressed != nil {
+			r.plugin = evt.Suppressed.Plugin
+		}
+		for _, a := range evt.Artifacts {
+			if r.plugin == "" {
+				r.plugin = artifacts[a]
+			}
+		}
+
+		details, _ := json.Marshal(evt.AlertDetails)
+		r.text = strings.ToLower(r.image + "\x00" + reporter.Describe(evt.AlertDetails) + "\x00" + string(details))
+		v.rows = append(v.rows, r)
+	}
+
+	return v, nil
+}
+
+// displayImage returns the name of image of event shown and filtered
+// by the UI
+func displayImage(evt reporter.Event) string {
+	if evt.Image != nil {
+		return evt.Image.Name()
+	}
+	if len(evt.ImageRefs) > 0 {
+		return evt.ImageRefs[0]
+	}
+	return evt.ID
+}
+
+func (f Filter) match(r row) bool {
+	switch {
+	case f.Image != "" && f.Image != r.image:
+		return false
+	case f.Plugin != "" && f.Plugin != r.plugin:
+		return false
+	case f.Level != "" && !strings.EqualFold(f.Level, r.level):
+		return false
+	case f.Alert != "" && !strings.EqualFold(f.Alert, r.alert):
+		return false
+	case f.Query != "" && !strings.Contains(r.text, strings.ToLower(f.Query)):
+		return false
+	}
+	return true
+}
+
+// Filter returns events of report selected by filter in report order
+func (v *Viewer) Filter(f Filter) []reporter.Event {
+	events := []reporter.Event{}
+	for i, r := range v.rows {
+		if f.match(r) {
+			events = append(events, v.doc.Events[i])
+		}
+	}
+	return events
+}
+
+// Page returns the window of filtered events at offset
+func (v *Viewer) Page(f Filter, offset int, limit int) Page {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	page := Page{Offset: offset, Limit: limit, Events: []reporter.Event{}}
+	for i, r := range v.rows {
+		if !f.match(r) {
+			continue
+		}
+		if page.Total >= offset && len(page.Events) < limit {
+			page.Events = append(page.Events, v.doc.Events[i])
+		}
+		page.Total++
+	}
+	return page
+}
+
+// Facets returns distinct values of filterable fields with counts of
+// events, values are ordered by count
+func (v *Viewer) Facets() Facets {
+	images, plugins, levels, alerts := map[string]int{}, map[string]int{}, map[string]int{}, map[string]int{}
+	for _, r := range v.rows {
+		images[r.image]++
+		if r.plugin != "" {
+			plugins[r.plugin]++
+		}
+		levels[r.level]++
+		alerts[r.alert]++
+	}
+
+	return Facets{
+		Images:  facets(images),
+		Plugins: facets(plugins),
+		Levels:  facets(levels),
+		Alerts:  facets(alerts),
+	}
+}
+
+func facets(counts map[string]int) []Facet {
+	result := []Facet{}
+	for value, count := range counts {
+		result = append(result, Facet{Value: value, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+	return result
+}
+
+func (v *Viewer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	switch r.URL.Path {
+	case "/api/events":
+		offset, limit, err := pageParams(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, v.Page(parseFilter(r.URL.Query()), offset, limit))
+	case "/api/facets":
+		writeJSON(w, http.StatusOK, v.Facets())
+	case "/api/export":
+		v.export(w, r.URL.Query())
+	default:
+		v.static.ServeHTTP(w, r)
+	}
+}
+
+func parseFilter(q url.Values) Filter {
+	return Filter{
+		Image:  q.Get("image"),
+		Plugin: q.Get("plugin"),
+		Level:  q.Get("level"),
+		Alert:  q.Get("alert"),
+		Query:  q.Get("q"),
+	}
+}
+
+func pageParams(q url.Values) (int, int, error) {
+	offset, limit := 0, DefaultLimit
+	if s := q.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, 0, errors.Errorf("invalid offset %#v", s)
+		}
+		offset = n
+	}
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, 0, errors.Errorf("invalid limit %#v", s)
+		}
+		limit = n
+	}
+	return offset, limit, nil
+}
+
+// export writes filtered events as attachment, JSON export is a report
+// document with metadata of the viewed report
+func (v *Viewer) export(w http.ResponseWriter, q url.Values) {
+	events := v.Filter(parseFilter(q))
+
+	switch format := q.Get("format"); format {
+	case "", FormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="events.json"`)
+		err := reporter.WriteJSON(w, reporter.Report{
+			SchemaVersion:      reporter.SchemaVersion,
+			FingerprintVersion: v.doc.FingerprintVersion,
+			Metadata:           v.doc.Metadata,
+			Events:             events,
+		})
+		if err != nil {
+			log.Error(err)
+		}
+	case FormatCSV:
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="events.csv"`)
+		if err := writeCSV(w, events); err != nil {
+			log.Error(err)
+		}
+	default:
+		writeError(w, http.StatusBadRequest, errors.Errorf("unknown export format: %#v", format))
+	}
+}
+
+func writeCSV(w io.Writer, events []reporter.Event) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"image", "level", "alert", "detail", "fingerprint"}); err != nil {
+		return err
+	}
+	for _, evt := range events {
+		err := cw.Write([]string{
+			displayImage(evt),
+			reporter.LevelString(evt.Level),
+			reporter.AlertTypeString(evt.AlertType),
+			reporter.Describe(evt.AlertDetails),
+			evt.Fingerprint,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// CheckListen refuses addresses other than loopback ones unless remote
+// access is allowed, reports are sensitive and the viewer has no auth
+func CheckListen(address string, allowRemote bool) error {
+	if allowRemote {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrapf(err, "listen address %#v", address)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return errors.Errorf("listen address %#v is not loopback, use --allow-remote to expose report", address)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error(err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
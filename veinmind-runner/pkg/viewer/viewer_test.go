@@ -0,0 +1,142 @@
+package viewer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/report"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/reporter"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testReport() *reporter.Report {
+	events := []reporter.Event{}
+	for i := 0; i < 250; i++ {
+		events = append(events, reporter.Event{
+			ReportEvent: report.ReportEvent{
+				ID:        "sha256:aa",
+				Level:     report.High,
+				AlertType: report.Weakpass,
+				AlertDetails: []report.AlertDetail{{
+					WeakpassDetail: &report.WeakpassDetail{Username: "root"},
+				}},
+			},
+			ImageRefs: []string{"nginx:latest"},
+		})
+	}
+	events = append(events, reporter.Event{
+		ReportEvent: report.ReportEvent{
+			ID:        "sha256:bb",
+			Level:     report.Critical,
+			AlertType: report.Backdoor,
+			AlertDetails: []report.AlertDetail{{
+				BackdoorDetail: &report.BackdoorDetail{FileDetail: report.FileDetail{Path: "/etc/crontab"}, Description: "reverse shell"},
+			}},
+		},
+		ImageRefs: []string{"redis:latest"},
+		Artifacts: []string{"/artifacts/crontab"},
+	})
+
+	return &reporter.Report{
+		SchemaVersion: reporter.SchemaVersion,
+		Metadata: reporter.Metadata{Artifacts: []reporter.Artifact{{
+			ImageID:  "sha256:bb",
+			Plugin:   "veinmind-backdoor",
+			Artifact: "/artifacts/crontab",
+		}}},
+		Events: events,
+	}
+}
+
+func get(t *testing.T, ts *httptest.Server, path string) (*http.Response, []byte) {
+	resp, err := http.Get(ts.URL + path)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp, b
+}
+
+func TestViewer(t *testing.T) {
+	v, err := New(testReport())
+	assert.NoError(t, err)
+	ts := httptest.NewServer(v)
+	defer ts.Close()
+
+	resp, body := get(t, ts, "/")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "app.js")
+
+	// Events are paginated
+	resp, body = get(t, ts, "/api/events?offset=200")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	page := Page{}
+	assert.NoError(t, json.Unmarshal(body, &page))
+	assert.Equal(t, 251, page.Total)
+	assert.Len(t, page.Events, 51)
+
+	_, body = get(t, ts, "/api/events?limit=100000")
+	page = Page{}
+	assert.NoError(t, json.Unmarshal(body, &page))
+	assert.Equal(t, MaxLimit, page.Limit)
+
+	// Filters are combined
+	for _, path := range []string{
+		"/api/events?level=critical",
+		"/api/events?plugin=veinmind-backdoor",
+		"/api/events?image=redis:latest&q=REVERSE",
+	} {
+		_, body = get(t, ts, path)
+		page = Page{}
+		assert.NoError(t, json.Unmarshal(body, &page))
+		assert.Equal(t, 1, page.Total)
+		assert.Equal(t, "sha256:bb", page.Events[0].ID)
+	}
+
+	resp, _ = get(t, ts, "/api/events?offset=x")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	_, body = get(t, ts, "/api/facets")
+	facets := Facets{}
+	assert.NoError(t, json.Unmarshal(body, &facets))
+	assert.Equal(t, []Facet{{Value: "nginx:latest", Count: 250}, {Value: "redis:latest", Count: 1}}, facets.Images)
+	assert.Equal(t, []Facet{{Value: "veinmind-backdoor", Count: 1}}, facets.Plugins)
+}
+
+func TestExport(t *testing.T) {
+	v, err := New(testReport())
+	assert.NoError(t, err)
+	ts := httptest.NewServer(v)
+	defer ts.Close()
+
+	_, body := get(t, ts, "/api/export?format=json&level=critical")
+	doc, err := reporter.Parse(body)
+	assert.NoError(t, err)
+	assert.Len(t, doc.Events, 1)
+	assert.Len(t, doc.Metadata.Artifacts, 1)
+
+	resp, body := get(t, ts, "/api/export?format=csv&q=root")
+	assert.Equal(t, "text/csv", resp.Header.Get("Content-Type"))
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 251)
+	assert.Equal(t, []string{"nginx:latest", "High", "Weakpass", "weak password of user root", ""}, records[1])
+
+	resp, _ = get(t, ts, "/api/export?format=xml")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestCheckListen(t *testing.T) {
+	for _, address := range []string{"127.0.0.1:8080", "localhost:8080", "[::1]:8080"} {
+		assert.NoError(t, CheckListen(address, false))
+	}
+	for _, address := range []string{":8080", "0.0.0.0:8080", "10.0.0.1:8080", "8080"} {
+		assert.Error(t, CheckListen(address, false))
+	}
+	assert.NoError(t, CheckListen("0.0.0.0:8080", true))
+}
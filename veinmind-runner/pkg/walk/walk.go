@@ -0,0 +1,235 @@
+// Package walk walks merged filesystem of an image once for walk
+// service of plugins, plugins page through entries matching their
+// filters instead of walking the image each
+package walk
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/hash"
+	commonWalk "github.com/chaitin/veinmind-tools/veinmind-common/go/service/walk"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Page sizes of walk service
+const (
+	DefaultPageSize = 1000
+	MaxPageSize     = 10000
+)
+
+// Walker walks filesystem of image, api.Image is a Walker
+type Walker interface {
+	Walk(root string, fn filepath.WalkFunc) error
+}
+
+// Stat is walk of image shared by plugins, Saved is walks of plugins
+// spared by the shared walk estimated by duration of the shared walk
+type Stat struct {
+	ImageID string        `json:"image_id"`
+	Entries int           `json:"entries"`
+	Plugins []string      `json:"plugins"`
+	Served  int64         `json:"served"`
+	Walk    time.Duration `json:"walk"`
+	Scan    time.Duration `json:"scan"`
+	Saved   time.Duration `json:"saved"`
+}
+
+// Shared is entries of image walked on the first request of plugins
+type Shared struct {
+	imageID string
+	walker  Walker
+	hash    func(path string) (hash.Digest, error)
+	once    sync.Once
+	entries []commonWalk.Entry
+	err     error
+	elapsed time.Duration
+	mu      sync.Mutex
+	plugins map[string]struct{}
+	served  int64
+}
+
+// New returns shared walk of image, hash returns digests of regular
+// files for filters asking for them
+func New(imageID string, walker Walker, hash func(path string) (hash.Digest, error)) *Shared {
+	return &Shared{
+		imageID: imageID,
+		walker:  walker,
+		hash:    hash,
+		plugins: map[string]struct{}{},
+	}
+}
+
+// walk walks image once, unreadable paths are skipped as plugins
+// walking by themselves do
+func (s *Shared) walk() error {
+	s.once.Do(func() {
+		start := time.Now()
+		s.err = s.walker.Walk("/", func(p string, info os.FileInfo, err error) error {
+			if err != nil || info == nil {
+				return nil
+			}
+			s.entries = append(s.entries, commonWalk.Entry{
+				Path: p,
+				Mode: info.Mode(),
+				Size: info.Size(),
+			})
+			return nil
+		})
+		s.elapsed = time.Since(start)
+	})
+	return s.err
+}
+
+// Page returns entries matching filter of request for plugin
+func (s *Shared) Page(plugin string, req commonWalk.Request) (commonWalk.Page, error) {
+	if req.ImageID != s.imageID {
+		return commonWalk.Page{}, errors.Errorf("walk: image %#v isn't being scanned", req.ImageID)
+	}
+	if err := Check(req.Filter); err != nil {
+		return commonWalk.Page{}, err
+	}
+	if err := s.walk(); err != nil {
+		return commonWalk.Page{}, err
+	}
+	if req.Cursor < 0 || req.Cursor > len(s.entries) {
+		return commonWalk.Page{}, errors.Errorf("walk: invalid cursor %d", req.Cursor)
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	page := commonWalk.Page{Entries: []commonWalk.Entry{}}
+	i := req.Cursor
+	for ; i < len(s.entries) && len(page.Entries) < limit; i++ {
+		e := s.entries[i]
+		if !Match(req.Filter, e) {
+			continue
+		}
+		if req.Filter.Hash && e.Mode.IsRegular() {
+			d, err := s.hash(e.Path)
+			if err != nil {
+				e.Error = err.Error()
+			}
+			e.SHA256, e.MD5 = d.SHA256, d.MD5
+		}
+		page.Entries = append(page.Entries, e)
+	}
+	page.Next = i
+	page.Done = i >= len(s.entries)
+
+	s.mu.Lock()
+	s.plugins[plugin] = struct{}{}
+	s.served += int64(len(page.Entries))
+	s.mu.Unlock()
+	return page, nil
+}
+
+// Size returns bytes of regular files of image, image is walked if it
+// isn't yet so that plugins share the walk
+func (s *Shared) Size() (int64, error) {
+	if err := s.walk(); err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, e := range s.entries {
+		if e.Mode.IsRegular() {
+			size += e.Size
+		}
+	}
+	return size, nil
+}
+
+// Used returns whether any plugin walked image by the service
+func (s *Shared) Used() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.plugins) > 0
+}
+
+// Stat returns statistics of walk, scan is wall time of scan of image.
+// Every plugin using the service would have walked image by itself
+func (s *Shared) Stat(scan time.Duration) Stat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat := Stat{
+		ImageID: s.imageID,
+		Entries: len(s.entries),
+		Plugins: []string{},
+		Served:  s.served,
+		Walk:    s.elapsed,
+		Scan:    scan,
+	}
+	for p := range s.plugins {
+		stat.Plugins = append(stat.Plugins, p)
+	}
+	sort.Strings(stat.Plugins)
+	if len(stat.Plugins) > 1 {
+		stat.Saved = time.Duration(len(stat.Plugins)-1) * s.elapsed
+	}
+	return stat
+}
+
+// Check validates globs of filter
+func Check(f commonWalk.Filter) error {
+	for _, g := range f.Globs {
+		if _, err := path.Match(g, ""); err != nil {
+			return errors.Wrapf(err, "walk: glob %#v", g)
+		}
+	}
+	if f.MaxSize > 0 && f.MinSize > f.MaxSize {
+		return errors.Errorf("walk: min size %d exceeds max size %d", f.MinSize, f.MaxSize)
+	}
+	return nil
+}
+
+// Match returns whether entry matches filter, globs of filter must be
+// checked
+func Match(f commonWalk.Filter, e commonWalk.Entry) bool {
+	if e.Mode.IsDir() && !f.Dirs {
+		return false
+	}
+	if e.Size < f.MinSize || (f.MaxSize > 0 && e.Size > f.MaxSize) {
+		return false
+	}
+
+	base := path.Base(e.Path)
+	if len(f.Extensions) > 0 {
+		matched := false
+		for _, ext := range f.Extensions {
+			if strings.HasSuffix(strings.ToLower(base), strings.ToLower(ext)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(f.Globs) > 0 {
+		matched := false
+		for _, g := range f.Globs {
+			if ok, _ := path.Match(g, e.Path); ok {
+				matched = true
+				break
+			}
+			if ok, _ := path.Match(g, base); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package walk
+
+import (
+	"github.com/chaitin/veinmind-tools/veinmind-common/go/service/hash"
+	commonWalk "github.com/chaitin/veinmind-tools/veinmind-common/go/service/walk"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fileInfo struct {
+	name string
+	mode os.FileMode
+	size int64
+}
+
+func (f fileInfo) Name() string       { return f.name }
+func (f fileInfo) Size() int64        { return f.size }
+func (f fileInfo) Mode() os.FileMode  { return f.mode }
+func (f fileInfo) ModTime() time.Time { return time.Time{} }
+func (f fileInfo) IsDir() bool        { return f.mode.IsDir() }
+func (f fileInfo) Sys() interface{}   { return nil }
+
+type fakeWalker struct {
+	files []fileInfo
+	walks int
+}
+
+func (w *fakeWalker) Walk(root string, fn filepath.WalkFunc) error {
+	w.walks++
+	for _, f := range w.files {
+		if err := fn(f.name, fileInfo{name: path.Base(f.name), mode: f.mode, size: f.size}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newShared() (*Shared, *fakeWalker) {
+	w := &fakeWalker{files: []fileInfo{
+		{name: "/", mode: os.ModeDir | 0755},
+		{name: "/app", mode: os.ModeDir | 0755},
+		{name: "/app/lib.JAR", mode: 0644, size: 2048},
+		{name: "/app/app.py", mode: 0644, size: 10},
+		{name: "/etc/passwd", mode: 0644, size: 100},
+		{name: "/opt/big.jar", mode: 0644, size: 1 << 30},
+	}}
+	return New("sha256:aa", w, func(p string) (hash.Digest, error) {
+		return hash.Digest{SHA256: "sha256 of " + p}, nil
+	}), w
+}
+
+func collect(t *testing.T, s *Shared, plugin string, req commonWalk.Request) []string {
+	paths := []string{}
+	for {
+		page, err := s.Page(plugin, req)
+		assert.NoError(t, err)
+		for _, e := range page.Entries {
+			paths = append(paths, e.Path)
+		}
+		if page.Done {
+			return paths
+		}
+		req.Cursor = page.Next
+	}
+}
+
+func TestPage(t *testing.T) {
+	s, w := newShared()
+
+	jars := commonWalk.Request{ImageID: "sha256:aa", Filter: commonWalk.Filter{Extensions: []string{".jar"}, MaxSize: 1 << 20}}
+	assert.Equal(t, []string{"/app/lib.JAR"}, collect(t, s, "veinmind-java", jars))
+	assert.Equal(t, []string{"/etc/passwd"}, collect(t, s, "veinmind-weakpass", commonWalk.Request{
+		ImageID: "sha256:aa",
+		Filter:  commonWalk.Filter{Globs: []string{"/etc/*"}},
+	}))
+	// Pages of a single entry walk all entries
+	assert.Equal(t, []string{"/app/lib.JAR", "/app/app.py", "/etc/passwd", "/opt/big.jar"}, collect(t, s, "veinmind-sensitive", commonWalk.Request{
+		ImageID: "sha256:aa",
+		Limit:   1,
+	}))
+	assert.Equal(t, []string{"/", "/app"}, collect(t, s, "veinmind-asset", commonWalk.Request{
+		ImageID: "sha256:aa",
+		Filter:  commonWalk.Filter{Dirs: true, MaxSize: 1},
+	}))
+	// Image is walked once for all plugins
+	assert.Equal(t, 1, w.walks)
+
+	page, err := s.Page("veinmind-java", commonWalk.Request{ImageID: "sha256:aa", Filter: commonWalk.Filter{Globs: []string{"app.py"}, Hash: true}})
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256 of /app/app.py", page.Entries[0].SHA256)
+
+	stat := s.Stat(time.Second)
+	assert.Equal(t, 6, stat.Entries)
+	assert.Equal(t, []string{"veinmind-asset", "veinmind-java", "veinmind-sensitive", "veinmind-weakpass"}, stat.Plugins)
+	assert.Equal(t, 3*stat.Walk, stat.Saved)
+}
+
+func TestPageInvalid(t *testing.T) {
+	s, w := newShared()
+	assert.False(t, s.Used())
+
+	for _, req := range []commonWalk.Request{
+		{ImageID: "sha256:bb"},
+		{ImageID: "sha256:aa", Filter: commonWalk.Filter{Globs: []string{"["}}},
+		{ImageID: "sha256:aa", Filter: commonWalk.Filter{MinSize: 10, MaxSize: 1}},
+		{ImageID: "sha256:aa", Cursor: 100},
+	} {
+		_, err := s.Page("veinmind-java", req)
+		assert.Error(t, err)
+	}
+	assert.False(t, s.Used())
+
+	// Sizing image walks it for plugins
+	size, err := s.Size()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2048+10+100+1<<30), size)
+	assert.False(t, s.Used())
+	_, err = s.Page("veinmind-java", commonWalk.Request{ImageID: "sha256:aa"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, w.walks)
+}
@@ -2,4 +2,4 @@
 
 export GOPROXY=https://goproxy.io,direct
 go mod tidy
-go build -a -o veinmind-runner ./cmd/cli.go
+go build -a -o veinmind-runner ./cmd
@@ -1,4 +1,4 @@
 go mod tidy
 mkdir -p ./artifacts/${CI_GOOS}-${CI_GOARCH}
 export GOOS="$CI_GOOS" GOARCH="$CI_GOARCH"
-go build -a -o ./artifacts/${CI_GOOS}-${CI_GOARCH}/veinmind-runner_${CI_GOOS}_${CI_GOARCH} ./cmd/cli.go
+go build -a -o ./artifacts/${CI_GOOS}-${CI_GOARCH}/veinmind-runner_${CI_GOOS}_${CI_GOARCH} ./cmd